@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Holds the keys of the depots unlocked in one shell session, served by the
+// same daemon as the session's ephemeral depot
+type agentServer struct {
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+func (s *agentServer) Unlock(args AgentKey, _ *struct{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[args.Depot] = args.Key
+	return nil
+}
+
+func (s *agentServer) Key(depot string, key *[]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*key = s.keys[depot]
+	return nil
+}
+
+// Forgets every key, overwriting them first so they don't linger in memory
+func (s *agentServer) Lock(_ struct{}, _ *struct{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for depot, key := range s.keys {
+		clear(key)
+		delete(s.keys, depot)
+	}
+	return nil
+}
+
+// Arguments to agentServer.Unlock, exported as net/rpc requires
+type AgentKey struct {
+	Depot string
+	Key   []byte
+}
+
+// Returns the name the agent knows the depot selected by the command-line
+// options and environment by or an error if unsuccessful
+func agentDepot(opts options) (string, error) {
+	if opts.ephemeral {
+		return "ephemeral", nil
+	}
+
+	path, err := choosePath()
+	if err != nil || strings.Contains(path, "://") {
+		return path, err
+	}
+
+	return filepath.Abs(path)
+}
+
+// Returns the key the current shell session's agent holds for the depot
+// selected by the command-line options and environment, or nil if it is
+// locked or no agent is running
+func agentKey(opts options) []byte {
+	depot, err := agentDepot(opts)
+	if err != nil {
+		return nil
+	}
+	client, err := dialSession(false)
+	if err != nil {
+		return nil
+	}
+	defer client.Close()
+
+	var key []byte
+	if err = client.Call("Agent.Key", depot, &key); err != nil {
+		return nil
+	}
+
+	return key
+}
+
+// Reports whether the depot was unlocked when the command started but has been
+// locked since, after which long-running commands stop decrypting values
+func lockedAgain(opts options) bool {
+	if _, ok, _ := presetPassword(); ok {
+		return false
+	}
+	return opts.unlockKey != nil && agentKey(opts) == nil
+}
+
+// Asks for the depot's password once and hands the key it derives to the
+// current shell session's agent, so later commands in the session need no
+// password until it is locked again. The password is checked against a value
+// already stowed, or asked for twice if there are none, since a typo would
+// otherwise go on to encrypt new values. Returns an error if unsuccessful.
+func unlock(storage *libdepot.Depot, opts options) error {
+	depot, err := agentDepot(opts)
+	if err != nil {
+		return err
+	}
+
+	keys, err := storage.List("")
+	if err != nil {
+		return err
+	}
+	var encrypted []string
+	for _, k := range keys {
+		if k.Encrypted {
+			encrypted = append(encrypted, k.Key)
+		}
+	}
+
+	var password []byte
+	if len(encrypted) == 0 {
+		password, err = getNewPassword(true, opts.keyfile != "")
+	} else {
+		password, err = getPassword(true, opts.keyfile != "")
+	}
+	if err != nil {
+		return err
+	}
+	if len(encrypted) > 0 {
+		if err = verifyAny(storage, encrypted, password); err != nil {
+			return err
+		}
+	}
+
+	client, err := dialSession(true)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err = client.Call("Agent.Unlock", AgentKey{depot, storage.DeriveKey(password)}, &struct{}{}); err != nil {
+		return err
+	}
+
+	log.Printf("Unlocked %v until depot lock or the end of this shell session\n", depot)
+	return nil
+}
+
+// Returns nil if password decrypts any of the given keys, since values may be
+// stowed under different passwords, or an error if it decrypts none of them
+func verifyAny(storage *libdepot.Depot, keys []string, password []byte) error {
+	var err error
+	for _, key := range keys {
+		if err = storage.Verify(key, password); err == nil {
+			return nil
+		} else if !errors.Is(err, libdepot.ErrBadPassword) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// Makes the current shell session's agent forget the keys of every depot
+// unlocked in it. Returns an error if unsuccessful.
+func lock() error {
+	client, err := dialSession(false)
+	if err != nil {
+		// Nothing was ever unlocked in this session
+		return nil
+	}
+	defer client.Close()
+
+	return client.Call("Agent.Lock", struct{}{}, &struct{}{})
+}
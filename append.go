@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Adds a line read from stdin, or given with --value or --from-file, to the
+// end of the value of the key, or with -n adds it as it is, asking for the
+// password only if the value is encrypted, or up front with -s. Returns an
+// error if unsuccessful.
+func appendValue(storage *libdepot.Depot, opts options) error {
+	val, err := stowValue(opts, storage.MaxValueSize())
+	if err != nil {
+		return err
+	}
+	// A new secret is asked for twice, as stow does
+	getPass := getPassword
+	if _, err = storage.Info(opts.key); errors.Is(err, libdepot.ErrNotFound) {
+		getPass = getNewPassword
+	}
+	password, err := getPass(opts.secret, opts.hasKey())
+	if err != nil {
+		return err
+	}
+
+	add := storage.AppendLine
+	if opts.noNewline {
+		add = storage.Append
+	}
+	err = add(opts.key, val, password)
+	if errors.Is(err, libdepot.ErrPasswordNeeded) && password == nil {
+		if password, err = getPassword(true, opts.hasKey()); err != nil {
+			return err
+		}
+		err = add(opts.key, val, password)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot append to %v: %w", opts.key, err)
+	}
+
+	return nil
+}
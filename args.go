@@ -0,0 +1,1099 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// An option that may be given on the command line
+type option struct {
+	// Given as --name, or as -short if short is not 0
+	name  string
+	short rune
+
+	// What the value it takes is, as in <file>, or "" if it is a switch
+	arg string
+
+	help []string
+}
+
+// An action that may be given on the command line
+type command struct {
+	name string
+
+	// What is given after the action, and how many arguments that is at
+	// least and at most, or -1 for any number
+	args    string
+	minArgs int
+	maxArgs int
+
+	// Whether the arguments are keys, which completion offers the names of
+	keyed bool
+
+	// How many of the arguments, from the first, name keys rather than
+	// patterns or anything else, or -1 if all of them do
+	keyArgs int
+
+	help []string
+
+	// The names of the options it takes, besides commonOptions
+	options []string
+}
+
+// What an option does for one action, in place of what usage says of it for
+// every action that takes it
+type optionHelp struct {
+	// What the value it takes is for the action, or "" if that is the same
+	arg string
+
+	help []string
+}
+
+// Options every action takes
+var commonOptions = []string{"profile", "keyfile", "pass-fd", "pass-file", "ephemeral", "non-interactive", "debug", "help"}
+
+// Every option, in the order usage lists them
+var optionList = []option{
+	{name: "clip", short: 'c', help: []string{
+		"Copy a fetched or generated value, or a TOTP code, to the",
+		"clipboard instead of printing it, and clear it after",
+		"clip-timeout in the config file (Defaults to 45s)",
+	}},
+	{name: "no-newline", short: 'n', help: []string{
+		"No newline character will be printed after fetching a value,",
+		"or put between a value and what append adds to it",
+	}},
+	{name: "secret", short: 's', help: []string{
+		"The provided value is secret and will be encrypted, or",
+		"grep and doctor decrypt encrypted values too",
+	}},
+	{name: "debug", short: 'v', help: []string{
+		"Log the database used, the config and environment that",
+		"chose it, each SQL statement run (without its values),",
+		"and how long each step took, to stderr",
+	}},
+	{name: "help", short: 'h', help: []string{
+		"Print this help message, or the given action's, and exit",
+		"(Also -?)",
+	}},
+	{name: "admin", help: []string{
+		"Let a new user do anything, as the owner of DEPOT_TOKEN can",
+	}},
+	{name: "all", help: []string{
+		"Export every key",
+	}},
+	{name: "addr", arg: "<host:port>", help: []string{
+		"Address for serve to listen on (Defaults to localhost:8080)",
+	}},
+	{name: "backup-dir", arg: "<dir>", help: []string{
+		"Directory for backup to write snapshots to (Defaults to",
+		"DEPOT_BACKUP_DIR, then backup-dir in the config file,",
+		"then $XDG_CONFIG_HOME/depot/backups)",
+	}},
+	{name: "batch", help: []string{
+		"Stow every key=value line read from stdin, as in a .env",
+		"file, or every key in a JSON object, all at once",
+	}},
+	{name: "by", arg: "<n>", help: []string{
+		"Amount for increment to add, which may be negative",
+		"(Defaults to 1)",
+	}},
+	{name: "conflict", arg: "<newest|prompt|keep-both>", help: []string{
+		"How sync settles a key that differs between depots:",
+		"keep the newest value, ask, or keep both with the older",
+		"one under a .conflict key (Defaults to newest)",
+	}},
+	{name: "decrypt", help: []string{
+		"Include secrets in a plain export, decrypted with the",
+		"password (They are left out otherwise!)",
+	}},
+	{name: "env", arg: "<NAME=key>", help: []string{
+		"Give run the value of the key as $NAME, or a key alone",
+		"named as it is by --format env (May be repeated)",
+	}},
+	{name: "ephemeral", help: []string{
+		"Use a depot held in memory for the life of the current",
+		"shell session instead of the database",
+	}},
+	{name: "expires", arg: "<age>", help: []string{
+		"How long a share lasts, such as 15m, 1h, or 2d",
+		"(Defaults to 1h)",
+	}},
+	{name: "force", help: []string{
+		"Stow a secret even if its password is weak, let gen, mv,",
+		"cp, or transfer replace an existing key, or drop a key",
+		"or empty the trash without asking",
+	}},
+	{name: "format", arg: "<json|csv|yaml|env|kdbx>", help: []string{
+		"Export or import plain values in the given format",
+		"instead of an encrypted archive, or export a KeePass",
+		"database with a password of its own (kdbx), fetch",
+		"values with when they were modified and whether they",
+		"are encrypted as one JSON object (json) or shell",
+		"assignments (env), or list keys or print info as JSON",
+		"(json). With json, messages and errors, with the exit",
+		"code, are JSON objects on stderr",
+	}},
+	{name: "field", arg: "<name>", help: []string{
+		"Fetch or stow only the given field of a record, such as",
+		"username, password, url, or notes, leaving its other",
+		"fields alone",
+	}},
+	{name: "from", arg: "<path|uri|manager>", help: []string{
+		"Depot for transfer to take keys from, into this one, or",
+		"the password manager whose store or export import reads",
+		"instead of an archive (pass, keepass, bitwarden, or",
+		"1password)",
+	}},
+	{name: "from-file", arg: "<file>", help: []string{
+		"Stow the whole of the given file, newlines and all,",
+		"instead of a line read from stdin, or with --batch read",
+		"keys and values from it",
+	}},
+	{name: "grpc-addr", arg: "<host:port>", help: []string{
+		"Address for serve to also offer its gRPC API on",
+	}},
+	{name: "csi-socket", arg: "<path>", help: []string{
+		"Unix socket for serve to also act as a provider for the",
+		"Kubernetes Secrets Store CSI driver on",
+	}},
+	{name: "keep", arg: "<n>", help: []string{
+		"Number of snapshots for backup to keep, or 0 to keep",
+		"them all (Defaults to backup-keep in the config file,",
+		"then 10)",
+	}},
+	{name: "key", arg: "<pattern>", help: []string{
+		"Restore or audit only the keys matching the given pattern",
+	}},
+	{name: "keyfile", arg: "<file>", help: []string{
+		"Derive encryption keys from the given keyfile, combined",
+		"with DEPOT_PASS if it is set",
+	}},
+	{name: "length", arg: "<n>", help: []string{
+		"Number of characters (or words) for gen to generate",
+		"(Defaults to 24 characters or 6 words)",
+	}},
+	{name: "move", help: []string{
+		"Drop the keys transfer copies from the depot they were in",
+	}},
+	{name: "names", help: []string{
+		"List only the names of keys, one per line",
+	}},
+	{name: "non-interactive", help: []string{
+		"Fail at once, rather than wait for an answer, wherever",
+		"depot would ask for a password or anything else, as it",
+		"does when DEPOT_NON_INTERACTIVE or CI is set",
+	}},
+	{name: "older-than", arg: "<age>", help: []string{
+		"List keys without a rotation period as stale once they",
+		"are older than the given age, such as 30d, 2w, or 36h",
+		"(Defaults to 90d)",
+	}},
+	{name: "out", arg: "<file>", help: []string{
+		"Write a rendered template, a QR code as a PNG image, an",
+		"attachment, or an encrypted systemd credential to the",
+		"given file, which only you may read, instead of stdout",
+	}},
+	{name: "pass-fd", arg: "<fd>", help: []string{
+		"Read the password from the given file descriptor, as",
+		"inherited from the program running depot, rather than",
+		"from DEPOT_PASS or the terminal",
+	}},
+	{name: "pass-file", arg: "<file>", help: []string{
+		"Read the password from the given file, which only you may",
+		"read, rather than from DEPOT_PASS or the terminal",
+	}},
+	{name: "pattern", arg: "<pattern>", help: []string{
+		"Drop every key matching the given pattern, such as",
+		"'staging/*', after listing them and asking whether to",
+	}},
+	{name: "perm", arg: "<r|w|rw>", help: []string{
+		"Permission for grant to give (Defaults to r)",
+	}},
+	{name: "pick", help: []string{
+		"Fetch the given key if it exists, and otherwise pick one",
+		"from a list filtered as you type, starting with the",
+		"given key if any",
+	}},
+	{name: "prefix", arg: "<prefix>", help: []string{
+		"Prefix of the keys to grant or revoke permission on",
+		"(Defaults to every key)",
+	}},
+	{name: "profile", arg: "<name>", help: []string{
+		"Use the database, namespace, and password sources of the",
+		"given profile in the config file (Defaults to DEPOT_PROFILE,",
+		"then to the profile setting in the config file)",
+	}},
+	{name: "qr", help: []string{
+		"Show a fetched value as a QR code, to scan with a phone",
+	}},
+	{name: "repair", help: []string{
+		"Let doctor repair the problems it safely can: the",
+		"permissions of the database's files, and with -s,",
+		"secrets that lack a key check or share a nonce",
+	}},
+	{name: "since", arg: "<duration|date>", help: []string{
+		"List keys changed, or audit events, since the given",
+		"time, either a duration before now (24h, 7d) or a",
+		"date (2006-01-02)",
+	}},
+	{name: "sort", arg: "<name|modified>", help: []string{
+		"Order for list to show keys in (Defaults to name)",
+	}},
+	{name: "symbols", help: []string{
+		"Include symbols in a generated password",
+	}},
+	{name: "tls-cert", arg: "<file>", help: []string{
+		"Certificate for serve to use for HTTPS and gRPC",
+	}},
+	{name: "tls-key", arg: "<file>", help: []string{
+		"Private key of the certificate given by --tls-cert",
+	}},
+	{name: "to", arg: "<path|uri>", help: []string{
+		"Depot for transfer to copy keys from this one into",
+	}},
+	{name: "user", arg: "<name>", help: []string{
+		"List only the audit events of the given user",
+	}},
+	{name: "uses", arg: "<n>", help: []string{
+		"Number of times a share may be fetched before it is gone",
+		"(Defaults to 1)",
+	}},
+	{name: "value", arg: "<value>", help: []string{
+		"Stow the given value instead of reading it from stdin",
+		"(Not for secrets, which it would leave in your shell",
+		"history)",
+	}},
+	{name: "words", help: []string{
+		"Generate a diceware passphrase instead of a password",
+	}},
+}
+
+// Every action, in the order usage lists them
+var commands = []command{
+	{name: actStow, args: "<key>", minArgs: 0, maxArgs: 1, keyed: true, keyArgs: 1, help: []string{
+		"Read a value from stdin and associate it with the given key,",
+		"or with --batch read many keys and values",
+	}, options: []string{"secret", "force", "batch", "from-file", "value", "field"}},
+	{name: actAppend, args: "<key>", minArgs: 1, maxArgs: 1, keyed: true, keyArgs: 1, help: []string{
+		"Add a line read from stdin to the end of the value of the",
+		"given key, without printing the value, creating it if it",
+		"does not exist",
+	}, options: []string{"secret", "force", "no-newline", "from-file", "value"}},
+	{name: actIncrement, args: "<key>", minArgs: 1, maxArgs: 1, keyed: true, keyArgs: 1, help: []string{
+		"Add one, or --by, to the counter stored under the given",
+		"key in a single step, starting it if it does not exist,",
+		"and print the new count",
+	}, options: []string{"by"}},
+	{name: actFetch, args: "<key>...", minArgs: 0, maxArgs: -1, keyed: true, keyArgs: -1, help: []string{
+		"Print the value associated with the given key, or with",
+		"each of the given keys, to stdout",
+	}, options: []string{"no-newline", "clip", "format", "pick", "qr", "out", "field"}},
+	{name: actDrop, args: "<key> | --pattern <pattern>", minArgs: 0, maxArgs: 1, keyed: true, keyArgs: 1, help: []string{
+		"Remove the given key, or every key matching --pattern,",
+		"from the depot, after asking whether to when run from a",
+		"terminal, and keep their values in the trash for 30 days",
+	}, options: []string{"force", "pattern"}},
+	{name: actTrash, args: "<list|restore|empty> [<key>...]", minArgs: 1, maxArgs: -1, help: []string{
+		"List the dropped keys still in the trash, restore the",
+		"given keys from it, or empty it, of the keys matching",
+		"the given patterns or of every key",
+	}, options: []string{"force", "format"}},
+	{name: actEdit, args: "<key>", minArgs: 1, maxArgs: 1, keyed: true, keyArgs: 1, help: []string{
+		"Open the value associated with the given key in $EDITOR",
+		"and stow it again when it is saved, encrypted if it was",
+	}, options: []string{"secret", "force"}},
+	{name: actGen, args: "<key>", minArgs: 1, maxArgs: 1, keyed: true, keyArgs: 1, help: []string{
+		"Generate a random password (or passphrase with --words),",
+		"stow it encrypted under the given key, and print it",
+	}, options: []string{"length", "symbols", "words", "force", "clip", "no-newline"}},
+	{name: actMove, args: "<key> <dest>", minArgs: 2, maxArgs: 2, keyed: true, keyArgs: 2, help: []string{
+		"Move the value of the given key to a second key",
+	}, options: []string{"force"}},
+	{name: actCopy, args: "<key> <dest>", minArgs: 2, maxArgs: 2, keyed: true, keyArgs: 2, help: []string{
+		"Copy the value of the given key to a second key, asking",
+		"for the password of an encrypted value",
+	}, options: []string{"force"}},
+	{name: actAlias, args: "<alias> <key>", minArgs: 2, maxArgs: 2, keyed: true, keyArgs: 2, help: []string{
+		"Make the alias another name for the given key, so",
+		"fetching either gets the same value (drop the alias to",
+		"remove it)",
+	}, options: []string{"force"}},
+	{name: actTOTP, args: "<key>", minArgs: 1, maxArgs: 1, keyed: true, keyArgs: 1, help: []string{
+		"Print the current two-factor code for the TOTP seed (an",
+		"otpauth:// URI or base32 secret) stored under the key",
+	}, options: []string{"clip", "no-newline"}},
+	{name: actInfo, args: "<key>", minArgs: 1, maxArgs: 1, keyed: true, keyArgs: 1, help: []string{
+		"Print when the given key was modified, whether it is",
+		"encrypted or compressed, and its size, without needing",
+		"its password",
+	}, options: []string{"format"}},
+	{name: actShare, args: "<key>", minArgs: 1, maxArgs: 1, keyed: true, keyArgs: 1, help: []string{
+		"Print a link, or a token for depot serve, that anyone may",
+		"fetch the value of the given key with, once or --uses",
+		"times, until it expires",
+	}, options: []string{"expires", "uses"}},
+	{name: actList, args: "[<pattern>]", minArgs: 0, maxArgs: 1, keyed: true, help: []string{
+		"List the keys matching the given pattern, or every key,",
+		"and whether each is encrypted",
+	}, options: []string{"sort", "since", "names", "format"}},
+	{name: actStale, args: "[<pattern>]", minArgs: 0, maxArgs: 1, keyed: true, help: []string{
+		"List the keys matching the given pattern, or every key,",
+		"that are due to be replaced by their rotation periods or",
+		"were last changed more than --older-than ago",
+	}, options: []string{"older-than", "format"}},
+	{name: actRotation, args: "<key> <age|off>", minArgs: 2, maxArgs: 2, keyed: true, keyArgs: 1, help: []string{
+		"Set how often the given key ought to be replaced, such as",
+		"90d, after which list, info, and stale show it as due, or",
+		"forget its rotation period with off",
+	}},
+	{name: actNamespace, args: "<list|add|remove> [<name>]", minArgs: 1, maxArgs: 2, help: []string{
+		"List the namespaces (the parts of keys before their",
+		"first slash) with passwords of their own, give the",
+		"given one a password of its own, or take it away",
+	}},
+	{name: actAttach, args: "<key> <file>", minArgs: 2, maxArgs: 2, keyed: true, keyArgs: 1, help: []string{
+		"Attach the given file, such as a license or a .p12",
+		"bundle, to the key under the file's name, encrypted",
+		"with the password of its value",
+	}},
+	{name: actGetAttach, args: "<key> [<name>]", minArgs: 1, maxArgs: 2, keyed: true, keyArgs: 1, help: []string{
+		"Write the key's attachment with the given name to stdout",
+		"or to --out, or list its attachments",
+	}, options: []string{"out"}},
+	{name: actGrep, args: "<regexp>", minArgs: 1, maxArgs: 1, help: []string{
+		"List the keys whose values match the given regular",
+		"expression, searching encrypted values as well with -s",
+	}, options: []string{"secret"}},
+	{name: actUI, help: []string{
+		"Browse, search, view, edit, and drop keys in a terminal UI",
+	}},
+	{name: actUnlock, help: []string{
+		"Ask for the password once and keep the key it derives",
+		"for the rest of the shell session, so later commands",
+		"don't ask for it",
+	}},
+	{name: actLock, help: []string{
+		"Forget the keys of every depot unlocked in the shell",
+		"session",
+	}},
+	{name: actRun, args: "-- <command>...", help: []string{
+		"Run the command given after -- with the keys mapped by",
+		"--env in its environment, never writing them to disk",
+	}, options: []string{"env"}},
+	{name: actTemplate, args: "<file>", minArgs: 1, maxArgs: 1, help: []string{
+		"Render the Go template in the given file, in which",
+		`{{depot "key"}} expands to the value of the key, to`,
+		"stdout or to --out",
+	}, options: []string{"out"}},
+	{name: actMount, args: "<dir>", minArgs: 1, maxArgs: 1, help: []string{
+		"Mount the depot at the given directory as read-only",
+		"files named after its keys, decrypting secrets as they",
+		"are read, until interrupted (Linux only)",
+	}},
+	{name: actDockerCred, args: "<get|store|erase|list>", minArgs: 1, maxArgs: 1, help: []string{
+		"Act as a Docker credential helper, speaking its JSON",
+		"protocol on stdin and stdout, so registry credentials",
+		"are kept encrypted under docker/ keys",
+	}},
+	{name: actGitCred, args: "<get|store|erase>", minArgs: 1, maxArgs: 1, help: []string{
+		"Act as a git credential helper, speaking its protocol on",
+		"stdin and stdout, so HTTPS remotes' credentials are kept",
+		"encrypted under git/ keys",
+	}},
+	{name: actAskpass, args: "<prompt>", minArgs: 1, maxArgs: 1, help: []string{
+		"Print the value of the key that the askpass rules in the",
+		"config file map the given prompt to, for use as",
+		"SSH_ASKPASS, SUDO_ASKPASS, or GIT_ASKPASS",
+	}},
+	{name: actSystemdCred, args: "<key>", minArgs: 1, maxArgs: 1, keyed: true, keyArgs: 1, help: []string{
+		"Encrypt the value of the given key with systemd-creds and",
+		"print it as a SetCredentialEncrypted= line for a unit",
+		"file, or write it to --out for LoadCredentialEncrypted=",
+	}, options: []string{"out"}},
+	{name: actServe, help: []string{
+		"Serve the depot over HTTP(S), and optionally gRPC and",
+		"the Kubernetes Secrets Store CSI provider API,",
+		"authenticating clients with DEPOT_TOKEN, with Prometheus",
+		"metrics at /metrics",
+	}, options: []string{"addr", "grpc-addr", "csi-socket", "tls-cert", "tls-key"}},
+	{name: actSecretSvc, help: []string{
+		"Serve the depot on the session bus as the freedesktop.org",
+		"Secret Service, so desktop apps keep their passwords in",
+		"it, until interrupted",
+	}},
+	{name: actSync, args: "<path|uri>", minArgs: 1, maxArgs: 1, help: []string{
+		"Merge the depot with the one at the given path or URI",
+		"so that both hold the same keys, or the keys under a",
+		"vault://<mount>/<path> with the secrets there in",
+		"HashiCorp Vault, found with VAULT_ADDR and VAULT_TOKEN",
+	}, options: []string{"conflict"}},
+	{name: actTransfer, args: "<pattern>...", minArgs: 1, maxArgs: -1, keyed: true, help: []string{
+		"Copy the keys matching the given patterns to the depot",
+		"at --to, or from the one at --from, encrypting secrets",
+		"again for it",
+	}, options: []string{"to", "from", "move", "force"}},
+	{name: actExport, args: "[<pattern>]", minArgs: 0, maxArgs: 1, keyed: true, help: []string{
+		"Write an archive of the keys matching the given pattern",
+		"(or every key with --all) to stdout, encrypted with",
+		"a password of its own, or plain values or a KeePass",
+		"database with --format",
+	}, options: []string{"all", "format", "decrypt"}},
+	{name: actImport, args: "[<path>]", minArgs: 0, maxArgs: 1, help: []string{
+		"Read an archive written by export (or plain values with",
+		"--format) from stdin, or with --from another password",
+		"manager's store or export at the given path, and store",
+		"its keys, replacing any that already exist",
+	}, options: []string{"format", "from"}},
+	{name: actBackup, help: []string{
+		"Write a snapshot of the depot to the backup directory",
+		"and remove all but the newest snapshots",
+	}, options: []string{"backup-dir", "keep"}},
+	{name: actRestore, args: "[<snapshot>]", minArgs: 0, maxArgs: 1, help: []string{
+		"Restore the depot, or with --key only the keys matching",
+		"a pattern, from the given snapshot (a path, a name in",
+		"the backup directory, or latest), or list the snapshots",
+		"if none is given",
+	}, options: []string{"key", "backup-dir"}},
+	{name: actCompact, help: []string{
+		"Purge expired tombstones and shrink the database file to",
+		"give back the space left by dropped and changed values",
+	}},
+	{name: actMigrate, help: []string{
+		"Encrypt every secret again as one stowed now would be,",
+		"checking each, so older secrets gain newer protections",
+	}},
+	{name: actDoctor, help: []string{
+		"Check the database and every value for damage, decrypting",
+		"secrets as well with -s, and report the problems found",
+	}, options: []string{"secret", "repair", "format"}},
+	{name: actStats, help: []string{
+		"Summarize the depot: how many keys it holds and how many",
+		"are encrypted, their sizes overall and by namespace, the",
+		"oldest and newest, and its backend and schema version",
+	}, options: []string{"format"}},
+	{name: actUserAdd, args: "<user>", minArgs: 1, maxArgs: 1, help: []string{
+		"Add a user who may use the depot when it is served, and",
+		"print the token they authenticate with",
+	}, options: []string{"admin"}},
+	{name: actUserDel, args: "<user>", minArgs: 1, maxArgs: 1, help: []string{
+		"Remove the given user",
+	}},
+	{name: actUsers, help: []string{
+		"List the users and what they may do",
+	}},
+	{name: actGrant, args: "<user>", minArgs: 1, maxArgs: 1, help: []string{
+		"Allow the given user to read (--perm r), write (w), or",
+		"both (rw) the keys beginning with --prefix",
+	}, options: []string{"prefix", "perm"}},
+	{name: actRevoke, args: "<user>", minArgs: 1, maxArgs: 1, help: []string{
+		"Take away what the given user was granted on --prefix",
+	}, options: []string{"prefix"}},
+	{name: actAudit, help: []string{
+		"List who stowed, fetched, and dropped which keys, and",
+		"when, narrowed down with --since, --user, and --key",
+	}, options: []string{"since", "user", "key"}},
+	{name: actCompletion, args: "<bash|zsh|fish>", minArgs: 1, maxArgs: 1, help: []string{
+		"Print the completion script for the given shell (bash,",
+		"zsh, or fish), which completes key names as well",
+	}},
+	{name: actPull, help: []string{
+		"Merge in changes from the git remote of a git:// depot",
+	}},
+	{name: actPush, help: []string{
+		"Send changes to the git remote of a git:// depot",
+	}},
+	{name: actHelp, args: "[<action>]", minArgs: 0, maxArgs: 1, help: []string{
+		"Print this help message, or what the given action does",
+		"and the options it takes",
+	}},
+}
+
+// What the options that several actions take do for each of them, by action
+// and then by option
+var commandOptionHelp = map[string]map[string]optionHelp{
+	actStow: {
+		"secret": {help: []string{
+			"Encrypt the value with a password, asked for twice",
+		}},
+		"force": {help: []string{
+			"Stow a secret even if its password is weak",
+		}},
+		"field": {help: []string{
+			"Stow the value as only the given field of a record,",
+			"such as username, password, url, or notes, leaving its",
+			"other fields alone",
+		}},
+	},
+	actAppend: {
+		"secret": {help: []string{
+			"The key's value is encrypted, or is to be if it does not",
+			"exist yet, so ask for its password",
+		}},
+		"force": {help: []string{
+			"Start a secret even if its password is weak",
+		}},
+		"no-newline": {help: []string{
+			"Add to the end of the value as it is, rather than on a",
+			"line of its own",
+		}},
+		"from-file": {help: []string{
+			"Add the whole of the given file, newlines and all,",
+			"instead of a line read from stdin",
+		}},
+		"value": {help: []string{
+			"Add the given value instead of reading it from stdin",
+			"(Not for secrets, which it would leave in your shell",
+			"history)",
+		}},
+	},
+	actFetch: {
+		"no-newline": {help: []string{
+			"Print no newline after the value",
+		}},
+		"clip": {help: []string{
+			"Copy the value to the clipboard instead of printing it,",
+			"and clear it after clip-timeout in the config file",
+			"(Defaults to 45s)",
+		}},
+		"format": {arg: "<json|env>", help: []string{
+			"Print the values as one JSON object, with when each was",
+			"modified and whether it is encrypted (json), or as shell",
+			"assignments named for their keys (env). With json,",
+			"messages and errors, with the exit code, are JSON",
+			"objects on stderr",
+		}},
+		"out": {help: []string{
+			"Write the QR code as a PNG image to the given file,",
+			"which only you may read, instead of showing it",
+		}},
+		"field": {help: []string{
+			"Fetch only the given field of each record, such as",
+			"username, password, url, or notes",
+		}},
+	},
+	actDrop: {
+		"force": {help: []string{
+			"Drop without asking, even every key matching --pattern",
+		}},
+	},
+	actTrash: {
+		"force": {help: []string{
+			"Empty the trash without asking",
+		}},
+		"format": {arg: "<json>", help: []string{
+			"List the keys in the trash as a JSON array, with",
+			"messages and errors as JSON objects on stderr",
+		}},
+	},
+	actEdit: {
+		"secret": {help: []string{
+			"Encrypt a key that does not exist yet with a password,",
+			"asked for before the editor opens",
+		}},
+		"force": {help: []string{
+			"Encrypt a key that does not exist yet even if its",
+			"password is weak",
+		}},
+	},
+	actGen: {
+		"force": {help: []string{
+			"Replace the key if it already exists, and encrypt the",
+			"value even if the password it is encrypted with is weak",
+		}},
+		"clip": {help: []string{
+			"Copy the generated value to the clipboard instead of",
+			"printing it, and clear it after clip-timeout in the",
+			"config file (Defaults to 45s)",
+		}},
+		"no-newline": {help: []string{
+			"Print no newline after the generated value",
+		}},
+	},
+	actMove: {
+		"force": {help: []string{
+			"Replace the second key if it already exists",
+		}},
+	},
+	actCopy: {
+		"force": {help: []string{
+			"Replace the second key if it already exists",
+		}},
+	},
+	actAlias: {
+		"force": {help: []string{
+			"Replace the alias if it already stands for another key",
+		}},
+	},
+	actTOTP: {
+		"clip": {help: []string{
+			"Copy the code to the clipboard instead of printing it,",
+			"and clear it after clip-timeout in the config file",
+			"(Defaults to 45s)",
+		}},
+		"no-newline": {help: []string{
+			"Print no newline after the code",
+		}},
+	},
+	actInfo: {
+		"format": {arg: "<json>", help: []string{
+			"Print the info as a JSON object, with messages and",
+			"errors as JSON objects on stderr",
+		}},
+	},
+	actList: {
+		"since": {help: []string{
+			"List only the keys stowed or dropped since the given",
+			"time, either a duration before now (24h, 7d) or a date",
+			"(2006-01-02)",
+		}},
+		"format": {arg: "<json>", help: []string{
+			"List the keys as a JSON array, with messages and errors",
+			"as JSON objects on stderr",
+		}},
+	},
+	actStale: {
+		"format": {arg: "<json>", help: []string{
+			"List the stale keys as a JSON array, with messages and",
+			"errors as JSON objects on stderr",
+		}},
+	},
+	actGetAttach: {
+		"out": {help: []string{
+			"Write the attachment to the given file, which only you",
+			"may read, instead of stdout",
+		}},
+	},
+	actGrep: {
+		"secret": {help: []string{
+			"Search encrypted values as well, decrypted with the",
+			"password",
+		}},
+	},
+	actTemplate: {
+		"out": {help: []string{
+			"Write the rendered template to the given file, which",
+			"only you may read, instead of stdout",
+		}},
+	},
+	actSystemdCred: {
+		"out": {help: []string{
+			"Write the encrypted credential to the given file, which",
+			"only you may read, for LoadCredentialEncrypted=, instead",
+			"of printing a SetCredentialEncrypted= line",
+		}},
+	},
+	actTransfer: {
+		"from": {arg: "<path|uri>", help: []string{
+			"Depot to copy keys from, into this one",
+		}},
+		"force": {help: []string{
+			"Replace keys that already exist in the depot copied to",
+		}},
+	},
+	actExport: {
+		"format": {arg: "<json|csv|yaml|kdbx>", help: []string{
+			"Write plain values in the given format instead of an",
+			"encrypted archive, or a KeePass database with a",
+			"password of its own (kdbx)",
+		}},
+	},
+	actImport: {
+		"format": {arg: "<json|csv|yaml>", help: []string{
+			"Read plain values in the given format, as export writes",
+			"them, instead of an encrypted archive",
+		}},
+		"from": {arg: "<manager>", help: []string{
+			"Read the store or export at the given path of another",
+			"password manager (pass, keepass, bitwarden, or",
+			"1password) instead of an archive. Each item's password",
+			"is stowed under its folders and title, and its other",
+			"fields, however many, under keys of their own below",
+			"it rather than as fields of a record",
+		}},
+	},
+	actBackup: {
+		"backup-dir": {help: []string{
+			"Directory to write the snapshot to (Defaults to",
+			"DEPOT_BACKUP_DIR, then backup-dir in the config file,",
+			"then $XDG_CONFIG_HOME/depot/backups)",
+		}},
+	},
+	actRestore: {
+		"key": {help: []string{
+			"Restore only the keys matching the given pattern",
+		}},
+		"backup-dir": {help: []string{
+			"Directory to find snapshots in, and to write one of the",
+			"depot as it was to before restoring all of it (Defaults",
+			"to DEPOT_BACKUP_DIR, then backup-dir in the config file,",
+			"then $XDG_CONFIG_HOME/depot/backups)",
+		}},
+	},
+	actDoctor: {
+		"secret": {help: []string{
+			"Decrypt encrypted values as well, to check them",
+		}},
+		"format": {arg: "<json>", help: []string{
+			"List the problems found as a JSON array, with messages",
+			"and errors as JSON objects on stderr",
+		}},
+	},
+	actStats: {
+		"format": {arg: "<json>", help: []string{
+			"Print the summary as a JSON object, with messages and",
+			"errors as JSON objects on stderr",
+		}},
+	},
+	actGrant: {
+		"prefix": {help: []string{
+			"Prefix of the keys to grant permission on (Defaults to",
+			"every key)",
+		}},
+	},
+	actRevoke: {
+		"prefix": {help: []string{
+			"Prefix of the keys to revoke permission on (Defaults to",
+			"every key)",
+		}},
+	},
+	actAudit: {
+		"since": {help: []string{
+			"List only the events since the given time, either a",
+			"duration before now (24h, 7d) or a date (2006-01-02)",
+		}},
+		"key": {help: []string{
+			"List only the events of the keys matching the given",
+			"pattern",
+		}},
+	},
+}
+
+// Returns the action called name, or false if there is none
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+
+	return command{}, false
+}
+
+// Returns the option called name, or false if there is none
+func findOption(name string) (option, bool) {
+	for _, o := range optionList {
+		if o.name == name {
+			return o, true
+		}
+	}
+
+	return option{}, false
+}
+
+// Reports whether the action takes the option called name
+func (c command) takes(name string) bool {
+	return contains(commonOptions, name) || contains(c.options, name)
+}
+
+// Returns the long options that are switched on by name, those that take a
+// value, and those that may be given more than once, each with where it is
+// stored in opts
+func optionTargets(opts *options) (map[string]*bool, map[string]*string, map[string]*[]string) {
+	flags := map[string]*bool{
+		"secret":          &opts.secret,
+		"batch":           &opts.batch,
+		"no-newline":      &opts.noNewline,
+		"clip":            &opts.clip,
+		"help":            &opts.help,
+		"debug":           &opts.debug,
+		"force":           &opts.force,
+		"ephemeral":       &opts.ephemeral,
+		"non-interactive": &opts.nonInteractive,
+		"all":             &opts.all,
+		"decrypt":         &opts.decrypt,
+		"admin":           &opts.admin,
+		"symbols":         &opts.symbols,
+		"words":           &opts.words,
+		"names":           &opts.names,
+		"pick":            &opts.pick,
+		"qr":              &opts.qr,
+		"move":            &opts.move,
+		"repair":          &opts.repair,
+	}
+	values := map[string]*string{
+		"keyfile":    &opts.keyfile,
+		"pass-fd":    &opts.passFd,
+		"pass-file":  &opts.passFile,
+		"profile":    &opts.profile,
+		"addr":       &opts.addr,
+		"grpc-addr":  &opts.grpcAddr,
+		"csi-socket": &opts.csiSocket,
+		"tls-cert":   &opts.tlsCert,
+		"tls-key":    &opts.tlsKey,
+		"conflict":   &opts.conflict,
+		"format":     &opts.format,
+		"backup-dir": &opts.backupDir,
+		"keep":       &opts.keep,
+		"key":        &opts.pattern,
+		"pattern":    &opts.pattern,
+		"prefix":     &opts.prefix,
+		"perm":       &opts.perm,
+		"since":      &opts.since,
+		"older-than": &opts.olderThan,
+		"expires":    &opts.expires,
+		"by":         &opts.by,
+		"uses":       &opts.uses,
+		"user":       &opts.user,
+		"sort":       &opts.sort,
+		"length":     &opts.length,
+		"out":        &opts.out,
+		"to":         &opts.to,
+		"from":       &opts.from,
+		"from-file":  &opts.fromFile,
+		"value":      &opts.value,
+		"field":      &opts.field,
+	}
+	lists := map[string]*[]string{
+		"env": &opts.env,
+	}
+
+	return flags, values, lists
+}
+
+// Returns the action to perform and its arguments and options specified in
+// the command-line arguments or an error if unsuccessful. Options may come
+// before or after the action, short switches may be grouped as in -sn, and
+// everything after -- is the command for run. With --help, the action is
+// help and its argument is the action given, if any.
+func parseArgs(args []string) (options, error) {
+	opts := options{
+		perm:     "r",
+		keyfile:  os.Getenv(envKeyfile),
+		addr:     "localhost:8080",
+		conflict: conflictNewest,
+		sort:     sortName,
+	}
+	flags, values, lists := optionTargets(&opts)
+
+	// The options given, checked against the action once it is known
+	var given, positional []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			opts.command = args[i+1:]
+			break
+		} else if strings.HasPrefix(a, "--") {
+			name, val, hasVal := strings.Cut(a[2:], "=")
+			given = append(given, name)
+			if dest, ok := flags[name]; ok {
+				if hasVal {
+					return opts, fmt.Errorf("--%v does not take a value", name)
+				}
+				*dest = true
+				continue
+			}
+
+			_, isValue := values[name]
+			_, isList := lists[name]
+			if !isValue && !isList {
+				return opts, fmt.Errorf("unknown option: --%v", name)
+			}
+			if !hasVal {
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--%v requires a value", name)
+				}
+				i++
+				val = args[i]
+			}
+			if isList {
+				*lists[name] = append(*lists[name], val)
+			} else {
+				*values[name] = val
+			}
+		} else if strings.HasPrefix(a, "-") && a != "-" {
+			for _, r := range a[1:] {
+				name, err := shortOption(r)
+				if err != nil {
+					return opts, err
+				}
+				given = append(given, name)
+				*flags[name] = true
+			}
+		} else {
+			positional = append(positional, a)
+		}
+	}
+
+	if len(positional) > 0 {
+		opts.action, positional = positional[0], positional[1:]
+	}
+	if opts.help {
+		// Help for the action given, whatever else was given with it
+		opts.key = opts.action
+		opts.action = actHelp
+		return opts, nil
+	}
+	if opts.action == "" {
+		return opts, fmt.Errorf("no action specified")
+	}
+
+	cmd, ok := findCommand(opts.action)
+	if !ok {
+		return opts, fmt.Errorf("unknown action: %v", opts.action)
+	}
+	for _, name := range given {
+		if !cmd.takes(name) {
+			return opts, fmt.Errorf("%v does not take --%v", cmd.name, name)
+		}
+	}
+	if opts.command != nil && cmd.name != actRun {
+		return opts, fmt.Errorf("only %v takes a command after --", actRun)
+	}
+	if len(positional) < cmd.minArgs {
+		return opts, fmt.Errorf("%v requires %v (see depot help %v)", cmd.name, cmd.args, cmd.name)
+	}
+	if cmd.maxArgs >= 0 && len(positional) > cmd.maxArgs {
+		return opts, fmt.Errorf("too many arguments for %v (see depot help %v)", cmd.name, cmd.name)
+	}
+
+	if len(positional) > 0 {
+		opts.key, opts.extraKeys = positional[0], positional[1:]
+	}
+
+	return opts, nil
+}
+
+// Returns the name of the option given as -r or an error if there is none
+func shortOption(r rune) (string, error) {
+	if r == '?' {
+		r = 'h'
+	}
+	for _, o := range optionList {
+		if o.short == r && o.arg == "" {
+			return o.name, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown option: -%c", r)
+}
+
+// Returns the lines of usage describing the option
+func (o option) usage() []string {
+	label := "--" + o.name
+	if o.short != 0 {
+		label = fmt.Sprintf("-%c, %v", o.short, label)
+	}
+	if o.arg != "" {
+		label += " " + o.arg
+	}
+
+	return describe(label, o.help)
+}
+
+// Returns help indented under a label that it follows on the same line if
+// there is room
+func describe(label string, help []string) []string {
+	const indent = "                "
+	lines := make([]string, 0, len(help)+1)
+	if len(label) < len(indent)-4 {
+		lines = append(lines, fmt.Sprintf("    %-11v %v", label, help[0]))
+		help = help[1:]
+	} else {
+		lines = append(lines, "    "+label)
+	}
+	for _, line := range help {
+		lines = append(lines, indent+line)
+	}
+
+	return lines
+}
+
+// Returns the help message
+func usage() string {
+	lines := []string{
+		"Usage: depot [-cnsh?] [--options] <action> [<args>] [-- <command>]",
+		"       depot help <action>",
+		"",
+		"Actions:",
+	}
+	for _, c := range commands {
+		lines = append(lines, describe(c.name, c.help)...)
+	}
+
+	lines = append(lines, "", "Options:")
+	for _, o := range optionList {
+		lines = append(lines, o.usage()...)
+	}
+
+	lines = append(lines,
+		"",
+		"Environment Variables:",
+		"    DEPOT_PATH  Specifies a non-standard path to the depot's database,",
+		"                a bolt:// path to use a bbolt database, a dir:// path",
+		"                to keep one file per key in a directory tree (or a",
+		"                git:// path to also commit every change to git), a",
+		"                postgres:// URI to use a PostgreSQL database, a",
+		"                redis:// URL to use a Redis server, an s3://bucket/prefix",
+		"                to use an S3-compatible bucket, or the https://",
+		"                or grpcs:// address of a remote depot server",
+		"                (Defaults to $XDG_DATA_HOME/depot/"+libdepot.DefaultFilename+",",
+		"                ~/Library/Application Support/depot/"+libdepot.DefaultFilename+" on",
+		"                macOS, or %LOCALAPPDATA%\\depot\\"+libdepot.DefaultFilename+" on Windows)",
+		"    DEPOT_PASS  Specifies the password to be used to encrypt/decrypt values",
+		"                (Be careful with this! It is certainly less secure!)",
+		"    DEPOT_PASS_COMMAND",
+		"                Specifies a shell command whose output is the password,",
+		"                used unless DEPOT_PASS is set (Defaults to pass-command",
+		"                in the config file)",
+		"    DEPOT_KEYFILE",
+		"                Specifies a keyfile, as with --keyfile",
+		"    DEPOT_TOKEN Specifies the token used to authenticate with a remote",
+		"                depot server, or that clients must present to serve",
+		"    DEPOT_BACKUP_DIR",
+		"                Specifies the directory for snapshots, as with --backup-dir",
+		"    DEPOT_PROFILE",
+		"                Specifies a profile in the config file, as with --profile",
+		"    DEPOT_NON_INTERACTIVE",
+		"                Runs depot non-interactively, as with --non-interactive",
+		"",
+		"Exit Status:",
+		fmt.Sprintf("    %-3d The key was not found", exitNotFound),
+		fmt.Sprintf("    %-3d The password was wrong", exitBadPassword),
+		fmt.Sprintf("    %-3d A password was needed but none could be asked for", exitPasswordNeeded),
+		fmt.Sprintf("    %-3d The database could not be accessed", exitDatabase),
+		fmt.Sprintf("    %-3d Something else had to be asked but could not be", exitNonInteractive),
+		fmt.Sprintf("    %-3d The command line was invalid", exitUsage),
+		fmt.Sprintf("    %-3d Any other error", exitError),
+	)
+
+	return strings.Join(lines, "\n")
+}
+
+// Returns the help message of the action called name, or an error if there
+// is no such action
+func commandUsage(name string) (string, error) {
+	cmd, ok := findCommand(name)
+	if !ok {
+		return "", fmt.Errorf("unknown action: %v", name)
+	}
+
+	lines := []string{strings.TrimSpace(fmt.Sprintf("Usage: depot [--options] %v %v", cmd.name, cmd.args)), ""}
+	lines = append(lines, cmd.help...)
+	lines = append(lines, "", "Options:")
+	for _, name := range append(cmd.options, commonOptions...) {
+		o, _ := findOption(name)
+		if own, ok := commandOptionHelp[cmd.name][name]; ok {
+			if own.arg != "" {
+				o.arg = own.arg
+			}
+			o.help = own.help
+		}
+		lines = append(lines, o.usage()...)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// The name depot acts as an askpass program under
+const askpassName = "depot-askpass"
+
+// Settings in the config file whose names begin with this map prompts to
+// keys, as "askpass <key> = <pattern>"
+const askpassRulePrefix = "askpass "
+
+// A rule mapping prompts that match a pattern to the key holding the answer
+type askpassRule struct {
+	key     string
+	pattern string
+	re      *regexp.Regexp
+}
+
+// Prints the value of the key that the config file's askpass rules map the
+// prompt to, as ssh, sudo, git, and others expect of the program named by
+// SSH_ASKPASS, SUDO_ASKPASS, or GIT_ASKPASS. Returns an error if unsuccessful,
+// including when no rule matches, which these programs take as the prompt
+// being cancelled.
+func askpass(storage *libdepot.Depot, prompt string, opts options) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	rules, err := askpassRules(cfg)
+	if err != nil {
+		return err
+	}
+	key, ok := matchAskpass(rules, prompt)
+	if !ok {
+		return fmt.Errorf("no askpass rule in the config file matches the prompt %q", prompt)
+	}
+
+	info, err := storage.Info(key)
+	if err != nil {
+		return err
+	}
+	password, err := getPassword(info.Encrypted, opts.hasKey())
+	if err != nil {
+		return err
+	}
+	val, err := storage.Fetch(key, password)
+	if err != nil {
+		return err
+	}
+	fmt.Println(val)
+
+	return nil
+}
+
+// Returns the askpass rules in the config file, or an error if a pattern is
+// missing
+func askpassRules(cfg config) ([]askpassRule, error) {
+	var rules []askpassRule
+	for name, pattern := range cfg {
+		key, ok := strings.CutPrefix(name, askpassRulePrefix)
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if key == "" || pattern == "" {
+			return nil, fmt.Errorf("config %q: expected askpass <key> = <pattern>", name)
+		}
+		rules = append(rules, askpassRule{key, pattern, globRegexp(pattern)})
+	}
+
+	return rules, nil
+}
+
+// Returns the key of the rule whose pattern matches the prompt, preferring
+// the longest pattern as the most specific, or false if none matches
+func matchAskpass(rules []askpassRule, prompt string) (string, bool) {
+	sort.Slice(rules, func(i, j int) bool {
+		if len(rules[i].pattern) != len(rules[j].pattern) {
+			return len(rules[i].pattern) > len(rules[j].pattern)
+		}
+		return rules[i].key < rules[j].key
+	})
+	for _, r := range rules {
+		if r.re.MatchString(strings.TrimSpace(prompt)) {
+			return r.key, true
+		}
+	}
+
+	return "", false
+}
+
+// Returns a regular expression matching the whole of any string the shell
+// pattern matches, in which * stands for any text, slashes included, and ?
+// for any one character
+func globRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+
+	return regexp.MustCompile(b.String())
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Attaches the file given after the key to it under the file's name,
+// encrypted with the password of the key's value. If the value is encrypted
+// the password is checked against it, and otherwise it is asked for twice.
+// Returns an error if unsuccessful.
+func attachFile(storage *libdepot.Depot, opts options) error {
+	path := opts.extraKeys[0]
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot read attachment: %w", err)
+	}
+	defer f.Close()
+
+	info, err := storage.Info(opts.key)
+	if err != nil {
+		return err
+	}
+	var password []byte
+	if info.Encrypted {
+		if password, err = getPassword(true, opts.hasKey()); err != nil {
+			return err
+		}
+		if err = storage.Verify(opts.key, password); err != nil {
+			return err
+		}
+	} else if password, err = getNewPassword(true, opts.hasKey()); err != nil {
+		return err
+	}
+
+	return storage.Attach(opts.key, filepath.Base(path), f, password)
+}
+
+// Writes the attachment of the key with the given name to stdout or to the
+// file given by --out, which only the user may read, or lists the key's
+// attachments if no name is given. Returns an error if unsuccessful.
+func getAttachment(storage *libdepot.Depot, opts options) error {
+	if len(opts.extraKeys) == 0 {
+		attachments, err := storage.Attachments(opts.key)
+		if err != nil {
+			return err
+		}
+		for _, a := range attachments {
+			fmt.Printf("%v\t%v\t%v\n", a.Name, formatSize(a.Size), a.Modified.Local().Format(time.DateTime))
+		}
+		return nil
+	}
+
+	name := opts.extraKeys[0]
+	password, err := getPassword(true, opts.hasKey())
+	if err != nil {
+		return err
+	}
+	fetch := func(w io.Writer) error {
+		return storage.FetchAttachment(opts.key, name, w, password)
+	}
+	if opts.out == "" {
+		return fetch(os.Stdout)
+	}
+
+	return writePrivateWith(opts.out, fetch)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Returns the name of the user running depot, for the audit log
+func actor() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return os.Getenv("USER")
+}
+
+// Returns the time described by s, either a duration before now (such as
+// 24h or 7d, see parseAge) or a date in the form 2006-01-02, or an error if it
+// is neither
+func parseSince(s string) (time.Time, error) {
+	if d, err := parseAge(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time: %v (expected a duration such as 24h or a date such as 2006-01-02)", s)
+}
+
+// Prints the events in the audit log selected by --since, --user, and --key.
+// Returns an error if unsuccessful.
+func printAudit(storage *libdepot.Depot, opts options) error {
+	q := libdepot.AuditQuery{Actor: opts.user, Pattern: opts.pattern}
+	if opts.since != "" {
+		since, err := parseSince(opts.since)
+		if err != nil {
+			return err
+		}
+		q.Since = since
+	}
+
+	events, err := storage.AuditLog(q)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		result := "ok"
+		if e.Error != "" {
+			result = "failed: " + e.Error
+		}
+		who := e.Actor
+		if who == "" {
+			who = "-"
+		}
+		fmt.Printf("%v  %-12v %-6v %v  %v\n",
+			e.Time.Local().Format(time.DateTime), who, e.Action, e.Key, result)
+	}
+
+	return nil
+}
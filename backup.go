@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// How many snapshots are kept unless told otherwise
+const defaultBackupKeep = 10
+
+// Where snapshots go, how many are kept, and how often they are taken
+// without being asked for
+type backupSettings struct {
+	dir      string
+	keep     int
+	interval time.Duration
+}
+
+// Returns the backup settings that follow from the command-line options,
+// environment, and config file, in that order of precedence, or an error if
+// unsuccessful
+func loadBackupSettings(opts options) (backupSettings, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return backupSettings{}, err
+	}
+
+	settings := backupSettings{dir: opts.backupDir, keep: defaultBackupKeep}
+	if settings.dir == "" {
+		settings.dir = os.Getenv(envBackupDir)
+	}
+	if settings.dir == "" {
+		settings.dir = cfg["backup-dir"]
+	}
+	if settings.dir == "" {
+		dir, err := configDir()
+		if err != nil {
+			return settings, err
+		}
+		settings.dir = filepath.Join(dir, "backups")
+	}
+
+	keep := opts.keep
+	if keep == "" {
+		keep = cfg["backup-keep"]
+	}
+	if keep != "" {
+		if settings.keep, err = strconv.Atoi(keep); err != nil {
+			return settings, fmt.Errorf("invalid number of snapshots to keep: %v", keep)
+		}
+	}
+
+	if interval := cfg["backup-interval"]; interval != "" {
+		if settings.interval, err = time.ParseDuration(interval); err != nil {
+			return settings, fmt.Errorf("invalid backup interval: %v", interval)
+		}
+	}
+
+	return settings, nil
+}
+
+// Writes a snapshot of the depot to the backup directory and prunes the
+// oldest snapshots. Returns an error if unsuccessful.
+func backup(storage *libdepot.Depot, opts options) error {
+	settings, err := loadBackupSettings(opts)
+	if err != nil {
+		return err
+	}
+
+	s, err := storage.Backup(settings.dir)
+	if err != nil {
+		return err
+	}
+	log.Printf("Backed up to %v\n", s.Path)
+
+	n, err := libdepot.PruneSnapshots(settings.dir, settings.keep)
+	if n > 0 {
+		log.Printf("Removed %v old snapshots\n", n)
+	}
+
+	return err
+}
+
+// Backs up the depot if backup-interval is set in the config file and the
+// newest snapshot is older than that. Returns an error if unsuccessful.
+func autoBackup(storage *libdepot.Depot, opts options) error {
+	settings, err := loadBackupSettings(opts)
+	if err != nil || settings.interval <= 0 {
+		return err
+	}
+
+	snapshots, err := libdepot.Snapshots(settings.dir)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) > 0 && time.Since(snapshots[len(snapshots)-1].Created) < settings.interval {
+		return nil
+	}
+
+	if _, err = storage.Backup(settings.dir); err != nil {
+		return err
+	}
+	_, err = libdepot.PruneSnapshots(settings.dir, settings.keep)
+
+	return err
+}
+
+// Restores the depot, or the keys matching --key, from the snapshot given as
+// the key, or lists the snapshots if there is none. The depot is backed up
+// before it is restored whole. Returns an error if unsuccessful.
+func restore(storage *libdepot.Depot, opts options) error {
+	settings, err := loadBackupSettings(opts)
+	if err != nil {
+		return err
+	}
+	snapshots, err := libdepot.Snapshots(settings.dir)
+	if err != nil {
+		return err
+	}
+
+	if opts.key == "" {
+		for _, s := range snapshots {
+			fmt.Printf("%v  %v\n", s.Created.Local().Format(time.DateTime), filepath.Base(s.Path))
+		}
+		return nil
+	}
+
+	path, err := findSnapshot(snapshots, settings.dir, opts.key)
+	if err != nil {
+		return err
+	}
+	if opts.pattern == "" {
+		s, err := storage.Backup(settings.dir)
+		if err != nil {
+			return err
+		}
+		log.Printf("Backed up to %v\n", s.Path)
+	}
+
+	n, err := storage.Restore(path, opts.pattern)
+	if err != nil {
+		return err
+	}
+	log.Printf("Restored %v keys from %v\n", n, path)
+
+	return nil
+}
+
+// Compacts the depot and reports how much space was reclaimed. Returns an
+// error if unsuccessful.
+func compact(storage *libdepot.Depot) error {
+	reclaimed, err := storage.Compact()
+	if err != nil {
+		return err
+	}
+	log.Printf("Reclaimed %v\n", formatSize(reclaimed))
+
+	return nil
+}
+
+// Returns a number of bytes in the largest unit that keeps it at least 1
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%d bytes", n)
+	}
+
+	size, prefix := float64(n)/unit, 0
+	for size >= unit || size <= -unit {
+		size /= unit
+		prefix++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", size, "KMGTPE"[prefix])
+}
+
+// Returns the path of the snapshot called name: a path, the name of one of
+// the snapshots in dir, or latest for the newest of them. Returns an error if
+// there is no such snapshot.
+func findSnapshot(snapshots []libdepot.Snapshot, dir, name string) (string, error) {
+	if name == "latest" {
+		if len(snapshots) == 0 {
+			return "", fmt.Errorf("no snapshots in %v", dir)
+		}
+		return snapshots[len(snapshots)-1].Path, nil
+	}
+
+	for _, path := range []string{name, filepath.Join(dir, name)} {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("cannot read snapshot: %w", err)
+		}
+	}
+
+	return "", fmt.Errorf("no snapshot named %v", name)
+}
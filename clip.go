@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// Hidden action used to start the process that clears the clipboard
+	actClipClear = "clip-clear"
+
+	// How long a copied value stays on the clipboard unless told otherwise
+	defaultClipTimeout = 45 * time.Second
+
+	// Pass the process that clears the clipboard an HMAC of the copied value,
+	// and the random key it was computed with, which is new for every copy,
+	// so that it can leave the clipboard alone if something else has been
+	// copied since without being able to tell what was copied. The
+	// environment can't be read by other users, unlike arguments.
+	envClipHash = "DEPOT_CLIP_HASH"
+	envClipKey  = "DEPOT_CLIP_KEY"
+)
+
+// The variables the process that clears the clipboard keeps from depot's
+// environment, which are all the clipboard tools need to reach the clipboard.
+// Their case is ignored, as Windows ignores it.
+var clipEnv = []string{
+	"PATH", "HOME", "USER", "DISPLAY", "XAUTHORITY", "WAYLAND_DISPLAY", "XDG_RUNTIME_DIR",
+	"SYSTEMROOT", "WINDIR", "PATHEXT", "USERPROFILE", "TEMP", "TMP",
+}
+
+// The commands that copy stdin to the clipboard and print what is on it
+type clipboardTool struct {
+	copy  []string
+	paste []string
+}
+
+// Returns the clipboard tools that may work here, the likeliest first
+func clipboardTools() []clipboardTool {
+	switch runtime.GOOS {
+	case "darwin":
+		return []clipboardTool{{[]string{"pbcopy"}, []string{"pbpaste"}}}
+	case "windows":
+		return []clipboardTool{{
+			[]string{"clip.exe"},
+			[]string{"powershell.exe", "-NoProfile", "-Command", "Get-Clipboard"},
+		}}
+	}
+
+	var tools []clipboardTool
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		tools = append(tools, clipboardTool{[]string{"wl-copy"}, []string{"wl-paste", "--no-newline"}})
+	}
+	if os.Getenv("DISPLAY") != "" {
+		tools = append(tools,
+			clipboardTool{
+				[]string{"xclip", "-selection", "clipboard"},
+				[]string{"xclip", "-selection", "clipboard", "-o"},
+			},
+			clipboardTool{
+				[]string{"xsel", "--clipboard", "--input"},
+				[]string{"xsel", "--clipboard", "--output"},
+			})
+	}
+
+	return tools
+}
+
+// Returns the first clipboard tool that is installed or an error if there is
+// none
+func findClipboard() (clipboardTool, error) {
+	for _, tool := range clipboardTools() {
+		if _, err := exec.LookPath(tool.copy[0]); err == nil {
+			return tool, nil
+		}
+	}
+
+	return clipboardTool{}, errors.New("no clipboard found (install wl-clipboard, xclip, or xsel)")
+}
+
+// Puts val on the clipboard. Returns an error if unsuccessful.
+func (t clipboardTool) write(val string) error {
+	cmd := exec.Command(t.copy[0], t.copy[1:]...)
+	cmd.Stdin = strings.NewReader(val)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cannot copy to clipboard: %w", err)
+	}
+
+	return nil
+}
+
+// Returns what is on the clipboard or an error if unsuccessful
+func (t clipboardTool) read() ([]byte, error) {
+	out, err := exec.Command(t.paste[0], t.paste[1:]...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read clipboard: %w", err)
+	}
+
+	return out, nil
+}
+
+// Copies the value of the key to the clipboard and clears it again after
+// clip-timeout in the config file, unless that is 0. Returns an error if
+// unsuccessful.
+func clip(key, val string) error {
+	timeout, err := clipTimeout()
+	if err != nil {
+		return err
+	}
+	tool, err := findClipboard()
+	if err != nil {
+		return err
+	}
+	if err = tool.write(val); err != nil {
+		return err
+	}
+	if timeout <= 0 {
+		log.Printf("Copied %v to the clipboard\n", key)
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	hashKey := make([]byte, 32)
+	if _, err = rand.Read(hashKey); err != nil {
+		return fmt.Errorf("cannot generate random key: %w", err)
+	}
+	cmd := exec.Command(exe, actClipClear, timeout.String())
+	cmd.Env = clipClearEnv(os.Environ(), hashKey, clipHash(hashKey, []byte(val)))
+	if err = startDetached(cmd); err != nil {
+		return fmt.Errorf("cannot clear clipboard later: %w", err)
+	}
+	log.Printf("Copied %v to the clipboard, which will be cleared in %v\n", key, timeout)
+
+	return nil
+}
+
+// Returns the HMAC of val under key that the process that clears the
+// clipboard compares what is on it with
+func clipHash(key, val []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(val)
+	return mac.Sum(nil)
+}
+
+// Returns the environment of the process that clears the clipboard: only the
+// variables of env in clipEnv, so that it never holds depot's credentials,
+// along with key and the HMAC of the copied value under it
+func clipClearEnv(env []string, key, hash []byte) []string {
+	var result []string
+	for _, v := range env {
+		name, _, _ := strings.Cut(v, "=")
+		if slices.ContainsFunc(clipEnv, func(keep string) bool { return strings.EqualFold(keep, name) }) {
+			result = append(result, v)
+		}
+	}
+
+	return append(result, envClipKey+"="+hex.EncodeToString(key), envClipHash+"="+hex.EncodeToString(hash))
+}
+
+// Returns how long a copied value stays on the clipboard or an error if the
+// config file sets it wrongly
+func clipTimeout() (time.Duration, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return 0, err
+	}
+	val := cfg["clip-timeout"]
+	if val == "" {
+		return defaultClipTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid clip timeout: %v", val)
+	}
+
+	return timeout, nil
+}
+
+// Waits for the given time, then clears the clipboard if it still holds the
+// value whose HMAC under DEPOT_CLIP_KEY is in DEPOT_CLIP_HASH. Returns an
+// error if unsuccessful.
+func clearClip(after string) error {
+	timeout, err := time.ParseDuration(after)
+	if err != nil {
+		return err
+	}
+	key, err := hex.DecodeString(os.Getenv(envClipKey))
+	if err != nil {
+		return err
+	}
+	want, err := hex.DecodeString(os.Getenv(envClipHash))
+	if err != nil {
+		return err
+	}
+	tool, err := findClipboard()
+	if err != nil {
+		return err
+	}
+
+	time.Sleep(timeout)
+	current, err := tool.read()
+	if err != nil {
+		return err
+	}
+	// Some tools add a newline when they paste
+	for _, val := range [][]byte{current, bytes.TrimSuffix(current, []byte("\n"))} {
+		if hmac.Equal(clipHash(key, val), want) {
+			return tool.write("")
+		}
+	}
+
+	return nil
+}
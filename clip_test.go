@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"slices"
+	"testing"
+)
+
+func TestClipHash(t *testing.T) {
+	val := []byte("hunter2")
+	a, b := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	if !bytes.Equal(clipHash(a, val), clipHash(a, val)) {
+		t.Errorf("expected the same HMAC under the same key")
+	}
+	if bytes.Equal(clipHash(a, val), clipHash(b, val)) {
+		t.Errorf("expected a different HMAC under another key")
+	}
+	if bytes.Equal(clipHash(a, val), clipHash(a, []byte("hunter3"))) {
+		t.Errorf("expected a different HMAC of another value")
+	}
+}
+
+func TestClipClearEnv(t *testing.T) {
+	env := []string{
+		"PATH=/usr/bin",
+		"WAYLAND_DISPLAY=wayland-0",
+		"SystemRoot=C:\\Windows",
+		"DEPOT_PASS=password",
+		"DEPOT_TOKEN=token",
+		"AWS_SECRET_ACCESS_KEY=secret",
+	}
+	key, hash := []byte{0xab}, []byte{0xcd}
+
+	got := clipClearEnv(env, key, hash)
+	want := []string{
+		"PATH=/usr/bin",
+		"WAYLAND_DISPLAY=wayland-0",
+		"SystemRoot=C:\\Windows",
+		envClipKey + "=" + hex.EncodeToString(key),
+		envClipHash + "=" + hex.EncodeToString(hash),
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Shells that completion scripts are written for
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// What a completion script needs to know about depot's command line
+type completionData struct {
+	// Every action, and those given keys or patterns from the depot, whose
+	// names are completed from depot list
+	Actions []string
+	Keyed   []string
+	Shells  []string
+
+	// Short switches with - in front, and long options without and with a
+	// value with -- in front
+	Shorts []string
+	Flags  []string
+	Values []string
+
+	// The values some options may take
+	Choices map[string][]string
+
+	// Options whose value is a file or a directory
+	Files []string
+	Dirs  []string
+
+	// Options whose value can't be completed
+	Free []string
+}
+
+// Returns what completion scripts need to know, taken from the same place
+// parseArgs takes it so that the two can't disagree
+func newCompletionData() completionData {
+	var opts options
+	flags, values, lists := optionTargets(&opts)
+	d := completionData{
+		Shells: completionShells,
+		Choices: map[string][]string{
+			"--conflict": {conflictNewest, conflictPrompt, conflictKeepBoth},
+			"--format":   {libdepot.FormatJSON, libdepot.FormatCSV, libdepot.FormatYAML, formatEnv},
+			"--perm":     {"r", "w", "rw"},
+			"--sort":     {sortName, sortModified},
+		},
+		Files: []string{"--from", "--from-file", "--keyfile", "--out", "--pass-file", "--tls-cert", "--tls-key", "--to"},
+		Dirs:  []string{"--backup-dir"},
+	}
+
+	for _, c := range commands {
+		d.Actions = append(d.Actions, c.name)
+		if c.keyed {
+			d.Keyed = append(d.Keyed, c.name)
+		}
+	}
+	for _, o := range optionList {
+		if o.short != 0 {
+			d.Shorts = append(d.Shorts, "-"+string(o.short))
+		}
+	}
+	for name := range flags {
+		d.Flags = append(d.Flags, "--"+name)
+	}
+	for name := range values {
+		d.Values = append(d.Values, "--"+name)
+	}
+	for name := range lists {
+		d.Values = append(d.Values, "--"+name)
+	}
+	sort.Strings(d.Flags)
+	sort.Strings(d.Values)
+
+	for _, name := range d.Values {
+		_, chosen := d.Choices[name]
+		if !chosen && !contains(d.Files, name) && !contains(d.Dirs, name) {
+			d.Free = append(d.Free, name)
+		}
+	}
+
+	return d
+}
+
+// Reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Prints the completion script for the given shell. Returns an error if
+// unsuccessful.
+func completion(shell string) error {
+	script, ok := completionScripts[shell]
+	if !ok {
+		return fmt.Errorf("no completion for %v, only for %v", shell, strings.Join(completionShells, ", "))
+	}
+
+	tmpl, err := template.New(shell).Funcs(template.FuncMap{
+		"join": strings.Join,
+		"trim": func(s, prefix string) string { return strings.TrimPrefix(s, prefix) },
+	}).Parse(script)
+	if err != nil {
+		return err
+	}
+
+	return tmpl.Execute(os.Stdout, newCompletionData())
+}
+
+var completionScripts = map[string]string{
+	"bash": `# bash completion for depot. Load it with: source <(depot completion bash)
+
+_depot() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+    local action="" word i
+
+    case "$prev" in
+{{- range $name, $choices := .Choices}}
+        {{$name}}) COMPREPLY=($(compgen -W "{{join $choices " "}}" -- "$cur")); return ;;
+{{- end}}
+        {{join .Files "|"}}) COMPREPLY=($(compgen -f -- "$cur")); return ;;
+        {{join .Dirs "|"}}) COMPREPLY=($(compgen -d -- "$cur")); return ;;
+        {{join .Free "|"}}) return ;;
+    esac
+
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        word="${COMP_WORDS[i]}"
+        case "$word" in
+            {{join .Values "|"}}) ((i++)) ;;
+            -*) ;;
+            *) action="$word"; break ;;
+        esac
+    done
+
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "{{join .Shorts " "}} {{join .Flags " "}} {{join .Values " "}}" -- "$cur"))
+    elif [[ -z "$action" ]]; then
+        COMPREPLY=($(compgen -W "{{join .Actions " "}}" -- "$cur"))
+    else
+        case "$action" in
+            {{join .Keyed "|"}})
+                local IFS=$'\n'
+                COMPREPLY=($(compgen -W "$(depot list --names 2>/dev/null)" -- "$cur")) ;;
+            sync|restore|template|import) COMPREPLY=($(compgen -f -- "$cur")) ;;
+            completion) COMPREPLY=($(compgen -W "{{join .Shells " "}}" -- "$cur")) ;;
+            trash) COMPREPLY=($(compgen -W "list restore empty" -- "$cur")) ;;
+            namespace) COMPREPLY=($(compgen -W "list add remove" -- "$cur")) ;;
+            help) COMPREPLY=($(compgen -W "{{join .Actions " "}}" -- "$cur")) ;;
+        esac
+    fi
+}
+
+complete -F _depot depot
+`,
+
+	"zsh": `#compdef depot
+# zsh completion for depot. Save it as _depot in a directory on $fpath, or
+# load it with: source <(depot completion zsh)
+
+_depot() {
+    local action i
+
+    for (( i = 2; i < CURRENT; i++ )); do
+        case $words[i] in
+            {{join .Values "|"}}) (( i++ )) ;;
+            -*) ;;
+            *) action=$words[i]; break ;;
+        esac
+    done
+
+    case $words[CURRENT-1] in
+{{- range $name, $choices := .Choices}}
+        {{$name}}) compadd -- {{join $choices " "}}; return ;;
+{{- end}}
+        {{join .Files "|"}}) _files; return ;;
+        {{join .Dirs "|"}}) _files -/; return ;;
+        {{join .Free "|"}}) return ;;
+    esac
+
+    if [[ $PREFIX == -* ]]; then
+        compadd -- {{join .Shorts " "}} {{join .Flags " "}} {{join .Values " "}}
+    elif [[ -z $action ]]; then
+        compadd -- {{join .Actions " "}}
+    else
+        case $action in
+            {{join .Keyed "|"}}) compadd -- ${(f)"$(depot list --names 2>/dev/null)"} ;;
+            sync|restore|template|import) _files ;;
+            completion) compadd -- {{join .Shells " "}} ;;
+            trash) compadd -- list restore empty ;;
+            namespace) compadd -- list add remove ;;
+            help) compadd -- {{join .Actions " "}} ;;
+        esac
+    fi
+}
+
+if [[ $zsh_eval_context[-1] == loadautofunc ]]; then
+    _depot "$@"
+else
+    compdef _depot depot
+fi
+`,
+
+	"fish": `# fish completion for depot. Save it as ~/.config/fish/completions/depot.fish,
+# or load it with: depot completion fish | source
+
+set -l actions {{join .Actions " "}}
+
+complete -c depot -f
+complete -c depot -n "not __fish_seen_subcommand_from $actions" -a "$actions"
+complete -c depot -n "__fish_seen_subcommand_from {{join .Keyed " "}}" -a "(depot list --names 2>/dev/null)"
+complete -c depot -n "__fish_seen_subcommand_from sync restore template import" -F
+complete -c depot -n "__fish_seen_subcommand_from completion" -a "{{join .Shells " "}}"
+complete -c depot -n "__fish_seen_subcommand_from trash" -a "list restore empty"
+complete -c depot -n "__fish_seen_subcommand_from namespace" -a "list add remove"
+complete -c depot -n "__fish_seen_subcommand_from help" -a "$actions"
+
+{{- range .Shorts}}
+complete -c depot -s {{trim . "-"}}
+{{- end}}
+{{- range .Flags}}
+complete -c depot -l {{trim . "--"}}
+{{- end}}
+{{- range $name, $choices := .Choices}}
+complete -c depot -l {{trim $name "--"}} -x -a "{{join $choices " "}}"
+{{- end}}
+{{- range .Files}}
+complete -c depot -l {{trim . "--"}} -r -F
+{{- end}}
+{{- range .Dirs}}
+complete -c depot -l {{trim . "--"}} -x -a "(__fish_complete_directories)"
+{{- end}}
+{{- range .Free}}
+complete -c depot -l {{trim . "--"}} -x
+{{- end}}
+`,
+}
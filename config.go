@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// The name of the config file in the config directory
+const configFilename = "config"
+
+// Settings read from the config file, keyed by name
+type config map[string]string
+
+// Returns the directory depot keeps its files in, creating it if it does not
+// exist, or an error if unsuccessful. Without $XDG_CONFIG_HOME that is
+// ~/.depot, or %APPDATA%\depot on Windows, which has no $HOME.
+func configDir() (string, error) {
+	var dir string
+	if basedir := os.Getenv("XDG_CONFIG_HOME"); basedir != "" {
+		dir = filepath.Join(basedir, "depot")
+	} else if runtime.GOOS == "windows" {
+		basedir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(basedir, "depot")
+	} else {
+		dir = filepath.Join(os.Getenv("HOME"), ".depot")
+	}
+
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// Returns the settings in the config file, or none if there is no config
+// file, or an error if unsuccessful. Each line of the file holds a
+// "name = value" pair, and blank lines and lines beginning with # are
+// ignored.
+func loadConfig() (config, error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, configFilename)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		debugf("config", slog.String("path", path), slog.Bool("found", false))
+		return config{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+	defer f.Close()
+
+	cfg := config{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("config line %v: expected name = value", n)
+		}
+		cfg[strings.TrimSpace(name)] = strings.TrimSpace(val)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+	if name := cfg.profile(); name != "" {
+		if cfg, err = cfg.withProfile(name); err != nil {
+			return nil, err
+		}
+	}
+	if debugLog != nil {
+		// The names of the settings only, since a pass-command may say
+		// too much
+		names := make([]string, 0, len(cfg))
+		for name := range cfg {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		debugf("config", slog.String("path", path), slog.Bool("found", true), slog.Any("settings", names))
+	}
+
+	return cfg, nil
+}
+
+// Returns the rules for key names set in the config with keys.max-length,
+// keys.pattern, keys.nfc, and keys.case-insensitive, or an error if any of
+// them is invalid
+func (cfg config) keyPolicy() (libdepot.KeyPolicy, error) {
+	var policy libdepot.KeyPolicy
+	var err error
+	if val := cfg["keys.max-length"]; val != "" {
+		if policy.MaxLength, err = strconv.Atoi(val); err != nil || policy.MaxLength < 0 {
+			return policy, fmt.Errorf("invalid keys.max-length: %v", val)
+		}
+	}
+	if val := cfg["keys.pattern"]; val != "" {
+		if policy.Pattern, err = regexp.Compile(val); err != nil {
+			return policy, fmt.Errorf("invalid keys.pattern: %w", err)
+		}
+	}
+	for name, flag := range map[string]*bool{
+		"keys.nfc":              &policy.NFC,
+		"keys.case-insensitive": &policy.CaseInsensitive,
+	} {
+		if val := cfg[name]; val != "" {
+			if *flag, err = strconv.ParseBool(val); err != nil {
+				return policy, fmt.Errorf("invalid %v: %v", name, val)
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// Returns the rate limit that depot serve holds its clients to, as set in the
+// config with serve.rate-limit, serve.burst, serve.backoff, and
+// serve.max-backoff, or an error if any of them is invalid. By default a
+// client may make 10 requests a second, 20 at once, and is refused for a
+// second after failing, doubling with each failure in a row up to 15 minutes.
+func (cfg config) rateLimit() (libdepot.RateLimit, error) {
+	limit := libdepot.RateLimit{
+		Rate:       10,
+		Burst:      20,
+		Backoff:    time.Second,
+		MaxBackoff: 15 * time.Minute,
+	}
+	var err error
+	if val := cfg["serve.rate-limit"]; val != "" {
+		if limit.Rate, err = strconv.ParseFloat(val, 64); err != nil || limit.Rate < 0 {
+			return limit, fmt.Errorf("invalid serve.rate-limit: %v", val)
+		}
+	}
+	if val := cfg["serve.burst"]; val != "" {
+		if limit.Burst, err = strconv.Atoi(val); err != nil || limit.Burst < 0 {
+			return limit, fmt.Errorf("invalid serve.burst: %v", val)
+		}
+	}
+	for name, d := range map[string]*time.Duration{
+		"serve.backoff":     &limit.Backoff,
+		"serve.max-backoff": &limit.MaxBackoff,
+	} {
+		if val := cfg[name]; val != "" {
+			if *d, err = parseAge(val); err != nil {
+				return limit, fmt.Errorf("invalid %v: %w", name, err)
+			}
+		}
+	}
+
+	return limit, nil
+}
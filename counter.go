@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Adds --by, or 1, to the counter stored under the key, starting it if
+// there is none, and prints the new count. Returns an error if unsuccessful.
+func increment(storage *libdepot.Depot, opts options) error {
+	delta := int64(1)
+	if opts.by != "" {
+		var err error
+		if delta, err = strconv.ParseInt(opts.by, 10, 64); err != nil {
+			return fmt.Errorf("invalid amount: %v", opts.by)
+		}
+	}
+
+	n, err := storage.Increment(opts.key, delta)
+	if err != nil {
+		return err
+	}
+	fmt.Println(n)
+
+	return nil
+}
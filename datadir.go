@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Returns the directory depot keeps its database in by default, creating it
+// if it does not exist, or an error if unsuccessful. Without $XDG_DATA_HOME
+// that is ~/.local/share/depot, ~/Library/Application Support/depot on
+// macOS, or %LOCALAPPDATA%\depot on Windows.
+func dataDir() (string, error) {
+	var basedir string
+	switch {
+	case os.Getenv("XDG_DATA_HOME") != "":
+		basedir = os.Getenv("XDG_DATA_HOME")
+	case runtime.GOOS == "windows":
+		if basedir = os.Getenv("LOCALAPPDATA"); basedir == "" {
+			return "", errors.New("%LOCALAPPDATA% is not defined")
+		}
+	case runtime.GOOS == "darwin":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		basedir = filepath.Join(home, "Library", "Application Support")
+	default:
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		basedir = filepath.Join(home, ".local", "share")
+	}
+	dir := filepath.Join(basedir, "depot")
+
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// Returns the path of the database depot uses when DEPOT_PATH is not set,
+// first moving it there from the config directory, where depot kept it
+// before, if it is only found there. If it cannot be moved, such as because
+// the two are on different filesystems, it is used where it is. Returns an
+// error if unsuccessful.
+func defaultPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, libdepot.DefaultFilename)
+	if _, err = os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		return path, nil
+	}
+
+	dir, err = configDir()
+	if err != nil {
+		return "", err
+	}
+	old := filepath.Join(dir, libdepot.DefaultFilename)
+	if _, err = os.Stat(old); err != nil {
+		return path, nil
+	}
+	if err = moveDatabase(old, path); err != nil {
+		log.Printf("WARNING: cannot move %v to %v, so it is used where it is "+
+			"(set %v to it to keep it there): %v\n", old, path, envPath, err)
+		return old, nil
+	}
+	log.Printf("Moved %v to %v\n", old, path)
+
+	return path, nil
+}
+
+// Moves the sqlite3 database at old to path, along with its journal or
+// write-ahead log, if any. Returns an error if unsuccessful, in which case
+// the database is left at old.
+func moveDatabase(old, path string) error {
+	var moved []string
+	for _, suffix := range []string{"-wal", "-shm", "-journal", ""} {
+		err := os.Rename(old+suffix, path+suffix)
+		if errors.Is(err, fs.ErrNotExist) && suffix != "" {
+			continue
+		} else if err != nil {
+			for _, s := range moved {
+				os.Rename(path+s, old+s)
+			}
+			return fmt.Errorf("cannot move database: %w", err)
+		}
+		moved = append(moved, suffix)
+	}
+
+	return nil
+}
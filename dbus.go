@@ -0,0 +1,694 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// D-Bus message types
+const (
+	dbusMethodCall   = 1
+	dbusMethodReturn = 2
+	dbusError        = 3
+	dbusSignal       = 4
+)
+
+// D-Bus header fields
+const (
+	dbusFieldPath        = 1
+	dbusFieldInterface   = 2
+	dbusFieldMember      = 3
+	dbusFieldErrorName   = 4
+	dbusFieldReplySerial = 5
+	dbusFieldDestination = 6
+	dbusFieldSender      = 7
+	dbusFieldSignature   = 8
+)
+
+// The longest message D-Bus allows
+const dbusMaxMessage = 128 * 1024 * 1024
+
+// A D-Bus object path, which marshals differently from a string
+type dbusPath string
+
+// A D-Bus type signature, which marshals differently from a string
+type dbusSignature string
+
+// A D-Bus variant: a value along with its signature
+type dbusVariant struct {
+	sig   string
+	value any
+}
+
+// A D-Bus message. The body is decoded into Go values by signature: basic
+// types to their Go counterparts, arrays of bytes to []byte, other arrays and
+// structs to []any, dictionaries to map[any]any, and variants to dbusVariant.
+type dbusMessage struct {
+	typ         byte
+	flags       byte
+	serial      uint32
+	replySerial uint32
+	path        dbusPath
+	iface       string
+	member      string
+	errorName   string
+	destination string
+	sender      string
+	sig         string
+	body        []any
+}
+
+// A connection to a message bus
+type dbusConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	serial uint32
+}
+
+// Connects to the session bus and authenticates as the current user. Returns
+// the connection or an error if unsuccessful.
+func dialSessionBus() (*dbusConn, error) {
+	addr := os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+	if addr == "" {
+		return nil, errors.New("no session bus, as DBUS_SESSION_BUS_ADDRESS is not set")
+	}
+
+	// The address may list several ways to connect, of which only Unix
+	// sockets are tried
+	var err error
+	for _, a := range strings.Split(addr, ";") {
+		transport, params, _ := strings.Cut(a, ":")
+		if transport != "unix" {
+			continue
+		}
+		for _, p := range strings.Split(params, ",") {
+			name, val, _ := strings.Cut(p, "=")
+			var conn net.Conn
+			switch name {
+			case "path":
+				conn, err = net.Dial("unix", unescapeDBusAddress(val))
+			case "abstract":
+				conn, err = net.Dial("unix", "@"+unescapeDBusAddress(val))
+			default:
+				continue
+			}
+			if err != nil {
+				continue
+			}
+			c := &dbusConn{conn: conn, r: bufio.NewReader(conn)}
+			if err = c.auth(); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return c, nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("no supported transport in %v", addr)
+	}
+
+	return nil, fmt.Errorf("cannot connect to the session bus: %w", err)
+}
+
+// Returns the value from a D-Bus address with its %-escapes undone
+func unescapeDBusAddress(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// Authenticates with the EXTERNAL mechanism, by which the bus checks our user
+// ID against the socket's credentials, and says hello. Returns an error if
+// unsuccessful.
+func (c *dbusConn) auth() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := fmt.Fprintf(c.conn, "\x00AUTH EXTERNAL %v\r\n", uid); err != nil {
+		return err
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("session bus refused authentication: %v", strings.TrimSpace(line))
+	}
+	if _, err = io.WriteString(c.conn, "BEGIN\r\n"); err != nil {
+		return err
+	}
+
+	_, err = c.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", "")
+	return err
+}
+
+func (c *dbusConn) Close() error {
+	return c.conn.Close()
+}
+
+// Calls a method on the bus itself and waits for the reply, which must come
+// before any other message, as it does while nothing else is asked of the
+// bus. Returns the body of the reply or an error if unsuccessful.
+func (c *dbusConn) call(dest string, path dbusPath, iface, member, sig string, args ...any) ([]any, error) {
+	msg := &dbusMessage{typ: dbusMethodCall, path: path, iface: iface, member: member, destination: dest, sig: sig, body: args}
+	if err := c.send(msg); err != nil {
+		return nil, err
+	}
+	for {
+		reply, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		if reply.replySerial != msg.serial {
+			continue
+		}
+		if reply.typ == dbusError {
+			text := ""
+			if len(reply.body) > 0 {
+				text, _ = reply.body[0].(string)
+			}
+			return nil, fmt.Errorf("%v: %v", reply.errorName, text)
+		}
+		return reply.body, nil
+	}
+}
+
+// Sends the message, giving it the next serial number. Returns an error if
+// unsuccessful.
+func (c *dbusConn) send(msg *dbusMessage) error {
+	c.serial++
+	msg.serial = c.serial
+
+	body := &dbusEncoder{}
+	if err := body.encodeAll(msg.sig, msg.body); err != nil {
+		return err
+	}
+
+	var fields []any
+	field := func(code byte, sig string, val any) {
+		fields = append(fields, []any{code, dbusVariant{sig, val}})
+	}
+	if msg.path != "" {
+		field(dbusFieldPath, "o", msg.path)
+	}
+	if msg.iface != "" {
+		field(dbusFieldInterface, "s", msg.iface)
+	}
+	if msg.member != "" {
+		field(dbusFieldMember, "s", msg.member)
+	}
+	if msg.errorName != "" {
+		field(dbusFieldErrorName, "s", msg.errorName)
+	}
+	if msg.replySerial != 0 {
+		field(dbusFieldReplySerial, "u", msg.replySerial)
+	}
+	if msg.destination != "" {
+		field(dbusFieldDestination, "s", msg.destination)
+	}
+	if msg.sig != "" {
+		field(dbusFieldSignature, "g", dbusSignature(msg.sig))
+	}
+
+	header := &dbusEncoder{}
+	err := header.encodeAll("yyyyuua(yv)", []any{
+		byte('l'), msg.typ, msg.flags, byte(1), uint32(len(body.buf)), msg.serial, fields,
+	})
+	if err != nil {
+		return err
+	}
+	header.align(8)
+	_, err = c.conn.Write(append(header.buf, body.buf...))
+
+	return err
+}
+
+// Returns the next message from the bus, or an error if unsuccessful
+func (c *dbusConn) receive() (*dbusMessage, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(c.r, fixed); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid D-Bus message byte order %q", fixed[0])
+	}
+	bodyLen, fieldsLen := order.Uint32(fixed[4:]), order.Uint32(fixed[12:])
+	headerLen := (16 + int(fieldsLen) + 7) &^ 7
+	if uint64(headerLen)+uint64(bodyLen) > dbusMaxMessage {
+		return nil, errors.New("D-Bus message too long")
+	}
+	data := make([]byte, headerLen+int(bodyLen))
+	copy(data, fixed)
+	if _, err := io.ReadFull(c.r, data[16:]); err != nil {
+		return nil, err
+	}
+
+	header := &dbusDecoder{buf: data, order: order}
+	vals, err := header.decodeAll("yyyyuua(yv)")
+	if err != nil {
+		return nil, err
+	}
+	msg := &dbusMessage{typ: vals[1].(byte), flags: vals[2].(byte), serial: vals[5].(uint32)}
+	for _, f := range vals[6].([]any) {
+		f := f.([]any)
+		val := f[1].(dbusVariant).value
+		switch f[0].(byte) {
+		case dbusFieldPath:
+			msg.path, _ = val.(dbusPath)
+		case dbusFieldInterface:
+			msg.iface, _ = val.(string)
+		case dbusFieldMember:
+			msg.member, _ = val.(string)
+		case dbusFieldErrorName:
+			msg.errorName, _ = val.(string)
+		case dbusFieldReplySerial:
+			msg.replySerial, _ = val.(uint32)
+		case dbusFieldDestination:
+			msg.destination, _ = val.(string)
+		case dbusFieldSender:
+			msg.sender, _ = val.(string)
+		case dbusFieldSignature:
+			sig, _ := val.(dbusSignature)
+			msg.sig = string(sig)
+		}
+	}
+
+	body := &dbusDecoder{buf: data[headerLen:], order: order}
+	if msg.body, err = body.decodeAll(msg.sig); err != nil {
+		return nil, fmt.Errorf("invalid D-Bus message body: %w", err)
+	}
+
+	return msg, nil
+}
+
+// Replies to the method call with the values in body, whose signature is sig.
+// Returns an error if unsuccessful.
+func (c *dbusConn) reply(call *dbusMessage, sig string, body ...any) error {
+	return c.send(&dbusMessage{
+		typ: dbusMethodReturn, replySerial: call.serial, destination: call.sender, sig: sig, body: body,
+	})
+}
+
+// Replies to the method call with the named error. Returns an error if
+// unsuccessful.
+func (c *dbusConn) replyError(call *dbusMessage, name, text string) error {
+	return c.send(&dbusMessage{
+		typ: dbusError, replySerial: call.serial, destination: call.sender, errorName: name,
+		sig: "s", body: []any{text},
+	})
+}
+
+// Emits a signal from the object at path. Returns an error if unsuccessful.
+func (c *dbusConn) signal(path dbusPath, iface, member, sig string, body ...any) error {
+	return c.send(&dbusMessage{typ: dbusSignal, path: path, iface: iface, member: member, sig: sig, body: body})
+}
+
+// Splits off the first complete type in sig, returning it and the rest
+func nextDBusType(sig string) (string, string, error) {
+	if sig == "" {
+		return "", "", errors.New("signature ended early")
+	}
+	switch sig[0] {
+	case 'a':
+		elem, rest, err := nextDBusType(sig[1:])
+		return "a" + elem, rest, err
+	case '(', '{':
+		end := byte(')')
+		if sig[0] == '{' {
+			end = '}'
+		}
+		inner := sig[1:]
+		for inner != "" && inner[0] != end {
+			var err error
+			if _, inner, err = nextDBusType(inner); err != nil {
+				return "", "", err
+			}
+		}
+		if inner == "" {
+			return "", "", fmt.Errorf("unbalanced signature %q", sig)
+		}
+		n := len(sig) - len(inner) + 1
+		return sig[:n], sig[n:], nil
+	default:
+		if !strings.ContainsRune("ybnqiuxtdsogvh", rune(sig[0])) {
+			return "", "", fmt.Errorf("unsupported type %q in signature", sig[0])
+		}
+		return sig[:1], sig[1:], nil
+	}
+}
+
+// Returns the boundary a value of the given type is aligned to
+func dbusAlignment(sig string) int {
+	switch sig[0] {
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 's', 'o', 'a', 'h':
+		return 4
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	default:
+		return 1
+	}
+}
+
+// Marshals values in the little-endian D-Bus wire format
+type dbusEncoder struct {
+	buf []byte
+}
+
+func (e *dbusEncoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+// Marshals vals, whose types are given in order by sig. Returns an error if
+// they don't match.
+func (e *dbusEncoder) encodeAll(sig string, vals []any) error {
+	for _, v := range vals {
+		t, rest, err := nextDBusType(sig)
+		if err != nil {
+			return err
+		}
+		if err = e.encode(t, reflect.ValueOf(v)); err != nil {
+			return err
+		}
+		sig = rest
+	}
+	if sig != "" {
+		return fmt.Errorf("missing values for signature %q", sig)
+	}
+
+	return nil
+}
+
+// Marshals v as a value of the single complete type sig. Returns an error if
+// v cannot be one.
+func (e *dbusEncoder) encode(sig string, v reflect.Value) error {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return fmt.Errorf("no value for %q", sig)
+	}
+	e.align(dbusAlignment(sig))
+	le := binary.LittleEndian
+
+	switch sig[0] {
+	case 'y':
+		e.buf = append(e.buf, byte(v.Uint()))
+	case 'b':
+		var b uint32
+		if v.Bool() {
+			b = 1
+		}
+		e.buf = le.AppendUint32(e.buf, b)
+	case 'n':
+		e.buf = le.AppendUint16(e.buf, uint16(v.Int()))
+	case 'q':
+		e.buf = le.AppendUint16(e.buf, uint16(v.Uint()))
+	case 'i':
+		e.buf = le.AppendUint32(e.buf, uint32(v.Int()))
+	case 'u', 'h':
+		e.buf = le.AppendUint32(e.buf, uint32(v.Uint()))
+	case 'x':
+		e.buf = le.AppendUint64(e.buf, uint64(v.Int()))
+	case 't':
+		e.buf = le.AppendUint64(e.buf, v.Uint())
+	case 'd':
+		e.buf = le.AppendUint64(e.buf, math.Float64bits(v.Float()))
+	case 's', 'o':
+		e.buf = le.AppendUint32(e.buf, uint32(v.Len()))
+		e.buf = append(append(e.buf, v.String()...), 0)
+	case 'g':
+		e.buf = append(e.buf, byte(v.Len()))
+		e.buf = append(append(e.buf, v.String()...), 0)
+	case 'v':
+		variant, ok := v.Interface().(dbusVariant)
+		if !ok {
+			return fmt.Errorf("%v is not a variant", v.Type())
+		}
+		if err := e.encode("g", reflect.ValueOf(variant.sig)); err != nil {
+			return err
+		}
+		return e.encode(variant.sig, reflect.ValueOf(variant.value))
+	case '(':
+		fields, ok := v.Interface().([]any)
+		if !ok {
+			return fmt.Errorf("%v is not a struct", v.Type())
+		}
+		return e.encodeAll(sig[1:len(sig)-1], fields)
+	case 'a':
+		// The length comes first, but is only known once the elements
+		// have been marshalled after padding to their alignment
+		e.buf = le.AppendUint32(e.buf, 0)
+		lenAt := len(e.buf) - 4
+		elem := sig[1:]
+		e.align(dbusAlignment(elem))
+		start := len(e.buf)
+
+		if elem[0] == '{' {
+			if v.Kind() != reflect.Map {
+				return fmt.Errorf("%v is not a map", v.Type())
+			}
+			key, val, err := nextDBusType(elem[1 : len(elem)-1])
+			if err != nil {
+				return err
+			}
+			keys := v.MapKeys()
+			sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+			for _, k := range keys {
+				e.align(8)
+				if err = e.encode(key, k); err != nil {
+					return err
+				}
+				if err = e.encode(val, v.MapIndex(k)); err != nil {
+					return err
+				}
+			}
+		} else {
+			if v.Kind() != reflect.Slice {
+				return fmt.Errorf("%v is not a slice", v.Type())
+			}
+			for i := 0; i < v.Len(); i++ {
+				if err := e.encode(elem, v.Index(i)); err != nil {
+					return err
+				}
+			}
+		}
+		le.PutUint32(e.buf[lenAt:], uint32(len(e.buf)-start))
+	default:
+		return fmt.Errorf("cannot marshal type %q", sig)
+	}
+
+	return nil
+}
+
+// Unmarshals values from the D-Bus wire format
+type dbusDecoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+var errDBusShort = errors.New("D-Bus message ended early")
+
+func (d *dbusDecoder) align(n int) error {
+	d.pos = (d.pos + n - 1) / n * n
+	if d.pos > len(d.buf) {
+		return errDBusShort
+	}
+
+	return nil
+}
+
+func (d *dbusDecoder) take(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.buf) {
+		return nil, errDBusShort
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+
+	return b, nil
+}
+
+// Unmarshals values of the types given in order by sig. Returns them or an
+// error if unsuccessful.
+func (d *dbusDecoder) decodeAll(sig string) ([]any, error) {
+	var vals []any
+	for sig != "" {
+		t, rest, err := nextDBusType(sig)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.decode(t)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+		sig = rest
+	}
+
+	return vals, nil
+}
+
+// Unmarshals a value of the single complete type sig. Returns it or an error
+// if unsuccessful.
+func (d *dbusDecoder) decode(sig string) (any, error) {
+	if err := d.align(dbusAlignment(sig)); err != nil {
+		return nil, err
+	}
+	switch sig[0] {
+	case 'y':
+		b, err := d.take(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b':
+		b, err := d.take(4)
+		if err != nil {
+			return nil, err
+		}
+		return d.order.Uint32(b) != 0, nil
+	case 'n', 'q':
+		b, err := d.take(2)
+		if err != nil {
+			return nil, err
+		}
+		if sig[0] == 'n' {
+			return int16(d.order.Uint16(b)), nil
+		}
+		return d.order.Uint16(b), nil
+	case 'i', 'u', 'h':
+		b, err := d.take(4)
+		if err != nil {
+			return nil, err
+		}
+		if sig[0] == 'i' {
+			return int32(d.order.Uint32(b)), nil
+		}
+		return d.order.Uint32(b), nil
+	case 'x', 't', 'd':
+		b, err := d.take(8)
+		if err != nil {
+			return nil, err
+		}
+		switch sig[0] {
+		case 'x':
+			return int64(d.order.Uint64(b)), nil
+		case 'd':
+			return math.Float64frombits(d.order.Uint64(b)), nil
+		}
+		return d.order.Uint64(b), nil
+	case 's', 'o':
+		b, err := d.take(4)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.take(int(d.order.Uint32(b)) + 1)
+		if err != nil {
+			return nil, err
+		}
+		if sig[0] == 'o' {
+			return dbusPath(s[:len(s)-1]), nil
+		}
+		return string(s[:len(s)-1]), nil
+	case 'g':
+		b, err := d.take(1)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.take(int(b[0]) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return dbusSignature(s[:len(s)-1]), nil
+	case 'v':
+		s, err := d.decode("g")
+		if err != nil {
+			return nil, err
+		}
+		inner := string(s.(dbusSignature))
+		if t, rest, err := nextDBusType(inner); err != nil || rest != "" || t == "" {
+			return nil, fmt.Errorf("invalid variant signature %q", inner)
+		}
+		v, err := d.decode(inner)
+		if err != nil {
+			return nil, err
+		}
+		return dbusVariant{inner, v}, nil
+	case '(', '{':
+		return d.decodeAll(sig[1 : len(sig)-1])
+	case 'a':
+		b, err := d.take(4)
+		if err != nil {
+			return nil, err
+		}
+		n := int(d.order.Uint32(b))
+		elem := sig[1:]
+		if err = d.align(dbusAlignment(elem)); err != nil {
+			return nil, err
+		}
+		if elem == "y" {
+			data, err := d.take(n)
+			return bytes.Clone(data), err
+		}
+		end := d.pos + n
+		if end > len(d.buf) {
+			return nil, errDBusShort
+		}
+
+		if elem[0] == '{' {
+			m := map[any]any{}
+			for d.pos < end {
+				entry, err := d.decode(elem)
+				if err != nil {
+					return nil, err
+				}
+				kv := entry.([]any)
+				m[kv[0]] = kv[1]
+			}
+			return m, nil
+		}
+		vals := []any{}
+		for d.pos < end {
+			v, err := d.decode(elem)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, v)
+		}
+		return vals, nil
+	default:
+		return nil, fmt.Errorf("cannot unmarshal type %q", sig)
+	}
+}
@@ -0,0 +1,198 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestDBusRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		sig  string
+		in   []any
+		// What decoding gives back, if not in
+		out []any
+	}{
+		{"basic types", "ybnqiuxtd", []any{
+			byte(7), true, int16(-2), uint16(3), int32(-4), uint32(5), int64(-6), uint64(7), 8.5,
+		}, nil},
+		{"strings", "sog", []any{"hello", dbusPath("/a/b"), dbusSignature("a{sv}")}, nil},
+		{"bytes", "ay", []any{[]byte("secret")}, nil},
+		{"empty bytes", "ay", []any{[]byte{}}, nil},
+		{"array of strings", "as", []any{[]string{"a", "bc"}}, []any{[]any{"a", "bc"}}},
+		{"array of paths", "ao", []any{[]dbusPath{"/a", "/b"}}, []any{[]any{dbusPath("/a"), dbusPath("/b")}}},
+		{"empty array", "ao", []any{[]dbusPath{}}, []any{[]any{}}},
+		{"struct", "(oayays)", []any{[]any{dbusPath("/s"), []byte{1}, []byte("v"), "text/plain"}}, nil},
+		{"dictionary", "a{ss}", []any{map[string]string{"b": "2", "a": "1"}},
+			[]any{map[any]any{"a": "1", "b": "2"}}},
+		{"variants", "vv", []any{dbusVariant{"s", "x"}, dbusVariant{"ao", []dbusPath{"/a"}}},
+			[]any{dbusVariant{"s", "x"}, dbusVariant{"ao", []any{dbusPath("/a")}}}},
+		{"dictionary of variants", "a{sv}", []any{map[string]dbusVariant{
+			"Label":  {"s", "depot"},
+			"Locked": {"b", false},
+			"Count":  {"t", uint64(3)},
+		}}, []any{map[any]any{
+			"Label":  dbusVariant{"s", "depot"},
+			"Locked": dbusVariant{"b", false},
+			"Count":  dbusVariant{"t", uint64(3)},
+		}}},
+		{"nested arrays", "aai", []any{[][]int32{{1, 2}, {}, {3}}},
+			[]any{[]any{[]any{int32(1), int32(2)}, []any{}, []any{int32(3)}}}},
+		{"header", "yyyyuua(yv)", []any{
+			byte('l'), byte(1), byte(0), byte(1), uint32(0), uint32(9),
+			[]any{[]any{byte(1), dbusVariant{"o", dbusPath("/p")}}, []any{byte(8), dbusVariant{"g", dbusSignature("s")}}},
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &dbusEncoder{}
+			if err := e.encodeAll(tt.sig, tt.in); err != nil {
+				t.Fatalf("error encoding: %v", err)
+			}
+			d := &dbusDecoder{buf: e.buf, order: binary.LittleEndian}
+			got, err := d.decodeAll(tt.sig)
+			if err != nil {
+				t.Fatalf("error decoding %x: %v", e.buf, err)
+			}
+			want := tt.out
+			if want == nil {
+				want = tt.in
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %#v but got %#v", want, got)
+			}
+			if d.pos != len(e.buf) {
+				t.Errorf("expected all %v bytes to be read but %v were", len(e.buf), d.pos)
+			}
+		})
+	}
+}
+
+func TestDBusAlignment(t *testing.T) {
+	tests := []struct {
+		name string
+		sig  string
+		in   []any
+		want []byte
+	}{
+		{"uint64 after a byte", "yt", []any{byte(1), uint64(2)},
+			[]byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0}},
+		{"int16 after a byte", "yn", []any{byte(1), int16(-1)}, []byte{1, 0, 0xff, 0xff}},
+		{"string after a byte", "ys", []any{byte(1), "ab"}, []byte{1, 0, 0, 0, 2, 0, 0, 0, 'a', 'b', 0}},
+		// The elements are padded to 8 even when there are none, and the
+		// length does not count the padding
+		{"empty array of structs", "ya(y)", []any{byte(1), [][]any{}},
+			[]byte{1, 0, 0, 0, 0, 0, 0, 0}},
+		{"array of structs", "a(y)", []any{[][]any{{byte(1)}, {byte(2)}}},
+			[]byte{9, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2}},
+		{"variant holding a uint64", "v", []any{dbusVariant{"t", uint64(1)}},
+			[]byte{1, 't', 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &dbusEncoder{}
+			if err := e.encodeAll(tt.sig, tt.in); err != nil {
+				t.Fatalf("error encoding: %v", err)
+			}
+			if !bytes.Equal(e.buf, tt.want) {
+				t.Errorf("expected %x but got %x", tt.want, e.buf)
+			}
+		})
+	}
+}
+
+func TestDBusBigEndian(t *testing.T) {
+	data := []byte{
+		0, 0, 0, 2, 'a', 'b', 0, 0, // s
+		0, 0, 0, 0, 0, 0, 0, 3, // t
+		0, 0, 0, 8, 0, 0, 0, 1, 0, 0, 0, 2, // ai
+	}
+	got, err := (&dbusDecoder{buf: data, order: binary.BigEndian}).decodeAll("stai")
+	if err != nil {
+		t.Fatalf("error decoding: %v", err)
+	}
+	want := []any{"ab", uint64(3), []any{int32(1), int32(2)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %#v but got %#v", want, got)
+	}
+}
+
+func TestDBusInvalid(t *testing.T) {
+	for _, sig := range []string{"a", "(ss", "a{s", "z"} {
+		if _, _, err := nextDBusType(sig); err == nil {
+			t.Errorf("expected an error splitting %q", sig)
+		}
+	}
+	if err := (&dbusEncoder{}).encodeAll("ss", []any{"a"}); err == nil {
+		t.Errorf("expected an error encoding too few values")
+	}
+	if err := (&dbusEncoder{}).encodeAll("v", []any{"a"}); err == nil {
+		t.Errorf("expected an error encoding a string as a variant")
+	}
+
+	tests := []struct {
+		name string
+		sig  string
+		data []byte
+	}{
+		{"short uint32", "u", []byte{1, 0}},
+		{"string past the end", "s", []byte{9, 0, 0, 0, 'a', 0}},
+		{"array past the end", "ay", []byte{9, 0, 0, 0, 1}},
+		{"bad variant signature", "v", []byte{2, 's', 's', 0, 0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		d := &dbusDecoder{buf: tt.data, order: binary.LittleEndian}
+		if _, err := d.decodeAll(tt.sig); err == nil {
+			t.Errorf("%v: expected an error", tt.name)
+		}
+	}
+}
+
+func TestDBusMessage(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	sender := &dbusConn{conn: client}
+	receiver := &dbusConn{conn: server, r: bufio.NewReader(server)}
+
+	sent := &dbusMessage{
+		typ:         dbusMethodCall,
+		path:        ssCollectionPath,
+		iface:       ssCollection,
+		member:      "SearchItems",
+		destination: ssBusName,
+		sig:         "a{ss}",
+		body:        []any{map[string]string{"service": "git"}},
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- sender.send(sent) }()
+
+	got, err := receiver.receive()
+	if err != nil {
+		t.Fatalf("error receiving: %v", err)
+	}
+	if err = <-errs; err != nil {
+		t.Fatalf("error sending: %v", err)
+	}
+	want := &dbusMessage{
+		typ:         dbusMethodCall,
+		serial:      1,
+		path:        ssCollectionPath,
+		iface:       ssCollection,
+		member:      "SearchItems",
+		destination: ssBusName,
+		sig:         "a{ss}",
+		body:        []any{map[any]any{"service": "git"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Where --debug logs to, or nil without it
+var debugLog *slog.Logger
+
+// Starts logging what depot does, and how long it takes, to stderr at debug
+// level, as JSON with --format json. The depot logs to it as well (see
+// libdepot.WithLogger), including each SQL statement it runs.
+func startDebugLog(opts options) {
+	handlerOpts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	if opts.format == libdepot.FormatJSON {
+		debugLog = slog.New(slog.NewJSONHandler(os.Stderr, handlerOpts))
+	} else {
+		debugLog = slog.New(slog.NewTextHandler(os.Stderr, handlerOpts))
+	}
+}
+
+// Logs msg with args if --debug was given
+func debugf(msg string, args ...any) {
+	if debugLog != nil {
+		debugLog.Debug(msg, args...)
+	}
+}
+
+// Logs that step, begun at start, is done, or failed with err if it is not
+// nil, and how long it took, if --debug was given
+func debugStep(step string, start time.Time, err error) {
+	args := []any{slog.String("step", step), slog.Duration("took", time.Since(start))}
+	if err != nil {
+		args = append(args, slog.Any("error", err))
+	}
+	debugf("done", args...)
+}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/adonSh/depot/libdepot"
 	"golang.org/x/term"
@@ -16,174 +21,747 @@ import (
 
 const (
 	// Commands
-	actStow  = "stow"
-	actFetch = "fetch"
-	actDrop  = "drop"
-	actHelp  = "help"
+	actStow        = "stow"
+	actAppend      = "append"
+	actIncrement   = "increment"
+	actFetch       = "fetch"
+	actDrop        = "drop"
+	actTrash       = "trash"
+	actList        = "list"
+	actEdit        = "edit"
+	actGen         = "gen"
+	actMove        = "mv"
+	actCopy        = "cp"
+	actAlias       = "alias"
+	actInfo        = "info"
+	actShare       = "share"
+	actStale       = "stale"
+	actRotation    = "rotation"
+	actNamespace   = "namespace"
+	actAttach      = "attach"
+	actGetAttach   = "get-attachment"
+	actTOTP        = "totp"
+	actRun         = "run"
+	actTemplate    = "template"
+	actMount       = "mount"
+	actDockerCred  = "docker-credential"
+	actGitCred     = "git-credential"
+	actAskpass     = "askpass"
+	actSystemdCred = "systemd-credential"
+	actGrep        = "grep"
+	actUI          = "ui"
+	actUnlock      = "unlock"
+	actLock        = "lock"
+	actServe       = "serve"
+	actSecretSvc   = "secret-service"
+	actSync        = "sync"
+	actTransfer    = "transfer"
+	actPull        = "pull"
+	actPush        = "push"
+	actExport      = "export"
+	actImport      = "import"
+	actBackup      = "backup"
+	actRestore     = "restore"
+	actCompact     = "compact"
+	actDoctor      = "doctor"
+	actStats       = "stats"
+	actMigrate     = "migrate"
+	actUserAdd     = "useradd"
+	actUserDel     = "userdel"
+	actUsers       = "users"
+	actGrant       = "grant"
+	actRevoke      = "revoke"
+	actAudit       = "audit"
+	actCompletion  = "completion"
+	actHelp        = "help"
 
 	// Environment Variables
-	envPath = "DEPOT_PATH"
-	envPass = "DEPOT_PASS"
+	envPath        = "DEPOT_PATH"
+	envPass        = "DEPOT_PASS"
+	envPassCommand = "DEPOT_PASS_COMMAND"
+	envKeyfile     = "DEPOT_KEYFILE"
+	envToken       = "DEPOT_TOKEN"
+	envBackupDir   = "DEPOT_BACKUP_DIR"
 )
 
+// Options specified on the command line
+type options struct {
+	action         string
+	key            string
+	extraKeys      []string
+	env            []string
+	command        []string
+	out            string
+	secret         bool
+	noNewline      bool
+	help           bool
+	debug          bool
+	keyfile        string
+	passFd         string
+	passFile       string
+	profile        string
+	force          bool
+	ephemeral      bool
+	nonInteractive bool
+	addr           string
+	grpcAddr       string
+	csiSocket      string
+	tlsCert        string
+	tlsKey         string
+	conflict       string
+	all            bool
+	format         string
+	decrypt        bool
+	backupDir      string
+	keep           string
+	pattern        string
+	admin          bool
+	prefix         string
+	perm           string
+	since          string
+	field          string
+	olderThan      string
+	expires        string
+	by             string
+	uses           string
+	user           string
+	sort           string
+	length         string
+	symbols        bool
+	words          bool
+	clip           bool
+	names          bool
+	pick           bool
+	qr             bool
+	batch          bool
+	to             string
+	from           string
+	move           bool
+	fromFile       string
+	value          string
+	repair         bool
+	unlockKey      []byte
+}
+
+// Reports whether values can be decrypted without a password typed at the
+// console, because a keyfile is in use or the depot is unlocked
+func (opts options) hasKey() bool {
+	return opts.keyfile != "" || opts.unlockKey != nil
+}
+
+// The actions depot takes when run under the name of a helper program that
+// other tools look for (through a symlink, say)
+var helperNames = map[string]string{
+	dockerHelperName: actDockerCred,
+	gitHelperName:    actGitCred,
+	askpassName:      actAskpass,
+}
+
+// Actions that change the depot, after which it is backed up if an automatic
+// backup is due
+var changing = map[string]bool{
+	actStow:       true,
+	actAppend:     true,
+	actIncrement:  true,
+	actDrop:       true,
+	actTrash:      true,
+	actEdit:       true,
+	actGen:        true,
+	actMove:       true,
+	actCopy:       true,
+	actAlias:      true,
+	actRotation:   true,
+	actShare:      true,
+	actNamespace:  true,
+	actAttach:     true,
+	actUI:         true,
+	actSync:       true,
+	actTransfer:   true,
+	actPull:       true,
+	actImport:     true,
+	actMigrate:    true,
+	actDockerCred: true,
+	actGitCred:    true,
+	actSecretSvc:  true,
+}
+
 func main() {
 	// Parse command line
 	log.SetFlags(0)
-	action, key, secret, newline, err := parseArgs(os.Args[1:])
+	if len(os.Args) == 3 && os.Args[1] == actEphemeralDaemon {
+		session, err := strconv.Atoi(os.Args[2])
+		if err != nil {
+			fatalUsage("%v\n", err)
+		}
+		if err = serveEphemeral(session); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if len(os.Args) == 3 && os.Args[1] == actClipClear {
+		if err := clearClip(os.Args[2]); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	args := os.Args[1:]
+	if action, ok := helperNames[filepath.Base(os.Args[0])]; ok {
+		// Run as docker-credential-depot <operation>, say
+		args = append([]string{action}, args...)
+	}
+	opts, err := parseArgs(args)
 	if err != nil {
-		log.Fatalf("Invalid args: %v\n", err)
+		fatalUsage("%v\n", err)
+	}
+	if opts.format == libdepot.FormatJSON {
+		log.SetOutput(jsonLog{os.Stderr})
+	}
+	if opts.debug {
+		startDebugLog(opts)
+		debugf("running", slog.String("action", opts.action))
+	}
+	setNonInteractive(opts)
+	if err = applyProfile(&opts); err != nil {
+		fatal(err)
+	}
+	if err = readGivenPassword(opts); err != nil {
+		fatal(err)
+	}
+	if opts.action == actHelp {
+		help := usage()
+		if opts.key != "" {
+			if help, err = commandUsage(opts.key); err != nil {
+				fatalUsage("%v\n", err)
+			}
+		}
+		fmt.Println(help)
+		return
+	}
+	if opts.action == actCompletion {
+		if err = completion(opts.key); err != nil {
+			fatal(err)
+		}
+		return
 	}
 
 	// Initialize
-	dbPath, err := choosePath()
-	if err != nil {
-		log.Fatalf("Error: %v\n", err)
+	if opts.action == actLock {
+		if err = lock(); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if opts.action != actUnlock {
+		opts.unlockKey = agentKey(opts)
 	}
-	storage, err := libdepot.NewDepot(dbPath)
+	start := time.Now()
+	storage, err := openDepot(opts)
+	debugStep("open depot", start, err)
 	if err != nil {
-		log.Fatalf("Error: %v", err)
+		fatal(err)
 	}
+	cleanup = func() { storage.Close() }
+	defer cleanup()
 
 	// Do the thing
-	switch action {
+	key := opts.key
+	start = time.Now()
+	switch opts.action {
 	case actStow:
-		val, err := getVal(secret)
-		if err != nil {
-			log.Fatalf("Error: %v\n", err)
+		if (key == "") != opts.batch {
+			fatalUsage("give a key, or --batch to read keys and values from stdin\n")
+		}
+		if opts.value != "" && opts.secret {
+			fatalUsage("--value would leave a secret in your shell history, read it from stdin or --from-file\n")
+		}
+		if opts.value != "" && (opts.batch || opts.fromFile != "") {
+			fatalUsage("--value cannot be given with --from-file or --batch\n")
+		}
+		if opts.field != "" && opts.batch {
+			fatalUsage("--field cannot be given with --batch\n")
+		}
+		if opts.batch {
+			if err = stowBatch(storage, opts); err != nil {
+				fatal(err)
+			}
+			break
 		}
 
-		password, err := getPassword(secret)
+		val, err := stowValue(opts, storage.MaxValueSize())
 		if err != nil {
-			log.Fatalf("Error: %v\n", err)
+			fatal(err)
 		}
 
-		err = storage.Stow(key, val, password)
+		password, err := getNewPassword(opts.secret, opts.hasKey())
 		if err != nil {
-			log.Fatalf("Error: %v\n", err)
+			fatal(err)
 		}
-	case actFetch:
-		val, err := storage.Fetch(key, nil)
-		if errors.Is(err, libdepot.ErrPasswordNeeded) {
-			password, err := getPassword(true)
-			if err != nil {
-				log.Fatalf("Error: %v\n", err)
-			}
 
-			val, err = storage.Fetch(key, password)
-			if err != nil {
-				log.Fatalf("Error: %v\n", err)
+		if opts.field != "" {
+			err = storage.StowField(key, opts.field, val, password)
+			if errors.Is(err, libdepot.ErrPasswordNeeded) {
+				err = fmt.Errorf("%v is encrypted, use -s to give its password", key)
 			}
-		} else if err != nil {
-			log.Fatalf("Error: %v\n", err)
-		}
-
-		if newline {
-			fmt.Println(val)
 		} else {
-			fmt.Print(val)
+			err = storage.Stow(key, val, password)
 		}
-	case actDrop:
-		err = storage.Drop(key)
 		if err != nil {
-			log.Fatalf("Error: %v\n", err)
+			fatal(err)
+		}
+	case actFetch:
+		if err = fetch(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actDrop:
+		if (key == "") == (opts.pattern == "") {
+			fatalUsage("give a key, or --pattern to drop every key matching it\n")
+		}
+		if err = drop(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actTrash:
+		if err = trash(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actEdit:
+		if err = edit(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actGen:
+		if err = generate(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actMove, actCopy:
+		if err = moveKey(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actAlias:
+		if err = alias(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actNamespace:
+		if err = namespace(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actAttach:
+		if err = attachFile(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actGetAttach:
+		if err = getAttachment(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actRun:
+		if err = runCommand(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actTemplate:
+		if err = renderTemplate(storage, key, opts); err != nil {
+			fatal(err)
+		}
+	case actDockerCred:
+		if !contains(dockerOps, key) {
+			fatalUsage("%v is not a credential helper operation, expected %v\n", key, strings.Join(dockerOps, ", "))
+		}
+		if err = dockerCredential(storage, key, opts); err != nil {
+			fatal(err)
+		}
+	case actGitCred:
+		if err = gitCredential(storage, key, opts); err != nil {
+			fatal(err)
+		}
+	case actAskpass:
+		if err = askpass(storage, key, opts); err != nil {
+			fatal(err)
+		}
+	case actSystemdCred:
+		if err = systemdCredential(storage, key, opts); err != nil {
+			fatal(err)
+		}
+	case actMount:
+		if err = mount(storage, key, opts); err != nil {
+			fatal(err)
+		}
+	case actTOTP:
+		if err = printTOTP(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actGrep:
+		if err = grep(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actInfo:
+		if err = printInfo(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actAppend:
+		if opts.value != "" && opts.secret {
+			fatalUsage("--value would leave a secret in your shell history, read it from stdin or --from-file\n")
+		}
+		if opts.value != "" && opts.fromFile != "" {
+			fatalUsage("--value cannot be given with --from-file\n")
+		}
+		if err = appendValue(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actIncrement:
+		if err = increment(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actShare:
+		if err = share(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actUI:
+		if err = runUI(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actUnlock:
+		if err = unlock(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actList:
+		if err = listKeys(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actStale:
+		if err = listStale(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actRotation:
+		if err = setRotation(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actServe:
+		if err = serve(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actSecretSvc:
+		if err = serveSecretService(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actSync:
+		if err = syncDepot(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actTransfer:
+		if (opts.to == "") == (opts.from == "") {
+			fatalUsage("give either --to or --from\n")
+		}
+		if err = transfer(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actPull:
+		if err = storage.Pull(); err != nil {
+			fatal(err)
+		}
+	case actPush:
+		if err = storage.Push(); err != nil {
+			fatal(err)
+		}
+	case actExport:
+		if opts.key == "" && !opts.all {
+			fatalUsage("give a pattern or --all to export everything\n")
+		}
+		if err = export(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actImport:
+		if opts.from != "" && opts.format != "" {
+			fatalUsage("give either --from or --format\n")
+		}
+		if opts.from != "" && importSources[opts.from] == nil {
+			fatalUsage("cannot import from %v\n", opts.from)
+		}
+		if opts.format == libdepot.FormatKeePass {
+			fatalUsage("use --from keepass to import a KeePass database\n")
+		}
+		if opts.key != "" && opts.from == "" {
+			fatalUsage("give a path only with --from\n")
+		}
+		if err = importValues(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actBackup:
+		if err = backup(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actRestore:
+		if err = restore(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actCompact:
+		if err = compact(storage); err != nil {
+			fatal(err)
+		}
+	case actMigrate:
+		if err = migrateSecrets(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actDoctor:
+		if err = doctor(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actStats:
+		if err = printStats(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actUserAdd:
+		if err = addUser(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actUserDel:
+		if err = storage.RemoveUser(key); err != nil {
+			fatal(err)
+		}
+	case actUsers:
+		if err = listUsers(storage); err != nil {
+			fatal(err)
+		}
+	case actGrant:
+		if err = grant(storage, opts); err != nil {
+			fatal(err)
+		}
+	case actRevoke:
+		if err = storage.Revoke(key, opts.prefix); err != nil {
+			fatal(err)
+		}
+	case actAudit:
+		if err = printAudit(storage, opts); err != nil {
+			fatal(err)
 		}
-	case actHelp:
-		fmt.Println(usage())
 	default:
-		log.Fatalf("Unrecognized action: %v\n", action)
+		fatalUsage("unrecognized action: %v\n", opts.action)
+	}
+	debugStep(opts.action, start, nil)
+
+	if changing[opts.action] && !opts.ephemeral {
+		if err = autoBackup(storage, opts); err != nil {
+			log.Printf("Warning: automatic backup failed: %v\n", err)
+		}
 	}
 }
 
-// Returns the key, options, and action to perform specified in the
-// command-line arguments or an error if unsuccessful
-func parseArgs(args []string) (string, string, bool, bool, error) {
-	action := ""
-	key := ""
-	secret := false
-	newline := true
-
-	for _, a := range args {
-		if a == "-h" || a == "--help" || a == "-?" {
-			return actHelp, key, secret, newline, nil
-		}
-
-		if strings.HasPrefix(a, "-") {
-			secret = secret || strings.Contains(a, "s")
-			newline = !(!newline || strings.Contains(a, "n"))
-		} else if action == "" {
-			if a == actHelp {
-				return actHelp, key, secret, newline, nil
-			}
-			action = a
-		} else if key == "" {
-			key = a
-		} else {
-			return action, key, secret, newline, fmt.Errorf("one key at a time")
+// Returns the depot selected by the command-line options and environment or
+// an error if unsuccessful
+func openDepot(opts options) (*libdepot.Depot, error) {
+	depotOpts, err := depotOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.unlockKey != nil {
+		depotOpts = append(depotOpts, libdepot.WithDerivedKey(opts.unlockKey))
+	}
+
+	if opts.ephemeral {
+		debugf("database", slog.String("from", "ephemeral"))
+		backend, err := dialEphemeral()
+		if err != nil {
+			return nil, err
 		}
+		return libdepot.NewDepotWithBackend(backend, depotOpts...)
 	}
 
-	if action == "" {
-		return action, key, secret, newline, fmt.Errorf("no action specified")
+	dbPath, err := choosePath()
+	if err != nil {
+		return nil, err
 	}
-	if key == "" {
-		return action, key, secret, newline, fmt.Errorf("no key specified")
+
+	return libdepot.NewDepot(dbPath, depotOpts...)
+}
+
+// Returns the options for opening a depot that follow from the command-line
+// options and environment or an error if unsuccessful
+func depotOptions(opts options) ([]libdepot.Option, error) {
+	depotOpts := []libdepot.Option{libdepot.WithActor(actor())}
+	if debugLog != nil {
+		depotOpts = append(depotOpts, libdepot.WithLogger(debugLog))
+		var set []string
+		for _, name := range []string{envPath, envPass, envPassCommand, envKeyfile, envToken, envBackupDir, envProfile, envNonInteractive, "XDG_CONFIG_HOME", "XDG_DATA_HOME"} {
+			if os.Getenv(name) != "" {
+				set = append(set, name)
+			}
+		}
+		debugf("environment", slog.Any("set", set))
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	for name, val := range cfg {
+		if pragma, ok := strings.CutPrefix(name, "sqlite."); ok {
+			depotOpts = append(depotOpts, libdepot.WithSQLitePragma(pragma, val))
+		}
 	}
+	if val := cfg["compression-threshold"]; val != "" {
+		threshold, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid compression threshold: %v", val)
+		}
+		depotOpts = append(depotOpts, libdepot.WithCompressionThreshold(threshold))
+	}
+	maxSize := defaultMaxValueSize
+	if val := cfg["max-value-size"]; val != "" {
+		if maxSize, err = strconv.Atoi(val); err != nil {
+			return nil, fmt.Errorf("invalid max value size: %v", val)
+		}
+	}
+	depotOpts = append(depotOpts, libdepot.WithMaxValueSize(maxSize))
+	policy, err := cfg.keyPolicy()
+	if err != nil {
+		return nil, err
+	}
+	depotOpts = append(depotOpts, libdepot.WithKeyPolicy(policy))
+	if opts.action == actServe {
+		limit, err := cfg.rateLimit()
+		if err != nil {
+			return nil, err
+		}
+		depotOpts = append(depotOpts, libdepot.WithRateLimit(limit))
+	}
+	if opts.keyfile != "" {
+		keyfile, err := os.ReadFile(opts.keyfile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read keyfile: %w", err)
+		}
+		depotOpts = append(depotOpts, libdepot.WithKeyfile(keyfile))
+	}
+	if token := os.Getenv(envToken); token != "" {
+		depotOpts = append(depotOpts, libdepot.WithToken(token))
+	}
+	depotOpts = append(depotOpts, libdepot.WithWeakPasswordFunc(
+		func(key string, entropy float64) error {
+			if opts.force {
+				log.Printf("Warning: weak password for %v (about %.0f bits of entropy)\n", key, entropy)
+				return nil
+			}
+			return fmt.Errorf("%w (about %.0f bits of entropy), use --force to stow anyway",
+				libdepot.ErrWeakPassword, entropy)
+		}))
+	depotOpts = append(depotOpts, libdepot.WithInsecureFileFunc(
+		func(path string, mode fs.FileMode) error {
+			log.Printf("WARNING: %v has mode %v, so other users may be able to read it; "+
+				"run depot doctor --repair to fix\n", path, mode.Perm())
+			return nil
+		}))
 
-	return action, key, secret, newline, nil
+	return depotOpts, nil
 }
 
 // Returns the location of the database in the filesystem depending on the
-// environment or an error if unsuccessful
+// environment and config file or an error if unsuccessful
 func choosePath() (string, error) {
 	path := os.Getenv(envPath)
 	if path != "" {
+		debugf("database", slog.String("path", path), slog.String("from", envPath))
 		return path, nil
 	}
 
-	basedir := os.Getenv("XDG_CONFIG_HOME")
-	if basedir == "" {
-		path = filepath.Join(os.Getenv("HOME"), ".depot")
-	} else {
-		path = filepath.Join(basedir, "depot")
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	if path = cfg[pathSetting]; path != "" {
+		debugf("database", slog.String("path", path), slog.String("from", "config"))
+		return path, nil
 	}
 
-	err := os.MkdirAll(path, os.ModePerm)
-	if err != nil {
+	if path, err = defaultPath(); err != nil {
 		return path, err
 	}
+	debugf("database", slog.String("path", path), slog.String("from", "default"))
 
-	return filepath.Join(path, "depot.db"), nil
+	return path, nil
 }
 
 // Returns the password from either an environment variable or console input.
-// If secret is false, returns nil. Returns an error if unsuccessful.
-func getPassword(secret bool) ([]byte, error) {
+// If secret is false, returns nil. When hasKey is true, because a keyfile is
+// in use or the depot is unlocked, the console is never consulted, so an unset
+// DEPOT_PASS means the keyfile or unlocked key alone decrypts the depot.
+// Returns an error if unsuccessful.
+func getPassword(secret, hasKey bool) ([]byte, error) {
+	return readPassword(secret, hasKey, false)
+}
+
+// Returns the password to encrypt a value being stowed with as getPassword
+// does, except that one typed at the console is asked for twice, since a typo
+// would leave the value undecryptable for good. Returns an error if
+// unsuccessful, including when the two passwords typed differ.
+func getNewPassword(secret, hasKey bool) ([]byte, error) {
+	return readPassword(secret, hasKey, true)
+}
+
+// Returns the password given with --pass-fd or --pass-file, in DEPOT_PASS,
+// printed by the password command (see commandPassword), or, for a service
+// run by systemd, given in its depot-pass credential, or false if there is
+// none. Returns an error if the password command fails.
+func presetPassword() ([]byte, bool, error) {
+	if givenPassword != nil {
+		debugf("password", slog.String("from", "--pass-fd or --pass-file"))
+		return givenPassword, true, nil
+	}
+	if p := os.Getenv(envPass); p != "" {
+		debugf("password", slog.String("from", envPass))
+		return []byte(p), true, nil
+	}
+	if p, err := commandPassword(); p != nil || err != nil {
+		debugf("password", slog.String("from", "password command"))
+		return p, p != nil, err
+	}
+	p, ok := credentialPassword()
+	if ok {
+		debugf("password", slog.String("from", "systemd credential"))
+	}
+
+	return p, ok, nil
+}
+
+func readPassword(secret, hasKey, confirm bool) ([]byte, error) {
 	if !secret {
 		return nil, nil
 	}
 
-	if p := os.Getenv(envPass); p != "" {
-		return []byte(p), nil
+	if p, ok, err := presetPassword(); err != nil || ok {
+		return p, err
+	}
+	if hasKey {
+		debugf("password", slog.String("from", "keyfile or unlocked depot"))
+		return []byte{}, nil
 	}
 
-	tty, err := os.Create("/dev/tty")
+	// Without a terminal to ask at, the password is simply missing
+	tty, err := openPrompt()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", libdepot.ErrPasswordNeeded, err)
 	}
 	defer tty.Close()
 
 	fmt.Fprint(tty, "PASSWORD: ")
-	password, err := term.ReadPassword(int(tty.Fd()))
+	password, err := tty.ReadPassword()
+	fmt.Fprintln(tty, "")
+	if err != nil || !confirm {
+		return password, err
+	}
+
+	fmt.Fprint(tty, "PASSWORD (again): ")
+	again, err := tty.ReadPassword()
 	fmt.Fprintln(tty, "")
 	if err != nil {
 		return nil, err
 	}
+	if !bytes.Equal(password, again) {
+		return nil, errors.New("passwords do not match, nothing was stowed")
+	}
 
 	return password, nil
 }
 
 // Returns the value read from stdin or an error if unsuccessful
-func getVal(secret bool) (string, error) {
+func getVal(secret bool, limit int) (string, error) {
+	if nonInteractive && term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("value must be piped to stdin: %w", errNonInteractive)
+	}
 	if term.IsTerminal(int(os.Stdin.Fd())) && secret {
 		val, err := term.ReadPassword(int(os.Stdin.Fd()))
 		if err != nil {
@@ -195,8 +773,15 @@ func getVal(secret bool) (string, error) {
 		return strings.TrimSpace(string(val)), nil
 	}
 
-	val, err := bufio.NewReader(os.Stdin).ReadString('\n')
-	if err != nil && !errors.Is(err, io.EOF) {
+	// The line may end in a newline on top of the value
+	lineLimit := limit
+	if limit > 0 {
+		lineLimit++
+	}
+	val, err := bufio.NewReader(limitReader(os.Stdin, lineLimit)).ReadString('\n')
+	if errors.Is(err, libdepot.ErrTooLarge) {
+		return "", fmt.Errorf("%w: more than %d bytes", libdepot.ErrTooLarge, limit)
+	} else if err != nil && !errors.Is(err, io.EOF) {
 		return "", fmt.Errorf("could not read value from stdin")
 	}
 	if strings.TrimSpace(val) == "" {
@@ -205,26 +790,3 @@ func getVal(secret bool) (string, error) {
 
 	return strings.TrimSpace(val), nil
 }
-
-// Returns the help message
-func usage() string {
-	return strings.Join([]string{
-		"Usage: depot [-nsh?] <action> <key>",
-		"",
-		"Actions:",
-		"    stow        Read a value from stdin and associate it with the given key",
-		"    fetch       Print the value associated with the given key to stdout",
-		"    drop        Remove the given key from the depot",
-		"",
-		"Options:",
-		"    -n          No newline character will be printed after fetching a value",
-		"    -s          The provided value is secret and will be encrypted",
-		"    -h, -?      Print this help message and exit",
-		"",
-		"Environment Variables:",
-		"    DEPOT_PATH  Specifies a non-standard path to the depot's database",
-		"                (Defaults to $XDG_CONFIG_HOME/depot/depot.db)",
-		"    DEPOT_PASS  Specifies the password to be used to encrypt/decrypt values",
-		"                (Be careful with this! It is certainly less secure!)",
-	}, "\n")
-}
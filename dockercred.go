@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// The name Docker looks for a credential helper called depot under
+const dockerHelperName = "docker-credential-depot"
+
+// What a Docker credential helper prints to stdout when asked for credentials
+// it doesn't have, which Docker tells apart from other failures by the text
+const dockerNotFound = "credentials not found in native keychain"
+
+// Keys that registry credentials are kept under begin with this
+const dockerPrefix = "docker/"
+
+// The operations of the Docker credential helper protocol
+var dockerOps = []string{"get", "store", "erase", "list"}
+
+// Registry credentials as the Docker credential helper protocol passes them,
+// and as they are stowed
+type dockerCredentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// Speaks the Docker credential helper protocol on stdin and stdout for the
+// operation op (get, store, erase, or list), keeping each registry's
+// credentials encrypted under a key beginning with docker/. Returns an error
+// if unsuccessful.
+func dockerCredential(storage *libdepot.Depot, op string, opts options) error {
+	switch op {
+	case "get":
+		url, err := readServerURL()
+		if err != nil {
+			return err
+		}
+		creds, err := fetchDockerCredentials(storage, dockerKey(url), opts)
+		if errors.Is(err, libdepot.ErrNotFound) {
+			fmt.Println(dockerNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		creds.ServerURL = url
+		return json.NewEncoder(os.Stdout).Encode(creds)
+	case "store":
+		var creds dockerCredentials
+		if err := json.NewDecoder(os.Stdin).Decode(&creds); err != nil {
+			return fmt.Errorf("cannot read credentials: %w", err)
+		}
+		if creds.ServerURL == "" {
+			return errors.New("no server URL given")
+		}
+		val, err := json.Marshal(creds)
+		if err != nil {
+			return err
+		}
+		password, err := getNewPassword(true, opts.hasKey())
+		if err != nil {
+			return err
+		}
+		return storage.Stow(dockerKey(creds.ServerURL), string(val), password)
+	case "erase":
+		url, err := readServerURL()
+		if err != nil {
+			return err
+		}
+		if _, err = storage.Info(dockerKey(url)); errors.Is(err, libdepot.ErrNotFound) {
+			fmt.Println(dockerNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		return storage.Drop(dockerKey(url))
+	case "list":
+		keys, err := storage.List("")
+		if err != nil {
+			return err
+		}
+		users := map[string]string{}
+		for _, k := range keys {
+			if !strings.HasPrefix(k.Key, dockerPrefix) || k.Alias != "" {
+				continue
+			}
+			creds, err := fetchDockerCredentials(storage, k.Key, opts)
+			if err != nil {
+				return fmt.Errorf("%v: %w", k.Key, err)
+			}
+			users[creds.ServerURL] = creds.Username
+		}
+		return json.NewEncoder(os.Stdout).Encode(users)
+	default:
+		return fmt.Errorf("unknown credential helper operation: %v", op)
+	}
+}
+
+// Returns the credentials stowed under key, or an error if unsuccessful
+func fetchDockerCredentials(storage *libdepot.Depot, key string, opts options) (*dockerCredentials, error) {
+	info, err := storage.Info(key)
+	if err != nil {
+		return nil, err
+	}
+	password, err := getPassword(info.Encrypted, opts.hasKey())
+	if err != nil {
+		return nil, err
+	}
+	val, err := storage.Fetch(key, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds dockerCredentials
+	if err = json.Unmarshal([]byte(val), &creds); err != nil {
+		return nil, fmt.Errorf("%v does not hold registry credentials: %w", key, err)
+	}
+
+	return &creds, nil
+}
+
+// Returns the server URL Docker gives on stdin, or an error if there is none
+func readServerURL() (string, error) {
+	url, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	url = strings.TrimSpace(url)
+	if url == "" {
+		return "", errors.New("no server URL given")
+	}
+
+	return url, nil
+}
+
+// Returns the key the credentials for the registry at url are stowed under:
+// its host and path, without the scheme or a trailing slash, after docker/
+func dockerKey(url string) string {
+	if _, rest, ok := strings.Cut(url, "://"); ok {
+		url = rest
+	}
+
+	return dockerPrefix + strings.TrimRight(url, "/")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Checks the depot for damage, decrypting every secret with -s, prints each
+// problem found (as a JSON array with --format json), and repairs what it
+// safely can with --repair. Returns an error if unsuccessful, including when
+// problems remain unrepaired, so scripts can tell a healthy depot apart.
+func doctor(storage *libdepot.Depot, opts options) error {
+	if opts.format != "" && opts.format != libdepot.FormatJSON {
+		return fmt.Errorf("invalid format for doctor: %v", opts.format)
+	}
+
+	password, err := getPassword(opts.secret, opts.hasKey())
+	if err != nil {
+		return err
+	}
+	problems, err := storage.Check(password, opts.repair)
+	if err != nil {
+		return err
+	}
+
+	remaining, repairable := 0, 0
+	for _, p := range problems {
+		if !p.Repaired {
+			remaining++
+		}
+		if p.Repairable && !p.Repaired {
+			repairable++
+		}
+	}
+
+	if opts.format == libdepot.FormatJSON {
+		if problems == nil {
+			problems = []libdepot.Problem{}
+		}
+		if err = printJSON(problems); err != nil {
+			return err
+		}
+	} else {
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+	}
+
+	switch {
+	case remaining == 0 && len(problems) == 0:
+		log.Printf("No problems found\n")
+		return nil
+	case remaining == 0:
+		log.Printf("Repaired %v problems\n", len(problems))
+		return nil
+	case repairable > 0:
+		command := "depot doctor --repair"
+		if opts.secret {
+			command = "depot doctor -s --repair"
+		}
+		return fmt.Errorf("found %v problems, %v of which %v can repair", remaining, repairable, command)
+	default:
+		return fmt.Errorf("found %v problems", remaining)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/adonSh/depot/libdepot"
+	"golang.org/x/term"
+)
+
+// Drops the key, first asking whether to when stdin is a terminal unless
+// --force is given. Unlike Depot.Drop, a key that does not exist is an error,
+// since it is likely a typo. With --pattern, drops every key matching it
+// instead (see dropMatching). Returns an error if unsuccessful.
+func drop(storage *libdepot.Depot, opts options) error {
+	if opts.pattern != "" {
+		return dropMatching(storage, opts)
+	}
+	info, err := storage.Info(opts.key)
+	if err != nil {
+		return err
+	}
+
+	if !opts.force && !nonInteractive && term.IsTerminal(int(os.Stdin.Fd())) {
+		question := fmt.Sprintf("Drop %v?", opts.key)
+		if info.Alias != "" {
+			question = fmt.Sprintf("Drop the alias %v (leaving %v alone)?", opts.key, info.Alias)
+		}
+		ok, err := confirm(question)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			log.Printf("Kept %v\n", opts.key)
+			return nil
+		}
+	}
+
+	return storage.Drop(opts.key)
+}
+
+// Drops every key matching --pattern after listing them and asking whether
+// to, which can only be skipped with --force, so that a pattern that matches
+// more than was meant never drops anything unseen. Returns an error if
+// unsuccessful, including when nothing matches.
+func dropMatching(storage *libdepot.Depot, opts options) error {
+	keys, err := storage.List(opts.pattern)
+	if err != nil {
+		return err
+	} else if len(keys) == 0 {
+		return fmt.Errorf("no keys match %v: %w", opts.pattern, libdepot.ErrNotFound)
+	}
+
+	if !opts.force {
+		for _, k := range keys {
+			fmt.Fprintln(os.Stderr, k.Key)
+		}
+		ok, err := confirm(fmt.Sprintf("Drop these %v keys?", len(keys)))
+		if err != nil {
+			return fmt.Errorf("cannot ask whether to drop them, use --force to drop them anyway: %w", err)
+		}
+		if !ok {
+			log.Printf("Kept %v keys\n", len(keys))
+			return nil
+		}
+	}
+
+	// Drop the keys listed, not whatever matches by now
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = k.Key
+	}
+	dropped, err := storage.DropAll(names)
+	if err != nil {
+		return err
+	}
+	log.Printf("Dropped %v keys\n", len(dropped))
+
+	return nil
+}
+
+// Asks the question on the terminal and reports whether it was answered yes.
+// Returns an error if the terminal cannot be used.
+func confirm(question string) (bool, error) {
+	tty, err := openPrompt()
+	if err != nil {
+		return false, err
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "%v [y/N] ", question)
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes", nil
+}
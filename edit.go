@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Opens the value of the key in the user's editor and stows what is saved,
+// encrypted with the same password if it was encrypted before, which is not
+// judged again. A key that does not exist yet starts out empty and is
+// encrypted if -s is given, with a password judged before the editor opens.
+// Returns an error if unsuccessful.
+func edit(storage *libdepot.Depot, opts options) error {
+	if nonInteractive {
+		return fmt.Errorf("cannot open an editor: %w", errNonInteractive)
+	}
+	var password []byte
+	val, err := storage.Fetch(opts.key, nil)
+	if errors.Is(err, libdepot.ErrPasswordNeeded) {
+		if password, err = getPassword(true, opts.hasKey()); err != nil {
+			return err
+		}
+		val, err = storage.Fetch(opts.key, password)
+	} else if errors.Is(err, libdepot.ErrNotFound) {
+		// Refuse a weak password before any editing is done, not after
+		if password, err = getNewPassword(opts.secret, opts.hasKey()); err == nil {
+			err = storage.CheckPassword(opts.key, password)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	edited, err := editValue(opts.key, val)
+	if err != nil {
+		return err
+	}
+	if edited == "" {
+		return fmt.Errorf("value must be a non-empty string")
+	}
+	if edited == val {
+		log.Printf("No changes to %v\n", opts.key)
+		return nil
+	}
+
+	return storage.Replace(opts.key, edited, password)
+}
+
+// Opens val in the user's editor and returns what it holds after the editor
+// has closed. Returns an error if unsuccessful.
+func editValue(key, val string) (string, error) {
+	cmd, err := startEdit(key, val)
+	if err != nil {
+		return "", err
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	return finishEdit(cmd, cmd.Run())
+}
+
+// Writes val to a file only the user can read, on a filesystem held in memory
+// when there is one, and returns the command that opens it in the user's
+// editor. Once the command has run, finishEdit must be called with it.
+// Returns an error if unsuccessful.
+func startEdit(key, val string) (*exec.Cmd, error) {
+	// Keep the key's extension, so the editor knows what it is editing
+	f, err := os.CreateTemp(editDir(), "depot-*"+filepath.Ext(key))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create file to edit: %w", err)
+	}
+	path := f.Name()
+
+	_, err = f.WriteString(val + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		wipe(path)
+		os.Remove(path)
+		return nil, fmt.Errorf("cannot write file to edit: %w", err)
+	}
+
+	// Run the editor through the shell, as git does, so $EDITOR may hold
+	// arguments of its own
+	editor := editorCommand()
+	return exec.Command("sh", "-c", editor+` "$@"`, editor, path), nil
+}
+
+// Returns what the file opened by cmd, as returned by startEdit, holds after
+// the editor has run and failed with runErr if it is not nil. The file is
+// wiped and removed either way. Returns an error if unsuccessful.
+func finishEdit(cmd *exec.Cmd, runErr error) (string, error) {
+	path := cmd.Args[len(cmd.Args)-1]
+	defer func() {
+		wipe(path)
+		os.Remove(path)
+	}()
+	if runErr != nil {
+		return "", fmt.Errorf("editor failed, nothing was stowed: %w", runErr)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read edited file: %w", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Returns the command that opens the user's editor: $VISUAL, then $EDITOR,
+// then vi
+func editorCommand() string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.TrimSpace(os.Getenv(name)); editor != "" {
+			return editor
+		}
+	}
+
+	return "vi"
+}
+
+// Returns the directory to put a file to edit in, preferring one that is only
+// ever held in memory so the value never reaches the disk
+func editDir() string {
+	for _, dir := range []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"} {
+		if dir == "" {
+			continue
+		}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+
+	return os.TempDir()
+}
+
+// Overwrites the file at path with zeros, as far as the filesystem allows
+func wipe(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	f.Write(make([]byte, info.Size()))
+	f.Sync()
+}
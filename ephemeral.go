@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Hidden action used to start the daemon that holds an ephemeral depot
+const actEphemeralDaemon = "ephemeral-daemon"
+
+// Serves an in-memory backend over RPC to the depot commands of one shell
+// session
+type ephemeralServer struct {
+	backend libdepot.Backend
+}
+
+func (s *ephemeralServer) Get(key string, entry *libdepot.Entry) error {
+	e, err := s.backend.Get(key)
+	if err != nil {
+		return err
+	}
+	*entry = *e
+	return nil
+}
+
+func (s *ephemeralServer) Put(entry libdepot.Entry, _ *struct{}) error {
+	return s.backend.Put(&entry)
+}
+
+func (s *ephemeralServer) Delete(key string, _ *struct{}) error {
+	return s.backend.Delete(key)
+}
+
+func (s *ephemeralServer) List(prefix string, entries *[]*libdepot.Entry) error {
+	var err error
+	*entries, err = s.backend.List(prefix)
+	return err
+}
+
+func (s *ephemeralServer) Meta(name string, data *[]byte) error {
+	var err error
+	*data, err = s.backend.Meta(name)
+	return err
+}
+
+func (s *ephemeralServer) SetMeta(args EphemeralMeta, _ *struct{}) error {
+	return s.backend.SetMeta(args.Name, args.Data)
+}
+
+// Arguments to ephemeralServer.SetMeta, exported as net/rpc requires
+type EphemeralMeta struct {
+	Name string
+	Data []byte
+}
+
+// A libdepot.Backend that forwards every call to the session's daemon
+type ephemeralClient struct {
+	*rpc.Client
+}
+
+// Errors only survive the trip as strings, so the ones callers check for are
+// restored here
+func (c ephemeralClient) call(method string, args, reply any) error {
+	err := c.Call("Ephemeral."+method, args, reply)
+	if err != nil && err.Error() == libdepot.ErrNotFound.Error() {
+		return libdepot.ErrNotFound
+	}
+	return err
+}
+
+func (c ephemeralClient) Get(key string) (*libdepot.Entry, error) {
+	var e libdepot.Entry
+	if err := c.call("Get", key, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (c ephemeralClient) Put(e *libdepot.Entry) error {
+	return c.call("Put", *e, &struct{}{})
+}
+
+func (c ephemeralClient) Delete(key string) error {
+	return c.call("Delete", key, &struct{}{})
+}
+
+func (c ephemeralClient) List(prefix string) ([]*libdepot.Entry, error) {
+	var entries []*libdepot.Entry
+	err := c.call("List", prefix, &entries)
+	return entries, err
+}
+
+func (c ephemeralClient) Meta(name string) ([]byte, error) {
+	var data []byte
+	err := c.call("Meta", name, &data)
+	return data, err
+}
+
+func (c ephemeralClient) SetMeta(name string, data []byte) error {
+	return c.call("SetMeta", EphemeralMeta{name, data}, &struct{}{})
+}
+
+// Returns the path of the socket belonging to the current shell session's
+// ephemeral depot or an error if unsuccessful. The socket is kept in the
+// user's runtime directory if they have one, and otherwise in a directory of
+// the user's own in the temporary directory, which is refused unless only
+// they can reach it, since whoever made it could stand in for the daemon and
+// be handed the keys of depots being unlocked.
+func ephemeralSocket(session int) (string, error) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("depot-%d", os.Getuid()))
+	if runtime := os.Getenv("XDG_RUNTIME_DIR"); runtime != "" {
+		dir = filepath.Join(runtime, "depot")
+	}
+	if err := os.Mkdir(dir, 0700); err != nil && !errors.Is(err, fs.ErrExist) {
+		return "", err
+	}
+	if err := checkPrivateDir(dir); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, fmt.Sprintf("ephemeral-%d.sock", session)), nil
+}
+
+// Returns a backend connected to the current shell session's ephemeral depot,
+// starting its daemon if it isn't running yet, or an error if unsuccessful
+func dialEphemeral() (libdepot.Backend, error) {
+	client, err := dialSession(true)
+	if err != nil {
+		return nil, err
+	}
+
+	return ephemeralClient{client}, nil
+}
+
+// Returns a client connected to the current shell session's daemon, starting
+// it first if start is true and it isn't running yet, or an error if
+// unsuccessful
+func dialSession(start bool) (*rpc.Client, error) {
+	session, err := shellSession()
+	if err != nil {
+		return nil, err
+	}
+	sock, err := ephemeralSocket(session)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := rpc.Dial("unix", sock)
+	if err == nil || !start {
+		return client, err
+	}
+
+	if err = startEphemeralDaemon(session); err != nil {
+		return nil, fmt.Errorf("cannot start ephemeral depot: %w", err)
+	}
+	for i := 0; i < 50; i++ {
+		time.Sleep(20 * time.Millisecond)
+		if client, err = rpc.Dial("unix", sock); err == nil {
+			return client, nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot connect to ephemeral depot: %w", err)
+}
+
+// Holds an in-memory depot, and the keys of depots unlocked, for the given
+// shell session until the session ends. Returns an error if unsuccessful.
+func serveEphemeral(session int) error {
+	sock, err := ephemeralSocket(session)
+	if err != nil {
+		return err
+	}
+
+	// A socket left behind by a daemon that died would block the listener
+	if _, err = rpc.Dial("unix", sock); err == nil {
+		return errors.New("ephemeral depot is already running")
+	}
+	os.Remove(sock)
+
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(sock)
+
+	server := rpc.NewServer()
+	if err = server.RegisterName("Ephemeral", &ephemeralServer{libdepot.NewMemBackend()}); err != nil {
+		return err
+	}
+	if err = server.RegisterName("Agent", &agentServer{keys: map[string][]byte{}}); err != nil {
+		return err
+	}
+	go server.Accept(listener)
+
+	for sessionAlive(session) {
+		time.Sleep(2 * time.Second)
+	}
+
+	return listener.Close()
+}
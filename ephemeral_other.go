@@ -0,0 +1,36 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var errNoSessions = errors.New("ephemeral depots are not supported on this platform")
+
+func shellSession() (int, error) {
+	return 0, errNoSessions
+}
+
+func sessionAlive(session int) bool {
+	return false
+}
+
+func startEphemeralDaemon(session int) error {
+	return errNoSessions
+}
+
+func checkPrivateDir(dir string) error {
+	return errNoSessions
+}
+
+// Starts cmd in the background, where it outlives the current process.
+// Returns an error if unsuccessful.
+func startDetached(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	return cmd.Process.Release()
+}
@@ -0,0 +1,62 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Returns the ID of the session the current process belongs to, which is
+// shared by everything started from the same shell
+func shellSession() (int, error) {
+	return unix.Getsid(0)
+}
+
+// Reports whether the leader of the given session is still running
+func sessionAlive(session int) bool {
+	return unix.Kill(session, 0) == nil
+}
+
+// Starts the ephemeral depot daemon for the given session in the background.
+// Returns an error if unsuccessful.
+func startEphemeralDaemon(session int) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	return startDetached(exec.Command(exe, actEphemeralDaemon, strconv.Itoa(session)))
+}
+
+// Starts cmd in the background, detached from the terminal so it isn't caught
+// by its signals and outlives the current process. Returns an error if
+// unsuccessful.
+func startDetached(cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	return cmd.Process.Release()
+}
+
+// Returns an error unless dir is a directory, not a link to one, that belongs
+// to the current user and that no one else may enter
+func checkPrivateDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !info.IsDir() || !ok || int(st.Uid) != os.Getuid() || info.Mode().Perm() != 0700 {
+		return fmt.Errorf("%v must be a directory of your own with mode 0700", dir)
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckPrivateDir(t *testing.T) {
+	root := t.TempDir()
+	private := filepath.Join(root, "private")
+	if err := os.Mkdir(private, 0700); err != nil {
+		t.Fatalf("error making directory: %v", err)
+	}
+	if err := checkPrivateDir(private); err != nil {
+		t.Errorf("expected a private directory to be accepted but got %v", err)
+	}
+
+	open := filepath.Join(root, "open")
+	os.Mkdir(open, 0700)
+	os.Chmod(open, 0777)
+	link := filepath.Join(root, "link")
+	os.Symlink(private, link)
+	file := filepath.Join(root, "file")
+	os.WriteFile(file, nil, 0700)
+	for _, dir := range []string{open, link, file, filepath.Join(root, "missing")} {
+		if err := checkPrivateDir(dir); err == nil {
+			t.Errorf("expected %v to be refused", dir)
+		}
+	}
+}
+
+func TestEphemeralSocket(t *testing.T) {
+	runtime := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtime)
+
+	sock, err := ephemeralSocket(1)
+	if err != nil || filepath.Dir(sock) != filepath.Join(runtime, "depot") {
+		t.Errorf("expected a socket in the runtime directory but got %v (%v)", sock, err)
+	}
+
+	os.Chmod(filepath.Dir(sock), 0755)
+	if _, err = ephemeralSocket(1); err == nil {
+		t.Errorf("expected a directory others may enter to be refused")
+	}
+}
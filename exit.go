@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Exit codes, so scripts can tell failures apart without parsing messages
+const (
+	exitError          = 1
+	exitNotFound       = 2
+	exitBadPassword    = 3
+	exitPasswordNeeded = 4
+	exitDatabase       = 5
+	exitNonInteractive = 6
+	exitUsage          = 64 // EX_USAGE from sysexits.h
+)
+
+// Returns the exit code for the class of the given error
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, libdepot.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, libdepot.ErrBadPassword):
+		return exitBadPassword
+	case errors.Is(err, libdepot.ErrPasswordNeeded):
+		return exitPasswordNeeded
+	case errors.Is(err, libdepot.ErrDatabase):
+		return exitDatabase
+	case errors.Is(err, errNonInteractive):
+		return exitNonInteractive
+	default:
+		return exitError
+	}
+}
+
+// Called before exiting on an error, to close the depot once it is open so
+// that nothing is left behind in its write-ahead log
+var cleanup = func() {}
+
+// The code depot is about to exit with, once fatal or fatalUsage is called,
+// for the error logged to carry
+var exiting int
+
+// Logs the error and exits with the code for its class
+func fatal(err error) {
+	exiting = exitCode(err)
+	log.Printf("Error: %v\n", err)
+	cleanup()
+	os.Exit(exiting)
+}
+
+// Logs a complaint about the command line and exits with exitUsage
+func fatalUsage(format string, v ...any) {
+	exiting = exitUsage
+	log.Printf("Invalid args: "+format, v...)
+	cleanup()
+	os.Exit(exitUsage)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Writes the keys matching the pattern given as the key to stdout, as an
+// encrypted archive, as plain values with --format, or as a KeePass database
+// with --format kdbx. Returns an error if unsuccessful.
+func export(storage *libdepot.Depot, opts options) error {
+	if opts.format == libdepot.FormatKeePass {
+		return exportKeePass(storage, opts)
+	}
+	if opts.format == "" {
+		password, err := getPassword(true, false)
+		if err != nil {
+			return err
+		}
+
+		n, err := storage.Export(os.Stdout, opts.key, password)
+		if err != nil {
+			return err
+		}
+		log.Printf("Exported %v keys\n", n)
+		return nil
+	}
+
+	var password []byte
+	if opts.decrypt {
+		var err error
+		if password, err = getPassword(true, opts.hasKey()); err != nil {
+			return err
+		}
+	}
+
+	dump, err := storage.Dump(opts.key, password)
+	if err != nil {
+		return err
+	}
+	data, err := dump.Marshal(opts.format)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stdout.Write(data); err != nil {
+		return err
+	}
+
+	secrets := 0
+	for _, e := range dump.Entries {
+		if e.Secret {
+			secrets++
+		}
+	}
+	if secrets > 0 {
+		log.Printf("Warning: %v secret values were exported in plaintext\n", secrets)
+	}
+	if len(dump.Withheld) > 0 {
+		log.Printf("Left out %v secret values, use --decrypt to include them\n", len(dump.Withheld))
+	}
+	log.Printf("Exported %v keys\n", len(dump.Entries))
+
+	return nil
+}
+
+// The password managers import can read with --from, each given the path
+// passed to import, if any, to a store or export file
+var importSources = map[string]func(path string) (*libdepot.DepotDump, error){
+	"pass":      passDump,
+	"keepass":   keepassDump,
+	"bitwarden": exportSource(libdepot.ParseBitwarden),
+	"1password": exportSource(libdepot.ParseOnePassword),
+}
+
+// Stores the keys read from stdin, either an encrypted archive or, with
+// --format, plain values, or those read from another password manager with
+// --from. Returns an error if unsuccessful.
+func importValues(storage *libdepot.Depot, opts options) error {
+	if opts.format == "" && opts.from == "" {
+		password, err := getPassword(true, false)
+		if err != nil {
+			return err
+		}
+
+		n, err := storage.Import(os.Stdin, password)
+		if err != nil {
+			return err
+		}
+		log.Printf("Imported %v keys\n", n)
+		return nil
+	}
+
+	dump := &libdepot.DepotDump{}
+	var err error
+	if opts.from != "" {
+		if dump, err = importSources[opts.from](opts.key); err != nil {
+			return err
+		}
+	} else {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		if err = dump.Unmarshal(data, opts.format); err != nil {
+			return err
+		}
+	}
+
+	var password []byte
+	for _, e := range dump.Entries {
+		if e.Secret {
+			if password, err = getPassword(true, opts.hasKey()); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	n, err := storage.Load(dump, password)
+	if err != nil {
+		return err
+	}
+	log.Printf("Imported %v keys\n", n)
+
+	return nil
+}
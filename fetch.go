@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Prints the values of several keys as shell variable assignments, named
+// for the keys (see envName)
+const formatEnv = "env"
+
+// A value as fetch prints it with --format json, along with what can be told
+// about its key
+type fetchedValue struct {
+	Value     string    `json:"value"`
+	Modified  time.Time `json:"modified"`
+	Encrypted bool      `json:"encrypted"`
+}
+
+// Prints the value of the key, or of every key given, or only the --field of
+// each record, each on a line of its own or all together with --format json
+// or env, or copies it to the clipboard, or shows it as a QR code. The
+// password is asked for at most once. Returns an error if unsuccessful.
+func fetch(storage *libdepot.Depot, opts options) error {
+	if opts.key == "" && !opts.pick {
+		return errors.New("fetch requires <key>, or --pick")
+	}
+	keys := append([]string{opts.key}, opts.extraKeys...)
+	if opts.pick {
+		if len(keys) > 1 {
+			return errors.New("--pick picks one key at a time")
+		}
+		key, err := pickKey(storage, opts.key)
+		if err != nil {
+			return err
+		}
+		keys[0] = key
+	}
+	if opts.clip && len(keys) > 1 {
+		return errors.New("only one value can be copied to the clipboard")
+	}
+	if opts.qr && (len(keys) > 1 || opts.clip || opts.format != "") {
+		return errors.New("--qr shows one value at a time, on its own")
+	}
+	if opts.format != "" && opts.format != libdepot.FormatJSON && opts.format != formatEnv {
+		return fmt.Errorf("invalid format for fetch: %v", opts.format)
+	}
+
+	f := fetcher{storage: storage, hasKey: opts.hasKey(), field: opts.field}
+	vals, err := f.fetchAll(keys)
+	if err != nil {
+		return err
+	}
+
+	switch opts.format {
+	case libdepot.FormatJSON:
+		byKey := make(map[string]fetchedValue, len(keys))
+		for i, key := range keys {
+			info, err := storage.Info(key)
+			if err != nil {
+				return err
+			}
+			byKey[key] = fetchedValue{vals[i], info.Modified, info.Encrypted}
+		}
+		return printJSON(byKey)
+	case formatEnv:
+		for i, key := range keys {
+			fmt.Printf("%v=%v\n", envName(key), shellQuote(vals[i]))
+		}
+		return nil
+	}
+
+	if opts.clip {
+		return clip(keys[0], vals[0])
+	} else if opts.qr {
+		return showQR(vals[0], opts.out)
+	}
+	for _, val := range vals {
+		if !opts.noNewline {
+			fmt.Println(val)
+		} else {
+			fmt.Print(val)
+		}
+	}
+
+	return nil
+}
+
+// Fetches values one after another, or the same field of records, asking for
+// the password the first time an encrypted one needs it and using it for the
+// rest
+type fetcher struct {
+	storage  *libdepot.Depot
+	hasKey   bool
+	field    string
+	password []byte
+}
+
+// Returns the value of the key, or its field, or an error if unsuccessful
+func (f *fetcher) fetch(key string) (string, error) {
+	get := f.storage.Fetch
+	if f.field != "" {
+		get = func(key string, password []byte) (string, error) {
+			return f.storage.FetchField(key, f.field, password)
+		}
+	}
+
+	val, err := get(key, f.password)
+	if errors.Is(err, libdepot.ErrPasswordNeeded) && f.password == nil {
+		if f.password, err = getPassword(true, f.hasKey); err != nil {
+			return "", err
+		}
+		val, err = get(key, f.password)
+	}
+
+	return val, err
+}
+
+// Returns the values of the keys, in the same order, asking for the password
+// only once however many of them are encrypted. Returns an error if
+// unsuccessful.
+func fetchValues(storage *libdepot.Depot, keys []string, hasKey bool) ([]string, error) {
+	f := fetcher{storage: storage, hasKey: hasKey}
+	return f.fetchAll(keys)
+}
+
+// Returns the values of the keys as fetchValues does
+func (f *fetcher) fetchAll(keys []string) ([]string, error) {
+	vals := make([]string, len(keys))
+	for i, key := range keys {
+		val, err := f.fetch(key)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+
+	return vals, nil
+}
+
+// Returns the name of the environment variable for key, in upper case with
+// anything but letters and digits replaced by underscores, as in DB_PASSWORD
+// for db/password
+func envName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, key)
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// Returns s quoted for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Generates a random password, or a passphrase with --words, stows it
+// encrypted under the key, and prints it or copies it to the clipboard. A key
+// that already exists is only replaced with --force, since its value would be
+// lost. Returns an error if unsuccessful.
+func generate(storage *libdepot.Depot, opts options) error {
+	if !opts.force {
+		_, err := storage.Fetch(opts.key, nil)
+		if err == nil || errors.Is(err, libdepot.ErrPasswordNeeded) {
+			return fmt.Errorf("%v already exists, use --force to replace it", opts.key)
+		} else if !errors.Is(err, libdepot.ErrNotFound) {
+			return err
+		}
+	}
+
+	length := libdepot.DefaultPasswordLength
+	if opts.words {
+		length = libdepot.DefaultPassphraseWords
+	}
+	if opts.length != "" {
+		n, err := strconv.Atoi(opts.length)
+		if err != nil {
+			return fmt.Errorf("invalid length: %v", opts.length)
+		}
+		length = n
+	}
+
+	var val string
+	var err error
+	if opts.words {
+		val, err = libdepot.GeneratePassphrase(length)
+	} else {
+		val, err = libdepot.GeneratePassword(length, opts.symbols)
+	}
+	if err != nil {
+		return err
+	}
+
+	password, err := getNewPassword(true, opts.hasKey())
+	if err != nil {
+		return err
+	}
+	if err = storage.Stow(opts.key, val, password); err != nil {
+		return err
+	}
+
+	if opts.clip {
+		return clip(opts.key, val)
+	} else if !opts.noNewline {
+		fmt.Println(val)
+	} else {
+		fmt.Print(val)
+	}
+
+	return nil
+}
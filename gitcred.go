@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// The name git looks for a credential helper called depot under
+const gitHelperName = "git-credential-depot"
+
+// Keys that git credentials are kept under begin with this
+const gitPrefix = "git/"
+
+// The credentials stowed for a remote
+type gitCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Speaks git's credential helper protocol on stdin and stdout for the
+// operation op (get, store, or erase), keeping the credentials for each remote
+// encrypted under a key beginning with git/. Operations it doesn't know are
+// ignored, as the protocol asks. Since git runs helpers in the middle of
+// other work, and carries on with its own prompt when a helper has nothing,
+// credentials that cannot be decrypted for want of a password are treated as
+// missing rather than failing the git command. Returns an error if
+// unsuccessful.
+func gitCredential(storage *libdepot.Depot, op string, opts options) error {
+	if op != "get" && op != "store" && op != "erase" {
+		return nil
+	}
+	attrs, err := readGitAttributes(os.Stdin)
+	if err != nil {
+		return err
+	}
+	key, err := gitKey(attrs)
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case "get":
+		creds, err := fetchGitCredentials(storage, key, opts)
+		if errors.Is(err, libdepot.ErrNotFound) {
+			return nil
+		} else if errors.Is(err, libdepot.ErrPasswordNeeded) {
+			log.Printf("Warning: cannot use the credentials in %v: %v\n", key, err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if attrs["username"] != "" && attrs["username"] != creds.Username {
+			return nil
+		}
+		fmt.Printf("username=%v\npassword=%v\n", creds.Username, creds.Password)
+	case "store":
+		if attrs["username"] == "" || attrs["password"] == "" {
+			return nil
+		}
+		val, err := json.Marshal(gitCredentials{attrs["username"], attrs["password"]})
+		if err != nil {
+			return err
+		}
+		password, err := getPassword(true, opts.hasKey())
+		if errors.Is(err, libdepot.ErrPasswordNeeded) {
+			log.Printf("Warning: cannot store the credentials in %v: %v\n", key, err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		// git stores credentials after every use, including those it just
+		// got from here
+		if old, err := storage.Fetch(key, password); err == nil && old == string(val) {
+			return nil
+		}
+		return storage.Stow(key, string(val), password)
+	case "erase":
+		if attrs["username"] != "" {
+			// Only the credentials for that user are to go, so check
+			// whose they are
+			creds, err := fetchGitCredentials(storage, key, opts)
+			if errors.Is(err, libdepot.ErrNotFound) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if creds.Username != attrs["username"] {
+				return nil
+			}
+		}
+		return storage.Drop(key)
+	}
+
+	return nil
+}
+
+// Returns the credentials stowed under key, or an error if unsuccessful
+func fetchGitCredentials(storage *libdepot.Depot, key string, opts options) (*gitCredentials, error) {
+	info, err := storage.Info(key)
+	if err != nil {
+		return nil, err
+	}
+	password, err := getPassword(info.Encrypted, opts.hasKey())
+	if err != nil {
+		return nil, err
+	}
+	val, err := storage.Fetch(key, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds gitCredentials
+	if err = json.Unmarshal([]byte(val), &creds); err != nil {
+		return nil, fmt.Errorf("%v does not hold git credentials: %w", key, err)
+	}
+
+	return &creds, nil
+}
+
+// Returns the attributes git gives one per line as name=value, up to a blank
+// line or the end of r, or an error if unsuccessful
+func readGitAttributes(r io.Reader) (map[string]string, error) {
+	attrs := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		name, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid credential attribute: %q", line)
+		}
+		attrs[name] = val
+	}
+
+	return attrs, scanner.Err()
+}
+
+// Returns the key the credentials for the remote described by attrs are
+// stowed under: git/, then its protocol, host, and path if git passes one
+// (see credential.useHttpPath in gitcredentials(7)), or an error if attrs
+// don't say which remote
+func gitKey(attrs map[string]string) (string, error) {
+	if attrs["protocol"] == "" || attrs["host"] == "" {
+		return "", errors.New("git did not give the protocol and host of the remote")
+	}
+
+	key := gitPrefix + attrs["protocol"] + "/" + attrs["host"]
+	if path := strings.Trim(attrs["path"], "/"); path != "" {
+		key += "/" + path
+	}
+
+	return key, nil
+}
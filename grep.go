@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Prints the keys whose values match the regular expression. Encrypted values
+// are only searched with -s, decrypted with the password, and those the
+// password doesn't open are skipped. Returns an error if unsuccessful.
+func grep(storage *libdepot.Depot, opts options) error {
+	re, err := regexp.Compile(opts.key)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	keys, err := storage.List("")
+	if err != nil {
+		return err
+	}
+	password, err := getPassword(opts.secret, opts.hasKey())
+	if err != nil {
+		return err
+	}
+
+	skipped := 0
+	for _, k := range keys {
+		if k.Encrypted && password == nil {
+			skipped++
+			continue
+		}
+		val, err := storage.Fetch(k.Key, password)
+		if errors.Is(err, libdepot.ErrBadPassword) {
+			skipped++
+			continue
+		} else if err != nil {
+			return err
+		}
+		if re.MatchString(val) {
+			fmt.Println(k.Key)
+		}
+	}
+
+	if skipped > 0 && password == nil {
+		log.Printf("Skipped %v encrypted value(s), use -s to search them too\n", skipped)
+	} else if skipped > 0 {
+		log.Printf("Skipped %v encrypted value(s) the password doesn't open\n", skipped)
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Returns an import source that parses the export of a password manager read
+// from the given path, or from stdin if there is none
+func exportSource(parse func(data []byte) (*libdepot.DepotDump, error)) func(string) (*libdepot.DepotDump, error) {
+	return func(path string) (*libdepot.DepotDump, error) {
+		data, err := readExport(path)
+		if err != nil {
+			return nil, err
+		}
+		return parse(data)
+	}
+}
+
+// Returns the contents of the file at path, or of stdin if path is empty, or
+// an error if unsuccessful
+func readExport(path string) ([]byte, error) {
+	if path == "" {
+		return io.ReadAll(os.Stdin)
+	}
+
+	return os.ReadFile(path)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Returns the passwords in the pass store at dir, or at PASSWORD_STORE_DIR or
+// ~/.password-store if dir is empty, decrypted with gpg and keyed by their
+// paths within the store, or an error if unsuccessful. Each value is the whole
+// of its file, as pass show prints it, and is marked secret.
+func passDump(dir string) (*libdepot.DepotDump, error) {
+	if dir == "" {
+		dir = os.Getenv("PASSWORD_STORE_DIR")
+	}
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(home, ".password-store")
+	}
+
+	dump := &libdepot.DepotDump{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Leave out .git, .gpg-id, and the like
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".gpg") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(strings.TrimSuffix(rel, ".gpg"))
+		val, err := gpgDecrypt(path)
+		if err != nil {
+			return fmt.Errorf("%v: %w", key, err)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		dump.Entries = append(dump.Entries, libdepot.DumpEntry{
+			Key:      key,
+			Value:    val,
+			Secret:   true,
+			Modified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(dump.Entries) == 0 {
+		return nil, fmt.Errorf("no passwords found in %v", dir)
+	}
+
+	return dump, nil
+}
+
+// Returns the contents of the gpg-encrypted file at path, less a final
+// newline, or an error if unsuccessful. gpg asks for the passphrase through
+// its agent as pass would.
+func gpgDecrypt(path string) (string, error) {
+	cmd := exec.Command("gpg", "--decrypt", "--quiet", "--yes", "--batch", "--use-agent", path)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return "", errors.New("gpg could not decrypt it")
+	} else if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Prints what can be told about the key without its value, which needs no
+// password, as a JSON object with --format json. Returns an error if
+// unsuccessful.
+func printInfo(storage *libdepot.Depot, opts options) error {
+	if opts.format != "" && opts.format != libdepot.FormatJSON {
+		return fmt.Errorf("invalid format for info: %v", opts.format)
+	}
+	info, err := storage.Info(opts.key)
+	if err != nil {
+		return err
+	}
+
+	if opts.format == libdepot.FormatJSON {
+		return printJSON(info)
+	}
+
+	encrypted, compression := "no", "none"
+	if info.Encrypted {
+		encrypted = "yes"
+	}
+	if info.Compression != libdepot.CompressionNone {
+		compression = info.Compression
+	}
+	age := time.Since(info.Modified).Truncate(time.Second)
+
+	fmt.Printf("key:          %v\n", info.Key)
+	if info.Alias != "" {
+		fmt.Printf("alias of:     %v\n", info.Alias)
+	}
+	fmt.Printf("modified:     %v (%v ago)\n", info.Modified.Local().Format(time.DateTime), age)
+	fmt.Printf("encrypted:    %v\n", encrypted)
+	fmt.Printf("compression:  %v\n", compression)
+	fmt.Printf("stored size:  %v\n", formatSize(int64(info.Size)))
+	if note := rotationNote(info); note != "" {
+		fmt.Printf("rotation:     %v\n", note)
+	}
+
+	return nil
+}
+
+// Prints v as indented JSON. Returns an error if unsuccessful.
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+// Set to run depot non-interactively, as --non-interactive does
+const envNonInteractive = "DEPOT_NON_INTERACTIVE"
+
+// Set by most CI services, which never have anyone to answer a prompt
+const envCI = "CI"
+
+// Something had to be asked, but depot is running non-interactively
+var errNonInteractive = errors.New("input is needed, but depot is running non-interactively")
+
+// Whether depot must never ask anything (see setNonInteractive)
+var nonInteractive bool
+
+// Makes depot fail at once with errNonInteractive, rather than wait for an
+// answer, wherever it would ask something, when --non-interactive is given
+// or DEPOT_NON_INTERACTIVE or CI is set to anything true
+func setNonInteractive(opts options) {
+	from := "--non-interactive"
+	nonInteractive = opts.nonInteractive
+	for _, name := range []string{envNonInteractive, envCI} {
+		if !nonInteractive && envTrue(name) {
+			nonInteractive, from = true, name
+		}
+	}
+	if nonInteractive {
+		debugf("non-interactive", slog.String("from", from))
+	}
+}
+
+// Reports whether the environment variable called name is set to a true
+// value, such as 1 or true, or to anything that isn't a boolean at all
+func envTrue(name string) bool {
+	val := os.Getenv(name)
+	if val == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(val)
+
+	return err != nil || b
+}
+
+// Returns the terminal to ask the user something at, or errNonInteractive if
+// depot is running non-interactively or there is no terminal to ask at
+func openPrompt() (*tty, error) {
+	if nonInteractive {
+		return nil, errNonInteractive
+	}
+	t, err := openTTY()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errNonInteractive, err)
+	}
+
+	return t, nil
+}
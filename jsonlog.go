@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// Writes each message logged as a JSON object on a line of its own, so that
+// a script reading stderr with --format json can tell errors from warnings
+// and other messages, and an error that depot exits with by the exit code
+// it exits with
+type jsonLog struct {
+	w io.Writer
+}
+
+// The prefixes of logged messages, and the level each stands for
+var logLevels = []struct{ prefix, level string }{
+	{"Error: ", "error"},
+	{"Invalid args: ", "error"},
+	{"Warning: ", "warning"},
+}
+
+func (l jsonLog) Write(p []byte) (int, error) {
+	msg := struct {
+		Level   string `json:"level"`
+		Message string `json:"message"`
+		Code    int    `json:"code,omitempty"`
+	}{"info", strings.TrimSpace(string(p)), 0}
+	for _, ll := range logLevels {
+		if rest, ok := strings.CutPrefix(msg.Message, ll.prefix); ok {
+			msg.Level, msg.Message = ll.level, rest
+			break
+		}
+	}
+	if msg.Level == "error" {
+		msg.Code = exiting
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = l.w.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
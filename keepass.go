@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Returns the entries of the KeePass database at path, or read from stdin if
+// path is empty, after asking at the terminal for its master password, or an
+// error if unsuccessful
+func keepassDump(path string) (*libdepot.DepotDump, error) {
+	data, err := readExport(path)
+	if err != nil {
+		return nil, err
+	}
+	password, err := keepassPassword(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return libdepot.ParseKeePass(data, password)
+}
+
+// Writes the keys matching the pattern given as the key to stdout as a
+// KeePass database, decrypting them with the depot's password and locking the
+// database with a master password of its own. Returns an error if
+// unsuccessful.
+func exportKeePass(storage *libdepot.Depot, opts options) error {
+	password, err := getPassword(true, opts.hasKey())
+	if err != nil {
+		return err
+	}
+	dump, err := storage.Dump(opts.key, password)
+	if err != nil {
+		return err
+	}
+
+	master, err := keepassPassword(true)
+	if err != nil {
+		return err
+	}
+	data, err := dump.MarshalKeePass(master)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stdout.Write(data); err != nil {
+		return err
+	}
+	log.Printf("Exported %v keys\n", len(dump.Entries))
+
+	return nil
+}
+
+// Returns the master password of a KeePass database, typed at the terminal,
+// twice if confirm is true since a typo would lock a new database for good,
+// or an error if unsuccessful
+func keepassPassword(confirm bool) ([]byte, error) {
+	tty, err := openPrompt()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", libdepot.ErrPasswordNeeded, err)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, "KEEPASS PASSWORD: ")
+	password, err := tty.ReadPassword()
+	fmt.Fprintln(tty, "")
+	if err != nil || !confirm {
+		return password, err
+	}
+
+	fmt.Fprint(tty, "KEEPASS PASSWORD (again): ")
+	again, err := tty.ReadPassword()
+	fmt.Fprintln(tty, "")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(password, again) {
+		return nil, errors.New("passwords do not match, nothing was exported")
+	}
+
+	return password, nil
+}
@@ -0,0 +1,426 @@
+package libdepot
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// What a user of a depot server may do with a key
+type Permission int
+
+const (
+	// Fetch the key's value
+	PermRead Permission = 1 << iota
+
+	// Stow and drop the key's value
+	PermWrite
+)
+
+// The name of the user who presents the server's own token, and may do
+// anything
+const OwnerName = "owner"
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("access denied")
+)
+
+// Grants a user permissions on every key that begins with Prefix
+type Rule struct {
+	Prefix string     `json:"prefix"`
+	Perm   Permission `json:"perm"`
+}
+
+// A user of a depot server, who authenticates with a token of their own.
+// Admins may do anything, and other users only what their rules allow.
+type User struct {
+	Name  string `json:"name"`
+	Admin bool   `json:"admin,omitempty"`
+	Rules []Rule `json:"rules,omitempty"`
+
+	// The SHA-256 digest of the user's token. Tokens are random, so a
+	// digest is as good as a slow hash and cheap to check on every request.
+	TokenHash []byte `json:"token_hash"`
+}
+
+// Returns the permission described by s, which holds r for PermRead and w
+// for PermWrite, or an error if it is invalid
+func ParsePermission(s string) (Permission, error) {
+	var perm Permission
+	for _, c := range s {
+		switch c {
+		case 'r':
+			perm |= PermRead
+		case 'w':
+			perm |= PermWrite
+		default:
+			return 0, fmt.Errorf("invalid permission: %q", s)
+		}
+	}
+	if perm == 0 {
+		return 0, fmt.Errorf("invalid permission: %q", s)
+	}
+
+	return perm, nil
+}
+
+func (p Permission) String() string {
+	s := ""
+	if p&PermRead != 0 {
+		s += "r"
+	}
+	if p&PermWrite != 0 {
+		s += "w"
+	}
+
+	return s
+}
+
+// Reports whether the user has every permission in perm on key
+func (u *User) Can(key string, perm Permission) bool {
+	if u.Admin {
+		return true
+	}
+
+	var granted Permission
+	for _, r := range u.Rules {
+		if strings.HasPrefix(key, r.Prefix) {
+			granted |= r.Perm
+		}
+	}
+
+	return granted&perm == perm
+}
+
+// Returns the users of the depot, who may use it when it is served, or an
+// error if unsuccessful
+func (db *Depot) Users() ([]User, error) {
+	data, err := db.backend.Meta("users")
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	var users []User
+	if err = json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("cannot read users: %w", ErrCorrupted)
+	}
+
+	return users, nil
+}
+
+// Replaces the users of the depot. Returns an error if unsuccessful.
+func (db *Depot) setUsers(users []User) error {
+	data, err := json.Marshal(users)
+	if err != nil {
+		return err
+	}
+	if err = db.backend.SetMeta("users", data); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return nil
+}
+
+// Calls update with the users of the depot and saves the users it returns,
+// keeping other processes from changing them in between (see Locker).
+// Returns an error if unsuccessful, including the one update returns.
+func (db *Depot) updateUsers(update func(users []User) ([]User, error)) error {
+	return db.locked(func() error {
+		users, err := db.Users()
+		if err != nil {
+			return err
+		}
+		if users, err = update(users); err != nil {
+			return err
+		}
+
+		return db.setUsers(users)
+	})
+}
+
+// Calls change with the user called name and saves the result. Returns an
+// error if unsuccessful, including when there is no such user.
+func (db *Depot) changeUser(name string, change func(u *User)) error {
+	return db.updateUsers(func(users []User) ([]User, error) {
+		for i := range users {
+			if users[i].Name == name {
+				change(&users[i])
+				return users, nil
+			}
+		}
+
+		return nil, fmt.Errorf("no user named %v", name)
+	})
+}
+
+// Adds a user to the depot with no permissions unless admin is true.
+// Returns the token the user authenticates with, which is not kept and
+// cannot be retrieved later, or an error if unsuccessful.
+func (db *Depot) AddUser(name string, admin bool) (string, error) {
+	if name == "" || name == OwnerName {
+		return "", fmt.Errorf("invalid user name: %q", name)
+	}
+
+	token := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, token); err != nil {
+		return "", fmt.Errorf("cannot generate token: %w", err)
+	}
+	encoded := hex.EncodeToString(token)
+	hash := sha256.Sum256([]byte(encoded))
+
+	err := db.updateUsers(func(users []User) ([]User, error) {
+		for _, u := range users {
+			if u.Name == name {
+				return nil, fmt.Errorf("user %v already exists", name)
+			}
+		}
+
+		return append(users, User{Name: name, Admin: admin, TokenHash: hash[:]}), nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return encoded, nil
+}
+
+// Removes the user called name from the depot. Returns an error if
+// unsuccessful.
+func (db *Depot) RemoveUser(name string) error {
+	return db.updateUsers(func(users []User) ([]User, error) {
+		for i, u := range users {
+			if u.Name == name {
+				return append(users[:i], users[i+1:]...), nil
+			}
+		}
+
+		return nil, fmt.Errorf("no user named %v", name)
+	})
+}
+
+// Grants the user called name perm on every key beginning with prefix, in
+// place of what they were granted on prefix before. Returns an error if
+// unsuccessful.
+func (db *Depot) Grant(name, prefix string, perm Permission) error {
+	return db.changeUser(name, func(u *User) {
+		for i := range u.Rules {
+			if u.Rules[i].Prefix == prefix {
+				u.Rules[i].Perm = perm
+				return
+			}
+		}
+		u.Rules = append(u.Rules, Rule{prefix, perm})
+	})
+}
+
+// Takes away what the user called name was granted on prefix. Returns an
+// error if unsuccessful.
+func (db *Depot) Revoke(name, prefix string) error {
+	return db.changeUser(name, func(u *User) {
+		for i := range u.Rules {
+			if u.Rules[i].Prefix == prefix {
+				u.Rules = append(u.Rules[:i], u.Rules[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+// Returns the user who authenticates with token, which is the owner if it is
+// ownerToken, or ErrUnauthorized if there is none
+func (db *Depot) authenticate(ownerToken, token string) (*User, error) {
+	if ownerToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(ownerToken)) == 1 {
+		return &User{Name: OwnerName, Admin: true}, nil
+	}
+	if token == "" {
+		return nil, ErrUnauthorized
+	}
+
+	users, err := db.Users()
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(token))
+	for _, u := range users {
+		if subtle.ConstantTimeCompare(hash[:], u.TokenHash) == 1 {
+			return &u, nil
+		}
+	}
+
+	return nil, ErrUnauthorized
+}
+
+// Reports whether the user has every permission in perm on key and, if key is
+// an alias, on the key it stands for, or returns an error if unsuccessful
+func (db *Depot) userCan(user *User, key string, perm Permission) (bool, error) {
+	if !user.Can(key, perm) {
+		return false, nil
+	}
+	target, err := db.resolve(db.normalizeKey(key))
+	if err != nil {
+		return false, err
+	}
+
+	return user.Can(target, perm), nil
+}
+
+// Reports whether the user may read the metadata called name. The list of
+// users is for admins only, and the rest is needed by every client.
+func (u *User) canReadMeta(name string) bool {
+	return u.Admin || name != "users"
+}
+
+// Returns ErrForbidden unless the user may replace the metadata called name
+// with data. Admins may change anything, and other users only what clients
+// need to look after keys their rules let them write: aliases, rotation
+// periods, attachments and their chunks, shares, the time of the last purge,
+// and the times of syncs with Vault. The salt, the namespaces' salts, and the
+// list of users are for admins only.
+func (db *Depot) checkMetaWrite(user *User, name string, data []byte) error {
+	if user.Admin {
+		return nil
+	}
+
+	switch {
+	case name == aliasesMeta:
+		return db.checkAliases(user, data)
+	case name == rotationsMeta, name == attachmentsMeta:
+		return db.checkKeyedMeta(user, name, data)
+	case strings.HasPrefix(name, attachmentsMeta+"/"):
+		return db.checkChunk(user, name)
+	case strings.HasPrefix(name, sharesMeta):
+		return db.checkShare(user, name, data)
+	case name == purgedMeta:
+		// Only ever moved forward to now, or purging could be put off for good
+		last, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil || last > db.now().Unix() {
+			return ErrForbidden
+		}
+		return nil
+	case strings.HasPrefix(name, vaultSyncedMeta):
+		// Named for the directory synced last, which ends the name
+		for i := len(name) - 1; i > len(vaultSyncedMeta); i-- {
+			if name[i-1] == '/' && user.Can(name[i:]+"/", PermWrite) {
+				return nil
+			}
+		}
+	}
+
+	return ErrForbidden
+}
+
+// Returns ErrForbidden unless the user may make every alias that data, the
+// JSON object the aliases are to be replaced with, adds, changes, or removes:
+// they must be able to write the alias and read the key it stands for
+func (db *Depot) checkAliases(user *User, data []byte) error {
+	var aliases map[string]string
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return fmt.Errorf("cannot read aliases: %w", ErrForbidden)
+	}
+	old, err := db.Aliases()
+	if err != nil {
+		return err
+	}
+
+	for alias, target := range aliases {
+		if old[alias] != target && (!user.Can(alias, PermWrite) || !user.Can(target, PermRead)) {
+			return ErrForbidden
+		}
+	}
+	for alias := range old {
+		if _, ok := aliases[alias]; !ok && !user.Can(alias, PermWrite) {
+			return ErrForbidden
+		}
+	}
+
+	return nil
+}
+
+// Returns ErrForbidden unless the user may write every key whose member of
+// the metadata called name, a JSON object keyed by key, data adds, changes,
+// or removes
+func (db *Depot) checkKeyedMeta(user *User, name string, data []byte) error {
+	var members, old map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return fmt.Errorf("cannot read %v: %w", name, ErrForbidden)
+	}
+	oldData, err := db.backend.Meta(name)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	} else if err == nil {
+		if err = json.Unmarshal(oldData, &old); err != nil {
+			return fmt.Errorf("cannot read %v: %w", name, ErrCorrupted)
+		}
+	}
+
+	for key, m := range members {
+		if !bytes.Equal(old[key], m) && !user.Can(key, PermWrite) {
+			return ErrForbidden
+		}
+	}
+	for key := range old {
+		if _, ok := members[key]; !ok && !user.Can(key, PermWrite) {
+			return ErrForbidden
+		}
+	}
+
+	return nil
+}
+
+// Returns ErrForbidden unless the user may write the attachment chunk called
+// name, which they may unless it belongs to an attachment of a key they
+// cannot write. Chunks of a new attachment are written before it is listed,
+// under an ID no one else knows.
+func (db *Depot) checkChunk(user *User, name string) error {
+	id, _, _ := strings.Cut(strings.TrimPrefix(name, attachmentsMeta+"/"), "/")
+	attachments, err := db.attachments()
+	if err != nil {
+		return err
+	}
+	for key, byName := range attachments {
+		for _, a := range byName {
+			if a.ID == id && !user.Can(key, PermWrite) {
+				return ErrForbidden
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns ErrForbidden unless the user may replace the share called name with
+// data: they must be able to read the key a new share is of, and write the
+// key of one that already exists
+func (db *Depot) checkShare(user *User, name string, data []byte) error {
+	old, err := db.backend.Meta(name)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	var s share
+	if len(old) > 0 {
+		if err = json.Unmarshal(old, &s); err != nil {
+			return fmt.Errorf("cannot read share: %w", ErrCorrupted)
+		}
+		if !user.Can(s.Key, PermWrite) {
+			return ErrForbidden
+		}
+	}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &s); err != nil || !user.Can(s.Key, PermRead) {
+			return ErrForbidden
+		}
+	}
+
+	return nil
+}
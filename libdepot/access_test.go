@@ -0,0 +1,87 @@
+package libdepot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUsers(t *testing.T) {
+	mdb, _ := NewMemDepot()
+
+	token, err := mdb.AddUser("alice", false)
+	if err != nil {
+		t.Fatalf("error adding user: %v", err)
+	}
+	if _, err = mdb.AddUser("alice", false); err == nil {
+		t.Errorf("expected an error adding a user twice")
+	}
+	if _, err = mdb.AddUser(OwnerName, false); err == nil {
+		t.Errorf("expected an error adding a user called %v", OwnerName)
+	}
+
+	user, err := mdb.authenticate("owner-token", token)
+	if err != nil || user.Name != "alice" {
+		t.Fatalf("expected alice to authenticate but got %v (%v)", user, err)
+	}
+	if user.Can("team/key", PermRead) {
+		t.Errorf("expected a new user to have no permissions")
+	}
+	if owner, _ := mdb.authenticate("owner-token", "owner-token"); owner == nil || !owner.Admin {
+		t.Errorf("expected the owner to be an admin but got %v", owner)
+	}
+	if _, err = mdb.authenticate("", ""); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected %v without a token but got %v", ErrUnauthorized, err)
+	}
+
+	if err = mdb.Grant("alice", "team/", PermRead); err != nil {
+		t.Fatalf("error granting permission: %v", err)
+	}
+	if err = mdb.Grant("alice", "team/alice/", PermRead|PermWrite); err != nil {
+		t.Fatalf("error granting permission: %v", err)
+	}
+	if err = mdb.Grant("bob", "team/", PermRead); err == nil {
+		t.Errorf("expected an error granting permission to a missing user")
+	}
+	user, _ = mdb.authenticate("", token)
+	for _, c := range []struct {
+		key  string
+		perm Permission
+		can  bool
+	}{
+		{"team/key", PermRead, true},
+		{"team/key", PermWrite, false},
+		{"team/alice/key", PermRead | PermWrite, true},
+		{"other", PermRead, false},
+	} {
+		if user.Can(c.key, c.perm) != c.can {
+			t.Errorf("expected alice's %v permission on %v to be %v", c.perm, c.key, c.can)
+		}
+	}
+
+	if err = mdb.Revoke("alice", "team/"); err != nil {
+		t.Fatalf("error revoking permission: %v", err)
+	}
+	if user, _ = mdb.authenticate("", token); user.Can("team/key", PermRead) {
+		t.Errorf("expected a revoked permission to be gone")
+	}
+
+	if err = mdb.RemoveUser("alice"); err != nil {
+		t.Fatalf("error removing user: %v", err)
+	}
+	if _, err = mdb.authenticate("", token); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected %v for a removed user but got %v", ErrUnauthorized, err)
+	}
+}
+
+func TestParsePermission(t *testing.T) {
+	for s, want := range map[string]Permission{"r": PermRead, "w": PermWrite, "rw": PermRead | PermWrite} {
+		if perm, err := ParsePermission(s); err != nil || perm != want || perm.String() != s {
+			t.Errorf("expected %v to parse as %v but got %v (%v)", s, want, perm, err)
+		}
+	}
+	for _, s := range []string{"", "x", "read"} {
+		if _, err := ParsePermission(s); err == nil {
+			t.Errorf("expected an error parsing %q", s)
+		}
+	}
+}
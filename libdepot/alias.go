@@ -0,0 +1,185 @@
+package libdepot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// The depot metadata that aliases are kept in, as a JSON object mapping each
+// alias to the key it stands for
+const aliasesMeta = "aliases"
+
+// Returns every alias in the depot mapped to the key it stands for, or an
+// error if unsuccessful
+func (db *Depot) Aliases() (map[string]string, error) {
+	aliases := map[string]string{}
+	data, err := db.backend.Meta(aliasesMeta)
+	if errors.Is(err, ErrNotFound) {
+		return aliases, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	if err = json.Unmarshal(data, &aliases); err != nil {
+		return nil, fmt.Errorf("cannot read aliases: %w", ErrCorrupted)
+	}
+
+	return aliases, nil
+}
+
+func (db *Depot) setAliases(aliases map[string]string) error {
+	data, err := json.Marshal(aliases)
+	if err != nil {
+		return err
+	}
+	if err = db.backend.SetMeta(aliasesMeta, data); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return nil
+}
+
+// Makes alias another name for the key target, so that fetching alias
+// fetches target's value, whatever it is at the time. An alias of an alias
+// stands for the key the latter stands for. Stowing under an alias stows
+// under the key it stands for. Aliases are listed alongside keys (see
+// KeyInfo.Alias), and dropping an alias drops only the alias. Returns
+// ErrNotFound if target does not exist, ErrExists if alias is already a key,
+// or is already an alias and overwrite is false, or another error if
+// unsuccessful.
+func (db *Depot) Alias(alias, target string, overwrite bool) error {
+	return db.opError(OpAlias, alias, db.locked(func() error { return db.alias(alias, target, overwrite) }))
+}
+
+func (db *Depot) alias(alias, target string, overwrite bool) error {
+	alias, err := db.checkKey(alias)
+	if err != nil {
+		return err
+	}
+	target = db.normalizeKey(target)
+	aliases, err := db.Aliases()
+	if err != nil {
+		return err
+	}
+	if t, ok := aliases[target]; ok {
+		target = t
+	}
+	if target == alias {
+		return fmt.Errorf("%v cannot be an alias of itself", alias)
+	}
+
+	if _, err = db.get(target); err != nil {
+		return err
+	}
+	if _, ok := aliases[alias]; ok && !overwrite {
+		return ErrExists
+	}
+	if e, err := db.backend.Get(alias); err == nil && !e.Deleted {
+		return ErrExists
+	} else if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	aliases[alias] = target
+	return db.setAliases(aliases)
+}
+
+// Removes the alias, leaving the key it stands for alone. Returns ErrNotFound
+// if there is no such alias or another error if unsuccessful.
+func (db *Depot) Unalias(alias string) error {
+	return db.opError(OpUnalias, alias, db.locked(func() error { return db.unalias(alias) }))
+}
+
+func (db *Depot) unalias(alias string) error {
+	alias = db.normalizeKey(alias)
+	aliases, err := db.Aliases()
+	if err != nil {
+		return err
+	}
+	if _, ok := aliases[alias]; !ok {
+		return ErrNotFound
+	}
+
+	delete(aliases, alias)
+	return db.setAliases(aliases)
+}
+
+// Returns the entry stored under key, or the one key is an alias of, or
+// ErrNotFound if there is neither, or another error if unsuccessful
+func (db *Depot) get(key string) (*Entry, error) {
+	entry, err := db.backend.Get(key)
+	if err == nil && !entry.Deleted {
+		return entry, nil
+	} else if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	aliases, err := db.Aliases()
+	if err != nil {
+		return nil, err
+	}
+	target, ok := aliases[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	entry, err = db.backend.Get(target)
+	if errors.Is(err, ErrNotFound) || (err == nil && entry.Deleted) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return entry, nil
+}
+
+// Returns the key that key is an alias of, or key itself if it is a key or
+// neither, or an error if unsuccessful
+func (db *Depot) resolve(key string) (string, error) {
+	if e, err := db.backend.Get(key); err == nil && !e.Deleted {
+		return key, nil
+	} else if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	aliases, err := db.Aliases()
+	if err != nil {
+		return "", err
+	}
+	if target, ok := aliases[key]; ok {
+		return target, nil
+	}
+
+	return key, nil
+}
+
+// Adds the aliases matching pattern to keys, each with what can be told about
+// the key it stands for, and returns them all sorted by key. An alias that a
+// key of the same name has since been brought in over, by a sync say, is
+// shadowed by it and left out. Returns an error if unsuccessful.
+func (db *Depot) withAliases(keys []KeyInfo, pattern string) ([]KeyInfo, error) {
+	aliases, err := db.Aliases()
+	if err != nil || len(aliases) == 0 {
+		return keys, err
+	}
+
+	for alias, target := range aliases {
+		if !matchKey(pattern, alias) {
+			continue
+		}
+		if e, err := db.backend.Get(alias); err == nil && !e.Deleted {
+			continue
+		}
+
+		info := KeyInfo{Key: alias}
+		if e, err := db.backend.Get(target); err == nil && !e.Deleted {
+			info = keyInfo(e)
+			info.Key = alias
+		}
+		info.Alias = target
+		keys = append(keys, info)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+
+	return keys, nil
+}
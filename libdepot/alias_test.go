@@ -0,0 +1,78 @@
+package libdepot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAlias(t *testing.T) {
+	password := []byte("password")
+	mdb, _ := NewMemDepot()
+	mdb.Stow("postgres/prod", "secret", password)
+	mdb.Stow("other", "other", nil)
+
+	if err := mdb.Alias("db/primary", "missing", false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v aliasing a missing key but got %v", ErrNotFound, err)
+	}
+	if err := mdb.Alias("other", "postgres/prod", false); !errors.Is(err, ErrExists) {
+		t.Errorf("expected %v aliasing over a key but got %v", ErrExists, err)
+	}
+	if err := mdb.Alias("db/primary", "postgres/prod", false); err != nil {
+		t.Fatalf("error adding alias: %v", err)
+	}
+	if err := mdb.Alias("db/primary", "other", false); !errors.Is(err, ErrExists) {
+		t.Errorf("expected %v replacing an alias without overwrite but got %v", ErrExists, err)
+	}
+
+	// An alias of an alias stands for the key itself
+	if err := mdb.Alias("db/main", "db/primary", false); err != nil {
+		t.Fatalf("error adding alias: %v", err)
+	}
+	for _, alias := range []string{"db/primary", "db/main"} {
+		if val, err := mdb.Fetch(alias, password); err != nil || val != "secret" {
+			t.Errorf("expected %v to fetch secret but got %q (%v)", alias, val, err)
+		}
+		if err := mdb.Verify(alias, password); err != nil {
+			t.Errorf("expected %v to verify but got %v", alias, err)
+		}
+	}
+	if info, err := mdb.Info("db/main"); err != nil || info.Alias != "postgres/prod" || !info.Encrypted {
+		t.Errorf("expected db/main to be an encrypted alias of postgres/prod but got %+v (%v)", info, err)
+	}
+
+	keys, err := mdb.List("db/*")
+	if err != nil || len(keys) != 2 || keys[0].Key != "db/main" || keys[1].Alias != "postgres/prod" {
+		t.Errorf("expected both aliases to be listed but got %+v (%v)", keys, err)
+	}
+
+	// Stowing under an alias stows under the key
+	if err = mdb.Stow("db/main", "changed", password); err != nil {
+		t.Errorf("error stowing under alias: %v", err)
+	}
+	if val, err := mdb.Fetch("postgres/prod", password); err != nil || val != "changed" {
+		t.Errorf("expected stowing under db/main to change postgres/prod but got %q (%v)", val, err)
+	}
+
+	// Dropping an alias leaves the key alone
+	if err = mdb.Drop("db/main"); err != nil {
+		t.Errorf("error dropping alias: %v", err)
+	}
+	if _, err = mdb.Fetch("db/main", password); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v fetching a dropped alias but got %v", ErrNotFound, err)
+	}
+	if _, err = mdb.Fetch("postgres/prod", password); err != nil {
+		t.Errorf("expected postgres/prod to survive dropping its alias but got %v", err)
+	}
+
+	// An alias of a dropped key is still listed but fetches nothing
+	mdb.Drop("postgres/prod")
+	if _, err = mdb.Fetch("db/primary", password); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v fetching an alias of a dropped key but got %v", ErrNotFound, err)
+	}
+	if keys, _ = mdb.List(""); len(keys) != 2 || keys[0].Key != "db/primary" {
+		t.Errorf("expected the dangling alias to be listed but got %+v", keys)
+	}
+	if problems, _ := mdb.Check(nil, false); len(problems) != 1 || problems[0].Key != "db/primary" {
+		t.Errorf("expected the dangling alias to be reported but got %v", problems)
+	}
+}
@@ -0,0 +1,133 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Adds suffix to the end of the value of key, or of the key it is an alias
+// of, without the value leaving the depot. An encrypted value is decrypted
+// with password and encrypted again with it, so a non-nil password must be
+// supplied for one, while a plain value stays plain whatever password is
+// given. The password is not judged again (see WithWeakPasswordFunc), since
+// the value was already stowed with it. A key that does not exist is stowed
+// with suffix as its value, and encrypted if password is not nil. Returns
+// ErrTooLarge if the value would grow longer than allowed (see
+// WithMaxValueSize), or another error if unsuccessful.
+func (db *Depot) Append(key, suffix string, password []byte) error {
+	return db.audit(AuditStow, key, db.locked(func() error {
+		return db.appendVal(key, suffix, password, false)
+	}))
+}
+
+// Adds line to the value of key as Append does, on a line of its own: a
+// newline is put between them unless the value is empty or already ends
+// with one. Returns an error if unsuccessful.
+func (db *Depot) AppendLine(key, line string, password []byte) error {
+	return db.audit(AuditStow, key, db.locked(func() error {
+		return db.appendVal(key, line, password, true)
+	}))
+}
+
+func (db *Depot) appendVal(key, suffix string, password []byte, newline bool) error {
+	entry, err := db.get(db.normalizeKey(key))
+	if errors.Is(err, ErrNotFound) {
+		return db.stow(key, suffix, password)
+	} else if err != nil {
+		return err
+	}
+	val, password, err := db.fetchStowed(entry, password)
+	if err != nil {
+		return err
+	}
+	if newline && val != "" && !strings.HasSuffix(val, "\n") {
+		val += "\n"
+	}
+
+	return db.restow(entry.Key, val+suffix, password)
+}
+
+// Stores val in place of the value of key, or of the key it is an alias of,
+// as Stow does but without judging password (see WithWeakPasswordFunc): an
+// encrypted value is encrypted again with the password it was stowed with,
+// so a non-nil password must be supplied for one, while a plain value stays
+// plain whatever password is given. A key that does not exist is stowed
+// with val as its value, and encrypted if password is not nil, which should
+// have been judged with CheckPassword. Returns an error if unsuccessful.
+func (db *Depot) Replace(key, val string, password []byte) error {
+	return db.audit(AuditStow, key, db.locked(func() error {
+		return db.replace(key, val, password)
+	}))
+}
+
+func (db *Depot) replace(key, val string, password []byte) error {
+	entry, err := db.get(db.normalizeKey(key))
+	if errors.Is(err, ErrNotFound) {
+		if key, err = db.checkKey(key); err != nil {
+			return err
+		}
+		if key, err = db.resolve(key); err != nil {
+			return err
+		}
+		return db.restow(key, val, password)
+	} else if err != nil {
+		return err
+	}
+	if _, password, err = db.fetchStowed(entry, password); err != nil {
+		return err
+	}
+
+	return db.restow(entry.Key, val, password)
+}
+
+// Reports password if it is weak, as Stow would when stowing a value under
+// key with it (see WithWeakPasswordFunc), so that it can be refused before
+// the value is at hand. Returns the error it is refused with, or nil.
+func (db *Depot) CheckPassword(key string, password []byte) error {
+	if password == nil {
+		return nil
+	}
+
+	return db.checkStrength(db.normalizeKey(key), password)
+}
+
+// Returns the value of the stored entry, decrypted with password, and the
+// password to encrypt a value that takes its place with, which is nil if it
+// is plain. Returns ErrPasswordNeeded if it is encrypted and password is
+// nil, or another error if unsuccessful.
+func (db *Depot) fetchStowed(entry *Entry, password []byte) (string, []byte, error) {
+	if entry.Nonce == nil {
+		password = nil
+	} else if password == nil {
+		return "", nil, ErrPasswordNeeded
+	}
+	val, err := db.fetchEntry(entry, password)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return val, password, nil
+}
+
+// Stores val under key, encrypted with password if it is not nil, without
+// judging the password, which the caller has already done or which the
+// value was already stowed with. Returns an error if unsuccessful.
+func (db *Depot) restow(key, val string, password []byte) error {
+	var encryptionKey, salt []byte
+	if password != nil {
+		var err error
+		if encryptionKey, salt, err = db.keyDeriver(password).derive(key); err != nil {
+			return err
+		}
+	}
+	entry, err := db.newEntry(key, val, encryptionKey, salt)
+	if err != nil {
+		return err
+	}
+	if err = db.backend.Put(entry); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return nil
+}
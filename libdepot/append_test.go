@@ -0,0 +1,105 @@
+package libdepot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAppend(t *testing.T) {
+	mdb, _ := NewMemDepot(WithMaxValueSize(64))
+	password := []byte("password")
+
+	if err := mdb.Append("notes", "first", nil); err != nil {
+		t.Fatalf("error appending to a missing key: %v", err)
+	}
+	if err := mdb.Append("notes", ", second", password); err != nil {
+		t.Fatalf("error appending: %v", err)
+	}
+	if info, _ := mdb.Info("notes"); info.Encrypted {
+		t.Errorf("expected a plain value to stay plain when appended to with a password")
+	}
+	if val, _ := mdb.Fetch("notes", nil); val != "first, second" {
+		t.Errorf("expected %q but got %q", "first, second", val)
+	}
+
+	mdb.Stow("codes", "1111", password)
+	mdb.Alias("recovery", "codes", false)
+	if err := mdb.AppendLine("recovery", "2222", nil); !errors.Is(err, ErrPasswordNeeded) {
+		t.Errorf("expected %v appending to a secret without a password but got %v", ErrPasswordNeeded, err)
+	}
+	if err := mdb.AppendLine("recovery", "2222", []byte("wrong")); !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v appending with the wrong password but got %v", ErrBadPassword, err)
+	}
+	for _, line := range []string{"2222\n", "3333"} {
+		if err := mdb.AppendLine("recovery", line, password); err != nil {
+			t.Fatalf("error appending a line: %v", err)
+		}
+	}
+	if val, _ := mdb.Fetch("codes", password); val != "1111\n2222\n3333" {
+		t.Errorf("expected each code on a line of its own but got %q", val)
+	}
+
+	if err := mdb.Append("notes", string(make([]byte, 64)), nil); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected %v growing a value past the limit but got %v", ErrTooLarge, err)
+	}
+	if val, _ := mdb.Fetch("notes", nil); val != "first, second" {
+		t.Errorf("expected a value too large to be left as it was but got %q", val)
+	}
+}
+
+func TestAppendWeakPassword(t *testing.T) {
+	refuse := false
+	mdb, _ := NewMemDepot(WithWeakPasswordFunc(func(key string, entropy float64) error {
+		if refuse {
+			return ErrWeakPassword
+		}
+		return nil
+	}))
+	mdb.Stow("pin", "1234", []byte("1234"))
+
+	refuse = true
+	if err := mdb.AppendLine("pin", "5678", []byte("1234")); err != nil {
+		t.Errorf("error appending with the weak password a value was stowed with: %v", err)
+	}
+	if val, _ := mdb.Fetch("pin", []byte("1234")); val != "1234\n5678" {
+		t.Errorf("expected %q but got %q", "1234\n5678", val)
+	}
+	if err := mdb.Append("new", "value", []byte("1234")); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("expected %v creating a secret with a weak password but got %v", ErrWeakPassword, err)
+	}
+}
+
+func TestReplaceWeakPassword(t *testing.T) {
+	refuse := false
+	mdb, _ := NewMemDepot(WithWeakPasswordFunc(func(key string, entropy float64) error {
+		if refuse {
+			return ErrWeakPassword
+		}
+		return nil
+	}))
+	mdb.Stow("pin", "1234", []byte("1234"))
+	mdb.Stow("plain", "value", nil)
+
+	refuse = true
+	if err := mdb.Replace("pin", "5678", []byte("1234")); err != nil {
+		t.Errorf("error replacing with the weak password a value was stowed with: %v", err)
+	}
+	if val, _ := mdb.Fetch("pin", []byte("1234")); val != "5678" {
+		t.Errorf("expected %q but got %q", "5678", val)
+	}
+	if err := mdb.Replace("pin", "0000", []byte("4321")); !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v replacing with the wrong password but got %v", ErrBadPassword, err)
+	}
+	if err := mdb.Replace("plain", "other", []byte("1234")); err != nil {
+		t.Errorf("error replacing a plain value: %v", err)
+	}
+	if val, err := mdb.Fetch("plain", nil); val != "other" {
+		t.Errorf("expected the value to stay plain but got %q (%v)", val, err)
+	}
+	if err := mdb.CheckPassword("new", []byte("1234")); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("expected %v checking a weak password but got %v", ErrWeakPassword, err)
+	}
+	if err := mdb.CheckPassword("new", nil); err != nil {
+		t.Errorf("expected no password to pass but got %v", err)
+	}
+}
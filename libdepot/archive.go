@@ -0,0 +1,173 @@
+package libdepot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// Identifies a depot archive
+	archiveFormat = "depot-archive"
+
+	// The version of the archive format written by Export
+	archiveVersion = 1
+
+	// PBKDF2 iterations used to derive the key of a new archive. Archives
+	// travel, so they get a slower derivation than the depot itself.
+	archiveIterations = 600000
+)
+
+// The outer layer of an archive, holding what is needed to derive its key
+// and the encrypted contents
+type archiveEnvelope struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// The contents of an archive. Entries are kept exactly as they were stored,
+// so encrypted values are still encrypted with their own passwords inside
+// the archive.
+type archiveContents struct {
+	Created time.Time         `json:"created"`
+	Meta    map[string][]byte `json:"meta"`
+	Entries []*Entry          `json:"entries"`
+}
+
+// Reports whether key matches pattern, a shell pattern as understood by
+// path.Match. An empty pattern matches every key.
+func matchKey(pattern, key string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	ok, _ := path.Match(pattern, key)
+	return ok
+}
+
+// Returns the entries, tombstones aside, whose keys match pattern (see
+// matchKey) or an error if unsuccessful
+func (db *Depot) matching(pattern string) ([]*Entry, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	entries, err := db.backend.List("")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	var matched []*Entry
+	for _, e := range entries {
+		if !e.Deleted && matchKey(pattern, e.Key) {
+			matched = append(matched, e)
+		}
+	}
+
+	return matched, nil
+}
+
+// Writes an archive of the entries whose keys match pattern (a shell pattern
+// as understood by path.Match, or "" for every key) to w, encrypted with
+// password. The archive carries everything needed to decrypt its entries, so
+// it can be imported into any depot. Returns the number of entries written or
+// an error if unsuccessful.
+func (db *Depot) Export(w io.Writer, pattern string, password []byte) (int, error) {
+	entries, err := db.matching(pattern)
+	if err != nil {
+		return 0, err
+	}
+
+	var plain bytes.Buffer
+	zw := gzip.NewWriter(&plain)
+	err = json.NewEncoder(zw).Encode(archiveContents{
+		Created: db.now(),
+		Meta:    map[string][]byte{"salt": db.salt},
+		Entries: entries,
+	})
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot write archive: %w", err)
+	}
+
+	env := archiveEnvelope{
+		Format:     archiveFormat,
+		Version:    archiveVersion,
+		KDF:        "pbkdf2-sha256",
+		Iterations: archiveIterations,
+		Salt:       make([]byte, 32),
+	}
+	if _, err = io.ReadFull(db.random(), env.Salt); err != nil {
+		return 0, fmt.Errorf("cannot generate random salt: %w", err)
+	}
+	key := pbkdf2.Key(password, env.Salt, env.Iterations, 32, sha256.New)
+	if env.Data, env.Nonce, err = encrypt(db.random(), key, plain.Bytes(), nil); err != nil {
+		return 0, fmt.Errorf("cannot encrypt data: %w", err)
+	}
+
+	if err = json.NewEncoder(w).Encode(env); err != nil {
+		return 0, fmt.Errorf("cannot write archive: %w", err)
+	}
+
+	return len(entries), nil
+}
+
+// Reads an archive written by Export from r, decrypting it with password, and
+// stores its entries in the depot, replacing any with the same keys. Entries
+// from a depot with a different salt keep that salt, so their passwords are
+// unchanged. Returns the number of entries stored or an error if
+// unsuccessful.
+func (db *Depot) Import(r io.Reader, password []byte) (int, error) {
+	var env archiveEnvelope
+	if err := json.NewDecoder(r).Decode(&env); err != nil || env.Format != archiveFormat {
+		return 0, errors.New("not a depot archive")
+	}
+	if env.Version != archiveVersion || env.KDF != "pbkdf2-sha256" {
+		return 0, fmt.Errorf("unsupported archive version %v (%v)", env.Version, env.KDF)
+	}
+
+	key := pbkdf2.Key(password, env.Salt, env.Iterations, 32, sha256.New)
+	plain, err := decrypt(key, env.Nonce, env.Data, nil)
+	if err != nil {
+		return 0, fmt.Errorf("cannot decrypt archive: %w", ErrBadPassword)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		return 0, fmt.Errorf("cannot read archive: %w", ErrCorrupted)
+	}
+	var contents archiveContents
+	if err = json.NewDecoder(zr).Decode(&contents); err != nil {
+		return 0, fmt.Errorf("cannot read archive: %w", ErrCorrupted)
+	}
+
+	salt := contents.Meta["salt"]
+	for i, e := range contents.Entries {
+		if e.Nonce != nil && e.Salt == nil {
+			e.Salt = salt
+		}
+		if bytes.Equal(e.Salt, db.salt) {
+			e.Salt = nil
+		}
+		if err = db.backend.Put(e); err != nil {
+			return i, fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+	}
+
+	return len(contents.Entries), nil
+}
@@ -0,0 +1,74 @@
+package libdepot
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	archivePassword := []byte("archive password")
+	src, err := NewMemDepot()
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	if err = src.Stow("web/secret", "hunter2", []byte("password")); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	if err = src.Stow("web/plain", "value", nil); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	if err = src.Stow("other", "value", nil); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	if err = src.Stow("web/dropped", "value", nil); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	if err = src.Drop("web/dropped"); err != nil {
+		t.Fatalf("error dropping value: %v", err)
+	}
+
+	var archive bytes.Buffer
+	n, err := src.Export(&archive, "web/*", archivePassword)
+	if err != nil {
+		t.Fatalf("error exporting: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 entries to be exported but got %v", n)
+	}
+	if bytes.Contains(archive.Bytes(), []byte("web/plain")) {
+		t.Errorf("expected the archive to be encrypted")
+	}
+
+	// The destination has a salt of its own
+	dst, err := NewMemDepot()
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	if _, err = dst.Import(bytes.NewReader(archive.Bytes()), []byte("wrong")); !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v importing with the wrong password but got %v", ErrBadPassword, err)
+	}
+	if n, err = dst.Import(bytes.NewReader(archive.Bytes()), archivePassword); err != nil {
+		t.Fatalf("error importing: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 entries to be imported but got %v", n)
+	}
+
+	if val, err := dst.Fetch("web/secret", []byte("password")); err != nil || val != "hunter2" {
+		t.Errorf("expected hunter2 but got %q (%v)", val, err)
+	}
+	if val, err := dst.Fetch("web/plain", nil); err != nil || val != "value" {
+		t.Errorf("expected value but got %q (%v)", val, err)
+	}
+	if _, err = dst.Fetch("other", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a key outside the pattern to be left out but got %v", err)
+	}
+
+	if _, err = src.Export(&archive, "[", archivePassword); err == nil {
+		t.Errorf("expected an error exporting with an invalid pattern")
+	}
+	if _, err = dst.Import(bytes.NewReader([]byte("{}")), archivePassword); err == nil {
+		t.Errorf("expected an error importing something that is not an archive")
+	}
+}
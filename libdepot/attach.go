@@ -0,0 +1,301 @@
+package libdepot
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The depot metadata that attachments are listed in, as a JSON object
+// mapping each key to its attachments by name. Their contents are kept in
+// chunks of their own, each in metadata named for the attachment's ID and the
+// chunk's place in it (see chunkMeta).
+const attachmentsMeta = "attachments"
+
+// How much of an attachment each chunk holds, so that neither stowing nor
+// fetching one needs all of it in memory at once
+const attachmentChunkSize = 1 << 20
+
+// A file attached to a key (see Attach)
+type Attachment struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+}
+
+// What a depot keeps about an attachment: where its chunks are, how many of
+// them there are, and the salt of the key they were encrypted with if it is
+// that of the key's namespace rather than the depot's own
+type attachment struct {
+	ID       string    `json:"id"`
+	Size     int64     `json:"size"`
+	Chunks   int       `json:"chunks"`
+	Salt     []byte    `json:"salt,omitempty"`
+	Modified time.Time `json:"modified"`
+}
+
+// A chunk of an attachment, sealed like the value of an entry (see Entry)
+type chunk struct {
+	Data   []byte `json:"data"`
+	Nonce  []byte `json:"nonce"`
+	Check  []byte `json:"check"`
+	Cipher string `json:"cipher,omitempty"`
+}
+
+// Returns the name of the metadata holding chunk i of the attachment with id
+func chunkMeta(id string, i int) string {
+	return attachmentsMeta + "/" + id + "/" + strconv.Itoa(i)
+}
+
+func (db *Depot) attachments() (map[string]map[string]attachment, error) {
+	attachments := map[string]map[string]attachment{}
+	data, err := db.backend.Meta(attachmentsMeta)
+	if errors.Is(err, ErrNotFound) {
+		return attachments, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	if err = json.Unmarshal(data, &attachments); err != nil {
+		return nil, fmt.Errorf("cannot read attachments: %w", ErrCorrupted)
+	}
+
+	return attachments, nil
+}
+
+func (db *Depot) setAttachments(attachments map[string]map[string]attachment) error {
+	data, err := json.Marshal(attachments)
+	if err != nil {
+		return err
+	}
+	if err = db.backend.SetMeta(attachmentsMeta, data); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return nil
+}
+
+// Returns the attachments of key, or of the key it is an alias of, sorted by
+// name, or an error if unsuccessful
+func (db *Depot) Attachments(key string) ([]Attachment, error) {
+	key = db.normalizeKey(key)
+	if entry, err := db.get(key); err == nil {
+		key = entry.Key
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, db.opError(OpAttach, key, err)
+	}
+	attachments, err := db.attachments()
+	if err != nil {
+		return nil, db.opError(OpAttach, key, err)
+	}
+
+	list := make([]Attachment, 0, len(attachments[key]))
+	for name, a := range attachments[key] {
+		list = append(list, Attachment{Name: name, Size: a.Size, Modified: a.Modified})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list, nil
+}
+
+// Attaches everything read from r to key, or to the key it is an alias of,
+// under name, replacing any attachment of the same name. Attachments are
+// always encrypted, with the key a value stowed under key with password
+// would be, and are read, stored, and fetched (see FetchAttachment) a chunk
+// at a time, so they may be far larger than a value. They stay attached
+// until they are removed (see RemoveAttachment), even if the key is dropped.
+// Returns ErrNotFound if there is no such key, ErrInvalidKey if name is empty
+// or contains a slash, or another error if unsuccessful.
+func (db *Depot) Attach(key, name string, r io.Reader, password []byte) error {
+	return db.opError(OpAttach, key, db.attachFile(db.normalizeKey(key), name, r, password))
+}
+
+func (db *Depot) attachFile(key, name string, r io.Reader, password []byte) error {
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("%w: attachment %q", ErrInvalidKey, name)
+	} else if password == nil {
+		return ErrPasswordNeeded
+	}
+	entry, err := db.get(key)
+	if err != nil {
+		return err
+	}
+	key = entry.Key
+	encryptionKey, salt, err := db.stowKey(key, password)
+	if err != nil {
+		return err
+	}
+
+	id := make([]byte, 16)
+	if _, err = io.ReadFull(db.random(), id); err != nil {
+		return fmt.Errorf("cannot generate random ID: %w", err)
+	}
+	a := attachment{ID: hex.EncodeToString(id), Salt: salt}
+	buf := make([]byte, attachmentChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if errors.Is(err, io.EOF) && a.Chunks > 0 {
+			break
+		} else if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("cannot read attachment: %w", err)
+		}
+		if err := db.putChunk(a.ID, a.Chunks, encryptionKey, buf[:n]); err != nil {
+			return err
+		}
+		a.Chunks++
+		a.Size += int64(n)
+		if n < len(buf) {
+			break
+		}
+	}
+	a.Modified = db.now()
+
+	var old attachment
+	err = db.locked(func() error {
+		attachments, err := db.attachments()
+		if err != nil {
+			return err
+		}
+		if attachments[key] == nil {
+			attachments[key] = map[string]attachment{}
+		}
+		old = attachments[key][name]
+		attachments[key][name] = a
+
+		return db.setAttachments(attachments)
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.clearChunks(old)
+}
+
+// Seals data with encryptionKey and stores it as chunk i of the attachment
+// with id. Returns an error if unsuccessful.
+func (db *Depot) putChunk(id string, i int, encryptionKey, data []byte) error {
+	sealed, nonce, cipher, err := db.seal(encryptionKey, data, nil)
+	if err != nil {
+		return fmt.Errorf("cannot encrypt data: %w", err)
+	}
+	c, err := json.Marshal(chunk{Data: sealed, Nonce: nonce, Check: keyCheck(encryptionKey, nonce), Cipher: cipher})
+	if err != nil {
+		return err
+	}
+	if err = db.backend.SetMeta(chunkMeta(id, i), c); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return nil
+}
+
+// Empties the chunks of an attachment that is no longer listed, since
+// backends cannot delete metadata. Returns an error if unsuccessful.
+func (db *Depot) clearChunks(a attachment) error {
+	for i := 0; i < a.Chunks; i++ {
+		if err := db.backend.SetMeta(chunkMeta(a.ID, i), nil); err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+	}
+
+	return nil
+}
+
+// Writes the attachment of key, or of the key it is an alias of, called name
+// to w, decrypted with password a chunk at a time. Returns ErrNotFound if it
+// has no such attachment, ErrBadPassword if password is not the one it was
+// attached with, or another error if unsuccessful, in which case part of it
+// may already have been written.
+func (db *Depot) FetchAttachment(key, name string, w io.Writer, password []byte) error {
+	return db.opError(OpAttach, key, db.fetchAttachment(db.normalizeKey(key), name, w, password))
+}
+
+func (db *Depot) fetchAttachment(key, name string, w io.Writer, password []byte) error {
+	if entry, err := db.get(key); err == nil {
+		key = entry.Key
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	attachments, err := db.attachments()
+	if err != nil {
+		return err
+	}
+	a, ok := attachments[key][name]
+	if !ok {
+		return fmt.Errorf("attachment %v: %w", name, ErrNotFound)
+	} else if password == nil {
+		return ErrPasswordNeeded
+	}
+
+	encryptionKey := db.deriveKey(password, a.Salt)
+	for i := 0; i < a.Chunks; i++ {
+		data, err := db.backend.Meta(chunkMeta(a.ID, i))
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+		var c chunk
+		if err = json.Unmarshal(data, &c); err != nil {
+			return fmt.Errorf("cannot read attachment: %w", ErrCorrupted)
+		}
+		if !hmac.Equal(c.Check, keyCheck(encryptionKey, c.Nonce)) {
+			return ErrBadPassword
+		}
+		sealer, err := db.opener(c.Cipher)
+		if err != nil {
+			return err
+		}
+		plain, err := sealer.Open(encryptionKey, c.Nonce, c.Data)
+		if err != nil {
+			return fmt.Errorf("cannot decrypt attachment: %w", ErrCorrupted)
+		}
+		if _, err = w.Write(plain); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Removes the attachment of key, or of the key it is an alias of, called
+// name. Returns ErrNotFound if it has no such attachment, or another error if
+// unsuccessful.
+func (db *Depot) RemoveAttachment(key, name string) error {
+	return db.opError(OpAttach, key, db.removeAttachment(db.normalizeKey(key), name))
+}
+
+func (db *Depot) removeAttachment(key, name string) error {
+	if entry, err := db.get(key); err == nil {
+		key = entry.Key
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	var old attachment
+	err := db.locked(func() error {
+		attachments, err := db.attachments()
+		if err != nil {
+			return err
+		}
+		a, ok := attachments[key][name]
+		if !ok {
+			return fmt.Errorf("attachment %v: %w", name, ErrNotFound)
+		}
+		old = a
+		if delete(attachments[key], name); len(attachments[key]) == 0 {
+			delete(attachments, key)
+		}
+
+		return db.setAttachments(attachments)
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.clearChunks(old)
+}
@@ -0,0 +1,68 @@
+package libdepot
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestAttachments(t *testing.T) {
+	mdb, _ := NewMemDepot()
+	password := []byte("password")
+	if err := mdb.Attach("licenses/ide", "license.txt", bytes.NewReader([]byte("key")), password); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v attaching to a missing key but got %v", ErrNotFound, err)
+	}
+	if err := mdb.Stow("licenses/ide", "seat 1", password); err != nil {
+		t.Fatalf("error stowing: %v", err)
+	}
+	if err := mdb.Attach("licenses/ide", "license.txt", bytes.NewReader([]byte("key")), nil); !errors.Is(err, ErrPasswordNeeded) {
+		t.Errorf("expected %v attaching without a password but got %v", ErrPasswordNeeded, err)
+	}
+	if err := mdb.Attach("licenses/ide", "a/b", bytes.NewReader([]byte("key")), password); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected %v for a name with a slash but got %v", ErrInvalidKey, err)
+	}
+
+	// Larger than a chunk, and not a whole number of them
+	file := bytes.Repeat([]byte("0123456789abcdef"), attachmentChunkSize/8+3)
+	if err := mdb.Attach("licenses/ide", "bundle.p12", bytes.NewReader(file), password); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	if err := mdb.Attach("licenses/ide", "empty", bytes.NewReader(nil), password); err != nil {
+		t.Fatalf("error attaching an empty file: %v", err)
+	}
+	list, err := mdb.Attachments("licenses/ide")
+	if err != nil || len(list) != 2 || list[0].Name != "bundle.p12" || list[0].Size != int64(len(file)) || list[1].Name != "empty" {
+		t.Errorf("expected bundle.p12 and empty but got %+v (%v)", list, err)
+	}
+
+	var out bytes.Buffer
+	if err = mdb.FetchAttachment("licenses/ide", "bundle.p12", &out, password); err != nil || !bytes.Equal(out.Bytes(), file) {
+		t.Errorf("expected the attached file back but got %d bytes (%v)", out.Len(), err)
+	}
+	if err = mdb.FetchAttachment("licenses/ide", "bundle.p12", &bytes.Buffer{}, []byte("wrong")); !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v but got %v", ErrBadPassword, err)
+	}
+	out.Reset()
+	if err = mdb.FetchAttachment("licenses/ide", "empty", &out, password); err != nil || out.Len() != 0 {
+		t.Errorf("expected an empty file but got %d bytes (%v)", out.Len(), err)
+	}
+
+	// Replacing an attachment leaves only the new one
+	if err = mdb.Attach("licenses/ide", "bundle.p12", bytes.NewReader([]byte("new")), password); err != nil {
+		t.Fatalf("error replacing attachment: %v", err)
+	}
+	out.Reset()
+	if err = mdb.FetchAttachment("licenses/ide", "bundle.p12", &out, password); err != nil || out.String() != "new" {
+		t.Errorf("expected new but got %q (%v)", out.String(), err)
+	}
+
+	if err = mdb.RemoveAttachment("licenses/ide", "bundle.p12"); err != nil {
+		t.Errorf("error removing attachment: %v", err)
+	}
+	if err = mdb.RemoveAttachment("licenses/ide", "bundle.p12"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v removing it again but got %v", ErrNotFound, err)
+	}
+	if err = mdb.FetchAttachment("licenses/ide", "bundle.p12", &out, password); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v fetching a removed attachment but got %v", ErrNotFound, err)
+	}
+}
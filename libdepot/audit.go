@@ -0,0 +1,144 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditStow  = "stow"
+	AuditFetch = "fetch"
+	AuditDrop  = "drop"
+	AuditShare = "share"
+)
+
+// A record of something done with a key. Values are never recorded.
+type AuditEvent struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	Key    string    `json:"key"`
+
+	// Why the action failed, or "" if it succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// Called with every event as it is recorded, to send it elsewhere
+type AuditFunc func(e AuditEvent)
+
+// A Backend that keeps an append-only log of what is done with the depot.
+// Every Stow, Fetch, and Drop is recorded in it.
+type AuditLogger interface {
+	// Adds an event to the end of the log
+	AppendAudit(e *AuditEvent) error
+
+	// Returns the events recorded at or after since, oldest first
+	AuditLog(since time.Time) ([]*AuditEvent, error)
+}
+
+// Selects events from the audit log. Empty fields select everything.
+type AuditQuery struct {
+	Since time.Time
+	Actor string
+
+	// A shell pattern as understood by path.Match
+	Pattern string
+}
+
+// Returns an Option that names who is using the depot in the audit log
+func WithActor(actor string) Option {
+	return func(db *Depot) {
+		db.actor = actor
+	}
+}
+
+// Returns an Option that calls f with every stow, fetch, and drop, whether
+// or not the backend keeps an audit log of its own
+func WithAuditFunc(f AuditFunc) Option {
+	return func(db *Depot) {
+		db.auditFunc = f
+	}
+}
+
+// Returns a copy of the depot that acts on behalf of actor
+func (db *Depot) as(actor string) *Depot {
+	c := *db
+	c.actor = actor
+	return &c
+}
+
+// Records that action was done with key, failing with err if it is not nil,
+// and returns err as an OpError. A failure for want of a password is not
+// recorded, since nothing was attempted. Returns an error if the event cannot
+// be recorded.
+func (db *Depot) audit(action, key string, err error) error {
+	return db.auditOp(action, action, key, err)
+}
+
+// Records that action was done with key as audit does, and returns err as an
+// OpError naming op, for an operation recorded as one of the audited ones
+func (db *Depot) auditOp(op, action, key string, err error) error {
+	if errors.Is(err, ErrPasswordNeeded) {
+		return db.opError(op, key, err)
+	}
+
+	db.logAction(action, key, err)
+	if err == nil {
+		defer db.afterAction(action, key)
+	}
+	e := AuditEvent{Time: db.now(), Actor: db.actor, Action: action, Key: key}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if db.auditFunc != nil {
+		db.auditFunc(e)
+	}
+	if l, ok := db.backend.(AuditLogger); ok {
+		if logErr := l.AppendAudit(&e); logErr != nil && err == nil {
+			db.log().Error("cannot write audit log", slog.Any("error", logErr))
+			return fmt.Errorf("cannot write audit log: %w", logErr)
+		}
+	}
+
+	return db.opError(op, key, err)
+}
+
+// Records that an entry was put on behalf of a client that encrypts values
+// itself, failing with err if it is not nil, and returns err as audit does
+func (db *Depot) auditPut(e *Entry, err error) error {
+	if e.Deleted {
+		return db.audit(AuditDrop, e.Key, err)
+	}
+
+	return db.audit(AuditStow, e.Key, err)
+}
+
+// Returns the events in the audit log selected by q, oldest first, or an
+// error if unsuccessful, including when the backend keeps no audit log
+func (db *Depot) AuditLog(q AuditQuery) ([]AuditEvent, error) {
+	l, ok := db.backend.(AuditLogger)
+	if !ok {
+		return nil, fmt.Errorf("depot keeps no audit log: %w", errors.ErrUnsupported)
+	}
+	if _, err := path.Match(q.Pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", q.Pattern, err)
+	}
+
+	events, err := l.AuditLog(q.Since)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read audit log: %w", err)
+	}
+
+	var selected []AuditEvent
+	for _, e := range events {
+		if (q.Actor == "" || e.Actor == q.Actor) && matchKey(q.Pattern, e.Key) {
+			selected = append(selected, *e)
+		}
+	}
+
+	return selected, nil
+}
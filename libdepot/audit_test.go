@@ -0,0 +1,58 @@
+package libdepot
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	var streamed []AuditEvent
+	mdb, _ := NewMemDepot(WithActor("alice"), WithAuditFunc(func(e AuditEvent) {
+		streamed = append(streamed, e)
+	}))
+	start := time.Now()
+
+	mdb.Stow("audit/a", "secret value", []byte("password"))
+	mdb.Fetch("audit/a", nil)
+	mdb.Fetch("audit/a", []byte("wrong"))
+	mdb.Fetch("audit/a", []byte("password"))
+	mdb.Drop("audit/a")
+	mdb.Stow("other", "value", nil)
+
+	events, err := mdb.AuditLog(AuditQuery{Since: start, Pattern: "audit/*"})
+	if err != nil {
+		t.Fatalf("error reading audit log: %v", err)
+	}
+	want := []struct{ action, err string }{
+		{AuditStow, ""},
+		{AuditFetch, "cannot decrypt data: " + ErrBadPassword.Error()},
+		{AuditFetch, ""},
+		{AuditDrop, ""},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %v audit events but got %v", len(want), events)
+	}
+	for i, w := range want {
+		e := events[i]
+		if e.Action != w.action || e.Error != w.err || e.Actor != "alice" || e.Key != "audit/a" {
+			t.Errorf("expected %v by alice on audit/a failing with %q but got %+v", w.action, w.err, e)
+		}
+	}
+	if len(streamed) != len(want)+1 {
+		t.Errorf("expected every event to be streamed but got %v", len(streamed))
+	}
+
+	if events, _ = mdb.AuditLog(AuditQuery{Actor: "bob"}); len(events) != 0 {
+		t.Errorf("expected no events by bob but got %v", events)
+	}
+
+	fs, _ := NewFSBackend(t.TempDir())
+	fdb, err := NewDepotWithBackend(fs)
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	if _, err = fdb.AuditLog(AuditQuery{}); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("expected %v reading the audit log of a directory but got %v", errors.ErrUnsupported, err)
+	}
+}
@@ -0,0 +1,116 @@
+package libdepot
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A single record as it is kept by a Backend. Encrypted values are stored
+// base64-encoded alongside the nonce (or whatever parameters their Sealer
+// needs) and key check used to encrypt them; a nil Nonce means Val is
+// plaintext. A value may be compressed before it is
+// encrypted, as Compression records, and a compressed plaintext value is
+// base64-encoded as well. An entry brought in from another depot may
+// carry the salt its key was derived with, which then takes the place of the
+// depot's own. A value encrypted now also has a salt of its own, KeySalt,
+// that its key is derived further with (see ValueKey). A dropped key leaves
+// behind a tombstone, an entry marked Deleted, which records when it was dropped
+// so that syncing with a stale copy of the depot cannot bring it back. The
+// tombstone keeps the value while it is in the trash (see TrashLifetime), and
+// has none after that.
+type Entry struct {
+	Key      string    `json:"key"`
+	Val      string    `json:"val"`
+	Nonce    []byte    `json:"nonce,omitempty"`
+	Check    []byte    `json:"check,omitempty"`
+	Salt     []byte    `json:"salt,omitempty"`
+	Modified time.Time `json:"modified"`
+	Deleted  bool      `json:"deleted,omitempty"`
+
+	// How Val was compressed, or CompressionNone
+	Compression string `json:"compression,omitempty"`
+
+	// The Sealer Val was encrypted with, or CipherAESGCM
+	Cipher string `json:"cipher,omitempty"`
+
+	// The value's own salt, or nil if it was encrypted with the key the
+	// password derives before values had salts of their own
+	KeySalt []byte `json:"key_salt,omitempty"`
+}
+
+// The storage medium behind a Depot. A Backend only ever sees values after
+// they have been encrypted, so implementations need not be trusted with
+// secrets. Implementations must be safe for concurrent use.
+type Backend interface {
+	// Returns the entry stored under key or ErrNotFound
+	Get(key string) (*Entry, error)
+
+	// Stores the entry, replacing any existing entry with the same key
+	Put(entry *Entry) error
+
+	// Removes the entry stored under key, tombstone or not. Removing a key
+	// that does not exist is not an error.
+	Delete(key string) error
+
+	// Returns every entry whose key begins with prefix, sorted by key
+	List(prefix string) ([]*Entry, error)
+
+	// Returns the named piece of depot metadata (such as the salt) or
+	// ErrNotFound
+	Meta(name string) ([]byte, error)
+
+	// Stores the named piece of depot metadata
+	SetMeta(name string, data []byte) error
+
+	// Releases any resources held by the backend
+	Close() error
+}
+
+// Returns the backend that the given URI refers to or an error if it cannot
+// be opened. A sqlite3 or bbolt database that does not exist is created,
+// along with its directory, readable by its owner alone. Anything that isn't
+// recognized by its scheme or extension is taken to be a sqlite3 database.
+func (db *Depot) openBackend(uri string) (Backend, error) {
+	scheme, rest, _ := strings.Cut(uri, "://")
+	switch scheme {
+	case "http", "https":
+		return NewHTTPBackend(uri, db.token)
+	case "grpc", "grpcs":
+		return NewGRPCBackend(uri, db.token)
+	case "postgres", "postgresql":
+		return NewPostgresBackend(uri)
+	case "bolt", "bbolt":
+		if err := createPrivate(rest); err != nil {
+			return nil, err
+		}
+		return NewBoltBackend(rest)
+	case "redis", "rediss":
+		return NewRedisBackend(uri)
+	case "s3":
+		return NewS3Backend(uri)
+	case "dir", "pass":
+		return NewFSBackend(rest)
+	case "git":
+		return NewGitBackend(rest)
+	}
+
+	switch filepath.Ext(uri) {
+	case ".bolt", ".bbolt":
+		if err := createPrivate(uri); err != nil {
+			return nil, err
+		}
+		return NewBoltBackend(uri)
+	default:
+		if path := sqlitePath(uri); path != "" {
+			if err := createPrivate(path); err != nil {
+				return nil, err
+			}
+		}
+		dsn, err := sqliteDSN(uri, db.pragmas)
+		if err != nil {
+			return nil, err
+		}
+		return NewSQLiteBackend(dsn)
+	}
+}
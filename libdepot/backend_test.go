@@ -0,0 +1,217 @@
+package libdepot
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// Exercises the parts of the Backend contract that every implementation
+// must honor
+func testBackend(t *testing.T, b Backend) {
+	t.Helper()
+
+	modified := time.Unix(time.Now().Unix(), 0)
+	entries := []*Entry{
+		{Key: "backend/b", Val: "plaintext", Modified: modified},
+		{Key: "backend/a", Val: "Y2lwaGVy", Nonce: []byte("nonce"), Check: []byte("check"), Salt: []byte("salt"), Modified: modified, Compression: CompressionZstd, Cipher: "test"},
+		{Key: "other", Val: "outside the prefix", Modified: modified},
+		{Key: "tombstone", Modified: modified, Deleted: true},
+	}
+	for _, e := range entries {
+		if err := b.Put(e); err != nil {
+			t.Fatalf("error putting %v: %v", e.Key, err)
+		}
+	}
+	t.Cleanup(func() {
+		for _, e := range entries {
+			b.Delete(e.Key)
+		}
+	})
+
+	e, err := b.Get("backend/a")
+	if err != nil {
+		t.Fatalf("error getting backend/a: %v", err)
+	}
+	if e.Val != "Y2lwaGVy" || string(e.Nonce) != "nonce" || string(e.Check) != "check" || string(e.Salt) != "salt" ||
+		e.Compression != CompressionZstd || e.Cipher != "test" {
+		t.Errorf("expected backend/a to round trip but got %+v", e)
+	}
+	if !e.Modified.Equal(modified) {
+		t.Errorf("expected modified time %v but got %v", modified, e.Modified)
+	}
+	if e.Deleted {
+		t.Errorf("expected backend/a not to be a tombstone")
+	}
+	if e, err = b.Get("tombstone"); err != nil || !e.Deleted {
+		t.Errorf("expected a tombstone to round trip but got %+v (%v)", e, err)
+	}
+
+	list, err := b.List("backend/")
+	if err != nil {
+		t.Fatalf("error listing entries: %v", err)
+	}
+	if len(list) != 2 || list[0].Key != "backend/a" || list[1].Key != "backend/b" {
+		t.Errorf("expected backend/a and backend/b in order but listed %v entries", len(list))
+	}
+	if list[1].Nonce != nil || list[1].Salt != nil || list[1].Compression != CompressionNone {
+		t.Errorf("expected a nil nonce and salt and no compression for a plaintext entry but got %+v", list[1])
+	}
+
+	entries[0].Val = "updated"
+	if err = b.Put(entries[0]); err != nil {
+		t.Fatalf("error replacing backend/b: %v", err)
+	}
+	if e, err = b.Get("backend/b"); err != nil || e.Val != "updated" {
+		t.Errorf("expected backend/b to be replaced but got %+v (%v)", e, err)
+	}
+
+	if err = b.Delete("backend/b"); err != nil {
+		t.Errorf("error deleting backend/b: %v", err)
+	}
+	if _, err = b.Get("backend/b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v getting a deleted entry but the error was %v", ErrNotFound, err)
+	}
+	if err = b.Delete("backend/b"); err != nil {
+		t.Errorf("expected deleting a missing entry to succeed but the error was %v", err)
+	}
+
+	if _, err = b.Meta("backend test"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v for missing metadata but the error was %v", ErrNotFound, err)
+	}
+	if err = b.SetMeta("backend test", []byte("meta")); err != nil {
+		t.Errorf("error setting metadata: %v", err)
+	}
+	if data, err := b.Meta("backend test"); err != nil || string(data) != "meta" {
+		t.Errorf("expected metadata to round trip but got %q (%v)", data, err)
+	}
+
+	if batcher, ok := b.(Batcher); ok {
+		batch := []*Entry{
+			{Key: "backend/batch/a", Val: "a", Modified: modified},
+			{Key: "backend/batch/b", Val: "b", Modified: modified},
+		}
+		t.Cleanup(func() {
+			for _, e := range batch {
+				b.Delete(e.Key)
+			}
+		})
+		if err := batcher.PutAll(batch); err != nil {
+			t.Fatalf("error putting a batch: %v", err)
+		}
+		if list, err := b.List("backend/batch/"); err != nil || len(list) != 2 || list[1].Val != "b" {
+			t.Errorf("expected both entries in the batch to be stored but listed %v (%v)", len(list), err)
+		}
+	}
+
+	if l, ok := b.(AuditLogger); ok {
+		start := time.Now()
+		for _, action := range []string{AuditStow, AuditFetch} {
+			e := AuditEvent{Time: time.Now(), Actor: "tester", Action: action, Key: "backend/a"}
+			if err := l.AppendAudit(&e); err != nil {
+				t.Fatalf("error appending audit event: %v", err)
+			}
+		}
+		events, err := l.AuditLog(start)
+		if err != nil || len(events) != 2 {
+			t.Fatalf("expected 2 audit events but got %v (%v)", len(events), err)
+		}
+		if events[0].Action != AuditStow || events[1].Actor != "tester" || events[1].Key != "backend/a" {
+			t.Errorf("expected audit events to round trip in order but got %v, %v", events[0], events[1])
+		}
+		if events, _ = l.AuditLog(time.Now().Add(time.Hour)); len(events) != 0 {
+			t.Errorf("expected no audit events from the future but got %v", len(events))
+		}
+	}
+}
+
+func TestSQLiteBackend(t *testing.T) {
+	b, err := NewSQLiteBackend(t.TempDir() + "/backend.db")
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	testBackend(t, b)
+}
+
+func TestPostgresBackend(t *testing.T) {
+	uri := os.Getenv("DEPOT_TEST_POSTGRES")
+	if uri == "" {
+		t.Skip("DEPOT_TEST_POSTGRES is not set")
+	}
+
+	b, err := NewPostgresBackend(uri)
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	if _, err = b.Meta("salt"); err != nil {
+		t.Errorf("expected the backend to create a salt but the error was %v", err)
+	}
+	testBackend(t, b)
+}
+
+func TestBoltBackend(t *testing.T) {
+	b, err := NewBoltBackend(t.TempDir() + "/backend.bolt")
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	testBackend(t, b)
+}
+
+func TestMemBackend(t *testing.T) {
+	testBackend(t, NewMemBackend())
+}
+
+func TestFSBackend(t *testing.T) {
+	root := t.TempDir()
+	b, err := NewFSBackend(root)
+	if err != nil {
+		t.Fatalf("failed to initialize directory: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	testBackend(t, b)
+
+	for _, key := range []string{"../escape", "/absolute", "a//b", ".depot/salt"} {
+		if err = b.Put(&Entry{Key: key, Val: "val"}); err == nil {
+			t.Errorf("expected an error storing %q but there was none", key)
+		}
+	}
+
+	if err = b.Put(&Entry{Key: "dir/nested/key", Val: "val"}); err != nil {
+		t.Fatalf("error putting a nested key: %v", err)
+	}
+	if _, err = os.Stat(root + "/dir/nested/key.depot"); err != nil {
+		t.Errorf("expected the entry to be kept in its own file: %v", err)
+	}
+	if err = b.Delete("dir/nested/key"); err != nil {
+		t.Fatalf("error deleting a nested key: %v", err)
+	}
+	if _, err = os.Stat(root + "/dir"); !os.IsNotExist(err) {
+		t.Errorf("expected empty directories to be removed but the error was %v", err)
+	}
+}
+
+func TestRedisBackend(t *testing.T) {
+	uri := os.Getenv("DEPOT_TEST_REDIS")
+	if uri == "" {
+		t.Skip("DEPOT_TEST_REDIS is not set")
+	}
+
+	b, err := NewRedisBackend(uri)
+	if err != nil {
+		t.Fatalf("failed to initialize backend: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	if _, err = b.Meta("salt"); err != nil {
+		t.Errorf("expected the backend to create a salt but the error was %v", err)
+	}
+	testBackend(t, b)
+}
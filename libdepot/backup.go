@@ -0,0 +1,279 @@
+package libdepot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Names of snapshots written by Backup begin with this
+	snapshotPrefix = "depot-"
+
+	// The timestamp in the name of a snapshot. Names sort in the order the
+	// snapshots were taken.
+	snapshotTime = "20060102T150405.000000Z"
+)
+
+// A Backend that can write a consistent copy of itself to a file while it is
+// in use
+type Snapshotter interface {
+	// Writes a copy of the backend to a new file at path
+	Snapshot(path string) error
+
+	// Returns the extension by which NewDepot recognizes the copy
+	SnapshotExt() string
+}
+
+// A copy of a depot written by Backup
+type Snapshot struct {
+	Path    string
+	Created time.Time
+}
+
+// Writes a copy of the depot to a new file at path, which can be opened with
+// NewDepot. A sqlite3 or bbolt depot is copied with the database's own means
+// and any other kind of depot is copied into a bbolt database. Returns an
+// error if unsuccessful.
+func (db *Depot) Snapshot(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("cannot write snapshot: %w", os.ErrExist)
+	}
+
+	// Write under a temporary name, so a snapshot cut short is never taken
+	// for a whole one
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	err := db.snapshot(tmp)
+	if err == nil {
+		err = os.Chmod(tmp, 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("cannot write snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func (db *Depot) snapshot(path string) error {
+	if s, ok := db.backend.(Snapshotter); ok {
+		return s.Snapshot(path)
+	}
+
+	b, err := NewBoltBackend(path)
+	if err != nil {
+		return err
+	}
+	if err = copyBackend(b, db.backend); err != nil {
+		b.Close()
+		return err
+	}
+
+	return b.Close()
+}
+
+// Returns the extension of the snapshots written by Snapshot
+func (db *Depot) snapshotExt() string {
+	if s, ok := db.backend.(Snapshotter); ok {
+		return s.SnapshotExt()
+	}
+
+	return ".bolt"
+}
+
+// Copies every entry, tombstones included, and the metadata a depot relies on,
+// attachments included, from src to dst. Returns an error if unsuccessful.
+func copyBackend(dst, src Backend) error {
+	entries, err := src.List("")
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err = dst.Put(e); err != nil {
+			return err
+		}
+	}
+
+	names := []string{"salt", "purged", namespacesMeta, attachmentsMeta}
+	data, err := src.Meta(attachmentsMeta)
+	if err == nil {
+		var attachments map[string]map[string]attachment
+		if err = json.Unmarshal(data, &attachments); err != nil {
+			return fmt.Errorf("cannot read attachments: %w", ErrCorrupted)
+		}
+		for _, byName := range attachments {
+			for _, a := range byName {
+				for i := 0; i < a.Chunks; i++ {
+					names = append(names, chunkMeta(a.ID, i))
+				}
+			}
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	for _, name := range names {
+		data, err := src.Meta(name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err = dst.SetMeta(name, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Writes a snapshot of the depot named for the current time into dir,
+// creating dir if it does not exist. Returns the new snapshot or an error if
+// unsuccessful.
+func (db *Depot) Backup(dir string) (Snapshot, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return Snapshot{}, fmt.Errorf("cannot create backup directory: %w", err)
+	}
+
+	now := time.Now().UTC()
+	s := Snapshot{
+		Path:    filepath.Join(dir, snapshotPrefix+now.Format(snapshotTime)+db.snapshotExt()),
+		Created: now,
+	}
+
+	return s, db.Snapshot(s.Path)
+}
+
+// Returns the snapshots written by Backup in dir, oldest first, or an error
+// if unsuccessful
+func Snapshots(dir string) ([]Snapshot, error) {
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read backup directory: %w", err)
+	}
+
+	var snapshots []Snapshot
+	for _, f := range files {
+		name := f.Name()
+		ext := filepath.Ext(name)
+		if f.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || (ext != ".db" && ext != ".bolt") {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), ext)
+		created, err := time.Parse(snapshotTime, stamp)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{filepath.Join(dir, name), created})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+
+	return snapshots, nil
+}
+
+// Removes all but the newest keep snapshots in dir, or none if keep is not
+// positive. Returns the number of snapshots removed or an error if
+// unsuccessful.
+func PruneSnapshots(dir string, keep int) (int, error) {
+	if keep <= 0 {
+		return 0, nil
+	}
+
+	snapshots, err := Snapshots(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for i := 0; i < len(snapshots)-keep; i++ {
+		if err = os.Remove(snapshots[i].Path); err != nil {
+			return removed, fmt.Errorf("cannot remove snapshot: %w", err)
+		}
+		// Opening a sqlite3 snapshot may have left its WAL files behind
+		os.Remove(snapshots[i].Path + "-wal")
+		os.Remove(snapshots[i].Path + "-shm")
+		removed++
+	}
+
+	return removed, nil
+}
+
+// Restores the keys matching pattern (see matchKey) from the snapshot at
+// path, as written by Snapshot, replacing their values in the depot. When
+// pattern is "" the whole depot is restored, so keys that were not in the
+// snapshot are dropped as well. Restored values are stamped with the current
+// time, so they win when the depot is next synced. Returns the number of keys
+// restored or dropped or an error if unsuccessful.
+func (db *Depot) Restore(path, pattern string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, fmt.Errorf("cannot read snapshot: %w", err)
+	}
+	snap, err := NewDepot(path)
+	if err != nil {
+		return 0, err
+	}
+	defer snap.Close()
+
+	entries, err := snap.matching(pattern)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	now := db.now()
+	restored := map[string]bool{}
+	for _, e := range entries {
+		restored[e.Key] = true
+		if e.Nonce != nil && e.Salt == nil {
+			e.Salt = snap.salt
+		}
+		if bytes.Equal(e.Salt, db.salt) {
+			e.Salt = nil
+		}
+
+		cur, err := db.backend.Get(e.Key)
+		if err == nil && sameEntry(cur, e) {
+			continue
+		} else if err != nil && !errors.Is(err, ErrNotFound) {
+			return n, fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+		e.Modified = now
+		if err = db.backend.Put(e); err != nil {
+			return n, fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+		n++
+	}
+	if pattern != "" {
+		return n, nil
+	}
+
+	live, err := db.matching("")
+	if err != nil {
+		return n, err
+	}
+	for _, e := range live {
+		if restored[e.Key] {
+			continue
+		}
+		if err = db.Drop(e.Key); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
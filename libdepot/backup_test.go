@@ -0,0 +1,129 @@
+package libdepot
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	password := []byte("password")
+
+	mdb, _ := NewMemDepot()
+	for _, d := range []*Depot{db, mdb} {
+		if err := d.Stow("backup/plain", "plain", nil); err != nil {
+			t.Fatalf("error stowing value: %v", err)
+		}
+		if err := d.Stow("backup/secret", "secret", password); err != nil {
+			t.Fatalf("error stowing value: %v", err)
+		}
+
+		s, err := d.Backup(dir)
+		if err != nil {
+			t.Fatalf("error backing up depot: %v", err)
+		}
+		copied, err := NewDepot(s.Path)
+		if err != nil {
+			t.Fatalf("failed to open snapshot %v: %v", s.Path, err)
+		}
+		if val, err := copied.Fetch("backup/plain", nil); err != nil || val != "plain" {
+			t.Errorf("expected plain in the snapshot but got %q (%v)", val, err)
+		}
+		if val, err := copied.Fetch("backup/secret", password); err != nil || val != "secret" {
+			t.Errorf("expected secret in the snapshot but got %q (%v)", val, err)
+		}
+		copied.Close()
+
+		if err = d.Snapshot(s.Path); err == nil {
+			t.Errorf("expected an error overwriting a snapshot")
+		}
+	}
+	if ext := filepath.Ext(mustSnapshots(t, dir)[1].Path); ext != ".bolt" {
+		t.Errorf("expected a memory depot to be copied to bolt but got %v", ext)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := mdb.Backup(dir); err != nil {
+			t.Fatalf("error backing up depot: %v", err)
+		}
+	}
+	newest := mustSnapshots(t, dir)[4]
+	if n, err := PruneSnapshots(dir, 2); err != nil || n != 3 {
+		t.Errorf("expected 3 snapshots to be pruned but got %v (%v)", n, err)
+	}
+	if kept := mustSnapshots(t, dir); len(kept) != 2 || kept[1] != newest {
+		t.Errorf("expected the newest 2 snapshots to be kept but got %v", kept)
+	}
+	if n, _ := PruneSnapshots(dir, 0); n != 0 {
+		t.Errorf("expected no snapshots to be pruned without a limit but %v were", n)
+	}
+}
+
+// Returns the snapshots in dir, failing the test if it is unsuccessful
+func mustSnapshots(t *testing.T, dir string) []Snapshot {
+	t.Helper()
+
+	snapshots, err := Snapshots(dir)
+	if err != nil {
+		t.Fatalf("error listing snapshots: %v", err)
+	}
+
+	return snapshots
+}
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	password := []byte("password")
+
+	mdb, _ := NewMemDepot()
+	mdb.Stow("restore/a", "a", nil)
+	mdb.Stow("restore/b", "b", password)
+	mdb.Stow("other", "other", nil)
+	s, err := mdb.Backup(dir)
+	if err != nil {
+		t.Fatalf("error backing up depot: %v", err)
+	}
+
+	mdb.Stow("restore/a", "changed", nil)
+	mdb.Drop("restore/b")
+	mdb.Drop("other")
+	mdb.Stow("new", "new", nil)
+
+	// Only the keys matching the pattern come back
+	if n, err := mdb.Restore(s.Path, "restore/*"); err != nil || n != 2 {
+		t.Errorf("expected 2 keys to be restored but got %v (%v)", n, err)
+	}
+	if val, _ := mdb.Fetch("restore/a", nil); val != "a" {
+		t.Errorf("expected restore/a to be restored but got %q", val)
+	}
+	if val, err := mdb.Fetch("restore/b", password); err != nil || val != "b" {
+		t.Errorf("expected restore/b to be restored but got %q (%v)", val, err)
+	}
+	if _, err = mdb.Fetch("other", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected other to stay dropped but got %v", err)
+	}
+
+	// The whole depot is restored to the snapshot
+	if n, err := mdb.Restore(s.Path, ""); err != nil || n != 2 {
+		t.Errorf("expected other and new to be restored but got %v (%v)", n, err)
+	}
+	if val, _ := mdb.Fetch("other", nil); val != "other" {
+		t.Errorf("expected other to be restored but got %q", val)
+	}
+	if _, err = mdb.Fetch("new", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected new to be dropped but got %v", err)
+	}
+
+	// A snapshot of another depot keeps its own salt
+	if n, err := db.Restore(s.Path, "restore/b"); err != nil || n != 1 {
+		t.Errorf("expected restore/b to be restored but got %v (%v)", n, err)
+	}
+	if val, err := db.Fetch("restore/b", password); err != nil || val != "b" {
+		t.Errorf("expected restore/b to be restored but got %q (%v)", val, err)
+	}
+
+	if _, err = mdb.Restore(filepath.Join(dir, "missing.db"), ""); err == nil {
+		t.Errorf("expected an error restoring a missing snapshot")
+	}
+}
@@ -0,0 +1,199 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// A Backend that can store several entries in one transaction
+type Batcher interface {
+	// Stores the entries as Put would, either all of them or, if it fails,
+	// none of them
+	PutAll(entries []*Entry) error
+}
+
+// Stores each key in vals with its value, as Stow would, but deriving the
+// encryption key from password only once for each namespace (see
+// CreateNamespace). A weak password is reported once, for the first key in
+// order. When the backend is a Batcher the values are stored in one
+// transaction, so that either all of them are stored or none are; otherwise
+// they are stored in order until one fails. Returns an error if
+// unsuccessful.
+func (db *Depot) StowAll(vals map[string]string, password []byte) error {
+	if len(vals) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(vals))
+	for key := range vals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if password != nil {
+		if err := db.checkStrength(keys[0], password); err != nil {
+			return err
+		}
+	}
+	deriver := db.keyDeriver(password)
+	entries := make([]*Entry, len(keys))
+	for i, key := range keys {
+		target, err := db.checkKey(key)
+		if err != nil {
+			return err
+		}
+		target, err = db.resolve(target)
+		if err != nil {
+			return err
+		}
+		var encryptionKey, salt []byte
+		if password != nil {
+			if encryptionKey, salt, err = deriver.derive(target); err != nil {
+				return err
+			}
+		}
+		if entries[i], err = db.newEntry(target, vals[key], encryptionKey, salt); err != nil {
+			return err
+		}
+	}
+
+	return db.putAll(entries)
+}
+
+// Drops every key matching pattern (see matchKey), and every alias whose
+// name matches it, as Drop would, in one transaction when the backend is a
+// Batcher. An empty pattern is refused, rather than dropping everything.
+// Returns the keys and aliases dropped, sorted, or an error if unsuccessful.
+func (db *Depot) DropMatching(pattern string) (dropped []string, err error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("%w: empty pattern", ErrInvalidKey)
+	}
+	err = db.locked(func() error {
+		dropped, err = db.dropMatching(pattern)
+		return err
+	})
+
+	return dropped, err
+}
+
+func (db *Depot) dropMatching(pattern string) ([]string, error) {
+	entries, err := db.matching(pattern)
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := db.Aliases()
+	if err != nil {
+		return nil, err
+	}
+
+	var matchedAliases []string
+	for alias := range aliases {
+		if matchKey(pattern, alias) {
+			matchedAliases = append(matchedAliases, alias)
+		}
+	}
+
+	return db.dropEntries(entries, matchedAliases, aliases)
+}
+
+// Drops each of keys, and each alias among them, as Drop would, in one
+// transaction when the backend is a Batcher, so that only the keys given go,
+// such as those a user was shown before agreeing to drop them. Keys that do
+// not exist are skipped. Returns the keys and aliases dropped, sorted, or an
+// error if unsuccessful.
+func (db *Depot) DropAll(keys []string) (dropped []string, err error) {
+	err = db.locked(func() error {
+		dropped, err = db.dropAll(keys)
+		return err
+	})
+
+	return dropped, err
+}
+
+func (db *Depot) dropAll(keys []string) ([]string, error) {
+	aliases, err := db.Aliases()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	var givenAliases []string
+	for _, key := range keys {
+		key = db.normalizeKey(key)
+		e, err := db.backend.Get(key)
+		if err == nil && !e.Deleted {
+			entries = append(entries, e)
+		} else if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+		if _, ok := aliases[key]; ok {
+			givenAliases = append(givenAliases, key)
+		}
+	}
+
+	return db.dropEntries(entries, givenAliases, aliases)
+}
+
+// Leaves tombstones in place of the entries and removes the named aliases
+// from aliases, which holds every alias. Returns the keys and aliases
+// dropped, sorted, or an error if unsuccessful.
+func (db *Depot) dropEntries(entries []*Entry, names []string, aliases map[string]string) ([]string, error) {
+	var dropped []string
+	now := db.now()
+	tombstones := make([]*Entry, len(entries))
+	for i, e := range entries {
+		tombstone := *e
+		tombstone.Modified = now
+		tombstone.Deleted = true
+		tombstones[i] = &tombstone
+		dropped = append(dropped, e.Key)
+	}
+	if err := db.putAll(tombstones); err != nil {
+		return nil, err
+	}
+
+	if len(names) > 0 {
+		for _, alias := range names {
+			delete(aliases, alias)
+		}
+		if err := db.setAliases(aliases); err != nil {
+			return nil, err
+		}
+	}
+	for _, alias := range names {
+		db.audit(AuditDrop, alias, nil)
+	}
+	dropped = append(dropped, names...)
+	sort.Strings(dropped)
+
+	return dropped, db.purgeExpired()
+}
+
+// Stores the entries, in one transaction if the backend is a Batcher and
+// otherwise in order until one fails, and audits each of them as stowed, or
+// as dropped if it is a tombstone. Returns an error if unsuccessful.
+func (db *Depot) putAll(entries []*Entry) error {
+	b, ok := db.backend.(Batcher)
+	if !ok {
+		for _, e := range entries {
+			err := db.backend.Put(e)
+			if err != nil {
+				err = fmt.Errorf("%w: %w", ErrDatabase, err)
+			}
+			if err = db.auditPut(e, err); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := b.PutAll(entries)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	for _, e := range entries {
+		db.auditPut(e, err)
+	}
+
+	return err
+}
@@ -0,0 +1,113 @@
+package libdepot
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// A Backend that hides whether the one it wraps is a Batcher
+type unbatched struct {
+	Backend
+}
+
+func TestStowAll(t *testing.T) {
+	password := []byte("password")
+	vals := map[string]string{"batch/a": "a", "batch/b": "b", "batch/c": "c"}
+
+	mem, _ := NewMemDepot()
+	plain, _ := NewDepotWithBackend(unbatched{NewMemBackend()})
+	for name, d := range map[string]*Depot{"sqlite3": db, "memory": mem, "unbatched": plain} {
+		if err := d.StowAll(vals, password); err != nil {
+			t.Fatalf("%v: error stowing a batch: %v", name, err)
+		}
+		for key, want := range vals {
+			if val, err := d.Fetch(key, password); err != nil || val != want {
+				t.Errorf("%v: expected %v to decrypt to %v but got %q (%v)", name, key, want, val, err)
+			}
+		}
+		if err := d.StowAll(map[string]string{"batch/a": "plain"}, nil); err != nil {
+			t.Fatalf("%v: error stowing a plain batch: %v", name, err)
+		}
+		if val, err := d.Fetch("batch/a", nil); err != nil || val != "plain" {
+			t.Errorf("%v: expected batch/a to be replaced with plain but got %q (%v)", name, val, err)
+		}
+	}
+
+	weak, _ := NewMemDepot(WithWeakPasswordFunc(func(key string, entropy float64) error {
+		return ErrWeakPassword
+	}))
+	if err := weak.StowAll(vals, []byte("1234")); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("expected %v stowing a batch with a weak password but got %v", ErrWeakPassword, err)
+	}
+	if keys, _ := weak.List(""); len(keys) != 0 {
+		t.Errorf("expected nothing to be stowed with a weak password but found %v keys", len(keys))
+	}
+}
+
+func TestDropMatching(t *testing.T) {
+	vals := map[string]string{"staging/a": "a", "staging/b": "b", "prod/a": "a"}
+	mem, _ := NewMemDepot()
+	plain, _ := NewDepotWithBackend(unbatched{NewMemBackend()})
+	for name, d := range map[string]*Depot{"memory": mem, "unbatched": plain} {
+		if err := d.StowAll(vals, nil); err != nil {
+			t.Fatalf("%v: error stowing a batch: %v", name, err)
+		}
+		if err := d.Alias("staging/c", "prod/a", false); err != nil {
+			t.Fatalf("%v: error adding alias: %v", name, err)
+		}
+
+		if _, err := d.DropMatching(""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%v: expected %v dropping everything but got %v", name, ErrInvalidKey, err)
+		}
+		dropped, err := d.DropMatching("staging/*")
+		if err != nil || !slices.Equal(dropped, []string{"staging/a", "staging/b", "staging/c"}) {
+			t.Errorf("%v: expected staging/a, b, and c to be dropped but got %v (%v)", name, dropped, err)
+		}
+		if keys, _ := d.List(""); len(keys) != 1 || keys[0].Key != "prod/a" {
+			t.Errorf("%v: expected only prod/a to be left but got %v", name, keys)
+		}
+		if trash, _ := d.Trash("staging/*"); len(trash) != 2 {
+			t.Errorf("%v: expected the dropped values to be in the trash but got %v", name, trash)
+		}
+	}
+}
+
+func TestDropAll(t *testing.T) {
+	mdb, _ := NewMemDepot()
+	mdb.StowAll(map[string]string{"staging/a": "a", "staging/b": "b", "prod/a": "a"}, nil)
+	mdb.Alias("staging/c", "prod/a", false)
+
+	// Only the keys given go, even if others match the same pattern
+	dropped, err := mdb.DropAll([]string{"staging/a", "staging/c", "staging/missing"})
+	if err != nil || !slices.Equal(dropped, []string{"staging/a", "staging/c"}) {
+		t.Errorf("expected staging/a and c to be dropped but got %v (%v)", dropped, err)
+	}
+	keys, _ := mdb.List("")
+	if len(keys) != 2 || keys[0].Key != "prod/a" || keys[1].Key != "staging/b" {
+		t.Errorf("expected prod/a and staging/b to be left but got %v", keys)
+	}
+	if trash, _ := mdb.Trash("staging/*"); len(trash) != 1 {
+		t.Errorf("expected the dropped value to be in the trash but got %v", trash)
+	}
+}
+
+func TestPutAllRollback(t *testing.T) {
+	b, err := NewSQLiteBackend(t.TempDir() + "/batch.db")
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	// sqlite3 won't store a nonce twice, so the second entry fails
+	err = b.(Batcher).PutAll([]*Entry{
+		{Key: "batch/a", Val: "a", Nonce: []byte("nonce")},
+		{Key: "batch/b", Val: "b", Nonce: []byte("nonce")},
+	})
+	if err == nil {
+		t.Fatalf("expected an error putting the same nonce twice")
+	}
+	if _, err = b.Get("batch/a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the first entry to be rolled back but the error was %v", err)
+	}
+}
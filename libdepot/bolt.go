@@ -0,0 +1,313 @@
+package libdepot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltStorage = []byte("storage")
+	boltMeta    = []byte("meta")
+	boltAudit   = []byte("audit")
+)
+
+// A Backend that keeps entries in a bbolt database. Unlike sqlite it is pure
+// Go, so depot can be built without cgo.
+type boltBackend struct {
+	// Held for writing only while Compact swaps in a new database
+	mu sync.RWMutex
+	db *bolt.DB
+}
+
+// Returns a Backend stored in the bbolt database at path, creating the
+// database if it does not exist, or an error if initialization is
+// unsuccessful. A bbolt database can be open in one process at a time, so
+// while another has it open this waits for up to LockTimeout before giving up
+// with ErrBusy.
+func NewBoltBackend(path string) (Backend, error) {
+	conn, err := bolt.Open(path, 0600, &bolt.Options{Timeout: LockTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("cannot connect to database: %w", ErrBusy)
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot connect to database: %w", err)
+	}
+
+	err = conn.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltStorage, boltMeta, boltAudit} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return &boltBackend{db: conn}, nil
+}
+
+func (b *boltBackend) Get(key string) (*Entry, error) {
+	var e Entry
+	err := b.view(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltStorage).Get([]byte(key))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &e)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (b *boltBackend) Put(e *Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return b.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltStorage).Put([]byte(e.Key), data)
+	})
+}
+
+func (b *boltBackend) Increment(key string, delta int64, modified time.Time) (int64, error) {
+	var n int64
+	err := b.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltStorage)
+		e := Entry{Key: key, Deleted: true}
+		if data := bucket.Get([]byte(key)); data != nil {
+			e = Entry{}
+			if err := json.Unmarshal(data, &e); err != nil {
+				return err
+			}
+		}
+		var err error
+		if n, err = addToCounter(&e, delta); err != nil {
+			return err
+		}
+		data, err := json.Marshal(counterEntry(key, n, modified))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), data)
+	})
+
+	return n, err
+}
+
+func (b *boltBackend) PutAll(entries []*Entry) error {
+	return b.update(func(tx *bolt.Tx) error {
+		for _, e := range entries {
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			if err = tx.Bucket(boltStorage).Put([]byte(e.Key), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltBackend) Delete(key string) error {
+	return b.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltStorage).Delete([]byte(key))
+	})
+}
+
+func (b *boltBackend) List(prefix string) ([]*Entry, error) {
+	var entries []*Entry
+	err := b.view(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltStorage).Cursor()
+		p := []byte(prefix)
+		for k, data := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, data = c.Next() {
+			var e Entry
+			if err := json.Unmarshal(data, &e); err != nil {
+				return err
+			}
+			entries = append(entries, &e)
+		}
+		return nil
+	})
+
+	return entries, err
+}
+
+func (b *boltBackend) Meta(name string) ([]byte, error) {
+	var data []byte
+	err := b.view(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltMeta).Get([]byte(name))
+		if v == nil {
+			return ErrNotFound
+		}
+		// Values are only valid for the life of the transaction
+		data = bytes.Clone(v)
+		return nil
+	})
+
+	return data, err
+}
+
+func (b *boltBackend) SetMeta(name string, data []byte) error {
+	return b.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltMeta).Put([]byte(name), data)
+	})
+}
+
+func (b *boltBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.db.Close()
+}
+
+// Runs fn in a read-only transaction
+func (b *boltBackend) view(fn func(tx *bolt.Tx) error) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.db.View(fn)
+}
+
+// Runs fn in a read-write transaction
+func (b *boltBackend) update(fn func(tx *bolt.Tx) error) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.db.Update(fn)
+}
+
+// bbolt never shrinks its file, so the database is copied into a new one,
+// which then takes its place
+func (b *boltBackend) Compact() (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	path := b.db.Path()
+	before, err := filesSize(path)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp := path + ".compact"
+	os.Remove(tmp)
+	dst, err := bolt.Open(tmp, 0600, nil)
+	if err != nil {
+		return 0, err
+	}
+	err = bolt.Compact(dst, b.db, 0)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+
+	if err = b.db.Close(); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	renameErr := os.Rename(tmp, path)
+	if renameErr != nil {
+		os.Remove(tmp)
+	}
+	// Whether or not the compacted copy took its place, the database must be
+	// opened again
+	if b.db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: LockTimeout}); err != nil {
+		return 0, err
+	} else if renameErr != nil {
+		return 0, renameErr
+	}
+
+	after, err := filesSize(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return before - after, nil
+}
+
+// Copies the database to path within a read transaction, so the copy is
+// consistent even while the database is being written to
+func (b *boltBackend) Snapshot(path string) error {
+	return b.view(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+}
+
+func (b *boltBackend) SnapshotExt() string {
+	return ".bolt"
+}
+
+func (b *boltBackend) Files() ([]string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return []string{b.db.Path()}, nil
+}
+
+func (b *boltBackend) Size() (int64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return filesSize(b.db.Path())
+}
+
+// Events are kept under sequence numbers, so the log only ever grows at the
+// end
+func (b *boltBackend) AppendAudit(e *AuditEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return b.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltAudit)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		return bucket.Put(binary.BigEndian.AppendUint64(nil, seq), data)
+	})
+}
+
+func (b *boltBackend) AuditLog(since time.Time) ([]*AuditEvent, error) {
+	var events []*AuditEvent
+	err := b.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltAudit).ForEach(func(_, data []byte) error {
+			var e AuditEvent
+			if err := json.Unmarshal(data, &e); err != nil {
+				return err
+			}
+			if !e.Time.Before(since) {
+				events = append(events, &e)
+			}
+			return nil
+		})
+	})
+
+	return events, err
+}
+
+// Returns the problems bbolt's consistency check finds
+func (b *boltBackend) CheckIntegrity() ([]string, error) {
+	var problems []string
+	err := b.view(func(tx *bolt.Tx) error {
+		for err := range tx.Check() {
+			problems = append(problems, err.Error())
+		}
+		return nil
+	})
+
+	return problems, err
+}
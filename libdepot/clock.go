@@ -0,0 +1,49 @@
+package libdepot
+
+import (
+	"crypto/rand"
+	"io"
+	"time"
+)
+
+// Returns an Option that reads the randomness a depot needs, for the nonces
+// of encrypted values (see AESGCM) and archives and the salts of new depots,
+// namespaces, and archives, from r rather than crypto/rand, so that tests
+// can stow values the same way every time and compare what is stored with
+// golden files. A Sealer given with WithSealer brings its own randomness. r
+// must be a cryptographically secure source for a depot that holds real
+// secrets, since a nonce that is used twice gives away what it encrypted.
+func WithRand(r io.Reader) Option {
+	return func(db *Depot) {
+		db.rand = r
+	}
+}
+
+// Returns an Option that takes the time from now rather than time.Now when
+// values are stowed, copied, renamed, dropped, and restored, when events are
+// audited, and when deciding which values are stale (see Stale) and which
+// have been in the trash or left as tombstones long enough to go, so that
+// tests can control what a depot takes to be the current time
+func WithClock(now func() time.Time) Option {
+	return func(db *Depot) {
+		db.clock = now
+	}
+}
+
+// Returns the source of randomness given to WithRand, or crypto/rand's
+func (db *Depot) random() io.Reader {
+	if db.rand == nil {
+		return rand.Reader
+	}
+
+	return db.rand
+}
+
+// Returns the current time according to the clock given to WithClock
+func (db *Depot) now() time.Time {
+	if db.clock == nil {
+		return time.Now()
+	}
+
+	return db.clock()
+}
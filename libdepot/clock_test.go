@@ -0,0 +1,50 @@
+package libdepot
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRandAndClock(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	open := func() *Depot {
+		mdb, err := NewMemDepot(WithRand(rand.NewChaCha8([32]byte{})), WithClock(clock))
+		if err != nil {
+			t.Fatalf("failed to initialize depot: %v", err)
+		}
+		if err = mdb.Stow("db/password", "hunter2", []byte("password")); err != nil {
+			t.Fatalf("error stowing: %v", err)
+		}
+		return mdb
+	}
+
+	// The same randomness and time store the same value the same way
+	a, b := open(), open()
+	if !bytes.Equal(a.salt, b.salt) {
+		t.Errorf("expected the same salt from the same randomness")
+	}
+	ea, _ := a.backend.Get("db/password")
+	eb, _ := b.backend.Get("db/password")
+	if !reflect.DeepEqual(ea, eb) {
+		t.Errorf("expected identical entries but got %+v and %+v", ea, eb)
+	}
+	if !ea.Modified.Equal(now) {
+		t.Errorf("expected the entry to be modified at %v but got %v", now, ea.Modified)
+	}
+	if val, err := a.Fetch("db/password", []byte("password")); err != nil || val != "hunter2" {
+		t.Errorf("expected hunter2 but got %q (%v)", val, err)
+	}
+
+	// Time moves only when the clock does
+	if stale, err := a.Stale("", 24*time.Hour); err != nil || len(stale) != 0 {
+		t.Errorf("expected nothing stale yet but got %v (%v)", stale, err)
+	}
+	now = now.Add(48 * time.Hour)
+	if stale, err := a.Stale("", 24*time.Hour); err != nil || len(stale) != 1 {
+		t.Errorf("expected db/password to be stale but got %v (%v)", stale, err)
+	}
+}
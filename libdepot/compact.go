@@ -0,0 +1,65 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// A Backend whose storage keeps the space freed by replaced and deleted
+// entries until it is compacted
+type Compactor interface {
+	// Rebuilds the storage without its unused space and returns the number
+	// of bytes reclaimed
+	Compact() (int64, error)
+}
+
+// Empties the trash of expired values (see TrashLifetime), purges expired
+// tombstones (see TombstoneLifetime), and gives the space they and any
+// replaced values took up back to the filesystem, which the database
+// would otherwise hold on to for good. Returns the number of bytes reclaimed
+// or an error if unsuccessful, including when the backend cannot be
+// compacted.
+func (db *Depot) Compact() (int64, error) {
+	c, ok := db.backend.(Compactor)
+	if !ok {
+		return 0, fmt.Errorf("depot cannot be compacted: %w", errors.ErrUnsupported)
+	}
+
+	err := db.locked(func() error {
+		if err := db.expireTrash(db.now().Add(-TrashLifetime)); err != nil {
+			return err
+		}
+		_, err := db.purgeTombstones(db.now().Add(-TombstoneLifetime))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	reclaimed, err := c.Compact()
+	if err != nil {
+		return 0, fmt.Errorf("cannot compact database: %w", err)
+	}
+
+	db.log().Info("compacted database", slog.Int64("reclaimed", reclaimed))
+
+	return reclaimed, nil
+}
+
+// Returns the combined size of the files at the given paths, counting those
+// that do not exist as empty, or an error if unsuccessful
+func filesSize(paths ...string) (int64, error) {
+	var size int64
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		size += info.Size()
+	}
+
+	return size, nil
+}
@@ -0,0 +1,68 @@
+package libdepot
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Fills the depot with values, drops them, and checks that compacting it
+// gives the space back and keeps what was left
+func testCompact(t *testing.T, d *Depot) {
+	t.Helper()
+
+	val := make([]byte, 4096)
+	for i := 0; i < 100; i++ {
+		rand.Read(val)
+		key := fmt.Sprintf("compact/%v", i)
+		if err := d.Stow(key, string(val), nil); err != nil {
+			t.Fatalf("error stowing %v: %v", key, err)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("compact/%v", i)
+		if err := d.Drop(key); err != nil {
+			t.Fatalf("error dropping %v: %v", key, err)
+		}
+	}
+	if _, err := d.EmptyTrash(""); err != nil {
+		t.Fatalf("error emptying the trash: %v", err)
+	}
+	d.Stow("kept", "kept", nil)
+	expired := Entry{Key: "expired", Modified: time.Now().Add(-TombstoneLifetime - time.Hour), Deleted: true}
+	d.backend.Put(&expired)
+
+	reclaimed, err := d.Compact()
+	if err != nil {
+		t.Fatalf("error compacting depot: %v", err)
+	}
+	if reclaimed < 100*4096/2 {
+		t.Errorf("expected the dropped values to be reclaimed but got %v bytes", reclaimed)
+	}
+	if val, err := d.Fetch("kept", nil); err != nil || val != "kept" {
+		t.Errorf("expected kept to survive compaction but got %q (%v)", val, err)
+	}
+	if _, err = d.backend.Get("expired"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected an expired tombstone to be purged but got %v", err)
+	}
+	if _, err = d.backend.Get("compact/0"); err != nil {
+		t.Errorf("expected a recent tombstone to be kept but got %v", err)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	d, err := NewDepot(filepath.Join(t.TempDir(), "compact.bolt"))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	testCompact(t, d)
+
+	mdb, _ := NewMemDepot()
+	if _, err = mdb.Compact(); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("expected a memory depot not to be compacted but got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package libdepot
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Methods by which the value of an Entry may be compressed
+const (
+	CompressionNone = ""
+	CompressionZstd = "zstd"
+)
+
+// Values at least this many bytes long are compressed unless told otherwise.
+// Shorter values, such as passwords and tokens, rarely shrink enough to be
+// worth it.
+const DefaultCompressionThreshold = 1024
+
+// The largest value decompress will produce, so a corrupted entry cannot
+// exhaust memory
+const maxDecompressedSize = 64 << 20
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+// Returns an Option that compresses values at least n bytes long before they
+// are encrypted and stored, or none at all if n is not positive. Values are
+// only ever stored compressed when that makes them smaller.
+func WithCompressionThreshold(n int) Option {
+	return func(db *Depot) {
+		db.compressThreshold = n
+	}
+}
+
+// Sets up the shared zstd encoder and decoder, which are safe for concurrent
+// use. Returns an error if unsuccessful.
+func initZstd() error {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+		if zstdErr == nil {
+			zstdDecoder, zstdErr = zstd.NewReader(nil,
+				zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(maxDecompressedSize))
+		}
+	})
+
+	return zstdErr
+}
+
+// Returns data compressed and the method used, or data as it is and
+// CompressionNone if the depot would not compress it or compressing would not
+// make it smaller
+func (db *Depot) compress(data []byte) ([]byte, string) {
+	if db.compressThreshold <= 0 || len(data) < db.compressThreshold || initZstd() != nil {
+		return data, CompressionNone
+	}
+
+	compressed := zstdEncoder.EncodeAll(data, nil)
+	if len(compressed) >= len(data) {
+		return data, CompressionNone
+	}
+
+	return compressed, CompressionZstd
+}
+
+// Returns data decompressed by the given method or an error if unsuccessful
+func decompress(method string, data []byte) ([]byte, error) {
+	switch method {
+	case CompressionNone:
+		return data, nil
+	case CompressionZstd:
+		if err := initZstd(); err != nil {
+			return nil, fmt.Errorf("cannot decompress data: %w", err)
+		}
+		plain, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decompress data: %w", ErrCorrupted)
+		}
+		return plain, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q: %w", method, ErrCorrupted)
+	}
+}
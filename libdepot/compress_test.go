@@ -0,0 +1,64 @@
+package libdepot
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	password := []byte("password")
+	large := strings.Repeat(`{"name": "depot", "kind": "config"}`, 100)
+
+	mdb, _ := NewMemDepot()
+	mdb.Stow("plain", large, nil)
+	mdb.Stow("secret", large, password)
+	mdb.Stow("small", "small value", nil)
+
+	for _, key := range []string{"plain", "secret"} {
+		e, err := mdb.backend.Get(key)
+		if err != nil {
+			t.Fatalf("error getting %v: %v", key, err)
+		}
+		if e.Compression != CompressionZstd || len(e.Val) >= len(large) {
+			t.Errorf("expected %v to be stored compressed but got %v bytes (%q)", key, len(e.Val), e.Compression)
+		}
+	}
+	if val, err := mdb.Fetch("plain", nil); err != nil || val != large {
+		t.Errorf("expected plain to round trip but got %v bytes (%v)", len(val), err)
+	}
+	if val, err := mdb.Fetch("secret", password); err != nil || val != large {
+		t.Errorf("expected secret to round trip but got %v bytes (%v)", len(val), err)
+	}
+	if _, err := mdb.Fetch("secret", []byte("wrong")); !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected a bad password but got %v", err)
+	}
+
+	if e, _ := mdb.backend.Get("small"); e.Compression != CompressionNone || e.Val != "small value" {
+		t.Errorf("expected a small value to be stored as it is but got %+v", e)
+	}
+
+	// Random data does not shrink, so it is stored as it is
+	data := make([]byte, 4096)
+	rand.Read(data)
+	random := string(data)
+	mdb.Stow("random", random, nil)
+	if e, _ := mdb.backend.Get("random"); e.Compression != CompressionNone || e.Val != random {
+		t.Errorf("expected incompressible data to be stored as it is but got %q", e.Compression)
+	}
+
+	off, _ := NewMemDepot(WithCompressionThreshold(0))
+	off.Stow("plain", large, nil)
+	if e, _ := off.backend.Get("plain"); e.Compression != CompressionNone || e.Val != large {
+		t.Errorf("expected no compression when disabled but got %q", e.Compression)
+	}
+
+	// Corrupted compressed data is reported as such
+	e, _ := mdb.backend.Get("plain")
+	e.Val = b64.EncodeToString([]byte("not zstd"))
+	mdb.backend.Put(e)
+	if _, err := mdb.Fetch("plain", nil); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected corrupted data but got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// The value is not a counter (see Increment)
+var ErrNotNumber = errors.New("value is not a whole number")
+
+// A Backend that adds to counters in a single step, so that no other change
+// can come between reading a counter and writing it
+type Incrementer interface {
+	// Adds delta to the value of key, a whole number in plain text, and
+	// returns the sum, which is stored modified at modified. A key that does
+	// not exist, or is a tombstone, is stored with delta as its value.
+	// Returns ErrNotNumber if the value is not a whole number or is not in
+	// plain text, ErrTooLarge if the sum would not fit in an int64, or
+	// another error if unsuccessful.
+	Increment(key string, delta int64, modified time.Time) (int64, error)
+}
+
+// Adds delta, which may be negative, to the counter stored under key, or
+// under the key it is an alias of, and returns the new count. A counter is a
+// plain value that is a whole number, as stowed by Stow with a nil password
+// or by Increment itself, which starts a key that does not exist at delta.
+// With a backend that is an Incrementer, such as sqlite3 or PostgreSQL, this
+// is a single statement, so that processes counting at once never lose each
+// other's counts. Returns ErrNotNumber if the value is not a counter,
+// ErrTooLarge if the count would overflow, or another error if unsuccessful.
+func (db *Depot) Increment(key string, delta int64) (n int64, err error) {
+	traced, end := db.trace("Increment", key)
+	defer func() { end(err) }()
+
+	n, err = traced.increment(key, delta)
+	if err = db.auditOp(OpIncrement, AuditStow, key, err); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (db *Depot) increment(key string, delta int64) (int64, error) {
+	// Pre-stow hooks must see the count before it is stored, so it is read
+	// and written in separate steps for them, under the lock
+	i, ok := db.backend.(Incrementer)
+	if !ok || len(db.preStow) > 0 {
+		var n int64
+		err := db.locked(func() (err error) {
+			n, err = db.incrementLocked(key, delta)
+			return err
+		})
+		return n, err
+	}
+
+	key, err := db.checkKey(key)
+	if err != nil {
+		return 0, err
+	}
+	if key, err = db.resolve(key); err != nil {
+		return 0, err
+	}
+	n, err := i.Increment(key, delta, db.now())
+	if err != nil && !errors.Is(err, ErrNotNumber) && !errors.Is(err, ErrTooLarge) {
+		return 0, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return n, err
+}
+
+// Increments the counter as Increment does by reading and then writing it,
+// which must be done holding the lock
+func (db *Depot) incrementLocked(key string, delta int64) (int64, error) {
+	key, err := db.checkKey(key)
+	if err != nil {
+		return 0, err
+	}
+	if key, err = db.resolve(key); err != nil {
+		return 0, err
+	}
+	entry, err := db.backend.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		entry = &Entry{Key: key, Deleted: true}
+	} else if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	n, err := addToCounter(entry, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, db.putChecked(counterEntry(key, n, db.now()))
+}
+
+// Returns the count of the counter stored in e, or 0 if e is a tombstone,
+// plus delta, or ErrNotNumber if e is not a counter, or ErrTooLarge if the
+// sum would overflow
+func addToCounter(e *Entry, delta int64) (int64, error) {
+	var n int64
+	if !e.Deleted {
+		var err error
+		n, err = strconv.ParseInt(e.Val, 10, 64)
+		// Only the numbers Increment writes are counters, and not, say, +1
+		if e.Nonce != nil || e.Compression != CompressionNone || err != nil || strconv.FormatInt(n, 10) != e.Val {
+			return 0, ErrNotNumber
+		}
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, fmt.Errorf("%w: the count would overflow", ErrTooLarge)
+	}
+
+	return n + delta, nil
+}
+
+// Returns the entry that holds the count n of the counter key
+func counterEntry(key string, n int64, modified time.Time) *Entry {
+	return &Entry{Key: key, Val: strconv.FormatInt(n, 10), Modified: modified}
+}
+
+// Returns why delta could not be added to the counter stored under key in
+// b, by a statement that added nothing because it was not a counter or would
+// overflow
+func incrementError(b Backend, key string, delta int64) error {
+	e, err := b.Get(key)
+	if err != nil {
+		return err
+	}
+	if _, err = addToCounter(e, delta); err != nil {
+		return err
+	}
+
+	return ErrNotNumber
+}
@@ -0,0 +1,70 @@
+package libdepot
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// A Backend that hides whether the one it wraps is an Incrementer
+type unincremented struct {
+	Backend
+}
+
+func TestIncrement(t *testing.T) {
+	mem, _ := NewMemDepot()
+	plain, _ := NewDepotWithBackend(unincremented{NewMemBackend()})
+	bolt, err := NewDepot(filepath.Join(t.TempDir(), "counter.bolt"))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { bolt.Close() })
+
+	for name, d := range map[string]*Depot{"sqlite3": db, "memory": mem, "bbolt": bolt, "unincremented": plain} {
+		d.Drop("counter/a")
+		if n, err := d.Increment("counter/a", 5); err != nil || n != 5 {
+			t.Errorf("%v: expected a new counter to start at 5 but got %v (%v)", name, n, err)
+		}
+		if n, err := d.Increment("counter/a", -7); err != nil || n != -2 {
+			t.Errorf("%v: expected -2 but got %v (%v)", name, n, err)
+		}
+		d.Alias("counter/alias", "counter/a", true)
+		if n, err := d.Increment("counter/alias", 3); err != nil || n != 1 {
+			t.Errorf("%v: expected 1 counting through an alias but got %v (%v)", name, n, err)
+		}
+		if val, err := d.Fetch("counter/a", nil); err != nil || val != "1" {
+			t.Errorf("%v: expected the count to be fetched as 1 but got %q (%v)", name, val, err)
+		}
+
+		d.Drop("counter/a")
+		if n, err := d.Increment("counter/a", 1); err != nil || n != 1 {
+			t.Errorf("%v: expected a dropped counter to start over but got %v (%v)", name, n, err)
+		}
+
+		d.Stow("counter/max", "9223372036854775806", nil)
+		if n, err := d.Increment("counter/max", 1); err != nil || n != math.MaxInt64 {
+			t.Errorf("%v: expected %v but got %v (%v)", name, int64(math.MaxInt64), n, err)
+		}
+		if _, err := d.Increment("counter/max", 1); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%v: expected %v on overflow but got %v", name, ErrTooLarge, err)
+		}
+		d.Stow("counter/min", "-9223372036854775807", nil)
+		if _, err := d.Increment("counter/min", -2); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%v: expected %v on underflow but got %v", name, ErrTooLarge, err)
+		}
+
+		d.Stow("counter/secret", "1", []byte("password"))
+		for key, val := range map[string]string{"counter/word": "one", "counter/plus": "+1", "counter/zeros": "01"} {
+			d.Stow(key, val, nil)
+		}
+		for _, key := range []string{"counter/secret", "counter/word", "counter/plus", "counter/zeros"} {
+			if _, err := d.Increment(key, 1); !errors.Is(err, ErrNotNumber) {
+				t.Errorf("%v: expected %v incrementing %v but got %v", name, ErrNotNumber, key, err)
+			}
+		}
+		if val, _ := d.Fetch("counter/word", nil); val != "one" {
+			t.Errorf("%v: expected a value that is not a counter to be left as it was but got %q", name, val)
+		}
+	}
+}
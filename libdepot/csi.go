@@ -0,0 +1,151 @@
+package libdepot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/adonSh/depot/libdepot/csipb"
+)
+
+// The version of the Secrets Store CSI driver's provider API that
+// NewCSIProvider speaks
+const csiAPIVersion = "v1alpha1"
+
+// Implements the CSIDriverProvider service of csipb for a depot
+type csiProvider struct {
+	csipb.UnimplementedCSIDriverProviderServer
+	depot *Depot
+	token string
+}
+
+// Returns a gRPC server offering the provider API of the Kubernetes Secrets
+// Store CSI driver for the given depot, to be served on a Unix socket in the
+// driver's providers directory on each node. A SecretProviderClass for it
+// lists the keys to mount in its "keys" parameter, one per line, each mounted
+// at a path named after the key, or at the path given before it as
+// "<path>=<key>". The secret named by the volume's nodePublishSecretRef holds
+// in "token" the token to authenticate with, as for Server, and in "password"
+// the password of any encrypted values. Options such as grpc.Creds are passed
+// along to grpc.NewServer.
+func NewCSIProvider(db *Depot, token string, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	csipb.RegisterCSIDriverProviderServer(s, &csiProvider{depot: db, token: token})
+
+	return s
+}
+
+func (p *csiProvider) Version(context.Context, *csipb.VersionRequest) (*csipb.VersionResponse, error) {
+	version := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		version = info.Main.Version
+	}
+
+	return &csipb.VersionResponse{Version: csiAPIVersion, RuntimeName: "depot", RuntimeVersion: version}, nil
+}
+
+func (p *csiProvider) Mount(ctx context.Context, req *csipb.MountRequest) (*csipb.MountResponse, error) {
+	var attrs, secrets map[string]string
+	if err := json.Unmarshal([]byte(req.GetAttributes()), &attrs); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid attributes: %v", err)
+	}
+	if req.GetSecrets() != "" {
+		if err := json.Unmarshal([]byte(req.GetSecrets()), &secrets); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid secrets: %v", err)
+		}
+	}
+	var mode int32
+	if err := json.Unmarshal([]byte(req.GetPermission()), &mode); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid permission: %v", err)
+	}
+
+	addr, _ := grpcClient(ctx)
+	token := secrets["token"]
+	if wait := p.depot.throttle(addr, token); wait > 0 {
+		return nil, status.Errorf(codes.ResourceExhausted, "%v, try again in %v",
+			ErrRateLimited, wait.Round(time.Second))
+	}
+	user, err := p.depot.authenticate(p.token, token)
+	if errors.Is(err, ErrUnauthorized) {
+		p.depot.failedRequest(addr, token, err)
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	} else if err != nil {
+		return nil, grpcError(err)
+	}
+	mounts, err := parseCSIKeys(attrs["keys"])
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var password []byte
+	if secrets["password"] != "" {
+		password = []byte(secrets["password"])
+	}
+
+	db := p.depot.as(user.Name)
+	resp := &csipb.MountResponse{}
+	for _, m := range mounts {
+		if ok, err := db.userCan(user, m.key, PermRead); err != nil {
+			return nil, grpcError(err)
+		} else if !ok {
+			return nil, grpcError(db.audit(AuditFetch, m.key, ErrForbidden))
+		}
+		info, err := db.Info(m.key)
+		if err != nil {
+			return nil, grpcError(err)
+		}
+		val, err := db.Fetch(m.key, password)
+		if err != nil {
+			p.depot.failedRequest(addr, token, err)
+			return nil, grpcError(err)
+		}
+
+		resp.Files = append(resp.Files, &csipb.File{Path: m.path, Mode: mode, Contents: []byte(val)})
+		resp.ObjectVersion = append(resp.ObjectVersion, &csipb.ObjectVersion{
+			Id:      m.key,
+			Version: info.Modified.UTC().Format(time.RFC3339Nano),
+		})
+	}
+
+	return resp, nil
+}
+
+// A key to mount and the path within the volume to mount it at
+type csiMount struct {
+	path string
+	key  string
+}
+
+// Returns the keys listed in the "keys" parameter of a SecretProviderClass,
+// or an error if there are none or a path would leave the volume
+func parseCSIKeys(param string) ([]csiMount, error) {
+	var mounts []csiMount
+	for _, line := range strings.Split(param, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		path, key, ok := strings.Cut(line, "=")
+		if !ok {
+			key = path
+		}
+		path, key = strings.TrimSpace(path), strings.TrimSpace(key)
+		if !filepath.IsLocal(path) {
+			return nil, fmt.Errorf("cannot mount %v at %v, outside the volume", key, path)
+		}
+		mounts = append(mounts, csiMount{path, key})
+	}
+	if len(mounts) == 0 {
+		return nil, errors.New(`no keys listed in the "keys" parameter`)
+	}
+
+	return mounts, nil
+}
@@ -0,0 +1,153 @@
+package libdepot
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/adonSh/depot/libdepot/csipb"
+)
+
+func TestCSIProvider(t *testing.T) {
+	password := []byte("password")
+	mdb, err := NewMemDepot()
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	if err = mdb.Stow("db/user", "admin", nil); err != nil {
+		t.Fatalf("error inserting into depot: %v", err)
+	}
+	if err = mdb.Stow("db/password", "hunter2", password); err != nil {
+		t.Fatalf("error inserting into depot: %v", err)
+	}
+	alice, err := mdb.AddUser("alice", false)
+	if err != nil {
+		t.Fatalf("error adding user: %v", err)
+	}
+	if err = mdb.Grant("alice", "db/user", PermRead); err != nil {
+		t.Fatalf("error granting access: %v", err)
+	}
+	if err = mdb.Grant("alice", "pub/", PermRead); err != nil {
+		t.Fatalf("error granting access: %v", err)
+	}
+	if err = mdb.Alias("pub/link", "db/password", false); err != nil {
+		t.Fatalf("error adding alias: %v", err)
+	}
+
+	sock := filepath.Join(t.TempDir(), "depot.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := NewCSIProvider(mdb, "token")
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("unix://"+sock, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := csipb.NewCSIDriverProviderClient(conn)
+	ctx := context.Background()
+
+	version, err := client.Version(ctx, &csipb.VersionRequest{Version: "v1.4.0"})
+	if err != nil {
+		t.Fatalf("error getting version: %v", err)
+	}
+	if version.GetVersion() != csiAPIVersion || version.GetRuntimeName() != "depot" {
+		t.Errorf("expected API %v from depot but got %v from %v", csiAPIVersion, version.GetVersion(), version.GetRuntimeName())
+	}
+
+	mount := func(keys, secrets string) (*csipb.MountResponse, error) {
+		return client.Mount(ctx, &csipb.MountRequest{
+			Attributes: `{"keys": "` + keys + `", "csi.storage.k8s.io/pod.name": "app"}`,
+			Secrets:    secrets,
+			TargetPath: "/var/lib/kubelet/pods/app/volumes/secrets",
+			Permission: "420",
+		})
+	}
+
+	resp, err := mount(`db/user\npass.txt = db/password\n`, `{"token": "token", "password": "password"}`)
+	if err != nil {
+		t.Fatalf("error mounting: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range resp.GetFiles() {
+		files[f.GetPath()] = string(f.GetContents())
+		if f.GetMode() != 0644 {
+			t.Errorf("expected %v to have mode 0644 but got %o", f.GetPath(), f.GetMode())
+		}
+	}
+	if len(files) != 2 || files["db/user"] != "admin" || files["pass.txt"] != "hunter2" {
+		t.Errorf("expected db/user and pass.txt but got %v", files)
+	}
+	if len(resp.GetObjectVersion()) != 2 || resp.GetObjectVersion()[1].GetId() != "db/password" {
+		t.Errorf("expected a version for each key but got %v", resp.GetObjectVersion())
+	}
+
+	tests := []struct {
+		name    string
+		keys    string
+		secrets string
+		code    codes.Code
+	}{
+		{"wrong token", "db/user", `{"token": "wrong"}`, codes.Unauthenticated},
+		{"no token", "db/user", "", codes.Unauthenticated},
+		{"no password", "db/password", `{"token": "token"}`, codes.PermissionDenied},
+		{"wrong password", "db/password", `{"token": "token", "password": "wrong"}`, codes.PermissionDenied},
+		{"missing key", "db/nope", `{"token": "token"}`, codes.NotFound},
+		{"no keys", "", `{"token": "token"}`, codes.InvalidArgument},
+		{"outside the volume", "../escape = db/user", `{"token": "token"}`, codes.InvalidArgument},
+		{"user not granted", "db/password", `{"token": "` + alice + `", "password": "password"}`, codes.PermissionDenied},
+		{"alias to a key not granted", "pub/link", `{"token": "` + alice + `", "password": "password"}`, codes.PermissionDenied},
+	}
+	for _, test := range tests {
+		if _, err = mount(test.keys, test.secrets); status.Code(err) != test.code {
+			t.Errorf("%v: expected %v but got %v", test.name, test.code, err)
+		}
+	}
+	if _, err = mount("db/user", `{"token": "`+alice+`"}`); err != nil {
+		t.Errorf("expected alice to mount db/user but got %v", err)
+	}
+}
+
+func TestCSIProviderBackoff(t *testing.T) {
+	mdb, _ := NewMemDepot(WithRateLimit(RateLimit{Rate: 100, Backoff: time.Hour}))
+	mdb.Stow("db/user", "admin", nil)
+	sock := filepath.Join(t.TempDir(), "depot.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := NewCSIProvider(mdb, "token")
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("unix://"+sock, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := csipb.NewCSIDriverProviderClient(conn)
+	mount := func(secrets string) error {
+		_, err := client.Mount(context.Background(), &csipb.MountRequest{
+			Attributes: `{"keys": "db/user"}`, Secrets: secrets, Permission: "420",
+		})
+		return err
+	}
+
+	if err = mount(`{"token": "wrong"}`); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected %v but got %v", codes.Unauthenticated, err)
+	}
+	// Held back even with the right token, for the address failed
+	if err = mount(`{"token": "token"}`); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected %v after failing to authenticate but got %v", codes.ResourceExhausted, err)
+	}
+}
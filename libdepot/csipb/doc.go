@@ -0,0 +1,6 @@
+// Package csipb holds the messages and the generated server for the provider
+// API of the Kubernetes Secrets Store CSI driver, as defined in csi.proto (see
+// libdepot.NewCSIProvider).
+package csipb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative csi.proto
@@ -0,0 +1,45 @@
+// Package depototel traces depots with OpenTelemetry. It is kept apart from
+// libdepot so that programs that do not trace are not built with
+// OpenTelemetry.
+package depototel
+
+import (
+	"context"
+	"errors"
+
+	"github.com/adonSh/depot/libdepot"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The name of the instrumentation scope spans are created in
+const ScopeName = "github.com/adonSh/depot/libdepot"
+
+// A libdepot.Tracer that creates spans with an OpenTelemetry tracer
+type tracer struct {
+	tracer trace.Tracer
+}
+
+// Returns a libdepot.Tracer, to be given to libdepot.WithTracer, that creates
+// spans with a tracer from tp. Spans carry the key, prefix, or metadata name
+// involved as depot.key, but never a value. A key that is not found is
+// recorded as depot.found=false rather than as an error.
+func NewTracer(tp trace.TracerProvider) libdepot.Tracer {
+	return &tracer{tp.Tracer(ScopeName)}
+}
+
+func (t *tracer) Start(ctx context.Context, name, key string) (context.Context, func(err error)) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(attribute.String("depot.key", key)))
+
+	return ctx, func(err error) {
+		switch {
+		case errors.Is(err, libdepot.ErrNotFound):
+			span.SetAttributes(attribute.Bool("depot.found", false))
+		case err != nil:
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
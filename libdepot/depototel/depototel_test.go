@@ -0,0 +1,80 @@
+package depototel
+
+import (
+	"testing"
+
+	"github.com/adonSh/depot/libdepot"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	mdb, err := libdepot.NewMemDepot(libdepot.WithTracer(NewTracer(tp)))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+
+	if err = mdb.Stow("db/password", "hunter2", []byte("password")); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	mdb.Fetch("db/password", []byte("wrong"))
+	mdb.Fetch("missing", nil)
+
+	var stow, badFetch, missingFetch sdktrace.ReadOnlySpan
+	puts := 0
+	for _, s := range recorder.Ended() {
+		key := ""
+		for _, a := range s.Attributes() {
+			if a.Key == "depot.key" {
+				key = a.Value.AsString()
+			}
+			if a.Value.AsString() == "hunter2" {
+				t.Errorf("expected values to be left out of spans but got %v", a)
+			}
+		}
+		switch {
+		case s.Name() == "depot.Stow":
+			stow = s
+		case s.Name() == "depot.Fetch" && key == "db/password":
+			badFetch = s
+		case s.Name() == "depot.Fetch" && key == "missing":
+			missingFetch = s
+		case s.Name() == "depot.backend.Put" && key == "db/password":
+			puts++
+		}
+	}
+	if stow == nil || badFetch == nil || missingFetch == nil {
+		t.Fatalf("expected spans for a stow and two fetches but got %v", recorder.Ended())
+	}
+	if puts != 1 {
+		t.Errorf("expected 1 span for the backend put but got %v", puts)
+	}
+
+	for _, s := range recorder.Ended() {
+		if s.Name() == "depot.backend.Put" && s.Parent().SpanID() != stow.SpanContext().SpanID() {
+			t.Errorf("expected the backend put to be a child of the stow")
+		}
+	}
+	if stow.Status().Code != codes.Unset {
+		t.Errorf("expected a stow that succeeded to have no status but got %v", stow.Status())
+	}
+	if badFetch.Status().Code != codes.Error {
+		t.Errorf("expected a fetch with the wrong password to fail but got %v", badFetch.Status())
+	}
+	if missingFetch.Status().Code != codes.Unset {
+		t.Errorf("expected a missing key not to be an error but got %v", missingFetch.Status())
+	}
+	found := false
+	for _, a := range missingFetch.Attributes() {
+		if a == attribute.Bool("depot.found", false) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a missing key to be recorded but got %v", missingFetch.Attributes())
+	}
+}
@@ -0,0 +1,7 @@
+// Package depotpb holds the messages and the generated client and server
+// for the gRPC API of a depot server, as defined in depot.proto. Most
+// programs should use libdepot.NewGRPCBackend instead of the client
+// directly, since it encrypts values before they leave the process.
+package depotpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative depot.proto
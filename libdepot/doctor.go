@@ -0,0 +1,220 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+)
+
+// A Backend that can check its storage for damage beneath the entries it
+// holds, such as a corrupted page or index
+type IntegrityChecker interface {
+	// Returns a description of each problem found, or none if the storage is
+	// sound
+	CheckIntegrity() ([]string, error)
+}
+
+// Something wrong with a depot found by Check
+type Problem struct {
+	// The key of the entry at fault, or empty if it is the storage itself
+	Key string `json:"key,omitempty"`
+
+	Message string `json:"message"`
+
+	// Whether Check could repair it, or did when asked to
+	Repairable bool `json:"repairable,omitempty"`
+	Repaired   bool `json:"repaired,omitempty"`
+}
+
+func (p Problem) String() string {
+	s := p.Message
+	if p.Key != "" {
+		s = p.Key + ": " + s
+	}
+	if p.Repaired {
+		s += " (repaired)"
+	}
+	return s
+}
+
+// Checks the storage, if the backend can check itself (see IntegrityChecker),
+// the permissions of the files holding the depot (see FileBackend), which
+// can be repaired, and every entry, including those in the trash, for values that cannot be
+// fetched: a nonce missing, malformed, or shared with another value, data
+// that is not valid base64 or cannot be decompressed, an unknown compression
+// method, and aliases of keys that no longer exist. With a password every
+// encrypted value is decrypted as well, and those missing the key check that
+// tells a bad password apart from corrupted data or sharing a nonce, which
+// weakens their encryption, can be repaired. If repair is true they are. Returns the problems found, none if
+// the depot is healthy, or an error if the check itself is unsuccessful.
+func (db *Depot) Check(password []byte, repair bool) ([]Problem, error) {
+	var problems []Problem
+	if c, ok := db.backend.(IntegrityChecker); ok {
+		found, err := c.CheckIntegrity()
+		if err != nil {
+			return nil, fmt.Errorf("cannot check database: %w", err)
+		}
+		for _, msg := range found {
+			problems = append(problems, Problem{Message: msg})
+		}
+	}
+
+	insecure, err := db.insecureFiles()
+	if err != nil {
+		return nil, fmt.Errorf("cannot check permissions: %w", err)
+	}
+	for _, f := range insecure {
+		p := Problem{Message: fmt.Sprintf("%v has mode %v, which other users have access to", f.path, f.mode.Perm()), Repairable: true}
+		if repair {
+			if err = os.Chmod(f.path, f.mode.Perm()&0700); err != nil {
+				return nil, fmt.Errorf("cannot repair %v: %w", f.path, err)
+			}
+			p.Repaired = true
+		}
+		problems = append(problems, p)
+	}
+
+	entries, err := db.backend.List("")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	nonces := map[string]string{}
+	for _, e := range entries {
+		if e.Deleted && e.Val == "" {
+			continue
+		}
+
+		p := db.checkEntry(e, nonces, password)
+		if p == nil {
+			continue
+		}
+		if p.Repairable && repair {
+			if err = db.repairEntry(e, password); err != nil {
+				return nil, fmt.Errorf("cannot repair %v: %w", e.Key, err)
+			}
+			p.Repaired = true
+		}
+		problems = append(problems, *p)
+	}
+
+	aliases, err := db.Aliases()
+	if err != nil {
+		return nil, err
+	}
+	for _, alias := range slices.Sorted(maps.Keys(aliases)) {
+		target := aliases[alias]
+		if _, err = db.get(target); errors.Is(err, ErrNotFound) {
+			problems = append(problems, Problem{Key: alias, Message: fmt.Sprintf("is an alias of %v, which does not exist", target)})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return problems, nil
+}
+
+// Returns the first problem with the entry or nil if there is none. nonces
+// maps each nonce seen so far to the key that used it, and gains the entry's.
+func (db *Depot) checkEntry(e *Entry, nonces map[string]string, password []byte) *Problem {
+	p := func(format string, v ...any) *Problem {
+		msg := fmt.Sprintf(format, v...)
+		if e.Deleted {
+			msg += " (in the trash)"
+		}
+		return &Problem{Key: e.Key, Message: msg}
+	}
+
+	if e.Compression != CompressionNone && e.Compression != CompressionZstd {
+		return p("unknown compression method %q", e.Compression)
+	}
+	if e.Nonce == nil {
+		if e.Check != nil || e.Salt != nil || e.KeySalt != nil {
+			return p("has a key check or salt but no nonce, so it cannot be decrypted")
+		}
+		if e.Compression == CompressionNone {
+			return nil
+		}
+		if _, err := db.fetchEntry(e, nil); err != nil {
+			return p("%v", err)
+		}
+		return nil
+	}
+
+	if _, err := db.opener(e.Cipher); err != nil {
+		return p("%v", err)
+	} else if e.Cipher == CipherAESGCM && len(e.Nonce) != 12 {
+		return p("nonce is %d bytes long instead of 12", len(e.Nonce))
+	}
+	if _, err := b64.DecodeString(e.Val); err != nil {
+		return p("encrypted value is not valid base64")
+	}
+	other, shared := nonces[string(e.Nonce)]
+	if !shared {
+		nonces[string(e.Nonce)] = e.Key
+	}
+
+	if password == nil {
+		if shared {
+			return p("shares its nonce with %v", other)
+		}
+		return nil
+	}
+	if _, err := db.fetchEntry(e, password); errors.Is(err, ErrBadPassword) {
+		return p("does not decrypt with the given password")
+	} else if err != nil {
+		return p("%v", err)
+	}
+
+	switch {
+	case shared:
+		problem := p("shares its nonce with %v", other)
+		problem.Repairable = true
+		return problem
+	case e.Check == nil:
+		problem := p("has no key check")
+		problem.Repairable = true
+		return problem
+	}
+
+	return nil
+}
+
+// Encrypts the value of the entry again under a fresh nonce, with a key
+// check, by the sealer it was sealed with, keeping its salt and when it was
+// modified. Returns an error if unsuccessful.
+func (db *Depot) repairEntry(e *Entry, password []byte) error {
+	sealer, err := db.opener(e.Cipher)
+	if err != nil {
+		return err
+	}
+	encryptionKey := db.entryKey(e, password)
+	data, err := b64.DecodeString(e.Val)
+	if err != nil {
+		return err
+	}
+	if data, err = db.open(e.Cipher, encryptionKey, e.Nonce, data, entryAAD(e)); err != nil {
+		return err
+	}
+
+	var ciphertext, nonce []byte
+	if gcm, ok := sealer.(aesGCM); ok {
+		ciphertext, nonce, err = gcm.sealWith(encryptionKey, data, entryAAD(e))
+	} else {
+		ciphertext, nonce, err = sealer.Seal(encryptionKey, data)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot encrypt data: %w", err)
+	}
+	repaired := *e
+	repaired.Val = b64.EncodeToString(ciphertext)
+	repaired.Nonce = nonce
+	repaired.Check = keyCheck(encryptionKey, nonce)
+	if err = db.backend.Put(&repaired); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package libdepot
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	password := []byte("password")
+	mdb, _ := NewMemDepot()
+	mdb.Stow("plain", "plain", nil)
+	mdb.Stow("secret", "secret", password)
+	mdb.Stow("other", "other", []byte("other password"))
+	if problems, err := mdb.Check(password, false); err != nil || len(problems) != 1 || problems[0].Key != "other" {
+		t.Errorf("expected only other to fail to decrypt but got %v (%v)", problems, err)
+	}
+
+	// Break the depot in every way that can be repaired and some that can't
+	secret, _ := mdb.backend.Get("secret")
+	shared := *secret
+	shared.Key = "shared"
+	unchecked := *secret
+	unchecked.Key, unchecked.Nonce, unchecked.Check = "unchecked", []byte("000000000000"), nil
+	mdb.backend.Put(&shared)
+	mdb.backend.Put(&Entry{Key: "garbled", Val: "not base64!", Nonce: []byte("111111111111")})
+	mdb.backend.Put(&Entry{Key: "unknown", Val: "plain", Compression: "lz4"})
+	mdb.backend.Put(&Entry{Key: "saltonly", Val: "plain", Salt: []byte("salt")})
+
+	// The entry without a check was encrypted under another nonce, so it
+	// can't be repaired
+	mdb.backend.Put(&unchecked)
+	fixable, _ := mdb.newEntry("fixable", "fixable", mdb.deriveKey(password, nil), nil)
+	fixable.Check = nil
+	mdb.backend.Put(fixable)
+
+	problems, err := mdb.Check(nil, false)
+	if err != nil {
+		t.Fatalf("error checking depot: %v", err)
+	}
+	found := map[string]Problem{}
+	for _, p := range problems {
+		found[p.Key] = p
+	}
+	for _, key := range []string{"shared", "garbled", "unknown", "saltonly"} {
+		if _, ok := found[key]; !ok {
+			t.Errorf("expected a problem with %v but got %v", key, problems)
+		}
+	}
+	if _, ok := found["fixable"]; ok {
+		t.Errorf("expected a missing key check to go unnoticed without a password but got %v", found["fixable"])
+	}
+
+	if problems, err = mdb.Check(password, true); err != nil {
+		t.Fatalf("error repairing depot: %v", err)
+	}
+	found = map[string]Problem{}
+	for _, p := range problems {
+		found[p.Key] = p
+	}
+	for key, want := range map[string]string{"shared": "secret", "fixable": "fixable"} {
+		if !found[key].Repaired {
+			t.Errorf("expected %v to be repaired but got %v", key, found[key])
+		}
+		if val, err := mdb.Fetch(key, password); err != nil || val != want {
+			t.Errorf("expected %v to decrypt to %v after repair but got %q (%v)", key, want, val, err)
+		}
+	}
+	if found["unchecked"].Repaired || found["garbled"].Repaired {
+		t.Errorf("expected values that cannot be decrypted to be left alone but got %v", problems)
+	}
+
+	if e, _ := mdb.backend.Get("shared"); string(e.Nonce) == string(secret.Nonce) || e.Check == nil {
+		t.Errorf("expected shared to be encrypted under a new nonce with a key check")
+	}
+	if problems, _ = mdb.Check(password, false); len(problems) != 5 {
+		t.Errorf("expected only the problems that cannot be repaired to remain but got %v", problems)
+	}
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	if problems, err := db.Check(nil, false); err != nil {
+		t.Errorf("error checking depot: %v", err)
+	} else {
+		for _, p := range problems {
+			if p.Key == "" {
+				t.Errorf("expected the database to pass its integrity check but got %v", p)
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package libdepot
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats a DepotDump can be marshaled to
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatYAML = "yaml"
+)
+
+// The contents of a depot in plain form, for exchange with other tools. Unlike
+// an archive (see Export), a dump is never encrypted, so any secret value in
+// it is there for anyone to read.
+type DepotDump struct {
+	Entries []DumpEntry `json:"entries" yaml:"entries"`
+
+	// Keys of secret values that were left out for want of a password
+	Withheld []string `json:"-" yaml:"-"`
+}
+
+// A single value in a DepotDump
+type DumpEntry struct {
+	Key   string `json:"key" yaml:"key"`
+	Value string `json:"value" yaml:"value"`
+
+	// The value was encrypted in the depot, and will be again when loaded
+	Secret   bool      `json:"secret,omitempty" yaml:"secret,omitempty"`
+	Modified time.Time `json:"modified" yaml:"modified"`
+}
+
+// The columns of a dump in CSV form
+var dumpColumns = []string{"key", "value", "secret", "modified"}
+
+// Returns the values whose keys match pattern (a shell pattern as understood
+// by path.Match, or "" for every key) in plain form. Secret values are
+// decrypted with password, or withheld if it is nil. Returns an error if
+// unsuccessful, including when a secret cannot be decrypted with password.
+func (db *Depot) Dump(pattern string, password []byte) (*DepotDump, error) {
+	entries, err := db.matching(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	dump := DepotDump{Entries: []DumpEntry{}}
+	for _, e := range entries {
+		secret := e.Nonce != nil
+		if secret && password == nil {
+			dump.Withheld = append(dump.Withheld, e.Key)
+			continue
+		}
+
+		val, err := db.Fetch(e.Key, password)
+		if err != nil {
+			return nil, err
+		}
+		dump.Entries = append(dump.Entries, DumpEntry{
+			Key:      e.Key,
+			Value:    val,
+			Secret:   secret,
+			Modified: e.Modified,
+		})
+	}
+
+	return &dump, nil
+}
+
+// Stores the values in the dump, replacing any with the same keys. Secret
+// values are encrypted with password, which must not be nil if there are any.
+// Returns the number of values stored or an error if unsuccessful.
+func (db *Depot) Load(dump *DepotDump, password []byte) (int, error) {
+	for i, e := range dump.Entries {
+		var pw []byte
+		if e.Secret {
+			if password == nil {
+				return i, fmt.Errorf("%v: %w", e.Key, ErrPasswordNeeded)
+			}
+			pw = password
+		}
+
+		if err := db.Stow(e.Key, e.Value, pw); err != nil {
+			return i, err
+		}
+	}
+
+	return len(dump.Entries), nil
+}
+
+// Returns the dump in the given format or an error if unsuccessful
+func (d *DepotDump) Marshal(format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(d, "", "  ")
+		return append(data, '\n'), err
+	case FormatYAML:
+		return yaml.Marshal(d)
+	case FormatCSV:
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write(dumpColumns)
+		for _, e := range d.Entries {
+			w.Write([]string{
+				e.Key,
+				e.Value,
+				strconv.FormatBool(e.Secret),
+				e.Modified.Format(time.RFC3339),
+			})
+		}
+		w.Flush()
+		return buf.Bytes(), w.Error()
+	default:
+		return nil, fmt.Errorf("unknown format: %v", format)
+	}
+}
+
+// Replaces the contents of the dump with data in the given format. Returns an
+// error if unsuccessful.
+func (d *DepotDump) Unmarshal(data []byte, format string) error {
+	*d = DepotDump{}
+
+	switch format {
+	case FormatJSON:
+		return json.Unmarshal(data, d)
+	case FormatYAML:
+		return yaml.Unmarshal(data, d)
+	case FormatCSV:
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		// Only the key and value columns are required, in any order
+		columns := map[string]int{}
+		for i, name := range records[0] {
+			columns[name] = i
+		}
+		if _, ok := columns["key"]; !ok {
+			return fmt.Errorf("csv has no key column")
+		}
+		if _, ok := columns["value"]; !ok {
+			return fmt.Errorf("csv has no value column")
+		}
+		field := func(record []string, name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+
+		for n, record := range records[1:] {
+			e := DumpEntry{Key: field(record, "key"), Value: field(record, "value")}
+			if s := field(record, "secret"); s != "" {
+				if e.Secret, err = strconv.ParseBool(s); err != nil {
+					return fmt.Errorf("csv line %v: invalid secret column: %q", n+2, s)
+				}
+			}
+			if s := field(record, "modified"); s != "" {
+				if e.Modified, err = time.Parse(time.RFC3339, s); err != nil {
+					return fmt.Errorf("csv line %v: invalid modified column: %q", n+2, s)
+				}
+			}
+			d.Entries = append(d.Entries, e)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown format: %v", format)
+	}
+}
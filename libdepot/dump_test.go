@@ -0,0 +1,77 @@
+package libdepot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	password := []byte("password")
+	src, err := NewMemDepot()
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	if err = src.Stow("secret", "hunter2", password); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	if err = src.Stow("plain", "a value, with \"quotes\"\nand lines", nil); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+
+	dump, err := src.Dump("", nil)
+	if err != nil {
+		t.Fatalf("error dumping: %v", err)
+	}
+	if len(dump.Entries) != 1 || len(dump.Withheld) != 1 || dump.Withheld[0] != "secret" {
+		t.Errorf("expected the secret to be withheld but got %+v", dump)
+	}
+	if _, err = src.Dump("", []byte("wrong")); !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v dumping with the wrong password but got %v", ErrBadPassword, err)
+	}
+
+	if dump, err = src.Dump("", password); err != nil {
+		t.Fatalf("error dumping: %v", err)
+	}
+	for _, format := range []string{FormatJSON, FormatCSV, FormatYAML} {
+		data, err := dump.Marshal(format)
+		if err != nil {
+			t.Fatalf("error marshaling %v: %v", format, err)
+		}
+
+		var loaded DepotDump
+		if err = loaded.Unmarshal(data, format); err != nil {
+			t.Fatalf("error unmarshaling %v: %v", format, err)
+		}
+		if len(loaded.Entries) != 2 {
+			t.Fatalf("expected 2 entries from %v but got %+v", format, loaded)
+		}
+		for i, e := range loaded.Entries {
+			want := dump.Entries[i]
+			if e.Key != want.Key || e.Value != want.Value || e.Secret != want.Secret ||
+				e.Modified.Unix() != want.Modified.Unix() {
+				t.Errorf("expected %+v to round trip through %v but got %+v", want, format, e)
+			}
+		}
+
+		dst, _ := NewMemDepot()
+		if _, err = dst.Load(&loaded, nil); !errors.Is(err, ErrPasswordNeeded) {
+			t.Errorf("expected %v loading secrets without a password but got %v", ErrPasswordNeeded, err)
+		}
+		if _, err = dst.Load(&loaded, []byte("other password")); err != nil {
+			t.Fatalf("error loading %v: %v", format, err)
+		}
+		if val, err := dst.Fetch("secret", []byte("other password")); err != nil || val != "hunter2" {
+			t.Errorf("expected hunter2 from %v but got %q (%v)", format, val, err)
+		}
+	}
+
+	var loaded DepotDump
+	if err = loaded.Unmarshal([]byte("value,key\nv,k\n"), FormatCSV); err != nil {
+		t.Errorf("error unmarshaling csv with only some columns: %v", err)
+	} else if len(loaded.Entries) != 1 || loaded.Entries[0].Key != "k" || loaded.Entries[0].Value != "v" {
+		t.Errorf("expected k=v but got %+v", loaded)
+	}
+	if _, err = dump.Marshal("xml"); err == nil {
+		t.Errorf("expected an error marshaling an unknown format")
+	}
+}
@@ -0,0 +1,93 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Operations named by OpError besides the audited ones (AuditStow,
+// AuditFetch, AuditDrop, and AuditShare)
+const (
+	OpAlias     = "alias"
+	OpUnalias   = "unalias"
+	OpInfo      = "info"
+	OpVerify    = "verify"
+	OpRotation  = "rotation"
+	OpAttach    = "attach"
+	OpIncrement = "increment"
+)
+
+// An error from an operation on a key, telling what was being done, to which
+// key, and with which kind of backend, so that it can be logged as is. It
+// wraps the error the operation failed with, so errors.Is still finds
+// ErrNotFound and the other errors of this package, and errors.As finds the
+// OpError.
+type OpError struct {
+	// The operation, such as AuditFetch or OpAlias
+	Op string
+
+	// The key the operation was given
+	Key string
+
+	// The kind of backend the depot is kept by, such as "sqlite", or "" if
+	// it is not one of this package's
+	Backend string
+
+	Err error
+}
+
+func (e *OpError) Error() string {
+	if e.Backend != "" && (errors.Is(e.Err, ErrDatabase) || errors.Is(e.Err, ErrBusy)) {
+		return fmt.Sprintf("%v %v (%v): %v", e.Op, e.Key, e.Backend, e.Err)
+	}
+
+	return fmt.Sprintf("%v %v: %v", e.Op, e.Key, e.Err)
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Returns err as an OpError from op on key, or nil if err is nil. An error
+// that already is an OpError is returned as is, so that an operation made of
+// others reports the one that failed.
+func (db *Depot) opError(op, key string, err error) error {
+	var opErr *OpError
+	if err == nil || errors.As(err, &opErr) {
+		return err
+	}
+
+	return &OpError{Op: op, Key: key, Backend: backendName(db.backend), Err: err}
+}
+
+// Returns the kind of backend b is, as OpError names it
+func backendName(b Backend) string {
+	if t, ok := b.(*tracedBackend); ok {
+		b = t.Backend
+	}
+
+	switch b.(type) {
+	case *sqliteBackend:
+		return "sqlite"
+	case *boltBackend:
+		return "bolt"
+	case *postgresBackend:
+		return "postgres"
+	case *redisBackend:
+		return "redis"
+	case *s3Backend:
+		return "s3"
+	case *fsBackend:
+		return "dir"
+	case *gitBackend:
+		return "git"
+	case *httpBackend:
+		return "http"
+	case *grpcBackend:
+		return "grpc"
+	case *memBackend:
+		return "memory"
+	}
+
+	return ""
+}
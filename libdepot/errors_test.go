@@ -0,0 +1,55 @@
+package libdepot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOpError(t *testing.T) {
+	mdb, _ := NewMemDepot()
+	password := []byte("correct horse battery staple")
+	if err := mdb.Stow("db/password", "hunter2", password); err != nil {
+		t.Fatalf("error stowing: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		op   string
+		key  string
+		is   error
+	}{
+		{"fetch missing", func() error { _, err := mdb.Fetch("db/user", nil); return err }(), AuditFetch, "db/user", ErrNotFound},
+		{"fetch bad password", func() error { _, err := mdb.Fetch("db/password", []byte("wrong")); return err }(), AuditFetch, "db/password", ErrBadPassword},
+		{"fetch no password", func() error { _, err := mdb.Fetch("db/password", nil); return err }(), AuditFetch, "db/password", ErrPasswordNeeded},
+		{"copy without password", mdb.Copy("db/password", "db/copy", nil, false), AuditStow, "db/copy", ErrPasswordNeeded},
+		{"alias missing", mdb.Alias("pg", "db/user", false), OpAlias, "pg", ErrNotFound},
+		{"info missing", func() error { _, err := mdb.Info("db/user"); return err }(), OpInfo, "db/user", ErrNotFound},
+		{"increment a secret", func() error { _, err := mdb.Increment("db/password", 1); return err }(), OpIncrement, "db/password", ErrNotNumber},
+		{"not a record", func() error { _, err := mdb.FetchRecord("db/password", password); return err }(), AuditFetch, "db/password", ErrNotRecord},
+	}
+	for _, tt := range tests {
+		var opErr *OpError
+		if !errors.As(tt.err, &opErr) {
+			t.Errorf("%v: expected an OpError but got %v", tt.name, tt.err)
+			continue
+		}
+		if opErr.Op != tt.op || opErr.Key != tt.key || opErr.Backend != "memory" {
+			t.Errorf("%v: expected %v of %v with memory but got %+v", tt.name, tt.op, tt.key, opErr)
+		}
+		if !errors.Is(tt.err, tt.is) {
+			t.Errorf("%v: expected %v to be %v", tt.name, tt.err, tt.is)
+		}
+	}
+
+	// An operation made of others reports the one that failed, once
+	err := mdb.StowField("db/password", FieldUsername, "admin", password)
+	if want := "fetch db/password: value is not a record"; err == nil || err.Error() != want {
+		t.Errorf("expected %q but got %v", want, err)
+	}
+
+	db := &OpError{Op: AuditStow, Key: "k", Backend: "sqlite", Err: ErrDatabase}
+	if want := "stow k (sqlite): cannot access database"; db.Error() != want {
+		t.Errorf("expected %q but got %q", want, db.Error())
+	}
+}
@@ -0,0 +1,158 @@
+package libdepot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Something given along with a key cannot be used, such as a sealed value
+// with no parameters or a share that never expires
+var ErrInvalidParams = errors.New("invalid parameters")
+
+// A value encrypted outside of the depot, such as by a hardware security
+// module or a remote signer, as it is stored (see StowSealed)
+type SealedValue struct {
+	// The encrypted value
+	Sealed []byte
+
+	// The parameters it was sealed with, such as its nonce, which must not be
+	// empty, and must never be the same for two values
+	Params []byte
+
+	// The name of the sealer that can open it (see Sealer), which is
+	// CipherAESGCM for a value that Fetch can decrypt with no sealer given
+	Cipher string
+
+	// A check of the key it was sealed with (see KeyCheck), or nil if there
+	// is none, in which case a wrong password is only found out by failing to
+	// open the value
+	Check []byte
+
+	// How the value was compressed before it was sealed, and must be
+	// decompressed after it is opened, or CompressionNone
+	Compression string
+
+	// The value's own salt, if it was sealed with the key ValueKey gives for
+	// it rather than the one the password derives, in which case it was also
+	// sealed with the salt followed by Compression as its additional data if
+	// it was sealed with AES-GCM, or nil
+	KeySalt []byte
+}
+
+// Returns the salt that the key to encrypt the value of key with is derived
+// with: that of the key's namespace if it has a password of its own (see
+// CreateNamespace), or otherwise the depot's own, which is also what ""
+// gives. With it, and the password, a key can be derived outside of the
+// depot that it would derive itself. Returns an error if unsuccessful.
+func (db *Depot) Salt(key string) ([]byte, error) {
+	salt, err := db.saltOf(db.normalizeKey(key))
+	if err != nil {
+		return nil, err
+	} else if salt == nil {
+		salt = db.salt
+	}
+
+	return bytes.Clone(salt), nil
+}
+
+// Returns the salt of the namespace of key if it has a password of its own,
+// or nil if it does not, or an error if unsuccessful
+func (db *Depot) saltOf(key string) ([]byte, error) {
+	namespaces, err := db.namespaces()
+	if err != nil {
+		return nil, err
+	}
+
+	return namespaces[Namespace(key)].Salt, nil
+}
+
+// Returns the check of an encryption key that a depot stores with the
+// values it encrypts, for the parameters a value was sealed with, so that a
+// value sealed outside of the depot (see StowSealed) can be checked against
+// a password as its own values are (see Verify)
+func KeyCheck(encryptionKey, params []byte) []byte {
+	return keyCheck(encryptionKey, params)
+}
+
+// Stores the value, encrypted outside of the depot, under key, or the key it
+// is an alias of, as it is: it is neither compressed nor encrypted again, and
+// it is taken to have been encrypted with a key derived with the salt Salt
+// gives for key, or the one ValueKey gives for it if it has a salt of its
+// own. Fetch can decrypt it only if the depot has its sealer, but
+// FetchSealed gives it back as it was stored. Returns ErrInvalidParams if its
+// parameters are empty or its compression is unknown, ErrTooLarge if it is
+// longer than allowed (see WithMaxValueSize), or another error if
+// unsuccessful.
+func (db *Depot) StowSealed(key string, v SealedValue) error {
+	return db.audit(AuditStow, key, db.stowSealed(key, v))
+}
+
+func (db *Depot) stowSealed(key string, v SealedValue) error {
+	if len(v.Params) == 0 {
+		return fmt.Errorf("%w: sealed value has no parameters", ErrInvalidParams)
+	} else if v.Compression != CompressionNone && v.Compression != CompressionZstd {
+		return fmt.Errorf("%w: unknown compression %q", ErrInvalidParams, v.Compression)
+	} else if limit := db.MaxValueSize(); limit > 0 && len(v.Sealed) > limit {
+		return fmt.Errorf("%w: %d bytes, more than %d", ErrTooLarge, len(v.Sealed), limit)
+	}
+	key, err := db.checkKey(key)
+	if err != nil {
+		return err
+	}
+	if key, err = db.resolve(key); err != nil {
+		return err
+	}
+	salt, err := db.saltOf(key)
+	if err != nil {
+		return err
+	}
+
+	return db.putChecked(&Entry{
+		Key:         key,
+		Val:         b64.EncodeToString(v.Sealed),
+		Nonce:       v.Params,
+		Check:       v.Check,
+		Salt:        salt,
+		Modified:    db.now(),
+		Compression: v.Compression,
+		Cipher:      v.Cipher,
+		KeySalt:     v.KeySalt,
+	})
+}
+
+// Returns the value of key, or of the key it is an alias of, as it is
+// stored, so that it can be decrypted outside of the depot with a key
+// derived with the salt Salt gives for key, and then with ValueKey if it has
+// a salt of its own. Returns ErrNotFound, an error if
+// the value is not encrypted, or another error if unsuccessful.
+func (db *Depot) FetchSealed(key string) (v SealedValue, err error) {
+	v, err = db.fetchSealed(key)
+	if err = db.audit(AuditFetch, key, err); err != nil {
+		return SealedValue{}, err
+	}
+
+	return v, nil
+}
+
+func (db *Depot) fetchSealed(key string) (SealedValue, error) {
+	entry, err := db.get(db.normalizeKey(key))
+	if err != nil {
+		return SealedValue{}, err
+	} else if entry.Nonce == nil {
+		return SealedValue{}, fmt.Errorf("value is not encrypted")
+	}
+	sealed, err := b64.DecodeString(entry.Val)
+	if err != nil {
+		return SealedValue{}, fmt.Errorf("cannot decode value: %w", ErrCorrupted)
+	}
+
+	return SealedValue{
+		Sealed:      sealed,
+		Params:      entry.Nonce,
+		Cipher:      entry.Cipher,
+		Check:       entry.Check,
+		Compression: entry.Compression,
+		KeySalt:     entry.KeySalt,
+	}, nil
+}
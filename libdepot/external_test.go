@@ -0,0 +1,99 @@
+package libdepot
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func TestSealedValues(t *testing.T) {
+	mdb, _ := NewMemDepot()
+	password := []byte("password")
+	banking := []byte("banking password")
+	if err := mdb.CreateNamespace("banking", banking); err != nil {
+		t.Fatalf("error creating namespace: %v", err)
+	}
+
+	depotSalt, err := mdb.Salt("")
+	if err != nil || !bytes.Equal(depotSalt, mdb.salt) {
+		t.Errorf("expected the depot's salt but got %x (%v)", depotSalt, err)
+	}
+	bankingSalt, err := mdb.Salt("banking/pin")
+	if err != nil || len(bankingSalt) == 0 || bytes.Equal(bankingSalt, depotSalt) {
+		t.Errorf("expected the namespace's own salt but got %x (%v)", bankingSalt, err)
+	}
+
+	// Sealed as depot would, but by the caller, with a key derived elsewhere
+	seal := func(password, salt []byte) SealedValue {
+		encryptionKey := pbkdf2.Key(password, salt, 4096, 32, sha1.New)
+		sealed, nonce, err := encrypt(rand.Reader, encryptionKey, []byte("sealed elsewhere"), nil)
+		if err != nil {
+			t.Fatalf("error encrypting: %v", err)
+		}
+		return SealedValue{Sealed: sealed, Params: nonce, Check: KeyCheck(encryptionKey, nonce)}
+	}
+	if err = mdb.StowSealed("db/password", seal(password, depotSalt)); err != nil {
+		t.Fatalf("error stowing sealed value: %v", err)
+	}
+	if err = mdb.StowSealed("banking/pin", seal(banking, bankingSalt)); err != nil {
+		t.Fatalf("error stowing sealed value: %v", err)
+	}
+	if val, err := mdb.Fetch("db/password", password); err != nil || val != "sealed elsewhere" {
+		t.Errorf("expected the sealed value but got %q (%v)", val, err)
+	}
+	if val, err := mdb.Fetch("banking/pin", banking); err != nil || val != "sealed elsewhere" {
+		t.Errorf("expected the sealed value in the namespace but got %q (%v)", val, err)
+	}
+	if err = mdb.Verify("db/password", []byte("wrong")); !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v but got %v", ErrBadPassword, err)
+	}
+
+	stored, err := mdb.FetchSealed("db/password")
+	if err != nil || len(stored.Sealed) == 0 || stored.Cipher != CipherAESGCM {
+		t.Fatalf("expected the value as it was stored but got %+v (%v)", stored, err)
+	}
+	encryptionKey := pbkdf2.Key(password, depotSalt, 4096, 32, sha1.New)
+	if plain, err := decrypt(encryptionKey, stored.Params, stored.Sealed, nil); err != nil || string(plain) != "sealed elsewhere" {
+		t.Errorf("expected to open the fetched value but got %q (%v)", plain, err)
+	}
+
+	// A value stowed by the depot has a salt of its own, and opens outside of
+	// it with the key ValueKey gives, bound to that salt and its compression
+	if err = mdb.Stow("db/host", "db.example.com", password); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	stored, err = mdb.FetchSealed("db/host")
+	if err != nil || len(stored.KeySalt) == 0 {
+		t.Fatalf("expected the value with its own salt but got %+v (%v)", stored, err)
+	}
+	valueKey := ValueKey(encryptionKey, depotSalt, stored.KeySalt)
+	aad := append(bytes.Clone(stored.KeySalt), stored.Compression...)
+	if plain, err := decrypt(valueKey, stored.Params, stored.Sealed, aad); err != nil || string(plain) != "db.example.com" {
+		t.Errorf("expected to open the fetched value with its key but got %q (%v)", plain, err)
+	}
+	if _, err := decrypt(encryptionKey, stored.Params, stored.Sealed, aad); err == nil {
+		t.Errorf("expected the password's key alone not to open the value")
+	}
+	if err = mdb.StowSealed("db/host2", stored); err != nil {
+		t.Fatalf("error stowing sealed value: %v", err)
+	}
+	if val, err := mdb.Fetch("db/host2", password); err != nil || val != "db.example.com" {
+		t.Errorf("expected the value stowed with its own salt but got %q (%v)", val, err)
+	}
+
+	if err = mdb.StowSealed("db/user", SealedValue{Sealed: []byte("x")}); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("expected %v without parameters but got %v", ErrInvalidParams, err)
+	}
+	err = mdb.StowSealed("db/user", SealedValue{Sealed: []byte("x"), Params: []byte("nonce"), Compression: "lzma"})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("expected %v with an unknown compression but got %v", ErrInvalidParams, err)
+	}
+	mdb.Stow("db/user", "admin", nil)
+	if _, err = mdb.FetchSealed("db/user"); err == nil {
+		t.Errorf("expected an error fetching a plain value sealed")
+	}
+}
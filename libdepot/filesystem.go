@@ -0,0 +1,243 @@
+package libdepot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// Extension of the file each entry is kept in
+	fsEntryExt = ".depot"
+
+	// Directory under the root that holds depot metadata
+	fsMetaDir = ".depot"
+)
+
+// A Backend that keeps each entry in a file of its own under a directory
+// tree, laid out like a password-store: the key "web/github" lives in
+// web/github.depot. The files are plain text, so the tree can be synced with
+// git, and it can share a directory with an existing password-store.
+type fsBackend struct {
+	mu   sync.Mutex
+	root string
+	lock fileLock
+}
+
+// Returns a Backend stored under the directory at root, creating it if it
+// does not exist, or an error if initialization is unsuccessful.
+func NewFSBackend(root string) (Backend, error) {
+	if err := os.MkdirAll(filepath.Join(root, fsMetaDir), 0700); err != nil {
+		return nil, fmt.Errorf("cannot access depot directory: %w", err)
+	}
+
+	b := &fsBackend{root: root}
+	b.lock.path = filepath.Join(root, fsMetaDir, ".lock")
+
+	return b, nil
+}
+
+// Returns the path of the file the given key is kept in or an error if the
+// key cannot be represented in the filesystem
+func (b *fsBackend) path(key string) (string, error) {
+	if key == "" || key != path.Clean(key) || path.IsAbs(key) ||
+		key == ".." || strings.HasPrefix(key, "../") ||
+		key == fsMetaDir || strings.HasPrefix(key, fsMetaDir+"/") {
+		return "", fmt.Errorf("key %q cannot be used as a file name", key)
+	}
+
+	return filepath.Join(b.root, filepath.FromSlash(key)+fsEntryExt), nil
+}
+
+// Returns the path of the file the named metadata is kept in
+func (b *fsBackend) metaPath(name string) string {
+	return filepath.Join(b.root, fsMetaDir, url.PathEscape(name))
+}
+
+// Writes data to the file at path by way of a temporary file, so readers
+// never see a partial write. Returns an error if unsuccessful.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Reads the entry kept in the file at path
+func readEntryFile(path string) (*Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var e Entry
+	if err = json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+
+	return &e, nil
+}
+
+func (b *fsBackend) Get(key string) (*Entry, error) {
+	p, err := b.path(key)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, err := readEntryFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return e, err
+}
+
+func (b *fsBackend) Put(e *Entry) error {
+	p, err := b.path(e.Key)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(e, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return writeFileAtomic(p, append(data, '\n'))
+}
+
+func (b *fsBackend) Delete(key string) error {
+	p, err := b.path(key)
+	if err != nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err = os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// Tidy up directories that no longer hold anything, as pass does
+	for dir := filepath.Dir(p); dir != filepath.Clean(b.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (b *fsBackend) List(prefix string) ([]*Entry, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var entries []*Entry
+	err := filepath.WalkDir(b.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != b.root && (d.Name() == fsMetaDir || d.Name() == ".git") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(p, fsEntryExt) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(b.root, p)
+		if err != nil {
+			return err
+		}
+		key := strings.TrimSuffix(filepath.ToSlash(rel), fsEntryExt)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		e, err := readEntryFile(p)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	return entries, err
+}
+
+func (b *fsBackend) Lock() (func(), error) {
+	return b.lock.Lock()
+}
+
+func (b *fsBackend) Meta(name string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data, err := os.ReadFile(b.metaPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+func (b *fsBackend) SetMeta(name string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return writeFileAtomic(b.metaPath(name), data)
+}
+
+func (b *fsBackend) Close() error {
+	return nil
+}
+
+// Returns everything in the directory tree, except a git repository's own
+// files, which git manages. The directory itself may be one that was there
+// before, such as a password-store, so it is left alone.
+func (b *fsBackend) Files() ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(b.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if path != b.root {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+
+	return paths, err
+}
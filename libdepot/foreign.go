@@ -0,0 +1,420 @@
+package libdepot
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// An item read from another password manager, before it is laid out as keys
+type foreignItem struct {
+	// The folders the item is in, outermost first
+	folders []string
+
+	title    string
+	password string
+	username string
+	url      string
+	notes    string
+	totp     string
+	fields   []foreignField
+	modified time.Time
+}
+
+// A field of a foreignItem beyond those every manager has
+type foreignField struct {
+	name   string
+	value  string
+	secret bool
+}
+
+// Returns the items as a dump, each under a key named after its folders and
+// title: its password at that key, and its username, url, notes, totp, and
+// other fields at keys below it, not as the fields of a Record, so that each
+// may be secret or not on its own. Passwords, notes, TOTP seeds, and the
+// fields a manager hides are secret. An item or field whose key is already taken
+// gets a number after its name, and empty values are left out.
+func foreignDump(items []foreignItem) *DepotDump {
+	dump := &DepotDump{Entries: []DumpEntry{}}
+	taken := map[string]bool{}
+	claim := func(key string) string {
+		unique := key
+		for n := 2; taken[unique]; n++ {
+			unique = fmt.Sprintf("%v %v", key, n)
+		}
+		taken[unique] = true
+		return unique
+	}
+
+	for _, it := range items {
+		var parts []string
+		for _, f := range it.folders {
+			if f = foreignName(f); f != "" {
+				parts = append(parts, f)
+			}
+		}
+		title := foreignName(it.title)
+		if title == "" {
+			title = "untitled"
+		}
+		key := claim(path.Join(append(parts, title)...))
+
+		add := func(key, val string, secret bool) {
+			if val == "" {
+				return
+			}
+			dump.Entries = append(dump.Entries, DumpEntry{
+				Key:      key,
+				Value:    val,
+				Secret:   secret,
+				Modified: it.modified,
+			})
+		}
+		add(key, it.password, true)
+		for _, f := range append([]foreignField{
+			{"username", it.username, false},
+			{"url", it.url, false},
+			{"notes", it.notes, true},
+			{"totp", it.totp, true},
+		}, it.fields...) {
+			name := foreignName(f.name)
+			if name == "" {
+				name = "field"
+			}
+			if f.value != "" {
+				add(claim(key+"/"+name), f.value, f.secret)
+			}
+		}
+	}
+
+	return dump
+}
+
+// Returns the name of a folder, item, or field made fit to be part of a key,
+// without slashes or surrounding space
+func foreignName(name string) string {
+	return strings.TrimSpace(strings.ReplaceAll(name, "/", "-"))
+}
+
+// A Bitwarden JSON export, as written unencrypted by its clients or an
+// organization's admin console
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Folders   []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Collections []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"collections"`
+	Items []struct {
+		FolderID      string    `json:"folderId"`
+		CollectionIDs []string  `json:"collectionIds"`
+		Type          int       `json:"type"`
+		Name          string    `json:"name"`
+		Notes         string    `json:"notes"`
+		RevisionDate  time.Time `json:"revisionDate"`
+		Fields        []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+			Type  int    `json:"type"`
+		} `json:"fields"`
+		Login *struct {
+			URIs []struct {
+				URI string `json:"uri"`
+			} `json:"uris"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+			TOTP     string `json:"totp"`
+		} `json:"login"`
+		Card     map[string]any `json:"card"`
+		Identity map[string]any `json:"identity"`
+	} `json:"items"`
+}
+
+// The type of a hidden custom field in a Bitwarden export
+const bitwardenHidden = 1
+
+// The fields of cards in a Bitwarden export that are secret
+var bitwardenSecretCardFields = map[string]bool{"number": true, "code": true}
+
+// Returns the items of a Bitwarden export, either the JSON or the CSV form
+// and either personal or an organization's, as a dump laid out as foreignDump
+// does, with an item's folder, or else its first collection, as its folders
+// and card and identity details as fields. Returns an error if unsuccessful,
+// including when the export is encrypted.
+func ParseBitwarden(data []byte) (*DepotDump, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return parseBitwardenJSON(trimmed)
+	}
+
+	records, err := csvRecords(data)
+	if err != nil {
+		return nil, err
+	}
+	var items []foreignItem
+	for _, rec := range records {
+		it := foreignItem{
+			title:    rec["name"],
+			notes:    rec["notes"],
+			username: rec["login_username"],
+			password: rec["login_password"],
+			totp:     rec["login_totp"],
+		}
+		// Items may have several URIs, separated by commas
+		it.url, _, _ = strings.Cut(rec["login_uri"], ",")
+		folder := rec["folder"]
+		if folder == "" {
+			folder, _, _ = strings.Cut(rec["collections"], ",")
+		}
+		if folder != "" {
+			it.folders = strings.Split(folder, "/")
+		}
+		for _, line := range strings.Split(rec["fields"], "\n") {
+			if name, val, ok := strings.Cut(line, ": "); ok {
+				it.fields = append(it.fields, foreignField{name, val, false})
+			}
+		}
+		items = append(items, it)
+	}
+
+	return foreignDump(items), nil
+}
+
+// Returns the items of a Bitwarden JSON export as ParseBitwarden does
+func parseBitwardenJSON(data []byte) (*DepotDump, error) {
+	var export bitwardenExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid Bitwarden export: %w", err)
+	}
+	if export.Encrypted {
+		return nil, errors.New("the Bitwarden export is encrypted, export it again as unencrypted JSON or CSV")
+	}
+
+	folders := map[string]string{}
+	for _, f := range export.Folders {
+		folders[f.ID] = f.Name
+	}
+	for _, c := range export.Collections {
+		folders[c.ID] = c.Name
+	}
+
+	var items []foreignItem
+	for _, bw := range export.Items {
+		it := foreignItem{title: bw.Name, notes: bw.Notes, modified: bw.RevisionDate}
+		folder := folders[bw.FolderID]
+		if folder == "" && len(bw.CollectionIDs) > 0 {
+			folder = folders[bw.CollectionIDs[0]]
+		}
+		if folder != "" {
+			it.folders = strings.Split(folder, "/")
+		}
+		if l := bw.Login; l != nil {
+			it.username, it.password, it.totp = l.Username, l.Password, l.TOTP
+			if len(l.URIs) > 0 {
+				it.url = l.URIs[0].URI
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(bw.Card)) {
+			if val, ok := bw.Card[name].(string); ok {
+				it.fields = append(it.fields, foreignField{name, val, bitwardenSecretCardFields[name]})
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(bw.Identity)) {
+			if val, ok := bw.Identity[name].(string); ok {
+				it.fields = append(it.fields, foreignField{name, val, false})
+			}
+		}
+		for _, f := range bw.Fields {
+			it.fields = append(it.fields, foreignField{f.Name, f.Value, f.Type == bitwardenHidden})
+		}
+		items = append(items, it)
+	}
+
+	return foreignDump(items), nil
+}
+
+// A 1Password export in the 1PUX format, as the export.data file within it
+type onePasswordExport struct {
+	Accounts []struct {
+		Vaults []struct {
+			Attrs struct {
+				Name string `json:"name"`
+			} `json:"attrs"`
+			Items []struct {
+				UpdatedAt int64  `json:"updatedAt"`
+				State     string `json:"state"`
+				Overview  struct {
+					Title string `json:"title"`
+					URL   string `json:"url"`
+				} `json:"overview"`
+				Details struct {
+					LoginFields []struct {
+						Value       string `json:"value"`
+						Name        string `json:"name"`
+						FieldType   string `json:"fieldType"`
+						Designation string `json:"designation"`
+					} `json:"loginFields"`
+					NotesPlain string `json:"notesPlain"`
+					Password   string `json:"password"`
+					Sections   []struct {
+						Fields []struct {
+							Title string                     `json:"title"`
+							ID    string                     `json:"id"`
+							Value map[string]json.RawMessage `json:"value"`
+						} `json:"fields"`
+					} `json:"sections"`
+				} `json:"details"`
+			} `json:"items"`
+		} `json:"vaults"`
+	} `json:"accounts"`
+}
+
+// Returns the items of a 1Password export, either a 1PUX file or the CSV form,
+// as a dump laid out as foreignDump does, with an item's vault as its folder
+// in a 1PUX file. Items 1Password has trashed are left out. Returns an error
+// if unsuccessful.
+func ParseOnePassword(data []byte) (*DepotDump, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return parseOnePUX(data)
+	}
+
+	records, err := csvRecords(data)
+	if err != nil {
+		return nil, err
+	}
+	var items []foreignItem
+	for _, rec := range records {
+		it := foreignItem{}
+		for col, val := range rec {
+			switch col {
+			case "title":
+				it.title = val
+			case "url", "website", "urls":
+				it.url = val
+			case "username":
+				it.username = val
+			case "password":
+				it.password = val
+			case "otpauth", "one-time password":
+				it.totp = val
+			case "notes", "notesplain":
+				it.notes = val
+			case "favorite", "archived", "tags", "type", "uuid", "vault":
+			default:
+				it.fields = append(it.fields, foreignField{col, val, false})
+			}
+		}
+		sort.Slice(it.fields, func(i, j int) bool { return it.fields[i].name < it.fields[j].name })
+		items = append(items, it)
+	}
+
+	return foreignDump(items), nil
+}
+
+// Returns the items of a 1PUX file as ParseOnePassword does
+func parseOnePUX(data []byte) (*DepotDump, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid 1Password export: %w", err)
+	}
+	f, err := zr.Open("export.data")
+	if err != nil {
+		return nil, fmt.Errorf("invalid 1Password export: %w", err)
+	}
+	defer f.Close()
+	var export onePasswordExport
+	if err = json.NewDecoder(f).Decode(&export); err != nil {
+		return nil, fmt.Errorf("invalid 1Password export: %w", err)
+	}
+
+	var items []foreignItem
+	for _, account := range export.Accounts {
+		for _, vault := range account.Vaults {
+			for _, op := range vault.Items {
+				if op.State == "deleted" {
+					continue
+				}
+				it := foreignItem{
+					folders:  []string{vault.Attrs.Name},
+					title:    op.Overview.Title,
+					url:      op.Overview.URL,
+					password: op.Details.Password,
+					notes:    op.Details.NotesPlain,
+					modified: time.Unix(op.UpdatedAt, 0).UTC(),
+				}
+				for _, lf := range op.Details.LoginFields {
+					switch {
+					case lf.Designation == "username":
+						it.username = lf.Value
+					case lf.Designation == "password":
+						it.password = lf.Value
+					case lf.Value != "":
+						it.fields = append(it.fields, foreignField{lf.Name, lf.Value, lf.FieldType == "P"})
+					}
+				}
+				for _, section := range op.Details.Sections {
+					for _, sf := range section.Fields {
+						name := sf.Title
+						if name == "" {
+							name = sf.ID
+						}
+						for kind, raw := range sf.Value {
+							var val string
+							if json.Unmarshal(raw, &val) != nil {
+								// Dates, addresses, and the like
+								val = strings.Trim(string(raw), `"`)
+							}
+							switch kind {
+							case "totp":
+								it.totp = val
+							default:
+								it.fields = append(it.fields, foreignField{name, val, kind == "concealed"})
+							}
+						}
+					}
+				}
+				items = append(items, it)
+			}
+		}
+	}
+
+	return foreignDump(items), nil
+}
+
+// Returns the rows of a CSV file with a header as maps from its lowercase
+// column names to their values, or an error if unsuccessful
+func csvRecords(data []byte) ([]map[string]string, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("invalid CSV: no header")
+	}
+
+	var records []map[string]string
+	for _, row := range rows[1:] {
+		rec := map[string]string{}
+		for i, col := range rows[0] {
+			if i < len(row) {
+				rec[strings.ToLower(strings.TrimSpace(col))] = row[i]
+			}
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
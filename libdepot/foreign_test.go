@@ -0,0 +1,459 @@
+package libdepot
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20"
+)
+
+// Returns the dump's entries as a map from keys to values, with a * after
+// the secret ones
+func dumpValues(dump *DepotDump) map[string]string {
+	vals := map[string]string{}
+	for _, e := range dump.Entries {
+		if e.Secret {
+			vals[e.Key] = e.Value + "*"
+		} else {
+			vals[e.Key] = e.Value
+		}
+	}
+
+	return vals
+}
+
+func checkValues(t *testing.T, name string, got, want map[string]string) {
+	t.Helper()
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%v: expected %v to be %q but got %q", name, k, v, got[k])
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("%v: expected %v keys but got %v", name, len(want), got)
+	}
+}
+
+const kdbxTestXML = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<KeePassFile>
+	<Meta>
+		<DatabaseName>Test</DatabaseName>
+		<RecycleBinEnabled>True</RecycleBinEnabled>
+		<RecycleBinUUID>cmVjeWNsZWJpbnJlY3ljbGU=</RecycleBinUUID>
+	</Meta>
+	<Root>
+		<Group>
+			<UUID>cm9vdHJvb3Ryb290cm9vdA==</UUID>
+			<Name>Passwords</Name>
+			<Entry>
+				<UUID>ZW50cnllbnRyeWVudHJ5MQ==</UUID>
+				<Times><LastModificationTime>2024-01-02T03:04:05Z</LastModificationTime></Times>
+				<String><Key>Title</Key><Value>Bank</Value></String>
+				<String><Key>UserName</Key><Value>alice</Value></String>
+				<String><Key>Password</Key><Value Protected="True">hunter2</Value></String>
+				<String><Key>PIN</Key><Value Protected="True">1234</Value></String>
+				<String><Key>Branch</Key><Value>Main St</Value></String>
+				<History>
+					<Entry>
+						<String><Key>Title</Key><Value>Bank</Value></String>
+						<String><Key>Password</Key><Value Protected="True">old password</Value></String>
+					</Entry>
+				</History>
+			</Entry>
+			<Group>
+				<UUID>ZW1haWxlbWFpbGVtYWlsZQ==</UUID>
+				<Name>Email</Name>
+				<Entry>
+					<String><Key>Title</Key><Value>Work/Mail</Value></String>
+					<String><Key>Password</Key><Value Protected="True">s3cret</Value></String>
+					<String><Key>URL</Key><Value>https://mail.example.com</Value></String>
+					<String><Key>Notes</Key><Value>line one
+line two</Value></String>
+					<String><Key>otp</Key><Value Protected="True">otpauth://totp/x?secret=JBSWY3DPEHPK3PXP</Value></String>
+				</Entry>
+				<Entry>
+					<String><Key>Title</Key><Value>Work/Mail</Value></String>
+					<String><Key>Password</Key><Value Protected="True">other</Value></String>
+				</Entry>
+			</Group>
+			<Group>
+				<UUID>cmVjeWNsZWJpbnJlY3ljbGU=</UUID>
+				<Name>Recycle Bin</Name>
+				<Entry>
+					<String><Key>Title</Key><Value>Deleted</Value></String>
+					<String><Key>Password</Key><Value Protected="True">gone</Value></String>
+				</Entry>
+			</Group>
+		</Group>
+	</Root>
+</KeePassFile>`
+
+// Returns a KeePass database of the given version (3 or 4) with the given
+// XML, in which the values marked protected are given in plain text, locked
+// with password and AES-KDF
+func buildKDBX(t *testing.T, major uint16, password []byte, body string) []byte {
+	t.Helper()
+	masterSeed := bytes.Repeat([]byte{1}, 32)
+	kdfSeed := bytes.Repeat([]byte{2}, 32)
+	iv := bytes.Repeat([]byte{3}, 16)
+	streamKey := bytes.Repeat([]byte{4}, 32)
+	startBytes := bytes.Repeat([]byte{5}, 32)
+	rounds := uint64(100)
+
+	// Protect the values marked so, in order
+	var stream cipher.Stream
+	if major == 3 {
+		stream, _ = kdbxInnerStream(kdbxStreamSalsa20, streamKey)
+	} else {
+		stream, _ = kdbxInnerStream(kdbxStreamChaCha20, streamKey)
+	}
+	re := regexp.MustCompile(`Protected="True">([^<]*)<`)
+	body = re.ReplaceAllStringFunc(body, func(m string) string {
+		val := []byte(re.FindStringSubmatch(m)[1])
+		stream.XORKeyStream(val, val)
+		return `Protected="True">` + base64.StdEncoding.EncodeToString(val) + "<"
+	})
+
+	le32 := func(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+	le64 := func(v uint64) []byte { return binary.LittleEndian.AppendUint64(nil, v) }
+	var header bytes.Buffer
+	binary.Write(&header, binary.LittleEndian, []uint32{kdbxSignature1, kdbxSignature2})
+	binary.Write(&header, binary.LittleEndian, []uint16{1, major})
+	field := func(id byte, data []byte) {
+		header.WriteByte(id)
+		if major == 3 {
+			binary.Write(&header, binary.LittleEndian, uint16(len(data)))
+		} else {
+			binary.Write(&header, binary.LittleEndian, uint32(len(data)))
+		}
+		header.Write(data)
+	}
+	field(kdbxCipherID, kdbxAES256)
+	field(kdbxCompressionFlags, le32(1))
+	field(kdbxMasterSeed, masterSeed)
+	field(kdbxEncryptionIV, iv)
+	if major == 3 {
+		field(kdbxTransformSeed, kdfSeed)
+		field(kdbxTransformRounds, le64(rounds))
+		field(kdbxProtectedStreamKey, streamKey)
+		field(kdbxStreamStartBytes, startBytes)
+		field(kdbxInnerRandomStreamID, le32(kdbxStreamSalsa20))
+	} else {
+		var dict bytes.Buffer
+		dict.Write([]byte{0x00, 0x01})
+		variant := func(typ byte, name string, val []byte) {
+			dict.WriteByte(typ)
+			dict.Write(le32(uint32(len(name))))
+			dict.WriteString(name)
+			dict.Write(le32(uint32(len(val))))
+			dict.Write(val)
+		}
+		variant(kdbxVariantBytes, "$UUID", kdbxAESKDF)
+		variant(kdbxVariantBytes, "S", kdfSeed)
+		variant(kdbxVariantUint64, "R", le64(rounds))
+		dict.WriteByte(kdbxVariantEnd)
+		field(kdbxKdfParameters, dict.Bytes())
+	}
+	field(kdbxEndOfHeader, []byte("\r\n\r\n"))
+
+	composite := sha256.Sum256(password)
+	composite = sha256.Sum256(composite[:])
+	transformed, err := kdbxTransformKey(map[byte][]byte{
+		kdbxTransformSeed:   kdfSeed,
+		kdbxTransformRounds: le64(rounds),
+	}, 3, composite[:])
+	if err != nil {
+		t.Fatalf("error transforming key: %v", err)
+	}
+	key := sha256.Sum256(append(append([]byte{}, masterSeed...), transformed...))
+
+	var plain bytes.Buffer
+	zw := gzip.NewWriter(&plain)
+	if major == 4 {
+		zw.Write([]byte{kdbxInnerRandomStream})
+		zw.Write(le32(4))
+		zw.Write(le32(kdbxStreamChaCha20))
+		zw.Write([]byte{kdbxInnerRandomStreamKey})
+		zw.Write(le32(uint32(len(streamKey))))
+		zw.Write(streamKey)
+		zw.Write([]byte{kdbxInnerEndOfHeader, 0, 0, 0, 0})
+	}
+	zw.Write([]byte(body))
+	zw.Close()
+	payload := plain.Bytes()
+
+	encrypt := func(data []byte) []byte {
+		pad := aes.BlockSize - len(data)%aes.BlockSize
+		data = append(append([]byte{}, data...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+		block, _ := aes.NewCipher(key[:])
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+		return data
+	}
+
+	out := bytes.NewBuffer(append([]byte{}, header.Bytes()...))
+	if major == 3 {
+		sum := sha256.Sum256(payload)
+		var blocks bytes.Buffer
+		blocks.Write(startBytes)
+		blocks.Write(le32(0))
+		blocks.Write(sum[:])
+		blocks.Write(le32(uint32(len(payload))))
+		blocks.Write(payload)
+		blocks.Write(le32(1))
+		blocks.Write(make([]byte, 32))
+		blocks.Write(le32(0))
+		out.Write(encrypt(blocks.Bytes()))
+		return out.Bytes()
+	}
+
+	hmacBase := sha512.Sum512(append(append(append([]byte{}, masterSeed...), transformed...), 1))
+	sum := sha256.Sum256(header.Bytes())
+	out.Write(sum[:])
+	mac := hmac.New(sha256.New, kdbxHMACKey(hmacBase[:], ^uint64(0)))
+	mac.Write(header.Bytes())
+	out.Write(mac.Sum(nil))
+	encrypted := encrypt(payload)
+	for i, data := range [][]byte{encrypted, nil} {
+		block := append(le32(uint32(len(data))), data...)
+		mac := hmac.New(sha256.New, kdbxHMACKey(hmacBase[:], uint64(i)))
+		mac.Write(le64(uint64(i)))
+		mac.Write(block)
+		out.Write(mac.Sum(nil))
+		out.Write(block)
+	}
+
+	return out.Bytes()
+}
+
+func TestParseKeePass(t *testing.T) {
+	password := []byte("password")
+	want := map[string]string{
+		"Bank":                  "hunter2*",
+		"Bank/username":         "alice",
+		"Bank/PIN":              "1234*",
+		"Bank/Branch":           "Main St",
+		"Email/Work-Mail":       "s3cret*",
+		"Email/Work-Mail/url":   "https://mail.example.com",
+		"Email/Work-Mail/notes": "line one\nline two*",
+		"Email/Work-Mail/totp":  "otpauth://totp/x?secret=JBSWY3DPEHPK3PXP*",
+		"Email/Work-Mail 2":     "other*",
+	}
+
+	for _, major := range []uint16{3, 4} {
+		data := buildKDBX(t, major, password, kdbxTestXML)
+		dump, err := ParseKeePass(data, password)
+		if err != nil {
+			t.Fatalf("KDBX %v: error parsing: %v", major, err)
+		}
+		checkValues(t, fmt.Sprintf("KDBX %v", major), dumpValues(dump), want)
+		for _, e := range dump.Entries {
+			if e.Key == "Bank" && e.Modified.Format("2006-01-02") != "2024-01-02" {
+				t.Errorf("KDBX %v: expected Bank to be modified 2024-01-02 but got %v", major, e.Modified)
+			}
+		}
+
+		if _, err = ParseKeePass(data, []byte("wrong")); !errors.Is(err, ErrBadPassword) {
+			t.Errorf("KDBX %v: expected %v but got %v", major, ErrBadPassword, err)
+		}
+	}
+	if _, err := ParseKeePass([]byte("not a database"), password); err == nil {
+		t.Errorf("expected an error parsing something that is not a database")
+	}
+}
+
+func TestKeePassStreams(t *testing.T) {
+	// The stream carries on across calls, whatever their lengths
+	for _, id := range []uint32{kdbxStreamSalsa20, kdbxStreamChaCha20} {
+		whole, _ := kdbxInnerStream(id, []byte("key"))
+		pieces, _ := kdbxInnerStream(id, []byte("key"))
+		want := make([]byte, 200)
+		whole.XORKeyStream(want, want)
+		got := make([]byte, 200)
+		for _, r := range [][2]int{{0, 1}, {1, 63}, {63, 64}, {64, 130}, {130, 200}} {
+			pieces.XORKeyStream(got[r[0]:r[1]], got[r[0]:r[1]])
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("stream %v: expected the same key stream in pieces as whole", id)
+		}
+	}
+
+	// The streams are keyed as KeePass keys them
+	salsaKey := sha256.Sum256([]byte("key"))
+	want := make([]byte, 200)
+	salsa20.XORKeyStream(want, want, kdbxSalsa20Nonce, &salsaKey)
+	s, _ := kdbxInnerStream(kdbxStreamSalsa20, []byte("key"))
+	got := make([]byte, 200)
+	s.XORKeyStream(got, got)
+	if !bytes.Equal(got, want) {
+		t.Errorf("expected the Salsa20 stream to be keyed with SHA-256 of the key")
+	}
+
+	sum := sha512.Sum512([]byte("key"))
+	c, _ := chacha20.NewUnauthenticatedCipher(sum[:32], sum[32:44])
+	want = make([]byte, 16)
+	c.XORKeyStream(want, want)
+	s, _ = kdbxInnerStream(kdbxStreamChaCha20, []byte("key"))
+	got = make([]byte, 16)
+	s.XORKeyStream(got, got)
+	if !bytes.Equal(got, want) {
+		t.Errorf("expected the ChaCha20 stream to be keyed with SHA-512 of the key")
+	}
+}
+
+func TestParseBitwarden(t *testing.T) {
+	json := `{
+		"encrypted": false,
+		"folders": [{"id": "f1", "name": "Work/Servers"}],
+		"items": [
+			{
+				"folderId": "f1", "type": 1, "name": "db", "notes": null,
+				"revisionDate": "2024-01-02T03:04:05.000Z",
+				"fields": [{"name": "port", "value": "5432", "type": 0}, {"name": "root", "value": "toor", "type": 1}],
+				"login": {"uris": [{"match": null, "uri": "postgres://db"}], "username": "admin", "password": "hunter2", "totp": null}
+			},
+			{
+				"folderId": null, "type": 3, "name": "Visa",
+				"card": {"cardholderName": "Alice", "number": "4111111111111111", "code": "123", "expMonth": "1"}
+			},
+			{"folderId": null, "type": 2, "name": "Note", "notes": "remember this", "secureNote": {"type": 0}}
+		]
+	}`
+	dump, err := ParseBitwarden([]byte(json))
+	if err != nil {
+		t.Fatalf("error parsing JSON: %v", err)
+	}
+	checkValues(t, "JSON", dumpValues(dump), map[string]string{
+		"Work/Servers/db":          "hunter2*",
+		"Work/Servers/db/username": "admin",
+		"Work/Servers/db/url":      "postgres://db",
+		"Work/Servers/db/port":     "5432",
+		"Work/Servers/db/root":     "toor*",
+		"Visa/cardholderName":      "Alice",
+		"Visa/number":              "4111111111111111*",
+		"Visa/code":                "123*",
+		"Visa/expMonth":            "1",
+		"Note/notes":               "remember this*",
+	})
+
+	csv := "folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp\n" +
+		"Work,,login,db,,\"port: 5432\nhost: db\",0,\"postgres://db,postgres://db2\",admin,hunter2,JBSWY3DPEHPK3PXP\n" +
+		",,note,Note,remember this,,0,,,,\n"
+	if dump, err = ParseBitwarden([]byte(csv)); err != nil {
+		t.Fatalf("error parsing CSV: %v", err)
+	}
+	checkValues(t, "CSV", dumpValues(dump), map[string]string{
+		"Work/db":          "hunter2*",
+		"Work/db/username": "admin",
+		"Work/db/url":      "postgres://db",
+		"Work/db/totp":     "JBSWY3DPEHPK3PXP*",
+		"Work/db/port":     "5432",
+		"Work/db/host":     "db",
+		"Note/notes":       "remember this*",
+	})
+
+	if _, err = ParseBitwarden([]byte(`{"encrypted": true, "data": "..."}`)); err == nil {
+		t.Errorf("expected an error parsing an encrypted export")
+	}
+}
+
+func TestParseOnePassword(t *testing.T) {
+	csv := "Title,Url,Username,Password,OTPAuth,Favorite,Archived,Tags,Notes\n" +
+		"Bank,https://bank.example.com,alice,hunter2,,false,false,,call first\n"
+	dump, err := ParseOnePassword([]byte(csv))
+	if err != nil {
+		t.Fatalf("error parsing CSV: %v", err)
+	}
+	checkValues(t, "CSV", dumpValues(dump), map[string]string{
+		"Bank":          "hunter2*",
+		"Bank/url":      "https://bank.example.com",
+		"Bank/username": "alice",
+		"Bank/notes":    "call first*",
+	})
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("export.data")
+	w.Write([]byte(`{"accounts": [{"vaults": [{"attrs": {"name": "Private"}, "items": [{
+		"updatedAt": 1704164645, "state": "active",
+		"overview": {"title": "Bank", "url": "https://bank.example.com"},
+		"details": {
+			"loginFields": [
+				{"value": "alice", "name": "username", "fieldType": "T", "designation": "username"},
+				{"value": "hunter2", "name": "password", "fieldType": "P", "designation": "password"}
+			],
+			"notesPlain": "",
+			"sections": [{"fields": [
+				{"title": "PIN", "id": "pin", "value": {"concealed": "1234"}},
+				{"title": "", "id": "one-time", "value": {"totp": "otpauth://totp/x?secret=JBSWY3DPEHPK3PXP"}},
+				{"title": "Opened", "id": "opened", "value": {"date": 1704164645}}
+			]}]
+		}
+	}]}]}]}`))
+	zw.Close()
+	if dump, err = ParseOnePassword(buf.Bytes()); err != nil {
+		t.Fatalf("error parsing 1PUX: %v", err)
+	}
+	checkValues(t, "1PUX", dumpValues(dump), map[string]string{
+		"Private/Bank":          "hunter2*",
+		"Private/Bank/url":      "https://bank.example.com",
+		"Private/Bank/username": "alice",
+		"Private/Bank/PIN":      "1234*",
+		"Private/Bank/totp":     "otpauth://totp/x?secret=JBSWY3DPEHPK3PXP*",
+		"Private/Bank/Opened":   "1704164645",
+	})
+	for _, e := range dump.Entries {
+		if e.Modified.Unix() != 1704164645 {
+			t.Errorf("expected %v to be modified at 1704164645 but got %v", e.Key, e.Modified.Unix())
+		}
+	}
+}
+
+func TestMarshalKeePass(t *testing.T) {
+	defer func(m, i uint64) { kdbxArgon2Memory, kdbxArgon2Iterations = m, i }(kdbxArgon2Memory, kdbxArgon2Iterations)
+	kdbxArgon2Memory, kdbxArgon2Iterations = 1<<20, 1
+
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	dump := &DepotDump{Entries: []DumpEntry{
+		{Key: "top", Value: "plain value", Modified: modified},
+		{Key: "db/password", Value: "hunter2", Secret: true, Modified: modified},
+		{Key: "db/replica/password", Value: "multi\nline <xml> & such", Secret: true, Modified: modified},
+		{Key: "db", Value: "a key named as a group", Modified: modified},
+	}}
+	data, err := dump.MarshalKeePass([]byte("kp"))
+	if err != nil {
+		t.Fatalf("error writing KeePass database: %v", err)
+	}
+	if _, err = ParseKeePass(data, []byte("wrong")); !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v but got %v", ErrBadPassword, err)
+	}
+
+	parsed, err := ParseKeePass(data, []byte("kp"))
+	if err != nil {
+		t.Fatalf("error parsing KeePass database: %v", err)
+	}
+	checkValues(t, "round trip", dumpValues(parsed), map[string]string{
+		"top":                 "plain value*",
+		"db/password":         "hunter2*",
+		"db/replica/password": "multi\nline <xml> & such*",
+		"db":                  "a key named as a group*",
+	})
+	for _, e := range parsed.Entries {
+		if !e.Modified.Equal(modified) {
+			t.Errorf("expected %v to be modified at %v but got %v", e.Key, modified, e.Modified)
+		}
+	}
+}
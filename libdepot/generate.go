@@ -0,0 +1,77 @@
+package libdepot
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/sethvargo/go-diceware/diceware"
+)
+
+const (
+	// How many characters GeneratePassword is usually asked for
+	DefaultPasswordLength = 24
+
+	// How many words GeneratePassphrase is usually asked for, which gives
+	// about 77 bits of entropy
+	DefaultPassphraseWords = 6
+)
+
+// The kinds of characters a generated password is made of. Every kind in use
+// appears at least once, since many sites insist on it.
+var (
+	passwordLower   = "abcdefghijklmnopqrstuvwxyz"
+	passwordUpper   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	passwordDigits  = "0123456789"
+	passwordSymbols = "!#$%&()*+,-./:;<=>?@[]^_{|}~"
+)
+
+// Returns a random password of length letters and digits, and symbols as well
+// if symbols is true, with at least one of each, or an error if unsuccessful
+func GeneratePassword(length int, symbols bool) (string, error) {
+	classes := []string{passwordLower, passwordUpper, passwordDigits}
+	if symbols {
+		classes = append(classes, passwordSymbols)
+	}
+	if length < len(classes) {
+		return "", fmt.Errorf("password must be at least %v characters long", len(classes))
+	}
+	alphabet := strings.Join(classes, "")
+
+	// Draw whole passwords until one has every kind of character, which
+	// keeps every password that does equally likely
+	password := make([]byte, length)
+	for {
+		for i := range password {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+			if err != nil {
+				return "", fmt.Errorf("cannot generate password: %w", err)
+			}
+			password[i] = alphabet[n.Int64()]
+		}
+
+		complete := true
+		for _, class := range classes {
+			complete = complete && strings.ContainsAny(string(password), class)
+		}
+		if complete {
+			return string(password), nil
+		}
+	}
+}
+
+// Returns a diceware passphrase of the given number of words from the EFF's
+// large word list, joined by hyphens, or an error if unsuccessful
+func GeneratePassphrase(words int) (string, error) {
+	if words < 1 {
+		return "", fmt.Errorf("passphrase must be at least 1 word long")
+	}
+
+	list, err := diceware.Generate(words)
+	if err != nil {
+		return "", fmt.Errorf("cannot generate passphrase: %w", err)
+	}
+
+	return strings.Join(list, "-"), nil
+}
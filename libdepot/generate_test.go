@@ -0,0 +1,56 @@
+package libdepot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGeneratePassword(t *testing.T) {
+	password, err := GeneratePassword(DefaultPasswordLength, false)
+	if err != nil {
+		t.Fatalf("error generating password: %v", err)
+	}
+	if len(password) != DefaultPasswordLength {
+		t.Errorf("expected %v characters but got %q", DefaultPasswordLength, password)
+	}
+	if strings.ContainsAny(password, passwordSymbols) {
+		t.Errorf("expected no symbols but got %q", password)
+	}
+	if entropy := EstimateEntropy([]byte(password)); entropy < MinPasswordEntropy {
+		t.Errorf("expected a strong password but %q has %.0f bits", password, entropy)
+	}
+
+	// Short passwords still get one of every kind of character
+	for i := 0; i < 100; i++ {
+		password, err = GeneratePassword(4, true)
+		if err != nil {
+			t.Fatalf("error generating password: %v", err)
+		}
+		for _, class := range []string{passwordLower, passwordUpper, passwordDigits, passwordSymbols} {
+			if !strings.ContainsAny(password, class) {
+				t.Fatalf("expected one of %q in %q", class, password)
+			}
+		}
+	}
+
+	if _, err = GeneratePassword(3, true); err == nil {
+		t.Errorf("expected an error generating a password too short for every kind of character")
+	}
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	passphrase, err := GeneratePassphrase(DefaultPassphraseWords)
+	if err != nil {
+		t.Fatalf("error generating passphrase: %v", err)
+	}
+	if words := strings.Split(passphrase, "-"); len(words) < DefaultPassphraseWords {
+		t.Errorf("expected %v words but got %q", DefaultPassphraseWords, passphrase)
+	}
+	if other, _ := GeneratePassphrase(DefaultPassphraseWords); other == passphrase {
+		t.Errorf("expected passphrases to differ but got %q twice", passphrase)
+	}
+
+	if _, err = GeneratePassphrase(0); err == nil {
+		t.Errorf("expected an error generating a passphrase of no words")
+	}
+}
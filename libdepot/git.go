@@ -0,0 +1,241 @@
+package libdepot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A Backend whose storage can be exchanged with a remote copy
+type Remote interface {
+	// Brings in changes from the remote, merging them with local ones
+	Pull() error
+
+	// Sends local changes to the remote
+	Push() error
+}
+
+// A Backend that keeps entries in a directory tree, as NewFSBackend does, and
+// commits every change to the git repository at its root. The history of the
+// repository records every change to the depot, and pushing to and pulling
+// from a remote keeps several machines in step. Values are committed as they
+// are stored, so plaintext values are readable by anyone with the repository.
+type gitBackend struct {
+	mu   sync.Mutex
+	fs   Backend
+	root string
+	lock fileLock
+}
+
+// Returns a Backend stored in the git repository at root, creating the
+// repository if it does not exist, or an error if initialization is
+// unsuccessful. The git command must be installed.
+func NewGitBackend(root string) (Backend, error) {
+	fs, err := NewFSBackend(root)
+	if err != nil {
+		return nil, err
+	}
+
+	// The lock file is kept out of the tree, which is committed as it is
+	b := &gitBackend{fs: fs, root: root}
+	b.lock.path = filepath.Join(root, ".git", "depot.lock")
+	if _, err = os.Stat(filepath.Join(root, ".git")); errors.Is(err, os.ErrNotExist) {
+		if _, err = b.git("init", "-q"); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot access depot directory: %w", err)
+	}
+
+	// Commits need an author, so fall back on one if git has none configured
+	if name, _ := b.git("config", "user.name"); name == "" {
+		if _, err = b.git("config", "user.name", "depot"); err != nil {
+			return nil, err
+		}
+	}
+	if email, _ := b.git("config", "user.email"); email == "" {
+		if _, err = b.git("config", "user.email", "depot@localhost"); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// Runs git in the repository with the given arguments and returns its
+// output or an error if unsuccessful
+func (b *gitBackend) git(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", b.root}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %v: %v", args[0], msg)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Commits every change in the tree with the given message, if there are any.
+// Returns an error if unsuccessful.
+func (b *gitBackend) commit(msg string) error {
+	if _, err := b.git("add", "-A"); err != nil {
+		return err
+	}
+	if status, err := b.git("status", "--porcelain"); err != nil || status == "" {
+		return err
+	}
+
+	_, err := b.git("commit", "-q", "-m", msg)
+	return err
+}
+
+func (b *gitBackend) Get(key string) (*Entry, error) {
+	return b.fs.Get(key)
+}
+
+func (b *gitBackend) Put(e *Entry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.fs.Put(e); err != nil {
+		return err
+	}
+	if e.Deleted {
+		return b.commit("Drop " + e.Key)
+	}
+
+	return b.commit("Stow " + e.Key)
+}
+
+func (b *gitBackend) Delete(key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.fs.Delete(key); err != nil {
+		return err
+	}
+
+	return b.commit("Purge " + key)
+}
+
+func (b *gitBackend) List(prefix string) ([]*Entry, error) {
+	return b.fs.List(prefix)
+}
+
+func (b *gitBackend) Meta(name string) ([]byte, error) {
+	return b.fs.Meta(name)
+}
+
+func (b *gitBackend) SetMeta(name string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.fs.SetMeta(name, data); err != nil {
+		return err
+	}
+
+	return b.commit("Set " + name)
+}
+
+func (b *gitBackend) Close() error {
+	return b.fs.Close()
+}
+
+func (b *gitBackend) Lock() (func(), error) {
+	return b.lock.Lock()
+}
+
+func (b *gitBackend) Files() ([]string, error) {
+	return b.fs.(FileBackend).Files()
+}
+
+// Pulls from the repository's upstream. When both sides changed the same key,
+// the entry modified most recently is kept.
+func (b *gitBackend) Pull() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, pullErr := b.git("pull", "-q", "--no-rebase", "--no-edit")
+	if pullErr == nil {
+		return nil
+	}
+
+	conflicted, err := b.git("diff", "-z", "--name-only", "--diff-filter=U")
+	if err != nil || conflicted == "" {
+		return pullErr
+	}
+	for _, name := range strings.Split(strings.Trim(conflicted, "\x00"), "\x00") {
+		if err = b.resolve(name); err != nil {
+			b.git("merge", "--abort")
+			return err
+		}
+	}
+
+	_, err = b.git("commit", "-q", "--no-edit")
+	return err
+}
+
+// Settles a file that was changed on both sides of a merge and stages the
+// result. Returns an error if unsuccessful.
+func (b *gitBackend) resolve(name string) error {
+	if name == fsMetaDir+"/salt" {
+		return fmt.Errorf("cannot merge %v: %w", name, ErrSaltMismatch)
+	} else if strings.HasPrefix(name, fsMetaDir+"/") || !strings.HasSuffix(name, fsEntryExt) {
+		// Other metadata, such as when tombstones were last purged, is local
+		_, err := b.git("checkout", "--ours", "--", name)
+		if err == nil {
+			_, err = b.git("add", "--", name)
+		}
+		return err
+	}
+
+	// Stage 2 is our side of the merge and stage 3 is theirs. A side that
+	// purged the entry has nothing to offer.
+	var newest string
+	var newestEntry *Entry
+	for _, stage := range []string{":2:", ":3:"} {
+		data, err := b.git("show", stage+name)
+		if err != nil {
+			continue
+		}
+		var e Entry
+		if err = json.Unmarshal([]byte(data), &e); err != nil {
+			return fmt.Errorf("cannot merge %v: %w", name, err)
+		}
+		if newestEntry == nil || e.Modified.After(newestEntry.Modified) {
+			newest, newestEntry = data, &e
+		}
+	}
+	if newestEntry == nil {
+		_, err := b.git("rm", "-q", "--", name)
+		return err
+	}
+
+	err := writeFileAtomic(filepath.Join(b.root, filepath.FromSlash(name)), []byte(newest+"\n"))
+	if err != nil {
+		return err
+	}
+	_, err = b.git("add", "--", name)
+	return err
+}
+
+// Pushes to the repository's upstream
+func (b *gitBackend) Push() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, err := b.git("push", "-q")
+	return err
+}
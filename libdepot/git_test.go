@@ -0,0 +1,114 @@
+package libdepot
+
+import (
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Skips the test if git is not installed
+func needGit(t *testing.T) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+}
+
+// Runs git with the given arguments, failing the test if it is unsuccessful
+func runGit(t *testing.T, args ...string) string {
+	t.Helper()
+
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args[0], err, out)
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+func TestGitBackend(t *testing.T) {
+	needGit(t)
+	dir := t.TempDir()
+
+	b, err := NewGitBackend(dir)
+	if err != nil {
+		t.Fatalf("failed to initialize backend: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	testBackend(t, b)
+	if log := runGit(t, "-C", dir, "log", "--format=%s"); !strings.Contains(log, "Stow backend/a") {
+		t.Errorf("expected a commit for every change but the log was %q", log)
+	}
+}
+
+func TestGitRemote(t *testing.T) {
+	needGit(t)
+	dir := t.TempDir()
+	origin := filepath.Join(dir, "origin.git")
+	runGit(t, "init", "-q", "--bare", origin)
+
+	a, err := NewDepot("git://" + filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { a.Close() })
+	if err = a.Stow("shared", "first", []byte("password")); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	runGit(t, "-C", filepath.Join(dir, "a"), "remote", "add", "origin", origin)
+	runGit(t, "-C", filepath.Join(dir, "a"), "push", "-q", "-u", "origin", "HEAD")
+
+	// git makes the clone with the umask's permissions
+	runGit(t, "clone", "-q", origin, filepath.Join(dir, "b"))
+	b, err := NewDepot("git://"+filepath.Join(dir, "b"), WithInsecureFileFunc(func(string, fs.FileMode) error {
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+	if val, err := b.Fetch("shared", []byte("password")); err != nil || val != "first" {
+		t.Fatalf("expected first in the clone but got %q (%v)", val, err)
+	}
+
+	// Both change the same key, and the later change wins
+	if err = a.Stow("shared", "older", nil); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	if err = a.Stow("only-a", "a", nil); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	if err = a.Push(); err != nil {
+		t.Fatalf("error pushing: %v", err)
+	}
+	if err = b.Stow("shared", "newer", nil); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	if err = b.Pull(); err != nil {
+		t.Fatalf("error pulling: %v", err)
+	}
+	if err = b.Push(); err != nil {
+		t.Fatalf("error pushing: %v", err)
+	}
+	if err = a.Pull(); err != nil {
+		t.Fatalf("error pulling: %v", err)
+	}
+
+	for _, d := range []*Depot{a, b} {
+		if val, _ := d.Fetch("shared", nil); val != "newer" {
+			t.Errorf("expected newer to win but got %v", val)
+		}
+		if val, _ := d.Fetch("only-a", nil); val != "a" {
+			t.Errorf("expected a to be merged but got %v", val)
+		}
+	}
+
+	mdb, _ := NewMemDepot()
+	if err = mdb.Pull(); err == nil {
+		t.Errorf("expected an error pulling a depot without a remote")
+	}
+}
@@ -0,0 +1,461 @@
+package libdepot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/adonSh/depot/libdepot/depotpb"
+)
+
+// How long a single call to a gRPC depot server may take
+const grpcTimeout = 30 * time.Second
+
+// Implements the Depot service of depotpb for a depot
+type grpcServer struct {
+	depotpb.UnimplementedDepotServer
+	depot *Depot
+}
+
+// Returns a gRPC server offering the Depot service of depotpb for the given
+// depot, which admits calls bearing token as the owner, and those bearing the
+// tokens of the depot's users, who are held to their rules as with Server.
+// Options such as grpc.Creds are passed along to grpc.NewServer.
+func NewGRPCServer(db *Depot, token string, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			ctx, err := grpcAuthorize(ctx, db, token)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := grpcAuthorize(ss.Context(), db, token)
+			if err != nil {
+				return err
+			}
+			return handler(srv, grpcStream{ss, ctx})
+		}),
+	)
+
+	s := grpc.NewServer(opts...)
+	depotpb.RegisterDepotServer(s, &grpcServer{depot: db})
+
+	return s
+}
+
+// Identifies the user making a call in its context
+type grpcUserKey struct{}
+
+// A server stream with the user making the call in its context
+type grpcStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s grpcStream) Context() context.Context {
+	return s.ctx
+}
+
+// Returns ctx with the user whose bearer token the call carries, or an error
+// if there is no such user or the caller is held back by the depot's rate
+// limit
+func grpcAuthorize(ctx context.Context, db *Depot, token string) (context.Context, error) {
+	addr, bearer := grpcClient(ctx)
+	if wait := db.throttle(addr, bearer); wait > 0 {
+		return nil, status.Errorf(codes.ResourceExhausted, "%v, try again in %v",
+			ErrRateLimited, wait.Round(time.Second))
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	auth := md.Get("authorization")
+	if len(auth) != 1 || !strings.HasPrefix(auth[0], "Bearer ") {
+		db.failedRequest(addr, "", ErrUnauthorized)
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	user, err := db.authenticate(token, bearer)
+	if errors.Is(err, ErrUnauthorized) {
+		db.failedRequest(addr, bearer, err)
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	} else if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return context.WithValue(ctx, grpcUserKey{}, user), nil
+}
+
+// Returns the address the call comes from, without its port, and the bearer
+// token it carries, if any
+func grpcClient(ctx context.Context) (string, string) {
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if auth := md.Get("authorization"); len(auth) == 1 {
+		token, _ = strings.CutPrefix(auth[0], "Bearer ")
+	}
+
+	return addr, token
+}
+
+// Returns the user making the call
+func grpcUser(ctx context.Context) *User {
+	user, _ := ctx.Value(grpcUserKey{}).(*User)
+	if user == nil {
+		return &User{}
+	}
+
+	return user
+}
+
+// Returns the depot acting on behalf of the user making the call
+func (s *grpcServer) depotFor(ctx context.Context) *Depot {
+	return s.depot.as(grpcUser(ctx).Name)
+}
+
+// Returns a PermissionDenied status unless the user making the call has perm
+// on key, and on the key it stands for if it is an alias, recording the
+// refusal to do action in the audit log
+func grpcCheck(ctx context.Context, db *Depot, key string, perm Permission, action string) error {
+	if ok, err := db.userCan(grpcUser(ctx), key, perm); err != nil {
+		return grpcError(err)
+	} else if !ok {
+		return grpcError(db.audit(action, key, ErrForbidden))
+	}
+
+	return nil
+}
+
+// Converts an error into a gRPC status with a fitting code
+func grpcError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, ErrPasswordNeeded), errors.Is(err, ErrBadPassword), errors.Is(err, ErrForbidden):
+		code = codes.PermissionDenied
+	case errors.Is(err, ErrWeakPassword), errors.Is(err, ErrInvalidKey), errors.Is(err, ErrInvalidParams),
+		errors.Is(err, ErrTooLarge):
+		code = codes.InvalidArgument
+	case errors.Is(err, ErrRateLimited):
+		code = codes.ResourceExhausted
+	}
+
+	return status.Error(code, err.Error())
+}
+
+func entryToProto(e *Entry) *depotpb.Entry {
+	return &depotpb.Entry{
+		Key:         e.Key,
+		Val:         e.Val,
+		Nonce:       e.Nonce,
+		Check:       e.Check,
+		Salt:        e.Salt,
+		Modified:    timestamppb.New(e.Modified),
+		Deleted:     e.Deleted,
+		Compression: e.Compression,
+		Cipher:      e.Cipher,
+		KeySalt:     e.KeySalt,
+	}
+}
+
+func entryFromProto(e *depotpb.Entry) *Entry {
+	return &Entry{
+		Key:         e.GetKey(),
+		Val:         e.GetVal(),
+		Nonce:       e.GetNonce(),
+		Check:       e.GetCheck(),
+		Salt:        e.GetSalt(),
+		Modified:    e.GetModified().AsTime(),
+		Deleted:     e.GetDeleted(),
+		Compression: e.GetCompression(),
+		Cipher:      e.GetCipher(),
+		KeySalt:     e.GetKeySalt(),
+	}
+}
+
+func (s *grpcServer) GetEntry(ctx context.Context, req *depotpb.GetEntryRequest) (*depotpb.Entry, error) {
+	db := s.depotFor(ctx)
+	if err := grpcCheck(ctx, db, req.GetKey(), PermRead, AuditFetch); err != nil {
+		return nil, err
+	}
+
+	e, err := db.backend.Get(req.GetKey())
+	if err = db.audit(AuditFetch, req.GetKey(), err); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return entryToProto(e), nil
+}
+
+func (s *grpcServer) PutEntry(ctx context.Context, req *depotpb.Entry) (*emptypb.Empty, error) {
+	db := s.depotFor(ctx)
+	if err := grpcCheck(ctx, db, req.GetKey(), PermWrite, AuditStow); err != nil {
+		return nil, err
+	}
+	e := entryFromProto(req)
+	if err := db.auditPut(e, db.putChecked(e)); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcServer) DeleteEntry(ctx context.Context, req *depotpb.DeleteEntryRequest) (*emptypb.Empty, error) {
+	db := s.depotFor(ctx)
+	if err := grpcCheck(ctx, db, req.GetKey(), PermWrite, AuditDrop); err != nil {
+		return nil, err
+	}
+	if err := db.deleteEntry(grpcUser(ctx), req.GetKey()); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcServer) ListEntries(req *depotpb.ListEntriesRequest, stream depotpb.Depot_ListEntriesServer) error {
+	entries, err := s.depot.backend.List(req.GetPrefix())
+	if err != nil {
+		return grpcError(err)
+	}
+
+	user := grpcUser(stream.Context())
+	for _, e := range entries {
+		if !user.Can(e.Key, PermRead) {
+			continue
+		}
+		if err = stream.Send(entryToProto(e)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *grpcServer) GetMeta(ctx context.Context, req *depotpb.GetMetaRequest) (*depotpb.Meta, error) {
+	if !grpcUser(ctx).canReadMeta(req.GetName()) {
+		return nil, grpcError(ErrForbidden)
+	}
+	data, err := s.depot.backend.Meta(req.GetName())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &depotpb.Meta{Name: req.GetName(), Data: data}, nil
+}
+
+func (s *grpcServer) SetMeta(ctx context.Context, req *depotpb.Meta) (*emptypb.Empty, error) {
+	if err := s.depot.checkMetaWrite(grpcUser(ctx), req.GetName(), req.GetData()); err != nil {
+		return nil, grpcError(err)
+	}
+	if err := s.depot.backend.SetMeta(req.GetName(), req.GetData()); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcServer) Fetch(ctx context.Context, req *depotpb.FetchRequest) (*depotpb.FetchResponse, error) {
+	db := s.depotFor(ctx)
+	if err := grpcCheck(ctx, db, req.GetKey(), PermRead, AuditFetch); err != nil {
+		return nil, err
+	}
+	val, err := db.Fetch(req.GetKey(), req.Password)
+	if err != nil {
+		addr, token := grpcClient(ctx)
+		s.depot.failedRequest(addr, token, err)
+		return nil, grpcError(err)
+	}
+
+	return &depotpb.FetchResponse{Value: val}, nil
+}
+
+func (s *grpcServer) Stow(ctx context.Context, req *depotpb.StowRequest) (*emptypb.Empty, error) {
+	db := s.depotFor(ctx)
+	if err := grpcCheck(ctx, db, req.GetKey(), PermWrite, AuditStow); err != nil {
+		return nil, err
+	}
+	if err := db.Stow(req.GetKey(), req.GetValue(), req.Password); err != nil {
+		addr, token := grpcClient(ctx)
+		s.depot.failedRequest(addr, token, err)
+		return nil, grpcError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcServer) Drop(ctx context.Context, req *depotpb.DropRequest) (*emptypb.Empty, error) {
+	db := s.depotFor(ctx)
+	if err := grpcCheck(ctx, db, req.GetKey(), PermWrite, AuditDrop); err != nil {
+		return nil, err
+	}
+	if err := db.Drop(req.GetKey()); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// Attaches a bearer token to every call
+type grpcToken struct {
+	token  string
+	secure bool
+}
+
+func (t grpcToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+func (t grpcToken) RequireTransportSecurity() bool {
+	return t.secure
+}
+
+// A Backend that talks to a remote depot server over its gRPC API. As with
+// the HTTP backend, values are encrypted before they leave the client.
+type grpcBackend struct {
+	conn   *grpc.ClientConn
+	client depotpb.DepotClient
+}
+
+// Returns a Backend served by the remote depot at uri, a grpc://host:port
+// address or grpcs://host:port to use TLS, authenticating with the given
+// bearer token if it is not empty
+func NewGRPCBackend(uri, token string) (Backend, error) {
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "grpc" && u.Scheme != "grpcs") || u.Host == "" {
+		return nil, fmt.Errorf("invalid depot server address: %v", uri)
+	}
+
+	secure := u.Scheme == "grpcs"
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if secure {
+		opts[0] = grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(nil, ""))
+	}
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(grpcToken{token, secure}))
+	}
+
+	conn, err := grpc.NewClient(u.Host, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid depot server address: %w", err)
+	}
+
+	return &grpcBackend{conn, depotpb.NewDepotClient(conn)}, nil
+}
+
+// Converts an error from a call into one like those of the other backends
+func grpcClientError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	s := status.Convert(err)
+	switch s.Code() {
+	case codes.NotFound:
+		return ErrNotFound
+	case codes.ResourceExhausted:
+		return fmt.Errorf("depot server: %w", ErrRateLimited)
+	}
+
+	return errors.New("depot server: " + s.Message())
+}
+
+func (b *grpcBackend) Get(key string) (*Entry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), grpcTimeout)
+	defer cancel()
+
+	e, err := b.client.GetEntry(ctx, &depotpb.GetEntryRequest{Key: key})
+	if err != nil {
+		return nil, grpcClientError(err)
+	}
+
+	return entryFromProto(e), nil
+}
+
+func (b *grpcBackend) Put(e *Entry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), grpcTimeout)
+	defer cancel()
+
+	_, err := b.client.PutEntry(ctx, entryToProto(e))
+	return grpcClientError(err)
+}
+
+func (b *grpcBackend) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), grpcTimeout)
+	defer cancel()
+
+	_, err := b.client.DeleteEntry(ctx, &depotpb.DeleteEntryRequest{Key: key})
+	if err = grpcClientError(err); errors.Is(err, ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+func (b *grpcBackend) List(prefix string) ([]*Entry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), grpcTimeout)
+	defer cancel()
+
+	stream, err := b.client.ListEntries(ctx, &depotpb.ListEntriesRequest{Prefix: prefix})
+	if err != nil {
+		return nil, grpcClientError(err)
+	}
+
+	var entries []*Entry
+	for {
+		e, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, grpcClientError(err)
+		}
+		entries = append(entries, entryFromProto(e))
+	}
+
+	return entries, nil
+}
+
+func (b *grpcBackend) Meta(name string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), grpcTimeout)
+	defer cancel()
+
+	m, err := b.client.GetMeta(ctx, &depotpb.GetMetaRequest{Name: name})
+	if err != nil {
+		return nil, grpcClientError(err)
+	}
+
+	return m.GetData(), nil
+}
+
+func (b *grpcBackend) SetMeta(name string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), grpcTimeout)
+	defer cancel()
+
+	_, err := b.client.SetMeta(ctx, &depotpb.Meta{Name: name, Data: data})
+	return grpcClientError(err)
+}
+
+func (b *grpcBackend) Close() error {
+	return b.conn.Close()
+}
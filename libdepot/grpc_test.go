@@ -0,0 +1,207 @@
+package libdepot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/adonSh/depot/libdepot/depotpb"
+)
+
+// Serves a depot kept in memory over the gRPC API and returns its address
+func testGRPCServer(t *testing.T, token string) string {
+	t.Helper()
+
+	mdb, err := NewMemDepot()
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := NewGRPCServer(mdb, token)
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+
+	return l.Addr().String()
+}
+
+func TestGRPCBackend(t *testing.T) {
+	addr := testGRPCServer(t, "token")
+
+	b, err := NewGRPCBackend("grpc://"+addr, "token")
+	if err != nil {
+		t.Fatalf("failed to initialize backend: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	testBackend(t, b)
+}
+
+func TestGRPCDepot(t *testing.T) {
+	key := "remote/key"
+	data := "testing123"
+	password := []byte("password")
+	addr := testGRPCServer(t, "token")
+
+	if _, err := NewDepot("grpc://"+addr, WithToken("wrong")); err == nil {
+		t.Errorf("expected an error connecting with the wrong token but there was none")
+	}
+
+	rdb, err := NewDepot("grpc://"+addr, WithToken("token"))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+
+	if err = rdb.Stow(key, data, password); err != nil {
+		t.Errorf("error inserting ciphertext into depot: %v", err.Error())
+	}
+	val, err := rdb.Fetch(key, password)
+	if err != nil {
+		t.Errorf("error fetching %v from depot: %v", key, err.Error())
+	}
+	if val != data {
+		t.Errorf("expected %v but %v was retrieved for key %v", data, val, key)
+	}
+}
+
+func TestGRPCValues(t *testing.T) {
+	addr := testGRPCServer(t, "token")
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(grpcToken{"token", false}))
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := depotpb.NewDepotClient(conn)
+	ctx := context.Background()
+
+	_, err = client.Stow(ctx, &depotpb.StowRequest{Key: "k", Value: "secret", Password: []byte("password")})
+	if err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+
+	resp, err := client.Fetch(ctx, &depotpb.FetchRequest{Key: "k", Password: []byte("password")})
+	if err != nil {
+		t.Errorf("error fetching value: %v", err)
+	} else if resp.GetValue() != "secret" {
+		t.Errorf("expected secret but %v was retrieved", resp.GetValue())
+	}
+
+	_, err = client.Fetch(ctx, &depotpb.FetchRequest{Key: "k"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied fetching without a password but got %v", err)
+	}
+
+	if _, err = client.Drop(ctx, &depotpb.DropRequest{Key: "k"}); err != nil {
+		t.Errorf("error dropping value: %v", err)
+	}
+	_, err = client.Fetch(ctx, &depotpb.FetchRequest{Key: "k"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound after dropping but got %v", err)
+	}
+}
+
+func TestGRPCUsers(t *testing.T) {
+	mdb, _ := NewMemDepot()
+	token, err := mdb.AddUser("alice", false)
+	if err != nil {
+		t.Fatalf("error adding user: %v", err)
+	}
+	mdb.Grant("alice", "team/", PermRead)
+	mdb.Stow("team/key", "team", nil)
+	mdb.Stow("private/key", "private", nil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := NewGRPCServer(mdb, "token")
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+
+	rdb, err := NewDepot("grpc://"+l.Addr().String(), WithToken(token))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+
+	if val, err := rdb.Fetch("team/key", nil); err != nil || val != "team" {
+		t.Errorf("expected team but got %q (%v)", val, err)
+	}
+	if _, err = rdb.Fetch("private/key", nil); err == nil {
+		t.Errorf("expected an error fetching a key alice cannot read")
+	}
+	if err = rdb.Stow("team/key", "changed", nil); err == nil {
+		t.Errorf("expected an error stowing a key alice cannot write")
+	}
+	if entries, err := rdb.backend.List(""); err != nil || len(entries) != 1 {
+		t.Errorf("expected alice to see 1 entry but got %v (%v)", len(entries), err)
+	}
+
+	client := rdb.backend.(*grpcBackend).client
+	aliases := &depotpb.Meta{Name: aliasesMeta, Data: []byte(`{"team/alias":"private/key"}`)}
+	if _, err = client.SetMeta(context.Background(), aliases); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected %v aliasing a key alice cannot read but got %v", codes.PermissionDenied, err)
+	}
+	mdb.Alias("team/alias", "private/key", false)
+	if _, err = client.Fetch(context.Background(), &depotpb.FetchRequest{Key: "team/alias"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected %v fetching through an alias of a key alice cannot read but got %v", codes.PermissionDenied, err)
+	}
+	if _, err = rdb.Fetch("team/alias", nil); err == nil {
+		t.Errorf("expected an error fetching through an alias of a key alice cannot read")
+	}
+}
+
+func TestGRPCRateLimit(t *testing.T) {
+	mdb, _ := NewMemDepot(WithRateLimit(RateLimit{Rate: 1, Backoff: time.Hour}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := NewGRPCServer(mdb, "token")
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+
+	backend, err := NewGRPCBackend("grpc://"+l.Addr().String(), "nobody")
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { backend.Close() })
+	if _, err = backend.Get("k"); err == nil || errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected to be refused for an unknown token but got %v", err)
+	}
+	if _, err = backend.Get("k"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected %v after failing to authenticate but got %v", ErrRateLimited, err)
+	}
+}
+
+func TestGRPCError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{ErrNotFound, codes.NotFound},
+		{ErrBadPassword, codes.PermissionDenied},
+		{fmt.Errorf("%w: bad name", ErrInvalidKey), codes.InvalidArgument},
+		{fmt.Errorf("%w: no parameters", ErrInvalidParams), codes.InvalidArgument},
+		{ErrRateLimited, codes.ResourceExhausted},
+		{errors.New("disk on fire"), codes.Internal},
+	}
+	for _, tt := range tests {
+		if got := status.Code(grpcError(tt.err)); got != tt.want {
+			t.Errorf("expected %v for %v but got %v", tt.want, tt.err, got)
+		}
+	}
+}
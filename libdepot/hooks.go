@@ -0,0 +1,116 @@
+package libdepot
+
+import (
+	"fmt"
+)
+
+// Called before a value is stored under key, to refuse it by returning an
+// error, which the stow fails with. val is the value as it was given, before
+// it is compressed or encrypted, and encrypted tells whether it will be
+// encrypted. An encrypted value that is copied or renamed, or put by a client
+// of a Server, is checked without decrypting it, so val is "".
+type PreStowFunc func(key, val string, encrypted bool) error
+
+// Called with the key after a value is stored under it, whether by a stow, a
+// copy, a rename, an undrop, or a client of a Server. It may be called while
+// the depot is locked (see Locker), so it must not change the depot itself.
+type PostStowFunc func(key string)
+
+// Called with the key after it is dropped, or renamed away from, as a
+// PostStowFunc is called
+type PostDropFunc func(key string)
+
+// Returns an Option that calls f before every value is stored, as a policy
+// that can refuse it. Each such Option adds a hook, and they are called in
+// the order they were given until one refuses.
+func WithPreStow(f PreStowFunc) Option {
+	return func(db *Depot) {
+		db.preStow = append(db.preStow, f)
+	}
+}
+
+// Returns an Option that calls f after every value is stored, such as to
+// push the depot to its remote. Each such Option adds a hook, and they are
+// called in the order they were given.
+func WithPostStow(f PostStowFunc) Option {
+	return func(db *Depot) {
+		db.postStow = append(db.postStow, f)
+	}
+}
+
+// Returns an Option that calls f after every key is dropped. Each such Option
+// adds a hook, and they are called in the order they were given.
+func WithPostDrop(f PostDropFunc) Option {
+	return func(db *Depot) {
+		db.postDrop = append(db.postDrop, f)
+	}
+}
+
+// Returns a PreStowFunc that refuses to store a value in plain text under a
+// key matching pattern (see matchKey), so that such keys can only hold
+// secrets
+func DenyPlaintext(pattern string) PreStowFunc {
+	return func(key, val string, encrypted bool) error {
+		if !encrypted && matchKey(pattern, key) {
+			return fmt.Errorf("%w: keys matching %v must be encrypted", ErrForbidden, pattern)
+		}
+		return nil
+	}
+}
+
+// Calls the pre-stow hooks with the value about to be stored under key.
+// Returns the error of the first that refuses it, or nil.
+func (db *Depot) checkStow(key, val string, encrypted bool) error {
+	for _, f := range db.preStow {
+		if err := f(key, val, encrypted); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Calls the pre-stow hooks with the value of the entry, which is about to be
+// stored as it is, decompressing it if it is in plain text. Returns the error
+// of the first that refuses it, or nil.
+func (db *Depot) checkStowEntry(e *Entry) error {
+	if len(db.preStow) == 0 || e.Deleted {
+		return nil
+	} else if e.Nonce != nil {
+		return db.checkStow(e.Key, "", true)
+	}
+
+	val, err := db.fetchEntry(e, nil)
+	if err != nil {
+		return err
+	}
+
+	return db.checkStow(e.Key, val, false)
+}
+
+// Puts the entry as it is if the pre-stow hooks allow it. Returns an error if
+// unsuccessful.
+func (db *Depot) putChecked(e *Entry) error {
+	if err := db.checkStowEntry(e); err != nil {
+		return err
+	}
+	if err := db.backend.Put(e); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return nil
+}
+
+// Calls the post-stow or post-drop hooks with key, according to action
+func (db *Depot) afterAction(action, key string) {
+	switch action {
+	case AuditStow:
+		for _, f := range db.postStow {
+			f(key)
+		}
+	case AuditDrop:
+		for _, f := range db.postDrop {
+			f(key)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package libdepot
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	var stowed, dropped []string
+	mdb, _ := NewMemDepot(
+		WithPreStow(DenyPlaintext("db/*")),
+		WithPostStow(func(key string) { stowed = append(stowed, key) }),
+		WithPostDrop(func(key string) { dropped = append(dropped, key) }),
+	)
+	password := []byte("correct horse battery staple")
+
+	if err := mdb.Stow("db/password", "hunter2", nil); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected %v stowing plain text under db/ but got %v", ErrForbidden, err)
+	}
+	if _, err := mdb.Fetch("db/password", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a refused value not to be stored but got %v", err)
+	}
+	if err := mdb.Stow("db/password", "hunter2", password); err != nil {
+		t.Fatalf("error stowing encrypted value: %v", err)
+	}
+	if err := mdb.Stow("web/user", "octocat", nil); err != nil {
+		t.Fatalf("error stowing plain text elsewhere: %v", err)
+	}
+	if err := mdb.StowAll(map[string]string{"db/user": "admin"}, nil); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected %v stowing plain text under db/ in a batch but got %v", ErrForbidden, err)
+	}
+
+	// Plain text may not be moved into db/ either, but secrets may
+	if err := mdb.Copy("web/user", "db/user", nil, false); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected %v copying plain text into db/ but got %v", ErrForbidden, err)
+	}
+	if err := mdb.Rename("web/user", "db/user", false); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected %v renaming plain text into db/ but got %v", ErrForbidden, err)
+	}
+	if _, err := mdb.Fetch("web/user", nil); err != nil {
+		t.Errorf("expected a refused rename to leave the key alone but got %v", err)
+	}
+	if err := mdb.Rename("db/password", "db/pass", false); err != nil {
+		t.Fatalf("error renaming a secret: %v", err)
+	}
+	if err := mdb.Drop("web/user"); err != nil {
+		t.Fatalf("error dropping: %v", err)
+	}
+
+	if want := []string{"db/password", "web/user", "db/pass"}; !slices.Equal(stowed, want) {
+		t.Errorf("expected post-stow hooks for %v but got %v", want, stowed)
+	}
+	if want := []string{"db/password", "web/user"}; !slices.Equal(dropped, want) {
+		t.Errorf("expected post-drop hooks for %v but got %v", want, dropped)
+	}
+}
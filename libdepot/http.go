@@ -0,0 +1,150 @@
+package libdepot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// A Backend that talks to a remote depot server over its REST API:
+//
+//	GET    /v1/entries?prefix=p  list entries
+//	GET    /v1/entries/{key}     get an entry
+//	PUT    /v1/entries/{key}     put an entry
+//	DELETE /v1/entries/{key}     delete an entry
+//	GET    /v1/meta/{name}       get metadata
+//	PUT    /v1/meta/{name}       set metadata
+//
+// Entries travel as JSON and metadata as raw bytes. Values are encrypted
+// before they leave the client, so the server never sees a secret. Only an
+// admin's delete removes a value for good (see Server).
+type httpBackend struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+// Returns a Backend served by the remote depot at baseURL, authenticating
+// with the given bearer token if it is not empty
+func NewHTTPBackend(baseURL, token string) (Backend, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid depot server address: %v", baseURL)
+	}
+
+	return &httpBackend{
+		base:   strings.TrimSuffix(baseURL, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Returns an Option that authenticates against remote depot servers with the
+// given bearer token
+func WithToken(token string) Option {
+	return func(db *Depot) {
+		db.token = token
+	}
+}
+
+// Sends a request to the server and returns the body of a successful
+// response. A 404 is reported as ErrNotFound.
+func (b *httpBackend) do(method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, b.base+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if b.token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, fmt.Errorf("depot server: %w, try again in %vs", ErrRateLimited, resp.Header.Get("Retry-After"))
+	case resp.StatusCode >= 300:
+		msg := strings.TrimSpace(string(data))
+		if msg == "" {
+			msg = resp.Status
+		}
+		return nil, errors.New("depot server: " + msg)
+	}
+
+	return data, nil
+}
+
+func (b *httpBackend) Get(key string) (*Entry, error) {
+	data, err := b.do(http.MethodGet, "/v1/entries/"+url.PathEscape(key), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var e Entry
+	if err = json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (b *httpBackend) Put(e *Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.do(http.MethodPut, "/v1/entries/"+url.PathEscape(e.Key), data)
+	return err
+}
+
+func (b *httpBackend) Delete(key string) error {
+	_, err := b.do(http.MethodDelete, "/v1/entries/"+url.PathEscape(key), nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+func (b *httpBackend) List(prefix string) ([]*Entry, error) {
+	data, err := b.do(http.MethodGet, "/v1/entries?prefix="+url.QueryEscape(prefix), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	err = json.Unmarshal(data, &entries)
+	return entries, err
+}
+
+func (b *httpBackend) Meta(name string) ([]byte, error) {
+	return b.do(http.MethodGet, "/v1/meta/"+url.PathEscape(name), nil)
+}
+
+func (b *httpBackend) SetMeta(name string, data []byte) error {
+	_, err := b.do(http.MethodPut, "/v1/meta/"+url.PathEscape(name), data)
+	return err
+}
+
+func (b *httpBackend) Close() error {
+	b.client.CloseIdleConnections()
+	return nil
+}
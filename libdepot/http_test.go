@@ -0,0 +1,60 @@
+package libdepot
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// Serves a depot kept in memory over the REST API
+func testServer(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+
+	mdb, err := NewMemDepot()
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	srv := httptest.NewServer(NewServer(mdb, token))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestHTTPBackend(t *testing.T) {
+	srv := testServer(t, "token")
+
+	b, err := NewHTTPBackend(srv.URL, "token")
+	if err != nil {
+		t.Fatalf("failed to initialize backend: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	testBackend(t, b)
+}
+
+func TestHTTPDepot(t *testing.T) {
+	key := "remote/key"
+	data := "testing123"
+	password := []byte("password")
+	srv := testServer(t, "token")
+
+	if _, err := NewDepot(srv.URL, WithToken("wrong")); err == nil {
+		t.Errorf("expected an error connecting with the wrong token but there was none")
+	}
+
+	rdb, err := NewDepot(srv.URL, WithToken("token"))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+
+	if err = rdb.Stow(key, data, password); err != nil {
+		t.Errorf("error inserting ciphertext into depot: %v", err.Error())
+	}
+	val, err := rdb.Fetch(key, password)
+	if err != nil {
+		t.Errorf("error fetching %v from depot: %v", key, err.Error())
+	}
+	if val != data {
+		t.Errorf("expected %v but %v was retrieved for key %v", data, val, key)
+	}
+}
@@ -0,0 +1,29 @@
+package argon2
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestKeys(t *testing.T) {
+	// The test vectors of RFC 9106
+	password := bytes.Repeat([]byte{0x01}, 32)
+	salt := bytes.Repeat([]byte{0x02}, 16)
+	secret := bytes.Repeat([]byte{0x03}, 8)
+	data := bytes.Repeat([]byte{0x04}, 12)
+
+	tests := []struct {
+		name string
+		kdf  func(password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte
+		want string
+	}{
+		{"Argon2d", DKey, "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb"},
+		{"Argon2id", IDKey, "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659"},
+	}
+	for _, test := range tests {
+		if got := hex.EncodeToString(test.kdf(password, salt, secret, data, 3, 32, 4, 32)); got != test.want {
+			t.Errorf("%v: expected %v but got %v", test.name, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,894 @@
+package libdepot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20/salsa"
+
+	"github.com/adonSh/depot/libdepot/internal/argon2"
+)
+
+// The format a DepotDump is written in as a KeePass database by MarshalKeePass
+const FormatKeePass = "kdbx"
+
+// The signatures every KeePass 2 database begins with
+const (
+	kdbxSignature1 = 0x9AA2D903
+	kdbxSignature2 = 0xB54BFB67
+)
+
+// IDs of the fields of a KeePass database's outer header
+const (
+	kdbxEndOfHeader          = 0
+	kdbxCipherID             = 2
+	kdbxCompressionFlags     = 3
+	kdbxMasterSeed           = 4
+	kdbxTransformSeed        = 5
+	kdbxTransformRounds      = 6
+	kdbxEncryptionIV         = 7
+	kdbxProtectedStreamKey   = 8
+	kdbxStreamStartBytes     = 9
+	kdbxInnerRandomStreamID  = 10
+	kdbxKdfParameters        = 11
+	kdbxInnerEndOfHeader     = 0
+	kdbxInnerRandomStream    = 1
+	kdbxInnerRandomStreamKey = 2
+)
+
+// The ciphers that encrypt protected values within a KeePass database
+const (
+	kdbxStreamSalsa20  = 2
+	kdbxStreamChaCha20 = 3
+)
+
+// UUIDs of the ciphers and key derivation functions KeePass databases use
+var (
+	kdbxAES256   = []byte{0x31, 0xc1, 0xf2, 0xe6, 0xbf, 0x71, 0x43, 0x50, 0xbe, 0x58, 0x05, 0x21, 0x6a, 0xfc, 0x5a, 0xff}
+	kdbxChaCha20 = []byte{0xd6, 0x03, 0x8a, 0x2b, 0x8b, 0x6f, 0x4c, 0xb5, 0xa5, 0x24, 0x33, 0x9a, 0x31, 0xdb, 0xb5, 0x9a}
+	kdbxAESKDF   = []byte{0xc9, 0xd9, 0xf3, 0x9a, 0x62, 0x8a, 0x44, 0x60, 0xbf, 0x74, 0x0d, 0x08, 0xc1, 0x8a, 0x4f, 0xea}
+	kdbxAESKDF3  = []byte{0x7c, 0x02, 0xbb, 0x82, 0x79, 0xa7, 0x4a, 0xc0, 0x92, 0x7d, 0x11, 0x4a, 0x00, 0x64, 0x82, 0x38}
+	kdbxArgon2d  = []byte{0xef, 0x63, 0x6d, 0xdf, 0x8c, 0x29, 0x44, 0x4b, 0x91, 0xf7, 0xa9, 0xa4, 0x03, 0xe3, 0x0a, 0x0c}
+	kdbxArgon2id = []byte{0x9e, 0x29, 0x8b, 0x19, 0x56, 0xdb, 0x47, 0x73, 0xb2, 0x3d, 0xfc, 0x3e, 0xc6, 0xf0, 0xa1, 0xe6}
+)
+
+// The Argon2d parameters of the KeePass databases MarshalKeePass writes, as
+// KeePassXC chooses by default
+var (
+	kdbxArgon2Memory      uint64 = 64 << 20
+	kdbxArgon2Iterations  uint64 = 10
+	kdbxArgon2Parallelism uint32 = 2
+)
+
+// The size of the blocks the payload of a KDBX 4 file is split into
+const kdbxBlockSize = 1 << 20
+
+// Seconds from the year 1, which KDBX 4 counts times from, to the Unix epoch
+const kdbxEpoch = 62135596800
+
+// The nonce of the Salsa20 stream protecting values in a KeePass database
+var kdbxSalsa20Nonce = []byte{0xe8, 0x30, 0x09, 0x4b, 0x97, 0x20, 0x5d, 0x2a}
+
+// Returns the entries of the KeePass database (a KDBX 3.1 or 4 file) in
+// data, decrypted with its master password, as a dump laid out as
+// foreignDump does, with the groups an entry is in as its folders. Entries in
+// the recycle bin and past versions of entries are left out. Returns
+// ErrBadPassword if password is wrong, or another error if unsuccessful.
+func ParseKeePass(data, password []byte) (*DepotDump, error) {
+	items, err := readKDBX(data, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return foreignDump(items), nil
+}
+
+// Returns the entries of a KeePass database, decrypted with its master
+// password, or an error if unsuccessful
+func readKDBX(data, password []byte) ([]foreignItem, error) {
+	r := bytes.NewReader(data)
+	var sig [2]uint32
+	var minor, major uint16
+	binary.Read(r, binary.LittleEndian, &sig)
+	binary.Read(r, binary.LittleEndian, &minor)
+	if err := binary.Read(r, binary.LittleEndian, &major); err != nil || sig[0] != kdbxSignature1 || sig[1] != kdbxSignature2 {
+		return nil, errors.New("not a KeePass 2 database")
+	}
+	if major != 3 && major != 4 {
+		return nil, fmt.Errorf("unsupported KeePass database version %v.%v", major, minor)
+	}
+
+	header := map[byte][]byte{}
+	for {
+		var id byte
+		var size uint32
+		err := binary.Read(r, binary.LittleEndian, &id)
+		if major == 3 {
+			var size16 uint16
+			err = errors.Join(err, binary.Read(r, binary.LittleEndian, &size16))
+			size = uint32(size16)
+		} else {
+			err = errors.Join(err, binary.Read(r, binary.LittleEndian, &size))
+		}
+		if err != nil || int64(size) > int64(r.Len()) {
+			return nil, fmt.Errorf("%w: truncated KeePass header", ErrCorrupted)
+		}
+		header[id] = make([]byte, size)
+		io.ReadFull(r, header[id])
+		if id == kdbxEndOfHeader {
+			break
+		}
+	}
+	headerBytes := data[:len(data)-r.Len()]
+	rest := data[len(headerBytes):]
+
+	compositeKey := sha256.Sum256(password)
+	compositeKey = sha256.Sum256(compositeKey[:])
+	transformed, err := kdbxTransformKey(header, major, compositeKey[:])
+	if err != nil {
+		return nil, err
+	}
+	masterKey := sha256.Sum256(append(append([]byte{}, header[kdbxMasterSeed]...), transformed...))
+
+	var payload, streamKey []byte
+	var streamID uint32
+	if major == 3 {
+		plain, err := kdbxDecrypt(header, masterKey[:], rest)
+		if err != nil || len(plain) < 32 || !hmac.Equal(plain[:32], header[kdbxStreamStartBytes]) {
+			return nil, ErrBadPassword
+		}
+		if payload, err = kdbxHashedBlocks(plain[32:]); err != nil {
+			return nil, err
+		}
+		if payload, err = kdbxDecompress(header, payload); err != nil {
+			return nil, err
+		}
+		streamKey = header[kdbxProtectedStreamKey]
+		if len(header[kdbxInnerRandomStreamID]) == 4 {
+			streamID = binary.LittleEndian.Uint32(header[kdbxInnerRandomStreamID])
+		}
+	} else {
+		if len(rest) < 64 {
+			return nil, fmt.Errorf("%w: truncated KeePass header", ErrCorrupted)
+		}
+		if sum := sha256.Sum256(headerBytes); !hmac.Equal(sum[:], rest[:32]) {
+			return nil, fmt.Errorf("%w: KeePass header checksum mismatch", ErrCorrupted)
+		}
+		hmacBase := sha512.Sum512(append(append(append([]byte{}, header[kdbxMasterSeed]...), transformed...), 1))
+		mac := hmac.New(sha256.New, kdbxHMACKey(hmacBase[:], ^uint64(0)))
+		mac.Write(headerBytes)
+		if !hmac.Equal(mac.Sum(nil), rest[32:64]) {
+			return nil, ErrBadPassword
+		}
+		encrypted, err := kdbxHMACBlocks(hmacBase[:], rest[64:])
+		if err != nil {
+			return nil, err
+		}
+		if payload, err = kdbxDecrypt(header, masterKey[:], encrypted); err != nil {
+			return nil, err
+		}
+		if payload, err = kdbxDecompress(header, payload); err != nil {
+			return nil, err
+		}
+		inner := map[byte][]byte{}
+		if payload, err = kdbxInnerHeader(payload, inner); err != nil {
+			return nil, err
+		}
+		streamKey = inner[kdbxInnerRandomStreamKey]
+		if len(inner[kdbxInnerRandomStream]) == 4 {
+			streamID = binary.LittleEndian.Uint32(inner[kdbxInnerRandomStream])
+		}
+	}
+
+	stream, err := kdbxInnerStream(streamID, streamKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return kdbxEntries(payload, stream)
+}
+
+// Returns the composite key transformed by the key derivation function the
+// header names, or an error if it is not one of those KeePass offers
+func kdbxTransformKey(header map[byte][]byte, major uint16, key []byte) ([]byte, error) {
+	var params map[string]any
+	if major == 3 {
+		if len(header[kdbxTransformRounds]) != 8 {
+			return nil, fmt.Errorf("%w: missing KeePass transform rounds", ErrCorrupted)
+		}
+		params = map[string]any{
+			"$UUID": kdbxAESKDF,
+			"S":     header[kdbxTransformSeed],
+			"R":     binary.LittleEndian.Uint64(header[kdbxTransformRounds]),
+		}
+	} else {
+		var err error
+		if params, err = readVariantDict(header[kdbxKdfParameters]); err != nil {
+			return nil, err
+		}
+	}
+
+	uuid, _ := params["$UUID"].([]byte)
+	salt, _ := params["S"].([]byte)
+	switch {
+	case bytes.Equal(uuid, kdbxAESKDF) || bytes.Equal(uuid, kdbxAESKDF3):
+		rounds, _ := params["R"].(uint64)
+		if len(salt) != 32 {
+			return nil, fmt.Errorf("%w: invalid KeePass transform seed", ErrCorrupted)
+		}
+		c, _ := aes.NewCipher(salt)
+		k := append([]byte{}, key...)
+		for i := uint64(0); i < rounds; i++ {
+			c.Encrypt(k[:16], k[:16])
+			c.Encrypt(k[16:], k[16:])
+		}
+		sum := sha256.Sum256(k)
+		return sum[:], nil
+	case bytes.Equal(uuid, kdbxArgon2d) || bytes.Equal(uuid, kdbxArgon2id):
+		memory, _ := params["M"].(uint64)
+		iterations, _ := params["I"].(uint64)
+		parallelism, _ := params["P"].(uint32)
+		version, _ := params["V"].(uint32)
+		secret, _ := params["K"].([]byte)
+		assoc, _ := params["A"].([]byte)
+		if version != argon2.Version || iterations < 1 || parallelism < 1 || parallelism > 255 ||
+			memory/1024 > 1<<32-1 || iterations > 1<<32-1 {
+			return nil, fmt.Errorf("unsupported Argon2 parameters in KeePass database")
+		}
+		kdf := argon2.DKey
+		if bytes.Equal(uuid, kdbxArgon2id) {
+			kdf = argon2.IDKey
+		}
+		return kdf(key, salt, secret, assoc, uint32(iterations), uint32(memory/1024), uint8(parallelism), 32), nil
+	default:
+		return nil, errors.New("unsupported key derivation function in KeePass database")
+	}
+}
+
+// Returns the payload decrypted with the cipher the header names, or an error
+// if unsuccessful, as when the key is wrong
+func kdbxDecrypt(header map[byte][]byte, key, payload []byte) ([]byte, error) {
+	iv := header[kdbxEncryptionIV]
+	switch id := header[kdbxCipherID]; {
+	case bytes.Equal(id, kdbxAES256):
+		block, _ := aes.NewCipher(key)
+		if len(iv) != aes.BlockSize || len(payload) == 0 || len(payload)%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("%w: invalid KeePass payload", ErrCorrupted)
+		}
+		plain := make([]byte, len(payload))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, payload)
+		pad := int(plain[len(plain)-1])
+		if pad == 0 || pad > aes.BlockSize || !bytes.Equal(plain[len(plain)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+			return nil, ErrBadPassword
+		}
+		return plain[:len(plain)-pad], nil
+	case bytes.Equal(id, kdbxChaCha20):
+		c, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid KeePass encryption IV", ErrCorrupted)
+		}
+		plain := make([]byte, len(payload))
+		c.XORKeyStream(plain, payload)
+		return plain, nil
+	default:
+		return nil, errors.New("unsupported cipher in KeePass database, only AES-256 and ChaCha20 are")
+	}
+}
+
+// Returns the payload gunzipped if the header says it is compressed, or an
+// error if unsuccessful
+func kdbxDecompress(header map[byte][]byte, payload []byte) ([]byte, error) {
+	if flags := header[kdbxCompressionFlags]; len(flags) != 4 || binary.LittleEndian.Uint32(flags) == 0 {
+		return payload, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorrupted, err)
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorrupted, err)
+	}
+
+	return data, nil
+}
+
+// Returns the data of a KDBX 3.1 hashed block stream, or an error if a block
+// does not match its hash
+func kdbxHashedBlocks(data []byte) ([]byte, error) {
+	var out []byte
+	for {
+		if len(data) < 40 {
+			return nil, fmt.Errorf("%w: truncated KeePass block", ErrCorrupted)
+		}
+		hash, size := data[4:36], binary.LittleEndian.Uint32(data[36:40])
+		data = data[40:]
+		if size == 0 {
+			return out, nil
+		}
+		if int64(size) > int64(len(data)) {
+			return nil, fmt.Errorf("%w: truncated KeePass block", ErrCorrupted)
+		}
+		if sum := sha256.Sum256(data[:size]); !hmac.Equal(sum[:], hash) {
+			return nil, fmt.Errorf("%w: KeePass block checksum mismatch", ErrCorrupted)
+		}
+		out, data = append(out, data[:size]...), data[size:]
+	}
+}
+
+// Returns the data of a KDBX 4 HMAC block stream, or an error if a block does
+// not match its HMAC
+func kdbxHMACBlocks(hmacBase, data []byte) ([]byte, error) {
+	var out []byte
+	for i := uint64(0); ; i++ {
+		if len(data) < 36 {
+			return nil, fmt.Errorf("%w: truncated KeePass block", ErrCorrupted)
+		}
+		mac, size := data[:32], binary.LittleEndian.Uint32(data[32:36])
+		if int64(size) > int64(len(data)-36) {
+			return nil, fmt.Errorf("%w: truncated KeePass block", ErrCorrupted)
+		}
+		var idx [8]byte
+		binary.LittleEndian.PutUint64(idx[:], i)
+		h := hmac.New(sha256.New, kdbxHMACKey(hmacBase, i))
+		h.Write(idx[:])
+		h.Write(data[32 : 36+size])
+		if !hmac.Equal(h.Sum(nil), mac) {
+			return nil, fmt.Errorf("%w: KeePass block HMAC mismatch", ErrCorrupted)
+		}
+		if size == 0 {
+			return out, nil
+		}
+		out, data = append(out, data[36:36+size]...), data[36+size:]
+	}
+}
+
+// Returns the key of the HMAC of a KDBX 4 block, or of the header as block
+// ^uint64(0)
+func kdbxHMACKey(hmacBase []byte, index uint64) []byte {
+	var idx [8]byte
+	binary.LittleEndian.PutUint64(idx[:], index)
+	key := sha512.Sum512(append(idx[:], hmacBase...))
+
+	return key[:]
+}
+
+// Reads the fields of a KDBX 4 inner header into inner and returns the XML
+// after it, or an error if unsuccessful
+func kdbxInnerHeader(data []byte, inner map[byte][]byte) ([]byte, error) {
+	for {
+		if len(data) < 5 {
+			return nil, fmt.Errorf("%w: truncated KeePass inner header", ErrCorrupted)
+		}
+		id, size := data[0], binary.LittleEndian.Uint32(data[1:5])
+		if int64(size) > int64(len(data)-5) {
+			return nil, fmt.Errorf("%w: truncated KeePass inner header", ErrCorrupted)
+		}
+		inner[id], data = data[5:5+size], data[5+size:]
+		if id == kdbxInnerEndOfHeader {
+			return data, nil
+		}
+	}
+}
+
+// Returns the key stream that protected values in a KeePass database's XML
+// are XORed with, or an error if the cipher is unsupported
+func kdbxInnerStream(id uint32, key []byte) (cipher.Stream, error) {
+	switch id {
+	case kdbxStreamSalsa20:
+		s := &salsaStream{key: sha256.Sum256(key)}
+		copy(s.counter[:], kdbxSalsa20Nonce)
+		return s, nil
+	case kdbxStreamChaCha20:
+		sum := sha512.Sum512(key)
+		return chacha20.NewUnauthenticatedCipher(sum[:32], sum[32:44])
+	default:
+		return nil, fmt.Errorf("unsupported inner stream cipher %v in KeePass database", id)
+	}
+}
+
+// A Salsa20 key stream that carries on where the last call left off
+type salsaStream struct {
+	key     [32]byte
+	counter [16]byte
+	block   [64]byte
+	used    int
+}
+
+func (s *salsaStream) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if s.used == 0 {
+			var zero [64]byte
+			salsa.XORKeyStream(s.block[:], zero[:], &s.counter, &s.key)
+			binary.LittleEndian.PutUint64(s.counter[8:], binary.LittleEndian.Uint64(s.counter[8:])+1)
+		}
+		dst[i] = src[i] ^ s.block[s.used]
+		s.used = (s.used + 1) % len(s.block)
+	}
+}
+
+// Returns the entries of a KeePass database's XML, with the values marked
+// protected decrypted by the stream, in the order they appear, or an error if
+// unsuccessful
+func kdbxEntries(data []byte, stream cipher.Stream) ([]foreignItem, error) {
+	type group struct {
+		name string
+		uuid string
+	}
+	var (
+		items      []foreignItem
+		groups     []group
+		elems      []string
+		text       strings.Builder
+		protected  bool
+		entry      *foreignItem
+		history    int
+		fieldKey   string
+		recycleBin string
+	)
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCorrupted, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			elems = append(elems, t.Name.Local)
+			text.Reset()
+			protected = false
+			for _, a := range t.Attr {
+				if a.Name.Local == "Protected" && strings.EqualFold(a.Value, "True") {
+					protected = true
+				}
+			}
+			switch t.Name.Local {
+			case "Group":
+				groups = append(groups, group{})
+			case "History":
+				history++
+			case "Entry":
+				if history == 0 {
+					entry = &foreignItem{}
+				}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			name := t.Name.Local
+			parent := ""
+			if len(elems) > 1 {
+				parent = elems[len(elems)-2]
+			}
+			val, wasProtected := text.String(), protected
+			if protected {
+				raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(val))
+				if err != nil {
+					return nil, fmt.Errorf("%w: invalid protected value", ErrCorrupted)
+				}
+				stream.XORKeyStream(raw, raw)
+				val = string(raw)
+			}
+			text.Reset()
+			protected = false
+			elems = elems[:len(elems)-1]
+
+			switch {
+			case name == "RecycleBinUUID" && parent == "Meta":
+				recycleBin = val
+			case name == "UUID" && parent == "Group":
+				groups[len(groups)-1].uuid = val
+			case name == "Name" && parent == "Group":
+				groups[len(groups)-1].name = val
+			case name == "Group":
+				groups = groups[:len(groups)-1]
+			case name == "History":
+				history--
+			case history > 0:
+				// Past versions of an entry only need their protected values
+				// decrypted, to keep the stream in step
+			case name == "Key" && parent == "String":
+				fieldKey = val
+			case name == "Value" && parent == "String" && entry != nil:
+				switch fieldKey {
+				case "Title":
+					entry.title = val
+				case "UserName":
+					entry.username = val
+				case "Password":
+					entry.password = val
+				case "URL":
+					entry.url = val
+				case "Notes":
+					entry.notes = val
+				case "otp":
+					entry.totp = val
+				case "TimeOtp-Secret-Base32":
+					// As KeePass itself keeps TOTP seeds
+					if entry.totp == "" {
+						entry.totp = val
+					}
+				default:
+					entry.fields = append(entry.fields, foreignField{fieldKey, val, wasProtected})
+				}
+			case name == "LastModificationTime" && parent == "Times" && entry != nil:
+				entry.modified = kdbxTime(val)
+			case name == "Entry" && entry != nil:
+				skip := false
+				var folders []string
+				for i, g := range groups {
+					if recycleBin != "" && g.uuid == recycleBin {
+						skip = true
+					}
+					// The root group is the database itself
+					if i > 0 {
+						folders = append(folders, g.name)
+					}
+				}
+				if !skip {
+					entry.folders = folders
+					items = append(items, *entry)
+				}
+				entry = nil
+			}
+		}
+	}
+
+	return items, nil
+}
+
+// Returns the time a KeePass database gives as text in KDBX 3.1 or as base64
+// seconds since the year 1 in KDBX 4, or the zero time if it is neither
+func kdbxTime(s string) time.Time {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(raw) != 8 {
+		return time.Time{}
+	}
+	secs := int64(binary.LittleEndian.Uint64(raw))
+
+	return time.Unix(secs-kdbxEpoch, 0).UTC()
+}
+
+// Types of the values in a KeePass variant dictionary
+const (
+	kdbxVariantEnd    = 0x00
+	kdbxVariantUint32 = 0x04
+	kdbxVariantUint64 = 0x05
+	kdbxVariantBool   = 0x08
+	kdbxVariantInt32  = 0x0c
+	kdbxVariantInt64  = 0x0d
+	kdbxVariantString = 0x18
+	kdbxVariantBytes  = 0x42
+)
+
+// Returns the values of a KeePass variant dictionary, as KDBX 4 keeps the
+// parameters of its key derivation function in, or an error if unsuccessful
+func readVariantDict(data []byte) (map[string]any, error) {
+	malformed := fmt.Errorf("%w: malformed KeePass KDF parameters", ErrCorrupted)
+	if len(data) < 2 || data[1] != 0x01 {
+		return nil, malformed
+	}
+	data = data[2:]
+
+	dict := map[string]any{}
+	for {
+		if len(data) < 1 {
+			return nil, malformed
+		}
+		typ := data[0]
+		if typ == kdbxVariantEnd {
+			return dict, nil
+		}
+		if len(data) < 5 {
+			return nil, malformed
+		}
+		n := binary.LittleEndian.Uint32(data[1:5])
+		if int64(n)+4 > int64(len(data)-5) {
+			return nil, malformed
+		}
+		name := string(data[5 : 5+n])
+		data = data[5+n:]
+		m := binary.LittleEndian.Uint32(data[:4])
+		if int64(m) > int64(len(data)-4) {
+			return nil, malformed
+		}
+		val := data[4 : 4+m]
+		data = data[4+m:]
+
+		switch {
+		case typ == kdbxVariantUint32 && m == 4:
+			dict[name] = binary.LittleEndian.Uint32(val)
+		case typ == kdbxVariantUint64 && m == 8:
+			dict[name] = binary.LittleEndian.Uint64(val)
+		case typ == kdbxVariantBool && m == 1:
+			dict[name] = val[0] != 0
+		case typ == kdbxVariantInt32 && m == 4:
+			dict[name] = int32(binary.LittleEndian.Uint32(val))
+		case typ == kdbxVariantInt64 && m == 8:
+			dict[name] = int64(binary.LittleEndian.Uint64(val))
+		case typ == kdbxVariantString:
+			dict[name] = string(val)
+		case typ == kdbxVariantBytes:
+			dict[name] = val
+		default:
+			return nil, malformed
+		}
+	}
+}
+
+// The XML of a KeePass database, as much of it as MarshalKeePass writes
+type kdbxXML struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    struct {
+		Generator         string
+		DatabaseName      string
+		RecycleBinEnabled string
+	}
+	Root struct {
+		Group *kdbxXMLGroup
+	}
+}
+
+type kdbxXMLGroup struct {
+	UUID    string
+	Name    string
+	Entries []*kdbxXMLEntry `xml:"Entry"`
+	Groups  []*kdbxXMLGroup `xml:"Group"`
+}
+
+type kdbxXMLEntry struct {
+	UUID  string
+	Times struct {
+		CreationTime         string
+		LastModificationTime string
+		LastAccessTime       string
+	}
+	Strings []kdbxXMLString `xml:"String"`
+}
+
+type kdbxXMLString struct {
+	Key   string
+	Value struct {
+		Protected string `xml:",attr,omitempty"`
+		Text      string `xml:",chardata"`
+	}
+}
+
+// Returns the dump as a KeePass database in the KDBX 4 format, locked with
+// password. Each value is the password of an entry titled with the last part
+// of its key, in groups named after the parts before it, so that ParseKeePass
+// gives back the same keys. Returns an error if unsuccessful.
+func (d *DepotDump) MarshalKeePass(password []byte) ([]byte, error) {
+	random := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(rand.Reader, b)
+		return b, err
+	}
+	masterSeed, err1 := random(32)
+	iv, err2 := random(aes.BlockSize)
+	salt, err3 := random(32)
+	streamKey, err4 := random(64)
+	if err := errors.Join(err1, err2, err3, err4); err != nil {
+		return nil, fmt.Errorf("cannot generate random keys: %w", err)
+	}
+
+	doc, err := kdbxDocument(d.Entries)
+	if err != nil {
+		return nil, err
+	}
+	stream, _ := kdbxInnerStream(kdbxStreamChaCha20, streamKey)
+	kdbxProtect(doc.Root.Group, stream)
+	body, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return nil, fmt.Errorf("cannot write KeePass database: %w", err)
+	}
+
+	le32 := func(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+	le64 := func(v uint64) []byte { return binary.LittleEndian.AppendUint64(nil, v) }
+	var header bytes.Buffer
+	binary.Write(&header, binary.LittleEndian, []uint32{kdbxSignature1, kdbxSignature2})
+	binary.Write(&header, binary.LittleEndian, []uint16{0, 4})
+	field := func(buf *bytes.Buffer, id byte, data []byte) {
+		buf.WriteByte(id)
+		buf.Write(le32(uint32(len(data))))
+		buf.Write(data)
+	}
+	params := writeVariantDict([]kdbxVariant{
+		{kdbxVariantBytes, "$UUID", kdbxArgon2d},
+		{kdbxVariantBytes, "S", salt},
+		{kdbxVariantUint32, "P", le32(kdbxArgon2Parallelism)},
+		{kdbxVariantUint64, "M", le64(kdbxArgon2Memory)},
+		{kdbxVariantUint64, "I", le64(kdbxArgon2Iterations)},
+		{kdbxVariantUint32, "V", le32(argon2.Version)},
+	})
+	field(&header, kdbxCipherID, kdbxAES256)
+	field(&header, kdbxCompressionFlags, le32(1))
+	field(&header, kdbxMasterSeed, masterSeed)
+	field(&header, kdbxEncryptionIV, iv)
+	field(&header, kdbxKdfParameters, params)
+	field(&header, kdbxEndOfHeader, []byte("\r\n\r\n"))
+
+	compositeKey := sha256.Sum256(password)
+	compositeKey = sha256.Sum256(compositeKey[:])
+	transformed, err := kdbxTransformKey(map[byte][]byte{kdbxKdfParameters: params}, 4, compositeKey[:])
+	if err != nil {
+		return nil, err
+	}
+	masterKey := sha256.Sum256(append(append([]byte{}, masterSeed...), transformed...))
+	hmacBase := sha512.Sum512(append(append(append([]byte{}, masterSeed...), transformed...), 1))
+
+	var plain bytes.Buffer
+	zw := gzip.NewWriter(&plain)
+	var inner bytes.Buffer
+	field(&inner, kdbxInnerRandomStream, le32(kdbxStreamChaCha20))
+	field(&inner, kdbxInnerRandomStreamKey, streamKey)
+	field(&inner, kdbxInnerEndOfHeader, nil)
+	zw.Write(inner.Bytes())
+	zw.Write([]byte(xml.Header))
+	zw.Write(body)
+	if err = zw.Close(); err != nil {
+		return nil, fmt.Errorf("cannot write KeePass database: %w", err)
+	}
+
+	payload := plain.Bytes()
+	pad := aes.BlockSize - len(payload)%aes.BlockSize
+	payload = append(payload, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	block, _ := aes.NewCipher(masterKey[:])
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(payload, payload)
+
+	out := bytes.NewBuffer(append([]byte{}, header.Bytes()...))
+	sum := sha256.Sum256(header.Bytes())
+	out.Write(sum[:])
+	mac := hmac.New(sha256.New, kdbxHMACKey(hmacBase[:], ^uint64(0)))
+	mac.Write(header.Bytes())
+	out.Write(mac.Sum(nil))
+	for i := uint64(0); ; i++ {
+		data := payload[:min(len(payload), kdbxBlockSize)]
+		payload = payload[len(data):]
+		blk := append(le32(uint32(len(data))), data...)
+		mac := hmac.New(sha256.New, kdbxHMACKey(hmacBase[:], i))
+		mac.Write(le64(i))
+		mac.Write(blk)
+		out.Write(mac.Sum(nil))
+		out.Write(blk)
+		if len(data) == 0 {
+			break
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// Returns the XML of a KeePass database holding the entries, with the
+// passwords not yet protected, or an error if unsuccessful
+func kdbxDocument(entries []DumpEntry) (*kdbxXML, error) {
+	uuid := func() (string, error) {
+		b := make([]byte, 16)
+		_, err := io.ReadFull(rand.Reader, b)
+		return base64.StdEncoding.EncodeToString(b), err
+	}
+
+	doc := &kdbxXML{}
+	doc.Meta.Generator = "depot"
+	doc.Meta.DatabaseName = "depot"
+	doc.Meta.RecycleBinEnabled = "False"
+	root := &kdbxXMLGroup{Name: "depot"}
+	doc.Root.Group = root
+	groups := map[string]*kdbxXMLGroup{"": root}
+
+	var err error
+	if root.UUID, err = uuid(); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		dir, title := path.Split(e.Key)
+		dir = strings.TrimSuffix(dir, "/")
+
+		// Make the groups the key's parts name, outermost first
+		parent := root
+		for i, part := range strings.Split(dir, "/") {
+			if dir == "" {
+				break
+			}
+			name := strings.Join(strings.Split(dir, "/")[:i+1], "/")
+			g := groups[name]
+			if g == nil {
+				g = &kdbxXMLGroup{Name: part}
+				if g.UUID, err = uuid(); err != nil {
+					return nil, err
+				}
+				groups[name] = g
+				parent.Groups = append(parent.Groups, g)
+			}
+			parent = g
+		}
+
+		entry := &kdbxXMLEntry{}
+		if entry.UUID, err = uuid(); err != nil {
+			return nil, err
+		}
+		modified := e.Modified
+		if modified.IsZero() {
+			modified = time.Now()
+		}
+		when := base64.StdEncoding.EncodeToString(binary.LittleEndian.AppendUint64(nil, uint64(modified.Unix()+kdbxEpoch)))
+		entry.Times.CreationTime = when
+		entry.Times.LastModificationTime = when
+		entry.Times.LastAccessTime = when
+		for _, f := range [][2]string{{"Title", title}, {"UserName", ""}, {"Password", e.Value}, {"URL", ""}, {"Notes", ""}} {
+			s := kdbxXMLString{Key: f[0]}
+			s.Value.Text = f[1]
+			if f[0] == "Password" {
+				s.Value.Protected = "True"
+			}
+			entry.Strings = append(entry.Strings, s)
+		}
+		parent.Entries = append(parent.Entries, entry)
+	}
+
+	return doc, nil
+}
+
+// Encrypts the protected values in the group with the stream, in the order
+// they appear in its XML
+func kdbxProtect(g *kdbxXMLGroup, stream cipher.Stream) {
+	for _, e := range g.Entries {
+		for i, s := range e.Strings {
+			if s.Value.Protected != "" {
+				val := []byte(s.Value.Text)
+				stream.XORKeyStream(val, val)
+				e.Strings[i].Value.Text = base64.StdEncoding.EncodeToString(val)
+			}
+		}
+	}
+	for _, sub := range g.Groups {
+		kdbxProtect(sub, stream)
+	}
+}
+
+// A value in a KeePass variant dictionary, already encoded
+type kdbxVariant struct {
+	typ  byte
+	name string
+	val  []byte
+}
+
+// Returns the variants as a KeePass variant dictionary
+func writeVariantDict(vars []kdbxVariant) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0x00, 0x01})
+	for _, v := range vars {
+		buf.WriteByte(v.typ)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(v.name)))
+		buf.WriteString(v.name)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(v.val)))
+		buf.Write(v.val)
+	}
+	buf.WriteByte(kdbxVariantEnd)
+
+	return buf.Bytes()
+}
@@ -0,0 +1,70 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Rules for the names of keys (see WithKeyPolicy). The zero KeyPolicy allows
+// any key, as a depot does by default.
+type KeyPolicy struct {
+	// The most characters a key may have, or 0 for no limit
+	MaxLength int
+
+	// A pattern the whole of every key must match, such as
+	// `^[a-z0-9/._-]+$`, or nil to allow any characters
+	Pattern *regexp.Regexp
+
+	// Whether keys are put in Unicode normalization form C, so that keys
+	// that look the same are the same, however their accents were typed
+	NFC bool
+
+	// Whether keys are folded to lower case, so that they can be typed in
+	// any case
+	CaseInsensitive bool
+}
+
+// A key breaks the rules set with WithKeyPolicy
+var ErrInvalidKey = errors.New("invalid key")
+
+// Returns an Option that checks new keys against policy when they are stowed,
+// copied, renamed, or made aliases, failing with ErrInvalidKey, and that
+// normalizes every key the depot is given as policy says. Keys that were
+// stowed before are not renamed, so a key that normalizing would change can
+// no longer be found until it is renamed with the policy unset.
+func WithKeyPolicy(policy KeyPolicy) Option {
+	return func(db *Depot) {
+		db.keyPolicy = policy
+	}
+}
+
+// Returns key as the key policy would have it be stored
+func (db *Depot) normalizeKey(key string) string {
+	if db.keyPolicy.NFC {
+		key = norm.NFC.String(key)
+	}
+	if db.keyPolicy.CaseInsensitive {
+		key = strings.ToLower(key)
+	}
+
+	return key
+}
+
+// Returns key normalized, or ErrInvalidKey if it breaks the key policy
+func (db *Depot) checkKey(key string) (string, error) {
+	key = db.normalizeKey(key)
+
+	switch p := db.keyPolicy; {
+	case p.MaxLength > 0 && utf8.RuneCountInString(key) > p.MaxLength:
+		return "", fmt.Errorf("%w %q: longer than %d characters", ErrInvalidKey, key, p.MaxLength)
+	case p.Pattern != nil && !p.Pattern.MatchString(key):
+		return "", fmt.Errorf("%w %q: does not match %v", ErrInvalidKey, key, p.Pattern)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,55 @@
+package libdepot
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestKeyPolicy(t *testing.T) {
+	mdb, err := NewMemDepot(WithKeyPolicy(KeyPolicy{
+		MaxLength:       10,
+		Pattern:         regexp.MustCompile(`^[\p{L}0-9/._-]+$`),
+		NFC:             true,
+		CaseInsensitive: true,
+	}))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+
+	for _, key := range []string{"", "web/" + strings.Repeat("x", 7), "web page", "tab\tkey"} {
+		if err = mdb.Stow(key, "value", nil); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("expected %v stowing %q but got %v", ErrInvalidKey, key, err)
+		}
+	}
+
+	// "Café" with a combining accent is the same key as "café" with a
+	// precomposed one, in any case
+	if err = mdb.Stow("Cafe\u0301", "value", nil); err != nil {
+		t.Fatalf("error stowing: %v", err)
+	}
+	if val, err := mdb.Fetch("CAF\u00c9", nil); err != nil || val != "value" {
+		t.Errorf("expected value fetching the normalized key but got %q (%v)", val, err)
+	}
+	keys, err := mdb.List("")
+	if err != nil || len(keys) != 1 || keys[0].Key != "caf\u00e9" {
+		t.Errorf("expected the key to be stored normalized but got %v (%v)", keys, err)
+	}
+
+	if err = mdb.Alias("too/long/alias", "café", false); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected %v adding an alias that breaks the policy but got %v", ErrInvalidKey, err)
+	}
+	if err = mdb.Rename("café", "bad name", false); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected %v renaming to a key that breaks the policy but got %v", ErrInvalidKey, err)
+	}
+	if err = mdb.Rename("CAFÉ", "Coffee", false); err != nil {
+		t.Errorf("error renaming: %v", err)
+	}
+	if err = mdb.Drop("COFFEE"); err != nil {
+		t.Errorf("error dropping: %v", err)
+	}
+	if keys, err = mdb.List(""); err != nil || len(keys) != 0 {
+		t.Errorf("expected no keys left but got %v (%v)", keys, err)
+	}
+}
@@ -1,90 +1,243 @@
 package libdepot
 
 import (
+	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/rand"
+	"crypto/hmac"
 	"crypto/sha1"
-	"database/sql"
+	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"strconv"
+	"time"
 
 	"golang.org/x/crypto/pbkdf2"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 type Depot struct {
-	*sql.DB
-	salt []byte
+	backend           Backend
+	salt              []byte
+	keyfile           []byte
+	derivedKey        []byte
+	weakPassword      WeakPasswordFunc
+	insecureFile      InsecureFileFunc
+	token             string
+	actor             string
+	auditFunc         AuditFunc
+	logger            *slog.Logger
+	tracer            Tracer
+	ctx               context.Context
+	pragmas           map[string]string
+	compressThreshold int
+	keyPolicy         KeyPolicy
+	maxValueSize      int
+	preStow           []PreStowFunc
+	postStow          []PostStowFunc
+	postDrop          []PostDropFunc
+	sealer            Sealer
+	sealers           map[string]Sealer
+	rand              io.Reader
+	clock             func() time.Time
+	subKeyPurpose     *string
+	limiter           *limiter
+	stretched         *stretchCache
 }
 
+// An Option configures optional behavior of a Depot
+type Option func(*Depot)
+
 var (
 	b64 = base64.StdEncoding
 
 	ErrNotFound       = errors.New("key not found")
 	ErrBadPassword    = errors.New("bad password")
 	ErrPasswordNeeded = errors.New("password is needed for decryption")
+	ErrCorrupted      = errors.New("stored data is corrupted")
+	ErrWeakPassword   = errors.New("password is too weak")
+	ErrExists         = errors.New("key already exists")
+	ErrDatabase       = errors.New("cannot access database")
+	ErrTooLarge       = errors.New("value is too large")
+
+	// Authenticated with the derived key to tell a bad password apart from
+	// corrupted data
+	keyCheckLabel = []byte("depot key check")
+)
+
+const (
+	// How long the tombstone of a dropped key is kept. A copy of the depot
+	// that goes longer than this without syncing may bring the key back.
+	TombstoneLifetime = 90 * 24 * time.Hour
+
+	// How often Drop purges expired tombstones
+	purgeInterval = 24 * time.Hour
+
+	// The depot metadata that the time of the last purge is kept in, in
+	// seconds since the Unix epoch
+	purgedMeta = "purged"
 )
 
-// Returns a new storage medium (sqlite3 database) or an error if
-// initialization is unsuccessful.
-func NewDepot(uri string) (*Depot, error) {
-	conn, err := sql.Open("sqlite3", uri)
+// Returns a new storage medium or an error if initialization is
+// unsuccessful. The uri is the path to a sqlite3 database, the path to a
+// bbolt database (as bolt://path or a path ending in .bolt), a directory
+// holding one file per key (as dir://path, or git://path to commit every
+// change to a git repository), a postgres:// connection string,
+// a redis:// URL, an s3:// bucket, or the http:// or https:// address of a
+// remote depot server.
+func NewDepot(uri string, opts ...Option) (*Depot, error) {
+	db := newDepot(opts)
+	backend, err := db.openBackend(uri)
 	if err != nil {
-		return nil, fmt.Errorf("cannot connect to database: %w", err)
+		return nil, err
 	}
 
-	db := Depot{conn, make([]byte, 32)}
-	if err = db.QueryRow("select data from salt").Scan(&db.salt); err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			if err = db.init(); err != nil {
-				return nil, fmt.Errorf("cannot access database: %w", err)
-			}
-		}
-		if _, err = io.ReadFull(rand.Reader, db.salt); err != nil {
-			return nil, fmt.Errorf("cannot generate random salt: %w", err)
-		}
-		_, err = db.Exec("insert into salt (data) values (?)", db.salt)
-		if err != nil {
-			return nil, fmt.Errorf("cannot access database: %w", err)
+	if err = db.attach(backend); err != nil {
+		backend.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Returns a new storage medium kept by the given backend or an error if
+// initialization is unsuccessful
+func NewDepotWithBackend(backend Backend, opts ...Option) (*Depot, error) {
+	db := newDepot(opts)
+	if err := db.attach(backend); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Returns a Depot configured by the given options but not yet backed by
+// anything
+func newDepot(opts []Option) *Depot {
+	db := Depot{compressThreshold: DefaultCompressionThreshold, stretched: &stretchCache{}}
+	for _, opt := range opts {
+		opt(&db)
+	}
+
+	return &db
+}
+
+// Backs the depot with the given backend, logging its SQL if it has any (see
+// WithLogger), after checking the permissions of its files (see FileBackend),
+// creating the salt if the backend is new.
+// Returns an error if unsuccessful.
+func (db *Depot) attach(backend Backend) error {
+	db.backend = backend
+	if b, ok := backend.(sqlBackend); ok {
+		b.queries().logger = db.logger
+	}
+	if err := db.checkPermissions(); err != nil {
+		return err
+	}
+
+	salt, err := backend.Meta("salt")
+	if errors.Is(err, ErrNotFound) {
+		salt = make([]byte, 32)
+		if _, err = io.ReadFull(db.random(), salt); err != nil {
+			return fmt.Errorf("cannot generate random salt: %w", err)
 		}
+		err = backend.SetMeta("salt", salt)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
 	}
 
-	return &db, nil
+	db.salt = salt
+	return nil
+}
+
+// Closes the underlying storage. Returns an error if unsuccessful.
+func (db *Depot) Close() error {
+	return db.backend.Close()
+}
+
+// Returns an Option that combines the contents of a keyfile with the password
+// when deriving encryption keys. With a keyfile in place, an empty (but
+// non-nil) password derives the key from the keyfile alone.
+func WithKeyfile(keyfile []byte) Option {
+	return func(db *Depot) {
+		db.keyfile = keyfile
+	}
 }
 
-// Writes the schema to the database and returns nil if successful.
-// Otherwise returns an error
-func (db *Depot) init() error {
-	_, err := db.Exec(`
-		create table if not exists storage (
-			modified   int  default (strftime('%s', 'now')),
-			key        text unique not null,
-			val        text not null,
-			nonce      blob unique
-		);
+// Returns an Option that encrypts and decrypts values with a key returned
+// earlier by DeriveKey, so the password need not be derived again. Any
+// non-nil password, including an empty one, then stands for that key. Values
+// that carry their own salt still derive theirs from the password given.
+func WithDerivedKey(key []byte) Option {
+	return func(db *Depot) {
+		db.derivedKey = key
+	}
+}
 
-		create table if not exists salt (
-			data blob not null
-		);`)
+// Returns an Option that refuses to stow values longer than size bytes,
+// failing with ErrTooLarge, or sets no limit if size is not positive
+func WithMaxValueSize(size int) Option {
+	return func(db *Depot) {
+		db.maxValueSize = size
+	}
+}
 
-	return err
+// Returns the most bytes a value may have (see WithMaxValueSize), or 0 if
+// there is no limit
+func (db *Depot) MaxValueSize() int {
+	return max(db.maxValueSize, 0)
 }
 
-// Returns the given data encrypted with a key derived from the given
-// password or an error if unsuccessful
-func encrypt(password, salt, data []byte) ([]byte, []byte, error) {
-	encryptionKey := pbkdf2.Key(password, salt, 4096, 32, sha1.New)
+// Returns the key the given password, combined with the keyfile if there is
+// one, derives for the depot. It can be held on to and handed to
+// WithDerivedKey later in place of the password.
+func (db *Depot) DeriveKey(password []byte) []byte {
+	return db.deriveKey(password, nil)
+}
+
+// Returns the encryption key derived from the given password and, if one
+// was provided, the keyfile, using the given salt or the depot's own if it is
+// nil
+func (db *Depot) deriveKey(password, salt []byte) []byte {
+	if salt == nil {
+		salt = db.salt
+	}
+	if db.derivedKey != nil && bytes.Equal(salt, db.salt) {
+		return db.derivedKey
+	}
+
+	if db.subKeyPurpose != nil && len(password) > 0 {
+		password = SubKey(password, *db.subKeyPurpose)
+	}
+	material := password
+	if db.keyfile != nil {
+		h := sha256.New()
+		if len(password) > 0 {
+			pwhash := sha256.Sum256(password)
+			h.Write(pwhash[:])
+		}
+		keyhash := sha256.Sum256(db.keyfile)
+		h.Write(keyhash[:])
+		material = h.Sum(nil)
+	}
+
+	return pbkdf2.Key(material, salt, 4096, 32, sha1.New)
+}
+
+// Returns the given data encrypted with the given key, under a nonce read
+// from r and bound to aad if it is not nil, or an error if unsuccessful
+func encrypt(r io.Reader, encryptionKey, data, aad []byte) ([]byte, []byte, error) {
 	block, err := aes.NewCipher(encryptionKey)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	nonce := make([]byte, 12)
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+	if _, err = io.ReadFull(r, nonce); err != nil {
 		return nil, nil, err
 	}
 
@@ -93,13 +246,12 @@ func encrypt(password, salt, data []byte) ([]byte, []byte, error) {
 		return nil, nil, err
 	}
 
-	return aesgcm.Seal(nil, nonce, data, nil), nonce, nil
+	return aesgcm.Seal(nil, nonce, data, aad), nonce, nil
 }
 
-// Returns the given data decrypted with a key derived from the given
-// password or an error if unsuccessful
-func decrypt(password, salt, nonce, data []byte) ([]byte, error) {
-	encryptionKey := pbkdf2.Key(password, salt, 4096, 32, sha1.New)
+// Returns the given data decrypted with the given key, checking that it was
+// bound to aad, or an error if unsuccessful
+func decrypt(encryptionKey, nonce, data, aad []byte) ([]byte, error) {
 	block, err := aes.NewCipher(encryptionKey)
 	if err != nil {
 		return nil, err
@@ -110,88 +262,343 @@ func decrypt(password, salt, nonce, data []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	plaintext, err := aesgcm.Open(nil, nonce, data, nil)
-	if err != nil {
-		return nil, ErrBadPassword
-	}
+	return aesgcm.Open(nil, nonce, data, aad)
+}
 
-	return plaintext, nil
+// Returns a value that can be stored alongside an encrypted value and later
+// used to verify that a password derives the same key, without decrypting
+func keyCheck(encryptionKey, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, encryptionKey)
+	mac.Write(keyCheckLabel)
+	mac.Write(nonce)
+	return mac.Sum(nil)[:16]
 }
 
 // Stores the specified key and value in the depot. If the key exists then
-// the value is updated. If password is not nil the value will be encrypted.
-// Returns an error if encryption or storage fails.
-func (db *Depot) Stow(key, val string, password []byte) error {
-	query := `
-		insert into storage (key, val, nonce)
-		values (?, ?, ?)
-		on conflict (key) do
-		update set
-			modified = (strftime('%s', 'now')),
-			val = ?,
-			nonce = ?`
+// the value is updated, and if it is an alias (see Alias) the key it stands
+// for is. If password is not nil the value will be encrypted
+// (see WithKeyfile for how a keyfile factors in, and WithWeakPasswordFunc for
+// how weak passwords are reported). Large values are compressed first (see
+// WithCompressionThreshold).
+// Returns ErrTooLarge if the value is longer than allowed (see
+// WithMaxValueSize), or another error if encryption or storage fails.
+func (db *Depot) Stow(key, val string, password []byte) (err error) {
+	traced, end := db.trace("Stow", key)
+	defer func() { end(err) }()
+
+	return db.audit(AuditStow, key, db.locked(func() error { return traced.stow(key, val, password) }))
+}
 
+func (db *Depot) stow(key, val string, password []byte) error {
+	key, err := db.checkKey(key)
+	if err != nil {
+		return err
+	}
+	if key, err = db.resolve(key); err != nil {
+		return err
+	}
+	encryptionKey, salt, err := db.stowKey(key, password)
+	if err != nil {
+		return err
+	}
+	entry, err := db.newEntry(key, val, encryptionKey, salt)
+	if err != nil {
+		return err
+	}
+
+	if err := db.backend.Put(entry); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return nil
+}
+
+// Returns the key to encrypt the value stowed under key with and the salt it
+// was derived with, if not the depot's own (see CreateNamespace), or nil if
+// password is nil, after reporting the password if it is weak. Returns an
+// error if unsuccessful.
+func (db *Depot) stowKey(key string, password []byte) ([]byte, []byte, error) {
 	if password == nil {
-		if _, err := db.Exec(query, key, val, nil, val, nil); err != nil {
-			return fmt.Errorf("cannot access database: %w", err)
+		return nil, nil, nil
+	}
+	encryptionKey, salt, err := db.keyDeriver(password).derive(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = db.checkStrength(key, password); err != nil {
+		return nil, nil, err
+	}
+
+	return encryptionKey, salt, nil
+}
+
+// Reports the password to stow a value under key with if it is weak (see
+// WithWeakPasswordFunc). Returns an error if it is refused.
+func (db *Depot) checkStrength(key string, password []byte) error {
+	if db.weakPassword != nil && db.keyfile == nil && db.derivedKey == nil {
+		if entropy := EstimateEntropy(password); entropy < MinPasswordEntropy {
+			return db.weakPassword(key, entropy)
 		}
+	}
 
-		return nil
+	return nil
+}
+
+// Returns the entry that holds val under key, compressed if it is large and
+// encrypted if encryptionKey is not nil, with the key derived from it for a
+// fresh salt of the entry's own (see ValueKey), where encryptionKey was
+// derived with salt if it is not nil, or an error if unsuccessful
+func (db *Depot) newEntry(key, val string, encryptionKey, salt []byte) (*Entry, error) {
+	if limit := db.MaxValueSize(); limit > 0 && len(val) > limit {
+		return nil, fmt.Errorf("%w: %d bytes, more than %d", ErrTooLarge, len(val), limit)
+	}
+	if err := db.checkStow(key, val, encryptionKey != nil); err != nil {
+		return nil, err
+	}
+
+	entry := Entry{Key: key, Val: val, Modified: db.now()}
+	data, compression := db.compress([]byte(val))
+	if compression != CompressionNone {
+		entry.Val = b64.EncodeToString(data)
+		entry.Compression = compression
+	}
+
+	if encryptionKey != nil {
+		entry.Salt = salt
+		entry.KeySalt = make([]byte, 16)
+		if _, err := io.ReadFull(db.random(), entry.KeySalt); err != nil {
+			return nil, fmt.Errorf("cannot generate random salt: %w", err)
+		}
+		encryptionKey = db.valueKey(encryptionKey, salt, entry.KeySalt)
+
+		ciphertext, nonce, cipher, err := db.seal(encryptionKey, data, entryAAD(&entry))
+		if err != nil {
+			db.log().Error("cannot encrypt value", append(db.keyAttrs(key), slog.Any("error", err))...)
+			return nil, fmt.Errorf("cannot encrypt data: %w", err)
+		}
+
+		entry.Val = b64.EncodeToString(ciphertext)
+		entry.Nonce = nonce
+		entry.Check = keyCheck(encryptionKey, nonce)
+		entry.Cipher = cipher
+	}
+
+	return &entry, nil
+}
+
+// Returns the value from the depot associated with the specified key, or
+// with the key it is an alias of (see Alias), or an error if unsuccessful. A
+// non-nil password must be supplied for encrypted values.
+func (db *Depot) Fetch(key string, password []byte) (_ string, err error) {
+	traced, end := db.trace("Fetch", key)
+	defer func() { end(err) }()
+
+	val, err := traced.fetch(key, password)
+	if err = db.audit(AuditFetch, key, err); err != nil {
+		return "", err
 	}
 
-	ciphertext, nonce, err := encrypt(password, db.salt, []byte(val))
+	return val, nil
+}
+
+// Checks password against the encrypted value of key without decrypting it.
+// Returns nil if the value can be fetched with password, ErrBadPassword if it
+// cannot, or another error if unsuccessful, including when the value is not
+// encrypted.
+func (db *Depot) Verify(key string, password []byte) error {
+	return db.opError(OpVerify, key, db.verify(key, password))
+}
+
+func (db *Depot) verify(key string, password []byte) error {
+	entry, err := db.get(db.normalizeKey(key))
 	if err != nil {
-		return fmt.Errorf("cannot encrypt data: %w", err)
+		return err
+	}
+
+	if entry.Nonce == nil {
+		return fmt.Errorf("value is not encrypted")
+	} else if password == nil {
+		return ErrPasswordNeeded
 	}
 
-	cval := b64.EncodeToString(ciphertext)
-	if _, err = db.Exec(query, key, cval, nonce, cval, nonce); err != nil {
-		return fmt.Errorf("cannot access database: %w", err)
+	// A value stowed before key checks were kept can only be checked by
+	// decrypting it
+	if entry.Check == nil {
+		_, err = db.fetch(key, password)
+		return err
+	}
+	if !hmac.Equal(entry.Check, keyCheck(db.entryKey(entry, password), entry.Nonce)) {
+		return ErrBadPassword
 	}
 
 	return nil
 }
 
-// Returns the value from the depot associated with the specified key or an
-// error if unsuccessful. A non-nil password must be supplied for encrypted
-// values.
-func (db *Depot) Fetch(key string, password []byte) (string, error) {
-	var val string
-	var nonce []byte
-	err := db.QueryRow(`
-		select val, nonce
-		from storage
-		where key = ?`,
-		key).Scan(&val, &nonce)
-	if errors.Is(err, sql.ErrNoRows) {
-		return "", ErrNotFound
-	} else if err != nil {
-		return "", fmt.Errorf("cannot access database: %w", err)
+func (db *Depot) fetch(key string, password []byte) (string, error) {
+	entry, err := db.get(db.normalizeKey(key))
+	if err != nil {
+		return "", err
 	}
 
-	if nonce == nil {
-		return val, nil
+	return db.fetchEntry(entry, password)
+}
+
+// Returns the value held by the entry, decrypted with password if it is
+// encrypted, or an error if unsuccessful
+func (db *Depot) fetchEntry(entry *Entry, password []byte) (string, error) {
+	if entry.Nonce == nil {
+		if entry.Compression == CompressionNone {
+			return entry.Val, nil
+		}
+		compressed, err := b64.DecodeString(entry.Val)
+		if err != nil {
+			return "", fmt.Errorf("cannot decompress data: %w", ErrCorrupted)
+		}
+		plain, err := decompress(entry.Compression, compressed)
+		return string(plain), err
 	} else if password == nil {
 		return "", ErrPasswordNeeded
 	}
+	if _, err := db.opener(entry.Cipher); err != nil {
+		return "", err
+	}
 
-	valbytes, err := b64.DecodeString(val)
-	if err != nil {
-		return "", fmt.Errorf("cannot decrypt data: %w", err)
+	encryptionKey := db.entryKey(entry, password)
+	check := entry.Check
+	if check != nil && !hmac.Equal(check, keyCheck(encryptionKey, entry.Nonce)) {
+		return "", db.decryptFailed(entry.Key, ErrBadPassword)
 	}
 
-	plaintext, err := decrypt(password, db.salt, nonce, valbytes)
+	valbytes, err := b64.DecodeString(entry.Val)
 	if err != nil {
-		return "", fmt.Errorf("cannot decrypt data: %w", err)
+		return "", db.decryptFailed(entry.Key, ErrCorrupted)
+	}
+
+	plaintext, err := db.open(entry.Cipher, encryptionKey, entry.Nonce, valbytes, entryAAD(entry))
+	if err != nil && check == nil {
+		// Entries stored before key checks existed can't tell the difference
+		return "", db.decryptFailed(entry.Key, ErrBadPassword)
+	} else if err != nil {
+		return "", db.decryptFailed(entry.Key, ErrCorrupted)
+	}
+	if plaintext, err = decompress(entry.Compression, plaintext); err != nil {
+		return "", err
 	}
 
 	return string(plaintext), nil
 }
 
-// Deletes the specified key from the depot. Returns an error if unsuccessful.
-func (db *Depot) Drop(key string) error {
-	if _, err := db.Exec("delete from storage where key = ?", key); err != nil {
-		return fmt.Errorf("cannot access database: %w", err)
+// Brings in changes from the remote copy of a depot whose backend is a
+// Remote. Returns an error if unsuccessful.
+func (db *Depot) Pull() error {
+	r, ok := db.backend.(Remote)
+	if !ok {
+		return fmt.Errorf("depot has no remote: %w", errors.ErrUnsupported)
+	}
+
+	return r.Pull()
+}
+
+// Sends changes to the remote copy of a depot whose backend is a Remote.
+// Returns an error if unsuccessful.
+func (db *Depot) Push() error {
+	r, ok := db.backend.(Remote)
+	if !ok {
+		return fmt.Errorf("depot has no remote: %w", errors.ErrUnsupported)
+	}
+
+	return r.Push()
+}
+
+// Deletes the specified key from the depot, leaving a tombstone in its place
+// (see Entry) that keeps the value in the trash for TrashLifetime (see
+// Undrop), and now and then empties the trash of values older than that and
+// purges tombstones older than TombstoneLifetime. An alias (see Alias) is
+// simply removed. Returns an error if unsuccessful.
+func (db *Depot) Drop(key string) (err error) {
+	traced, end := db.trace("Drop", key)
+	defer func() { end(err) }()
+
+	return db.audit(AuditDrop, key, traced.locked(func() error { return traced.drop(key) }))
+}
+
+func (db *Depot) drop(key string) error {
+	key = db.normalizeKey(key)
+	entry, err := db.backend.Get(key)
+	if errors.Is(err, ErrNotFound) || (err == nil && entry.Deleted) {
+		if err = db.unalias(key); errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	} else if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	tombstone := *entry
+	tombstone.Modified = db.now()
+	tombstone.Deleted = true
+	if err = db.backend.Put(&tombstone); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return db.purgeExpired()
+}
+
+// Removes the tombstones of keys dropped before the given time for good.
+// Returns the number removed or an error if unsuccessful.
+func (db *Depot) PurgeTombstones(before time.Time) (purged int, err error) {
+	err = db.locked(func() error {
+		purged, err = db.purgeTombstones(before)
+		return err
+	})
+
+	return purged, err
+}
+
+func (db *Depot) purgeTombstones(before time.Time) (int, error) {
+	entries, err := db.backend.List("")
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	purged := 0
+	for _, e := range entries {
+		if !e.Deleted || !e.Modified.Before(before) {
+			continue
+		}
+		if err = db.backend.Delete(e.Key); err != nil {
+			return purged, fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+		purged++
+	}
+	if purged > 0 {
+		db.log().Info("purged tombstones", slog.Int("count", purged))
+	}
+
+	return purged, nil
+}
+
+// Empties the trash of expired values and purges expired tombstones unless
+// that was done within the last purgeInterval. Returns an error if unsuccessful.
+func (db *Depot) purgeExpired() error {
+	now := db.now()
+	data, err := db.backend.Meta(purgedMeta)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	if last, err := strconv.ParseInt(string(data), 10, 64); err == nil &&
+		now.Sub(time.Unix(last, 0)) < purgeInterval {
+		return nil
+	}
+
+	if err = db.expireTrash(now.Add(-TrashLifetime)); err != nil {
+		return err
+	}
+	if _, err = db.purgeTombstones(now.Add(-TombstoneLifetime)); err != nil {
+		return err
+	}
+	if err = db.backend.SetMeta(purgedMeta, []byte(strconv.FormatInt(now.Unix(), 10))); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
 	}
 
 	return nil
@@ -3,12 +3,19 @@ package libdepot
 import (
 	"errors"
 	"log"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 var db *Depot
 
 func init() {
+	// Argon2id as it is used in earnest would make every test that encrypts
+	// take a good while
+	stretchParams.time, stretchParams.memory, stretchParams.threads = 1, 64, 1
+
 	var err error
 	db, err = NewDepot("test.db")
 	if err != nil {
@@ -16,6 +23,19 @@ func init() {
 	}
 }
 
+func TestMain(m *testing.M) {
+	code := m.Run()
+
+	// Remove the database the tests share, and the files SQLite and the
+	// depot keep beside it
+	db.Close()
+	files, _ := filepath.Glob("test.db*")
+	for _, f := range files {
+		os.Remove(f)
+	}
+	os.Exit(code)
+}
+
 func TestPlain(t *testing.T) {
 	key := "plaintext"
 	data := "testing123"
@@ -100,9 +120,225 @@ func TestBadDecrypt(t *testing.T) {
 	t.Cleanup(func() { db.Drop(key) })
 }
 
+func TestVerify(t *testing.T) {
+	password := []byte("password")
+	db.Stow("verify/secret", "secret", password)
+	db.Stow("verify/plain", "plain", nil)
+	t.Cleanup(func() {
+		db.Drop("verify/secret")
+		db.Drop("verify/plain")
+	})
+
+	if err := db.Verify("verify/secret", password); err != nil {
+		t.Errorf("expected the right password to verify but the error was %v", err)
+	}
+	if err := db.Verify("verify/secret", []byte("wrong")); !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v verifying a wrong password but the error was %v", ErrBadPassword, err)
+	}
+	if err := db.Verify("verify/secret", nil); !errors.Is(err, ErrPasswordNeeded) {
+		t.Errorf("expected %v verifying no password but the error was %v", ErrPasswordNeeded, err)
+	}
+	if err := db.Verify("verify/plain", password); err == nil {
+		t.Errorf("expected an error verifying a plain value")
+	}
+	if err := db.Verify("verify/missing", password); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v verifying a missing key but the error was %v", ErrNotFound, err)
+	}
+}
+
 func TestBadKey(t *testing.T) {
 	_, err := db.Fetch("badkey", nil)
 	if !errors.Is(err, ErrNotFound) {
 		t.Errorf("expected %v from Fetch() but the error was %v", ErrNotFound, err)
 	}
 }
+
+func TestDatabaseError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	_, err := NewDepot(filepath.Join(file, "test.db"))
+	if !errors.Is(err, ErrDatabase) {
+		t.Errorf("expected %v opening a database in a file but the error was %v", ErrDatabase, err)
+	}
+}
+
+func TestKeyfile(t *testing.T) {
+	key := "keyfile"
+	data := "testing123"
+	password := []byte("password")
+
+	kdb, err := NewDepot("test.db", WithKeyfile([]byte("keyfile contents")))
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err.Error())
+	}
+	t.Cleanup(func() { kdb.Close() })
+
+	// Keyfile alone
+	err = kdb.Stow(key, data, []byte{})
+	if err != nil {
+		t.Errorf("error inserting ciphertext into database: %v", err.Error())
+	}
+	val, err := kdb.Fetch(key, []byte{})
+	if err != nil {
+		t.Errorf("error fetching %v from database: %v", key, err.Error())
+	}
+	if val != data {
+		t.Errorf("expected %v but %v was retrieved for key %v", data, val, key)
+	}
+	_, err = db.Fetch(key, []byte{})
+	if !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v fetching without the keyfile but the error was %v", ErrBadPassword, err)
+	}
+
+	// Keyfile combined with a password
+	err = kdb.Stow(key, data, password)
+	if err != nil {
+		t.Errorf("error inserting ciphertext into database: %v", err.Error())
+	}
+	val, err = kdb.Fetch(key, password)
+	if err != nil {
+		t.Errorf("error fetching %v from database: %v", key, err.Error())
+	}
+	if val != data {
+		t.Errorf("expected %v but %v was retrieved for key %v", data, val, key)
+	}
+	_, err = kdb.Fetch(key, []byte{})
+	if !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v fetching without the password but the error was %v", ErrBadPassword, err)
+	}
+	_, err = db.Fetch(key, password)
+	if !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v fetching without the keyfile but the error was %v", ErrBadPassword, err)
+	}
+
+	t.Cleanup(func() { db.Drop(key) })
+}
+
+func TestDerivedKey(t *testing.T) {
+	key := "derived"
+	data := "testing123"
+	password := []byte("password")
+
+	kdb, err := NewDepot("test.db", WithDerivedKey(db.DeriveKey(password)),
+		WithWeakPasswordFunc(func(string, float64) error { return ErrWeakPassword }))
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err.Error())
+	}
+	t.Cleanup(func() {
+		kdb.Close()
+		db.Drop(key)
+	})
+
+	// An empty password stands for the derived key, weak as it looks
+	if err = kdb.Stow(key, data, []byte{}); err != nil {
+		t.Errorf("error inserting ciphertext into database: %v", err.Error())
+	}
+	val, err := db.Fetch(key, password)
+	if err != nil {
+		t.Errorf("error fetching %v from database: %v", key, err.Error())
+	}
+	if val != data {
+		t.Errorf("expected %v but %v was retrieved for key %v", data, val, key)
+	}
+	if val, err = kdb.Fetch(key, []byte{}); err != nil || val != data {
+		t.Errorf("expected %v but %v was retrieved for key %v (%v)", data, val, key, err)
+	}
+	if _, err = kdb.Fetch(key, nil); !errors.Is(err, ErrPasswordNeeded) {
+		t.Errorf("expected %v fetching without a password but the error was %v", ErrPasswordNeeded, err)
+	}
+}
+
+func TestCorrupted(t *testing.T) {
+	key := "corrupted"
+	data := "testing123"
+	password := []byte("password")
+
+	err := db.Stow(key, data, password)
+	if err != nil {
+		t.Errorf("error inserting ciphertext into database: %v", err.Error())
+	}
+
+	entry, err := db.backend.Get(key)
+	if err != nil {
+		t.Fatalf("error retrieving %v: %v", key, err.Error())
+	}
+	entry.Val = b64.EncodeToString([]byte("garbage"))
+	if err = db.backend.Put(entry); err != nil {
+		t.Errorf("error corrupting %v: %v", key, err.Error())
+	}
+
+	_, err = db.Fetch(key, password)
+	if !errors.Is(err, ErrCorrupted) {
+		t.Errorf("Expected %v from Fetch() but the error was %v", ErrCorrupted, err)
+	}
+	_, err = db.Fetch(key, []byte("badpassword"))
+	if !errors.Is(err, ErrBadPassword) {
+		t.Errorf("Expected %v from Fetch() but the error was %v", ErrBadPassword, err)
+	}
+
+	t.Cleanup(func() { db.Drop(key) })
+}
+
+func TestTombstone(t *testing.T) {
+	key := "tombstone"
+	data := "testing123"
+
+	if err := db.Stow(key, data, nil); err != nil {
+		t.Errorf("error inserting plaintext into database: %v", err.Error())
+	}
+	if err := db.Drop(key); err != nil {
+		t.Errorf("error deleting %v from database: %v", key, err.Error())
+	}
+
+	// The tombstone keeps the value while it is in the trash
+	e, err := db.backend.Get(key)
+	if err != nil || !e.Deleted || e.Val != data {
+		t.Errorf("expected a tombstone for %v holding its value but got %+v (%v)", key, e, err)
+	}
+	if _, err = db.Fetch(key, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v retrieving dropped data %v but error was %v", ErrNotFound, key, err)
+	}
+
+	// Stowing again brings the key back
+	if err = db.Stow(key, data, nil); err != nil {
+		t.Errorf("error inserting plaintext into database: %v", err.Error())
+	}
+	if val, err := db.Fetch(key, nil); err != nil || val != data {
+		t.Errorf("expected %v but %v was retrieved for key %v (%v)", data, val, key, err)
+	}
+
+	if err = db.Drop(key); err != nil {
+		t.Errorf("error deleting %v from database: %v", key, err.Error())
+	}
+	if n, err := db.PurgeTombstones(time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("expected a fresh tombstone to be kept but %v were purged (%v)", n, err)
+	}
+	if _, err := db.PurgeTombstones(time.Now().Add(time.Hour)); err != nil {
+		t.Errorf("error purging tombstones: %v", err)
+	}
+	if _, err = db.backend.Get(key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the tombstone for %v to be purged but the error was %v", key, err)
+	}
+}
+
+func TestMaxValueSize(t *testing.T) {
+	mdb, err := NewMemDepot(WithMaxValueSize(8))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+
+	if err = mdb.Stow("fits", "12345678", []byte("correct horse")); err != nil {
+		t.Errorf("error stowing a value of the largest size: %v", err)
+	}
+	if err = mdb.Stow("big", "123456789", nil); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected %v stowing a larger value but got %v", ErrTooLarge, err)
+	}
+	if err = mdb.StowAll(map[string]string{"a": "1", "b": "123456789"}, nil); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected %v stowing a larger value among others but got %v", ErrTooLarge, err)
+	}
+	if keys, _ := mdb.List(""); len(keys) != 1 {
+		t.Errorf("expected only the value that fits to be stowed but got %v", keys)
+	}
+}
@@ -0,0 +1,150 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+)
+
+// A Backend that can find the entries changed since a given time without
+// reading every entry, such as by an index of when they were modified
+type ChangeLister interface {
+	// Returns every entry, tombstone or not, modified at or after t, sorted
+	// by when it was modified and then by key
+	ListSince(t time.Time) ([]*Entry, error)
+}
+
+// What can be told about a key without its value
+type KeyInfo struct {
+	Key       string    `json:"key"`
+	Encrypted bool      `json:"encrypted"`
+	Modified  time.Time `json:"modified"`
+
+	// How the value was compressed, or CompressionNone
+	Compression string `json:"compression,omitempty"`
+
+	// How many bytes the value takes up once compressed and encrypted
+	Size int `json:"size"`
+
+	// The key this one is an alias of (see Depot.Alias), or "" if it isn't
+	// one
+	Alias string `json:"alias,omitempty"`
+
+	// How often the value ought to be replaced (see Depot.SetRotation), or 0
+	// if it has no rotation period
+	Rotation time.Duration `json:"rotation,omitempty"`
+
+	// Whether the key has been dropped, which only ChangedSince tells of
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Returns the keys and aliases matching pattern (see matchKey), sorted by key,
+// or an error if unsuccessful. Values are not decrypted, so no password is
+// needed.
+func (db *Depot) List(pattern string) ([]KeyInfo, error) {
+	entries, err := db.matching(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]KeyInfo, 0, len(entries))
+	for _, e := range entries {
+		keys = append(keys, keyInfo(e))
+	}
+
+	if keys, err = db.withAliases(keys, pattern); err != nil {
+		return nil, err
+	}
+
+	return db.withRotations(keys)
+}
+
+// Returns the keys matching pattern (see matchKey) whose values were stowed or
+// dropped at or after since, oldest change first, or an error if
+// unsuccessful. Dropped keys are included, marked as Deleted, so that the
+// changes can be copied elsewhere; aliases are not, since they are not
+// modified. No password is needed.
+func (db *Depot) ChangedSince(pattern string, since time.Time) ([]KeyInfo, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	var entries []*Entry
+	var err error
+	if cl, ok := db.backend.(ChangeLister); ok {
+		entries, err = cl.ListSince(since)
+	} else {
+		entries, err = db.backend.List("")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	keys := []KeyInfo{}
+	for _, e := range entries {
+		if e.Modified.Before(since) || !matchKey(pattern, e.Key) {
+			continue
+		}
+		info := keyInfo(e)
+		info.Deleted = e.Deleted
+		keys = append(keys, info)
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].Modified.Before(keys[j].Modified) })
+
+	return db.withRotations(keys)
+}
+
+// Returns what can be told about the key, or the key it is an alias of,
+// without its value, or ErrNotFound, or another error if unsuccessful. An
+// alias of a key that no longer exists is described by its name alone, as
+// List describes it. No password is needed.
+func (db *Depot) Info(key string) (KeyInfo, error) {
+	info, err := db.info(key)
+	return info, db.opError(OpInfo, key, err)
+}
+
+func (db *Depot) info(key string) (KeyInfo, error) {
+	key = db.normalizeKey(key)
+	entry, err := db.get(key)
+	if errors.Is(err, ErrNotFound) {
+		aliases, aliasErr := db.Aliases()
+		if target, ok := aliases[key]; ok && aliasErr == nil {
+			return KeyInfo{Key: key, Alias: target}, nil
+		}
+		return KeyInfo{}, err
+	} else if err != nil {
+		return KeyInfo{}, err
+	}
+
+	info := keyInfo(entry)
+	if entry.Key != key {
+		info.Key, info.Alias = key, entry.Key
+	}
+	keys, err := db.withRotations([]KeyInfo{info})
+	if err != nil {
+		return KeyInfo{}, err
+	}
+
+	return keys[0], nil
+}
+
+// Returns what the entry tells about its key
+func keyInfo(e *Entry) KeyInfo {
+	info := KeyInfo{
+		Key:         e.Key,
+		Encrypted:   e.Nonce != nil,
+		Modified:    e.Modified,
+		Compression: e.Compression,
+		Size:        len(e.Val),
+	}
+	// Values that aren't plain text are kept base64-encoded
+	if info.Encrypted || info.Compression != CompressionNone {
+		if data, err := b64.DecodeString(e.Val); err == nil {
+			info.Size = len(data)
+		}
+	}
+
+	return info
+}
@@ -0,0 +1,105 @@
+package libdepot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestList(t *testing.T) {
+	mdb, _ := NewMemDepot()
+	mdb.Stow("list/b", "b", nil)
+	mdb.Stow("list/a", "a", []byte("password"))
+	mdb.Stow("list/c", "c", nil)
+	mdb.Drop("list/c")
+	mdb.Stow("other", "other", nil)
+
+	keys, err := mdb.List("list/*")
+	if err != nil {
+		t.Fatalf("error listing keys: %v", err)
+	}
+	if len(keys) != 2 || keys[0].Key != "list/a" || keys[1].Key != "list/b" {
+		t.Fatalf("expected list/a and list/b in order but got %+v", keys)
+	}
+	if !keys[0].Encrypted || keys[1].Encrypted {
+		t.Errorf("expected only list/a to be encrypted but got %+v", keys)
+	}
+	if keys[1].Modified.IsZero() {
+		t.Errorf("expected a modified time but got none")
+	}
+
+	if keys, err = mdb.List(""); err != nil || len(keys) != 3 {
+		t.Errorf("expected every live key to be listed but got %v (%v)", len(keys), err)
+	}
+	if _, err = mdb.List("["); err == nil {
+		t.Errorf("expected an error with an invalid pattern")
+	}
+}
+
+func TestInfo(t *testing.T) {
+	mdb, _ := NewMemDepot(WithCompressionThreshold(16))
+	mdb.Stow("info/plain", "plain", nil)
+	mdb.Stow("info/secret", "secret", []byte("password"))
+	mdb.Stow("info/long", strings.Repeat("long ", 100), nil)
+
+	info, err := mdb.Info("info/plain")
+	if err != nil {
+		t.Fatalf("error getting info: %v", err)
+	}
+	if info.Key != "info/plain" || info.Encrypted || info.Size != 5 || info.Modified.IsZero() {
+		t.Errorf("unexpected info for a plain value: %+v", info)
+	}
+
+	// Sealed with AES-GCM, which adds a 16 byte tag
+	if info, err = mdb.Info("info/secret"); err != nil || !info.Encrypted || info.Size != 6+16 {
+		t.Errorf("unexpected info for an encrypted value: %+v (%v)", info, err)
+	}
+	if info, err = mdb.Info("info/long"); err != nil || info.Compression != CompressionZstd || info.Size >= 500 {
+		t.Errorf("unexpected info for a compressed value: %+v (%v)", info, err)
+	}
+
+	mdb.Drop("info/plain")
+	if _, err = mdb.Info("info/plain"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v for a dropped key but got %v", ErrNotFound, err)
+	}
+}
+
+func TestChangedSince(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	mdb, _ := NewMemDepot(WithClock(func() time.Time { return now }))
+	testChangedSince(t, mdb, &now)
+}
+
+// Stows and drops keys in db as the clock reading now moves on, and checks
+// that ChangedSince finds what changed
+func testChangedSince(t *testing.T, db *Depot, now *time.Time) {
+	t.Helper()
+	db.Stow("old", "old", nil)
+	*now = now.Add(time.Hour)
+	start := *now
+	db.Stow("new/b", "b", []byte("password"))
+	*now = now.Add(time.Hour)
+	db.Stow("new/a", "a", nil)
+	db.Drop("old")
+
+	keys, err := db.ChangedSince("", start)
+	if err != nil {
+		t.Fatalf("error listing changes: %v", err)
+	}
+	if len(keys) != 3 || keys[0].Key != "new/b" || keys[1].Key != "new/a" || keys[2].Key != "old" {
+		t.Fatalf("expected new/b, new/a, and old in order but got %+v", keys)
+	}
+	if !keys[0].Encrypted || keys[0].Deleted || !keys[2].Deleted {
+		t.Errorf("expected new/b to be encrypted and only old to be dropped but got %+v", keys)
+	}
+	if keys, err = db.ChangedSince("new/*", *now); err != nil || len(keys) != 1 || keys[0].Key != "new/a" {
+		t.Errorf("expected only new/a but got %+v (%v)", keys, err)
+	}
+	if keys, err = db.ChangedSince("", now.Add(time.Second)); err != nil || len(keys) != 0 {
+		t.Errorf("expected no changes but got %+v (%v)", keys, err)
+	}
+	if _, err = db.ChangedSince("[", start); err == nil {
+		t.Errorf("expected an error with an invalid pattern")
+	}
+}
@@ -0,0 +1,100 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// A Backend that several processes may use at once, which can be locked so
+// that only one of them at a time reads something, changes it, and writes it
+// back
+type Locker interface {
+	// Waits for any other process holding the lock to release it, then takes
+	// it and returns the function that releases it
+	Lock() (unlock func(), err error)
+}
+
+// How long to wait for another process to release a depot it is changing,
+// or for a busy sqlite3 database, before giving up with ErrBusy
+var LockTimeout = 10 * time.Second
+
+// Another process kept the depot locked for longer than LockTimeout
+var ErrBusy = errors.New("database is busy")
+
+// Calls fn holding the backend's lock if it is a Locker, so that changes it
+// makes based on what it reads are not interleaved with those of other
+// processes. Must not be called within fn, which would wait for itself.
+// Returns the error fn returns, or an error if the lock cannot be taken.
+func (db *Depot) locked(fn func() error) error {
+	l, ok := db.backend.(Locker)
+	if !ok {
+		return fn()
+	}
+
+	unlock, err := l.Lock()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	defer unlock()
+
+	return fn()
+}
+
+// Calls fn until it returns an error that busy does not report, waiting a
+// little longer each time, or until LockTimeout has passed, when ErrBusy is
+// returned wrapping the last error. Returns nil once fn succeeds.
+func retryBusy(busy func(error) bool, fn func() error) error {
+	deadline := time.Now().Add(LockTimeout)
+	wait := 5 * time.Millisecond
+	for {
+		err := fn()
+		if err == nil || !busy(err) {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %w", ErrBusy, err)
+		}
+
+		time.Sleep(wait)
+		wait = min(wait*2, 250*time.Millisecond)
+	}
+}
+
+// An advisory lock on the file at path, shared by every process that opens
+// the depot, along with a mutex that serves the goroutines of this one, since
+// a process may not see its own lock on a file. With no path, only the mutex
+// is used.
+type fileLock struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (l *fileLock) Lock() (func(), error) {
+	l.mu.Lock()
+	if l.path == "" {
+		return l.mu.Unlock, nil
+	}
+
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		l.mu.Unlock()
+		return nil, fmt.Errorf("cannot open lock file: %w", err)
+	}
+	err = retryBusy(func(err error) bool { return errors.Is(err, errLockHeld) }, func() error {
+		return lockFile(f)
+	})
+	if err != nil {
+		f.Close()
+		l.mu.Unlock()
+		return nil, err
+	}
+
+	return func() {
+		unlockFile(f)
+		f.Close()
+		l.mu.Unlock()
+	}, nil
+}
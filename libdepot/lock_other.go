@@ -0,0 +1,20 @@
+//go:build !unix
+
+package libdepot
+
+import (
+	"errors"
+	"os"
+)
+
+var errLockHeld = errors.New("lock is held by another process")
+
+// Files cannot be locked on this platform, so only the goroutines of one
+// process are kept from interleaving their changes
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,94 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Opens the depot at uri n times, as n processes would
+func openDepots(t *testing.T, uri string, n int) []*Depot {
+	dbs := make([]*Depot, n)
+	for i := range dbs {
+		d, err := NewDepot(uri)
+		if err != nil {
+			t.Fatalf("failed to initialize depot: %v", err)
+		}
+		t.Cleanup(func() { d.Close() })
+		dbs[i] = d
+	}
+
+	return dbs
+}
+
+// Adds an alias from each of the depots at once and checks that none of them
+// was lost to another reading the aliases before it wrote them back
+func testConcurrentAliases(t *testing.T, dbs []*Depot) {
+	if err := dbs[0].Stow("target", "value", nil); err != nil {
+		t.Fatalf("error stowing: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(dbs))
+	for i, d := range dbs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5 && errs[i] == nil; j++ {
+				errs[i] = d.Alias(fmt.Sprintf("alias-%d-%d", i, j), "target", false)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("error adding aliases from depot %d: %v", i, err)
+		}
+	}
+	aliases, err := dbs[0].Aliases()
+	if err != nil || len(aliases) != len(dbs)*5 {
+		t.Errorf("expected %d aliases but got %d (%v)", len(dbs)*5, len(aliases), err)
+	}
+}
+
+func TestLockConcurrentAliases(t *testing.T) {
+	dbs := openDepots(t, "dir://"+filepath.Join(t.TempDir(), "depot"), 4)
+	testConcurrentAliases(t, dbs)
+}
+
+func TestLockTimeout(t *testing.T) {
+	dbs := openDepots(t, "dir://"+filepath.Join(t.TempDir(), "depot"), 2)
+	if err := dbs[0].Stow("target", "value", nil); err != nil {
+		t.Fatalf("error stowing: %v", err)
+	}
+
+	unlock, err := dbs[0].backend.(Locker).Lock()
+	if err != nil {
+		t.Fatalf("error locking depot: %v", err)
+	}
+	defer func(timeout time.Duration) { LockTimeout = timeout }(LockTimeout)
+	LockTimeout = 50 * time.Millisecond
+
+	err = dbs[1].Alias("alias", "target", false)
+	if !errors.Is(err, ErrBusy) || !errors.Is(err, ErrDatabase) {
+		t.Errorf("expected %v while another depot holds the lock but got %v", ErrBusy, err)
+	}
+
+	// Once released, the lock can be taken, and is held until released again
+	done := make(chan error)
+	LockTimeout = 5 * time.Second
+	go func() { done <- dbs[1].Alias("alias", "target", false) }()
+	select {
+	case err = <-done:
+		t.Fatalf("expected the alias to wait for the lock but got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	if err = <-done; err != nil {
+		t.Errorf("error adding alias once the lock was released: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package libdepot
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Returned by lockFile while another process holds the lock
+var errLockHeld = errors.New("lock is held by another process")
+
+// Takes an exclusive advisory lock on f without waiting. Returns errLockHeld
+// if another process holds it, or another error if unsuccessful.
+func lockFile(f *os.File) error {
+	err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		return errLockHeld
+	}
+
+	return err
+}
+
+// Releases the lock taken with lockFile
+func unlockFile(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_UN)
+}
@@ -0,0 +1,75 @@
+package libdepot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// A slog.Handler that drops every record, for depots given no logger
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// Returns an Option that logs what is done with the depot to logger: every
+// stow, fetch, and drop at debug level, or at info level if it fails, or
+// error level if the database cannot be accessed; values that cannot be
+// decrypted or encrypted at warn and error level; and the work of syncing,
+// compacting, and purging tombstones at info level; and every SQL statement a
+// sqlite or postgres backend runs, and how long it took, at debug level.
+// Records carry the key and actor involved, but values, passwords, and keys
+// derived from them are never logged, nor are the strings and bytes a
+// statement is run with, only their lengths.
+func WithLogger(logger *slog.Logger) Option {
+	return func(db *Depot) {
+		db.logger = logger
+	}
+}
+
+// Returns the logger given with WithLogger, or one that discards everything
+func (db *Depot) log() *slog.Logger {
+	if db.logger == nil {
+		return slog.New(discardHandler{})
+	}
+
+	return db.logger
+}
+
+// Returns the attributes of a record about key
+func (db *Depot) keyAttrs(key string) []any {
+	attrs := []any{slog.String("key", key)}
+	if db.actor != "" {
+		attrs = append(attrs, slog.String("actor", db.actor))
+	}
+
+	return attrs
+}
+
+// Logs that the value of key could not be decrypted and returns the error
+// saying so, which wraps err
+func (db *Depot) decryptFailed(key string, err error) error {
+	level := slog.LevelWarn
+	if errors.Is(err, ErrCorrupted) {
+		level = slog.LevelError
+	}
+	db.log().Log(context.Background(), level, "cannot decrypt value", append(db.keyAttrs(key), slog.Any("error", err))...)
+
+	return fmt.Errorf("cannot decrypt data: %w", err)
+}
+
+// Logs the outcome of action on key at the level that err calls for
+func (db *Depot) logAction(action, key string, err error) {
+	attrs := db.keyAttrs(key)
+	switch {
+	case err == nil:
+		db.log().Debug(action, attrs...)
+	case errors.Is(err, ErrDatabase):
+		db.log().Error(action+" failed", append(attrs, slog.Any("error", err))...)
+	default:
+		db.log().Info(action+" failed", append(attrs, slog.Any("error", err))...)
+	}
+}
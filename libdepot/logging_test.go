@@ -0,0 +1,56 @@
+package libdepot
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	mdb, err := NewMemDepot(WithLogger(logger), WithActor("tester"))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+
+	mdb.Stow("db/password", "hunter2", []byte("correct horse"))
+	mdb.Fetch("db/password", []byte("battery staple"))
+	mdb.Fetch("missing", nil)
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var r map[string]any
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("cannot parse log record %q: %v", line, err)
+		}
+		records = append(records, r)
+	}
+
+	want := []struct{ level, msg, key string }{
+		{"DEBUG", "stow", "db/password"},
+		{"WARN", "cannot decrypt value", "db/password"},
+		{"INFO", "fetch failed", "db/password"},
+		{"INFO", "fetch failed", "missing"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("expected %v log records but got %v:\n%v", len(want), len(records), buf.String())
+	}
+	for i, w := range want {
+		r := records[i]
+		if r["level"] != w.level || r["msg"] != w.msg || r["key"] != w.key {
+			t.Errorf("expected %v %q for %v but got %v", w.level, w.msg, w.key, r)
+		}
+	}
+	if records[0]["actor"] != "tester" {
+		t.Errorf("expected the actor to be logged but got %v", records[0])
+	}
+
+	for _, secret := range []string{"hunter2", "correct horse", "battery staple"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("expected %q to be left out of the log but got:\n%v", secret, buf.String())
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package libdepot
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Backend that keeps entries in memory and never touches the disk.
+// Everything it holds is lost when it is closed.
+type memBackend struct {
+	mu      sync.RWMutex
+	entries map[string]Entry
+	meta    map[string][]byte
+	audit   []AuditEvent
+}
+
+// Returns an empty Backend held entirely in memory
+func NewMemBackend() Backend {
+	return &memBackend{
+		entries: make(map[string]Entry),
+		meta:    make(map[string][]byte),
+	}
+}
+
+// Returns a new storage medium held entirely in memory, which is useful for
+// tests and for secrets that should not outlive the process, or an error if
+// initialization is unsuccessful
+func NewMemDepot(opts ...Option) (*Depot, error) {
+	return NewDepotWithBackend(NewMemBackend(), opts...)
+}
+
+// Returns a copy of the entry that shares no memory with the original
+func cloneEntry(e Entry) *Entry {
+	e.Nonce = bytes.Clone(e.Nonce)
+	e.Check = bytes.Clone(e.Check)
+	e.Salt = bytes.Clone(e.Salt)
+	e.KeySalt = bytes.Clone(e.KeySalt)
+	return &e
+}
+
+func (b *memBackend) Get(key string) (*Entry, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	e, ok := b.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return cloneEntry(e), nil
+}
+
+func (b *memBackend) Put(e *Entry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entries[e.Key] = *cloneEntry(*e)
+	return nil
+}
+
+func (b *memBackend) PutAll(entries []*Entry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, e := range entries {
+		b.entries[e.Key] = *cloneEntry(*e)
+	}
+	return nil
+}
+
+func (b *memBackend) Increment(key string, delta int64, modified time.Time) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[key]
+	if !ok {
+		e = Entry{Key: key, Deleted: true}
+	}
+	n, err := addToCounter(&e, delta)
+	if err != nil {
+		return 0, err
+	}
+	b.entries[key] = *counterEntry(key, n, modified)
+
+	return n, nil
+}
+
+func (b *memBackend) Delete(key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.entries, key)
+	return nil
+}
+
+func (b *memBackend) List(prefix string) ([]*Entry, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var entries []*Entry
+	for key, e := range b.entries {
+		if strings.HasPrefix(key, prefix) {
+			entries = append(entries, cloneEntry(e))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	return entries, nil
+}
+
+func (b *memBackend) Meta(name string) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	data, ok := b.meta[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return bytes.Clone(data), nil
+}
+
+func (b *memBackend) SetMeta(name string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.meta[name] = bytes.Clone(data)
+	return nil
+}
+
+func (b *memBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entries = make(map[string]Entry)
+	b.meta = make(map[string][]byte)
+	b.audit = nil
+	return nil
+}
+
+func (b *memBackend) AppendAudit(e *AuditEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.audit = append(b.audit, *e)
+	return nil
+}
+
+func (b *memBackend) AuditLog(since time.Time) ([]*AuditEvent, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var events []*AuditEvent
+	for _, e := range b.audit {
+		if !e.Time.Before(since) {
+			e := e
+			events = append(events, &e)
+		}
+	}
+
+	return events, nil
+}
@@ -0,0 +1,29 @@
+package libdepot
+
+import (
+	"testing"
+)
+
+func TestMemDepot(t *testing.T) {
+	key := "memory"
+	data := "testing123"
+	password := []byte("password")
+
+	mdb, err := NewMemDepot()
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err.Error())
+	}
+	t.Cleanup(func() { mdb.Close() })
+
+	err = mdb.Stow(key, data, password)
+	if err != nil {
+		t.Errorf("error inserting ciphertext into depot: %v", err.Error())
+	}
+	val, err := mdb.Fetch(key, password)
+	if err != nil {
+		t.Errorf("error fetching %v from depot: %v", key, err.Error())
+	}
+	if val != data {
+		t.Errorf("expected %v but %v was retrieved for key %v", data, val, key)
+	}
+}
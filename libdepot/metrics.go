@@ -0,0 +1,216 @@
+package libdepot
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Backend that can tell how much space its storage takes up
+type Sizer interface {
+	// Returns the size of the storage in bytes
+	Size() (int64, error)
+}
+
+// The upper bounds of the buckets request durations are counted in, in
+// seconds
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// What the requests counted together have in common
+type requestLabels struct {
+	route  string
+	method string
+	code   int
+}
+
+// How many requests took up to each of durationBuckets, and how long they
+// took altogether
+type durationHistogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// Counts the requests a Server handles and how long they take, to be
+// reported along with the number of entries in the depot and the size of its
+// database in the Prometheus text format
+type metrics struct {
+	mu        sync.Mutex
+	requests  map[requestLabels]uint64
+	durations map[string]*durationHistogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:  map[requestLabels]uint64{},
+		durations: map[string]*durationHistogram{},
+	}
+}
+
+// Returns the part of the API a request path falls under, so that requests
+// for different keys are counted together
+func requestRoute(path string) string {
+	switch {
+	case path == "/metrics":
+		return "metrics"
+	case path == "/v1/entries", strings.HasPrefix(path, "/v1/entries/"):
+		return "entries"
+	case strings.HasPrefix(path, "/v1/meta/"):
+		return "meta"
+	case strings.HasPrefix(path, "/v1/values/"):
+		return "values"
+	case strings.HasPrefix(path, "/v1/shares/"):
+		return "shares"
+	default:
+		return "other"
+	}
+}
+
+// Counts a request that was answered with code after the given time
+func (m *metrics) observe(route, method string, code int, elapsed time.Duration) {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPost, http.MethodDelete:
+	default:
+		// Any other method is refused, and counting each one separately
+		// would let clients make up labels
+		method = "other"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestLabels{route, method, code}]++
+	h := m.durations[route]
+	if h == nil {
+		h = &durationHistogram{buckets: make([]uint64, len(durationBuckets))}
+		m.durations[route] = h
+	}
+	seconds := elapsed.Seconds()
+	for i, le := range durationBuckets {
+		if seconds <= le {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// Writes the metrics, and those of the depot, in the Prometheus text
+// format. Returns an error if the depot cannot be read.
+func (m *metrics) write(w io.Writer, db *Depot) error {
+	entries, err := db.backend.List("")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	live, deleted := 0, 0
+	for _, e := range entries {
+		if e.Deleted {
+			deleted++
+		} else {
+			live++
+		}
+	}
+	var size int64 = -1
+	if s, ok := db.backend.(Sizer); ok {
+		if size, err = s.Size(); err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP depot_http_requests_total Requests handled, by route, method, and status code.")
+	fmt.Fprintln(w, "# TYPE depot_http_requests_total counter")
+	labels := make([]requestLabels, 0, len(m.requests))
+	for l := range m.requests {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		a, b := labels[i], labels[j]
+		if a.route != b.route {
+			return a.route < b.route
+		} else if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	for _, l := range labels {
+		fmt.Fprintf(w, "depot_http_requests_total{route=%q,method=%q,code=\"%d\"} %d\n",
+			l.route, l.method, l.code, m.requests[l])
+	}
+
+	fmt.Fprintln(w, "# HELP depot_http_request_duration_seconds How long requests took to handle, by route.")
+	fmt.Fprintln(w, "# TYPE depot_http_request_duration_seconds histogram")
+	routes := make([]string, 0, len(m.durations))
+	for r := range m.durations {
+		routes = append(routes, r)
+	}
+	sort.Strings(routes)
+	for _, r := range routes {
+		h := m.durations[r]
+		for i, le := range durationBuckets {
+			fmt.Fprintf(w, "depot_http_request_duration_seconds_bucket{route=%q,le=%q} %d\n",
+				r, strconv.FormatFloat(le, 'g', -1, 64), h.buckets[i])
+		}
+		fmt.Fprintf(w, "depot_http_request_duration_seconds_bucket{route=%q,le=\"+Inf\"} %d\n", r, h.count)
+		fmt.Fprintf(w, "depot_http_request_duration_seconds_sum{route=%q} %v\n", r, h.sum)
+		fmt.Fprintf(w, "depot_http_request_duration_seconds_count{route=%q} %d\n", r, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP depot_entries Keys held by the depot, and tombstones of dropped keys.")
+	fmt.Fprintln(w, "# TYPE depot_entries gauge")
+	fmt.Fprintf(w, "depot_entries{state=\"live\"} %d\n", live)
+	fmt.Fprintf(w, "depot_entries{state=\"dropped\"} %d\n", deleted)
+
+	if size >= 0 {
+		fmt.Fprintln(w, "# HELP depot_database_size_bytes The size of the depot's database.")
+		fmt.Fprintln(w, "# TYPE depot_database_size_bytes gauge")
+		fmt.Fprintf(w, "depot_database_size_bytes %d\n", size)
+	}
+
+	return nil
+}
+
+// A ResponseWriter that records the status code of the response
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request, user *User) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	} else if !user.Admin {
+		writeError(w, ErrForbidden)
+		return
+	}
+
+	var buf strings.Builder
+	if err := s.metrics.write(&buf, s.depot); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	io.WriteString(w, buf.String())
+}
@@ -0,0 +1,98 @@
+package libdepot
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// A change to the schema of a SQL database, applied once, in order of version
+type migration struct {
+	version     int
+	description string
+	apply       func(tx *sql.Tx) error
+}
+
+// Returns the version of the database's schema, the newest migration applied
+// to it, or 0 if none has been, creating the table that records it if need
+// be. Returns an error if unsuccessful.
+func schemaVersion(db *sql.DB) (int, error) {
+	_, err := db.Exec(`create table if not exists schema_version (version int primary key)`)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = db.QueryRow(`select coalesce(max(version), 0) from schema_version`).Scan(&version)
+
+	return version, err
+}
+
+// Brings the schema of the database up to date by applying the migrations
+// newer than its version in order, each in a transaction of its own that
+// also records its version, so a failed one changes nothing. Migrations must
+// tolerate a database created before versioning began, which is at version 0
+// whatever its schema. If there is anything to apply, backup is called first
+// (unless it is nil) with the version the database is at. Returns an error if
+// unsuccessful, leaving the database at the last version that succeeded.
+func migrate(db *sql.DB, migrations []migration, backup func(from int) error) error {
+	from, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	var pending []migration
+	for _, m := range migrations {
+		if m.version > from {
+			pending = append(pending, m)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if backup != nil {
+		if err = backup(from); err != nil {
+			return fmt.Errorf("cannot back up database before migrating: %w", err)
+		}
+	}
+
+	for _, m := range pending {
+		if err = applyMigration(db, m); err != nil {
+			return fmt.Errorf("cannot migrate database to version %d (%v): %w", m.version, m.description, err)
+		}
+	}
+
+	return nil
+}
+
+// Applies the migration and records its version in one transaction. Returns
+// an error if unsuccessful.
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = m.apply(tx); err != nil {
+		return err
+	}
+	// Another process may have got there first
+	_, err = tx.Exec(fmt.Sprintf(`insert into schema_version (version) values (%d) on conflict do nothing`, m.version))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Returns a migration function that runs the given statements in order
+func execMigration(stmts ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,172 @@
+package libdepot
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// The depot metadata that namespaces with passwords of their own are kept
+// in, as a JSON object mapping each namespace to its salt and key check
+const namespacesMeta = "namespaces"
+
+// What a depot keeps about a namespace with a password of its own: the salt
+// its keys are derived with, and a check of the key its password derives
+type namespace struct {
+	Salt  []byte `json:"salt"`
+	Check []byte `json:"check"`
+}
+
+// Returns the namespace of key, the part of it before its first slash, or ""
+// if it has none
+func Namespace(key string) string {
+	ns, _, ok := strings.Cut(key, "/")
+	if !ok {
+		return ""
+	}
+
+	return ns
+}
+
+func (db *Depot) namespaces() (map[string]namespace, error) {
+	namespaces := map[string]namespace{}
+	data, err := db.backend.Meta(namespacesMeta)
+	if errors.Is(err, ErrNotFound) {
+		return namespaces, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	if err = json.Unmarshal(data, &namespaces); err != nil {
+		return nil, fmt.Errorf("cannot read namespaces: %w", ErrCorrupted)
+	}
+
+	return namespaces, nil
+}
+
+func (db *Depot) setNamespaces(namespaces map[string]namespace) error {
+	data, err := json.Marshal(namespaces)
+	if err != nil {
+		return err
+	}
+	if err = db.backend.SetMeta(namespacesMeta, data); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return nil
+}
+
+// Returns the namespaces that have passwords of their own (see
+// CreateNamespace), sorted, or an error if unsuccessful
+func (db *Depot) Namespaces() ([]string, error) {
+	namespaces, err := db.namespaces()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(namespaces))
+	for name := range namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Gives the namespace a password of its own, and a salt of its own to derive
+// keys from it with, so that values stowed under keys in it (see Namespace)
+// can only be stowed and fetched with that password, and no other password
+// that protects the depot unlocks them. Values already stowed under it are
+// left as they are, encrypted with the password they were stowed with, until
+// they are stowed again. Returns ErrExists if the namespace already has a
+// password, or another error if unsuccessful.
+func (db *Depot) CreateNamespace(name string, password []byte) error {
+	name = db.normalizeKey(name)
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("%w: namespace %q", ErrInvalidKey, name)
+	} else if password == nil {
+		return ErrPasswordNeeded
+	}
+
+	return db.locked(func() error {
+		namespaces, err := db.namespaces()
+		if err != nil {
+			return err
+		} else if _, ok := namespaces[name]; ok {
+			return fmt.Errorf("namespace %v: %w", name, ErrExists)
+		}
+
+		salt := make([]byte, 32)
+		if _, err = io.ReadFull(db.random(), salt); err != nil {
+			return fmt.Errorf("cannot generate random salt: %w", err)
+		}
+		namespaces[name] = namespace{Salt: salt, Check: keyCheck(db.deriveKey(password, salt), salt)}
+
+		return db.setNamespaces(namespaces)
+	})
+}
+
+// Takes away the namespace's own password, so that values stowed under it
+// from then on are encrypted with a key derived with the depot's salt. Values
+// stowed while it had one carry its salt, so they can still be fetched with
+// its password. Returns ErrNotFound if the namespace has no password of its
+// own, or another error if unsuccessful.
+func (db *Depot) RemoveNamespace(name string) error {
+	name = db.normalizeKey(name)
+	return db.locked(func() error {
+		namespaces, err := db.namespaces()
+		if err != nil {
+			return err
+		} else if _, ok := namespaces[name]; !ok {
+			return fmt.Errorf("namespace %v: %w", name, ErrNotFound)
+		}
+		delete(namespaces, name)
+
+		return db.setNamespaces(namespaces)
+	})
+}
+
+// Derives the keys that values stowed under various keys are encrypted with
+// from one password, once for each namespace with a password of its own
+// (see CreateNamespace) and once for the rest, keeping each by its salt
+type keyDeriver struct {
+	db         *Depot
+	password   []byte
+	namespaces map[string]namespace
+	keys       map[string][]byte
+}
+
+func (db *Depot) keyDeriver(password []byte) *keyDeriver {
+	return &keyDeriver{db: db, password: password, keys: map[string][]byte{}}
+}
+
+// Returns the key to encrypt a value stowed under key with, and the salt it
+// was derived with if it is that of the key's namespace rather than the
+// depot's own. Returns ErrBadPassword if the namespace has a password of its
+// own and this is not it, or another error if unsuccessful.
+func (d *keyDeriver) derive(key string) (encryptionKey, salt []byte, err error) {
+	if d.namespaces == nil {
+		if d.namespaces, err = d.db.namespaces(); err != nil {
+			return nil, nil, err
+		}
+	}
+	name := Namespace(key)
+	ns, ok := d.namespaces[name]
+	if ok {
+		salt = ns.Salt
+	}
+	if encryptionKey, ok = d.keys[string(salt)]; ok {
+		return encryptionKey, salt, nil
+	}
+
+	encryptionKey = d.db.deriveKey(d.password, salt)
+	if salt != nil && !hmac.Equal(ns.Check, keyCheck(encryptionKey, salt)) {
+		return nil, nil, fmt.Errorf("%w for namespace %v", ErrBadPassword, name)
+	}
+	d.keys[string(salt)] = encryptionKey
+
+	return encryptionKey, salt, nil
+}
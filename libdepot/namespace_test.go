@@ -0,0 +1,73 @@
+package libdepot
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestNamespaces(t *testing.T) {
+	mdb, _ := NewMemDepot()
+	misc, banking := []byte("misc password"), []byte("banking password")
+	if err := mdb.Stow("banking/old", "stowed before", misc); err != nil {
+		t.Fatalf("error stowing: %v", err)
+	}
+
+	if err := mdb.CreateNamespace("banking", banking); err != nil {
+		t.Fatalf("error creating namespace: %v", err)
+	}
+	if err := mdb.CreateNamespace("banking", misc); !errors.Is(err, ErrExists) {
+		t.Errorf("expected %v creating a namespace twice but got %v", ErrExists, err)
+	}
+	if err := mdb.CreateNamespace("banking/cards", banking); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected %v for a namespace with a slash but got %v", ErrInvalidKey, err)
+	}
+	if names, err := mdb.Namespaces(); err != nil || !slices.Equal(names, []string{"banking"}) {
+		t.Errorf("expected [banking] but got %v (%v)", names, err)
+	}
+
+	// Only the namespace's password stows and fetches under it
+	if err := mdb.Stow("banking/acct", "1234", misc); !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v stowing with another password but got %v", ErrBadPassword, err)
+	}
+	if err := mdb.StowAll(map[string]string{"banking/pin": "0000", "misc/wifi": "hunter2"}, misc); !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v stowing several with another password but got %v", ErrBadPassword, err)
+	}
+	if err := mdb.Stow("banking/acct", "1234", banking); err != nil {
+		t.Fatalf("error stowing with the namespace's password: %v", err)
+	}
+	if _, err := mdb.Fetch("banking/acct", misc); !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v fetching with another password but got %v", ErrBadPassword, err)
+	}
+	if val, err := mdb.Fetch("banking/acct", banking); err != nil || val != "1234" {
+		t.Errorf("expected 1234 but got %q (%v)", val, err)
+	}
+	if e, _ := mdb.backend.Get("banking/acct"); e.Salt == nil {
+		t.Errorf("expected the value to carry the namespace's salt")
+	}
+	if err := mdb.Stow("misc/wifi", "hunter2", misc); err != nil {
+		t.Fatalf("error stowing outside the namespace: %v", err)
+	}
+	if err := mdb.Copy("misc/wifi", "banking/wifi", misc, false); !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v copying into the namespace with another password but got %v", ErrBadPassword, err)
+	}
+
+	// Values stowed before keep their password until reencrypted with it
+	if val, err := mdb.Fetch("banking/old", misc); err != nil || val != "stowed before" {
+		t.Errorf("expected an older value to keep its password but got %q (%v)", val, err)
+	}
+	if n, skipped, err := mdb.Reencrypt(misc, nil); err != nil || n != 1 || !slices.Equal(skipped, []string{"banking/acct", "banking/old"}) {
+		t.Errorf("expected only misc/wifi to be reencrypted with the misc password but got %v, skipped %v (%v)", n, skipped, err)
+	}
+
+	// Values keep the namespace's salt once it is removed
+	if err := mdb.RemoveNamespace("banking"); err != nil {
+		t.Fatalf("error removing namespace: %v", err)
+	}
+	if err := mdb.RemoveNamespace("banking"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v removing a namespace twice but got %v", ErrNotFound, err)
+	}
+	if val, err := mdb.Fetch("banking/acct", banking); err != nil || val != "1234" {
+		t.Errorf("expected 1234 after removing the namespace but got %q (%v)", val, err)
+	}
+}
@@ -0,0 +1,111 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A Backend that can get several entries at once, such as in one query
+type MultiGetter interface {
+	// Returns the entries, tombstones included, stored under any of keys, in
+	// no particular order. Keys with no entry are left out.
+	GetAll(keys []string) ([]*Entry, error)
+}
+
+// Returns the values of those of keys, or of the keys they are aliases of,
+// that are not encrypted, by the names they were asked for. Keys that do not
+// exist or whose values are encrypted are left out, so no password is ever
+// needed. When the backend is a MultiGetter every value is read at once.
+// Returns an error if unsuccessful.
+func (db *Depot) PeekAll(keys []string) (map[string]string, error) {
+	aliases, err := db.Aliases()
+	if err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string, len(keys))
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		key = db.normalizeKey(key)
+		target := key
+		if t, ok := aliases[key]; ok {
+			target = t
+		}
+		targets[key] = target
+		names = append(names, target)
+	}
+
+	entries, err := db.getAll(names)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]*Entry, len(entries))
+	for _, e := range entries {
+		byKey[e.Key] = e
+	}
+
+	vals := make(map[string]string, len(targets))
+	for key, target := range targets {
+		e, ok := byKey[target]
+		if !ok || e.Deleted || e.Nonce != nil {
+			continue
+		}
+		val, err := db.fetchEntry(e, nil)
+		if err = db.audit(AuditFetch, key, err); err != nil {
+			return nil, err
+		}
+		vals[key] = val
+	}
+
+	return vals, nil
+}
+
+// Returns the entries stored under keys, in one query when the backend is a
+// MultiGetter, leaving out those that do not exist, or an error if
+// unsuccessful
+func (db *Depot) getAll(keys []string) ([]*Entry, error) {
+	if g, ok := db.backend.(MultiGetter); ok {
+		entries, err := g.GetAll(keys)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+		return entries, nil
+	}
+
+	entries := make([]*Entry, 0, len(keys))
+	for _, key := range keys {
+		e, err := db.backend.Get(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// Returns the values of the keys beginning with prefix that are not
+// encrypted, by key, in one listing of the backend. Encrypted values and
+// aliases are left out, so no password is ever needed. Returns an error if
+// unsuccessful.
+func (db *Depot) PeekPrefix(prefix string) (map[string]string, error) {
+	entries, err := db.backend.List(db.normalizeKey(prefix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	vals := map[string]string{}
+	for _, e := range entries {
+		if e.Deleted || e.Nonce != nil {
+			continue
+		}
+		val, err := db.fetchEntry(e, nil)
+		if err = db.audit(AuditFetch, e.Key, err); err != nil {
+			return nil, err
+		}
+		vals[e.Key] = val
+	}
+
+	return vals, nil
+}
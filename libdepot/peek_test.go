@@ -0,0 +1,43 @@
+package libdepot
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestPeek(t *testing.T) {
+	mdb, _ := NewMemDepot(WithCompressionThreshold(16))
+	testPeek(t, mdb)
+}
+
+// Stows plain, compressed, encrypted, and dropped values in db and checks
+// that only the plain ones are peeked at
+func testPeek(t *testing.T, db *Depot) {
+	t.Helper()
+	long := strings.Repeat("compressible ", 8)
+	db.Stow("app/host", "localhost", nil)
+	db.Stow("app/banner", long, nil)
+	db.Stow("app/password", "hunter2", []byte("password"))
+	db.Stow("app/old", "old", nil)
+	db.Drop("app/old")
+	db.Stow("other", "other", nil)
+	if err := db.Alias("host", "app/host", false); err != nil {
+		t.Fatalf("error creating alias: %v", err)
+	}
+
+	want := map[string]string{"app/host": "localhost", "app/banner": long}
+	vals, err := db.PeekPrefix("app/")
+	if err != nil || !maps.Equal(vals, want) {
+		t.Errorf("expected %v but got %v (%v)", want, vals, err)
+	}
+
+	want = map[string]string{"host": "localhost", "app/banner": long, "other": "other"}
+	vals, err = db.PeekAll([]string{"host", "app/banner", "app/password", "app/old", "missing", "other"})
+	if err != nil || !maps.Equal(vals, want) {
+		t.Errorf("expected %v but got %v (%v)", want, vals, err)
+	}
+	if vals, err = db.PeekAll(nil); err != nil || len(vals) != 0 {
+		t.Errorf("expected nothing but got %v (%v)", vals, err)
+	}
+}
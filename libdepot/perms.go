@@ -0,0 +1,153 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// A Backend kept in files on the local filesystem, whose permissions are
+// checked when a depot is opened (see WithInsecureFileFunc)
+type FileBackend interface {
+	// Returns the paths of the files and directories that hold the depot
+	Files() ([]string, error)
+}
+
+// Called by NewDepot for each file holding the depot that users other than
+// its owner have some access to, along with its mode. A non-nil error aborts
+// opening the depot and is returned to its caller.
+type InsecureFileFunc func(path string, mode fs.FileMode) error
+
+// Files holding a depot should be accessible to their owner alone
+var ErrInsecurePermissions = errors.New("database is accessible to other users")
+
+// Returns an Option that reports files holding the depot that other users
+// have access to to the given function, instead of refusing to open the depot
+func WithInsecureFileFunc(fn InsecureFileFunc) Option {
+	return func(db *Depot) {
+		db.insecureFile = fn
+	}
+}
+
+// An insecure file found by insecureFiles
+type insecureFile struct {
+	path string
+	mode fs.FileMode
+}
+
+// Returns the files holding the depot that users other than their owner have
+// some access to, or none if the backend is not a FileBackend or the system
+// does not have Unix permissions. Returns an error if unsuccessful.
+func (db *Depot) insecureFiles() ([]insecureFile, error) {
+	f, ok := db.backend.(FileBackend)
+	if !ok || runtime.GOOS == "windows" {
+		return nil, nil
+	}
+	paths, err := f.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	var insecure []insecureFile
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 && info.Mode().Perm()&0077 != 0 {
+			insecure = append(insecure, insecureFile{path, info.Mode()})
+		}
+	}
+
+	return insecure, nil
+}
+
+// Refuses to open a depot whose files other users have access to, or reports
+// them to the function given with WithInsecureFileFunc. Returns an error if
+// unsuccessful.
+func (db *Depot) checkPermissions() error {
+	insecure, err := db.insecureFiles()
+	if err != nil {
+		return fmt.Errorf("cannot check permissions: %w", err)
+	}
+
+	for _, f := range insecure {
+		if db.insecureFile == nil {
+			return fmt.Errorf("%w: %v has mode %v", ErrInsecurePermissions, f.path, f.mode.Perm())
+		}
+		if err = db.insecureFile(f.path, f.mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Takes away every permission of users other than the owner from the files
+// and directories that hold the depot, leaving files at 0600 and directories
+// at 0700 at most. Returns the number of files changed or an error if
+// unsuccessful.
+func (db *Depot) FixPermissions() (int, error) {
+	insecure, err := db.insecureFiles()
+	if err != nil {
+		return 0, fmt.Errorf("cannot check permissions: %w", err)
+	}
+
+	for i, f := range insecure {
+		if err = os.Chmod(f.path, f.mode.Perm()&0700); err != nil {
+			return i, err
+		}
+	}
+
+	return len(insecure), nil
+}
+
+// Creates the database file at path, and the directory it is in, with
+// permissions for their owner alone if they do not exist, so the database
+// is never readable by others, even briefly. Returns an error if
+// unsuccessful.
+func createPrivate(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return f.Close()
+}
+
+// Returns the path of the file a sqlite3 database is kept in, given as a path
+// or a file: URI, or "" if it is held in memory
+func sqlitePath(uri string) string {
+	path, query, _ := strings.Cut(uri, "?")
+	if rest, ok := strings.CutPrefix(path, "file:"); ok {
+		if params, err := url.ParseQuery(query); err == nil && params.Get("mode") == "memory" {
+			return ""
+		}
+		// sqlite allows no authority but localhost
+		if p, ok := strings.CutPrefix(rest, "//"); ok {
+			rest = strings.TrimPrefix(p, "localhost")
+		}
+		if p, err := url.PathUnescape(rest); err == nil {
+			rest = p
+		}
+		path = rest
+	}
+	if path == ":memory:" {
+		return ""
+	}
+
+	return path
+}
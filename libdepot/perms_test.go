@@ -0,0 +1,62 @@
+package libdepot
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPermissions(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "depot")
+	path := filepath.Join(dir, "test.db")
+
+	d, err := NewDepot(path)
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	d.Stow("key", "value", nil)
+	d.Close()
+	for p, want := range map[string]fs.FileMode{dir: 0700, path: 0600} {
+		if info, err := os.Stat(p); err != nil || info.Mode().Perm() != want {
+			t.Errorf("expected %v to be created with mode %v but got %v (%v)", p, want, info.Mode().Perm(), err)
+		}
+	}
+
+	if err = os.Chmod(path, 0644); err != nil {
+		t.Fatalf("error changing mode: %v", err)
+	}
+	if _, err = NewDepot(path); !errors.Is(err, ErrInsecurePermissions) {
+		t.Errorf("expected %v opening a world-readable database but got %v", ErrInsecurePermissions, err)
+	}
+
+	var reported []string
+	d, err = NewDepot(path, WithInsecureFileFunc(func(p string, mode fs.FileMode) error {
+		reported = append(reported, p)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	defer d.Close()
+	// The write-ahead log and index sqlite made for the database take on its
+	// mode as well
+	if len(reported) == 0 || reported[0] != path {
+		t.Errorf("expected %v to be reported but got %v", path, reported)
+	}
+
+	problems, err := d.Check(nil, false)
+	if err != nil || len(problems) != len(reported) || !problems[0].Repairable {
+		t.Errorf("expected a repairable problem for each file but got %v (%v)", problems, err)
+	}
+	if n, err := d.FixPermissions(); err != nil || n != len(reported) {
+		t.Errorf("expected %v files to be fixed but got %v (%v)", len(reported), n, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600 after fixing but got %v (%v)", info.Mode().Perm(), err)
+	}
+	if problems, err = d.Check(nil, false); err != nil || len(problems) != 0 {
+		t.Errorf("expected no problems after fixing but got %v (%v)", problems, err)
+	}
+}
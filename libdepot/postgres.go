@@ -0,0 +1,328 @@
+package libdepot
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// A Backend that keeps entries in a PostgreSQL database, which lets several
+// clients share one depot
+type postgresBackend struct {
+	db    *sql.DB
+	stmts *statements
+}
+
+// Returns a Backend stored in the PostgreSQL database at uri (a
+// postgres:// connection string), creating the schema if it does not exist
+// and migrating it if it is out of date, or an error if initialization is
+// unsuccessful.
+func NewPostgresBackend(uri string) (Backend, error) {
+	conn, err := sql.Open("postgres", uri)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to database: %w", err)
+	}
+
+	b := &postgresBackend{conn, newStatements(conn)}
+	if err = b.init(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return b, nil
+}
+
+// The migrations that bring a PostgreSQL database's schema up to date, in
+// order. Each runs in a transaction, which PostgreSQL extends to changes to
+// the schema, since a database on a server can't be copied aside first.
+var postgresMigrations = []migration{
+	{1, "create tables", execMigration(`
+		create table if not exists storage (
+			modified    bigint not null,
+			key         text primary key,
+			val         text not null,
+			nonce       bytea unique,
+			checkval    bytea,
+			salt        bytea,
+			deleted     boolean not null default false,
+			compression text not null default ''
+		)`, `
+		create table if not exists meta (
+			name text primary key,
+			data bytea not null
+		)`, `
+		create table if not exists audit (
+			id     bigserial primary key,
+			time   timestamptz not null,
+			actor  text not null,
+			action text not null,
+			key    text not null,
+			error  text not null default ''
+		)`,
+		`create or replace rule audit_no_update as on update to audit do instead nothing`,
+		`create or replace rule audit_no_delete as on delete to audit do instead nothing`)},
+	{2, "upgrade databases from before versioning", execMigration(
+		`alter table storage add column if not exists deleted boolean not null default false`,
+		`alter table storage add column if not exists salt bytea`,
+		`alter table storage add column if not exists compression text not null default ''`)},
+	{3, "record the sealer of each value", execMigration(
+		`alter table storage add column if not exists cipher text not null default ''`)},
+	{4, "index values by when they were modified", execMigration(
+		`create index if not exists storage_modified on storage (modified)`)},
+	{5, "record the salt of each value", execMigration(
+		`alter table storage add column if not exists key_salt bytea`)},
+}
+
+// Brings the schema of the database up to date and gives it a salt if it has
+// none yet. Returns an error if unsuccessful.
+func (b *postgresBackend) init() error {
+	if err := migrate(b.db, postgresMigrations, nil); err != nil {
+		return err
+	}
+
+	// Several clients may be initializing the same depot at once, so the salt
+	// is created here where only the first one can win
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	_, err := b.db.Exec(`
+		insert into meta (name, data)
+		values ('salt', $1)
+		on conflict (name) do nothing`,
+		salt)
+
+	return err
+}
+
+func (b *postgresBackend) Get(key string) (*Entry, error) {
+	var modified int64
+	e := Entry{Key: key}
+	err := b.stmts.QueryRow(`
+		select modified, val, nonce, checkval, salt, deleted, compression, cipher, key_salt
+		from storage
+		where key = $1`,
+		key).Scan(&modified, &e.Val, &e.Nonce, &e.Check, &e.Salt, &e.Deleted, &e.Compression, &e.Cipher, &e.KeySalt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	e.Modified = time.Unix(modified, 0)
+
+	return &e, nil
+}
+
+func (b *postgresBackend) GetAll(keys []string) ([]*Entry, error) {
+	rows, err := b.stmts.Query(`
+		select modified, key, val, nonce, checkval, salt, deleted, compression, cipher, key_salt
+		from storage
+		where key = any($1)`,
+		pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanEntries(rows)
+}
+
+// Stores an entry, replacing any with the same key
+const postgresPut = `
+	insert into storage (modified, key, val, nonce, checkval, salt, deleted, compression, cipher, key_salt)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	on conflict (key) do
+	update set
+		modified = excluded.modified,
+		val = excluded.val,
+		nonce = excluded.nonce,
+		checkval = excluded.checkval,
+		salt = excluded.salt,
+		deleted = excluded.deleted,
+		compression = excluded.compression,
+		cipher = excluded.cipher,
+		key_salt = excluded.key_salt`
+
+func (b *postgresBackend) Put(e *Entry) error {
+	_, err := b.stmts.Exec(postgresPut, entryArgs(e)...)
+	return err
+}
+
+// Adds to a counter, or starts one that does not exist, or is a tombstone,
+// at the amount added, returning the count, or nothing if the value is not a
+// counter or the count would overflow. The amount is given both as text ($3)
+// and as a number ($4), and the value is only cast once it is known to be a
+// number.
+const postgresIncrement = `
+	insert into storage (modified, key, val, deleted, compression, cipher)
+	values ($1, $2, $3, false, '', '')
+	on conflict (key) do
+	update set
+		modified = excluded.modified,
+		val = case when storage.deleted then excluded.val
+			else (storage.val::numeric + $4::bigint)::text end,
+		nonce = null,
+		checkval = null,
+		salt = null,
+		deleted = false,
+		compression = '',
+		cipher = '',
+		key_salt = null
+	where storage.deleted or (
+		storage.nonce is null and storage.compression = ''
+		and case when storage.val ~ '^(0|-?[1-9][0-9]*)$'
+			then storage.val::numeric + $4::bigint
+				between -9223372036854775808 and 9223372036854775807
+			else false end)
+	returning val::bigint`
+
+func (b *postgresBackend) Increment(key string, delta int64, modified time.Time) (int64, error) {
+	var n int64
+	err := b.stmts.QueryRow(postgresIncrement, modified.Unix(), key, strconv.FormatInt(delta, 10), delta).Scan(&n)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, incrementError(b, key, delta)
+	}
+
+	return n, err
+}
+
+func (b *postgresBackend) PutAll(entries []*Entry) error {
+	argSets := make([][]any, len(entries))
+	for i, e := range entries {
+		argSets[i] = entryArgs(e)
+	}
+
+	return b.stmts.ExecAll(postgresPut, argSets)
+}
+
+func (b *postgresBackend) Delete(key string) error {
+	_, err := b.stmts.Exec("delete from storage where key = $1", key)
+	return err
+}
+
+func (b *postgresBackend) List(prefix string) ([]*Entry, error) {
+	rows, err := b.stmts.Query(`
+		select modified, key, val, nonce, checkval, salt, deleted, compression, cipher, key_salt
+		from storage
+		where left(key, length($1)) = $1
+		order by key`,
+		prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanEntries(rows)
+}
+
+func (b *postgresBackend) ListSince(t time.Time) ([]*Entry, error) {
+	rows, err := b.stmts.Query(`
+		select modified, key, val, nonce, checkval, salt, deleted, compression, cipher, key_salt
+		from storage
+		where modified >= $1
+		order by modified, key`,
+		t.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	return scanEntries(rows)
+}
+
+func (b *postgresBackend) Meta(name string) ([]byte, error) {
+	var data []byte
+	err := b.stmts.QueryRow("select data from meta where name = $1", name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+func (b *postgresBackend) SetMeta(name string, data []byte) error {
+	_, err := b.stmts.Exec(`
+		insert into meta (name, data)
+		values ($1, $2)
+		on conflict (name) do
+		update set data = excluded.data`,
+		name, data)
+
+	return err
+}
+
+func (b *postgresBackend) queries() *statements {
+	return b.stmts
+}
+
+func (b *postgresBackend) Close() error {
+	b.stmts.close()
+	return b.db.Close()
+}
+
+func (b *postgresBackend) AppendAudit(e *AuditEvent) error {
+	_, err := b.stmts.Exec(`
+		insert into audit (time, actor, action, key, error)
+		values ($1, $2, $3, $4, $5)`,
+		e.Time, e.Actor, e.Action, e.Key, e.Error)
+
+	return err
+}
+
+func (b *postgresBackend) AuditLog(since time.Time) ([]*AuditEvent, error) {
+	rows, err := b.stmts.Query(`
+		select time, actor, action, key, error
+		from audit
+		where time >= $1
+		order by id`,
+		since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*AuditEvent
+	for rows.Next() {
+		var e AuditEvent
+		if err = rows.Scan(&e.Time, &e.Actor, &e.Action, &e.Key, &e.Error); err != nil {
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+
+	return events, rows.Err()
+}
+
+// Rebuilds the depot's tables with VACUUM FULL, which locks them while it
+// runs, and refreshes the query planner's statistics
+func (b *postgresBackend) Compact() (int64, error) {
+	before, err := b.size()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = b.db.Exec("vacuum (full, analyze) storage, meta, audit"); err != nil {
+		return 0, err
+	}
+
+	after, err := b.size()
+	if err != nil {
+		return 0, err
+	}
+
+	return before - after, nil
+}
+
+// Returns the size of the depot's tables and their indexes in bytes
+func (b *postgresBackend) size() (int64, error) {
+	var size int64
+	err := b.db.QueryRow(`
+		select pg_total_relation_size('storage') +
+			pg_total_relation_size('meta') +
+			pg_total_relation_size('audit')`).Scan(&size)
+
+	return size, err
+}
@@ -0,0 +1,78 @@
+package libdepot
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// The pragmas that can be set when a sqlite3 database is opened, each with
+// the short name that may stand in for it in a URI, if any
+var sqlitePragmas = map[string]string{
+	"auto_vacuum":              "vacuum",
+	"busy_timeout":             "timeout",
+	"cache_size":               "",
+	"case_sensitive_like":      "cslike",
+	"defer_foreign_keys":       "defer_fk",
+	"foreign_keys":             "fk",
+	"ignore_check_constraints": "",
+	"journal_mode":             "journal",
+	"locking_mode":             "locking",
+	"query_only":               "",
+	"recursive_triggers":       "rt",
+	"secure_delete":            "",
+	"synchronous":              "sync",
+	"writable_schema":          "",
+}
+
+// Returns the pragmas a sqlite3 database is opened with unless told
+// otherwise. In WAL mode readers carry on while another process writes, and
+// the busy timeout makes a writer wait its turn for a while rather than fail
+// with "database is locked". With WAL, synchronous=NORMAL is still safe from
+// corruption and only risks the last few changes on power loss.
+func defaultSQLitePragmas() map[string]string {
+	return map[string]string{
+		"journal_mode": "WAL",
+		"busy_timeout": "5000",
+		"foreign_keys": "on",
+		"synchronous":  "NORMAL",
+	}
+}
+
+// Returns an Option that opens a sqlite3 database with the given pragma set
+// to value in place of the default (see defaultSQLitePragmas). Pragmas given
+// in the query of a file: URI take precedence over both.
+func WithSQLitePragma(name, value string) Option {
+	return func(db *Depot) {
+		if db.pragmas == nil {
+			db.pragmas = map[string]string{}
+		}
+		db.pragmas[name] = value
+	}
+}
+
+// Returns uri with the given pragmas added to its query, in the form the
+// sqlite3 driver understands, unless the query already sets them. Returns an
+// error if a pragma cannot be set this way.
+func sqliteDSN(uri string, pragmas map[string]string) (string, error) {
+	path, query, _ := strings.Cut(uri, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid database uri: %w", err)
+	}
+
+	for name, val := range pragmas {
+		alias, ok := sqlitePragmas[name]
+		if !ok {
+			return "", fmt.Errorf("unsupported sqlite3 pragma: %v", name)
+		}
+		if !params.Has("_"+name) && (alias == "" || !params.Has("_"+alias)) {
+			params.Set("_"+name, val)
+		}
+	}
+
+	if len(params) == 0 {
+		return path, nil
+	}
+	return path + "?" + params.Encode(), nil
+}
@@ -0,0 +1,235 @@
+package libdepot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the audit log by a server rather than done with a key,
+// which they name none of
+const (
+	// A request bearing a token that is not the server's or a user's
+	AuditAuth = "auth"
+
+	// A request refused by the rate limit (see WithRateLimit), which is
+	// recorded at most once a minute for each client
+	AuditThrottle = "throttle"
+)
+
+// A request was refused because its client has made too many too quickly,
+// or has just failed (see WithRateLimit)
+var ErrRateLimited = errors.New("too many requests")
+
+// How long a client is refused after failed attempts in a row at most,
+// unless RateLimit says otherwise
+const defaultMaxBackoff = 15 * time.Minute
+
+// How often clients that are neither held back nor backing off are
+// forgotten, and how often the refusal of a client's requests is recorded
+// in the audit log at most
+const sweepInterval = time.Minute
+
+// Limits how often each client may make requests of the servers of a depot
+// (see WithRateLimit). A client is both the address a request comes from and
+// the token it bears, and each is held to the limit on its own, so that
+// neither spreading requests across tokens nor across addresses gets around
+// it.
+type RateLimit struct {
+	// Requests a client may make per second on average, or 0 for no limit
+	Rate float64
+
+	// Requests a client may make at once before Rate holds it back, or the
+	// whole number at or above Rate if it is not positive
+	Burst int
+
+	// How long a client is refused after a request bearing an unknown token
+	// or a bad password, doubling with each further one in a row, or 0 to
+	// never refuse a client for failing
+	Backoff time.Duration
+
+	// How long a client is refused after failing at most, which is also how
+	// long it must go without failing for its failures to be forgotten, or
+	// 15 minutes if it is not positive
+	MaxBackoff time.Duration
+}
+
+// Returns an Option that holds the clients of the depot's servers (see
+// NewServer and NewGRPCServer) to limit, refusing requests from a client
+// that makes them too quickly, or that has just failed to authenticate or
+// given a bad password, until it may make another. Refusals and failures to
+// authenticate are recorded in the audit log, as by the client's address.
+func WithRateLimit(limit RateLimit) Option {
+	return func(db *Depot) {
+		if limit.Burst <= 0 {
+			limit.Burst = max(int(math.Ceil(limit.Rate)), 1)
+		}
+		if limit.MaxBackoff <= 0 {
+			limit.MaxBackoff = defaultMaxBackoff
+		}
+		db.limiter = &limiter{limit: limit, clients: map[string]*client{}}
+	}
+}
+
+// Holds clients to a RateLimit
+type limiter struct {
+	limit   RateLimit
+	mu      sync.Mutex
+	clients map[string]*client
+	swept   time.Time
+}
+
+// What is known of a client's recent requests
+type client struct {
+	// Requests it may still make at once, as of last
+	allowance float64
+	last      time.Time
+
+	// Failures in a row, the last of which was at failed, and when it may
+	// make requests again after them
+	failures int
+	failed   time.Time
+	until    time.Time
+
+	// When the refusal of one of its requests was last recorded
+	reported time.Time
+}
+
+// Returns the names that the limiter knows the client at addr that bears
+// token by. Tokens are known only by their hashes.
+func clientNames(addr, token string) []string {
+	names := []string{"addr " + addr}
+	if token != "" {
+		hash := sha256.Sum256([]byte(token))
+		names = append(names, "token "+hex.EncodeToString(hash[:8]))
+	}
+
+	return names
+}
+
+// Returns how long the client known by names must wait before it may make
+// a request, or 0 if it may make one now, which is then counted against it,
+// and whether a refusal is due to be recorded
+func (l *limiter) wait(now time.Time, names []string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	var wait time.Duration
+	for _, name := range names {
+		c := l.client(now, name)
+		if now.Before(c.until) {
+			wait = max(wait, c.until.Sub(now))
+		}
+		if l.limit.Rate > 0 {
+			c.allowance = min(c.allowance+now.Sub(c.last).Seconds()*l.limit.Rate, float64(l.limit.Burst))
+			c.last = now
+			if c.allowance < 1 {
+				wait = max(wait, time.Duration((1-c.allowance)/l.limit.Rate*float64(time.Second)))
+			}
+		}
+	}
+
+	report := false
+	for _, name := range names {
+		c := l.clients[name]
+		if wait == 0 {
+			c.allowance--
+		} else if now.Sub(c.reported) >= sweepInterval {
+			c.reported = now
+			report = true
+		}
+	}
+
+	return wait, report
+}
+
+// Counts a failed attempt against the client known by names, refusing it
+// for the backoff it has earned
+func (l *limiter) fail(now time.Time, names []string) {
+	if l.limit.Backoff <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, name := range names {
+		c := l.client(now, name)
+		if now.Sub(c.failed) > l.limit.MaxBackoff {
+			c.failures = 0
+		}
+		c.failures++
+		c.failed = now
+		// Doubling is stopped short of overflowing
+		backoff := l.limit.MaxBackoff
+		if c.failures <= 32 {
+			backoff = min(l.limit.Backoff<<(c.failures-1), l.limit.MaxBackoff)
+		}
+		c.until = now.Add(backoff)
+	}
+}
+
+// Returns the client called name, which is new with a full allowance if it
+// is not known
+func (l *limiter) client(now time.Time, name string) *client {
+	c, ok := l.clients[name]
+	if !ok {
+		c = &client{allowance: float64(l.limit.Burst), last: now}
+		l.clients[name] = c
+	}
+
+	return c
+}
+
+// Forgets the clients whose allowance is full and that have no failures
+// left to remember, at most once every sweepInterval
+func (l *limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepInterval {
+		return
+	}
+	l.swept = now
+
+	for name, c := range l.clients {
+		full := l.limit.Rate <= 0 ||
+			c.allowance+now.Sub(c.last).Seconds()*l.limit.Rate >= float64(l.limit.Burst)
+		if full && now.Sub(c.failed) > l.limit.MaxBackoff && !now.Before(c.until) {
+			delete(l.clients, name)
+		}
+	}
+}
+
+// Returns how long the client at addr bearing token must wait before the
+// depot's servers take another request from it, or 0 if they take this one,
+// recording a refusal in the audit log if none has been of late
+func (db *Depot) throttle(addr, token string) time.Duration {
+	if db.limiter == nil {
+		return 0
+	}
+	wait, report := db.limiter.wait(db.now(), clientNames(addr, token))
+	if report {
+		db.as(addr).audit(AuditThrottle, "", ErrRateLimited)
+	}
+
+	return wait
+}
+
+// Counts a request from the client at addr bearing token that failed with
+// err against the client, if it failed to authenticate, which is recorded in
+// the audit log, or gave a bad password. Only the address is held to a
+// failure to authenticate, since the token is no one's.
+func (db *Depot) failedRequest(addr, token string, err error) {
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		db.as(addr).audit(AuditAuth, "", err)
+		token = ""
+	case errors.Is(err, ErrBadPassword):
+	default:
+		return
+	}
+	if db.limiter != nil {
+		db.limiter.fail(db.now(), clientNames(addr, token))
+	}
+}
@@ -0,0 +1,60 @@
+package libdepot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var db Depot
+	WithRateLimit(RateLimit{Rate: 1, Burst: 2, Backoff: time.Second, MaxBackoff: 4 * time.Second})(&db)
+	l := db.limiter
+	alice, bob := clientNames("192.0.2.1", "alice"), clientNames("192.0.2.2", "bob")
+
+	for i := 0; i < 2; i++ {
+		if wait, _ := l.wait(now, alice); wait != 0 {
+			t.Errorf("expected request %v within the burst to be let through but got %v", i+1, wait)
+		}
+	}
+	wait, report := l.wait(now, alice)
+	if wait != time.Second || !report {
+		t.Errorf("expected a reported wait of 1s beyond the burst but got %v (%v)", wait, report)
+	}
+	if _, report = l.wait(now, alice); report {
+		t.Errorf("expected a refusal to be reported only once a minute")
+	}
+	if wait, _ = l.wait(now, bob); wait != 0 {
+		t.Errorf("expected another client to be let through but got %v", wait)
+	}
+	// The same token from another address is held back all the same
+	if wait, _ = l.wait(now, clientNames("192.0.2.3", "alice")); wait == 0 {
+		t.Errorf("expected the token to be held back from another address")
+	}
+	now = now.Add(time.Second)
+	if wait, _ = l.wait(now, alice); wait != 0 {
+		t.Errorf("expected a request to be let through a second later but got %v", wait)
+	}
+
+	// Each failure in a row doubles the backoff, up to its limit
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		l.fail(now, bob)
+		if wait, _ = l.wait(now, bob); wait != want {
+			t.Errorf("expected a backoff of %v but got %v", want, wait)
+		}
+		now = now.Add(want)
+	}
+	// and failures are forgotten once there have been none for as long
+	now = now.Add(5 * time.Second)
+	l.fail(now, bob)
+	if wait, _ = l.wait(now, bob); wait != time.Second {
+		t.Errorf("expected the backoff to start over but got %v", wait)
+	}
+
+	// Clients with nothing to remember are forgotten
+	now = now.Add(time.Hour)
+	l.wait(now, alice)
+	if _, ok := l.clients[bob[0]]; ok {
+		t.Errorf("expected an idle client to be forgotten")
+	}
+}
@@ -0,0 +1,90 @@
+package libdepot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The fields of a record that most credentials have, though a record may
+// have any fields
+const (
+	FieldUsername = "username"
+	FieldPassword = "password"
+	FieldURL      = "url"
+	FieldNotes    = "notes"
+)
+
+// A value made up of named fields, such as a username, a password, a URL,
+// and notes, that is stowed as a JSON object of strings, encrypted as a whole
+// if it is a secret
+type Record map[string]string
+
+var (
+	ErrNotRecord = errors.New("value is not a record")
+	ErrNoField   = errors.New("record has no such field")
+)
+
+// Parses a value stowed as a record. Returns ErrNotRecord if it is not a
+// JSON object of strings.
+func ParseRecord(val string) (Record, error) {
+	var r Record
+	if err := json.Unmarshal([]byte(val), &r); err != nil || r == nil {
+		return nil, ErrNotRecord
+	}
+
+	return r, nil
+}
+
+// Stores the record under key as Stow would store a value. Returns an error
+// if unsuccessful.
+func (db *Depot) StowRecord(key string, r Record, password []byte) error {
+	return StowJSON(db, key, r, password)
+}
+
+// Returns the record stored under key, decrypted with password if it is
+// encrypted, or ErrNotRecord if the value of key is not a record, or another
+// error if unsuccessful
+func (db *Depot) FetchRecord(key string, password []byte) (Record, error) {
+	val, err := db.Fetch(key, password)
+	if err != nil {
+		return nil, err
+	}
+	r, err := ParseRecord(val)
+
+	return r, db.opError(AuditFetch, key, err)
+}
+
+// Returns the named field of the record stored under key, or ErrNoField if
+// it has none, or another error as FetchRecord does
+func (db *Depot) FetchField(key, field string, password []byte) (string, error) {
+	r, err := db.FetchRecord(key, password)
+	if err != nil {
+		return "", err
+	}
+	val, ok := r[field]
+	if !ok {
+		return "", db.opError(AuditFetch, key, fmt.Errorf("%w: %v", ErrNoField, field))
+	}
+
+	return val, nil
+}
+
+// Sets the named field of the record stored under key to val, leaving its
+// other fields alone, or stows a new record with only that field if key does
+// not exist. The record is encrypted with password if it is not nil, which
+// must be its password if it was encrypted before. Returns ErrNotRecord if
+// key holds a value that is not a record, or another error if unsuccessful.
+func (db *Depot) StowField(key, field, val string, password []byte) error {
+	return db.locked(func() error {
+		r, err := db.FetchRecord(key, password)
+		if errors.Is(err, ErrNotFound) {
+			r = Record{}
+		} else if err != nil {
+			return err
+		}
+		r[field] = val
+
+		return db.StowRecord(key, r, password)
+	})
+}
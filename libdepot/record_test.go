@@ -0,0 +1,49 @@
+package libdepot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRecord(t *testing.T) {
+	mdb, _ := NewMemDepot()
+	password := []byte("correct horse battery staple")
+
+	r := Record{FieldUsername: "octocat", FieldPassword: "hunter2", FieldURL: "https://github.com"}
+	if err := mdb.StowRecord("web/github", r, password); err != nil {
+		t.Fatalf("error stowing record: %v", err)
+	}
+	if val, err := mdb.FetchField("web/github", FieldUsername, password); err != nil || val != "octocat" {
+		t.Errorf("expected octocat but got %q (%v)", val, err)
+	}
+	if _, err := mdb.FetchField("web/github", FieldUsername, nil); !errors.Is(err, ErrPasswordNeeded) {
+		t.Errorf("expected %v fetching a field of an encrypted record but got %v", ErrPasswordNeeded, err)
+	}
+	if _, err := mdb.FetchField("web/github", "otp", password); !errors.Is(err, ErrNoField) {
+		t.Errorf("expected %v fetching a missing field but got %v", ErrNoField, err)
+	}
+
+	// Setting one field leaves the others alone
+	if err := mdb.StowField("web/github", FieldNotes, "work account", password); err != nil {
+		t.Fatalf("error stowing field: %v", err)
+	}
+	got, err := mdb.FetchRecord("web/github", password)
+	if err != nil || len(got) != 4 || got[FieldPassword] != "hunter2" || got[FieldNotes] != "work account" {
+		t.Errorf("expected the record with notes added but got %v (%v)", got, err)
+	}
+
+	if err = mdb.StowField("web/new", FieldUsername, "me", nil); err != nil {
+		t.Fatalf("error stowing field of a new record: %v", err)
+	}
+	if val, err := mdb.Fetch("web/new", nil); err != nil || val != `{"username":"me"}` {
+		t.Errorf("expected a new record holding the field but got %q (%v)", val, err)
+	}
+
+	mdb.Stow("plain", "not a record", nil)
+	if _, err = mdb.FetchField("plain", FieldUsername, nil); !errors.Is(err, ErrNotRecord) {
+		t.Errorf("expected %v fetching a field of a plain value but got %v", ErrNotRecord, err)
+	}
+	if err = mdb.StowField("plain", FieldUsername, "me", nil); !errors.Is(err, ErrNotRecord) {
+		t.Errorf("expected %v setting a field of a plain value but got %v", ErrNotRecord, err)
+	}
+}
@@ -0,0 +1,160 @@
+package libdepot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// A Backend that keeps entries in Redis, for sharing secrets across a fleet
+// quickly. Each entry is a JSON string under "depot:entry:<key>", a sorted
+// set under "depot:keys" indexes the keys for listing, and metadata lives in
+// the hash "depot:meta". Whether anything survives a restart is up to the
+// Redis server's persistence settings.
+type redisBackend struct {
+	client *redis.Client
+}
+
+const (
+	redisEntryPrefix = "depot:entry:"
+	redisKeys        = "depot:keys"
+	redisMeta        = "depot:meta"
+)
+
+// Returns a Backend stored in the Redis server at uri (a redis:// or
+// rediss:// URL) or an error if it cannot be reached
+func NewRedisBackend(uri string) (Backend, error) {
+	opts, err := redis.ParseURL(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis address: %w", err)
+	}
+
+	client := redis.NewClient(opts)
+	if err = client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("cannot connect to redis: %w", err)
+	}
+
+	// Several clients may be initializing the same depot at once, so the salt
+	// is created here where only the first one can win
+	salt := make([]byte, 32)
+	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+		client.Close()
+		return nil, err
+	}
+	if err = client.HSetNX(context.Background(), redisMeta, "salt", salt).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("cannot access redis: %w", err)
+	}
+
+	return &redisBackend{client}, nil
+}
+
+func (b *redisBackend) Get(key string) (*Entry, error) {
+	data, err := b.client.Get(context.Background(), redisEntryPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var e Entry
+	if err = json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (b *redisBackend) Put(e *Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	_, err = b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, redisEntryPrefix+e.Key, data, 0)
+		pipe.ZAdd(ctx, redisKeys, redis.Z{Member: e.Key})
+		return nil
+	})
+
+	return err
+}
+
+func (b *redisBackend) Delete(key string) error {
+	ctx := context.Background()
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, redisEntryPrefix+key)
+		pipe.ZRem(ctx, redisKeys, key)
+		return nil
+	})
+
+	return err
+}
+
+func (b *redisBackend) List(prefix string) ([]*Entry, error) {
+	ctx := context.Background()
+
+	// Every member of the index shares a score, so they sort lexically and a
+	// prefix is a range
+	max := "+"
+	if prefix != "" {
+		max = "(" + prefix + "\xff"
+	}
+	keys, err := b.client.ZRangeByLex(ctx, redisKeys, &redis.ZRangeBy{
+		Min: "[" + prefix,
+		Max: max,
+	}).Result()
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = redisEntryPrefix + key
+	}
+	vals, err := b.client.MGet(ctx, names...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for _, val := range vals {
+		// Deleted since the index was read
+		s, ok := val.(string)
+		if !ok {
+			continue
+		}
+
+		var e Entry
+		if err = json.Unmarshal([]byte(s), &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+
+	return entries, nil
+}
+
+func (b *redisBackend) Meta(name string) ([]byte, error) {
+	data, err := b.client.HGet(context.Background(), redisMeta, name).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+func (b *redisBackend) SetMeta(name string, data []byte) error {
+	return b.client.HSet(context.Background(), redisMeta, name, data).Err()
+}
+
+func (b *redisBackend) Close() error {
+	return b.client.Close()
+}
@@ -0,0 +1,117 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Encrypts every secret in the depot, including those in the trash, again
+// under the parameters a value stowed now would get: a key derived with the
+// depot's own salt, or its namespace's (see CreateNamespace), rather than
+// one brought in from another depot, stretched again with Argon2id and
+// expanded for a salt of the value's own (see ValueKey), a fresh nonce,
+// that salt and the value's compression bound to it as it is sealed, a key
+// check, and compression if the value is large. Each secret is read,
+// rewritten, and fetched back and compared holding the depot's lock, so that
+// a value stowed meanwhile is not overwritten with the one it replaced, and
+// keeps when it was modified. Secrets that don't decrypt with password, or
+// are in a namespace whose password it is not, are left as they are, and
+// their keys returned. progress, if not nil, is called after each secret
+// with the number done so far and the total. Returns the number of secrets
+// encrypted again, or an error if unsuccessful, in which case those already
+// done stay done and the rest are untouched.
+func (db *Depot) Reencrypt(password []byte, progress func(done, total int)) (int, []string, error) {
+	if password == nil {
+		return 0, nil, ErrPasswordNeeded
+	}
+
+	entries, err := db.backend.List("")
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	var secrets []string
+	for _, e := range entries {
+		if e.Nonce != nil {
+			secrets = append(secrets, e.Key)
+		}
+	}
+
+	deriver := db.keyDeriver(password)
+	n := 0
+	var skipped []string
+	for i, key := range secrets {
+		var done bool
+		err := db.locked(func() (err error) {
+			done, err = db.reencrypt(key, deriver, password)
+			return err
+		})
+		if errors.Is(err, ErrBadPassword) {
+			skipped = append(skipped, key)
+		} else if err != nil {
+			return n, skipped, fmt.Errorf("%v: %w", key, err)
+		} else if done {
+			n++
+		}
+
+		if progress != nil {
+			progress(i+1, len(secrets))
+		}
+	}
+
+	return n, skipped, nil
+}
+
+// Encrypts the secret under key again with a key deriver gives, as it is
+// now rather than as it was listed. Returns whether it was, which it is not
+// if it has since been dropped for good or stowed unencrypted, or an error
+// if unsuccessful.
+func (db *Depot) reencrypt(key string, deriver *keyDeriver, password []byte) (bool, error) {
+	e, err := db.backend.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrDatabase, err)
+	} else if e.Nonce == nil {
+		return false, nil
+	}
+
+	val, err := db.fetchEntry(e, password)
+	if err != nil {
+		return false, err
+	}
+	encryptionKey, salt, err := deriver.derive(key)
+	if err != nil {
+		return false, err
+	}
+
+	return true, db.audit(AuditStow, key, db.reencryptEntry(e, val, encryptionKey, salt, password))
+}
+
+// Replaces the entry with one holding val encrypted with encryptionKey,
+// derived with salt, then
+// checks that it decrypts to val with password. Returns an error if
+// unsuccessful.
+func (db *Depot) reencryptEntry(e *Entry, val string, encryptionKey, salt, password []byte) error {
+	entry, err := db.newEntry(e.Key, val, encryptionKey, salt)
+	if err != nil {
+		return err
+	}
+	entry.Modified, entry.Deleted = e.Modified, e.Deleted
+	if err = db.backend.Put(entry); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	stored, err := db.backend.Get(e.Key)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	if check, err := db.fetchEntry(stored, password); err != nil || check != val {
+		// Put the original back rather than leave a value that can't be read
+		if err = db.backend.Put(e); err != nil {
+			return fmt.Errorf("value did not survive encryption and could not be restored: %w", err)
+		}
+		return fmt.Errorf("value did not survive encryption, so it was left as it was")
+	}
+
+	return nil
+}
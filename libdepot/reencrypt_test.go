@@ -0,0 +1,129 @@
+package libdepot
+
+import (
+	"bytes"
+	"crypto/rand"
+	"reflect"
+	"testing"
+)
+
+func TestReencrypt(t *testing.T) {
+	password := []byte("password")
+	src, _ := NewMemDepot()
+	mdb, _ := NewMemDepot()
+	src.Stow("imported", "imported", password)
+	imported, _ := src.backend.Get("imported")
+	imported.Salt = src.salt
+	mdb.backend.Put(imported)
+	mdb.Stow("secret", "secret", password)
+	mdb.Stow("trashed", "trashed", password)
+	mdb.Drop("trashed")
+	mdb.Stow("other", "other", []byte("other password"))
+	mdb.Stow("plain", "plain", nil)
+	before, _ := mdb.backend.Get("secret")
+
+	var calls []int
+	n, skipped, err := mdb.Reencrypt(password, func(done, total int) {
+		if total != 4 {
+			t.Errorf("expected 4 secrets in all but got %v", total)
+		}
+		calls = append(calls, done)
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 secrets to be encrypted again but got %v (%v)", n, err)
+	}
+	if !reflect.DeepEqual(skipped, []string{"other"}) {
+		t.Errorf("expected other to be skipped but got %v", skipped)
+	}
+	if !reflect.DeepEqual(calls, []int{1, 2, 3, 4}) {
+		t.Errorf("expected progress after every secret but got %v", calls)
+	}
+
+	e, _ := mdb.backend.Get("imported")
+	if e.Salt != nil {
+		t.Errorf("expected imported to move to the depot's salt")
+	}
+	if val, err := mdb.Fetch("imported", password); err != nil || val != "imported" {
+		t.Errorf("expected imported to decrypt but got %q (%v)", val, err)
+	}
+	after, _ := mdb.backend.Get("secret")
+	if string(after.Nonce) == string(before.Nonce) || !after.Modified.Equal(before.Modified) {
+		t.Errorf("expected secret to get a fresh nonce and keep when it was modified")
+	}
+	if err = mdb.Undrop("trashed"); err != nil {
+		t.Errorf("expected trashed to stay in the trash: %v", err)
+	}
+	if val, err := mdb.Fetch("trashed", password); err != nil || val != "trashed" {
+		t.Errorf("expected trashed to decrypt but got %q (%v)", val, err)
+	}
+	if val, err := mdb.Fetch("other", []byte("other password")); err != nil || val != "other" {
+		t.Errorf("expected other to be left alone but got %q (%v)", val, err)
+	}
+}
+
+func TestReencryptLegacy(t *testing.T) {
+	password := []byte("password")
+	mdb, _ := NewMemDepot()
+
+	// Sealed as values were before they had salts of their own
+	encryptionKey := mdb.deriveKey(password, nil)
+	sealed, nonce, err := encrypt(rand.Reader, encryptionKey, []byte("legacy"), nil)
+	if err != nil {
+		t.Fatalf("error encrypting: %v", err)
+	}
+	mdb.backend.Put(&Entry{Key: "legacy", Val: b64.EncodeToString(sealed), Nonce: nonce,
+		Check: keyCheck(encryptionKey, nonce), Modified: mdb.now()})
+	if val, err := mdb.Fetch("legacy", password); err != nil || val != "legacy" {
+		t.Fatalf("expected legacy to decrypt but got %q (%v)", val, err)
+	}
+
+	if n, _, err := mdb.Reencrypt(password, nil); err != nil || n != 1 {
+		t.Fatalf("expected 1 secret to be encrypted again but got %v (%v)", n, err)
+	}
+	e, _ := mdb.backend.Get("legacy")
+	if len(e.KeySalt) != 16 {
+		t.Fatalf("expected legacy to get a salt of its own but got %x", e.KeySalt)
+	}
+	if val, err := mdb.Fetch("legacy", password); err != nil || val != "legacy" {
+		t.Errorf("expected legacy to decrypt but got %q (%v)", val, err)
+	}
+
+	// Its salt and compression are bound to it
+	tampered := *e
+	tampered.KeySalt = bytes.Clone(e.KeySalt)
+	tampered.KeySalt[0] ^= 1
+	mdb.backend.Put(&tampered)
+	if _, err := mdb.Fetch("legacy", password); err == nil {
+		t.Errorf("expected an error with its salt changed")
+	}
+	tampered = *e
+	tampered.Compression = CompressionZstd
+	mdb.backend.Put(&tampered)
+	if _, err := mdb.Fetch("legacy", password); err == nil {
+		t.Errorf("expected an error with its compression changed")
+	}
+}
+
+func TestReencryptStowed(t *testing.T) {
+	password := []byte("password")
+	mdb, _ := NewMemDepot()
+	mdb.Stow("a", "old", password)
+	mdb.Stow("b", "old", password)
+
+	// Whichever is done second is stowed after it was listed, and must not be
+	// put back as it was
+	_, _, err := mdb.Reencrypt(password, func(done, total int) {
+		if done == 1 {
+			mdb.Stow("a", "new", password)
+			mdb.Stow("b", "new", password)
+		}
+	})
+	if err != nil {
+		t.Fatalf("error encrypting again: %v", err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if val, err := mdb.Fetch(key, password); err != nil || val != "new" {
+			t.Errorf("expected %v to keep the value stowed meanwhile but got %q (%v)", key, val, err)
+		}
+	}
+}
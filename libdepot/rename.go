@@ -0,0 +1,136 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Stores a copy of the value of src under dst. An encrypted value is
+// decrypted with password and encrypted again with it, since no two values
+// may share a nonce, so a non-nil password must be supplied for one, though
+// it is not reported again if it is weak (see WithWeakPasswordFunc). An
+// existing dst is only replaced if overwrite is true, and otherwise ErrExists
+// is returned. Returns an error if unsuccessful.
+func (db *Depot) Copy(src, dst string, password []byte, overwrite bool) error {
+	return db.audit(AuditStow, dst, db.locked(func() error {
+		return db.copy(src, dst, password, overwrite)
+	}))
+}
+
+func (db *Depot) copy(src, dst string, password []byte, overwrite bool) error {
+	src, dst, err := db.checkMove(src, dst)
+	if err != nil {
+		return err
+	}
+	entry, err := db.source(src, dst, overwrite)
+	if err != nil {
+		return err
+	}
+
+	if entry.Nonce == nil {
+		c := *entry
+		c.Key = dst
+		c.Modified = db.now()
+		if err = db.checkStowEntry(&c); err != nil {
+			return err
+		}
+		if err = db.backend.Put(&c); err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+		return nil
+	} else if password == nil {
+		return ErrPasswordNeeded
+	}
+
+	val, err := db.fetch(src, password)
+	if err != nil {
+		return err
+	}
+
+	return db.restow(dst, val, password)
+}
+
+// Moves the value of oldKey to newKey as it is, so no password is needed even
+// if it is encrypted, and drops oldKey. An existing newKey is only replaced
+// if overwrite is true, and otherwise ErrExists is returned. Returns an error
+// if unsuccessful.
+func (db *Depot) Rename(oldKey, newKey string, overwrite bool) error {
+	err := db.locked(func() error { return db.rename(oldKey, newKey, overwrite) })
+	if err = db.audit(AuditStow, newKey, err); err != nil {
+		return err
+	}
+
+	return db.audit(AuditDrop, oldKey, nil)
+}
+
+func (db *Depot) rename(oldKey, newKey string, overwrite bool) error {
+	oldKey, newKey, err := db.checkMove(oldKey, newKey)
+	if err != nil {
+		return err
+	}
+	entry, err := db.source(oldKey, newKey, overwrite)
+	if err != nil {
+		return err
+	}
+
+	moved := *entry
+	moved.Key = newKey
+	if err = db.checkStowEntry(&moved); err != nil {
+		return err
+	}
+
+	// Drop the old key first, since an encrypted value's nonce may only be
+	// stored once
+	now := db.now()
+	tombstone := Entry{Key: oldKey, Modified: now, Deleted: true}
+	if err = db.backend.Put(&tombstone); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	moved.Modified = now
+	if err = db.backend.Put(&moved); err != nil {
+		// Put the old key back rather than lose its value
+		db.backend.Put(entry)
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return nil
+}
+
+// Returns src and dst normalized, or ErrInvalidKey if dst breaks the key
+// policy (see WithKeyPolicy)
+func (db *Depot) checkMove(src, dst string) (string, string, error) {
+	dst, err := db.checkKey(dst)
+	if err != nil {
+		return "", "", err
+	}
+
+	return db.normalizeKey(src), dst, nil
+}
+
+// Returns the entry of src, which is to be copied or moved to dst, or
+// ErrExists if dst exists and overwrite is false, or another error if
+// unsuccessful
+func (db *Depot) source(src, dst string, overwrite bool) (*Entry, error) {
+	if src == dst {
+		return nil, fmt.Errorf("%v is both source and destination", src)
+	}
+
+	entry, err := db.backend.Get(src)
+	if errors.Is(err, ErrNotFound) || (err == nil && entry.Deleted) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	if !overwrite {
+		existing, err := db.backend.Get(dst)
+		if err == nil && !existing.Deleted {
+			return nil, ErrExists
+		} else if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,80 @@
+package libdepot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCopyRename(t *testing.T) {
+	// The sqlite3 depot, which won't store a nonce twice
+	password := []byte("password")
+	for _, key := range []string{"rename/plain", "rename/copy", "rename/moved"} {
+		db.Drop(key)
+	}
+	db.Stow("rename/plain", "plain", nil)
+	db.Stow("rename/secret", "secret", password)
+	db.Stow("rename/taken", "taken", nil)
+
+	if err := db.Copy("rename/secret", "rename/copy", nil, false); !errors.Is(err, ErrPasswordNeeded) {
+		t.Errorf("expected %v copying a secret without a password but got %v", ErrPasswordNeeded, err)
+	}
+	if err := db.Copy("rename/secret", "rename/copy", password, false); err != nil {
+		t.Fatalf("error copying: %v", err)
+	}
+	if val, err := db.Fetch("rename/copy", password); err != nil || val != "secret" {
+		t.Errorf("expected copy to decrypt to secret but got %q (%v)", val, err)
+	}
+	if val, err := db.Fetch("rename/secret", password); err != nil || val != "secret" {
+		t.Errorf("expected original to be left alone but got %q (%v)", val, err)
+	}
+
+	if err := db.Rename("rename/copy", "rename/moved", false); err != nil {
+		t.Fatalf("error renaming a secret: %v", err)
+	}
+	if val, err := db.Fetch("rename/moved", password); err != nil || val != "secret" {
+		t.Errorf("expected renamed secret to decrypt to secret but got %q (%v)", val, err)
+	}
+
+	if err := db.Rename("rename/plain", "rename/taken", false); !errors.Is(err, ErrExists) {
+		t.Errorf("expected %v renaming onto an existing key but got %v", ErrExists, err)
+	}
+	if err := db.Rename("rename/plain", "rename/taken", true); err != nil {
+		t.Fatalf("error renaming: %v", err)
+	}
+	if val, err := db.Fetch("rename/taken", nil); err != nil || val != "plain" {
+		t.Errorf("expected renamed value plain but got %q (%v)", val, err)
+	}
+	if _, err := db.Fetch("rename/plain", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v fetching the old key but got %v", ErrNotFound, err)
+	}
+
+	// The old key is now a tombstone, which doesn't count as existing
+	if err := db.Rename("rename/taken", "rename/plain", false); err != nil {
+		t.Errorf("expected to rename onto a dropped key but got %v", err)
+	}
+	if err := db.Copy("rename/missing", "rename/other", nil, false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v copying a missing key but got %v", ErrNotFound, err)
+	}
+	if err := db.Rename("rename/plain", "rename/plain", true); err == nil {
+		t.Errorf("expected an error renaming a key to itself")
+	}
+}
+
+func TestCopyWeakPassword(t *testing.T) {
+	refuse := false
+	mdb, _ := NewMemDepot(WithWeakPasswordFunc(func(key string, entropy float64) error {
+		if refuse {
+			return ErrWeakPassword
+		}
+		return nil
+	}))
+	mdb.Stow("pin", "1234", []byte("1234"))
+
+	refuse = true
+	if err := mdb.Copy("pin", "pin2", []byte("1234"), false); err != nil {
+		t.Errorf("error copying with the weak password a value was stowed with: %v", err)
+	}
+	if val, _ := mdb.Fetch("pin2", []byte("1234")); val != "1234" {
+		t.Errorf("expected %q but got %q", "1234", val)
+	}
+}
@@ -0,0 +1,120 @@
+package libdepot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The depot metadata that rotation periods are kept in, as a JSON object
+// mapping each key to its period in nanoseconds
+const rotationsMeta = "rotations"
+
+// Returns every key that has a rotation period (see SetRotation) mapped to
+// it, or an error if unsuccessful
+func (db *Depot) Rotations() (map[string]time.Duration, error) {
+	rotations := map[string]time.Duration{}
+	data, err := db.backend.Meta(rotationsMeta)
+	if errors.Is(err, ErrNotFound) {
+		return rotations, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	if err = json.Unmarshal(data, &rotations); err != nil {
+		return nil, fmt.Errorf("cannot read rotation periods: %w", ErrCorrupted)
+	}
+
+	return rotations, nil
+}
+
+// Sets how often the value of key, or of the key it is an alias of, ought to
+// be replaced, after which Stale reports it, or forgets the period if it is
+// not positive. The period stays with the key's name, so it is kept if the
+// key is dropped and stowed again but not if it is renamed. Returns
+// ErrNotFound if there is no such key, or another error if unsuccessful.
+func (db *Depot) SetRotation(key string, period time.Duration) error {
+	return db.opError(OpRotation, key, db.locked(func() error {
+		entry, err := db.get(db.normalizeKey(key))
+		if err != nil {
+			return err
+		}
+		rotations, err := db.Rotations()
+		if err != nil {
+			return err
+		}
+
+		if period > 0 {
+			rotations[entry.Key] = period
+		} else {
+			delete(rotations, entry.Key)
+		}
+		data, err := json.Marshal(rotations)
+		if err != nil {
+			return err
+		}
+		if err = db.backend.SetMeta(rotationsMeta, data); err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+
+		return nil
+	}))
+}
+
+// Returns the keys and aliases matching pattern (see matchKey) whose values
+// were last modified longer ago than their rotation period (see SetRotation)
+// or, for those without one, than maxAge unless it is 0, oldest first, or an
+// error if unsuccessful
+func (db *Depot) Stale(pattern string, maxAge time.Duration) ([]KeyInfo, error) {
+	keys, err := db.List(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	now := db.now()
+	stale := []KeyInfo{}
+	for _, k := range keys {
+		if k.Modified.IsZero() {
+			// An alias of a key that no longer exists
+			continue
+		}
+		if due := k.RotationDue(); !due.IsZero() && !now.Before(due) {
+			stale = append(stale, k)
+		} else if due.IsZero() && maxAge > 0 && now.Sub(k.Modified) > maxAge {
+			stale = append(stale, k)
+		}
+	}
+	sort.SliceStable(stale, func(i, j int) bool { return stale[i].Modified.Before(stale[j].Modified) })
+
+	return stale, nil
+}
+
+// Returns when the value of the key ought to be replaced by, according to
+// its rotation period, or the zero time if it has none
+func (k KeyInfo) RotationDue() time.Time {
+	if k.Rotation <= 0 {
+		return time.Time{}
+	}
+
+	return k.Modified.Add(k.Rotation)
+}
+
+// Fills in the rotation period of each of the keys, or of the key each alias
+// stands for. Returns the keys or an error if unsuccessful.
+func (db *Depot) withRotations(keys []KeyInfo) ([]KeyInfo, error) {
+	rotations, err := db.Rotations()
+	if err != nil || len(rotations) == 0 {
+		return keys, err
+	}
+
+	for i, k := range keys {
+		if k.Alias != "" {
+			keys[i].Rotation = rotations[k.Alias]
+		} else {
+			keys[i].Rotation = rotations[k.Key]
+		}
+	}
+
+	return keys, nil
+}
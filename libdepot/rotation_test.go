@@ -0,0 +1,56 @@
+package libdepot
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRotation(t *testing.T) {
+	mdb, _ := NewMemDepot()
+	old := time.Now().Add(-100 * 24 * time.Hour)
+	for _, e := range []*Entry{
+		{Key: "old", Val: "value", Modified: old},
+		{Key: "rotated", Val: "value", Modified: time.Now().Add(-2 * time.Hour)},
+		{Key: "fresh", Val: "value", Modified: time.Now()},
+	} {
+		mdb.backend.Put(e)
+	}
+	mdb.Alias("other", "rotated", false)
+
+	if err := mdb.SetRotation("missing", time.Hour); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v setting the rotation period of a missing key but got %v", ErrNotFound, err)
+	}
+	// An alias sets the period of the key it stands for
+	if err := mdb.SetRotation("other", time.Hour); err != nil {
+		t.Fatalf("error setting rotation period: %v", err)
+	}
+	if info, err := mdb.Info("rotated"); err != nil || info.Rotation != time.Hour {
+		t.Errorf("expected a rotation period of %v but got %+v (%v)", time.Hour, info, err)
+	}
+
+	stale, err := mdb.Stale("", 90*24*time.Hour)
+	if err != nil {
+		t.Fatalf("error listing stale keys: %v", err)
+	}
+	want := []string{"old", "other", "rotated"}
+	if len(stale) != len(want) {
+		t.Fatalf("expected %v to be stale but got %v", want, stale)
+	}
+	for i, k := range stale {
+		if k.Key != want[i] {
+			t.Errorf("expected %v to be stale but got %v", want, stale)
+			break
+		}
+	}
+	if stale, _ = mdb.Stale("", 0); len(stale) != 2 {
+		t.Errorf("expected only keys with rotation periods to be stale with no maximum age but got %v", stale)
+	}
+
+	if err = mdb.SetRotation("rotated", 0); err != nil {
+		t.Fatalf("error clearing rotation period: %v", err)
+	}
+	if stale, _ = mdb.Stale("", 0); len(stale) != 0 {
+		t.Errorf("expected no stale keys once the rotation period was cleared but got %v", stale)
+	}
+}
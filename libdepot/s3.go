@@ -0,0 +1,311 @@
+package libdepot
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Backend that keeps each entry in an object of its own in an
+// S3-compatible bucket, under <prefix>entries/<key>, with metadata under
+// <prefix>meta/<name>. Recovering a depot then only takes the bucket
+// credentials and the password.
+type s3Backend struct {
+	client   *http.Client
+	endpoint *url.URL
+	bucket   string
+	prefix   string
+	region   string
+	creds    s3Credentials
+	now      func() time.Time
+}
+
+// Credentials for signing requests to S3
+type s3Credentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// Returns a Backend stored in the bucket named by uri, which looks like
+// s3://bucket/prefix?region=us-east-1&endpoint=https://minio.local:9000
+// (the region and endpoint are optional). Credentials are taken from the
+// usual AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN
+// environment variables.
+func NewS3Backend(uri string) (Backend, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid s3 address: %v", uri)
+	}
+
+	b := s3Backend{
+		client: &http.Client{Timeout: 30 * time.Second},
+		bucket: u.Host,
+		prefix: strings.TrimPrefix(u.Path, "/"),
+		region: u.Query().Get("region"),
+		creds: s3Credentials{
+			accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		},
+		now: time.Now,
+	}
+	if b.prefix != "" && !strings.HasSuffix(b.prefix, "/") {
+		b.prefix += "/"
+	}
+	if b.region == "" {
+		b.region = os.Getenv("AWS_REGION")
+	}
+	if b.region == "" {
+		b.region = "us-east-1"
+	}
+
+	endpoint := u.Query().Get("endpoint")
+	if endpoint == "" {
+		endpoint = "https://s3." + b.region + ".amazonaws.com"
+	}
+	if b.endpoint, err = url.Parse(endpoint); err != nil || b.endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint: %v", endpoint)
+	}
+	if b.creds.accessKey == "" || b.creds.secretKey == "" {
+		return nil, errors.New("s3 credentials are missing from the environment")
+	}
+
+	return &b, nil
+}
+
+// Encodes s the way SigV4 expects, leaving slashes alone if path is true
+func s3Escape(s string, path bool) string {
+	var buf strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', path && c == '/':
+			buf.WriteByte(c)
+		default:
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+
+	return buf.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Adds an AWS Signature Version 4 Authorization header to the request
+func (b *s3Backend) sign(req *http.Request, body []byte) {
+	now := b.now().UTC()
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if b.creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.creds.sessionToken)
+	}
+
+	var names []string
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	var params []string
+	for name, vals := range query {
+		for _, val := range vals {
+			params = append(params, s3Escape(name, false)+"="+s3Escape(val, false))
+		}
+	}
+	sort.Strings(params)
+
+	canonical := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, true),
+		strings.Join(params, "&"),
+		headers.String(),
+		signed,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+
+	scope := date + "/" + b.region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" +
+		scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+b.creds.secretKey), date)
+	key = hmacSHA256(key, b.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+b.creds.accessKey+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+signature)
+}
+
+// Returns the URL of the named object, or of the bucket itself if name is
+// empty. AWS is addressed with virtual-hosted buckets and anything else with
+// path-style buckets, which is what S3-compatible servers expect.
+func (b *s3Backend) objectURL(name string, query url.Values) *url.URL {
+	u := *b.endpoint
+	if strings.HasSuffix(u.Host, ".amazonaws.com") {
+		u.Host = b.bucket + "." + u.Host
+		u.Path = "/" + name
+	} else {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + b.bucket + "/" + name
+	}
+	// Go's own escaping of paths differs from the one that gets signed
+	u.RawPath = s3Escape(u.Path, true)
+	u.RawQuery = query.Encode()
+
+	return &u
+}
+
+// Sends a signed request and returns the body of a successful response. A
+// 404 is reported as ErrNotFound.
+func (b *s3Backend) do(method string, u *url.URL, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	b.sign(req, body)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	} else if resp.StatusCode >= 300 {
+		var s3err struct {
+			Code    string
+			Message string
+		}
+		if xml.Unmarshal(data, &s3err) == nil && s3err.Code != "" {
+			return nil, fmt.Errorf("s3: %v: %v", s3err.Code, s3err.Message)
+		}
+		return nil, errors.New("s3: " + resp.Status)
+	}
+
+	return data, nil
+}
+
+func (b *s3Backend) Get(key string) (*Entry, error) {
+	data, err := b.do(http.MethodGet, b.objectURL(b.prefix+"entries/"+key, nil), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var e Entry
+	if err = json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (b *s3Backend) Put(e *Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.do(http.MethodPut, b.objectURL(b.prefix+"entries/"+e.Key, nil), data)
+	return err
+}
+
+func (b *s3Backend) Delete(key string) error {
+	_, err := b.do(http.MethodDelete, b.objectURL(b.prefix+"entries/"+key, nil), nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+func (b *s3Backend) List(prefix string) ([]*Entry, error) {
+	var entries []*Entry
+	query := url.Values{
+		"list-type": {"2"},
+		"prefix":    {b.prefix + "entries/" + prefix},
+	}
+	for {
+		data, err := b.do(http.MethodGet, b.objectURL("", query), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if err = xml.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+
+		for _, obj := range result.Contents {
+			e, err := b.Get(strings.TrimPrefix(obj.Key, b.prefix+"entries/"))
+			if errors.Is(err, ErrNotFound) {
+				// Deleted since the listing was made
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		}
+
+		if !result.IsTruncated {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	return entries, nil
+}
+
+func (b *s3Backend) Meta(name string) ([]byte, error) {
+	return b.do(http.MethodGet, b.objectURL(b.prefix+"meta/"+name, nil), nil)
+}
+
+func (b *s3Backend) SetMeta(name string, data []byte) error {
+	_, err := b.do(http.MethodPut, b.objectURL(b.prefix+"meta/"+name, nil), data)
+	return err
+}
+
+func (b *s3Backend) Close() error {
+	b.client.CloseIdleConnections()
+	return nil
+}
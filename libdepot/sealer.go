@@ -0,0 +1,132 @@
+package libdepot
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The cipher of values sealed by AESGCM, which is what every value was
+// encrypted with before sealers could be chosen
+const CipherAESGCM = ""
+
+// A way of encrypting values (see WithSealer), such as AES-GCM, age, or a
+// key management service. The parameters a value was sealed with, such as
+// its nonce, are stored with it (as Entry.Nonce) and given back to Open, and
+// the name of the sealer is stored as Entry.Cipher so that it can be found
+// again. Implementations must be safe for concurrent use.
+type Sealer interface {
+	// Returns the name that values sealed by it are stored with, which must
+	// be unique among the sealers given to a depot
+	Cipher() string
+
+	// Returns data encrypted with key, the 32 bytes derived from the
+	// password (see WithKeyfile), and the parameters needed to open it
+	// again. The parameters must not be empty, and must never be the same
+	// for two values, since a depot tells values apart by them.
+	Seal(key, data []byte) (sealed, params []byte, err error)
+
+	// Returns the data that was sealed with key and params, or an error if
+	// it cannot be opened, such as because key is not the one it was sealed
+	// with
+	Open(key, params, sealed []byte) ([]byte, error)
+}
+
+// A value was sealed by a sealer that the depot was not given
+var ErrUnknownCipher = errors.New("value was sealed with an unknown cipher")
+
+// The Sealer that depots seal values with unless they are given another:
+// AES-256-GCM, with a random 12-byte nonce as its parameters
+var AESGCM Sealer = aesGCM{}
+
+// Reads its nonces from rand, or crypto/rand if it is nil
+type aesGCM struct {
+	rand io.Reader
+}
+
+func (aesGCM) Cipher() string {
+	return CipherAESGCM
+}
+
+func (s aesGCM) Seal(key, data []byte) ([]byte, []byte, error) {
+	return s.sealWith(key, data, nil)
+}
+
+func (aesGCM) Open(key, params, sealed []byte) ([]byte, error) {
+	return decrypt(key, params, sealed, nil)
+}
+
+// Seals data as Seal does, binding it to aad as additional data
+func (s aesGCM) sealWith(key, data, aad []byte) ([]byte, []byte, error) {
+	r := s.rand
+	if r == nil {
+		r = rand.Reader
+	}
+
+	return encrypt(r, key, data, aad)
+}
+
+// Returns an Option that seals new values with s, and lets values it sealed
+// be opened. Values sealed by AESGCM can always be opened, but those sealed
+// by other sealers can only be opened by a depot given them too, so a depot
+// that moves from one sealer to another should be given the old one first
+// and the new one last. Only values stowed from then on are sealed by the
+// new sealer, until Reencrypt is called.
+func WithSealer(s Sealer) Option {
+	return func(db *Depot) {
+		if db.sealers == nil {
+			db.sealers = map[string]Sealer{}
+		}
+		db.sealers[s.Cipher()] = s
+		db.sealer = s
+	}
+}
+
+// Returns data sealed with key by the depot's sealer, bound to aad if it is
+// AES-GCM (see entryAAD), the parameters it was sealed with, and the sealer's
+// cipher, or an error if unsuccessful
+func (db *Depot) seal(key, data, aad []byte) (sealed, params []byte, cipher string, err error) {
+	s := db.sealer
+	if _, ok := s.(aesGCM); ok || s == nil {
+		gcm := aesGCM{rand: db.random()}
+		s = gcm
+		sealed, params, err = gcm.sealWith(key, data, aad)
+	} else {
+		sealed, params, err = s.Seal(key, data)
+	}
+	if err != nil {
+		return nil, nil, "", err
+	} else if len(params) == 0 {
+		return nil, nil, "", fmt.Errorf("sealer %q gave no parameters", s.Cipher())
+	}
+
+	return sealed, params, s.Cipher(), nil
+}
+
+// Returns the sealer that can open values sealed with cipher, or
+// ErrUnknownCipher if the depot was not given it
+func (db *Depot) opener(cipher string) (Sealer, error) {
+	if cipher == CipherAESGCM {
+		return aesGCM{rand: db.random()}, nil
+	} else if s, ok := db.sealers[cipher]; ok {
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownCipher, cipher)
+}
+
+// Returns the data that was sealed with key and params by the sealer of
+// cipher, checking that it was bound to aad if it is AES-GCM, or an error if
+// it cannot be opened
+func (db *Depot) open(cipher string, key, params, sealed, aad []byte) ([]byte, error) {
+	if cipher == CipherAESGCM {
+		return decrypt(key, params, sealed, aad)
+	}
+	s, err := db.opener(cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Open(key, params, sealed)
+}
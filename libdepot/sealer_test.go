@@ -0,0 +1,87 @@
+package libdepot
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// A Sealer as a plugin would add one, sealing with XChaCha20-Poly1305
+type xchachaSealer struct{}
+
+func (xchachaSealer) Cipher() string {
+	return "xchacha20-poly1305"
+}
+
+func (xchachaSealer) Seal(key, data []byte) ([]byte, []byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+
+	return aead.Seal(nil, nonce, data, nil), nonce, nil
+}
+
+func (xchachaSealer) Open(key, params, sealed []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Open(nil, params, sealed, nil)
+}
+
+func TestSealer(t *testing.T) {
+	password := []byte("correct horse battery staple")
+	aesdb, _ := NewMemDepot()
+	if err := aesdb.Stow("old", "sealed by AES-GCM", password); err != nil {
+		t.Fatalf("error stowing: %v", err)
+	}
+	if e, _ := aesdb.backend.Get("old"); e.Cipher != CipherAESGCM || len(e.Nonce) != 12 {
+		t.Errorf("expected AES-GCM with a 12-byte nonce by default but got %q and %d bytes", e.Cipher, len(e.Nonce))
+	}
+
+	sdb, err := NewDepotWithBackend(aesdb.backend, WithSealer(xchachaSealer{}))
+	if err != nil {
+		t.Fatalf("error opening depot: %v", err)
+	}
+	if err = sdb.Stow("new", "sealed by XChaCha20", password); err != nil {
+		t.Fatalf("error stowing with a sealer: %v", err)
+	}
+	if e, _ := sdb.backend.Get("new"); e.Cipher != "xchacha20-poly1305" || len(e.Nonce) != chacha20poly1305.NonceSizeX {
+		t.Errorf("expected the sealer's cipher and nonce to be stored but got %q and %d bytes", e.Cipher, len(e.Nonce))
+	}
+	for key, want := range map[string]string{"old": "sealed by AES-GCM", "new": "sealed by XChaCha20"} {
+		if val, err := sdb.Fetch(key, password); err != nil || val != want {
+			t.Errorf("expected %q for %v but got %q (%v)", want, key, val, err)
+		}
+	}
+	if _, err = sdb.Fetch("new", []byte("wrong")); !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v but got %v", ErrBadPassword, err)
+	}
+	if err = sdb.Verify("new", password); err != nil {
+		t.Errorf("expected the password to verify but got %v", err)
+	}
+
+	// A depot that wasn't given the sealer can't open what it sealed
+	if _, err = aesdb.Fetch("new", password); !errors.Is(err, ErrUnknownCipher) {
+		t.Errorf("expected %v but got %v", ErrUnknownCipher, err)
+	}
+	if problems, err := aesdb.Check(password, false); err != nil || len(problems) != 1 || problems[0].Key != "new" {
+		t.Errorf("expected the unknown cipher to be reported as a problem but got %+v (%v)", problems, err)
+	}
+
+	// Reencrypting moves every value to the depot's sealer
+	if n, _, err := sdb.Reencrypt(password, nil); err != nil || n != 2 {
+		t.Fatalf("expected 2 values reencrypted but got %v (%v)", n, err)
+	}
+	if e, _ := sdb.backend.Get("old"); e.Cipher != "xchacha20-poly1305" {
+		t.Errorf("expected reencrypting to seal with the new sealer but got %q", e.Cipher)
+	}
+}
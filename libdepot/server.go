@@ -0,0 +1,394 @@
+package libdepot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The largest request body the server will read
+const maxRequestSize = 1 << 20
+
+// Serves a depot over HTTP. Alongside the API spoken by the HTTP backend
+// (see NewHTTPBackend), which deals only in encrypted entries, it offers
+// whole operations on values:
+//
+//	GET    /v1/values/{key}    fetch a value
+//	PUT    /v1/values/{key}    stow the request body as the value
+//	DELETE /v1/values/{key}    drop a value
+//	GET    /v1/shares/{token}  fetch a shared value (see Share), or for a
+//	                           browser, a page that asks first
+//	POST   /v1/shares/{token}  fetch a shared value
+//
+// and, for admins, GET /metrics reports the requests it has handled, the
+// number of entries in the depot, and the size of its database (for backends
+// that are a Sizer) in the Prometheus text format.
+//
+// For encrypted values the password goes in the X-Depot-Password header, so
+// the server should only ever be reached over TLS. Every request but for a
+// shared value, whose token is all it needs, must carry the server's token,
+// or the token of one of the depot's users (see AddUser), as a bearer token.
+// Users other than admins are held to the keys their rules allow, both for
+// an alias and for the key it stands for, and see only the keys they may
+// read. When such a user deletes an entry through the API of the HTTP
+// backend, its value is dropped as Drop drops it, and its tombstone is
+// removed for good only once it is older than TombstoneLifetime. A depot
+// with a rate limit (see WithRateLimit) refuses requests from clients that
+// exceed it, or that are backing off after failing, with 429 Too Many
+// Requests and a Retry-After header.
+type Server struct {
+	depot   *Depot
+	token   string
+	metrics *metrics
+}
+
+// Returns a server for the given depot that admits requests bearing token as
+// the owner, and those bearing the tokens of the depot's users
+func NewServer(db *Depot, token string) *Server {
+	return &Server{db, token, newMetrics()}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w}
+	s.serve(rec, r)
+	if rec.code == 0 {
+		rec.code = http.StatusOK
+	}
+	s.metrics.observe(requestRoute(r.URL.EscapedPath()), r.Method, rec.code, time.Since(start))
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+	addr, token := requestClient(r)
+	if wait := s.depot.throttle(addr, token); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(w, ErrRateLimited)
+		return
+	}
+	if shareToken, ok := strings.CutPrefix(path, "/v1/shares/"); ok {
+		s.serveShare(w, r, shareToken)
+		return
+	}
+
+	user, err := s.depot.authenticate(s.token, token)
+	if errors.Is(err, ErrUnauthorized) {
+		s.depot.failedRequest(addr, token, err)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		writeError(w, err)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+
+	switch {
+	case path == "/metrics":
+		s.serveMetrics(w, r, user)
+	case path == "/v1/entries":
+		s.serveList(w, r, user)
+	case strings.HasPrefix(path, "/v1/entries/"):
+		s.serveEntry(w, r, user, strings.TrimPrefix(path, "/v1/entries/"))
+	case strings.HasPrefix(path, "/v1/meta/"):
+		s.serveMeta(w, r, user, strings.TrimPrefix(path, "/v1/meta/"))
+	case strings.HasPrefix(path, "/v1/values/"):
+		s.serveValue(w, r, user, strings.TrimPrefix(path, "/v1/values/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Writes the given error as a response with a fitting status code
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrPasswordNeeded), errors.Is(err, ErrBadPassword), errors.Is(err, ErrForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, ErrWeakPassword), errors.Is(err, ErrInvalidKey), errors.Is(err, ErrInvalidParams):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrRateLimited):
+		status = http.StatusTooManyRequests
+	}
+
+	http.Error(w, err.Error(), status)
+}
+
+// Writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// Returns ErrForbidden unless the user may do what the request's method asks
+// of key, and of the key it stands for if it is an alias, recording the
+// refusal in the audit log
+func checkAccess(db *Depot, r *http.Request, user *User, key string) error {
+	perm, action := PermWrite, AuditStow
+	switch r.Method {
+	case http.MethodGet:
+		perm, action = PermRead, AuditFetch
+	case http.MethodDelete:
+		action = AuditDrop
+	}
+	if ok, err := db.userCan(user, key, perm); err != nil {
+		return err
+	} else if !ok {
+		return db.audit(action, key, ErrForbidden)
+	}
+
+	return nil
+}
+
+// Deletes the entry stored under key on behalf of a client of a Server. An
+// admin removes it for good, as a backend would. For other users a value is
+// dropped as Drop drops it, leaving a tombstone that keeps it in the trash,
+// and a tombstone is removed, as PurgeTombstones removes it, only once it is
+// older than TombstoneLifetime. Returns an error if unsuccessful.
+func (db *Depot) deleteEntry(user *User, key string) error {
+	return db.audit(AuditDrop, key, db.locked(func() error {
+		if !user.Admin {
+			e, err := db.backend.Get(key)
+			if errors.Is(err, ErrNotFound) || (err == nil && !e.Deleted) {
+				return db.drop(key)
+			} else if err != nil {
+				return fmt.Errorf("%w: %w", ErrDatabase, err)
+			} else if e.Modified.After(db.now().Add(-TombstoneLifetime)) {
+				return fmt.Errorf("%w: only an admin may purge a recent tombstone", ErrForbidden)
+			}
+		}
+
+		if err := db.backend.Delete(key); err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+		return nil
+	}))
+}
+
+func (s *Server) serveList(w http.ResponseWriter, r *http.Request, user *User) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries, err := s.depot.backend.List(r.URL.Query().Get("prefix"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	readable := []*Entry{}
+	for _, e := range entries {
+		if user.Can(e.Key, PermRead) {
+			readable = append(readable, e)
+		}
+	}
+	entries = readable
+
+	writeJSON(w, entries)
+}
+
+func (s *Server) serveEntry(w http.ResponseWriter, r *http.Request, user *User, escaped string) {
+	key, err := url.PathUnescape(escaped)
+	if err != nil {
+		http.Error(w, "invalid key", http.StatusBadRequest)
+		return
+	}
+	db := s.depot.as(user.Name)
+	if err = checkAccess(db, r, user, key); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		e, err := db.backend.Get(key)
+		if err = db.audit(AuditFetch, key, err); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, e)
+	case http.MethodPut:
+		var e Entry
+		if err = json.NewDecoder(r.Body).Decode(&e); err != nil || e.Key != key {
+			http.Error(w, "invalid entry", http.StatusBadRequest)
+			return
+		}
+		if err = db.auditPut(&e, db.putChecked(&e)); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if err = db.deleteEntry(user, key); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) serveMeta(w http.ResponseWriter, r *http.Request, user *User, escaped string) {
+	name, err := url.PathUnescape(escaped)
+	if err != nil {
+		http.Error(w, "invalid name", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if !user.canReadMeta(name) {
+			writeError(w, ErrForbidden)
+			return
+		}
+		data, err := s.depot.backend.Meta(name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err = s.depot.checkMetaWrite(user, name, data); err != nil {
+			writeError(w, err)
+			return
+		}
+		if err = s.depot.backend.SetMeta(name, data); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Returns the address a request comes from, without its port, and the bearer
+// token it carries, if any
+func requestClient(r *http.Request) (string, string) {
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	return addr, token
+}
+
+// Returns the password sent with the request, or nil if there is none
+func requestPassword(r *http.Request) []byte {
+	if _, ok := r.Header["X-Depot-Password"]; !ok {
+		return nil
+	}
+
+	return []byte(r.Header.Get("X-Depot-Password"))
+}
+
+func (s *Server) serveValue(w http.ResponseWriter, r *http.Request, user *User, escaped string) {
+	key, err := url.PathUnescape(escaped)
+	if err != nil {
+		http.Error(w, "invalid key", http.StatusBadRequest)
+		return
+	}
+	db := s.depot.as(user.Name)
+	if err = checkAccess(db, r, user, key); err != nil {
+		writeError(w, err)
+		return
+	}
+	addr, token := requestClient(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		val, err := db.Fetch(key, requestPassword(r))
+		if err != nil {
+			s.depot.failedRequest(addr, token, err)
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, val)
+	case http.MethodPut:
+		// Read no more than would be refused anyway
+		body := r.Body
+		if limit := db.MaxValueSize(); limit > 0 {
+			body = http.MaxBytesReader(w, body, int64(limit)+1)
+		}
+		val, err := io.ReadAll(body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, ErrTooLarge)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err = db.Stow(key, string(val), requestPassword(r)); err != nil {
+			s.depot.failedRequest(addr, token, err)
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if err = db.Drop(key); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// A page that asks before a shared value is fetched, so that a browser, or a
+// chat app previewing the link, does not use the share up just by loading it
+const sharePage = `<!DOCTYPE html>
+<title>Shared secret</title>
+<p>Someone has shared a secret with you. It can only be shown so many times.</p>
+<form method="post"><button>Show it</button></form>
+`
+
+func (s *Server) serveShare(w http.ResponseWriter, r *http.Request, token string) {
+	switch {
+	case r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html"):
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, sharePage)
+		return
+	case r.Method != http.MethodGet && r.Method != http.MethodPost:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	val, err := s.depot.OpenShare(token)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// Nothing along the way may keep what can only be fetched so many times
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, val)
+}
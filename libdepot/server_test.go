@@ -0,0 +1,418 @@
+package libdepot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Sends a request to the test server and returns the response status and body
+func request(t *testing.T, method, url, token, password, body string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if password != "" {
+		req.Header.Set("X-Depot-Password", password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestServerValues(t *testing.T) {
+	srv := testServer(t, "token")
+	url := srv.URL + "/v1/values/web%2Fgithub"
+
+	if status, _ := request(t, http.MethodGet, url, "wrong", "", ""); status != http.StatusUnauthorized {
+		t.Errorf("expected %v with the wrong token but got %v", http.StatusUnauthorized, status)
+	}
+
+	if status, body := request(t, http.MethodPut, url, "token", "password", "testing123"); status != http.StatusNoContent {
+		t.Errorf("expected %v stowing a value but got %v: %v", http.StatusNoContent, status, body)
+	}
+	if status, _ := request(t, http.MethodGet, url, "token", "", ""); status != http.StatusForbidden {
+		t.Errorf("expected %v fetching without a password but got %v", http.StatusForbidden, status)
+	}
+	if status, body := request(t, http.MethodGet, url, "token", "password", ""); status != http.StatusOK || body != "testing123" {
+		t.Errorf("expected testing123 but got %v: %v", status, body)
+	}
+
+	if status, _ := request(t, http.MethodDelete, url, "token", "", ""); status != http.StatusNoContent {
+		t.Errorf("expected %v dropping a value but got %v", http.StatusNoContent, status)
+	}
+	if status, _ := request(t, http.MethodGet, url, "token", "password", ""); status != http.StatusNotFound {
+		t.Errorf("expected %v fetching a dropped value but got %v", http.StatusNotFound, status)
+	}
+}
+
+func TestServerUsers(t *testing.T) {
+	mdb, _ := NewMemDepot()
+	token, err := mdb.AddUser("alice", false)
+	if err != nil {
+		t.Fatalf("error adding user: %v", err)
+	}
+	mdb.Grant("alice", "team/", PermRead|PermWrite)
+	mdb.Grant("alice", "shared/", PermRead)
+	mdb.Stow("shared/key", "shared", nil)
+	mdb.Stow("private/key", "private", nil)
+	srv := httptest.NewServer(NewServer(mdb, "token"))
+	t.Cleanup(srv.Close)
+
+	for _, c := range []struct {
+		method, key string
+		status      int
+	}{
+		{http.MethodPut, "team%2Fkey", http.StatusNoContent},
+		{http.MethodGet, "team%2Fkey", http.StatusOK},
+		{http.MethodGet, "shared%2Fkey", http.StatusOK},
+		{http.MethodPut, "shared%2Fkey", http.StatusForbidden},
+		{http.MethodDelete, "shared%2Fkey", http.StatusForbidden},
+		{http.MethodGet, "private%2Fkey", http.StatusForbidden},
+	} {
+		if status, body := request(t, c.method, srv.URL+"/v1/values/"+c.key, token, "", "value"); status != c.status {
+			t.Errorf("expected %v for %v %v but got %v: %v", c.status, c.method, c.key, status, body)
+		}
+	}
+
+	// Only readable keys are listed
+	_, body := request(t, http.MethodGet, srv.URL+"/v1/entries", token, "", "")
+	var entries []*Entry
+	if err = json.Unmarshal([]byte(body), &entries); err != nil || len(entries) != 2 {
+		t.Errorf("expected alice to see 2 entries but got %v (%v)", body, err)
+	}
+
+	if status, _ := request(t, http.MethodGet, srv.URL+"/v1/meta/users", token, "", ""); status != http.StatusForbidden {
+		t.Errorf("expected %v reading users as a user but got %v", http.StatusForbidden, status)
+	}
+	if status, _ := request(t, http.MethodGet, srv.URL+"/v1/meta/users", "token", "", ""); status != http.StatusOK {
+		t.Errorf("expected %v reading users as the owner but got %v", http.StatusOK, status)
+	}
+	if status, _ := request(t, http.MethodGet, srv.URL+"/v1/values/private%2Fkey", "token", "", ""); status != http.StatusOK {
+		t.Errorf("expected %v reading a key as the owner but got %v", http.StatusOK, status)
+	}
+
+	// Aliases are held to the rules of the keys they stand for
+	if status, _ := request(t, http.MethodPut, srv.URL+"/v1/meta/aliases", token, "", `{"team/x":"private/key"}`); status != http.StatusForbidden {
+		t.Errorf("expected %v aliasing a key alice cannot read but got %v", http.StatusForbidden, status)
+	}
+	if status, body := request(t, http.MethodPut, srv.URL+"/v1/meta/aliases", token, "", `{"team/y":"shared/key"}`); status != http.StatusNoContent {
+		t.Errorf("expected %v aliasing a key alice can read but got %v: %v", http.StatusNoContent, status, body)
+	}
+	if status, _ := request(t, http.MethodPut, srv.URL+"/v1/values/team%2Fy", token, "", "value"); status != http.StatusForbidden {
+		t.Errorf("expected %v stowing through an alias of a key alice cannot write but got %v", http.StatusForbidden, status)
+	}
+	mdb.Alias("team/z", "private/key", false)
+	if status, _ := request(t, http.MethodGet, srv.URL+"/v1/values/team%2Fz", token, "", ""); status != http.StatusForbidden {
+		t.Errorf("expected %v fetching through an alias of a key alice cannot read but got %v", http.StatusForbidden, status)
+	}
+
+	// Refusals are audited along with everything else
+	events, err := mdb.AuditLog(AuditQuery{Actor: "alice", Pattern: "private/*"})
+	if err != nil || len(events) != 1 || events[0].Error != ErrForbidden.Error() {
+		t.Errorf("expected alice's refused fetch to be audited but got %v (%v)", events, err)
+	}
+	if events, _ = mdb.AuditLog(AuditQuery{Actor: OwnerName}); len(events) != 1 {
+		t.Errorf("expected the owner's fetch to be audited but got %v", events)
+	}
+}
+
+func TestServerMetaAccess(t *testing.T) {
+	mdb, _ := NewMemDepot()
+	token, err := mdb.AddUser("alice", false)
+	if err != nil {
+		t.Fatalf("error adding user: %v", err)
+	}
+	mdb.Grant("alice", "team/", PermRead|PermWrite)
+	mdb.Stow("team/key", "team", nil)
+	mdb.Stow("private/key", "private", nil)
+	mdb.SetRotation("private/key", time.Hour)
+	mdb.Attach("private/key", "file", strings.NewReader("contents"), []byte("password"))
+	srv := httptest.NewServer(NewServer(mdb, "token"))
+	t.Cleanup(srv.Close)
+
+	// What clients need is allowed for keys alice may write
+	rdb, err := NewDepot(srv.URL, WithToken(token))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+	if err = rdb.SetRotation("team/key", time.Hour); err != nil {
+		t.Errorf("error setting a rotation period as alice: %v", err)
+	}
+	if err = rdb.Attach("team/key", "file", strings.NewReader("contents"), []byte("password")); err != nil {
+		t.Errorf("error attaching a file as alice: %v", err)
+	}
+	if _, err = rdb.Share("team/key", nil, time.Hour, 1); err != nil {
+		t.Errorf("error sharing a value as alice: %v", err)
+	}
+	if err = rdb.Drop("team/key"); err != nil {
+		t.Errorf("error dropping a value as alice: %v", err)
+	}
+
+	attachments, _ := mdb.attachments()
+	chunk := url.PathEscape(chunkMeta(attachments["private/key"]["file"].ID, 0))
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	for _, c := range []struct{ name, body string }{
+		{"users", "[]"},
+		{"salt", "salt"},
+		{namespacesMeta, "{}"},
+		{rotationsMeta, "{}"},
+		{rotationsMeta, `{"private/key":1}`},
+		{attachmentsMeta, "{}"},
+		{chunk, ""},
+		{url.PathEscape(sharesMeta + "00"), `{"key":"private/key"}`},
+		{purgedMeta, future},
+		{"unknown", ""},
+	} {
+		if status, _ := request(t, http.MethodPut, srv.URL+"/v1/meta/"+c.name, token, "", c.body); status != http.StatusForbidden {
+			t.Errorf("expected %v writing %v as alice but got %v", http.StatusForbidden, c.name, status)
+		}
+	}
+	if period, _ := mdb.Rotations(); period["private/key"] != time.Hour {
+		t.Errorf("expected private/key's rotation period to be left alone but got %v", period)
+	}
+}
+
+func TestServerMaxValueSize(t *testing.T) {
+	mdb, _ := NewMemDepot(WithMaxValueSize(8))
+	srv := httptest.NewServer(NewServer(mdb, "token"))
+	t.Cleanup(srv.Close)
+
+	status, body := request(t, http.MethodPut, srv.URL+"/v1/values/big", "token", "", strings.Repeat("x", 1<<20))
+	if status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected %v putting a larger value but got %v: %v", http.StatusRequestEntityTooLarge, status, body)
+	}
+	if status, body = request(t, http.MethodPut, srv.URL+"/v1/values/small", "token", "", "value"); status != http.StatusNoContent {
+		t.Errorf("expected %v putting a value that fits but got %v: %v", http.StatusNoContent, status, body)
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	mdb, _ := NewMemDepot()
+	token, err := mdb.AddUser("alice", false)
+	if err != nil {
+		t.Fatalf("error adding user: %v", err)
+	}
+	mdb.Stow("kept", "value", nil)
+	mdb.Stow("dropped", "value", nil)
+	mdb.Drop("dropped")
+	srv := httptest.NewServer(NewServer(mdb, "token"))
+	t.Cleanup(srv.Close)
+
+	request(t, http.MethodGet, srv.URL+"/v1/values/kept", "token", "", "")
+	request(t, http.MethodGet, srv.URL+"/v1/values/missing", "token", "", "")
+	request(t, http.MethodGet, srv.URL+"/v1/values/kept", "wrong", "", "")
+
+	if status, _ := request(t, http.MethodGet, srv.URL+"/metrics", token, "", ""); status != http.StatusForbidden {
+		t.Errorf("expected %v reading metrics as a user but got %v", http.StatusForbidden, status)
+	}
+	status, body := request(t, http.MethodGet, srv.URL+"/metrics", "token", "", "")
+	if status != http.StatusOK {
+		t.Fatalf("expected %v reading metrics but got %v: %v", http.StatusOK, status, body)
+	}
+	for _, want := range []string{
+		`depot_http_requests_total{route="values",method="GET",code="200"} 1`,
+		`depot_http_requests_total{route="values",method="GET",code="404"} 1`,
+		`depot_http_requests_total{route="values",method="GET",code="401"} 1`,
+		`depot_http_requests_total{route="metrics",method="GET",code="403"} 1`,
+		`depot_http_request_duration_seconds_count{route="values"} 3`,
+		`depot_http_request_duration_seconds_bucket{route="values",le="+Inf"} 3`,
+		`depot_entries{state="live"} 1`,
+		`depot_entries{state="dropped"} 1`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("expected metrics to include %v but got:\n%v", want, body)
+		}
+	}
+}
+
+func TestServerShares(t *testing.T) {
+	srv := testServer(t, "token")
+	client, err := NewDepot(srv.URL, WithToken("token"))
+	if err != nil {
+		t.Fatalf("failed to open remote depot: %v", err)
+	}
+	if err = client.Stow("web/github", "testing123", []byte("password")); err != nil {
+		t.Fatalf("error stowing: %v", err)
+	}
+	token, err := client.Share("web/github", []byte("password"), time.Hour, 1)
+	if err != nil {
+		t.Fatalf("error sharing: %v", err)
+	}
+
+	// Anyone with the token may fetch it, without a token of the server's
+	url := srv.URL + "/v1/shares/" + token
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Accept", "text/html")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error sending request: %v", err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "<form") || strings.Contains(string(page), "testing123") {
+		t.Errorf("expected a browser to be asked first but got %v", string(page))
+	}
+	if status, body := request(t, http.MethodPost, url, "", "", ""); status != http.StatusOK || body != "testing123" {
+		t.Errorf("expected testing123 but got %v: %v", status, body)
+	}
+	if status, _ := request(t, http.MethodGet, url, "", "", ""); status != http.StatusNotFound {
+		t.Errorf("expected %v once the share is used up but got %v", http.StatusNotFound, status)
+	}
+}
+
+func TestServerRateLimit(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var events []AuditEvent
+	mdb, _ := NewMemDepot(
+		WithClock(func() time.Time { return now }),
+		WithAuditFunc(func(e AuditEvent) { events = append(events, e) }),
+		WithRateLimit(RateLimit{Rate: 1, Burst: 3, Backoff: time.Minute}))
+	srv := httptest.NewServer(NewServer(mdb, "token"))
+	t.Cleanup(srv.Close)
+	url := srv.URL + "/v1/values/k"
+
+	if status, body := request(t, http.MethodPut, url, "token", "password", "value"); status != http.StatusNoContent {
+		t.Fatalf("expected %v but got %v: %v", http.StatusNoContent, status, body)
+	}
+	if status, _ := request(t, http.MethodGet, url, "token", "wrong", ""); status != http.StatusForbidden {
+		t.Errorf("expected %v with a bad password but got %v", http.StatusForbidden, status)
+	}
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("X-Depot-Password", "password")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error sending request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "60" {
+		t.Errorf("expected %v after a bad password, to retry after 60s, but got %v, after %q",
+			http.StatusTooManyRequests, resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// Another client is held to its own limit, and failing to authenticate
+	// holds back only the address
+	now = now.Add(time.Hour)
+	if status, _ := request(t, http.MethodGet, url, "nobody", "", ""); status != http.StatusUnauthorized {
+		t.Errorf("expected %v with an unknown token but got %v", http.StatusUnauthorized, status)
+	}
+	if status, _ := request(t, http.MethodGet, url, "token", "password", ""); status != http.StatusTooManyRequests {
+		t.Errorf("expected %v after failing to authenticate but got %v", http.StatusTooManyRequests, status)
+	}
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		if status, body := request(t, http.MethodGet, url, "token", "password", ""); status != http.StatusOK {
+			t.Errorf("expected request %v within the burst to succeed but got %v: %v", i+1, status, body)
+		}
+	}
+	if status, _ := request(t, http.MethodGet, url, "token", "password", ""); status != http.StatusTooManyRequests {
+		t.Errorf("expected %v beyond the burst but got %v", http.StatusTooManyRequests, status)
+	}
+
+	var actions []string
+	for _, e := range events {
+		if e.Key == "" {
+			actions = append(actions, e.Action)
+			if e.Actor != "127.0.0.1" {
+				t.Errorf("expected %v to be recorded as by the client's address but got %v", e.Action, e.Actor)
+			}
+		}
+	}
+	if want := []string{AuditThrottle, AuditAuth, AuditThrottle, AuditThrottle}; !slices.Equal(actions, want) {
+		t.Errorf("expected %v to be recorded but got %v", want, actions)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{ErrNotFound, http.StatusNotFound},
+		{ErrForbidden, http.StatusForbidden},
+		{fmt.Errorf("%w: bad name", ErrInvalidKey), http.StatusBadRequest},
+		{fmt.Errorf("%w: no parameters", ErrInvalidParams), http.StatusBadRequest},
+		{ErrTooLarge, http.StatusRequestEntityTooLarge},
+		{errors.New("disk on fire"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		writeError(w, tt.err)
+		if w.Code != tt.want {
+			t.Errorf("expected %v for %v but got %v", tt.want, tt.err, w.Code)
+		}
+	}
+}
+
+func TestServerDeleteEntry(t *testing.T) {
+	now := time.Now()
+	var dropped []string
+	mdb, _ := NewMemDepot(WithClock(func() time.Time { return now }),
+		WithPostDrop(func(key string) { dropped = append(dropped, key) }))
+	token, err := mdb.AddUser("alice", false)
+	if err != nil {
+		t.Fatalf("error adding user: %v", err)
+	}
+	mdb.Grant("alice", "team/", PermRead|PermWrite)
+	mdb.Stow("team/key", "value", nil)
+	mdb.Stow("team/other", "value", nil)
+	srv := httptest.NewServer(NewServer(mdb, "token"))
+	t.Cleanup(srv.Close)
+	url := srv.URL + "/v1/entries/team%2Fkey"
+
+	// A user's delete drops the value, leaving it in the trash
+	if status, body := request(t, http.MethodDelete, url, token, "", ""); status != http.StatusNoContent {
+		t.Fatalf("expected %v deleting an entry but got %v: %v", http.StatusNoContent, status, body)
+	}
+	if trash, _ := mdb.Trash("team/*"); len(trash) != 1 || trash[0].Key != "team/key" {
+		t.Errorf("expected the value to be in the trash but got %v", trash)
+	}
+	events, err := mdb.AuditLog(AuditQuery{Actor: "alice"})
+	if err != nil || len(events) != 1 || events[0].Action != AuditDrop || events[0].Error != "" {
+		t.Errorf("expected alice's drop to be audited but got %v (%v)", events, err)
+	}
+	if len(dropped) != 1 {
+		t.Errorf("expected the post-drop hook to be called once but got %v", dropped)
+	}
+
+	// Its tombstone goes only once it is old enough
+	if status, _ := request(t, http.MethodDelete, url, token, "", ""); status != http.StatusForbidden {
+		t.Errorf("expected %v purging a recent tombstone but got %v", http.StatusForbidden, status)
+	}
+	now = now.Add(TombstoneLifetime + time.Hour)
+	if status, _ := request(t, http.MethodDelete, url, token, "", ""); status != http.StatusNoContent {
+		t.Errorf("expected %v purging an old tombstone but got %v", http.StatusNoContent, status)
+	}
+	if _, err = mdb.backend.Get("team/key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the tombstone to be gone but got %v", err)
+	}
+
+	// An admin's delete removes the entry for good
+	url = srv.URL + "/v1/entries/team%2Fother"
+	if status, _ := request(t, http.MethodDelete, url, "token", "", ""); status != http.StatusNoContent {
+		t.Errorf("expected %v deleting an entry as the owner but got %v", http.StatusNoContent, status)
+	}
+	if _, err = mdb.backend.Get("team/other"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the entry to be gone but got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package libdepot
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// The depot metadata that shares are kept in, each in metadata of its own
+// named for its ID after this prefix
+const sharesMeta = "shares/"
+
+// A copy of a value that whoever holds its token may fetch, until it expires
+// or has been fetched as many times as it allows (see Share). The value is
+// sealed with a key that is only ever part of the token, so neither the depot
+// nor anyone reading its backend can open it without the token.
+type share struct {
+	Key     string    `json:"key"`
+	Sealed  []byte    `json:"sealed"`
+	Nonce   []byte    `json:"nonce"`
+	Check   []byte    `json:"check"`
+	Expires time.Time `json:"expires"`
+	Uses    int       `json:"uses"`
+}
+
+// Returns the ID of the share a token was minted for and the key that opens
+// it, or ErrNotFound if the token is malformed, so that it tells no more than
+// a token for a share that is gone
+func parseShareToken(token string) (string, []byte, error) {
+	id, encoded, ok := strings.Cut(token, ".")
+	if _, err := hex.DecodeString(id); !ok || err != nil || id == "" {
+		return "", nil, ErrNotFound
+	}
+	key, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return "", nil, ErrNotFound
+	}
+
+	return id, key, nil
+}
+
+// Makes a copy of the value of key, or of the key it is an alias of,
+// decrypted with password if it is encrypted, that whoever holds the token
+// returned may fetch with OpenShare, at most uses times and only until
+// expires has passed, after which it is gone for good. The copy is sealed
+// with a key of its own that is part of the token and is never stored, so
+// the token must be handed over as carefully as the value itself. Returns
+// ErrInvalidParams if expires or uses is not positive, or another error if
+// unsuccessful.
+func (db *Depot) Share(key string, password []byte, expires time.Duration, uses int) (string, error) {
+	token, err := db.share(key, password, expires, uses)
+	if err = db.audit(AuditShare, key, err); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (db *Depot) share(key string, password []byte, expires time.Duration, uses int) (string, error) {
+	if expires <= 0 || uses <= 0 {
+		return "", fmt.Errorf("%w: a share must expire and allow at least one use", ErrInvalidParams)
+	}
+	entry, err := db.get(db.normalizeKey(key))
+	if err != nil {
+		return "", err
+	}
+	val, err := db.fetchEntry(entry, password)
+	if err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	shareKey := make([]byte, 32)
+	if _, err = io.ReadFull(db.random(), id); err != nil {
+		return "", fmt.Errorf("cannot generate random ID: %w", err)
+	}
+	if _, err = io.ReadFull(db.random(), shareKey); err != nil {
+		return "", fmt.Errorf("cannot generate random key: %w", err)
+	}
+	sealed, nonce, err := encrypt(db.random(), shareKey, []byte(val), nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot encrypt data: %w", err)
+	}
+
+	s := share{
+		Key:     entry.Key,
+		Sealed:  sealed,
+		Nonce:   nonce,
+		Check:   keyCheck(shareKey, nonce),
+		Expires: db.now().Add(expires),
+		Uses:    uses,
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	if err = db.backend.SetMeta(sharesMeta+hex.EncodeToString(id), data); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return hex.EncodeToString(id) + "." + base64.RawURLEncoding.EncodeToString(shareKey), nil
+}
+
+// Returns the value shared with token (see Share), counting it as one of the
+// share's uses and removing the share once it has none left. Fetches are
+// recorded in the audit log as by "share <ID>". Returns ErrNotFound if there
+// is no such share, including when it has expired, has been used up, or token
+// does not open it, or another error if unsuccessful.
+func (db *Depot) OpenShare(token string) (string, error) {
+	id, shareKey, err := parseShareToken(token)
+	if err != nil {
+		return "", db.opError(AuditFetch, "", err)
+	}
+
+	var val, key string
+	err = db.locked(func() error {
+		val, key, err = db.openShare(id, shareKey)
+		return err
+	})
+	if key == "" {
+		return "", db.opError(AuditFetch, "", err)
+	} else if err = db.as("share "+id).audit(AuditFetch, key, err); err != nil {
+		return "", err
+	}
+
+	return val, nil
+}
+
+// Opens the share with id, returning its value and the key it was shared
+// from, which is also returned if it cannot be opened once it is known
+func (db *Depot) openShare(id string, shareKey []byte) (string, string, error) {
+	name := sharesMeta + id
+	data, err := db.backend.Meta(name)
+	if errors.Is(err, ErrNotFound) || (err == nil && len(data) == 0) {
+		return "", "", ErrNotFound
+	} else if err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	var s share
+	if err = json.Unmarshal(data, &s); err != nil {
+		return "", "", fmt.Errorf("cannot read share: %w", ErrCorrupted)
+	}
+	// A token that doesn't open the share is no reason to use it up
+	if !hmac.Equal(s.Check, keyCheck(shareKey, s.Nonce)) {
+		return "", s.Key, ErrNotFound
+	}
+
+	if s.Uses--; s.Uses <= 0 || !db.now().Before(s.Expires) {
+		// Backends cannot delete metadata, so it is emptied
+		if err = db.backend.SetMeta(name, []byte{}); err != nil {
+			return "", s.Key, fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+		if !db.now().Before(s.Expires) {
+			return "", s.Key, ErrNotFound
+		}
+	} else {
+		if data, err = json.Marshal(s); err != nil {
+			return "", s.Key, err
+		}
+		if err = db.backend.SetMeta(name, data); err != nil {
+			return "", s.Key, fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+	}
+
+	val, err := decrypt(shareKey, s.Nonce, s.Sealed, nil)
+	if err != nil {
+		return "", s.Key, fmt.Errorf("cannot decrypt share: %w", ErrCorrupted)
+	}
+
+	return string(val), s.Key, nil
+}
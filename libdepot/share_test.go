@@ -0,0 +1,69 @@
+package libdepot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShare(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	mdb, _ := NewMemDepot(WithClock(func() time.Time { return now }))
+	testShare(t, mdb, &now)
+}
+
+// Tests sharing with mdb, whose clock reads now
+func testShare(t *testing.T, mdb *Depot, now *time.Time) {
+	password := []byte("password")
+	mdb.Stow("db/password", "hunter2", password)
+
+	if _, err := mdb.Share("db/password", nil, time.Hour, 1); !errors.Is(err, ErrPasswordNeeded) {
+		t.Errorf("expected %v sharing without a password but got %v", ErrPasswordNeeded, err)
+	}
+	if _, err := mdb.Share("db/password", password, 0, 1); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("expected %v for a share that never expires but got %v", ErrInvalidParams, err)
+	}
+	if _, err := mdb.Share("db/password", password, time.Hour, 0); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("expected %v for a share that can never be used but got %v", ErrInvalidParams, err)
+	}
+	if _, err := mdb.Share("missing", password, time.Hour, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v sharing a missing key but got %v", ErrNotFound, err)
+	}
+
+	token, err := mdb.Share("db/password", password, time.Hour, 2)
+	if err != nil {
+		t.Fatalf("error sharing: %v", err)
+	}
+	if strings.Contains(token, "hunter2") {
+		t.Errorf("expected the token to hold no part of the value but got %v", token)
+	}
+
+	// A token with the right ID but the wrong key uses nothing up
+	id, _, _ := strings.Cut(token, ".")
+	wrong := id + ".AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	if _, err = mdb.OpenShare(wrong); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v with the wrong key but got %v", ErrNotFound, err)
+	}
+	if _, err = mdb.OpenShare("nonsense"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v with a malformed token but got %v", ErrNotFound, err)
+	}
+	for i := 0; i < 2; i++ {
+		if val, err := mdb.OpenShare(token); err != nil || val != "hunter2" {
+			t.Errorf("expected hunter2 on use %v but got %q (%v)", i+1, val, err)
+		}
+	}
+	if _, err = mdb.OpenShare(token); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v once the share is used up but got %v", ErrNotFound, err)
+	}
+
+	// Changing the value leaves the share as it was
+	if token, err = mdb.Share("db/password", password, time.Hour, 1); err != nil {
+		t.Fatalf("error sharing: %v", err)
+	}
+	mdb.Stow("db/password", "changed", password)
+	*now = now.Add(time.Hour)
+	if _, err = mdb.OpenShare(token); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v once the share has expired but got %v", ErrNotFound, err)
+	}
+}
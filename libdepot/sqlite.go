@@ -0,0 +1,515 @@
+//go:build cgo
+
+package libdepot
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// The name of the database file a depot is kept in by default
+const DefaultFilename = "depot.db"
+
+// A Backend that keeps entries in a sqlite3 database
+type sqliteBackend struct {
+	db    *sql.DB
+	stmts *statements
+	lock  fileLock
+}
+
+// Returns a Backend stored in the sqlite3 database at uri (a path or a file:
+// URI), creating the database if it does not exist, or an error if
+// initialization is unsuccessful. The database is put in WAL mode with a busy
+// timeout, so that several processes can use it at once, unless the query of
+// uri sets those pragmas otherwise, and transactions take the write lock as
+// they begin, so one never fails for having read what another was changing.
+// Writes that still find the database busy are retried until LockTimeout
+// passes, and the depot is locked with a file beside the database
+// (depot.db.lock) while it is read and changed together. The schema of an
+// older database is migrated, after the database is copied to a file beside
+// it named for the version it was at (depot.db.schema-2.bak, say).
+func NewSQLiteBackend(uri string) (Backend, error) {
+	dsn, err := sqliteDSN(uri, defaultSQLitePragmas())
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(dsn, "_txlock=") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "_txlock=immediate"
+	}
+	conn, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to database: %w", err)
+	}
+
+	b := &sqliteBackend{db: conn, stmts: newStatements(conn)}
+	if path := sqlitePath(uri); path != "" {
+		b.lock.path = path + ".lock"
+	}
+	err = retryBusy(sqliteBusy, func() error {
+		return migrate(conn, sqliteMigrations, b.backupBeforeMigrating)
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return b, nil
+}
+
+// The migrations that bring a sqlite3 database's schema up to date, in order
+var sqliteMigrations = []migration{
+	{1, "create tables", execMigration(`
+		create table if not exists storage (
+			modified    int  default (strftime('%s', 'now')),
+			key         text unique not null,
+			val         text not null,
+			nonce       blob unique,
+			checkval    blob,
+			salt        blob,
+			deleted     int  not null default 0,
+			compression text not null default ''
+		)`, `
+		create table if not exists meta (
+			name text primary key,
+			data blob not null
+		)`, `
+		create table if not exists audit (
+			time   int  not null,
+			actor  text not null,
+			action text not null,
+			key    text not null,
+			error  text not null default ''
+		)`, `
+		create trigger if not exists audit_no_update
+		before update on audit
+		begin
+			select raise(abort, 'audit log is append-only');
+		end`, `
+		create trigger if not exists audit_no_delete
+		before delete on audit
+		begin
+			select raise(abort, 'audit log is append-only');
+		end`)},
+	{2, "upgrade databases from before versioning", sqliteUpgradeUnversioned},
+	{3, "record the sealer of each value", execMigration(
+		`alter table storage add column cipher text not null default ''`)},
+	{4, "index values by when they were modified", execMigration(
+		`create index if not exists storage_modified on storage (modified)`)},
+	{5, "record the salt of each value", execMigration(
+		`alter table storage add column key_salt blob`)},
+}
+
+// Brings the schema of a database created before versioning began, which
+// the tables created by the first migration already existed in, up to date
+func sqliteUpgradeUnversioned(tx *sql.Tx) error {
+	columns := []struct{ name, def string }{
+		{"checkval", "blob"},
+		{"deleted", "int not null default 0"},
+		{"salt", "blob"},
+		{"compression", "text not null default ''"},
+	}
+	var found int
+	for _, c := range columns {
+		err := tx.QueryRow(`
+			select count(*)
+			from pragma_table_info('storage')
+			where name = ?`,
+			c.name).Scan(&found)
+		if err != nil {
+			return err
+		}
+		if found == 0 {
+			_, err = tx.Exec("alter table storage add column " + c.name + " " + c.def)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// The salt used to live in a table of its own
+	err := tx.QueryRow(`
+		select count(*)
+		from sqlite_master
+		where type = 'table' and name = 'salt'`).Scan(&found)
+	if err != nil || found == 0 {
+		return err
+	}
+	_, err = tx.Exec(`
+		insert or ignore into meta (name, data)
+		select 'salt', data from salt limit 1`)
+
+	return err
+}
+
+// Copies a database that is about to be migrated from the given version to a
+// file beside it named for that version, unless it is new or held in memory.
+// Returns an error if unsuccessful.
+func (b *sqliteBackend) backupBeforeMigrating(from int) error {
+	path, err := b.path()
+	if err != nil || path == "" {
+		return err
+	}
+
+	var found int
+	err = b.db.QueryRow(`
+		select count(*)
+		from sqlite_master
+		where type = 'table' and name = 'storage'`).Scan(&found)
+	if err != nil || found == 0 {
+		return err
+	}
+
+	return b.Snapshot(fmt.Sprintf("%v.schema-%d.bak", path, from))
+}
+
+func (b *sqliteBackend) Get(key string) (*Entry, error) {
+	var modified int64
+	e := Entry{Key: key}
+	err := b.stmts.QueryRow(`
+		select modified, val, nonce, checkval, salt, deleted, compression, cipher, key_salt
+		from storage
+		where key = ?`,
+		key).Scan(&modified, &e.Val, &e.Nonce, &e.Check, &e.Salt, &e.Deleted, &e.Compression, &e.Cipher, &e.KeySalt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	e.Modified = time.Unix(modified, 0)
+
+	return &e, nil
+}
+
+func (b *sqliteBackend) GetAll(keys []string) ([]*Entry, error) {
+	// The keys are passed as one JSON array so that the statement is the same
+	// however many there are
+	list, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := b.stmts.Query(`
+		select modified, key, val, nonce, checkval, salt, deleted, compression, cipher, key_salt
+		from storage
+		where key in (select value from json_each(?))`,
+		string(list))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanEntries(rows)
+}
+
+// Stores an entry, replacing any with the same key
+const sqlitePut = `
+	insert into storage (modified, key, val, nonce, checkval, salt, deleted, compression, cipher, key_salt)
+	values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	on conflict (key) do
+	update set
+		modified = excluded.modified,
+		val = excluded.val,
+		nonce = excluded.nonce,
+		checkval = excluded.checkval,
+		salt = excluded.salt,
+		deleted = excluded.deleted,
+		compression = excluded.compression,
+		cipher = excluded.cipher,
+		key_salt = excluded.key_salt`
+
+func (b *sqliteBackend) Put(e *Entry) error {
+	return b.exec(sqlitePut, entryArgs(e)...)
+}
+
+func (b *sqliteBackend) PutAll(entries []*Entry) error {
+	argSets := make([][]any, len(entries))
+	for i, e := range entries {
+		argSets[i] = entryArgs(e)
+	}
+
+	return retryBusy(sqliteBusy, func() error {
+		return b.stmts.ExecAll(sqlitePut, argSets)
+	})
+}
+
+// Adds to a counter, or starts one that does not exist, or is a tombstone,
+// at the amount added, returning the count, or nothing if the value is not a
+// counter or the count would overflow
+const sqliteIncrement = `
+	insert into storage (modified, key, val)
+	values (?1, ?2, cast(?3 as text))
+	on conflict (key) do
+	update set
+		modified = excluded.modified,
+		val = case when storage.deleted then excluded.val
+			else cast(cast(storage.val as integer) + ?3 as text) end,
+		nonce = null,
+		checkval = null,
+		salt = null,
+		deleted = 0,
+		compression = '',
+		cipher = '',
+		key_salt = null
+	where storage.deleted or (
+		storage.nonce is null and storage.compression = ''
+		and storage.val = cast(cast(storage.val as integer) as text)
+		and case when ?3 >= 0
+			then cast(storage.val as integer) <= 9223372036854775807 - ?3
+			else cast(storage.val as integer) >= -9223372036854775807 - 1 - ?3 end)
+	returning cast(val as integer)`
+
+func (b *sqliteBackend) Increment(key string, delta int64, modified time.Time) (int64, error) {
+	var n int64
+	err := retryBusy(sqliteBusy, func() error {
+		return b.stmts.QueryRow(sqliteIncrement, modified.Unix(), key, delta).Scan(&n)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, incrementError(b, key, delta)
+	}
+
+	return n, err
+}
+
+func (b *sqliteBackend) Delete(key string) error {
+	return b.exec("delete from storage where key = ?", key)
+}
+
+func (b *sqliteBackend) List(prefix string) ([]*Entry, error) {
+	rows, err := b.stmts.Query(`
+		select modified, key, val, nonce, checkval, salt, deleted, compression, cipher, key_salt
+		from storage
+		where substr(key, 1, length(?)) = ?
+		order by key`,
+		prefix, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanEntries(rows)
+}
+
+func (b *sqliteBackend) ListSince(t time.Time) ([]*Entry, error) {
+	rows, err := b.stmts.Query(`
+		select modified, key, val, nonce, checkval, salt, deleted, compression, cipher, key_salt
+		from storage
+		where modified >= ?
+		order by modified, key`,
+		t.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	return scanEntries(rows)
+}
+
+func (b *sqliteBackend) Meta(name string) ([]byte, error) {
+	var data []byte
+	err := b.stmts.QueryRow("select data from meta where name = ?", name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+func (b *sqliteBackend) SetMeta(name string, data []byte) error {
+	return b.exec(`
+		insert into meta (name, data)
+		values (?, ?)
+		on conflict (name) do
+		update set data = excluded.data`,
+		name, data)
+}
+
+// Runs a statement that changes the database, trying again while another
+// process holds the write lock for longer than the busy timeout. Returns an
+// error if unsuccessful.
+func (b *sqliteBackend) exec(query string, args ...any) error {
+	return retryBusy(sqliteBusy, func() error {
+		_, err := b.stmts.Exec(query, args...)
+		return err
+	})
+}
+
+// Reports whether err is sqlite3's way of saying another connection holds a
+// lock the statement needs
+func sqliteBusy(err error) bool {
+	var e sqlite3.Error
+	return errors.As(err, &e) && (e.Code == sqlite3.ErrBusy || e.Code == sqlite3.ErrLocked)
+}
+
+func (b *sqliteBackend) Lock() (func(), error) {
+	return b.lock.Lock()
+}
+
+func (b *sqliteBackend) queries() *statements {
+	return b.stmts
+}
+
+func (b *sqliteBackend) Close() error {
+	b.stmts.close()
+	return b.db.Close()
+}
+
+func (b *sqliteBackend) AppendAudit(e *AuditEvent) error {
+	return b.exec(`
+		insert into audit (time, actor, action, key, error)
+		values (?, ?, ?, ?, ?)`,
+		e.Time.UnixNano(), e.Actor, e.Action, e.Key, e.Error)
+}
+
+func (b *sqliteBackend) AuditLog(since time.Time) ([]*AuditEvent, error) {
+	rows, err := b.stmts.Query(`
+		select time, actor, action, key, error
+		from audit
+		where time >= ?
+		order by rowid`,
+		since.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*AuditEvent
+	for rows.Next() {
+		var t int64
+		var e AuditEvent
+		if err = rows.Scan(&t, &e.Actor, &e.Action, &e.Key, &e.Error); err != nil {
+			return nil, err
+		}
+		e.Time = time.Unix(0, t)
+		events = append(events, &e)
+	}
+
+	return events, rows.Err()
+}
+
+// Copies the database to path with sqlite3's online backup API, so the copy
+// is consistent even while the database is being written to. The copy is
+// readable by its owner alone, as the database is.
+func (b *sqliteBackend) Snapshot(path string) error {
+	if err := createPrivate(path); err != nil {
+		return err
+	}
+	dest, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	ctx := context.Background()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := b.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriver any) error {
+		return srcConn.Raw(func(srcDriver any) error {
+			backup, err := destDriver.(*sqlite3.SQLiteConn).Backup("main", srcDriver.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err = backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+func (b *sqliteBackend) SnapshotExt() string {
+	return ".db"
+}
+
+// Rebuilds the database with VACUUM, then truncates the write-ahead log the
+// rebuilt database passed through and refreshes the query planner's
+// statistics
+func (b *sqliteBackend) Compact() (int64, error) {
+	before, err := b.Size()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, stmt := range []string{"vacuum", "pragma wal_checkpoint(truncate)", "pragma optimize"} {
+		if _, err = b.db.Exec(stmt); err != nil {
+			return 0, err
+		}
+	}
+
+	after, err := b.Size()
+	if err != nil {
+		return 0, err
+	}
+
+	return before - after, nil
+}
+
+// Returns the size of the database file and its write-ahead log in bytes, or
+// 0 for a database held in memory
+func (b *sqliteBackend) Size() (int64, error) {
+	path, err := b.path()
+	if err != nil || path == "" {
+		return 0, err
+	}
+
+	return filesSize(path, path+"-wal")
+}
+
+// Returns the path of the database file, or an empty string for a database
+// held in memory
+func (b *sqliteBackend) path() (string, error) {
+	var path string
+	err := b.db.QueryRow("select file from pragma_database_list where name = 'main'").Scan(&path)
+
+	return path, err
+}
+
+// Returns the database file and, while the database is open in WAL mode, its
+// write-ahead log and shared-memory index, along with its lock file, or
+// nothing for a database held in memory
+func (b *sqliteBackend) Files() ([]string, error) {
+	path, err := b.path()
+	if err != nil || path == "" {
+		return nil, err
+	}
+
+	return []string{path, path + "-wal", path + "-shm", path + ".lock"}, nil
+}
+
+// Returns the problems sqlite's own integrity check finds
+func (b *sqliteBackend) CheckIntegrity() ([]string, error) {
+	rows, err := b.db.Query("pragma integrity_check")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err = rows.Scan(&msg); err != nil {
+			return nil, err
+		}
+		if msg != "ok" {
+			problems = append(problems, strings.TrimSpace(msg))
+		}
+	}
+
+	return problems, rows.Err()
+}
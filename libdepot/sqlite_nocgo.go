@@ -0,0 +1,22 @@
+//go:build !cgo
+
+package libdepot
+
+import (
+	"errors"
+)
+
+// The name of the database file a depot is kept in by default. Without cgo
+// there is no sqlite3, so bbolt takes its place.
+const DefaultFilename = "depot.bolt"
+
+// Always returns an error, since sqlite3 support requires cgo
+func NewSQLiteBackend(uri string) (Backend, error) {
+	return nil, errors.New("sqlite3 is unavailable in builds without cgo, use a bolt:// database instead")
+}
+
+// Stands in for the sqlite3 backend where its type is named, such as by
+// backendName, though none is ever made without cgo
+type sqliteBackend struct {
+	Backend
+}
@@ -0,0 +1,281 @@
+//go:build cgo
+
+package libdepot
+
+import (
+	"bytes"
+	"database/sql"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Returns the value of a pragma in the depot's sqlite3 database, failing the
+// test if it is unsuccessful
+func pragma(t *testing.T, d *Depot, name string) string {
+	t.Helper()
+
+	var val string
+	if err := d.backend.(*sqliteBackend).db.QueryRow("pragma " + name).Scan(&val); err != nil {
+		t.Fatalf("error reading pragma %v: %v", name, err)
+	}
+
+	return strings.ToLower(val)
+}
+
+func TestSQLitePragmas(t *testing.T) {
+	dir := t.TempDir()
+
+	d, err := NewDepot(filepath.Join(dir, "default.db"))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	for name, want := range map[string]string{
+		"journal_mode": "wal",
+		"busy_timeout": "5000",
+		"foreign_keys": "1",
+		"synchronous":  "1",
+	} {
+		if val := pragma(t, d, name); val != want {
+			t.Errorf("expected %v to be %v by default but it was %v", name, want, val)
+		}
+	}
+
+	d, err = NewDepot("file:"+filepath.Join(dir, "custom.db")+"?_journal=delete",
+		WithSQLitePragma("synchronous", "FULL"), WithSQLitePragma("journal_mode", "truncate"))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	if val := pragma(t, d, "synchronous"); val != "2" {
+		t.Errorf("expected the synchronous option to be applied but it was %v", val)
+	}
+	if val := pragma(t, d, "journal_mode"); val != "delete" {
+		t.Errorf("expected the uri to take precedence but the journal mode was %v", val)
+	}
+
+	if _, err = NewDepot(filepath.Join(dir, "bad.db"), WithSQLitePragma("nonsense", "1")); err == nil {
+		t.Errorf("expected an error with an unsupported pragma")
+	}
+}
+
+func TestSQLiteLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	d, err := NewDepot(filepath.Join(t.TempDir(), "test.db"), WithLogger(logger))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	if err = d.Stow("db/password", "hunter2", nil); err != nil {
+		t.Fatalf("error stowing: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "msg=sql") || !strings.Contains(out, "insert into storage") || !strings.Contains(out, "took=") {
+		t.Errorf("expected the statements run to be logged but got:\n%v", out)
+	}
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "args=\"db/password") {
+		t.Errorf("expected the arguments of statements to be redacted but got:\n%v", out)
+	}
+}
+
+func TestSQLiteChangedSince(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	d, err := NewDepot(filepath.Join(t.TempDir(), "test.db"), WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	if _, ok := d.backend.(ChangeLister); !ok {
+		t.Fatalf("expected the sqlite backend to list changes itself")
+	}
+	testChangedSince(t, d, &now)
+}
+
+func TestSQLitePeek(t *testing.T) {
+	d, err := NewDepot(filepath.Join(t.TempDir(), "test.db"), WithCompressionThreshold(16))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	if _, ok := d.backend.(MultiGetter); !ok {
+		t.Fatalf("expected the sqlite backend to get several entries at once")
+	}
+	testPeek(t, d)
+}
+
+func TestSQLiteShare(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	d, err := NewDepot(filepath.Join(t.TempDir(), "test.db"), WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	testShare(t, d, &now)
+}
+
+func TestSQLiteCompact(t *testing.T) {
+	d, err := NewDepot(filepath.Join(t.TempDir(), "compact.db"))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	testCompact(t, d)
+}
+
+func TestSQLiteMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	latest := sqliteMigrations[len(sqliteMigrations)-1].version
+
+	// A database as the first versions of depot left it
+	old, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	_, err = old.Exec(`
+		create table storage (
+			modified int default (strftime('%s', 'now')),
+			key      text unique not null,
+			val      text not null,
+			nonce    blob unique
+		);
+		create table salt (data blob not null);
+		insert into salt (data) values (x'0123456789');
+		insert into storage (key, val) values ('old', 'value');`)
+	old.Close()
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if err = os.Chmod(path, 0600); err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+
+	d, err := NewDepot(path)
+	if err != nil {
+		t.Fatalf("failed to migrate depot: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	if val, err := d.Fetch("old", nil); err != nil || val != "value" {
+		t.Errorf("expected old to survive migration but got %q (%v)", val, err)
+	}
+	if string(d.salt) != "\x01\x23\x45\x67\x89" {
+		t.Errorf("expected the salt to be carried over but got %x", d.salt)
+	}
+	conn := d.backend.(*sqliteBackend).db
+	if version, err := schemaVersion(conn); err != nil || version != latest {
+		t.Errorf("expected schema version %v but got %v (%v)", latest, version, err)
+	}
+	backup, err := NewDepot(path + ".schema-0.bak")
+	if err != nil {
+		t.Fatalf("expected a backup of the database before migrating: %v", err)
+	}
+	t.Cleanup(func() { backup.Close() })
+	if val, err := backup.Fetch("old", nil); err != nil || val != "value" {
+		t.Errorf("expected old in the backup but got %q (%v)", val, err)
+	}
+
+	// A migration that fails partway changes nothing
+	broken := append(sqliteMigrations, migration{latest + 1, "broken", execMigration(
+		"create table half (a int)", "not sql at all")})
+	if err = migrate(conn, broken, nil); err == nil {
+		t.Errorf("expected an error from a broken migration")
+	}
+	if version, _ := schemaVersion(conn); version != latest {
+		t.Errorf("expected a failed migration to leave schema version %v but got %v", latest, version)
+	}
+	var found int
+	conn.QueryRow("select count(*) from sqlite_master where name = 'half'").Scan(&found)
+	if found != 0 {
+		t.Errorf("expected a failed migration to be rolled back")
+	}
+
+	// An up-to-date database is neither migrated nor backed up again
+	os.Remove(path + ".schema-0.bak")
+	d.Close()
+	if d, err = NewDepot(path); err != nil {
+		t.Fatalf("failed to open depot: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	if _, err = os.Stat(path + ".schema-0.bak"); err == nil {
+		t.Errorf("expected no backup of an up-to-date database")
+	}
+}
+
+// Returns a depot in a sqlite3 database holding a plaintext value under key
+func benchmarkDepot(b *testing.B, key string) *Depot {
+	b.Helper()
+
+	d, err := NewDepot(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatalf("failed to initialize depot: %v", err)
+	}
+	b.Cleanup(func() { d.Close() })
+	if err = d.Stow(key, "value", nil); err != nil {
+		b.Fatalf("error stowing value: %v", err)
+	}
+
+	return d
+}
+
+func BenchmarkSQLiteFetch(b *testing.B) {
+	d := benchmarkDepot(b, "bench")
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := d.Fetch("bench", nil); err != nil {
+			b.Fatalf("error fetching value: %v", err)
+		}
+	}
+}
+
+func BenchmarkSQLiteStow(b *testing.B) {
+	d := benchmarkDepot(b, "bench")
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := d.Stow("bench", "value", nil); err != nil {
+			b.Fatalf("error stowing value: %v", err)
+		}
+	}
+}
+
+func TestSQLiteConcurrentAliases(t *testing.T) {
+	dbs := openDepots(t, filepath.Join(t.TempDir(), "test.db"), 4)
+	testConcurrentAliases(t, dbs)
+}
+
+func TestSQLiteIncrement(t *testing.T) {
+	d, err := NewDepot(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				if _, err := d.Increment("seq", 1); err != nil {
+					t.Errorf("error incrementing: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if val, _ := d.Fetch("seq", nil); val != "200" {
+		t.Errorf("expected no count to be lost but got %v", val)
+	}
+}
@@ -0,0 +1,187 @@
+package libdepot
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prepares the statements a SQL backend runs the first time each is needed
+// and keeps them for later calls, so the database parses each query once
+// rather than on every call. Each statement run is logged at debug level to
+// logger if it is not nil (see WithLogger).
+type statements struct {
+	db     *sql.DB
+	mu     sync.Mutex
+	cache  map[string]*sql.Stmt
+	logger *slog.Logger
+}
+
+// A Backend that runs its queries through statements
+type sqlBackend interface {
+	queries() *statements
+}
+
+func newStatements(db *sql.DB) *statements {
+	return &statements{db: db, cache: make(map[string]*sql.Stmt)}
+}
+
+// Returns the prepared statement for query or an error if unsuccessful
+func (s *statements) get(query string) (*sql.Stmt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stmt, ok := s.cache[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	s.cache[query] = stmt
+
+	return stmt, nil
+}
+
+// Runs query as Exec would, with a prepared statement. Should the statement
+// fail to be prepared, the query is run as it is to report the error, and
+// likewise for Query and QueryRow.
+func (s *statements) Exec(query string, args ...any) (res sql.Result, err error) {
+	defer s.logQuery(query, args, time.Now(), &err)
+	stmt, err := s.get(query)
+	if err != nil {
+		return s.db.Exec(query, args...)
+	}
+
+	return stmt.Exec(args...)
+}
+
+func (s *statements) Query(query string, args ...any) (rows *sql.Rows, err error) {
+	defer s.logQuery(query, args, time.Now(), &err)
+	stmt, err := s.get(query)
+	if err != nil {
+		return s.db.Query(query, args...)
+	}
+
+	return stmt.Query(args...)
+}
+
+func (s *statements) QueryRow(query string, args ...any) (row *sql.Row) {
+	defer func(start time.Time) {
+		err := row.Err()
+		s.logQuery(query, args, start, &err)
+	}(time.Now())
+	stmt, err := s.get(query)
+	if err != nil {
+		return s.db.QueryRow(query, args...)
+	}
+
+	return stmt.QueryRow(args...)
+}
+
+// Logs that query was run with args, redacted, from start, failing with *err
+// if it is not nil
+func (s *statements) logQuery(query string, args []any, start time.Time, err *error) {
+	if s.logger == nil || !s.logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+
+	attrs := []any{
+		slog.String("query", strings.Join(strings.Fields(query), " ")),
+		slog.String("args", redact(args)),
+		slog.Duration("took", time.Since(start)),
+	}
+	if *err != nil {
+		attrs = append(attrs, slog.Any("error", *err))
+	}
+	s.logger.Debug("sql", attrs...)
+}
+
+// Returns the arguments of a query as they are logged, with strings and byte
+// slices, which may be keys or values, given only by their length, and
+// anything else but numbers and booleans, such as a list of keys, only by its
+// type
+func redact(args []any) string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case string:
+			redacted[i] = fmt.Sprintf("<%d bytes>", len(arg))
+		case []byte:
+			redacted[i] = fmt.Sprintf("<%d bytes>", len(arg))
+		case int, int64, bool:
+			redacted[i] = fmt.Sprint(arg)
+		default:
+			redacted[i] = fmt.Sprintf("<%T>", arg)
+		}
+	}
+
+	return strings.Join(redacted, ", ")
+}
+
+// Runs query once for each set of arguments, all in one transaction, so that
+// either every run takes effect or none does. Returns an error if
+// unsuccessful.
+func (s *statements) ExecAll(query string, argSets [][]any) (err error) {
+	defer s.logQuery(query, nil, time.Now(), &err)
+	stmt, err := s.get(query)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	txStmt := tx.Stmt(stmt)
+	defer txStmt.Close()
+	for _, args := range argSets {
+		if _, err = txStmt.Exec(args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Returns the columns of the storage table that a SQL backend stores e in, in
+// the order they are inserted
+func entryArgs(e *Entry) []any {
+	return []any{e.Modified.Unix(), e.Key, e.Val, e.Nonce, e.Check, e.Salt, e.Deleted, e.Compression, e.Cipher, e.KeySalt}
+}
+
+// Returns the entries in rows, which hold the columns of the storage table in
+// the order entryArgs gives them, closing rows, or an error if unsuccessful
+func scanEntries(rows *sql.Rows) ([]*Entry, error) {
+	defer rows.Close()
+
+	var entries []*Entry
+	for rows.Next() {
+		var modified int64
+		var e Entry
+		err := rows.Scan(&modified, &e.Key, &e.Val, &e.Nonce, &e.Check, &e.Salt, &e.Deleted, &e.Compression, &e.Cipher, &e.KeySalt)
+		if err != nil {
+			return nil, err
+		}
+		e.Modified = time.Unix(modified, 0)
+		entries = append(entries, &e)
+	}
+
+	return entries, rows.Err()
+}
+
+// Closes every prepared statement
+func (s *statements) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for query, stmt := range s.cache {
+		stmt.Close()
+		delete(s.cache, query)
+	}
+}
@@ -0,0 +1,114 @@
+package libdepot
+
+import (
+	"fmt"
+	"time"
+)
+
+// A summary of what a depot holds, for checking on it and for comparing it
+// before and after a migration (see Depot.Stats)
+type Stats struct {
+	// How many keys have values, and how many of those are encrypted
+	Keys      int `json:"keys"`
+	Encrypted int `json:"encrypted"`
+
+	// How many aliases there are (see Depot.Alias), and how many tombstones
+	// of dropped keys are kept (see TombstoneLifetime)
+	Aliases    int `json:"aliases"`
+	Tombstones int `json:"tombstones"`
+
+	// How many bytes the values take up once compressed and encrypted
+	Size int64 `json:"size"`
+
+	// The keys and bytes of each namespace (see Namespace), with those of keys
+	// without one under ""
+	Prefixes map[string]PrefixStats `json:"prefixes"`
+
+	// When the least and most recently modified values were, or the zero
+	// time if there are none
+	Oldest time.Time `json:"oldest"`
+	Newest time.Time `json:"newest"`
+
+	// How many encrypted values each sealer sealed, by its cipher (see
+	// Sealer), with AESGCM's under CipherAESGCM
+	Ciphers map[string]int `json:"ciphers"`
+
+	// How many encrypted values were stowed before key checks were kept, so
+	// that a bad password cannot be told from corrupted data until Reencrypt
+	// is called
+	Unchecked int `json:"unchecked"`
+
+	// The kind of backend the depot is kept by, as OpError names it, the
+	// size of its storage in bytes if it is a Sizer, or -1, and the version
+	// of its schema if it is a SQL database, or 0
+	Backend       string `json:"backend"`
+	StorageSize   int64  `json:"storage_size"`
+	SchemaVersion int    `json:"schema_version,omitempty"`
+}
+
+// The keys under a namespace and the bytes their values take up
+type PrefixStats struct {
+	Keys int   `json:"keys"`
+	Size int64 `json:"size"`
+}
+
+// Returns a summary of what the depot holds, which needs no password, or an
+// error if unsuccessful
+func (db *Depot) Stats() (Stats, error) {
+	entries, err := db.backend.List("")
+	if err != nil {
+		return Stats{}, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	aliases, err := db.Aliases()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{
+		Aliases:     len(aliases),
+		Prefixes:    map[string]PrefixStats{},
+		Ciphers:     map[string]int{},
+		Backend:     backendName(db.backend),
+		StorageSize: -1,
+	}
+	for _, e := range entries {
+		if e.Deleted {
+			stats.Tombstones++
+			continue
+		}
+
+		info := keyInfo(e)
+		stats.Keys++
+		stats.Size += int64(info.Size)
+		prefix := stats.Prefixes[Namespace(e.Key)]
+		prefix.Keys++
+		prefix.Size += int64(info.Size)
+		stats.Prefixes[Namespace(e.Key)] = prefix
+		if stats.Oldest.IsZero() || e.Modified.Before(stats.Oldest) {
+			stats.Oldest = e.Modified
+		}
+		if e.Modified.After(stats.Newest) {
+			stats.Newest = e.Modified
+		}
+		if info.Encrypted {
+			stats.Encrypted++
+			stats.Ciphers[e.Cipher]++
+			if e.Check == nil {
+				stats.Unchecked++
+			}
+		}
+	}
+
+	if s, ok := db.backend.(Sizer); ok {
+		if stats.StorageSize, err = s.Size(); err != nil {
+			return Stats{}, fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+	}
+	if b, ok := db.backend.(sqlBackend); ok {
+		if stats.SchemaVersion, err = schemaVersion(b.queries().db); err != nil {
+			return Stats{}, fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,43 @@
+package libdepot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mdb, _ := NewMemDepot(WithClock(func() time.Time { return now }))
+	for key, secret := range map[string]bool{"banking/pin": true, "banking/acct": true, "misc": false, "gone": false} {
+		var password []byte
+		if secret {
+			password = []byte("password")
+		}
+		if err := mdb.Stow(key, "1234", password); err != nil {
+			t.Fatalf("error stowing: %v", err)
+		}
+		now = now.Add(time.Hour)
+	}
+	mdb.Drop("gone")
+	mdb.Alias("pin", "banking/pin", false)
+
+	stats, err := mdb.Stats()
+	if err != nil {
+		t.Fatalf("error summarizing depot: %v", err)
+	}
+	if stats.Keys != 3 || stats.Encrypted != 2 || stats.Aliases != 1 || stats.Tombstones != 1 {
+		t.Errorf("expected 3 keys, 2 encrypted, 1 alias, and 1 tombstone but got %+v", stats)
+	}
+	if p := stats.Prefixes["banking"]; p.Keys != 2 || p.Size == 0 || stats.Prefixes[""].Size != 4 {
+		t.Errorf("expected 2 keys under banking and 4 bytes under none but got %+v", stats.Prefixes)
+	}
+	if stats.Size != stats.Prefixes["banking"].Size+4 {
+		t.Errorf("expected the size to be that of every prefix but got %v", stats.Size)
+	}
+	if stats.Newest.Sub(stats.Oldest) < 2*time.Hour || stats.Newest.After(now) {
+		t.Errorf("expected values modified hours apart but got %v and %v", stats.Oldest, stats.Newest)
+	}
+	if stats.Ciphers[CipherAESGCM] != 2 || stats.Unchecked != 0 || stats.Backend != "memory" || stats.StorageSize != -1 {
+		t.Errorf("expected 2 AES-GCM values in a memory depot but got %+v", stats)
+	}
+}
@@ -0,0 +1,150 @@
+package libdepot
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Passwords estimated to have fewer bits of entropy than this are weak
+const MinPasswordEntropy = 50.0
+
+// Called by Stow when a value is about to be encrypted with a weak password,
+// along with the password's estimated entropy in bits. A non-nil error aborts
+// the Stow and is returned to its caller.
+type WeakPasswordFunc func(key string, entropy float64) error
+
+var (
+	// Keyboard rows, used to spot walks like "qwerty" and "asdf"
+	keyboardRows = []string{
+		"`1234567890-=",
+		"qwertyuiop[]\\",
+		"asdfghjkl;'",
+		"zxcvbnm,./",
+	}
+
+	// A handful of the most common passwords, which are tried first by
+	// anybody guessing
+	commonPasswords = []string{
+		"password", "123456", "123456789", "12345678", "12345", "qwerty",
+		"abc123", "football", "monkey", "letmein", "111111", "1234567",
+		"dragon", "baseball", "sunshine", "iloveyou", "trustno1", "princess",
+		"admin", "welcome", "shadow", "superman", "michael", "master",
+		"jennifer", "jordan", "hunter", "charlie", "passw0rd", "starwars",
+		"whatever", "freedom", "secret", "login", "hello", "access", "ninja",
+		"mustang", "batman", "zaq1zaq1", "qazwsx", "changeme", "default",
+	}
+)
+
+// Returns an Option that reports passwords weaker than MinPasswordEntropy to
+// the given function when they are used to encrypt a value
+func WithWeakPasswordFunc(fn WeakPasswordFunc) Option {
+	return func(db *Depot) {
+		db.weakPassword = fn
+	}
+}
+
+// Returns a rough estimate of the entropy of a password in bits. Like
+// zxcvbn, it discounts common passwords, repeated characters, sequences, and
+// keyboard walks instead of only counting character classes, so it is
+// conservative rather than exact.
+func EstimateEntropy(password []byte) float64 {
+	pw := []rune(string(password))
+	if len(pw) == 0 {
+		return 0
+	}
+
+	lower := strings.ToLower(string(pw))
+	trimmed := strings.TrimRightFunc(lower, unicode.IsDigit)
+	for rank, common := range commonPasswords {
+		if lower == common || trimmed == common {
+			suffix := len(lower) - len(trimmed)
+			return math.Log2(float64(rank+1)) + float64(suffix)*math.Log2(10)
+		}
+	}
+
+	bitsPerChar := math.Log2(float64(poolSize(pw)))
+	entropy := 0.0
+	for i := 0; i < len(pw); {
+		n := patternLength(pw[i:])
+		if n > 2 {
+			// A predictable run costs about as much as its first character
+			// plus a guess at its length
+			entropy += bitsPerChar + math.Log2(float64(n))
+		} else {
+			n = 1
+			entropy += bitsPerChar
+		}
+		i += n
+	}
+
+	return entropy
+}
+
+// Returns the number of distinct characters an attacker would have to try
+// for each position in the password
+func poolSize(pw []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range pw {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+
+	return size
+}
+
+// Returns the length of the repeated, sequential, or keyboard-walk run at the
+// start of pw
+func patternLength(pw []rune) int {
+	best := 1
+	for _, step := range []rune{0, 1, -1} {
+		n := 1
+		for n < len(pw) && unicode.ToLower(pw[n])-unicode.ToLower(pw[n-1]) == step {
+			n++
+		}
+		best = max(best, n)
+	}
+
+	for _, row := range keyboardRows {
+		n := 1
+		for n < len(pw) && adjacentKeys(row, unicode.ToLower(pw[n-1]), unicode.ToLower(pw[n])) {
+			n++
+		}
+		best = max(best, n)
+	}
+
+	return best
+}
+
+// Reports whether b sits immediately to the right of a on the keyboard row
+func adjacentKeys(row string, a, b rune) bool {
+	i := strings.IndexRune(row, a)
+	return i >= 0 && i+1 < len(row) && rune(row[i+1]) == b
+}
@@ -0,0 +1,54 @@
+package libdepot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEstimateEntropy(t *testing.T) {
+	weak := []string{"", "password", "password123", "aaaaaaaaaaaa", "abcdefgh", "qwertyuiop", "12345678"}
+	for _, pw := range weak {
+		if e := EstimateEntropy([]byte(pw)); e >= MinPasswordEntropy {
+			t.Errorf("expected %q to be weak but its entropy was estimated at %v", pw, e)
+		}
+	}
+
+	strong := []string{"correct horse battery staple", "x7#Qm!2vLp@9rZ&k"}
+	for _, pw := range strong {
+		if e := EstimateEntropy([]byte(pw)); e < MinPasswordEntropy {
+			t.Errorf("expected %q to be strong but its entropy was estimated at %v", pw, e)
+		}
+	}
+}
+
+func TestWeakPasswordFunc(t *testing.T) {
+	key := "weak"
+	reported := ""
+
+	wdb, err := NewDepot("test.db", WithWeakPasswordFunc(func(k string, entropy float64) error {
+		reported = k
+		return ErrWeakPassword
+	}))
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err.Error())
+	}
+	t.Cleanup(func() { wdb.Close() })
+
+	err = wdb.Stow(key, "testing123", []byte("password"))
+	if !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("expected %v from Stow() but the error was %v", ErrWeakPassword, err)
+	}
+	if reported != key {
+		t.Errorf("expected weak password for %v to be reported but got %q", key, reported)
+	}
+	if _, err = wdb.Fetch(key, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v after a rejected Stow() but the error was %v", ErrNotFound, err)
+	}
+
+	err = wdb.Stow(key, "testing123", []byte("x7#Qm!2vLp@9rZ&k"))
+	if err != nil {
+		t.Errorf("error inserting ciphertext into database: %v", err.Error())
+	}
+
+	t.Cleanup(func() { wdb.Drop(key) })
+}
@@ -0,0 +1,40 @@
+package libdepot
+
+import (
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Begins the HKDF info of every sub-key (see SubKey), so that they are never
+// the same as keys derived for anything else from the same secret
+const subKeyLabel = "depot sub-key "
+
+// Returns a 32-byte key derived from master with HKDF-SHA256 for purpose, such
+// as the name of a depot or a namespace. Keys derived for different purposes
+// are independent of each other, so one memorized password can protect any
+// number of depots and namespaces without any two sharing a key, and learning
+// one of them tells nothing about master or the others. A sub-key can be
+// given to a depot as its password, which is then stretched with its salt
+// like any other, or see WithSubKey.
+func SubKey(master []byte, purpose string) []byte {
+	key := make([]byte, 32)
+	// HKDF gives up to 255 times as much as this, so reading it cannot fail
+	io.ReadFull(hkdf.New(sha256.New, master, nil, []byte(subKeyLabel+purpose)), key)
+
+	return key
+}
+
+// Returns an Option that takes every password the depot is given to be a
+// master password, and derives the depot's keys from its sub-key for purpose
+// (see SubKey) instead, so that depots opened with the same master password
+// and different purposes share no key even if they share a salt. Namespaces
+// with passwords of their own (see CreateNamespace) derive theirs the same
+// way. An empty password given with a keyfile still derives the key from the
+// keyfile alone.
+func WithSubKey(purpose string) Option {
+	return func(db *Depot) {
+		db.subKeyPurpose = &purpose
+	}
+}
@@ -0,0 +1,41 @@
+package libdepot
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSubKey(t *testing.T) {
+	master := []byte("one memorized password")
+	work, home := SubKey(master, "work"), SubKey(master, "home")
+	if len(work) != 32 || bytes.Equal(work, home) {
+		t.Errorf("expected independent 32-byte keys but got %x and %x", work, home)
+	}
+	if !bytes.Equal(work, SubKey(master, "work")) {
+		t.Errorf("expected the same key for the same purpose")
+	}
+
+	// Depots sharing a backend, and so a salt, share no key
+	backend := NewMemBackend()
+	a, _ := NewDepotWithBackend(backend, WithSubKey("work"))
+	b, _ := NewDepotWithBackend(backend, WithSubKey("home"))
+	if bytes.Equal(a.DeriveKey(master), b.DeriveKey(master)) {
+		t.Errorf("expected different keys for different purposes")
+	}
+	if err := a.Stow("vpn", "hunter2", master); err != nil {
+		t.Fatalf("error stowing: %v", err)
+	}
+	if _, err := b.Fetch("vpn", master); !errors.Is(err, ErrBadPassword) {
+		t.Errorf("expected %v fetching with another purpose but got %v", ErrBadPassword, err)
+	}
+	if val, err := a.Fetch("vpn", master); err != nil || val != "hunter2" {
+		t.Errorf("expected hunter2 but got %q (%v)", val, err)
+	}
+
+	// The sub-key itself is the password a depot without the option needs
+	plain, _ := NewDepotWithBackend(backend)
+	if val, err := plain.Fetch("vpn", work); err != nil || val != "hunter2" {
+		t.Errorf("expected hunter2 with the sub-key but got %q (%v)", val, err)
+	}
+}
@@ -0,0 +1,188 @@
+package libdepot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// How a conflict between two depots is settled
+type Resolution int
+
+const (
+	// Keep the entry from the depot Sync was called on
+	KeepLocal Resolution = iota
+
+	// Keep the entry from the other depot
+	KeepRemote
+
+	// Keep the newer entry under its key and the older one under a key
+	// marking it as a conflicted copy (see ConflictKey)
+	KeepBoth
+)
+
+// Decides how to settle a key whose entry differs between two depots. An
+// error aborts the sync.
+type ConflictFunc func(local, remote *Entry) (Resolution, error)
+
+// A ConflictFunc that keeps whichever entry was modified most recently,
+// favoring the local one on a tie
+func NewestWins(local, remote *Entry) (Resolution, error) {
+	if remote.Modified.After(local.Modified) {
+		return KeepRemote, nil
+	}
+
+	return KeepLocal, nil
+}
+
+// The number of entries copied in each direction by a sync
+type SyncStats struct {
+	Pulled    int
+	Pushed    int
+	Conflicts int
+}
+
+// Depots whose keys are derived from different salts cannot share encrypted
+// entries
+var ErrSaltMismatch = errors.New("depots were created with different salts")
+
+// Returns the key under which the losing entry of a conflict is kept when
+// both are kept
+func ConflictKey(e *Entry) string {
+	return e.Key + ".conflict-" + e.Modified.UTC().Format("20060102T150405Z")
+}
+
+// Reports whether key is one that ConflictKey returns
+func isConflictKey(key string) bool {
+	return strings.Contains(key, ".conflict-")
+}
+
+// Reports whether two entries hold the same value
+func sameEntry(a, b *Entry) bool {
+	return a.Val == b.Val && bytes.Equal(a.Nonce, b.Nonce) &&
+		bytes.Equal(a.Check, b.Check) && bytes.Equal(a.Salt, b.Salt) &&
+		a.Deleted == b.Deleted && a.Compression == b.Compression &&
+		a.Cipher == b.Cipher && bytes.Equal(a.KeySalt, b.KeySalt)
+}
+
+// Merges the depot with another so that both hold the same entries. Keys
+// present in only one depot are copied to the other, and keys whose entries
+// differ are settled by resolve (NewestWins if it is nil). Encrypted entries
+// are copied as they are, so the depots must share a salt; an empty depot
+// takes on the salt of the other. Tombstones are synced like any other entry,
+// so a key dropped from one depot is dropped from the other unless it was
+// stowed there again afterward. Returns what was copied or an error if
+// unsuccessful.
+func (db *Depot) Sync(other *Depot, resolve ConflictFunc) (SyncStats, error) {
+	var stats SyncStats
+	if resolve == nil {
+		resolve = NewestWins
+	}
+
+	local, err := db.backend.List("")
+	if err != nil {
+		return stats, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	remote, err := other.backend.List("")
+	if err != nil {
+		return stats, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	if !bytes.Equal(db.salt, other.salt) {
+		switch {
+		case len(remote) == 0:
+			err = other.adoptSalt(db.salt)
+		case len(local) == 0:
+			err = db.adoptSalt(other.salt)
+		default:
+			err = ErrSaltMismatch
+		}
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	put := func(d *Depot, e *Entry) error {
+		if err := d.backend.Put(e); err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+		return nil
+	}
+
+	// Both lists are sorted by key, so they can be walked together
+	for i, j := 0, 0; i < len(local) || j < len(remote); {
+		switch {
+		case j == len(remote) || (i < len(local) && local[i].Key < remote[j].Key):
+			err = put(other, local[i])
+			stats.Pushed++
+			i++
+		case i == len(local) || remote[j].Key < local[i].Key:
+			err = put(db, remote[j])
+			stats.Pulled++
+			j++
+		default:
+			l, r := local[i], remote[j]
+			i++
+			j++
+			if sameEntry(l, r) {
+				continue
+			}
+
+			stats.Conflicts++
+			var res Resolution
+			if res, err = resolve(l, r); err != nil {
+				return stats, err
+			}
+
+			switch res {
+			case KeepLocal:
+				err = put(other, l)
+				stats.Pushed++
+			case KeepRemote:
+				err = put(db, r)
+				stats.Pulled++
+			case KeepBoth:
+				newer, older := l, r
+				if older.Modified.After(newer.Modified) {
+					newer, older = older, newer
+				}
+				copied := *older
+				copied.Key = ConflictKey(older)
+				for _, d := range []*Depot{db, other} {
+					if err == nil {
+						err = put(d, newer)
+					}
+					// There is nothing to keep of a dropped key
+					if err == nil && !older.Deleted {
+						err = put(d, &copied)
+					}
+				}
+				stats.Pushed++
+				stats.Pulled++
+			default:
+				err = fmt.Errorf("unknown resolution: %v", res)
+			}
+		}
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	db.log().Info("synced depot", slog.Int("pulled", stats.Pulled),
+		slog.Int("pushed", stats.Pushed), slog.Int("conflicts", stats.Conflicts))
+
+	return stats, nil
+}
+
+// Replaces the salt of a depot that holds no entries. Returns an error if
+// unsuccessful.
+func (db *Depot) adoptSalt(salt []byte) error {
+	if err := db.backend.SetMeta("salt", salt); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	db.salt = salt
+
+	return nil
+}
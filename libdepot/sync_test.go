@@ -0,0 +1,146 @@
+package libdepot
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSync(t *testing.T) {
+	a, err := NewMemDepot()
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	b, err := NewMemDepot()
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	if err = a.Stow("secret", "hunter2", []byte("password")); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+
+	// b is empty, so it takes on a's salt
+	stats, err := a.Sync(b, nil)
+	if err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+	if stats.Pushed != 1 || stats.Pulled != 0 {
+		t.Errorf("expected 1 entry pushed and none pulled but got %+v", stats)
+	}
+	if val, err := b.Fetch("secret", []byte("password")); err != nil || val != "hunter2" {
+		t.Errorf("expected hunter2 in the other depot but got %q (%v)", val, err)
+	}
+
+	c, err := NewMemDepot()
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	if err = c.Stow("plain", "value", nil); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	if _, err = a.Sync(c, nil); !errors.Is(err, ErrSaltMismatch) {
+		t.Errorf("expected ErrSaltMismatch syncing unrelated depots but got %v", err)
+	}
+
+	if err = b.Stow("plain", "value", nil); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	if stats, err = a.Sync(b, nil); err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+	if stats.Pulled != 1 || stats.Pushed != 0 || stats.Conflicts != 0 {
+		t.Errorf("expected 1 entry pulled and nothing else but got %+v", stats)
+	}
+	if val, err := a.Fetch("plain", nil); err != nil || val != "value" {
+		t.Errorf("expected value in the local depot but got %q (%v)", val, err)
+	}
+
+	// Nothing has changed since
+	if stats, err = a.Sync(b, nil); err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+	if stats != (SyncStats{}) {
+		t.Errorf("expected nothing to be copied but got %+v", stats)
+	}
+
+	// Dropped keys stay dropped
+	if err = b.Drop("secret"); err != nil {
+		t.Fatalf("error dropping value: %v", err)
+	}
+	if _, err = a.Sync(b, nil); err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+	if _, err = a.Fetch("secret", []byte("password")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v for a key dropped from the other depot but got %v", ErrNotFound, err)
+	}
+}
+
+func TestSyncConflicts(t *testing.T) {
+	a, _ := NewMemDepot()
+	b, _ := NewMemDepot()
+	if _, err := a.Sync(b, nil); err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+
+	conflict := func() {
+		t.Helper()
+		old := &Entry{Key: "k", Val: "old", Modified: time.Unix(1000, 0)}
+		new := &Entry{Key: "k", Val: "new", Modified: time.Unix(2000, 0)}
+		if err := a.backend.Put(old); err != nil {
+			t.Fatalf("error putting entry: %v", err)
+		}
+		if err := b.backend.Put(new); err != nil {
+			t.Fatalf("error putting entry: %v", err)
+		}
+	}
+
+	conflict()
+	stats, err := a.Sync(b, nil)
+	if err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+	if stats.Conflicts != 1 {
+		t.Errorf("expected 1 conflict but got %+v", stats)
+	}
+	for _, d := range []*Depot{a, b} {
+		if val, _ := d.Fetch("k", nil); val != "new" {
+			t.Errorf("expected the newest value to win but got %v", val)
+		}
+	}
+
+	conflict()
+	if _, err = a.Sync(b, func(local, remote *Entry) (Resolution, error) {
+		return KeepLocal, nil
+	}); err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+	for _, d := range []*Depot{a, b} {
+		if val, _ := d.Fetch("k", nil); val != "old" {
+			t.Errorf("expected the local value to be kept but got %v", val)
+		}
+	}
+
+	conflict()
+	if _, err = a.Sync(b, func(local, remote *Entry) (Resolution, error) {
+		return KeepBoth, nil
+	}); err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+	copied := ConflictKey(&Entry{Key: "k", Modified: time.Unix(1000, 0)})
+	for _, d := range []*Depot{a, b} {
+		if val, _ := d.Fetch("k", nil); val != "new" {
+			t.Errorf("expected the newest value under the key but got %v", val)
+		}
+		if val, _ := d.Fetch(copied, nil); val != "old" {
+			t.Errorf("expected the older value under %v but got %v", copied, val)
+		}
+	}
+
+	conflict()
+	abort := errors.New("abort")
+	if _, err = a.Sync(b, func(local, remote *Entry) (Resolution, error) {
+		return KeepLocal, abort
+	}); !errors.Is(err, abort) {
+		t.Errorf("expected the sync to be aborted but got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package libdepot
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// The test vectors from RFC 6238
+	secrets := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	vectors := []struct {
+		unix      int64
+		algorithm string
+		code      string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111111, "SHA256", "67062674"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{20000000000, "SHA256", "77737706"},
+	}
+
+	for _, v := range vectors {
+		secret := base32.StdEncoding.EncodeToString([]byte(secrets[v.algorithm]))
+		totp, err := ParseTOTP("otpauth://totp/Example:alice?secret=" + secret +
+			"&digits=8&algorithm=" + v.algorithm)
+		if err != nil {
+			t.Fatalf("error parsing otpauth URI: %v", err)
+		}
+		code, _ := totp.Code(time.Unix(v.unix, 0))
+		if code != v.code {
+			t.Errorf("expected %v at %v with %v but got %v", v.code, v.unix, v.algorithm, code)
+		}
+	}
+
+	// A bare secret, written the way sites tend to show it
+	totp, err := ParseTOTP("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	if err != nil {
+		t.Fatalf("error parsing bare secret: %v", err)
+	}
+	code, remaining := totp.Code(time.Unix(1111111109, 0))
+	if code != "081804" || remaining != 1*time.Second {
+		t.Errorf("expected 081804 for 1s but got %v for %v", code, remaining)
+	}
+
+	for _, bad := range []string{
+		"not base32!",
+		"otpauth://hotp/Example?secret=GEZDGNBV",
+		"otpauth://totp/Example?secret=GEZDGNBV&algorithm=MD5",
+		"otpauth://totp/Example?secret=GEZDGNBV&digits=3",
+	} {
+		if _, err = ParseTOTP(bad); err == nil {
+			t.Errorf("expected an error parsing %v", bad)
+		}
+	}
+}
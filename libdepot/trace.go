@@ -0,0 +1,101 @@
+package libdepot
+
+import "context"
+
+// Traces what is done with a depot, as with the adapter for OpenTelemetry in
+// the depototel package. Start begins a span for an operation on key (or a
+// prefix or metadata name, or "" for none) as a child of any span in ctx, and
+// returns the context of the new span and a function that ends it, recording
+// the error the operation failed with unless it is nil.
+type Tracer interface {
+	Start(ctx context.Context, name, key string) (context.Context, func(err error))
+}
+
+// Returns an Option that traces every stow, fetch, and drop, and the backend
+// calls each of them makes, with t. Spans are children of the context given
+// with WithContext.
+func WithTracer(t Tracer) Option {
+	return func(db *Depot) {
+		db.tracer = t
+	}
+}
+
+// Returns a copy of the depot whose operations are traced (see WithTracer)
+// as children of any span in ctx
+func (db *Depot) WithContext(ctx context.Context) *Depot {
+	c := *db
+	c.ctx = ctx
+	return &c
+}
+
+// Begins a span named name for an operation on key, returning a copy of the
+// depot whose backend calls are traced within it and a function that ends
+// it. Without a tracer, returns the depot itself and a function that does
+// nothing.
+func (db *Depot) trace(name, key string) (*Depot, func(err error)) {
+	if db.tracer == nil {
+		return db, func(error) {}
+	}
+
+	ctx := db.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, end := db.tracer.Start(ctx, "depot."+name, key)
+	c := *db
+	c.ctx = ctx
+	c.backend = &tracedBackend{db.backend, db.tracer, ctx}
+
+	return &c, end
+}
+
+// A Backend whose calls are traced as children of the span in ctx
+type tracedBackend struct {
+	Backend
+	tracer Tracer
+	ctx    context.Context
+}
+
+// Calls fn within a span for the backend call called name on key
+func (b *tracedBackend) span(name, key string, fn func() error) error {
+	_, end := b.tracer.Start(b.ctx, "depot.backend."+name, key)
+	err := fn()
+	end(err)
+	return err
+}
+
+func (b *tracedBackend) Get(key string) (e *Entry, err error) {
+	err = b.span("Get", key, func() error {
+		e, err = b.Backend.Get(key)
+		return err
+	})
+	return e, err
+}
+
+func (b *tracedBackend) Put(e *Entry) error {
+	return b.span("Put", e.Key, func() error { return b.Backend.Put(e) })
+}
+
+func (b *tracedBackend) Delete(key string) error {
+	return b.span("Delete", key, func() error { return b.Backend.Delete(key) })
+}
+
+func (b *tracedBackend) List(prefix string) (entries []*Entry, err error) {
+	err = b.span("List", prefix, func() error {
+		entries, err = b.Backend.List(prefix)
+		return err
+	})
+	return entries, err
+}
+
+func (b *tracedBackend) Meta(name string) (data []byte, err error) {
+	err = b.span("Meta", name, func() error {
+		data, err = b.Backend.Meta(name)
+		return err
+	})
+	return data, err
+}
+
+func (b *tracedBackend) SetMeta(name string, data []byte) error {
+	return b.span("SetMeta", name, func() error { return b.Backend.SetMeta(name, data) })
+}
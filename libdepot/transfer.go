@@ -0,0 +1,93 @@
+package libdepot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Copies the entries whose keys match any of patterns (see matchKey) to the
+// depot dst, or moves them if move is true, dropping them here once dst holds
+// them. Plain values, and encrypted ones when both depots share a salt, are
+// copied as they are. Other encrypted values are decrypted with password and
+// encrypted again under the salt of dst, so a non-nil password must be
+// supplied for them. Existing keys in dst are only replaced if overwrite is
+// true, and otherwise ErrExists is returned before anything is copied.
+// Returns the number of entries transferred or an error if unsuccessful.
+func (db *Depot) Transfer(dst *Depot, patterns []string, password []byte, move, overwrite bool) (int, error) {
+	if db == dst {
+		return 0, errors.New("depot is both source and destination")
+	}
+
+	matched := map[string]*Entry{}
+	for _, pattern := range patterns {
+		entries, err := db.matching(pattern)
+		if err != nil {
+			return 0, err
+		}
+		if len(entries) == 0 {
+			return 0, fmt.Errorf("%v: %w", pattern, ErrNotFound)
+		}
+		for _, e := range entries {
+			matched[e.Key] = e
+		}
+	}
+	keys := make([]string, 0, len(matched))
+	for key := range matched {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	deriver := dst.keyDeriver(password)
+	entries := make([]*Entry, len(keys))
+	for i, key := range keys {
+		e := matched[key]
+		if !overwrite {
+			existing, err := dst.backend.Get(key)
+			if err == nil && !existing.Deleted {
+				return 0, fmt.Errorf("%v: %w", key, ErrExists)
+			} else if err != nil && !errors.Is(err, ErrNotFound) {
+				return 0, fmt.Errorf("%w: %w", ErrDatabase, err)
+			}
+		}
+
+		// An entry that carries its own salt can be decrypted anywhere
+		if e.Nonce == nil || e.Salt != nil || bytes.Equal(db.salt, dst.salt) {
+			c := *e
+			if bytes.Equal(c.Salt, dst.salt) {
+				c.Salt = nil
+			}
+			entries[i] = &c
+			continue
+		} else if password == nil {
+			return 0, fmt.Errorf("%v: %w", key, ErrPasswordNeeded)
+		}
+
+		val, err := db.Fetch(key, password)
+		if err != nil {
+			return 0, err
+		}
+		encryptionKey, salt, err := deriver.derive(key)
+		if err != nil {
+			return 0, err
+		}
+		if entries[i], err = dst.newEntry(key, val, encryptionKey, salt); err != nil {
+			return 0, err
+		}
+		entries[i].Modified = e.Modified
+	}
+
+	if err := dst.putAll(entries); err != nil {
+		return 0, err
+	}
+	if move {
+		for _, key := range keys {
+			if err := db.Drop(key); err != nil {
+				return 0, fmt.Errorf("%v was copied but not dropped: %w", key, err)
+			}
+		}
+	}
+
+	return len(entries), nil
+}
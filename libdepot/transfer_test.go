@@ -0,0 +1,57 @@
+package libdepot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTransfer(t *testing.T) {
+	password := []byte("password")
+	src, _ := NewMemDepot()
+	dst, _ := NewMemDepot()
+	src.Stow("work/plain", "plain", nil)
+	src.Stow("work/secret", "secret", password)
+	src.Stow("home/secret", "home", password)
+	dst.Stow("work/plain", "taken", nil)
+
+	if _, err := src.Transfer(dst, []string{"work/*"}, nil, false, true); !errors.Is(err, ErrPasswordNeeded) {
+		t.Errorf("expected %v transferring a secret between salts but got %v", ErrPasswordNeeded, err)
+	}
+	if _, err := src.Transfer(dst, []string{"work/*"}, password, false, false); !errors.Is(err, ErrExists) {
+		t.Errorf("expected %v transferring onto an existing key but got %v", ErrExists, err)
+	}
+	if _, err := src.Transfer(dst, []string{"missing"}, password, false, false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v transferring a missing key but got %v", ErrNotFound, err)
+	}
+	if val, _ := dst.Fetch("work/plain", nil); val != "taken" {
+		t.Errorf("expected a failed transfer to change nothing but work/plain is %q", val)
+	}
+
+	n, err := src.Transfer(dst, []string{"work/*"}, password, true, true)
+	if err != nil || n != 2 {
+		t.Fatalf("expected to move 2 keys but moved %v (%v)", n, err)
+	}
+	if val, err := dst.Fetch("work/secret", password); err != nil || val != "secret" {
+		t.Errorf("expected work/secret to decrypt to secret in the destination but got %q (%v)", val, err)
+	}
+	if val, err := dst.Fetch("work/plain", nil); err != nil || val != "plain" {
+		t.Errorf("expected work/plain to be replaced with plain but got %q (%v)", val, err)
+	}
+	if _, err := src.Fetch("work/secret", password); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v fetching a moved key but got %v", ErrNotFound, err)
+	}
+
+	// A depot that shares the salt gets the entry as it is, without a password
+	if err = dst.adoptSalt(src.salt); err != nil {
+		t.Fatalf("error setting salt: %v", err)
+	}
+	if _, err = src.Transfer(dst, []string{"home/secret"}, nil, false, false); err != nil {
+		t.Fatalf("error copying a secret between depots sharing a salt: %v", err)
+	}
+	if val, err := dst.Fetch("home/secret", password); err != nil || val != "home" {
+		t.Errorf("expected home/secret to decrypt to home in the destination but got %q (%v)", val, err)
+	}
+	if val, err := src.Fetch("home/secret", password); err != nil || val != "home" {
+		t.Errorf("expected a copied key to be left alone but got %q (%v)", val, err)
+	}
+}
@@ -0,0 +1,120 @@
+package libdepot
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"time"
+)
+
+// How long the value of a dropped key is kept in the trash, from which it can
+// be restored, before only its tombstone is left
+const TrashLifetime = 30 * 24 * time.Hour
+
+// Reports whether the entry is the tombstone of a key whose value is still in
+// the trash
+func trashed(e *Entry) bool {
+	return e.Deleted && (e.Val != "" || e.Nonce != nil)
+}
+
+// Returns the dropped keys matching pattern (see matchKey) whose values are
+// still in the trash, sorted by key, or an error if unsuccessful. The
+// Modified time of each is when it was dropped.
+func (db *Depot) Trash(pattern string) ([]KeyInfo, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	entries, err := db.backend.List("")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	keys := []KeyInfo{}
+	for _, e := range entries {
+		if trashed(e) && matchKey(pattern, e.Key) {
+			keys = append(keys, keyInfo(e))
+		}
+	}
+
+	return keys, nil
+}
+
+// Brings the dropped key back from the trash with the value it had. Returns
+// ErrNotFound if its value is not in the trash, or ErrExists if the key was
+// stowed again since, or another error if unsuccessful.
+func (db *Depot) Undrop(key string) error {
+	return db.audit(AuditStow, key, db.locked(func() error { return db.undrop(key) }))
+}
+
+func (db *Depot) undrop(key string) error {
+	key = db.normalizeKey(key)
+	entry, err := db.backend.Get(key)
+	if errors.Is(err, ErrNotFound) || (err == nil && entry.Deleted && !trashed(entry)) {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	if !entry.Deleted {
+		return ErrExists
+	}
+
+	entry.Deleted = false
+	entry.Modified = db.now()
+	if err = db.backend.Put(entry); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	return nil
+}
+
+// Removes the values of the dropped keys matching pattern (see matchKey) from
+// the trash for good, leaving only their tombstones. Returns the number of
+// values removed or an error if unsuccessful.
+func (db *Depot) EmptyTrash(pattern string) (emptied int, err error) {
+	err = db.locked(func() error {
+		emptied, err = db.emptyTrash(pattern)
+		return err
+	})
+
+	return emptied, err
+}
+
+func (db *Depot) emptyTrash(pattern string) (int, error) {
+	keys, err := db.Trash(pattern)
+	if err != nil {
+		return 0, err
+	}
+
+	// Mark each tombstone as modified now, so that syncing passes the empty
+	// one on rather than bringing the value back
+	now := db.now()
+	for i, k := range keys {
+		tombstone := Entry{Key: k.Key, Modified: now, Deleted: true}
+		if err = db.backend.Put(&tombstone); err != nil {
+			return i, fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+	}
+
+	return len(keys), nil
+}
+
+// Removes from the trash the values of keys dropped before the given time.
+// Returns an error if unsuccessful.
+func (db *Depot) expireTrash(before time.Time) error {
+	entries, err := db.backend.List("")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	for _, e := range entries {
+		if !trashed(e) || !e.Modified.Before(before) {
+			continue
+		}
+		tombstone := Entry{Key: e.Key, Modified: e.Modified, Deleted: true}
+		if err = db.backend.Put(&tombstone); err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package libdepot
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	password := []byte("password")
+	d, _ := NewMemDepot()
+	d.Stow("trash/plain", "plain", nil)
+	d.Stow("trash/secret", "secret", password)
+	d.Stow("kept", "kept", nil)
+	for _, key := range []string{"trash/plain", "trash/secret"} {
+		if err := d.Drop(key); err != nil {
+			t.Fatalf("error dropping %v: %v", key, err)
+		}
+	}
+
+	keys, err := d.Trash("")
+	if err != nil || len(keys) != 2 || keys[0].Key != "trash/plain" || !keys[1].Encrypted {
+		t.Fatalf("expected both dropped keys in the trash but got %+v (%v)", keys, err)
+	}
+	if keys, _ = d.Trash("trash/s*"); len(keys) != 1 {
+		t.Errorf("expected 1 key in the trash matching trash/s* but got %v", len(keys))
+	}
+
+	if err = d.Undrop("trash/secret"); err != nil {
+		t.Fatalf("error restoring trash/secret: %v", err)
+	}
+	if val, err := d.Fetch("trash/secret", password); err != nil || val != "secret" {
+		t.Errorf("expected a restored secret to decrypt to secret but got %q (%v)", val, err)
+	}
+	if err = d.Undrop("trash/secret"); !errors.Is(err, ErrExists) {
+		t.Errorf("expected %v restoring a key that exists but got %v", ErrExists, err)
+	}
+	if err = d.Undrop("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v restoring a key never dropped but got %v", ErrNotFound, err)
+	}
+
+	if n, err := d.EmptyTrash(""); err != nil || n != 1 {
+		t.Errorf("expected to empty 1 value from the trash but emptied %v (%v)", n, err)
+	}
+	if err = d.Undrop("trash/plain"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v restoring a key after emptying the trash but got %v", ErrNotFound, err)
+	}
+	if e, err := d.backend.Get("trash/plain"); err != nil || !e.Deleted {
+		t.Errorf("expected emptying the trash to leave a tombstone but got %+v (%v)", e, err)
+	}
+
+	// Values dropped longer ago than TrashLifetime leave the trash by
+	// themselves
+	d.Drop("kept")
+	old := Entry{Key: "old", Val: "old", Modified: time.Now().Add(-TrashLifetime - time.Hour), Deleted: true}
+	d.backend.Put(&old)
+	if err = d.expireTrash(time.Now().Add(-TrashLifetime)); err != nil {
+		t.Fatalf("error expiring the trash: %v", err)
+	}
+	if keys, _ = d.Trash(""); len(keys) != 1 || keys[0].Key != "kept" {
+		t.Errorf("expected only kept to be left in the trash but got %+v", keys)
+	}
+}
@@ -0,0 +1,35 @@
+package libdepot
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Stores v under key as JSON, as Stow would store a value, encrypted with
+// password if it is not nil. Returns an error if v cannot be marshaled or
+// the value cannot be stowed.
+func StowJSON[T any](d *Depot, key string, v T, password []byte) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return d.opError(AuditStow, key, fmt.Errorf("cannot marshal value: %w", err))
+	}
+
+	return d.Stow(key, string(data), password)
+}
+
+// Returns the value stored under key by StowJSON, or any JSON value stowed
+// under it, unmarshaled into a T, decrypted with password if it is
+// encrypted. Returns an error if unsuccessful, including ErrCorrupted
+// wrapping the error from unmarshaling if the value does not hold a T.
+func FetchJSON[T any](d *Depot, key string, password []byte) (T, error) {
+	var v T
+	val, err := d.Fetch(key, password)
+	if err != nil {
+		return v, err
+	}
+	if err = json.Unmarshal([]byte(val), &v); err != nil {
+		return v, d.opError(AuditFetch, key, fmt.Errorf("cannot unmarshal value: %w: %w", ErrCorrupted, err))
+	}
+
+	return v, nil
+}
@@ -0,0 +1,42 @@
+package libdepot
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJSON(t *testing.T) {
+	type token struct {
+		Access  string    `json:"access"`
+		Refresh string    `json:"refresh"`
+		Expires time.Time `json:"expires"`
+	}
+	mdb, _ := NewMemDepot()
+	password := []byte("correct horse battery staple")
+
+	want := token{"abc", "def", time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)}
+	if err := StowJSON(mdb, "oauth/token", want, password); err != nil {
+		t.Fatalf("error stowing JSON: %v", err)
+	}
+	got, err := FetchJSON[token](mdb, "oauth/token", password)
+	if err != nil || got != want {
+		t.Errorf("expected %+v but got %+v (%v)", want, got, err)
+	}
+	if _, err = FetchJSON[token](mdb, "oauth/token", nil); !errors.Is(err, ErrPasswordNeeded) {
+		t.Errorf("expected %v fetching without a password but got %v", ErrPasswordNeeded, err)
+	}
+
+	mdb.Stow("plain", "not JSON", nil)
+	if _, err = FetchJSON[token](mdb, "plain", nil); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected %v fetching a value that isn't JSON but got %v", ErrCorrupted, err)
+	}
+	if err = StowJSON(mdb, "bad", make(chan int), nil); err == nil {
+		t.Errorf("expected an error stowing a value that cannot be marshaled")
+	}
+
+	counts, err := FetchJSON[map[string]int](mdb, "missing", nil)
+	if !errors.Is(err, ErrNotFound) || counts != nil {
+		t.Errorf("expected %v and no value fetching a missing key but got %v (%v)", ErrNotFound, counts, err)
+	}
+}
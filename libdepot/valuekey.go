@@ -0,0 +1,112 @@
+package libdepot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Begins the HKDF info of the key of every value with a salt of its own (see
+// ValueKey), so that it is never the same as a key derived for anything else
+const valueKeyLabel = "depot value key"
+
+// How the key derived from the password is stretched again for values with
+// salts of their own: Argon2id, with the parameters RFC 9106 recommends where
+// memory is constrained. It is a variable so that tests can make it cheap.
+var stretchParams = struct {
+	time, memory uint32
+	threads      uint8
+}{3, 64 * 1024, 4}
+
+// Returns the key that a value with a salt of its own, keySalt (see
+// Entry.KeySalt), is sealed with, given encryptionKey, the key the password
+// derives with salt (see Salt). encryptionKey is stretched again with Argon2id,
+// so that guessing the password costs far more than it does for values
+// stowed before, and then expanded with HKDF for keySalt, so that no two
+// values share a key. With it, a value fetched with FetchSealed can be opened
+// outside of the depot.
+func ValueKey(encryptionKey, salt, keySalt []byte) []byte {
+	return expandValueKey(stretchKey(encryptionKey, salt), keySalt)
+}
+
+func stretchKey(encryptionKey, salt []byte) []byte {
+	p := stretchParams
+	return argon2.IDKey(encryptionKey, salt, p.time, p.memory, p.threads, 32)
+}
+
+func expandValueKey(stretched, keySalt []byte) []byte {
+	key := make([]byte, 32)
+	// HKDF gives up to 255 times as much as this, so reading it cannot fail
+	io.ReadFull(hkdf.New(sha256.New, stretched, keySalt, []byte(valueKeyLabel)), key)
+
+	return key
+}
+
+// Returns the key that a value with a salt of its own is sealed with, as
+// ValueKey does, given encryptionKey, the key the password derives with salt,
+// or the depot's own salt if it is nil
+func (db *Depot) valueKey(encryptionKey, salt, keySalt []byte) []byte {
+	if salt == nil {
+		salt = db.salt
+	}
+
+	return expandValueKey(db.stretched.get(encryptionKey, salt), keySalt)
+}
+
+// Returns the key that the value of e is sealed with, derived from password
+func (db *Depot) entryKey(e *Entry, password []byte) []byte {
+	encryptionKey := db.deriveKey(password, e.Salt)
+	if e.KeySalt == nil {
+		return encryptionKey
+	}
+
+	return db.valueKey(encryptionKey, e.Salt, e.KeySalt)
+}
+
+// Returns the data that the value of e is bound to as it is sealed, so that
+// it cannot be opened once its salt or compression has been changed: nothing
+// for a value stowed before values had salts of their own, and otherwise its
+// salt followed by its compression. Only AES-GCM (see AESGCM) binds it as
+// additional data, but for every sealer the salt goes into the key.
+func entryAAD(e *Entry) []byte {
+	if e.KeySalt == nil {
+		return nil
+	}
+
+	return append(bytes.Clone(e.KeySalt), e.Compression...)
+}
+
+// Keeps the key that one key derived from a password was last stretched to
+// (see stretchKey), since stretching is slow by design and a depot usually
+// sees the same password over and over
+type stretchCache struct {
+	mu  sync.Mutex
+	id  [sha256.Size]byte
+	key []byte
+}
+
+// Returns encryptionKey stretched with salt, from the cache if it was the last
+// one stretched. A nil cache stretches every time.
+func (c *stretchCache) get(encryptionKey, salt []byte) []byte {
+	if c == nil {
+		return stretchKey(encryptionKey, salt)
+	}
+
+	h := sha256.New()
+	h.Write(encryptionKey)
+	h.Write(salt)
+	var id [sha256.Size]byte
+	h.Sum(id[:0])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.key == nil || c.id != id {
+		c.id, c.key = id, stretchKey(encryptionKey, salt)
+	}
+
+	return c.key
+}
@@ -0,0 +1,465 @@
+package libdepot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The field of a Vault secret whose value is kept under the secret's own path
+// rather than under a key for the field
+const VaultValueField = "value"
+
+// The prefix of the depot metadata that the time of the last sync with each
+// Vault path is kept in (see syncedMeta)
+const vaultSyncedMeta = "vault-synced:"
+
+// A client of the KV version 2 secrets engine of a HashiCorp Vault server
+type Vault struct {
+	addr      string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+// A secret as it is read from Vault
+type vaultSecret struct {
+	// The value of each field as a string, and as it was read
+	fields  map[string]string
+	raw     map[string]any
+	version int
+	created time.Time
+}
+
+// Returns a client of the Vault server at addr, authenticating with token and
+// working in namespace if it is not empty, or an error if addr is invalid
+func NewVault(addr, token, namespace string) (*Vault, error) {
+	u, err := url.Parse(addr)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid vault address: %v", addr)
+	}
+
+	return &Vault{
+		addr:      strings.TrimSuffix(addr, "/"),
+		token:     token,
+		namespace: namespace,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Sends a request to the server and decodes the JSON body of a successful
+// response into out if it is not nil. A 404 is reported as ErrNotFound.
+func (v *Vault) do(method, path string, body, out any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, v.addr+"/v1/"+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode >= 300:
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		msg := resp.Status
+		if json.Unmarshal(data, &e) == nil && len(e.Errors) > 0 {
+			msg = strings.Join(e.Errors, "; ")
+		}
+		return errors.New("vault: " + msg)
+	case out == nil || len(data) == 0:
+		return nil
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+// Returns the paths of every secret beneath dir in the engine mounted at
+// mount, or an error if unsuccessful
+func (v *Vault) list(mount, dir string) ([]string, error) {
+	var resp struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	err := v.do("LIST", mount+"/metadata/"+escapePath(dir), nil, &resp)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, k := range resp.Data.Keys {
+		if !strings.HasSuffix(k, "/") {
+			paths = append(paths, dir+"/"+k)
+			continue
+		}
+		sub, err := v.list(mount, dir+"/"+strings.TrimSuffix(k, "/"))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, sub...)
+	}
+
+	return paths, nil
+}
+
+// Returns the latest version of the secret at path in the engine mounted at
+// mount, ErrNotFound if it has none or it was deleted, or another error if
+// unsuccessful
+func (v *Vault) read(mount, path string) (*vaultSecret, error) {
+	var resp struct {
+		Data struct {
+			Data     map[string]any `json:"data"`
+			Metadata struct {
+				CreatedTime time.Time `json:"created_time"`
+				Version     int       `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}
+	if err := v.do(http.MethodGet, mount+"/data/"+escapePath(path), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data.Data == nil {
+		return nil, ErrNotFound
+	}
+
+	secret := &vaultSecret{
+		fields:  map[string]string{},
+		raw:     resp.Data.Data,
+		version: resp.Data.Metadata.Version,
+		created: resp.Data.Metadata.CreatedTime,
+	}
+	for name, val := range resp.Data.Data {
+		switch val := val.(type) {
+		case string:
+			secret.fields[name] = val
+		default:
+			// Values that aren't strings are kept as the JSON they were
+			// written as
+			data, err := json.Marshal(val)
+			if err != nil {
+				return nil, err
+			}
+			secret.fields[name] = string(data)
+		}
+	}
+
+	return secret, nil
+}
+
+// Writes fields as a new version of the secret at path in the engine mounted
+// at mount, only if its latest version is still version (0 for a secret that
+// does not exist yet), or deletes the latest version if fields is empty.
+// Returns an error if unsuccessful.
+func (v *Vault) write(mount, path string, fields map[string]any, version int) error {
+	if len(fields) == 0 {
+		return v.do(http.MethodDelete, mount+"/data/"+escapePath(path), nil, nil)
+	}
+
+	body := map[string]any{
+		"data":    fields,
+		"options": map[string]int{"cas": version},
+	}
+	return v.do(http.MethodPost, mount+"/data/"+escapePath(path), body, nil)
+}
+
+// Escapes each part of a slash-separated path for use in a URL
+func escapePath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// Where a key of the depot is kept in Vault
+type vaultField struct {
+	secret string
+	field  string
+}
+
+// Returns the metadata under which the time of the last sync with the Vault
+// path is kept
+func (v *Vault) syncedMeta(mount, dir string) string {
+	return vaultSyncedMeta + v.addr + "/" + mount + "/" + dir
+}
+
+// Merges the keys under dir in the depot with the secrets under dir in the
+// KV version 2 engine mounted at mount in Vault. Each field of a secret is
+// kept under the secret's path followed by the name of the field, except
+// VaultValueField, which is kept under the secret's path itself. A key that
+// is new to Vault is pushed as a field of the secret at its parent path if
+// there is one, or as VaultValueField of a new secret at its own path. Values
+// pulled from Vault are encrypted with password unless it is nil or the key
+// already holds a plaintext value.
+//
+// A key whose value differs from its secret's is pulled if only the secret
+// was written since the last sync with Vault, pushed if only the key was
+// stowed since then, and otherwise settled by resolve (NewestWins if it is
+// nil), given an entry for the secret that holds its plaintext value and the
+// time it was written. When both are kept, the older value is kept under a
+// conflict key (see ConflictKey) in the depot only, and conflict keys are
+// left out of the sync. Keys dropped from the depot are deleted from their
+// secrets, and secrets deleted from Vault are dropped from the depot, in the
+// same way. Secrets are written with check-and-set, so one written by someone
+// else during the sync fails it rather than being overwritten. Returns what
+// was copied or an error if unsuccessful.
+func (db *Depot) SyncVault(v *Vault, mount, dir string, password []byte, resolve ConflictFunc) (SyncStats, error) {
+	var stats SyncStats
+	if resolve == nil {
+		resolve = NewestWins
+	}
+	dir = strings.Trim(dir, "/")
+	if mount == "" || dir == "" {
+		return stats, fmt.Errorf("vault path must be a directory beneath a mount: %v/%v", mount, dir)
+	}
+
+	var last time.Time
+	data, err := db.backend.Meta(v.syncedMeta(mount, dir))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return stats, fmt.Errorf("%w: %w", ErrDatabase, err)
+	} else if err == nil {
+		if err = last.UnmarshalText(data); err != nil {
+			return stats, fmt.Errorf("cannot read time of last sync: %w", ErrCorrupted)
+		}
+	}
+
+	paths, err := v.list(mount, dir)
+	if err != nil {
+		return stats, err
+	}
+	secrets := map[string]*vaultSecret{}
+	remote := map[string]*Entry{}
+	where := map[string]vaultField{}
+	for _, path := range paths {
+		secret, err := v.read(mount, path)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return stats, err
+		}
+		secrets[path] = secret
+		for name, val := range secret.fields {
+			key := path + "/" + name
+			if name == VaultValueField {
+				key = path
+			}
+			remote[key] = &Entry{Key: key, Val: val, Modified: secret.created}
+			where[key] = vaultField{path, name}
+		}
+	}
+
+	entries, err := db.backend.List(dir + "/")
+	if err != nil {
+		return stats, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	local := map[string]*Entry{}
+	keys := []string{}
+	for _, e := range entries {
+		// Conflicted copies are left in the depot alone
+		if isConflictKey(e.Key) {
+			continue
+		}
+		local[e.Key] = e
+		keys = append(keys, e.Key)
+	}
+	for key := range remote {
+		if local[key] == nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	// Changes to secrets are gathered up so each is written once
+	changed := map[string]map[string]any{}
+	push := func(key string, val *string) {
+		loc, ok := where[key]
+		if !ok {
+			loc = vaultField{key, VaultValueField}
+			if _, exists := secrets[key]; !exists {
+				if i := strings.LastIndex(key, "/"); i > 0 && secrets[key[:i]] != nil {
+					loc = vaultField{key[:i], key[i+1:]}
+				}
+			}
+		}
+		fields, ok := changed[loc.secret]
+		if !ok {
+			fields = map[string]any{}
+			if s := secrets[loc.secret]; s != nil {
+				for name, val := range s.raw {
+					fields[name] = val
+				}
+			}
+			changed[loc.secret] = fields
+		}
+		if val == nil {
+			delete(fields, loc.field)
+		} else {
+			fields[loc.field] = *val
+		}
+		stats.Pushed++
+	}
+	deriver := db.keyDeriver(password)
+	pull := func(r *Entry, l *Entry) error {
+		stats.Pulled++
+		if r.Deleted {
+			return db.drop(r.Key)
+		}
+		var encryptionKey, salt []byte
+		if password != nil && (l == nil || l.Deleted || l.Nonce != nil) {
+			var err error
+			if encryptionKey, salt, err = deriver.derive(r.Key); err != nil {
+				return err
+			}
+		}
+		e, err := db.newEntry(r.Key, r.Val, encryptionKey, salt)
+		if err != nil {
+			return err
+		}
+		e.Modified = r.Modified
+		if err = db.backend.Put(e); err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+		return nil
+	}
+
+	for _, key := range keys {
+		l, r := local[key], remote[key]
+		var val string
+		if l != nil && !l.Deleted {
+			if val, err = db.fetchEntry(l, password); err != nil {
+				return stats, fmt.Errorf("%v: %w", key, err)
+			}
+		}
+
+		switch {
+		case r == nil && l.Deleted:
+			continue
+		case r == nil && (last.IsZero() || l.Modified.After(last)):
+			push(key, &val)
+			continue
+		case r == nil:
+			// The secret was deleted from Vault since the last sync
+			err = pull(&Entry{Key: key, Deleted: true}, l)
+		case l == nil && (last.IsZero() || r.Modified.After(last)):
+			err = pull(r, l)
+		case l == nil:
+			// The key was dropped and its tombstone purged since the last
+			// sync
+			push(key, nil)
+			continue
+		case !l.Deleted && val == r.Val:
+			continue
+		case !r.Modified.After(last) && l.Modified.After(last):
+			if l.Deleted {
+				push(key, nil)
+			} else {
+				push(key, &val)
+			}
+			continue
+		case !l.Modified.After(last) && r.Modified.After(last):
+			err = pull(r, l)
+		default:
+			stats.Conflicts++
+			var res Resolution
+			if res, err = resolve(l, r); err != nil {
+				return stats, err
+			}
+
+			switch res {
+			case KeepLocal:
+				if l.Deleted {
+					push(key, nil)
+				} else {
+					push(key, &val)
+				}
+			case KeepRemote:
+				err = pull(r, l)
+			case KeepBoth:
+				if l.Deleted {
+					err = pull(r, l)
+					break
+				}
+				older := &Entry{Key: ConflictKey(r), Val: r.Val, Modified: r.Modified}
+				if l.Modified.Before(r.Modified) {
+					older = &Entry{Key: ConflictKey(l), Val: val, Modified: l.Modified}
+					err = pull(r, l)
+				} else {
+					push(key, &val)
+				}
+				if err == nil {
+					err = pull(older, nil)
+					stats.Pulled--
+				}
+			default:
+				err = fmt.Errorf("unknown resolution: %v", res)
+			}
+		}
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	for path, fields := range changed {
+		version := 0
+		if s := secrets[path]; s != nil {
+			version = s.version
+		} else if len(fields) == 0 {
+			continue
+		}
+		if err = v.write(mount, path, fields, version); err != nil {
+			return stats, fmt.Errorf("%v: %w", path, err)
+		}
+	}
+
+	data, err = time.Now().MarshalText()
+	if err != nil {
+		return stats, err
+	}
+	if err = db.backend.SetMeta(v.syncedMeta(mount, dir), data); err != nil {
+		return stats, fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+	db.log().Info("synced with vault", slog.String("path", mount+"/"+dir),
+		slog.Int("pulled", stats.Pulled), slog.Int("pushed", stats.Pushed),
+		slog.Int("conflicts", stats.Conflicts))
+
+	return stats, nil
+}
@@ -0,0 +1,260 @@
+package libdepot
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A version of a secret kept by fakeVault
+type fakeVersion struct {
+	data    map[string]any
+	created time.Time
+	deleted bool
+}
+
+// Serves the parts of the KV version 2 API of Vault that SyncVault uses, for
+// an engine mounted at secret
+type fakeVault struct {
+	mu      sync.Mutex
+	secrets map[string][]fakeVersion
+}
+
+func (f *fakeVault) put(path string, data map[string]any) {
+	f.secrets[path] = append(f.secrets[path], fakeVersion{data: data, created: time.Now()})
+}
+
+func (f *fakeVault) latest(path string) map[string]any {
+	versions := f.secrets[path]
+	if len(versions) == 0 || versions[len(versions)-1].deleted {
+		return nil
+	}
+
+	return versions[len(versions)-1].data
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("X-Vault-Token") != "token" {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+	kind, path, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/secret/"), "/")
+	switch {
+	case kind == "metadata" && r.Method == "LIST":
+		seen := map[string]bool{}
+		keys := []string{}
+		for p := range f.secrets {
+			rest, ok := strings.CutPrefix(p, path+"/")
+			if !ok {
+				continue
+			}
+			if dir, _, ok := strings.Cut(rest, "/"); ok {
+				rest = dir + "/"
+			}
+			if !seen[rest] {
+				seen[rest] = true
+				keys = append(keys, rest)
+			}
+		}
+		if len(keys) == 0 {
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+			return
+		}
+		sort.Strings(keys)
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"keys": keys}})
+	case kind == "data" && r.Method == http.MethodGet:
+		data := f.latest(path)
+		if data == nil {
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+			return
+		}
+		versions := f.secrets[path]
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"data": data,
+			"metadata": map[string]any{
+				"created_time": versions[len(versions)-1].created,
+				"version":      len(versions),
+			},
+		}})
+	case kind == "data" && r.Method == http.MethodPost:
+		var body struct {
+			Data    map[string]any `json:"data"`
+			Options struct {
+				CAS int `json:"cas"`
+			} `json:"options"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, `{"errors":["bad request"]}`, http.StatusBadRequest)
+			return
+		}
+		if body.Options.CAS != len(f.secrets[path]) {
+			http.Error(w, `{"errors":["check-and-set parameter did not match the current version"]}`, http.StatusBadRequest)
+			return
+		}
+		f.put(path, body.Data)
+	case kind == "data" && r.Method == http.MethodDelete:
+		if versions := f.secrets[path]; len(versions) > 0 {
+			versions[len(versions)-1].deleted = true
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, `{"errors":["unsupported path"]}`, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestSyncVault(t *testing.T) {
+	fake := &fakeVault{secrets: map[string][]fakeVersion{}}
+	fake.put("team/app/db", map[string]any{"username": "admin", "password": "hunter2", "port": 5432.0})
+	fake.put("team/app/token", map[string]any{"value": "abc"})
+	fake.put("team/other/key", map[string]any{"value": "elsewhere"})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	v, err := NewVault(server.URL, "token", "")
+	if err != nil {
+		t.Fatalf("failed to create vault client: %v", err)
+	}
+	db, err := NewMemDepot()
+	if err != nil {
+		t.Fatalf("failed to initialize depot: %v", err)
+	}
+	password := []byte("password")
+	if err = db.Stow("team/app/mine", "override", password); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	if err = db.Stow("personal", "private", nil); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+
+	stats, err := db.SyncVault(v, "secret", "team/app", password, nil)
+	if err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+	if stats != (SyncStats{Pulled: 4, Pushed: 1}) {
+		t.Errorf("expected 4 keys pulled and 1 pushed but got %+v", stats)
+	}
+	for key, want := range map[string]string{
+		"team/app/db/username": "admin",
+		"team/app/db/password": "hunter2",
+		"team/app/db/port":     "5432",
+		"team/app/token":       "abc",
+	} {
+		if _, err = db.Fetch(key, nil); !errors.Is(err, ErrPasswordNeeded) {
+			t.Errorf("expected %v to be encrypted but got %v", key, err)
+		}
+		if val, err := db.Fetch(key, password); err != nil || val != want {
+			t.Errorf("expected %q under %v but got %q (%v)", want, key, val, err)
+		}
+	}
+	if _, err = db.Fetch("team/other/key", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a secret outside the path to be left alone but got %v", err)
+	}
+	if got := fake.latest("team/app/mine"); got["value"] != "override" {
+		t.Errorf("expected the local key to be pushed but got %v", got)
+	}
+	if fake.latest("personal") != nil {
+		t.Errorf("expected a key outside the path to be left alone")
+	}
+
+	// Nothing has changed since
+	if stats, err = db.SyncVault(v, "secret", "team/app", password, nil); err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+	if stats != (SyncStats{}) {
+		t.Errorf("expected nothing to be copied but got %+v", stats)
+	}
+
+	// Changes on either side go the other way, and new keys join the secret
+	// at their parent path
+	if err = db.Stow("team/app/db/password", "hunter3", password); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	if err = db.Stow("team/app/db/host", "db.example.com", password); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	if err = db.Drop("team/app/mine"); err != nil {
+		t.Fatalf("error dropping value: %v", err)
+	}
+	fake.put("team/app/token", map[string]any{"value": "def"})
+	if stats, err = db.SyncVault(v, "secret", "team/app", password, nil); err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+	if stats != (SyncStats{Pulled: 1, Pushed: 3}) {
+		t.Errorf("expected 1 key pulled and 3 pushed but got %+v", stats)
+	}
+	want := map[string]any{"username": "admin", "password": "hunter3", "port": 5432.0, "host": "db.example.com"}
+	if got := fake.latest("team/app/db"); len(got) != len(want) {
+		t.Errorf("expected %v but got %v", want, got)
+	} else {
+		for name, val := range want {
+			if got[name] != val {
+				t.Errorf("expected %v but got %v", want, got)
+				break
+			}
+		}
+	}
+	if fake.latest("team/app/mine") != nil {
+		t.Errorf("expected the secret of a dropped key to be deleted")
+	}
+	if val, err := db.Fetch("team/app/token", password); err != nil || val != "def" {
+		t.Errorf("expected def under team/app/token but got %q (%v)", val, err)
+	}
+
+	// Keys changed on both sides are conflicts, which keep-both settles with
+	// a conflicted copy in the depot alone
+	if err = db.Stow("team/app/token", "local", password); err != nil {
+		t.Fatalf("error stowing value: %v", err)
+	}
+	fake.put("team/app/token", map[string]any{"value": "remote"})
+	fake.put("team/app/new", map[string]any{"value": "new"})
+	keepBoth := func(_, _ *Entry) (Resolution, error) { return KeepBoth, nil }
+	if stats, err = db.SyncVault(v, "secret", "team/app", password, keepBoth); err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+	if stats.Conflicts != 1 {
+		t.Errorf("expected 1 conflict but got %+v", stats)
+	}
+	if val, err := db.Fetch("team/app/token", password); err != nil || val != "remote" {
+		t.Errorf("expected the newer value under team/app/token but got %q (%v)", val, err)
+	}
+	keys, err := db.List("team/app/token.conflict-*")
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected a conflicted copy but got %v (%v)", keys, err)
+	}
+	if val, err := db.Fetch(keys[0].Key, password); err != nil || val != "local" {
+		t.Errorf("expected the older value in the conflicted copy but got %q (%v)", val, err)
+	}
+	if stats, err = db.SyncVault(v, "secret", "team/app", password, nil); err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+	if stats != (SyncStats{}) {
+		t.Errorf("expected the conflicted copy to stay out of vault but got %+v", stats)
+	}
+
+	// Secrets deleted from vault are dropped
+	fake.secrets["team/app/new"][0].deleted = true
+	if _, err = db.SyncVault(v, "secret", "team/app", password, nil); err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+	if _, err = db.Fetch("team/app/new", password); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v for a secret deleted from vault but got %v", ErrNotFound, err)
+	}
+
+	if _, err = db.SyncVault(v, "secret", "", password, nil); err == nil {
+		t.Errorf("expected an error syncing a whole mount")
+	}
+	bad, _ := NewVault(server.URL, "wrong", "")
+	if _, err = db.SyncVault(bad, "secret", "team/app", password, nil); err == nil ||
+		!strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("expected permission denied with the wrong token but got %v", err)
+	}
+}
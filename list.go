@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Orders in which keys can be listed
+const (
+	sortName     = "name"
+	sortModified = "modified"
+)
+
+// Prints the keys matching the given pattern, or every key, in the order
+// given by --sort, or only their names with --names, as a JSON array with
+// --format json. With --since only the keys stowed or dropped since then are
+// printed, dropped ones included. Returns an error if unsuccessful.
+func listKeys(storage *libdepot.Depot, opts options) error {
+	if opts.format != "" && opts.format != libdepot.FormatJSON {
+		return fmt.Errorf("invalid format for list: %v", opts.format)
+	}
+	var keys []libdepot.KeyInfo
+	if opts.since != "" {
+		since, err := parseSince(opts.since)
+		if err != nil {
+			return err
+		}
+		if keys, err = storage.ChangedSince(opts.key, since); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if keys, err = storage.List(opts.key); err != nil {
+			return err
+		}
+	}
+
+	switch opts.sort {
+	case sortName:
+		// Changes are found oldest first
+		if opts.since != "" {
+			sort.SliceStable(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+		}
+	case sortModified:
+		sort.SliceStable(keys, func(i, j int) bool {
+			return keys[i].Modified.Before(keys[j].Modified)
+		})
+	default:
+		return fmt.Errorf("invalid sort order: %v", opts.sort)
+	}
+
+	if opts.format == libdepot.FormatJSON {
+		if !opts.names {
+			return printJSON(keys)
+		}
+		names := make([]string, len(keys))
+		for i, k := range keys {
+			names[i] = k.Key
+		}
+		return printJSON(names)
+	}
+
+	for _, k := range keys {
+		if opts.names {
+			fmt.Println(k.Key)
+			continue
+		}
+		kind := "plain"
+		if k.Deleted {
+			kind = "dropped"
+		} else if k.Encrypted {
+			kind = "encrypted"
+		}
+		modified := k.Modified.Local().Format(time.DateTime)
+		if k.Modified.IsZero() {
+			// An alias of a key that no longer exists
+			modified = fmt.Sprintf("%-*v", len(time.DateTime), "-")
+		}
+		if k.Alias != "" {
+			fmt.Printf("%v  %-9v  %v -> %v\n", modified, "alias", k.Key, k.Alias)
+			continue
+		}
+		if note := rotationNote(k); note != "" {
+			fmt.Printf("%v  %-9v  %v  (rotate %v)\n", modified, kind, k.Key, note)
+			continue
+		}
+		fmt.Printf("%v  %-9v  %v\n", modified, kind, k.Key)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/adonSh/depot/libdepot"
+	"golang.org/x/term"
+)
+
+// Encrypts every secret again as one stowed now would be, so the depot picks
+// up improvements to how secrets are encrypted, showing progress on a
+// terminal. Secrets under another password are left alone and named in a
+// warning. Returns an error if unsuccessful.
+func migrateSecrets(storage *libdepot.Depot, opts options) error {
+	password, err := getPassword(true, opts.hasKey())
+	if err != nil {
+		return err
+	}
+
+	var progress func(done, total int)
+	if term.IsTerminal(int(os.Stderr.Fd())) && opts.format != libdepot.FormatJSON {
+		progress = func(done, total int) {
+			fmt.Fprintf(os.Stderr, "\rEncrypting %v of %v secrets", done, total)
+			if done == total {
+				fmt.Fprintln(os.Stderr)
+			}
+		}
+	}
+
+	n, skipped, err := storage.Reencrypt(password, progress)
+	if err != nil {
+		return fmt.Errorf("stopped after %v secrets: %w", n, err)
+	}
+
+	log.Printf("Encrypted %v secrets again\n", n)
+	if len(skipped) > 0 {
+		log.Printf("Warning: %v secrets don't decrypt with this password and were left as they were: %v\n",
+			len(skipped), strings.Join(skipped, ", "))
+	}
+
+	return nil
+}
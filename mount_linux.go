@@ -0,0 +1,574 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+	"golang.org/x/sys/unix"
+)
+
+// Opcodes of the FUSE kernel protocol, just those a read-only filesystem
+// needs. Anything else is answered with ENOSYS.
+const (
+	fuseLookup      = 1
+	fuseForget      = 2
+	fuseGetattr     = 3
+	fuseOpen        = 14
+	fuseRead        = 15
+	fuseRelease     = 18
+	fuseFlush       = 25
+	fuseInit        = 26
+	fuseOpendir     = 27
+	fuseReaddir     = 28
+	fuseReleasedir  = 29
+	fuseInterrupt   = 36
+	fuseDestroy     = 38
+	fuseBatchForget = 42
+)
+
+const (
+	fuseRootID      = 1
+	fuseMinor       = 31
+	fuseMaxWrite    = 128 * 1024
+	fuseInHeaderLen = 40
+	fuseAttrLen     = 88
+
+	// FOPEN_DIRECT_IO, so reads always come to us rather than the page cache
+	fuseDirectIO = 1
+
+	// How long the kernel may trust what it's told about a file before asking
+	// again
+	fuseValid = time.Second
+)
+
+// Serves the keys of a depot as a read-only filesystem over /dev/fuse, with
+// each "/" in a key making a directory
+type fuseServer struct {
+	dev      *os.File
+	storage  *libdepot.Depot
+	opts     options
+	password []byte
+	uid, gid uint32
+
+	// Node IDs handed to the kernel for each path, and back
+	ids   map[string]uint64
+	paths map[uint64]string
+
+	// The values of open files, by file handle
+	handles map[uint64][]byte
+	nextFH  uint64
+
+	// Decrypted sizes of values, which stat needs, by key
+	sizes map[string]fuseSize
+}
+
+type fuseSize struct {
+	modified time.Time
+	size     int
+}
+
+// A FUSE request header
+type fuseIn struct {
+	Len    uint32
+	Opcode uint32
+	Unique uint64
+	NodeID uint64
+	UID    uint32
+	GID    uint32
+	PID    uint32
+	_      uint32
+}
+
+// Mounts the depot's keys at dir as files whose contents are their values, for
+// programs that insist on reading secrets from a path, and serves them until
+// unmounted or interrupted. Secrets are decrypted as they
+// are read: if the depot is unlocked (see unlock) they can be read only while
+// it stays unlocked, and otherwise the password is asked for once up front.
+// Returns an error if unsuccessful.
+func mount(storage *libdepot.Depot, dir string, opts options) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	var password []byte
+	keys, err := storage.List("")
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if k.Encrypted {
+			if password, err = getPassword(true, opts.hasKey()); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	dev, err := fuseMount(dir)
+	if err != nil {
+		return fmt.Errorf("cannot mount %v: %w", dir, err)
+	}
+	defer dev.Close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		if err := fuseUnmount(dir); err != nil {
+			log.Printf("Warning: cannot unmount %v: %v\n", dir, err)
+		}
+		// A lazy unmount leaves the kernel waiting on us until the device
+		// is closed
+		dev.Close()
+	}()
+
+	log.Printf("Mounted at %v until interrupted or unmounted\n", dir)
+	s := &fuseServer{
+		dev:      dev,
+		storage:  storage,
+		opts:     opts,
+		password: password,
+		uid:      uint32(os.Getuid()),
+		gid:      uint32(os.Getgid()),
+		ids:      map[string]uint64{"": fuseRootID},
+		paths:    map[uint64]string{fuseRootID: ""},
+		handles:  map[uint64][]byte{},
+		sizes:    map[string]fuseSize{},
+	}
+
+	return s.serve()
+}
+
+// Mounts a FUSE filesystem at dir, directly as root or otherwise with the
+// help of fusermount, and returns the device to serve it through or an error
+// if unsuccessful
+func fuseMount(dir string) (*os.File, error) {
+	const flags = unix.MS_NOSUID | unix.MS_NODEV | unix.MS_RDONLY
+	if os.Geteuid() == 0 {
+		dev, err := os.OpenFile("/dev/fuse", os.O_RDWR, 0)
+		if err != nil {
+			return nil, err
+		}
+		data := fmt.Sprintf("fd=%d,rootmode=40000,user_id=0,group_id=0,default_permissions", dev.Fd())
+		if err = unix.Mount("depot", dir, "fuse.depot", flags, data); err != nil {
+			dev.Close()
+			return nil, err
+		}
+		return dev, nil
+	}
+
+	// fusermount mounts on our behalf and passes the device back over a
+	// socket
+	fusermount, err := findFusermount()
+	if err != nil {
+		return nil, err
+	}
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, err
+	}
+	ours, theirs := os.NewFile(uintptr(fds[0]), "fusermount"), os.NewFile(uintptr(fds[1]), "fusermount")
+	defer ours.Close()
+	defer theirs.Close()
+
+	cmd := exec.Command(fusermount, "-o", "ro,nosuid,nodev,default_permissions,fsname=depot,subtype=depot", "--", dir)
+	cmd.Env = append(os.Environ(), "_FUSE_COMMFD=3")
+	cmd.ExtraFiles = []*os.File{theirs}
+	cmd.Stderr = os.Stderr
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	theirs.Close()
+
+	buf, oob := make([]byte, 1), make([]byte, unix.CmsgSpace(4))
+	_, oobn, _, _, err := unix.Recvmsg(fds[0], buf, oob, 0)
+	if waitErr := cmd.Wait(); err == nil && waitErr != nil {
+		err = waitErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) == 0 {
+		return nil, errors.New("fusermount did not pass back the device")
+	}
+	devs, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil || len(devs) == 0 {
+		return nil, errors.New("fusermount did not pass back the device")
+	}
+
+	return os.NewFile(uintptr(devs[0]), "/dev/fuse"), nil
+}
+
+// Unmounts the FUSE filesystem at dir. Returns an error if unsuccessful.
+func fuseUnmount(dir string) error {
+	if os.Geteuid() == 0 {
+		return unix.Unmount(dir, unix.MNT_DETACH)
+	}
+
+	fusermount, err := findFusermount()
+	if err != nil {
+		return err
+	}
+
+	return exec.Command(fusermount, "-u", "-z", dir).Run()
+}
+
+// Returns the path of fusermount3, or of the older fusermount, or an error if
+// neither is installed
+func findFusermount() (string, error) {
+	for _, name := range []string{"fusermount3", "fusermount"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", errors.New("fusermount is not installed")
+}
+
+// Answers requests from the kernel until the filesystem is unmounted.
+// Returns an error if unsuccessful.
+func (s *fuseServer) serve() error {
+	buf := make([]byte, fuseMaxWrite+4096)
+	for {
+		n, err := s.dev.Read(buf)
+		if errors.Is(err, unix.ENODEV) || errors.Is(err, os.ErrClosed) {
+			return nil
+		} else if errors.Is(err, unix.EINTR) || errors.Is(err, unix.ENOENT) {
+			// Interrupted, or a request the kernel gave up on
+			continue
+		} else if err != nil {
+			return err
+		}
+		if n < fuseInHeaderLen {
+			return fmt.Errorf("short FUSE request of %v bytes", n)
+		}
+
+		var in fuseIn
+		binary.Read(bytes.NewReader(buf[:fuseInHeaderLen]), binary.NativeEndian, &in)
+		if in.Opcode == fuseDestroy {
+			return nil
+		}
+		out, errno := s.handle(in, buf[fuseInHeaderLen:n])
+		if out == nil && errno == 0 {
+			// Forgetting needs no answer
+			continue
+		}
+		if err = s.reply(in.Unique, out, errno); err != nil && !errors.Is(err, unix.ENOENT) {
+			return err
+		}
+	}
+}
+
+// Sends the answer to the request with the given unique ID: out, or the
+// error errno if it isn't 0. Returns an error if unsuccessful.
+func (s *fuseServer) reply(unique uint64, out []byte, errno unix.Errno) error {
+	if errno != 0 {
+		out = nil
+	}
+	msg := make([]byte, 16, 16+len(out))
+	binary.NativeEndian.PutUint32(msg[0:], uint32(16+len(out)))
+	binary.NativeEndian.PutUint32(msg[4:], uint32(-int32(errno)))
+	binary.NativeEndian.PutUint64(msg[8:], unique)
+	_, err := s.dev.Write(append(msg, out...))
+
+	return err
+}
+
+// Returns the answer to the request whose header is in and whose arguments
+// are arg, or an error number
+func (s *fuseServer) handle(in fuseIn, arg []byte) ([]byte, unix.Errno) {
+	switch in.Opcode {
+	case fuseInit:
+		return s.init(arg)
+	case fuseLookup:
+		return s.lookup(in.NodeID, string(bytes.TrimRight(arg, "\x00")))
+	case fuseGetattr:
+		return s.getattr(in.NodeID)
+	case fuseOpen:
+		return s.open(in.NodeID, binary.NativeEndian.Uint32(arg))
+	case fuseRead:
+		return s.read(arg)
+	case fuseRelease:
+		fh := binary.NativeEndian.Uint64(arg)
+		clear(s.handles[fh])
+		delete(s.handles, fh)
+		return []byte{}, 0
+	case fuseFlush, fuseReleasedir:
+		return []byte{}, 0
+	case fuseOpendir:
+		if _, ok := s.paths[in.NodeID]; !ok {
+			return nil, unix.ENOENT
+		}
+		return make([]byte, 16), 0
+	case fuseReaddir:
+		return s.readdir(in.NodeID, arg)
+	default:
+		return nil, unix.ENOSYS
+	}
+}
+
+func (s *fuseServer) init(arg []byte) ([]byte, unix.Errno) {
+	major, minor := binary.NativeEndian.Uint32(arg[0:]), binary.NativeEndian.Uint32(arg[4:])
+	if major != 7 {
+		return nil, unix.EPROTO
+	}
+
+	out := make([]byte, 64)
+	binary.NativeEndian.PutUint32(out[0:], 7)
+	binary.NativeEndian.PutUint32(out[4:], min(minor, fuseMinor))
+	copy(out[8:12], arg[8:12]) // max_readahead
+	binary.NativeEndian.PutUint32(out[20:], fuseMaxWrite)
+	binary.NativeEndian.PutUint32(out[24:], 1) // time_gran
+
+	return out, 0
+}
+
+// Returns the names in the directory at dir, each mapped to whether it is a
+// directory itself, or ok false if there is no such directory
+func (s *fuseServer) children(dir string) (map[string]bool, bool, error) {
+	keys, err := s.storage.List("")
+	if err != nil {
+		return nil, false, err
+	}
+
+	prefix := dir
+	if prefix != "" {
+		prefix += "/"
+	}
+	found := dir == ""
+	names := map[string]bool{}
+	for _, k := range keys {
+		rest, ok := strings.CutPrefix(k.Key, prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		found = true
+		name, _, isDir := strings.Cut(rest, "/")
+		if name != "" {
+			names[name] = names[name] || isDir
+		}
+	}
+
+	return names, found, nil
+}
+
+func (s *fuseServer) lookup(parent uint64, name string) ([]byte, unix.Errno) {
+	dir, ok := s.paths[parent]
+	if !ok {
+		return nil, unix.ENOENT
+	}
+	names, _, err := s.children(dir)
+	if err != nil {
+		return nil, unix.EIO
+	}
+	isDir, ok := names[name]
+	if !ok {
+		return nil, unix.ENOENT
+	}
+
+	path := name
+	if dir != "" {
+		path = dir + "/" + name
+	}
+	id, ok := s.ids[path]
+	if !ok {
+		id = uint64(len(s.paths) + 1)
+		s.ids[path], s.paths[id] = id, path
+	}
+	attr, errno := s.attr(id, path, isDir)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	out := make([]byte, 40, 40+fuseAttrLen)
+	binary.NativeEndian.PutUint64(out[0:], id)
+	binary.NativeEndian.PutUint64(out[16:], uint64(fuseValid.Seconds()))
+	binary.NativeEndian.PutUint64(out[24:], uint64(fuseValid.Seconds()))
+
+	return append(out, attr...), 0
+}
+
+func (s *fuseServer) getattr(id uint64) ([]byte, unix.Errno) {
+	path, ok := s.paths[id]
+	if !ok {
+		return nil, unix.ENOENT
+	}
+	isDir := path == ""
+	if !isDir {
+		_, isDir, _ = s.children(path)
+	}
+	attr, errno := s.attr(id, path, isDir)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	out := make([]byte, 16, 16+fuseAttrLen)
+	binary.NativeEndian.PutUint64(out[0:], uint64(fuseValid.Seconds()))
+
+	return append(out, attr...), 0
+}
+
+// Returns the attributes of the file or directory at path: read-only and
+// owned by whoever mounted the depot
+func (s *fuseServer) attr(id uint64, path string, isDir bool) ([]byte, unix.Errno) {
+	mode, size, modified := uint32(unix.S_IFDIR|0500), 0, time.Now()
+	if !isDir {
+		info, err := s.storage.Info(path)
+		if errors.Is(err, libdepot.ErrNotFound) {
+			return nil, unix.ENOENT
+		} else if err != nil {
+			return nil, unix.EIO
+		}
+		mode, size, modified = unix.S_IFREG|0400, s.size(path, info), info.Modified
+	}
+
+	attr := make([]byte, fuseAttrLen)
+	binary.NativeEndian.PutUint64(attr[0:], id)
+	binary.NativeEndian.PutUint64(attr[8:], uint64(size))
+	binary.NativeEndian.PutUint64(attr[16:], uint64((size+511)/512))
+	for _, off := range []int{24, 32, 40} {
+		binary.NativeEndian.PutUint64(attr[off:], uint64(modified.Unix()))
+	}
+	binary.NativeEndian.PutUint32(attr[60:], mode)
+	binary.NativeEndian.PutUint32(attr[64:], 1) // nlink
+	binary.NativeEndian.PutUint32(attr[68:], s.uid)
+	binary.NativeEndian.PutUint32(attr[72:], s.gid)
+	binary.NativeEndian.PutUint32(attr[80:], 4096) // blksize
+
+	return attr, 0
+}
+
+// Returns the size of the value of key, which for a secret means decrypting
+// it the first time, or 0 if it cannot be fetched
+func (s *fuseServer) size(key string, info libdepot.KeyInfo) int {
+	if !info.Encrypted && info.Compression == libdepot.CompressionNone {
+		return info.Size
+	}
+	if cached, ok := s.sizes[key]; ok && cached.modified.Equal(info.Modified) {
+		return cached.size
+	}
+
+	val, err := s.fetch(key, info)
+	if err != nil {
+		return 0
+	}
+	s.sizes[key] = fuseSize{info.Modified, len(val)}
+	clear(val)
+
+	return len(val)
+}
+
+// Returns the value of key, refusing secrets once the depot is locked again
+// if it was unlocked when mounted, or an error if unsuccessful
+func (s *fuseServer) fetch(key string, info libdepot.KeyInfo) ([]byte, error) {
+	password := s.password
+	if info.Encrypted && lockedAgain(s.opts) {
+		password = nil
+	}
+	val, err := s.storage.Fetch(key, password)
+
+	return []byte(val), err
+}
+
+func (s *fuseServer) open(id uint64, flags uint32) ([]byte, unix.Errno) {
+	path, ok := s.paths[id]
+	if !ok {
+		return nil, unix.ENOENT
+	}
+	if flags&unix.O_ACCMODE != unix.O_RDONLY {
+		return nil, unix.EROFS
+	}
+	info, err := s.storage.Info(path)
+	if errors.Is(err, libdepot.ErrNotFound) {
+		return nil, unix.ENOENT
+	} else if err != nil {
+		return nil, unix.EIO
+	}
+
+	val, err := s.fetch(path, info)
+	if errors.Is(err, libdepot.ErrPasswordNeeded) || errors.Is(err, libdepot.ErrBadPassword) {
+		return nil, unix.EACCES
+	} else if err != nil {
+		return nil, unix.EIO
+	}
+	s.nextFH++
+	s.handles[s.nextFH] = val
+
+	out := make([]byte, 16)
+	binary.NativeEndian.PutUint64(out[0:], s.nextFH)
+	binary.NativeEndian.PutUint32(out[8:], fuseDirectIO)
+
+	return out, 0
+}
+
+func (s *fuseServer) read(arg []byte) ([]byte, unix.Errno) {
+	fh := binary.NativeEndian.Uint64(arg[0:])
+	offset := binary.NativeEndian.Uint64(arg[8:])
+	size := uint64(binary.NativeEndian.Uint32(arg[16:]))
+	val, ok := s.handles[fh]
+	if !ok {
+		return nil, unix.EBADF
+	}
+	if offset >= uint64(len(val)) {
+		return []byte{}, 0
+	}
+
+	return val[offset:min(offset+size, uint64(len(val)))], 0
+}
+
+func (s *fuseServer) readdir(id uint64, arg []byte) ([]byte, unix.Errno) {
+	dir, ok := s.paths[id]
+	if !ok {
+		return nil, unix.ENOENT
+	}
+	offset := binary.NativeEndian.Uint64(arg[8:])
+	size := int(binary.NativeEndian.Uint32(arg[16:]))
+
+	names, _, err := s.children(dir)
+	if err != nil {
+		return nil, unix.EIO
+	}
+	entries := []string{".", ".."}
+	for name := range names {
+		entries = append(entries, name)
+	}
+	sort.Strings(entries[2:])
+
+	out := []byte{}
+	for i := int(offset); i < len(entries); i++ {
+		name := entries[i]
+		typ := uint32(unix.DT_REG)
+		if i < 2 || names[name] {
+			typ = unix.DT_DIR
+		}
+		dirent := make([]byte, 24, (24+len(name)+7)&^7)
+		binary.NativeEndian.PutUint64(dirent[0:], uint64(i+1000)) // the real ID comes with lookup
+		binary.NativeEndian.PutUint64(dirent[8:], uint64(i+1))
+		binary.NativeEndian.PutUint32(dirent[16:], uint32(len(name)))
+		binary.NativeEndian.PutUint32(dirent[20:], typ)
+		dirent = append(dirent, name...)
+		dirent = dirent[:cap(dirent)]
+		if len(out)+len(dirent) > size {
+			break
+		}
+		out = append(out, dirent...)
+	}
+
+	return out, 0
+}
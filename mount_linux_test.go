@@ -0,0 +1,228 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/adonSh/depot/libdepot"
+	"golang.org/x/sys/unix"
+)
+
+// Returns a FUSE server over an in-memory depot holding a few keys, one of
+// them a secret, with no device to serve on
+func newTestFuseServer(t *testing.T) *fuseServer {
+	t.Helper()
+	storage, err := libdepot.NewMemDepot()
+	if err != nil {
+		t.Fatalf("error creating depot: %v", err)
+	}
+	password := []byte("password")
+	for key, val := range map[string]string{"plain": "hello", "db/user": "admin", "db/replica/host": "db2"} {
+		if err = storage.Stow(key, val, nil); err != nil {
+			t.Fatalf("error stowing %v: %v", key, err)
+		}
+	}
+	if err = storage.Stow("db/password", "hunter2", password); err != nil {
+		t.Fatalf("error stowing secret: %v", err)
+	}
+
+	return &fuseServer{
+		storage:  storage,
+		password: password,
+		uid:      1000,
+		gid:      100,
+		ids:      map[string]uint64{"": fuseRootID},
+		paths:    map[uint64]string{fuseRootID: ""},
+		handles:  map[uint64][]byte{},
+		sizes:    map[string]fuseSize{},
+	}
+}
+
+// The fields of fuse_attr that the server fills in
+type fuseTestAttr struct {
+	ino, size, blocks uint64
+	mode, nlink       uint32
+	uid, gid          uint32
+	blksize           uint32
+}
+
+func decodeFuseAttr(attr []byte) fuseTestAttr {
+	ne := binary.NativeEndian
+	return fuseTestAttr{
+		ino:     ne.Uint64(attr[0:]),
+		size:    ne.Uint64(attr[8:]),
+		blocks:  ne.Uint64(attr[16:]),
+		mode:    ne.Uint32(attr[60:]),
+		nlink:   ne.Uint32(attr[64:]),
+		uid:     ne.Uint32(attr[68:]),
+		gid:     ne.Uint32(attr[72:]),
+		blksize: ne.Uint32(attr[80:]),
+	}
+}
+
+// Looks name up in the directory parent, as the kernel would, and returns
+// the entry's node ID and attributes
+func fuseTestLookup(t *testing.T, s *fuseServer, parent uint64, name string) (uint64, fuseTestAttr) {
+	t.Helper()
+	out, errno := s.handle(fuseIn{Opcode: fuseLookup, NodeID: parent}, append([]byte(name), 0))
+	if errno != 0 {
+		t.Fatalf("error looking up %v: %v", name, errno)
+	}
+	if len(out) != 40+fuseAttrLen {
+		t.Fatalf("expected an entry of %v bytes but got %v", 40+fuseAttrLen, len(out))
+	}
+
+	return binary.NativeEndian.Uint64(out), decodeFuseAttr(out[40:])
+}
+
+func TestFuseAttributes(t *testing.T) {
+	s := newTestFuseServer(t)
+
+	dir, attr := fuseTestLookup(t, s, fuseRootID, "db")
+	want := fuseTestAttr{ino: dir, mode: unix.S_IFDIR | 0500, nlink: 1, uid: 1000, gid: 100, blksize: 4096}
+	if attr != want {
+		t.Errorf("expected %+v for db but got %+v", want, attr)
+	}
+
+	id, attr := fuseTestLookup(t, s, dir, "password")
+	want = fuseTestAttr{ino: id, size: 7, blocks: 1, mode: unix.S_IFREG | 0400, nlink: 1, uid: 1000, gid: 100, blksize: 4096}
+	if attr != want {
+		t.Errorf("expected %+v for the secret, with its decrypted size, but got %+v", want, attr)
+	}
+
+	out, errno := s.getattr(id)
+	if errno != 0 || decodeFuseAttr(out[16:]) != want {
+		t.Errorf("expected getattr to agree with lookup but got %+v (%v)", decodeFuseAttr(out[16:]), errno)
+	}
+	out, errno = s.getattr(fuseRootID)
+	if errno != 0 || decodeFuseAttr(out[16:]).mode != unix.S_IFDIR|0500 {
+		t.Errorf("expected the root to be a directory (%v)", errno)
+	}
+	if _, errno = s.getattr(99); errno != unix.ENOENT {
+		t.Errorf("expected %v for an unknown node but got %v", unix.ENOENT, errno)
+	}
+}
+
+func TestFuseLookup(t *testing.T) {
+	s := newTestFuseServer(t)
+
+	db, _ := fuseTestLookup(t, s, fuseRootID, "db")
+	replica, _ := fuseTestLookup(t, s, db, "replica")
+	host, _ := fuseTestLookup(t, s, replica, "host")
+	if s.paths[db] != "db" || s.paths[replica] != "db/replica" || s.paths[host] != "db/replica/host" {
+		t.Errorf("expected node IDs to map to their keys but got %v", s.paths)
+	}
+	if again, _ := fuseTestLookup(t, s, fuseRootID, "db"); again != db {
+		t.Errorf("expected the same node ID looking db up again but got %v and %v", db, again)
+	}
+
+	for _, tt := range []struct {
+		parent uint64
+		name   string
+	}{
+		{fuseRootID, "missing"},
+		{fuseRootID, "user"},
+		{db, "plain"},
+		{99, "db"},
+	} {
+		if _, errno := s.lookup(tt.parent, tt.name); errno != unix.ENOENT {
+			t.Errorf("expected %v looking up %v in %v but got %v", unix.ENOENT, tt.name, tt.parent, errno)
+		}
+	}
+
+	// The node's key is what is opened and read
+	password, _ := fuseTestLookup(t, s, db, "password")
+	out, errno := s.open(password, unix.O_RDONLY)
+	if errno != 0 {
+		t.Fatalf("error opening: %v", errno)
+	}
+	arg := make([]byte, 40)
+	binary.NativeEndian.PutUint64(arg[0:], binary.NativeEndian.Uint64(out))
+	binary.NativeEndian.PutUint64(arg[8:], 2)
+	binary.NativeEndian.PutUint32(arg[16:], 3)
+	if got, errno := s.read(arg); errno != 0 || string(got) != "nte" {
+		t.Errorf("expected part of the secret but got %q (%v)", got, errno)
+	}
+	if _, errno = s.open(password, unix.O_WRONLY); errno != unix.EROFS {
+		t.Errorf("expected %v opening to write but got %v", unix.EROFS, errno)
+	}
+
+	s.password = nil
+	if _, errno = s.open(password, unix.O_RDONLY); errno != unix.EACCES {
+		t.Errorf("expected %v without the password but got %v", unix.EACCES, errno)
+	}
+}
+
+// An entry of a directory as readdir gives it
+type fuseTestDirent struct {
+	off  uint64
+	typ  uint32
+	name string
+}
+
+func decodeFuseDirents(t *testing.T, out []byte) []fuseTestDirent {
+	t.Helper()
+	ne := binary.NativeEndian
+	var entries []fuseTestDirent
+	for len(out) > 0 {
+		if len(out) < 24 {
+			t.Fatalf("expected a whole entry but got %v bytes", len(out))
+		}
+		n := int(ne.Uint32(out[16:]))
+		entries = append(entries, fuseTestDirent{ne.Uint64(out[8:]), ne.Uint32(out[20:]), string(out[24 : 24+n])})
+		out = out[(24+n+7)&^7:]
+	}
+
+	return entries
+}
+
+func TestFuseReaddir(t *testing.T) {
+	s := newTestFuseServer(t)
+	readdir := func(id, offset uint64, size uint32) []fuseTestDirent {
+		arg := make([]byte, 40)
+		binary.NativeEndian.PutUint64(arg[8:], offset)
+		binary.NativeEndian.PutUint32(arg[16:], size)
+		out, errno := s.handle(fuseIn{Opcode: fuseReaddir, NodeID: id}, arg)
+		if errno != 0 {
+			t.Fatalf("error reading directory: %v", errno)
+		}
+		return decodeFuseDirents(t, out)
+	}
+
+	want := []fuseTestDirent{
+		{1, unix.DT_DIR, "."},
+		{2, unix.DT_DIR, ".."},
+		{3, unix.DT_DIR, "db"},
+		{4, unix.DT_REG, "plain"},
+	}
+	if got := readdir(fuseRootID, 0, 4096); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+	// Carrying on from the offset of the last entry given
+	if got := readdir(fuseRootID, 2, 4096); !reflect.DeepEqual(got, want[2:]) {
+		t.Errorf("expected %v but got %v", want[2:], got)
+	}
+	// Only whole entries that fit
+	if got := readdir(fuseRootID, 0, 70); !reflect.DeepEqual(got, want[:2]) {
+		t.Errorf("expected %v but got %v", want[:2], got)
+	}
+
+	db, _ := fuseTestLookup(t, s, fuseRootID, "db")
+	want = []fuseTestDirent{
+		{1, unix.DT_DIR, "."},
+		{2, unix.DT_DIR, ".."},
+		{3, unix.DT_REG, "password"},
+		{4, unix.DT_DIR, "replica"},
+		{5, unix.DT_REG, "user"},
+	}
+	if got := readdir(db, 0, 4096); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+
+	if _, errno := s.readdir(99, make([]byte, 40)); errno != unix.ENOENT {
+		t.Errorf("expected %v for an unknown directory but got %v", unix.ENOENT, errno)
+	}
+}
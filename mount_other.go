@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+func mount(storage *libdepot.Depot, dir string, opts options) error {
+	return fmt.Errorf("mount is only supported on Linux: %w", errors.ErrUnsupported)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Moves (mv) or copies (cp) the value of the key to the destination key. An
+// encrypted value is moved as it is, but copying one asks for its password.
+// An existing destination is only replaced with --force. Returns an error if
+// unsuccessful.
+func moveKey(storage *libdepot.Depot, opts options) error {
+	var err error
+	if opts.action == actMove {
+		err = storage.Rename(opts.key, opts.extraKeys[0], opts.force)
+	} else {
+		err = storage.Copy(opts.key, opts.extraKeys[0], nil, opts.force)
+		if errors.Is(err, libdepot.ErrPasswordNeeded) {
+			var password []byte
+			if password, err = getPassword(true, opts.hasKey()); err != nil {
+				return err
+			}
+			err = storage.Copy(opts.key, opts.extraKeys[0], password, opts.force)
+		}
+	}
+	if errors.Is(err, libdepot.ErrExists) {
+		return fmt.Errorf("%v already exists, use --force to replace it", opts.extraKeys[0])
+	}
+
+	return err
+}
+
+// Makes the key an alias of the destination key, replacing an existing alias
+// only with --force. Returns an error if unsuccessful.
+func alias(storage *libdepot.Depot, opts options) error {
+	err := storage.Alias(opts.key, opts.extraKeys[0], opts.force)
+	if errors.Is(err, libdepot.ErrExists) {
+		return fmt.Errorf("%v already exists, use --force to replace an alias", opts.key)
+	}
+
+	return err
+}
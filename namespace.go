@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// What namespace may be asked to do
+const (
+	namespaceList   = "list"
+	namespaceAdd    = "add"
+	namespaceRemove = "remove"
+)
+
+// Lists the namespaces that have passwords of their own, gives the given
+// namespace one, asked for twice, or takes it away. Returns an error if
+// unsuccessful.
+func namespace(storage *libdepot.Depot, opts options) error {
+	if opts.key != namespaceList && len(opts.extraKeys) != 1 {
+		return fmt.Errorf("give the namespace to %v", opts.key)
+	}
+
+	switch opts.key {
+	case namespaceList:
+		names, err := storage.Namespaces()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	case namespaceAdd:
+		name := opts.extraKeys[0]
+		// Neither a keyfile nor an unlocked depot stands in for the
+		// namespace's password
+		password, err := getNewPassword(true, false)
+		if err != nil {
+			return err
+		}
+		if err = storage.CreateNamespace(name, password); errors.Is(err, libdepot.ErrExists) {
+			return fmt.Errorf("%v already has a password of its own", name)
+		} else if err != nil {
+			return err
+		}
+		log.Printf("Values stowed under %v/ from now on need its own password\n", name)
+	case namespaceRemove:
+		name := opts.extraKeys[0]
+		if err := storage.RemoveNamespace(name); errors.Is(err, libdepot.ErrNotFound) {
+			return fmt.Errorf("%v has no password of its own", name)
+		} else if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("namespace can only %v, %v, or %v", namespaceList, namespaceAdd, namespaceRemove)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// The config setting naming a command that prints the password, as
+// DEPOT_PASS_COMMAND does
+const passCommandSetting = "pass-command"
+
+// Returns the password printed by the command in DEPOT_PASS_COMMAND, or else
+// pass-command in the config file, or false if neither is set. The command is
+// run through the shell, as $EDITOR is, at most once however many times the
+// password is needed. Returns an error if the command fails or prints
+// nothing.
+var commandPassword = sync.OnceValues(func() ([]byte, error) {
+	command := os.Getenv(envPassCommand)
+	if command == "" {
+		cfg, err := loadConfig()
+		if err != nil {
+			return nil, err
+		}
+		command = cfg[passCommandSetting]
+	}
+	if command == "" {
+		return nil, nil
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("password command: %w", err)
+	}
+	if p := bytes.TrimSuffix(bytes.TrimSuffix(out, []byte("\n")), []byte("\r")); len(p) > 0 {
+		return p, nil
+	}
+
+	return nil, errors.New("password command printed no password")
+})
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+)
+
+// The password read from --pass-fd or --pass-file, if either was given
+var givenPassword []byte
+
+// Reads the password from the file descriptor given with --pass-fd or the
+// file given with --pass-file, if either was, once and for all, so that it
+// is used wherever a password is needed. The file must not be readable by
+// other users. Returns an error if unsuccessful, including when it holds no
+// password.
+func readGivenPassword(opts options) error {
+	var data []byte
+	switch {
+	case opts.passFd != "" && opts.passFile != "":
+		return errors.New("give either --pass-fd or --pass-file, not both")
+	case opts.passFd != "":
+		fd, err := strconv.Atoi(opts.passFd)
+		if err != nil || fd < 0 {
+			return fmt.Errorf("invalid --pass-fd: %v", opts.passFd)
+		}
+		f := os.NewFile(uintptr(fd), "pass-fd")
+		data, err = io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("cannot read password from fd %v: %w", fd, err)
+		}
+	case opts.passFile != "":
+		info, err := os.Stat(opts.passFile)
+		if err != nil {
+			return fmt.Errorf("cannot read password: %w", err)
+		} else if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+			return fmt.Errorf("%v has mode %v, so other users may be able to read it; "+
+				"chmod 600 it first", opts.passFile, info.Mode().Perm())
+		}
+		if data, err = os.ReadFile(opts.passFile); err != nil {
+			return fmt.Errorf("cannot read password: %w", err)
+		}
+	default:
+		return nil
+	}
+
+	givenPassword = bytes.TrimSuffix(bytes.TrimSuffix(data, []byte("\n")), []byte("\r"))
+	if len(givenPassword) == 0 {
+		return errors.New("no password was given")
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// A selector over the keys in the depot, which is filtered as the user types
+type pickModel struct {
+	list   list.Model
+	picked string
+}
+
+// Returns query if it names a key in the depot, and otherwise the key the
+// user picks from a selector filtered by query as they type. The selector is
+// drawn on stderr, so that the value fetched can still go to a pipe. Returns
+// an error if unsuccessful or if nothing is picked.
+func pickKey(storage *libdepot.Depot, query string) (string, error) {
+	keys, err := storage.List("")
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", errors.New("depot is empty")
+	}
+
+	items := make([]list.Item, len(keys))
+	for i, k := range keys {
+		if k.Key == query {
+			return k.Key, nil
+		}
+		items[i] = uiItem(k)
+	}
+	if nonInteractive {
+		return "", fmt.Errorf("no key is called %v, and none can be picked: %w", query, errNonInteractive)
+	}
+
+	delegate := list.NewDefaultDelegate()
+	delegate.ShowDescription = false
+	delegate.SetSpacing(0)
+	m := pickModel{list: list.New(items, delegate, 0, 0)}
+	m.list.Title = "Pick a key"
+	m.list.SetStatusBarItemName("key", "keys")
+	m.list.SetShowHelp(false)
+	if query != "" {
+		m.list.SetFilterText(query)
+	}
+	m.list.SetFilterState(list.Filtering)
+
+	final, err := tea.NewProgram(m, tea.WithOutput(os.Stderr), tea.WithInputTTY()).Run()
+	if err != nil {
+		return "", fmt.Errorf("cannot show keys to pick from: %w", err)
+	}
+	if picked := final.(pickModel).picked; picked != "" {
+		return picked, nil
+	}
+
+	return "", errors.New("no key picked")
+}
+
+func (m pickModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m pickModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.list.SetSize(msg.Width, min(msg.Height, 20))
+		return m, nil
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c":
+			return m, tea.Quit
+		case "enter":
+			// Pick the highlighted key even while still filtering
+			if item, ok := m.list.SelectedItem().(uiItem); ok {
+				m.picked = item.Key
+				return m, tea.Quit
+			}
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m pickModel) View() string {
+	if m.picked != "" {
+		return ""
+	}
+
+	return m.list.View()
+}
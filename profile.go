@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Selects a profile, as --profile does
+const envProfile = "DEPOT_PROFILE"
+
+// The setting in the config file that names the database, in place of the
+// default one, when DEPOT_PATH is not set
+const pathSetting = "path"
+
+// The setting in the config file that selects the profile used when neither
+// --profile nor DEPOT_PROFILE does
+const profileSetting = "profile"
+
+// Settings in the config file whose names begin with this apply only to the
+// profile named next, as "profile.<name>.<setting> = <value>", in place of
+// the setting of the same name outside of any profile
+const profilePrefix = "profile."
+
+// The profile selected with --profile or DEPOT_PROFILE, if either was given
+var selectedProfile string
+
+// Returns the settings of the profile called name in cfg laid over the rest
+// of cfg, or an error if no setting of cfg belongs to it
+func (cfg config) withProfile(name string) (config, error) {
+	prefix := profilePrefix + name + "."
+	merged := config{}
+	found := false
+	for setting, val := range cfg {
+		if rest, ok := strings.CutPrefix(setting, prefix); ok {
+			merged[rest], found = val, true
+		} else if _, ok := merged[setting]; !ok {
+			merged[setting] = val
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no profile called %v in the config file", name)
+	}
+
+	return merged, nil
+}
+
+// Returns the profile that is selected, by --profile, DEPOT_PROFILE, or the
+// config file, in that order, or "" if none is
+func (cfg config) profile() string {
+	if selectedProfile != "" {
+		return selectedProfile
+	}
+
+	return cfg[profileSetting]
+}
+
+// Selects the profile given with --profile or DEPOT_PROFILE, and fills in
+// the options that its settings supply and that were not given otherwise: a
+// keyfile, a file holding the password, and a namespace that keys given as
+// arguments without one of their own are taken to be in. Returns an error if
+// unsuccessful, including when there is no such profile.
+func applyProfile(opts *options) error {
+	selectedProfile = opts.profile
+	if selectedProfile == "" {
+		selectedProfile = os.Getenv(envProfile)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	name := cfg.profile()
+	if name == "" {
+		return nil
+	}
+	debugf("profile", slog.String("name", name))
+
+	if opts.keyfile == "" {
+		opts.keyfile = cfg["keyfile"]
+	}
+	if opts.passFd == "" && opts.passFile == "" {
+		opts.passFile = cfg["pass-file"]
+	}
+	if ns := cfg["namespace"]; ns != "" {
+		cmd, _ := findCommand(opts.action)
+		qualifyKeys(opts, cmd.keyArgs, ns)
+	}
+
+	return nil
+}
+
+// Puts the first n keys given as arguments, or all of them if n is -1, that
+// have no namespace of their own into the namespace ns
+func qualifyKeys(opts *options, n int, ns string) {
+	qualify := func(key string) string {
+		if key == "" || strings.Contains(key, "/") {
+			return key
+		}
+		return ns + "/" + key
+	}
+
+	if n != 0 {
+		opts.key = qualify(opts.key)
+	}
+	for i := range opts.extraKeys {
+		if n >= 0 && i+1 >= n {
+			break
+		}
+		opts.extraKeys[i] = qualify(opts.extraKeys[i])
+	}
+}
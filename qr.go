@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Shows val as a QR code drawn with block characters, light on dark as most
+// terminals are, or writes it to the file at out as a PNG image only the user
+// may read. Returns an error if unsuccessful.
+func showQR(val, out string) error {
+	code, err := qrcode.New(val, qrcode.Medium)
+	if err != nil {
+		return fmt.Errorf("cannot make QR code: %w", err)
+	}
+
+	if out == "" {
+		fmt.Print(code.ToSmallString(false))
+		return nil
+	}
+
+	png, err := code.PNG(512)
+	if err != nil {
+		return fmt.Errorf("cannot make QR code: %w", err)
+	}
+
+	return writePrivate(out, png)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Fetches the keys mapped with --env, asking for the password at most once,
+// and runs the command given after -- with their values in its environment,
+// so that they are never written to disk. Returns an error if unsuccessful,
+// and otherwise does not return.
+func runCommand(storage *libdepot.Depot, opts options) error {
+	if len(opts.command) == 0 {
+		return errors.New("no command given, put it after --")
+	}
+	if len(opts.env) == 0 {
+		return errors.New("no keys given, map them with --env NAME=key")
+	}
+
+	names := make([]string, len(opts.env))
+	keys := make([]string, len(opts.env))
+	for i, mapping := range opts.env {
+		name, key, ok := strings.Cut(mapping, "=")
+		if !ok {
+			name, key = envName(mapping), mapping
+		}
+		if name == "" || key == "" {
+			return fmt.Errorf("invalid --env %v, expected NAME=key", mapping)
+		}
+		names[i], keys[i] = name, key
+	}
+
+	vals, err := fetchValues(storage, keys, opts.hasKey())
+	if err != nil {
+		return err
+	}
+	storage.Close()
+
+	return execCommand(opts.command, withEnv(os.Environ(), names, vals))
+}
+
+// The variables that give depot its own credentials, which a command it runs
+// has no business seeing
+var credentialEnv = []string{envPass, envPassCommand, envToken}
+
+// Returns env with the variables of the given names set to vals, replacing
+// any already there, since not every program heeds the last of several, and
+// without depot's own credentials (see credentialEnv) unless they are among
+// them
+func withEnv(env, names, vals []string) []string {
+	set := make(map[string]bool, len(names)+len(credentialEnv))
+	for _, name := range slices.Concat(names, credentialEnv) {
+		set[name] = true
+	}
+
+	result := make([]string, 0, len(env)+len(names))
+	for _, v := range env {
+		if name, _, _ := strings.Cut(v, "="); !set[name] {
+			result = append(result, v)
+		}
+	}
+	for i, name := range names {
+		result = append(result, name+"="+vals[i])
+	}
+
+	return result
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestWithEnv(t *testing.T) {
+	env := []string{
+		"PATH=/usr/bin",
+		"DB_PASS=stale",
+		"DEPOT_PASS=password",
+		"DEPOT_PASS_COMMAND=pass show depot",
+		"DEPOT_TOKEN=token",
+		"DEPOT_PATH=/tmp/depot.db",
+	}
+
+	got := withEnv(env, []string{"DB_PASS", "API_TOKEN"}, []string{"secret", "abc"})
+	want := []string{"PATH=/usr/bin", "DEPOT_PATH=/tmp/depot.db", "DB_PASS=secret", "API_TOKEN=abc"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+
+	// Mapped explicitly, a credential is passed on like any other value
+	got = withEnv(env, []string{"DEPOT_TOKEN"}, []string{"child token"})
+	if !slices.Contains(got, "DEPOT_TOKEN=child token") || slices.Contains(got, "DEPOT_TOKEN=token") {
+		t.Errorf("expected only the mapped token but got %v", got)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Replaces depot with the command, which so gets its process ID, its
+// terminal, and its signals. Returns an error only if the command cannot be
+// started.
+func execCommand(argv, env []string) error {
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		return err
+	}
+
+	return syscall.Exec(path, argv, env)
+}
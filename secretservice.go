@@ -0,0 +1,784 @@
+//go:build unix
+
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Names in the freedesktop.org Secret Service API
+const (
+	ssBusName        = "org.freedesktop.secrets"
+	ssService        = "org.freedesktop.Secret.Service"
+	ssCollection     = "org.freedesktop.Secret.Collection"
+	ssItem           = "org.freedesktop.Secret.Item"
+	ssSession        = "org.freedesktop.Secret.Session"
+	ssPath           = dbusPath("/org/freedesktop/secrets")
+	ssCollectionPath = ssPath + "/collection/default"
+	ssAliasPath      = ssPath + "/aliases/default"
+	ssSessionPath    = ssPath + "/session/"
+	ssLabelProp      = ssItem + ".Label"
+	ssAttributesProp = ssItem + ".Attributes"
+	dbusProperties   = "org.freedesktop.DBus.Properties"
+
+	ssPlain = "plain"
+	ssDH    = "dh-ietf1024-sha256-aes128-cbc-pkcs7"
+)
+
+// Keys that items stored through the Secret Service are kept under begin
+// with this, followed by the item's ID
+const ssPrefix = "secret-service/"
+
+// The 1024-bit MODP group of RFC 2409, which the dh-ietf1024 algorithm uses
+var ssPrime, _ = new(big.Int).SetString(
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74"+
+		"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437"+
+		"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE65381FFFFFFFFFFFFFFFF", 16)
+
+// A Secret Service item as it is stowed, encrypted, under its key
+type ssStoredItem struct {
+	Label       string            `json:"label"`
+	Attributes  map[string]string `json:"attributes"`
+	Secret      []byte            `json:"secret"`
+	ContentType string            `json:"content_type"`
+	Created     time.Time         `json:"created"`
+
+	modified time.Time
+}
+
+// A D-Bus error to reply with
+type busError struct {
+	name string
+	text string
+}
+
+func (e *busError) Error() string {
+	return e.name + ": " + e.text
+}
+
+var (
+	errNoSuchObject = &busError{"org.freedesktop.Secret.Error.NoSuchObject", "no such object"}
+	errNoSession    = &busError{"org.freedesktop.Secret.Error.NoSession", "no such session"}
+	errIsLocked     = &busError{"org.freedesktop.Secret.Error.IsLocked", "the depot is locked"}
+	errUnknown      = &busError{"org.freedesktop.DBus.Error.UnknownMethod", "no such method"}
+	errReadOnly     = &busError{"org.freedesktop.DBus.Error.PropertyReadOnly", "the property cannot be set"}
+)
+
+// Serves the depot's secret-service/ keys as the default collection of the
+// Secret Service
+type secretService struct {
+	bus      *dbusConn
+	storage  *libdepot.Depot
+	opts     options
+	password []byte
+
+	// The items by ID, decrypted when first asked for and again if changed
+	items map[string]*ssStoredItem
+
+	// The AES keys of open sessions, or nil for those using the plain
+	// algorithm
+	sessions    map[dbusPath][]byte
+	lastSession int
+}
+
+// Serves the depot on the session bus as the freedesktop.org Secret Service,
+// in place of gnome-keyring or KWallet, until interrupted. Items that
+// applications store are kept encrypted under keys beginning with
+// secret-service/. The password is asked for once up front, and if the depot
+// is unlocked (see unlock) items can be read only while it stays unlocked.
+// Returns an error if unsuccessful.
+func serveSecretService(storage *libdepot.Depot, opts options) error {
+	password, err := getPassword(true, opts.hasKey())
+	if err != nil {
+		return err
+	}
+	keys, err := storage.List(ssPrefix + "*")
+	if err != nil {
+		return err
+	}
+	var stowed []string
+	for _, k := range keys {
+		stowed = append(stowed, k.Key)
+	}
+	if err = verifyAny(storage, stowed, password); err != nil {
+		return err
+	}
+
+	bus, err := dialSessionBus()
+	if err != nil {
+		return err
+	}
+	defer bus.Close()
+
+	const doNotQueue, primaryOwner, alreadyOwner = 4, 1, 4
+	reply, err := bus.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus",
+		"RequestName", "su", ssBusName, uint32(doNotQueue))
+	if err != nil {
+		return err
+	}
+	if r := reply[0].(uint32); r != primaryOwner && r != alreadyOwner {
+		return errors.New("another Secret Service, such as gnome-keyring, is already running")
+	}
+
+	var stopped atomic.Bool
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		stopped.Store(true)
+		bus.Close()
+	}()
+
+	log.Println("Serving the depot as the Secret Service until interrupted")
+	s := &secretService{
+		bus:      bus,
+		storage:  storage,
+		opts:     opts,
+		password: password,
+		items:    map[string]*ssStoredItem{},
+		sessions: map[dbusPath][]byte{},
+	}
+	for {
+		msg, err := bus.receive()
+		if stopped.Load() {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.typ != dbusMethodCall {
+			continue
+		}
+
+		sig, body, err := s.handle(msg)
+		var be *busError
+		if errors.As(err, &be) {
+			err = bus.replyError(msg, be.name, be.text)
+		} else if err != nil {
+			err = bus.replyError(msg, "org.freedesktop.DBus.Error.Failed", err.Error())
+		} else {
+			err = bus.reply(msg, sig, body...)
+		}
+		if err != nil && !stopped.Load() {
+			return err
+		}
+	}
+}
+
+// Answers the method call with a body and its signature, or an error to reply
+// with
+func (s *secretService) handle(msg *dbusMessage) (string, []any, error) {
+	if msg.iface == dbusProperties {
+		return s.handleProperties(msg)
+	}
+
+	switch {
+	case msg.path == ssPath && (msg.iface == ssService || msg.iface == ""):
+		return s.handleService(msg)
+	case (msg.path == ssCollectionPath || msg.path == ssAliasPath) && (msg.iface == ssCollection || msg.iface == ""):
+		return s.handleCollection(msg)
+	case strings.HasPrefix(string(msg.path), string(ssCollectionPath)+"/") && (msg.iface == ssItem || msg.iface == ""):
+		return s.handleItem(msg, strings.TrimPrefix(string(msg.path), string(ssCollectionPath)+"/"))
+	case strings.HasPrefix(string(msg.path), string(ssSessionPath)) && (msg.iface == ssSession || msg.iface == "") && msg.member == "Close":
+		if _, ok := s.sessions[msg.path]; !ok {
+			return "", nil, errNoSession
+		}
+		clear(s.sessions[msg.path])
+		delete(s.sessions, msg.path)
+		return "", nil, nil
+	}
+
+	return "", nil, errUnknown
+}
+
+// Checks that the method call's arguments have the signature sig
+func checkArgs(msg *dbusMessage, sig string) error {
+	if msg.sig != sig {
+		return &busError{"org.freedesktop.DBus.Error.InvalidArgs",
+			fmt.Sprintf("%v takes arguments of type %q, not %q", msg.member, sig, msg.sig)}
+	}
+
+	return nil
+}
+
+func (s *secretService) handleService(msg *dbusMessage) (string, []any, error) {
+	switch msg.member {
+	case "OpenSession":
+		if err := checkArgs(msg, "sv"); err != nil {
+			return "", nil, err
+		}
+		output, key, err := openSSSession(msg.body[0].(string), msg.body[1].(dbusVariant))
+		if err != nil {
+			return "", nil, err
+		}
+		s.lastSession++
+		path := ssSessionPath + dbusPath(strconv.Itoa(s.lastSession))
+		s.sessions[path] = key
+		return "vo", []any{output, path}, nil
+	case "CreateCollection":
+		// There is only the one collection
+		return "oo", []any{ssCollectionPath, dbusPath("/")}, nil
+	case "SearchItems":
+		if err := checkArgs(msg, "a{ss}"); err != nil {
+			return "", nil, err
+		}
+		found, err := s.search(stringMap(msg.body[0]))
+		if err != nil {
+			return "", nil, err
+		}
+		if s.locked() {
+			return "aoao", []any{[]dbusPath{}, found}, nil
+		}
+		return "aoao", []any{found, []dbusPath{}}, nil
+	case "Unlock":
+		if err := checkArgs(msg, "ao"); err != nil {
+			return "", nil, err
+		}
+		// The depot can only be unlocked with depot unlock
+		if s.locked() {
+			return "aoo", []any{[]dbusPath{}, dbusPath("/")}, nil
+		}
+		return "aoo", []any{msg.body[0], dbusPath("/")}, nil
+	case "Lock":
+		// Nor locked but with depot lock
+		return "aoo", []any{[]dbusPath{}, dbusPath("/")}, nil
+	case "GetSecrets":
+		if err := checkArgs(msg, "aoo"); err != nil {
+			return "", nil, err
+		}
+		secrets := map[dbusPath]any{}
+		for _, p := range msg.body[0].([]any) {
+			id, ok := strings.CutPrefix(string(p.(dbusPath)), string(ssCollectionPath)+"/")
+			if !ok {
+				continue
+			}
+			secret, err := s.secret(id, msg.body[1].(dbusPath))
+			if errors.Is(err, errNoSuchObject) {
+				continue
+			} else if err != nil {
+				return "", nil, err
+			}
+			secrets[p.(dbusPath)] = secret
+		}
+		return "a{o(oayays)}", []any{secrets}, nil
+	case "ReadAlias":
+		if err := checkArgs(msg, "s"); err != nil {
+			return "", nil, err
+		}
+		if msg.body[0].(string) == "default" {
+			return "o", []any{ssCollectionPath}, nil
+		}
+		return "o", []any{dbusPath("/")}, nil
+	case "SetAlias":
+		if err := checkArgs(msg, "so"); err != nil {
+			return "", nil, err
+		}
+		if msg.body[0].(string) == "default" && msg.body[1].(dbusPath) == ssCollectionPath {
+			return "", nil, nil
+		}
+		return "", nil, &busError{"org.freedesktop.DBus.Error.NotSupported", "the depot has only the default collection"}
+	}
+
+	return "", nil, errUnknown
+}
+
+func (s *secretService) handleCollection(msg *dbusMessage) (string, []any, error) {
+	switch msg.member {
+	case "Delete":
+		return "", nil, &busError{"org.freedesktop.DBus.Error.NotSupported", "the depot's collection cannot be deleted"}
+	case "SearchItems":
+		if err := checkArgs(msg, "a{ss}"); err != nil {
+			return "", nil, err
+		}
+		found, err := s.search(stringMap(msg.body[0]))
+		if err != nil {
+			return "", nil, err
+		}
+		return "ao", []any{found}, nil
+	case "CreateItem":
+		if err := checkArgs(msg, "a{sv}(oayays)b"); err != nil {
+			return "", nil, err
+		}
+		path, err := s.createItem(msg.body[0].(map[any]any), msg.body[1].([]any), msg.body[2].(bool))
+		if err != nil {
+			return "", nil, err
+		}
+		return "oo", []any{path, dbusPath("/")}, nil
+	}
+
+	return "", nil, errUnknown
+}
+
+func (s *secretService) handleItem(msg *dbusMessage, id string) (string, []any, error) {
+	if err := s.refresh(); err != nil {
+		return "", nil, err
+	}
+	item, ok := s.items[id]
+	if !ok {
+		return "", nil, errNoSuchObject
+	}
+
+	switch msg.member {
+	case "Delete":
+		if err := s.storage.Drop(ssPrefix + id); err != nil {
+			return "", nil, err
+		}
+		delete(s.items, id)
+		s.bus.signal(ssCollectionPath, ssCollection, "ItemDeleted", "o", msg.path)
+		return "o", []any{dbusPath("/")}, nil
+	case "GetSecret":
+		if err := checkArgs(msg, "o"); err != nil {
+			return "", nil, err
+		}
+		secret, err := s.secret(id, msg.body[0].(dbusPath))
+		if err != nil {
+			return "", nil, err
+		}
+		return "(oayays)", []any{secret}, nil
+	case "SetSecret":
+		if err := checkArgs(msg, "(oayays)"); err != nil {
+			return "", nil, err
+		}
+		val, contentType, err := s.decodeSecret(msg.body[0].([]any))
+		if err != nil {
+			return "", nil, err
+		}
+		changed := *item
+		changed.Secret, changed.ContentType = val, contentType
+		return "", nil, s.stow(id, &changed)
+	}
+
+	return "", nil, errUnknown
+}
+
+func (s *secretService) handleProperties(msg *dbusMessage) (string, []any, error) {
+	switch msg.member {
+	case "Get":
+		if err := checkArgs(msg, "ss"); err != nil {
+			return "", nil, err
+		}
+		props, err := s.properties(msg.path, msg.body[0].(string))
+		if err != nil {
+			return "", nil, err
+		}
+		prop, ok := props[msg.body[1].(string)]
+		if !ok {
+			return "", nil, &busError{"org.freedesktop.DBus.Error.UnknownProperty", "no such property"}
+		}
+		return "v", []any{prop}, nil
+	case "GetAll":
+		if err := checkArgs(msg, "s"); err != nil {
+			return "", nil, err
+		}
+		props, err := s.properties(msg.path, msg.body[0].(string))
+		if err != nil {
+			return "", nil, err
+		}
+		return "a{sv}", []any{props}, nil
+	case "Set":
+		if err := checkArgs(msg, "ssv"); err != nil {
+			return "", nil, err
+		}
+		id, ok := strings.CutPrefix(string(msg.path), string(ssCollectionPath)+"/")
+		if !ok || msg.body[0].(string) != ssItem {
+			return "", nil, errReadOnly
+		}
+		if err := s.refresh(); err != nil {
+			return "", nil, err
+		}
+		item, ok := s.items[id]
+		if !ok {
+			return "", nil, errNoSuchObject
+		}
+		changed := *item
+		val := msg.body[2].(dbusVariant).value
+		switch msg.body[1].(string) {
+		case "Label":
+			changed.Label, _ = val.(string)
+		case "Attributes":
+			changed.Attributes = stringMap(val)
+		default:
+			return "", nil, errReadOnly
+		}
+		return "", nil, s.stow(id, &changed)
+	}
+
+	return "", nil, errUnknown
+}
+
+// Returns the properties of the interface iface of the object at path, or an
+// error if there is no such object
+func (s *secretService) properties(path dbusPath, iface string) (map[string]dbusVariant, error) {
+	switch {
+	case path == ssPath && iface == ssService:
+		return map[string]dbusVariant{"Collections": {"ao", []dbusPath{ssCollectionPath}}}, nil
+	case (path == ssCollectionPath || path == ssAliasPath) && iface == ssCollection:
+		if err := s.refresh(); err != nil {
+			return nil, err
+		}
+		var created, modified time.Time
+		for _, item := range s.items {
+			if created.IsZero() || item.Created.Before(created) {
+				created = item.Created
+			}
+			if item.modified.After(modified) {
+				modified = item.modified
+			}
+		}
+		return map[string]dbusVariant{
+			"Items":    {"ao", s.paths(s.ids())},
+			"Label":    {"s", "depot"},
+			"Locked":   {"b", s.locked()},
+			"Created":  {"t", unixTime(created)},
+			"Modified": {"t", unixTime(modified)},
+		}, nil
+	case strings.HasPrefix(string(path), string(ssCollectionPath)+"/") && iface == ssItem:
+		if err := s.refresh(); err != nil {
+			return nil, err
+		}
+		item, ok := s.items[strings.TrimPrefix(string(path), string(ssCollectionPath)+"/")]
+		if !ok {
+			return nil, errNoSuchObject
+		}
+		return map[string]dbusVariant{
+			"Locked":     {"b", s.locked()},
+			"Attributes": {"a{ss}", item.Attributes},
+			"Label":      {"s", item.Label},
+			"Created":    {"t", unixTime(item.Created)},
+			"Modified":   {"t", unixTime(item.modified)},
+		}, nil
+	}
+
+	return nil, errNoSuchObject
+}
+
+// Reports whether the depot was unlocked when served and has since been
+// locked, in which case secrets cannot be read or stored
+func (s *secretService) locked() bool {
+	return lockedAgain(s.opts)
+}
+
+// Brings the items up to date with the depot, decrypting those that are new
+// or have changed. Returns an error if unsuccessful.
+func (s *secretService) refresh() error {
+	keys, err := s.storage.List("")
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	for _, k := range keys {
+		id, ok := strings.CutPrefix(k.Key, ssPrefix)
+		if !ok || k.Alias != "" {
+			continue
+		}
+		seen[id] = true
+		if item, ok := s.items[id]; ok && item.modified.Equal(k.Modified) {
+			continue
+		}
+		if s.locked() {
+			return errIsLocked
+		}
+
+		val, err := s.storage.Fetch(k.Key, s.password)
+		if errors.Is(err, libdepot.ErrBadPassword) {
+			// Stowed under another password, so not one of ours
+			continue
+		} else if err != nil {
+			return err
+		}
+		var item ssStoredItem
+		if err = json.Unmarshal([]byte(val), &item); err != nil {
+			log.Printf("Warning: %v does not hold a Secret Service item: %v\n", k.Key, err)
+			continue
+		}
+		item.modified = k.Modified
+		s.items[id] = &item
+	}
+	for id := range s.items {
+		if !seen[id] {
+			delete(s.items, id)
+		}
+	}
+
+	return nil
+}
+
+// Returns the IDs of every item, sorted
+func (s *secretService) ids() []string {
+	ids := make([]string, 0, len(s.items))
+	for id := range s.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Returns the object paths of the items with the given IDs
+func (s *secretService) paths(ids []string) []dbusPath {
+	paths := make([]dbusPath, len(ids))
+	for i, id := range ids {
+		paths[i] = ssCollectionPath + "/" + dbusPath(id)
+	}
+
+	return paths
+}
+
+// Returns the paths of the items with all the given attributes, or an error
+// if unsuccessful
+func (s *secretService) search(attrs map[string]string) ([]dbusPath, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+
+	var found []string
+	for _, id := range s.ids() {
+		if matchAttributes(s.items[id].Attributes, attrs) {
+			found = append(found, id)
+		}
+	}
+
+	return s.paths(found), nil
+}
+
+// Reports whether have includes every attribute in want with the same value
+func matchAttributes(have, want map[string]string) bool {
+	for name, val := range want {
+		if v, ok := have[name]; !ok || v != val {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Stores a new item with the properties and secret given, or with replace
+// replaces the one with the same attributes. Returns the item's path or an
+// error if unsuccessful.
+func (s *secretService) createItem(props map[any]any, secret []any, replace bool) (dbusPath, error) {
+	val, contentType, err := s.decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	item := &ssStoredItem{Attributes: map[string]string{}, Secret: val, ContentType: contentType, Created: time.Now()}
+	if v, ok := props[ssLabelProp].(dbusVariant); ok {
+		item.Label, _ = v.value.(string)
+	}
+	if v, ok := props[ssAttributesProp].(dbusVariant); ok {
+		item.Attributes = stringMap(v.value)
+	}
+
+	if err = s.refresh(); err != nil {
+		return "", err
+	}
+	var id string
+	if replace {
+		for _, existing := range s.ids() {
+			have := s.items[existing].Attributes
+			if len(have) == len(item.Attributes) && matchAttributes(have, item.Attributes) {
+				id, item.Created = existing, s.items[existing].Created
+				break
+			}
+		}
+	}
+	if id == "" {
+		b := make([]byte, 8)
+		if _, err = rand.Read(b); err != nil {
+			return "", err
+		}
+		id = hex.EncodeToString(b)
+	}
+	if err = s.stow(id, item); err != nil {
+		return "", err
+	}
+
+	return ssCollectionPath + "/" + dbusPath(id), nil
+}
+
+// Stows the item under its ID and announces that it was created or changed.
+// Returns an error if unsuccessful.
+func (s *secretService) stow(id string, item *ssStoredItem) error {
+	if s.locked() {
+		return errIsLocked
+	}
+	val, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err = s.storage.Stow(ssPrefix+id, string(val), s.password); err != nil {
+		return err
+	}
+
+	member := "ItemChanged"
+	if _, ok := s.items[id]; !ok {
+		member = "ItemCreated"
+	}
+	// Picked up again, with when it was modified, on the next refresh
+	delete(s.items, id)
+
+	return s.bus.signal(ssCollectionPath, ssCollection, member, "o", ssCollectionPath+"/"+dbusPath(id))
+}
+
+// Returns the secret of the item with the given ID as a Secret struct for the
+// session, or an error if unsuccessful
+func (s *secretService) secret(id string, session dbusPath) ([]any, error) {
+	key, ok := s.sessions[session]
+	if !ok {
+		return nil, errNoSession
+	}
+	if s.locked() {
+		return nil, errIsLocked
+	}
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	item, ok := s.items[id]
+	if !ok {
+		return nil, errNoSuchObject
+	}
+
+	params, val := []byte{}, item.Secret
+	if key != nil {
+		var err error
+		if params, val, err = ssEncrypt(key, val); err != nil {
+			return nil, err
+		}
+	}
+	contentType := item.ContentType
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+
+	return []any{session, params, val, contentType}, nil
+}
+
+// Returns the value and content type of a Secret struct, decrypted for the
+// session it names, or an error if unsuccessful
+func (s *secretService) decodeSecret(secret []any) ([]byte, string, error) {
+	session := secret[0].(dbusPath)
+	key, ok := s.sessions[session]
+	if !ok {
+		return nil, "", errNoSession
+	}
+	params, val, contentType := secret[1].([]byte), secret[2].([]byte), secret[3].(string)
+	if key == nil {
+		return val, contentType, nil
+	}
+
+	val, err := ssDecrypt(key, params, val)
+	return val, contentType, err
+}
+
+// Agrees on how secrets are passed in a new session using the algorithm
+// requested and the client's input. Returns the output for the client, the
+// AES key for the session or nil for the plain algorithm, or an error if the
+// algorithm is not supported.
+func openSSSession(algorithm string, input dbusVariant) (dbusVariant, []byte, error) {
+	switch algorithm {
+	case ssPlain:
+		return dbusVariant{"s", ""}, nil, nil
+	case ssDH:
+		clientPublic, ok := input.value.([]byte)
+		if !ok {
+			return dbusVariant{}, nil, &busError{"org.freedesktop.DBus.Error.InvalidArgs", "expected a public key"}
+		}
+		private, err := rand.Int(rand.Reader, ssPrime)
+		if err != nil {
+			return dbusVariant{}, nil, err
+		}
+		public := new(big.Int).Exp(big.NewInt(2), private, ssPrime)
+		shared := new(big.Int).Exp(new(big.Int).SetBytes(clientPublic), private, ssPrime)
+
+		key := make([]byte, 16)
+		if _, err = io.ReadFull(hkdf.New(sha256.New, shared.FillBytes(make([]byte, 128)), nil, nil), key); err != nil {
+			return dbusVariant{}, nil, err
+		}
+		return dbusVariant{"ay", public.Bytes()}, key, nil
+	}
+
+	return dbusVariant{}, nil, &busError{"org.freedesktop.DBus.Error.NotSupported", "unsupported algorithm: " + algorithm}
+}
+
+// Encrypts val with AES-128-CBC and PKCS#7 padding, returning the IV and the
+// ciphertext or an error if unsuccessful
+func ssEncrypt(key, val []byte) ([]byte, []byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err = rand.Read(iv); err != nil {
+		return nil, nil, err
+	}
+	pad := aes.BlockSize - len(val)%aes.BlockSize
+	out := append([]byte(nil), val...)
+	for i := 0; i < pad; i++ {
+		out = append(out, byte(pad))
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, out)
+
+	return iv, out, nil
+}
+
+// Reverses ssEncrypt, returning the value or an error if unsuccessful
+func ssDecrypt(key, iv, val []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize || len(val) == 0 || len(val)%aes.BlockSize != 0 {
+		return nil, &busError{"org.freedesktop.DBus.Error.InvalidArgs", "malformed encrypted secret"}
+	}
+	out := make([]byte, len(val))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, val)
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return nil, &busError{"org.freedesktop.DBus.Error.InvalidArgs", "malformed encrypted secret"}
+	}
+
+	return out[:len(out)-pad], nil
+}
+
+// Returns a decoded a{ss} as a map of strings
+func stringMap(v any) map[string]string {
+	m := map[string]string{}
+	d, _ := v.(map[any]any)
+	for k, v := range d {
+		ks, _ := k.(string)
+		vs, _ := v.(string)
+		m[ks] = vs
+	}
+
+	return m
+}
+
+// Returns t as seconds since the epoch, or 0 if it is the zero time
+func unixTime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return uint64(t.Unix())
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+func serveSecretService(storage *libdepot.Depot, opts options) error {
+	return fmt.Errorf("the Secret Service needs D-Bus: %w", errors.ErrUnsupported)
+}
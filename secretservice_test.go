@@ -0,0 +1,163 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Returns a Secret Service over an in-memory depot holding the given items,
+// stowed under their IDs, with no bus to signal on
+func newTestSecretService(t *testing.T, items map[string]*ssStoredItem) *secretService {
+	t.Helper()
+	storage, err := libdepot.NewMemDepot()
+	if err != nil {
+		t.Fatalf("error creating depot: %v", err)
+	}
+	password := []byte("password")
+	for id, item := range items {
+		val, _ := json.Marshal(item)
+		if err = storage.Stow(ssPrefix+id, string(val), password); err != nil {
+			t.Fatalf("error stowing %v: %v", id, err)
+		}
+	}
+
+	return &secretService{
+		storage:  storage,
+		password: password,
+		items:    map[string]*ssStoredItem{},
+		sessions: map[dbusPath][]byte{},
+	}
+}
+
+func ssCall(path dbusPath, iface, member, sig string, body ...any) *dbusMessage {
+	return &dbusMessage{typ: dbusMethodCall, path: path, iface: iface, member: member, sig: sig, body: body}
+}
+
+func TestSecretServiceOpenSession(t *testing.T) {
+	s := newTestSecretService(t, nil)
+
+	sig, body, err := s.handle(ssCall(ssPath, ssService, "OpenSession", "sv", ssPlain, dbusVariant{"s", ""}))
+	if err != nil || sig != "vo" {
+		t.Fatalf("expected a plain session but got %q (%v)", sig, err)
+	}
+	if !reflect.DeepEqual(body, []any{dbusVariant{"s", ""}, ssSessionPath + "1"}) {
+		t.Errorf("expected no output and the first session but got %v", body)
+	}
+	if key, ok := s.sessions[ssSessionPath+"1"]; !ok || key != nil {
+		t.Errorf("expected a session with no key but got %x (%v)", key, ok)
+	}
+
+	private, _ := rand.Int(rand.Reader, ssPrime)
+	public := new(big.Int).Exp(big.NewInt(2), private, ssPrime)
+	_, body, err = s.handle(ssCall(ssPath, ssService, "OpenSession", "sv", ssDH, dbusVariant{"ay", public.Bytes()}))
+	if err != nil {
+		t.Fatalf("error opening a session: %v", err)
+	}
+	output := body[0].(dbusVariant).value.([]byte)
+	shared := new(big.Int).Exp(new(big.Int).SetBytes(output), private, ssPrime)
+	key := make([]byte, 16)
+	io.ReadFull(hkdf.New(sha256.New, shared.FillBytes(make([]byte, 128)), nil, nil), key)
+	if body[1] != ssSessionPath+"2" || !bytes.Equal(s.sessions[ssSessionPath+"2"], key) {
+		t.Errorf("expected both sides to agree on the key of the second session")
+	}
+
+	_, _, err = s.handle(ssCall(ssPath, ssService, "OpenSession", "sv", "rot13", dbusVariant{"s", ""}))
+	var be *busError
+	if !errors.As(err, &be) || be.name != "org.freedesktop.DBus.Error.NotSupported" {
+		t.Errorf("expected an unsupported algorithm to be refused but got %v", err)
+	}
+	if _, _, err = s.handle(ssCall(ssPath, ssService, "OpenSession", "s", ssPlain)); !errors.As(err, &be) {
+		t.Errorf("expected the wrong arguments to be refused but got %v", err)
+	}
+}
+
+func TestSecretServiceSearchItems(t *testing.T) {
+	s := newTestSecretService(t, map[string]*ssStoredItem{
+		"a": {Label: "git", Attributes: map[string]string{"service": "git", "user": "me"}, Secret: []byte("1")},
+		"b": {Label: "mail", Attributes: map[string]string{"service": "mail", "user": "me"}, Secret: []byte("2")},
+	})
+
+	tests := []struct {
+		attrs map[any]any
+		want  []dbusPath
+	}{
+		{map[any]any{"service": "git"}, []dbusPath{ssCollectionPath + "/a"}},
+		{map[any]any{"user": "me"}, []dbusPath{ssCollectionPath + "/a", ssCollectionPath + "/b"}},
+		{map[any]any{"service": "git", "user": "you"}, []dbusPath{}},
+		{map[any]any{}, []dbusPath{ssCollectionPath + "/a", ssCollectionPath + "/b"}},
+	}
+	for _, tt := range tests {
+		sig, body, err := s.handle(ssCall(ssPath, ssService, "SearchItems", "a{ss}", tt.attrs))
+		if err != nil || sig != "aoao" {
+			t.Fatalf("expected unlocked and locked items but got %q (%v)", sig, err)
+		}
+		if !reflect.DeepEqual(body, []any{tt.want, []dbusPath{}}) {
+			t.Errorf("expected %v unlocked for %v but got %v", tt.want, tt.attrs, body)
+		}
+
+		_, body, err = s.handle(ssCall(ssCollectionPath, ssCollection, "SearchItems", "a{ss}", tt.attrs))
+		if err != nil || !reflect.DeepEqual(body, []any{tt.want}) {
+			t.Errorf("expected %v in the collection for %v but got %v (%v)", tt.want, tt.attrs, body, err)
+		}
+	}
+}
+
+func TestSecretServiceGetSecret(t *testing.T) {
+	s := newTestSecretService(t, map[string]*ssStoredItem{
+		"a": {Label: "git", Secret: []byte("hunter2"), Created: time.Now()},
+		"b": {Label: "cert", Secret: []byte("-----BEGIN"), ContentType: "application/x-pem-file"},
+	})
+	plain, aes := dbusPath(ssSessionPath+"1"), dbusPath(ssSessionPath+"2")
+	key := bytes.Repeat([]byte{7}, 16)
+	s.sessions[plain], s.sessions[aes] = nil, key
+
+	sig, body, err := s.handle(ssCall(ssCollectionPath+"/a", ssItem, "GetSecret", "o", plain))
+	if err != nil || sig != "(oayays)" {
+		t.Fatalf("expected a secret but got %q (%v)", sig, err)
+	}
+	if want := []any{plain, []byte{}, []byte("hunter2"), "text/plain"}; !reflect.DeepEqual(body[0], want) {
+		t.Errorf("expected %v but got %v", want, body[0])
+	}
+
+	_, body, err = s.handle(ssCall(ssCollectionPath+"/b", ssItem, "GetSecret", "o", aes))
+	if err != nil {
+		t.Fatalf("error getting secret: %v", err)
+	}
+	secret := body[0].([]any)
+	val, err := ssDecrypt(key, secret[1].([]byte), secret[2].([]byte))
+	if err != nil || string(val) != "-----BEGIN" || secret[3] != "application/x-pem-file" {
+		t.Errorf("expected the secret encrypted for the session but got %q %v (%v)", val, secret[3], err)
+	}
+
+	_, _, err = s.handle(ssCall(ssCollectionPath+"/a", ssItem, "GetSecret", "o", dbusPath(ssSessionPath+"9")))
+	if !errors.Is(err, errNoSession) {
+		t.Errorf("expected %v but got %v", errNoSession, err)
+	}
+	_, _, err = s.handle(ssCall(ssCollectionPath+"/c", ssItem, "GetSecret", "o", plain))
+	if !errors.Is(err, errNoSuchObject) {
+		t.Errorf("expected %v but got %v", errNoSuchObject, err)
+	}
+
+	sig, body, err = s.handle(ssCall(ssPath, ssService, "GetSecrets", "aoo",
+		[]any{ssCollectionPath + "/a", ssCollectionPath + "/c"}, plain))
+	if err != nil || sig != "a{o(oayays)}" {
+		t.Fatalf("expected secrets but got %q (%v)", sig, err)
+	}
+	secrets := body[0].(map[dbusPath]any)
+	if len(secrets) != 1 || secrets[ssCollectionPath+"/a"] == nil {
+		t.Errorf("expected only the secret that exists but got %v", secrets)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Serves the depot over HTTP, or HTTPS if a certificate was given, over gRPC
+// as well if --grpc-addr was given, and to the Kubernetes Secrets Store CSI
+// driver if --csi-socket was given, until interrupted. Returns an error
+// if the server cannot run.
+func serve(storage *libdepot.Depot, opts options) error {
+	token := os.Getenv(envToken)
+	if token == "" {
+		return errors.New(envToken + " must be set to serve a depot")
+	}
+	if (opts.tlsCert == "") != (opts.tlsKey == "") {
+		return errors.New("--tls-cert and --tls-key must be given together")
+	}
+
+	srv := &http.Server{
+		Addr:              opts.addr,
+		Handler:           libdepot.NewServer(storage, token),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	var grpcSrv *grpc.Server
+	if opts.grpcAddr != "" {
+		var grpcOpts []grpc.ServerOption
+		if opts.tlsCert != "" {
+			creds, err := credentials.NewServerTLSFromFile(opts.tlsCert, opts.tlsKey)
+			if err != nil {
+				return err
+			}
+			grpcOpts = append(grpcOpts, grpc.Creds(creds))
+		} else if !isLoopback(opts.grpcAddr) {
+			log.Printf("Warning: serving gRPC without TLS exposes passwords and tokens to the network\n")
+		}
+
+		l, err := net.Listen("tcp", opts.grpcAddr)
+		if err != nil {
+			return err
+		}
+		grpcSrv = libdepot.NewGRPCServer(storage, token, grpcOpts...)
+		log.Printf("Serving depot over gRPC on %v\n", opts.grpcAddr)
+		go grpcSrv.Serve(l)
+	}
+
+	var csiSrv *grpc.Server
+	if opts.csiSocket != "" {
+		if err := removeStaleSocket(opts.csiSocket); err != nil {
+			return err
+		}
+		l, err := net.Listen("unix", opts.csiSocket)
+		if err != nil {
+			return err
+		}
+		csiSrv = libdepot.NewCSIProvider(storage, token)
+		log.Printf("Serving depot to the Secrets Store CSI driver on %v\n", opts.csiSocket)
+		go csiSrv.Serve(l)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if grpcSrv != nil {
+			grpcSrv.GracefulStop()
+		}
+		if csiSrv != nil {
+			csiSrv.GracefulStop()
+		}
+		srv.Shutdown(shutdown)
+	}()
+
+	var err error
+	if opts.tlsCert != "" {
+		log.Printf("Serving depot on https://%v\n", opts.addr)
+		err = srv.ListenAndServeTLS(opts.tlsCert, opts.tlsKey)
+	} else {
+		if !isLoopback(opts.addr) {
+			log.Printf("Warning: serving without TLS exposes passwords and tokens to the network\n")
+		}
+		log.Printf("Serving depot on http://%v\n", opts.addr)
+		err = srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// Reports whether the address only listens on the local machine
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Removes the socket at path left by a provider that didn't shut down
+// cleanly, which would keep this one from listening. Returns an error if
+// something other than a socket is there, which is left alone, or if it
+// cannot be removed.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if info.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("%v exists and is not a socket", path)
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,46 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+	if err := removeStaleSocket(filepath.Join(dir, "missing.sock")); err != nil {
+		t.Errorf("expected nothing to remove to be fine but got %v", err)
+	}
+
+	sock := filepath.Join(dir, "csi.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if err = removeStaleSocket(sock); err != nil {
+		t.Errorf("expected a stale socket to be removed but got %v", err)
+	}
+	if _, err = os.Lstat(sock); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the socket to be gone but got %v", err)
+	}
+
+	file := filepath.Join(dir, "important")
+	os.WriteFile(file, []byte("keep me"), 0600)
+	if err = removeStaleSocket(file); err == nil {
+		t.Errorf("expected an error for a regular file")
+	}
+	link := filepath.Join(dir, "link.sock")
+	os.Symlink(file, link)
+	if err = removeStaleSocket(link); err == nil {
+		t.Errorf("expected an error for a symbolic link")
+	}
+	if data, err := os.ReadFile(file); err != nil || string(data) != "keep me" {
+		t.Errorf("expected the file to be left alone but got %q (%v)", data, err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// How long a share lasts unless --expires says otherwise
+const defaultShareExpiry = time.Hour
+
+// Shares the value of the key for --expires, to be fetched at most --uses
+// times, and prints the link to it, if the depot is served, or otherwise the
+// token that depot serve hands it out for. Returns an error if unsuccessful.
+func share(storage *libdepot.Depot, opts options) error {
+	expires, uses := defaultShareExpiry, 1
+	if opts.expires != "" {
+		d, err := parseAge(opts.expires)
+		if err != nil {
+			return err
+		}
+		expires = d
+	}
+	if opts.uses != "" {
+		n, err := strconv.Atoi(opts.uses)
+		if err != nil {
+			return fmt.Errorf("invalid number of uses: %v", opts.uses)
+		}
+		uses = n
+	}
+
+	token, err := storage.Share(opts.key, nil, expires, uses)
+	if errors.Is(err, libdepot.ErrPasswordNeeded) {
+		var password []byte
+		if password, err = getPassword(true, opts.hasKey()); err != nil {
+			return err
+		}
+		token, err = storage.Share(opts.key, password, expires, uses)
+	}
+	if err != nil {
+		return err
+	}
+
+	path, err := choosePath()
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		fmt.Println(strings.TrimSuffix(path, "/") + "/v1/shares/" + token)
+		return nil
+	}
+	fmt.Println(token)
+	log.Printf("Serve the depot with depot %v to hand it out at /v1/shares/<token>\n", actServe)
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// How old a value without a rotation period may get before stale lists it,
+// unless --older-than says otherwise
+const defaultMaxAge = 90 * 24 * time.Hour
+
+// Returns the duration described by s, either as time.ParseDuration takes it
+// (36h) or a whole number of days or weeks (90d, 2w), or an error if it is
+// neither
+func parseAge(s string) (time.Duration, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			if count, err := strconv.Atoi(n); err == nil && count >= 0 {
+				return time.Duration(count) * unit, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("invalid duration: %v (expected one such as 90d, 2w, or 36h)", s)
+}
+
+// Returns d in whole days if it is at least one, as parseAge takes it
+func formatAge(d time.Duration) string {
+	if d >= 24*time.Hour {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+
+	return d.Truncate(time.Second).String()
+}
+
+// Returns what list and info say about the rotation period of the key, or ""
+// if it has none
+func rotationNote(k libdepot.KeyInfo) string {
+	due := k.RotationDue()
+	if due.IsZero() {
+		return ""
+	} else if left := time.Until(due); left > 0 {
+		return fmt.Sprintf("every %v, due in %v", formatAge(k.Rotation), formatAge(left))
+	}
+
+	return fmt.Sprintf("every %v, overdue by %v", formatAge(k.Rotation), formatAge(-time.Until(due)))
+}
+
+// Sets the rotation period of the key to the one given after it, or forgets
+// it if that is off. Returns an error if unsuccessful.
+func setRotation(storage *libdepot.Depot, opts options) error {
+	var period time.Duration
+	if arg := opts.extraKeys[0]; arg != "off" {
+		var err error
+		if period, err = parseAge(arg); err != nil {
+			return err
+		} else if period <= 0 {
+			return fmt.Errorf("rotation period must be positive, or off")
+		}
+	}
+
+	return storage.SetRotation(opts.key, period)
+}
+
+// Prints the keys matching the given pattern, or every key, that are due to
+// be replaced according to their rotation periods or, for those without one,
+// were last modified longer ago than --older-than, oldest first, as a JSON
+// array with --format json. Returns an error if unsuccessful.
+func listStale(storage *libdepot.Depot, opts options) error {
+	if opts.format != "" && opts.format != libdepot.FormatJSON {
+		return fmt.Errorf("invalid format for stale: %v", opts.format)
+	}
+	maxAge := defaultMaxAge
+	if opts.olderThan != "" {
+		var err error
+		if maxAge, err = parseAge(opts.olderThan); err != nil {
+			return err
+		}
+	}
+
+	keys, err := storage.Stale(opts.key, maxAge)
+	if err != nil {
+		return err
+	}
+	if opts.format == libdepot.FormatJSON {
+		return printJSON(keys)
+	}
+
+	for _, k := range keys {
+		note := fmt.Sprintf("%v old", formatAge(time.Since(k.Modified)))
+		if k.Rotation > 0 {
+			note = "rotate " + rotationNote(k)
+		}
+		fmt.Printf("%v  %v  (%v)\n", k.Modified.Local().Format(time.DateTime), k.Key, note)
+	}
+
+	return nil
+}
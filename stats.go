@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Prints a summary of the depot: how many keys it holds and how many are
+// encrypted, how much space they take up overall and under each namespace,
+// when the oldest and newest were modified, and what the values are sealed
+// with and stored in, as a JSON object with --format json. Returns an error
+// if unsuccessful.
+func printStats(storage *libdepot.Depot, opts options) error {
+	if opts.format != "" && opts.format != libdepot.FormatJSON {
+		return fmt.Errorf("invalid format for stats: %v", opts.format)
+	}
+	stats, err := storage.Stats()
+	if err != nil {
+		return err
+	}
+
+	if opts.format == libdepot.FormatJSON {
+		return printJSON(stats)
+	}
+
+	fmt.Printf("keys:          %v (%v encrypted, %v plain text)\n", stats.Keys, stats.Encrypted, stats.Keys-stats.Encrypted)
+	fmt.Printf("aliases:       %v\n", stats.Aliases)
+	fmt.Printf("tombstones:    %v\n", stats.Tombstones)
+	fmt.Printf("value size:    %v\n", formatSize(stats.Size))
+	if stats.Keys > 0 {
+		fmt.Printf("oldest:        %v\n", stats.Oldest.Local().Format(time.DateTime))
+		fmt.Printf("newest:        %v\n", stats.Newest.Local().Format(time.DateTime))
+	}
+	for _, cipher := range slices.Sorted(maps.Keys(stats.Ciphers)) {
+		name := cipher
+		if name == libdepot.CipherAESGCM {
+			name = "aes-256-gcm"
+		}
+		fmt.Printf("sealed by:     %v (%v)\n", name, stats.Ciphers[cipher])
+	}
+	if stats.Unchecked > 0 {
+		fmt.Printf("unchecked:     %v (run depot migrate to add key checks)\n", stats.Unchecked)
+	}
+	fmt.Printf("backend:       %v\n", stats.Backend)
+	if stats.StorageSize >= 0 {
+		fmt.Printf("storage size:  %v\n", formatSize(stats.StorageSize))
+	}
+	if stats.SchemaVersion > 0 {
+		fmt.Printf("schema:        %v\n", stats.SchemaVersion)
+	}
+
+	if len(stats.Prefixes) > 0 {
+		fmt.Println("prefixes:")
+	}
+	for _, prefix := range slices.Sorted(maps.Keys(stats.Prefixes)) {
+		p := stats.Prefixes[prefix]
+		name := prefix + "/"
+		if prefix == "" {
+			name = "(none)"
+		}
+		fmt.Printf("  %-20v %5v  %v\n", name, p.Keys, formatSize(p.Size))
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// The most bytes a value may have unless the config file sets max-value-size
+const defaultMaxValueSize = 16 << 20
+
+// Returns the value to stow: the whole of --from-file, --value, or a line
+// read from stdin, reading no more than limit bytes of a file or stdin unless
+// limit is 0. Returns an error if unsuccessful, including
+// libdepot.ErrTooLarge if the value is longer than that.
+func stowValue(opts options, limit int) (string, error) {
+	if opts.value != "" {
+		return opts.value, nil
+	} else if opts.fromFile == "" {
+		return getVal(opts.secret, limit)
+	}
+
+	f, err := os.Open(opts.fromFile)
+	if err != nil {
+		return "", fmt.Errorf("cannot read value: %w", err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(limitReader(f, limit))
+	if errors.Is(err, libdepot.ErrTooLarge) {
+		return "", fmt.Errorf("%v: %w", opts.fromFile, err)
+	} else if err != nil {
+		return "", fmt.Errorf("cannot read value: %w", err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return "", fmt.Errorf("value must be a non-empty string")
+	}
+
+	return string(data), nil
+}
+
+// Returns a reader of r that fails with libdepot.ErrTooLarge as soon as more
+// than limit bytes have been read from it, so that a runaway pipe is stopped
+// before it fills memory, or r itself if limit is 0
+func limitReader(r io.Reader, limit int) io.Reader {
+	if limit <= 0 {
+		return r
+	}
+
+	return &sizeLimiter{r: r, limit: int64(limit)}
+}
+
+// A reader that fails once more than limit bytes are read from r
+type sizeLimiter struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+func (l *sizeLimiter) Read(p []byte) (int, error) {
+	// Read one byte past the limit to tell a value of exactly the limit
+	// from a longer one
+	if left := l.limit - l.read + 1; int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := l.r.Read(p)
+	if l.read += int64(n); l.read > l.limit {
+		return 0, fmt.Errorf("%w: more than %d bytes", libdepot.ErrTooLarge, l.limit)
+	}
+
+	return n, err
+}
+
+// Stows every key and value read from stdin, or from --from-file, all at
+// once and with a single password for -s. Returns an error if unsuccessful.
+func stowBatch(storage *libdepot.Depot, opts options) error {
+	var data []byte
+	var err error
+	if opts.fromFile != "" {
+		data, err = os.ReadFile(opts.fromFile)
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read values: %w", err)
+	}
+	vals, err := parseBatch(data)
+	if err != nil {
+		return err
+	}
+	if len(vals) == 0 {
+		return errors.New("no keys and values were read from stdin")
+	}
+
+	password, err := getNewPassword(opts.secret, opts.hasKey())
+	if err != nil {
+		return err
+	}
+	if err = storage.StowAll(vals, password); err != nil {
+		return err
+	}
+	log.Printf("Stowed %v keys\n", len(vals))
+
+	return nil
+}
+
+// Returns the keys and values in data, which is either a JSON object of
+// strings or key=value lines as in a .env file. Blank lines and lines
+// starting with # are skipped, export in front of a key is ignored, and a
+// value may be quoted, with escapes inside double quotes. Returns an error if
+// unsuccessful, including when a value is empty.
+func parseBatch(data []byte) (map[string]string, error) {
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("{")) {
+		var vals map[string]string
+		if err := json.Unmarshal(trimmed, &vals); err != nil {
+			return nil, fmt.Errorf("invalid JSON object: %w", err)
+		}
+		for key, val := range vals {
+			if key == "" || strings.TrimSpace(val) == "" {
+				return nil, fmt.Errorf("%q needs a key and a non-empty value", key)
+			}
+			vals[key] = strings.TrimSpace(val)
+		}
+		return vals, nil
+	}
+
+	vals := map[string]string{}
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, val, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %v: expected key=value", n+1)
+		}
+		val, err := unquote(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", n+1, err)
+		}
+		if val == "" {
+			return nil, fmt.Errorf("line %v: value of %v must be a non-empty string", n+1, key)
+		}
+		vals[key] = val
+	}
+
+	return vals, nil
+}
+
+// Returns s without the single or double quotes around it, if it has them,
+// or an error if a double-quoted s holds an invalid escape
+func unquote(s string) (string, error) {
+	if len(s) < 2 || s[0] != s[len(s)-1] {
+		return s, nil
+	}
+
+	switch s[0] {
+	case '"':
+		val, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted value: %v", s)
+		}
+		return val, nil
+	case '\'':
+		return s[1 : len(s)-1], nil
+	}
+
+	return s, nil
+}
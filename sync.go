@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Ways of settling conflicts that can be given with --conflict
+const (
+	conflictNewest   = "newest"
+	conflictPrompt   = "prompt"
+	conflictKeepBoth = "keep-both"
+)
+
+// Merges the depot with the one at the path or URI given as the key, or
+// with the secrets at a vault:// path. Returns an error if unsuccessful.
+func syncDepot(storage *libdepot.Depot, opts options) error {
+	var resolve libdepot.ConflictFunc
+	switch opts.conflict {
+	case conflictNewest:
+		resolve = libdepot.NewestWins
+	case conflictPrompt:
+		resolve = promptConflict
+	case conflictKeepBoth:
+		resolve = func(_, _ *libdepot.Entry) (libdepot.Resolution, error) {
+			return libdepot.KeepBoth, nil
+		}
+	default:
+		return fmt.Errorf("unknown conflict resolution: %v", opts.conflict)
+	}
+
+	if path, ok := strings.CutPrefix(opts.key, "vault://"); ok {
+		return syncVault(storage, path, resolve, opts)
+	}
+
+	depotOpts, err := depotOptions(opts)
+	if err != nil {
+		return err
+	}
+	other, err := libdepot.NewDepot(opts.key, depotOpts...)
+	if err != nil {
+		return err
+	}
+	defer other.Close()
+
+	stats, err := storage.Sync(other, resolve)
+	if err != nil {
+		return err
+	}
+	log.Printf("Pulled %v, pushed %v, %v conflicts\n", stats.Pulled, stats.Pushed, stats.Conflicts)
+
+	return nil
+}
+
+// Merges the keys under path, the mount of a Vault KV version 2 engine
+// followed by a directory in it, with the secrets there, reaching Vault as
+// its own CLI does. Returns an error if unsuccessful.
+func syncVault(storage *libdepot.Depot, path string, resolve libdepot.ConflictFunc, opts options) error {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		addr = "https://127.0.0.1:8200"
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			data, _ := os.ReadFile(filepath.Join(home, ".vault-token"))
+			token = strings.TrimSpace(string(data))
+		}
+	}
+	if token == "" {
+		return errors.New("no vault token, set VAULT_TOKEN or run vault login")
+	}
+	v, err := libdepot.NewVault(addr, token, os.Getenv("VAULT_NAMESPACE"))
+	if err != nil {
+		return err
+	}
+
+	password, err := getPassword(true, opts.hasKey())
+	if err != nil {
+		return err
+	}
+
+	mount, dir, _ := strings.Cut(path, "/")
+	stats, err := storage.SyncVault(v, mount, dir, password, resolve)
+	if err != nil {
+		return err
+	}
+	log.Printf("Pulled %v, pushed %v, %v conflicts\n", stats.Pulled, stats.Pushed, stats.Conflicts)
+
+	return nil
+}
+
+// Describes one side of a conflict for the user
+func describeEntry(e *libdepot.Entry) string {
+	if e.Deleted {
+		return "dropped " + e.Modified.Local().Format(time.DateTime)
+	}
+
+	desc := "modified " + e.Modified.Local().Format(time.DateTime)
+	if e.Nonce != nil {
+		desc += " (encrypted)"
+	} else if e.Compression != libdepot.CompressionNone {
+		desc += " (compressed)"
+	} else {
+		desc += ": " + e.Val
+	}
+
+	return desc
+}
+
+// A ConflictFunc that asks the user at the terminal which entry to keep
+func promptConflict(local, remote *libdepot.Entry) (libdepot.Resolution, error) {
+	tty, err := openPrompt()
+	if err != nil {
+		return 0, err
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "Conflict for %v\n", local.Key)
+	fmt.Fprintf(tty, "    local:  %v\n", describeEntry(local))
+	fmt.Fprintf(tty, "    remote: %v\n", describeEntry(remote))
+	in := bufio.NewReader(tty)
+	for {
+		fmt.Fprint(tty, "Keep [l]ocal, [r]emote, or [b]oth? ")
+		answer, err := in.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "l", "local":
+			return libdepot.KeepLocal, nil
+		case "r", "remote":
+			return libdepot.KeepRemote, nil
+		case "b", "both":
+			return libdepot.KeepBoth, nil
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// The name of the systemd credential that a service running depot may be
+// given the depot's password in, with LoadCredentialEncrypted= say
+const passCredential = "depot-pass"
+
+// Encrypts the value of the key with systemd-creds, under the name of the key
+// with its slashes made dashes, and prints it as a SetCredentialEncrypted=
+// line for a unit file or, with --out, writes it to the given file for
+// LoadCredentialEncrypted=. Returns an error if unsuccessful.
+func systemdCredential(storage *libdepot.Depot, key string, opts options) error {
+	info, err := storage.Info(key)
+	if err != nil {
+		return err
+	}
+	password, err := getPassword(info.Encrypted, opts.hasKey())
+	if err != nil {
+		return err
+	}
+	val, err := storage.Fetch(key, password)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"encrypt", "--name=" + credentialName(key), "-", "-"}
+	if opts.out == "" {
+		args = append(args, "--pretty")
+	}
+	cmd := exec.Command("systemd-creds", args...)
+	cmd.Stdin = strings.NewReader(val)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("systemd-creds: %w", err)
+	}
+	if opts.out != "" {
+		return writePrivate(opts.out, out)
+	}
+	_, err = os.Stdout.Write(out)
+
+	return err
+}
+
+// Returns the name of the systemd credential holding the value of the key
+func credentialName(key string) string {
+	return strings.ReplaceAll(key, "/", "-")
+}
+
+// Returns the depot's password from the credential systemd gave the service
+// running depot as depot-pass, or false if there is none
+func credentialPassword() ([]byte, bool) {
+	dir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if dir == "" {
+		return nil, false
+	}
+	p, err := os.ReadFile(filepath.Join(dir, passCredential))
+	if err != nil || len(p) == 0 {
+		return nil, false
+	}
+
+	return bytes.TrimSuffix(p, []byte("\n")), true
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Renders the Go template in the file at path, in which {{depot "key"}}
+// expands to the value of the key, and writes the result to stdout or to the
+// file given by --out, which only the user may read. The password is asked
+// for at most once. Nothing is written if rendering fails. Returns an error
+// if unsuccessful.
+func renderTemplate(storage *libdepot.Depot, path string, opts options) error {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read template: %w", err)
+	}
+
+	f := fetcher{storage: storage, hasKey: opts.hasKey()}
+	tmpl, err := template.New(filepath.Base(path)).
+		Funcs(template.FuncMap{"depot": f.fetch}).
+		Option("missingkey=error").
+		Parse(string(text))
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err = tmpl.Execute(&out, nil); err != nil {
+		return err
+	}
+	if opts.out == "" {
+		_, err = os.Stdout.Write(out.Bytes())
+		return err
+	}
+
+	return writePrivate(opts.out, out.Bytes())
+}
+
+// Replaces the file at path with one holding data that only the user may
+// read, never leaving a partly written file behind. Returns an error if
+// unsuccessful.
+func writePrivate(path string, data []byte) error {
+	return writePrivateWith(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// Replaces the file at path as writePrivate does with what write writes to
+// it. Returns an error if unsuccessful.
+func writePrivateWith(path string, write func(io.Writer) error) error {
+	// CreateTemp makes files only the user may read
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = write(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
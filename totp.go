@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Prints the current code of the TOTP seed stored under the key, as an
+// otpauth:// URI or a base32 secret, or copies it to the clipboard. How long
+// the code is still valid for goes to stderr, so that stdout holds only the
+// code. Returns an error if unsuccessful.
+func printTOTP(storage *libdepot.Depot, opts options) error {
+	vals, err := fetchValues(storage, []string{opts.key}, opts.hasKey())
+	if err != nil {
+		return err
+	}
+	totp, err := libdepot.ParseTOTP(strings.TrimSpace(vals[0]))
+	if err != nil {
+		return err
+	}
+
+	code, remaining := totp.Code(time.Now())
+	if opts.clip {
+		return clip(opts.key, code)
+	} else if !opts.noNewline {
+		fmt.Println(code)
+	} else {
+		fmt.Print(code)
+	}
+	log.Printf("Valid for %v\n", remaining)
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Copies the keys matching the given patterns to the depot at --to, or from
+// the one at --from, and drops them from where they were with --move. An
+// encrypted value is encrypted again under the other depot's salt, which asks
+// for its password, unless the depots share one. Keys that exist in the
+// destination are only replaced with --force. Returns an error if
+// unsuccessful.
+func transfer(storage *libdepot.Depot, opts options) error {
+	depotOpts, err := depotOptions(opts)
+	if err != nil {
+		return err
+	}
+	other, err := libdepot.NewDepot(opts.to+opts.from, depotOpts...)
+	if err != nil {
+		return err
+	}
+	defer other.Close()
+
+	src, dst := storage, other
+	if opts.from != "" {
+		src, dst = other, storage
+	}
+	patterns := append([]string{opts.key}, opts.extraKeys...)
+
+	n, err := src.Transfer(dst, patterns, nil, opts.move, opts.force)
+	if errors.Is(err, libdepot.ErrPasswordNeeded) {
+		// Only this depot may be unlocked, so the other one still needs the
+		// password typed
+		var password []byte
+		if password, err = getPassword(true, opts.keyfile != ""); err != nil {
+			return err
+		}
+		n, err = src.Transfer(dst, patterns, password, opts.move, opts.force)
+	}
+	if errors.Is(err, libdepot.ErrExists) {
+		return fmt.Errorf("%w, use --force to replace it", err)
+	} else if err != nil {
+		return err
+	}
+
+	verb := "Copied"
+	if opts.move {
+		verb = "Moved"
+	}
+	log.Printf("%v %v keys\n", verb, n)
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/adonSh/depot/libdepot"
+	"golang.org/x/term"
+)
+
+// What trash may be asked to do
+const (
+	trashList    = "list"
+	trashRestore = "restore"
+	trashEmpty   = "empty"
+)
+
+// Lists the dropped keys whose values are still in the trash, restores the
+// given keys from it, or empties it of the keys matching the given patterns
+// (or of every key), asking first when run from a terminal unless --force is
+// given. Returns an error if unsuccessful.
+func trash(storage *libdepot.Depot, opts options) error {
+	patterns := opts.extraKeys
+	if len(patterns) == 0 {
+		patterns = []string{""}
+	}
+
+	switch opts.key {
+	case trashList:
+		if opts.format != "" && opts.format != libdepot.FormatJSON {
+			return fmt.Errorf("invalid format for trash: %v", opts.format)
+		}
+		var keys []libdepot.KeyInfo
+		for _, pattern := range patterns {
+			matched, err := storage.Trash(pattern)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, matched...)
+		}
+		if opts.format == libdepot.FormatJSON {
+			return printJSON(keys)
+		}
+		for _, k := range keys {
+			kind := "plain"
+			if k.Encrypted {
+				kind = "encrypted"
+			}
+			fmt.Printf("dropped %v  %-9v  %v\n", k.Modified.Local().Format(time.DateTime), kind, k.Key)
+		}
+	case trashRestore:
+		if len(opts.extraKeys) == 0 {
+			return errors.New("give the keys to restore")
+		}
+		for _, key := range opts.extraKeys {
+			err := storage.Undrop(key)
+			if errors.Is(err, libdepot.ErrNotFound) {
+				return fmt.Errorf("%v is not in the trash", key)
+			} else if errors.Is(err, libdepot.ErrExists) {
+				return fmt.Errorf("%v exists, so there is nothing to restore", key)
+			} else if err != nil {
+				return err
+			}
+			log.Printf("Restored %v\n", key)
+		}
+	case trashEmpty:
+		if !opts.force && !nonInteractive && term.IsTerminal(int(os.Stdin.Fd())) {
+			ok, err := confirm("Remove the values in the trash for good?")
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+		}
+		emptied := 0
+		for _, pattern := range patterns {
+			n, err := storage.EmptyTrash(pattern)
+			emptied += n
+			if err != nil {
+				return err
+			}
+		}
+		log.Printf("Emptied %v keys from the trash\n", emptied)
+	default:
+		return fmt.Errorf("trash can only %v, %v, or %v", trashList, trashRestore, trashEmpty)
+	}
+
+	return nil
+}
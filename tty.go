@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// The terminal the user is at, opened apart from stdin and stdout so that
+// prompts reach the user even when those are redirected
+type tty struct {
+	in  *os.File
+	out *os.File
+}
+
+func (t *tty) Read(p []byte) (int, error) {
+	return t.in.Read(p)
+}
+
+func (t *tty) Write(p []byte) (int, error) {
+	return t.out.Write(p)
+}
+
+// Reads a line from the terminal without echoing it. Returns an error if
+// unsuccessful.
+func (t *tty) ReadPassword() ([]byte, error) {
+	return term.ReadPassword(int(t.in.Fd()))
+}
+
+func (t *tty) Close() error {
+	err := t.in.Close()
+	if t.out != t.in {
+		if outErr := t.out.Close(); err == nil {
+			err = outErr
+		}
+	}
+
+	return err
+}
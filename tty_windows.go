@@ -0,0 +1,24 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+)
+
+// Opens the console, whose input and output are separate files on Windows,
+// or returns an error if unsuccessful. The input is opened for writing too,
+// since changing its mode to hide a password needs that.
+func openTTY() (*tty, error) {
+	in, err := os.OpenFile("CONIN$", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	out, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0)
+	if err != nil {
+		in.Close()
+		return nil, err
+	}
+
+	return &tty{in, out}, nil
+}
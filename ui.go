@@ -0,0 +1,351 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// What the terminal UI is showing
+type uiState int
+
+const (
+	uiBrowsing uiState = iota
+	uiViewing
+	uiAskingPassword
+	uiConfirmingDrop
+)
+
+// What to do with a key once its value has been fetched
+type uiIntent int
+
+const (
+	uiView uiIntent = iota
+	uiEdit
+)
+
+var (
+	uiTitleStyle = lipgloss.NewStyle().Bold(true)
+	uiFaintStyle = lipgloss.NewStyle().Faint(true)
+	uiErrorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	uiPaneStyle  = lipgloss.NewStyle().Padding(1, 2)
+	uiViewKeys   = "e edit • d drop • esc back"
+	uiBrowseKeys = []key.Binding{
+		key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "view")),
+		key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "edit")),
+		key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "drop")),
+	}
+)
+
+// A key as shown in the list
+type uiItem libdepot.KeyInfo
+
+func (i uiItem) Title() string {
+	return i.Key
+}
+
+func (i uiItem) Description() string {
+	kind := "plain"
+	if i.Encrypted {
+		kind = "encrypted"
+	}
+
+	return kind + " • modified " + i.Modified.Local().Format(time.DateTime)
+}
+
+func (i uiItem) FilterValue() string {
+	return i.Key
+}
+
+// Sent when the editor opened on a value has closed
+type uiEditedMsg struct {
+	cmd *exec.Cmd
+	err error
+}
+
+// The terminal UI for browsing a depot
+type uiModel struct {
+	storage *libdepot.Depot
+	state   uiState
+
+	// The password entered for encrypted values, which is used for every
+	// one of them until it fails
+	password []byte
+
+	list  list.Model
+	input textinput.Model
+	pager viewport.Model
+
+	// The key being viewed, edited, or dropped, what to do with it once its
+	// password is known, and its value
+	item   uiItem
+	intent uiIntent
+	val    string
+
+	// Shown below whatever is on screen until the next key is pressed
+	err error
+}
+
+// Runs the terminal UI for browsing, searching, viewing, editing, and dropping
+// the keys in the depot. Returns an error if unsuccessful.
+func runUI(storage *libdepot.Depot, opts options) error {
+	if nonInteractive {
+		return errNonInteractive
+	}
+	m := uiModel{storage: storage}
+	if p, ok, err := presetPassword(); err != nil {
+		return err
+	} else if ok {
+		m.password = p
+	} else if opts.hasKey() {
+		m.password = []byte{}
+	}
+
+	m.list = list.New(nil, list.NewDefaultDelegate(), 0, 0)
+	m.list.Title = "depot"
+	m.list.SetStatusBarItemName("key", "keys")
+	m.list.AdditionalShortHelpKeys = func() []key.Binding { return uiBrowseKeys }
+	m.list.AdditionalFullHelpKeys = func() []key.Binding { return uiBrowseKeys }
+	if err := m.reload(); err != nil {
+		return err
+	}
+
+	m.input = textinput.New()
+	m.input.EchoMode = textinput.EchoPassword
+	m.input.Prompt = "Password: "
+	m.pager = viewport.New(0, 0)
+
+	_, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+	return err
+}
+
+// Fills the list with the keys in the depot. Returns an error if
+// unsuccessful.
+func (m *uiModel) reload() error {
+	keys, err := m.storage.List("")
+	if err != nil {
+		return err
+	}
+
+	items := make([]list.Item, len(keys))
+	for i, k := range keys {
+		items[i] = uiItem(k)
+	}
+	m.list.SetItems(items)
+
+	return nil
+}
+
+func (m uiModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m uiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		w, h := uiPaneStyle.GetFrameSize()
+		m.list.SetSize(msg.Width-w, msg.Height-h)
+		// Leave room for the key above the value and the help below it
+		m.pager.Width, m.pager.Height = msg.Width-w, msg.Height-h-4
+		return m, nil
+	case uiEditedMsg:
+		m.err = m.finishEdit(msg)
+		return m, nil
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		if m.list.FilterState() != list.Filtering {
+			m.err = nil
+		}
+	}
+
+	switch m.state {
+	case uiViewing:
+		return m.updateViewing(msg)
+	case uiAskingPassword:
+		return m.updateAskingPassword(msg)
+	case uiConfirmingDrop:
+		return m.updateConfirmingDrop(msg)
+	default:
+		return m.updateBrowsing(msg)
+	}
+}
+
+func (m uiModel) updateBrowsing(msg tea.Msg) (tea.Model, tea.Cmd) {
+	item, selected := m.list.SelectedItem().(uiItem)
+	if msg, ok := msg.(tea.KeyMsg); ok && selected && m.list.FilterState() != list.Filtering {
+		switch msg.String() {
+		case "enter":
+			m.item = item
+			return m.open(uiView)
+		case "e":
+			m.item = item
+			return m.open(uiEdit)
+		case "d":
+			m.item = item
+			m.state = uiConfirmingDrop
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m uiModel) updateViewing(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc", "q":
+			m.val = ""
+			m.pager.SetContent("")
+			m.state = uiBrowsing
+			return m, nil
+		case "e":
+			return m.open(uiEdit)
+		case "d":
+			m.state = uiConfirmingDrop
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.pager, cmd = m.pager.Update(msg)
+	return m, cmd
+}
+
+func (m uiModel) updateAskingPassword(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc":
+			m.input.Reset()
+			m.state = uiBrowsing
+			return m, nil
+		case "enter":
+			m.password = []byte(m.input.Value())
+			m.input.Reset()
+			m.input.Blur()
+			return m.open(m.intent)
+		}
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m uiModel) updateConfirmingDrop(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	m.state = uiBrowsing
+	if keyMsg.String() != "y" {
+		return m, nil
+	}
+	if m.err = m.storage.Drop(m.item.Key); m.err == nil {
+		m.err = m.reload()
+	}
+	m.val = ""
+
+	return m, nil
+}
+
+// Fetches the value of the selected key and views or edits it, asking for the
+// password first if it is needed
+func (m uiModel) open(intent uiIntent) (tea.Model, tea.Cmd) {
+	m.intent = intent
+	val, err := m.storage.Fetch(m.item.Key, m.password)
+	if errors.Is(err, libdepot.ErrPasswordNeeded) || errors.Is(err, libdepot.ErrBadPassword) {
+		if m.password != nil {
+			m.err = err
+		}
+		m.password = nil
+		m.state = uiAskingPassword
+		return m, m.input.Focus()
+	} else if err != nil {
+		m.err = err
+		m.state = uiBrowsing
+		return m, nil
+	}
+	m.val = val
+
+	if intent == uiEdit {
+		if m.state == uiAskingPassword {
+			m.state = uiBrowsing
+		}
+		cmd, err := startEdit(m.item.Key, val)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		return m, tea.ExecProcess(cmd, func(err error) tea.Msg {
+			return uiEditedMsg{cmd, err}
+		})
+	}
+
+	m.pager.SetContent(val)
+	m.pager.GotoTop()
+	m.state = uiViewing
+	return m, nil
+}
+
+// Stows the value saved in the editor, encrypted if it was before with the
+// same password, which is not judged again. Returns an error if
+// unsuccessful.
+func (m *uiModel) finishEdit(msg uiEditedMsg) error {
+	edited, err := finishEdit(msg.cmd, msg.err)
+	if err != nil {
+		return err
+	}
+	if edited == "" {
+		return fmt.Errorf("value must be a non-empty string")
+	}
+	if edited == m.val {
+		return nil
+	}
+
+	var password []byte
+	if m.item.Encrypted {
+		password = m.password
+	}
+	if err = m.storage.Replace(m.item.Key, edited, password); err != nil {
+		return err
+	}
+	m.val = edited
+	m.pager.SetContent(edited)
+
+	return m.reload()
+}
+
+func (m uiModel) View() string {
+	var view string
+	switch m.state {
+	case uiViewing:
+		view = uiTitleStyle.Render(m.item.Key) + "\n\n" + m.pager.View() + "\n" + uiFaintStyle.Render(uiViewKeys)
+	case uiAskingPassword:
+		view = uiTitleStyle.Render(m.item.Key) + "\n\n" + m.input.View()
+	case uiConfirmingDrop:
+		view = uiTitleStyle.Render(fmt.Sprintf("Drop %v? (y/n)", m.item.Key))
+	default:
+		view = m.list.View()
+	}
+
+	if m.err != nil {
+		view += "\n\n" + uiErrorStyle.Render("Error: "+m.err.Error())
+	}
+
+	return uiPaneStyle.Render(view)
+}
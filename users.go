@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/adonSh/depot/libdepot"
+)
+
+// Adds the user named by the key to the depot and prints their token.
+// Returns an error if unsuccessful.
+func addUser(storage *libdepot.Depot, opts options) error {
+	token, err := storage.AddUser(opts.key, opts.admin)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Added %v, who authenticates with the token below (It will not be shown again!)\n", opts.key)
+	fmt.Println(token)
+	return nil
+}
+
+// Prints the users of the depot and what they may do. Returns an error if
+// unsuccessful.
+func listUsers(storage *libdepot.Depot) error {
+	users, err := storage.Users()
+	if err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		if u.Admin {
+			fmt.Printf("%v (admin)\n", u.Name)
+			continue
+		}
+		fmt.Println(u.Name)
+		for _, r := range u.Rules {
+			prefix := r.Prefix
+			if prefix == "" {
+				prefix = "(every key)"
+			}
+			fmt.Printf("    %-2v  %v\n", r.Perm, prefix)
+		}
+	}
+
+	return nil
+}
+
+// Grants the user named by the key the permission given with --perm on the
+// keys beginning with --prefix. Returns an error if unsuccessful.
+func grant(storage *libdepot.Depot, opts options) error {
+	perm, err := libdepot.ParsePermission(opts.perm)
+	if err != nil {
+		return err
+	}
+
+	return storage.Grant(opts.key, opts.prefix, perm)
+}